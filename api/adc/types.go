@@ -36,6 +36,7 @@ const (
 	TypeSSL            = "ssl"
 	TypeGlobalRule     = "global_rule"
 	TypePluginMetadata = "plugin_metadata"
+	TypeProto          = "proto"
 )
 
 type Object interface {
@@ -44,6 +45,9 @@ type Object interface {
 
 // +k8s:deepcopy-gen=true
 type Metadata struct {
+	// ID is an optional custom ID, generated from the name when empty. It
+	// becomes a segment of the etcd key of the resource, so only letters,
+	// digits, '.', '-' and '_' are accepted.
 	ID     string            `json:"id,omitempty" yaml:"id,omitempty"`
 	Name   string            `json:"name,omitempty" yaml:"name,omitempty"`
 	Desc   string            `json:"description,omitempty" yaml:"description,omitempty"`
@@ -57,6 +61,7 @@ type Resources struct {
 	Consumers      []*Consumer      `json:"consumers,omitempty" yaml:"consumers,omitempty"`
 	GlobalRules    GlobalRule       `json:"global_rules,omitempty" yaml:"global_rules,omitempty"`
 	PluginMetadata PluginMetadata   `json:"plugin_metadata,omitempty" yaml:"plugin_metadata,omitempty"`
+	Protos         []*Proto         `json:"protos,omitempty" yaml:"protos,omitempty"`
 	Services       []*Service       `json:"services,omitempty" yaml:"services,omitempty"`
 	SSLs           []*SSL           `json:"ssls,omitempty" yaml:"ssls,omitempty"`
 }
@@ -113,6 +118,7 @@ type Credential struct {
 type Service struct {
 	Metadata `json:",inline" yaml:",inline"`
 
+	EnableWebsocket *bool          `json:"enable_websocket,omitempty" yaml:"enable_websocket,omitempty"`
 	Hosts           []string       `json:"hosts,omitempty" yaml:"hosts,omitempty"`
 	PathPrefix      string         `json:"path_prefix,omitempty" yaml:"path_prefix,omitempty"`
 	Plugins         Plugins        `json:"plugins,omitempty" yaml:"plugins,omitempty"`
@@ -127,22 +133,35 @@ type Service struct {
 type Route struct {
 	Metadata `json:",inline" yaml:",inline"`
 
-	EnableWebsocket *bool    `json:"enable_websocket,omitempty" yaml:"enable_websocket,omitempty"`
-	FilterFunc      string   `json:"filter_func,omitempty" yaml:"filter_func,omitempty"`
-	Hosts           []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
-	Methods         []string `json:"methods,omitempty" yaml:"methods,omitempty"`
-	Plugins         Plugins  `json:"plugins,omitempty" yaml:"plugins,omitempty"`
-	Priority        *int64   `json:"priority,omitempty" yaml:"priority,omitempty"`
-	RemoteAddrs     []string `json:"remote_addrs,omitempty" yaml:"remote_addrs,omitempty"`
-	Timeout         *Timeout `json:"timeout,omitempty" yaml:"timeout,omitempty"`
-	Uris            []string `json:"uris" yaml:"uris"`
-	Vars            Vars     `json:"vars,omitempty" yaml:"vars,omitempty"`
+	EnableWebsocket *bool     `json:"enable_websocket,omitempty" yaml:"enable_websocket,omitempty"`
+	FilterFunc      string    `json:"filter_func,omitempty" yaml:"filter_func,omitempty"`
+	Hosts           []string  `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Methods         []string  `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Plugins         Plugins   `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	Priority        *int64    `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Status          *int64    `json:"status,omitempty" yaml:"status,omitempty"`
+	RemoteAddrs     []string  `json:"remote_addrs,omitempty" yaml:"remote_addrs,omitempty"`
+	Timeout         *Timeout  `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Upstream        *Upstream `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	UpstreamID      string    `json:"upstream_id,omitempty" yaml:"upstream_id,omitempty"`
+	Uris            []string  `json:"uris" yaml:"uris"`
+	Vars            Vars      `json:"vars,omitempty" yaml:"vars,omitempty"`
+}
+
+// Timeout holds upstream timeouts in seconds, fractions of a second
+// included
+type Timeout struct {
+	Connect float64 `json:"connect"`
+	Read    float64 `json:"read"`
+	Send    float64 `json:"send"`
 }
 
-type Timeout struct {
-	Connect int `json:"connect"`
-	Read    int `json:"read"`
-	Send    int `json:"send"`
+// Proto holds a protobuf definition referenced by the grpc-transcode plugin
+// +k8s:deepcopy-gen=true
+type Proto struct {
+	Metadata `json:",inline" yaml:",inline"`
+
+	Content string `json:"content" yaml:"content"`
 }
 
 // +k8s:deepcopy-gen=true
@@ -172,8 +191,9 @@ type Upstream struct {
 	Type         UpstreamType  `json:"type,omitempty" yaml:"type,omitempty"`
 	UpstreamHost string        `json:"upstream_host,omitempty" yaml:"upstream_host,omitempty"`
 
-	Checks *UpstreamHealthCheck `json:"checks,omitempty" yaml:"checks,omitempty"`
-	TLS    *ClientTLS           `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Checks        *UpstreamHealthCheck   `json:"checks,omitempty" yaml:"checks,omitempty"`
+	TLS           *ClientTLS             `json:"tls,omitempty" yaml:"tls,omitempty"`
+	KeepalivePool *UpstreamKeepalivePool `json:"keepalive_pool,omitempty" yaml:"keepalive_pool,omitempty"`
 	// for Service Discovery
 	DiscoveryType string            `json:"discovery_type,omitempty" yaml:"discovery_type,omitempty"`
 	DiscoveryArgs map[string]string `json:"discovery_args,omitempty" yaml:"discovery_args,omitempty"`
@@ -195,6 +215,14 @@ type ClientTLS struct {
 	Key  string `json:"client_key,omitempty" yaml:"client_key,omitempty"`
 }
 
+// UpstreamKeepalivePool configures the connection pool kept to upstream nodes
+// +k8s:deepcopy-gen=true
+type UpstreamKeepalivePool struct {
+	Size        int64   `json:"size,omitempty" yaml:"size,omitempty"`
+	IdleTimeout float64 `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	Requests    int64   `json:"requests,omitempty" yaml:"requests,omitempty"`
+}
+
 // UpstreamActiveHealthCheck defines the active upstream health check configuration.
 // +k8s:deepcopy-gen=true
 type UpstreamActiveHealthCheck struct {
@@ -204,7 +232,8 @@ type UpstreamActiveHealthCheck struct {
 	Host               string                             `json:"host,omitempty" yaml:"host,omitempty"`
 	Port               int32                              `json:"port,omitempty" yaml:"port,omitempty"`
 	HTTPPath           string                             `json:"http_path,omitempty" yaml:"http_path,omitempty"`
-	HTTPSVerifyCert    bool                               `json:"https_verify_cert,omitempty" yaml:"https_verify_cert,omitempty"`
+	HTTPSVerifyCert    *bool                              `json:"https_verify_cert,omitempty" yaml:"https_verify_cert,omitempty"`
+	HTTPSSni           string                             `json:"https_sni,omitempty" yaml:"https_sni,omitempty"`
 	HTTPRequestHeaders []string                           `json:"req_headers,omitempty" yaml:"req_headers,omitempty"`
 	Healthy            UpstreamActiveHealthCheckHealthy   `json:"healthy,omitempty" yaml:"healthy,omitempty"`
 	Unhealthy          UpstreamActiveHealthCheckUnhealthy `json:"unhealthy,omitempty" yaml:"unhealthy,omitempty"`
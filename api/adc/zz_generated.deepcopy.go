@@ -390,6 +390,22 @@ func (in *Metadata) DeepCopy() *Metadata {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Proto) DeepCopyInto(out *Proto) {
+	*out = *in
+	in.Metadata.DeepCopyInto(&out.Metadata)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Proto.
+func (in *Proto) DeepCopy() *Proto {
+	if in == nil {
+		return nil
+	}
+	out := new(Proto)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Route) DeepCopyInto(out *Route) {
 	*out = *in
@@ -415,6 +431,11 @@ func (in *Route) DeepCopyInto(out *Route) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(int64)
+		**out = **in
+	}
 	if in.RemoteAddrs != nil {
 		in, out := &in.RemoteAddrs, &out.RemoteAddrs
 		*out = make([]string, len(*in))
@@ -425,6 +446,11 @@ func (in *Route) DeepCopyInto(out *Route) {
 		*out = new(Timeout)
 		**out = **in
 	}
+	if in.Upstream != nil {
+		in, out := &in.Upstream, &out.Upstream
+		*out = new(Upstream)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Uris != nil {
 		in, out := &in.Uris, &out.Uris
 		*out = make([]string, len(*in))
@@ -500,6 +526,11 @@ func (in *SSL) DeepCopy() *SSL {
 func (in *Service) DeepCopyInto(out *Service) {
 	*out = *in
 	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.EnableWebsocket != nil {
+		in, out := &in.EnableWebsocket, &out.EnableWebsocket
+		*out = new(bool)
+		**out = **in
+	}
 	if in.Hosts != nil {
 		in, out := &in.Hosts, &out.Hosts
 		*out = make([]string, len(*in))
@@ -718,6 +749,11 @@ func (in *Upstream) DeepCopyInto(out *Upstream) {
 		*out = new(ClientTLS)
 		**out = **in
 	}
+	if in.KeepalivePool != nil {
+		in, out := &in.KeepalivePool, &out.KeepalivePool
+		*out = new(UpstreamKeepalivePool)
+		**out = **in
+	}
 	if in.DiscoveryArgs != nil {
 		in, out := &in.DiscoveryArgs, &out.DiscoveryArgs
 		*out = make(map[string]string, len(*in))
@@ -740,6 +776,11 @@ func (in *Upstream) DeepCopy() *Upstream {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UpstreamActiveHealthCheck) DeepCopyInto(out *UpstreamActiveHealthCheck) {
 	*out = *in
+	if in.HTTPSVerifyCert != nil {
+		in, out := &in.HTTPSVerifyCert, &out.HTTPSVerifyCert
+		*out = new(bool)
+		**out = **in
+	}
 	if in.HTTPRequestHeaders != nil {
 		in, out := &in.HTTPRequestHeaders, &out.HTTPRequestHeaders
 		*out = make([]string, len(*in))
@@ -816,6 +857,21 @@ func (in *UpstreamHealthCheck) DeepCopy() *UpstreamHealthCheck {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpstreamKeepalivePool) DeepCopyInto(out *UpstreamKeepalivePool) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpstreamKeepalivePool.
+func (in *UpstreamKeepalivePool) DeepCopy() *UpstreamKeepalivePool {
+	if in == nil {
+		return nil
+	}
+	out := new(UpstreamKeepalivePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UpstreamPassiveHealthCheck) DeepCopyInto(out *UpstreamPassiveHealthCheck) {
 	*out = *in
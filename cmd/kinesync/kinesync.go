@@ -0,0 +1,363 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Command kinesync runs the kine sync pipeline of the controller outside of
+// the cluster, to validate, plan and apply ADC resource files and to export
+// the cached state.
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/adc/client"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// syncFlags are the flags describing a sync, shared by the commands running
+// one
+type syncFlags struct {
+	file             string
+	labels           map[string]string
+	types            []string
+	strictTypes      bool
+	bestEffort       bool
+	namespacedIDs    bool
+	sharedUpstreams  bool
+	splitUpstreams   bool
+	derivePriorities bool
+	routeTimeouts    bool
+	validatePlugins  bool
+	pluginSchemaDir  string
+	zeroWeight       string
+	globalRuleMode   string
+	force            bool
+	timeout          time.Duration
+	verbose          bool
+}
+
+func (f *syncFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.file, "file", "f", "", "ADC resource file to sync, in JSON or YAML")
+	cmd.Flags().StringToStringVar(&f.labels, "label-selector", nil, "labels owning the synced resources")
+	cmd.Flags().StringSliceVar(&f.types, "include-resource-type", nil, "ADC resource types to sync, all when empty")
+	cmd.Flags().BoolVar(&f.strictTypes, "strict-types", false,
+		"fail when --include-resource-type excludes resources present in the file")
+	cmd.Flags().BoolVar(&f.bestEffort, "best-effort", false, "skip invalid resources with a warning")
+	cmd.Flags().BoolVar(&f.namespacedIDs, "namespaced-ids", false, "scope generated IDs by kind and namespace")
+	cmd.Flags().BoolVar(&f.sharedUpstreams, "shared-upstreams", false, "store identical service upstreams once")
+	cmd.Flags().BoolVar(&f.splitUpstreams, "split-upstreams", false,
+		"store the upstreams embedded in traffic-split configs once, referenced by upstream_id")
+	cmd.Flags().BoolVar(&f.derivePriorities, "derive-priorities", false,
+		"derive the priority of routes without one from the specificity of their paths")
+	cmd.Flags().BoolVar(&f.routeTimeouts, "propagate-timeouts", false,
+		"give routes without a timeout the one of the upstream serving them")
+	cmd.Flags().BoolVar(&f.validatePlugins, "validate-plugins", false,
+		"validate plugin configs against the built-in JSON schemas")
+	cmd.Flags().StringVar(&f.pluginSchemaDir, "plugin-schema-dir", "",
+		"directory of plugin JSON schemas named <plugin>.json, overriding the built-in ones; implies --validate-plugins")
+	cmd.Flags().StringVar(&f.zeroWeight, "zero-weight", string(kine.ZeroWeightReject),
+		"services whose upstream nodes all have weight 0: reject, drop-routes or disable-routes")
+	cmd.Flags().StringVar(&f.globalRuleMode, "global-rule-mode", "",
+		"how global rules are written: per-plugin keys or a single aggregated key")
+	cmd.Flags().BoolVar(&f.force, "force", false, "update unchanged resources too, to rewrite them to the gateway")
+	cmd.Flags().DurationVar(&f.timeout, "timeout", 0, "bound the whole sync, unbounded when 0")
+	cmd.Flags().BoolVarP(&f.verbose, "verbose", "v", false, "log the pipeline stages to stderr")
+	_ = cmd.MarkFlagRequired("file")
+}
+
+// args returns the executor arguments of the sync
+func (f *syncFlags) args() []string {
+	args := client.BuildADCExecuteArgs(f.file, f.labels, f.types)
+	if f.strictTypes {
+		args = append(args, "--strict-types")
+	}
+	if f.force {
+		args = append(args, "--force")
+	}
+	if f.timeout > 0 {
+		args = append(args, "--timeout", f.timeout.String())
+	}
+	if f.verbose {
+		// Log every applied event, not only the summary
+		args = append(args, "--v", "1")
+	}
+	return args
+}
+
+// options returns the executor options of the sync
+func (f *syncFlags) options() ([]client.KindExecutorOption, error) {
+	var opts []client.KindExecutorOption
+	if f.bestEffort {
+		opts = append(opts, client.WithBestEffortTransfer())
+	}
+	if f.namespacedIDs {
+		opts = append(opts, client.WithNamespacedIDs())
+	}
+	if f.sharedUpstreams {
+		opts = append(opts, client.WithSharedUpstreams())
+	}
+	if f.splitUpstreams {
+		opts = append(opts, client.WithSplitUpstreams())
+	}
+	if f.derivePriorities {
+		opts = append(opts, client.WithDerivedPriorities())
+	}
+	if f.routeTimeouts {
+		opts = append(opts, client.WithTimeoutPropagation())
+	}
+	if f.zeroWeight != "" {
+		opts = append(opts, client.WithZeroWeightPolicy(kine.ZeroWeightPolicy(f.zeroWeight)))
+	}
+	if f.globalRuleMode != "" {
+		opts = append(opts, client.WithGlobalRuleMode(client.GlobalRuleMode(f.globalRuleMode)))
+	}
+	if f.validatePlugins || f.pluginSchemaDir != "" {
+		validator, err := f.pluginValidator()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithPluginValidator(validator))
+	}
+	return opts, nil
+}
+
+// pluginValidator returns the validator of the built-in plugin schemas,
+// overridden by those of the schema directory
+func (f *syncFlags) pluginValidator() (kine.PluginValidator, error) {
+	schemas := kine.DefaultPluginSchemas()
+	if f.pluginSchemaDir != "" {
+		dirSchemas, err := kine.LoadPluginSchemas(f.pluginSchemaDir)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(schemas, dirSchemas)
+	}
+	return kine.NewSchemaPluginValidator(schemas)
+}
+
+// logger returns the logger of the executor
+func (f *syncFlags) logger() logr.Logger {
+	if !f.verbose {
+		return logr.Discard()
+	}
+	core := zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.AddSync(zapcore.Lock(os.Stderr)),
+		zapcore.InfoLevel,
+	)
+	return zapr.NewLogger(zap.New(core))
+}
+
+func newRootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kinesync [command]",
+		Short:        "Run the kine sync pipeline of apisix-ingress-controller on ADC resource files",
+		SilenceUsage: true,
+	}
+	cmd.AddCommand(newValidateCmd(), newPlanCmd(), newApplyCmd(), newExportCmd())
+	return cmd
+}
+
+func newValidateCmd() *cobra.Command {
+	var flags syncFlags
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Transfer and validate a resource file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			// Validate against an empty in-memory cache, whatever the
+			// environment configures
+			opts, err := flags.options()
+			if err != nil {
+				return err
+			}
+			opts = append(opts, client.WithDiffOnly(),
+				&client.KindExecutorOptions{CacheBackend: client.CacheBackendMemDB})
+			plan, err := runPlan(cmd, &flags, opts)
+			if err != nil {
+				return err
+			}
+			writeWarnings(cmd.OutOrStdout(), plan)
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "%d resources valid\n", len(plan.Events))
+			return err
+		},
+	}
+	flags.register(cmd)
+	return cmd
+}
+
+func newPlanCmd() *cobra.Command {
+	var (
+		flags    syncFlags
+		snapshot string
+	)
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes syncing a resource file would make to a cache snapshot",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts, err := flags.options()
+			if err != nil {
+				return err
+			}
+			opts = append(opts, client.WithDiffOnly(), client.WithBoltCache(snapshot))
+			plan, err := runPlan(cmd, &flags, opts)
+			if err != nil {
+				return err
+			}
+			writeWarnings(cmd.OutOrStdout(), plan)
+			return writePlan(cmd.OutOrStdout(), plan)
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVar(&snapshot, "snapshot", "", "bolt cache file to diff against")
+	_ = cmd.MarkFlagRequired("snapshot")
+	return cmd
+}
+
+func newApplyCmd() *cobra.Command {
+	var (
+		flags       syncFlags
+		adapterAddr string
+		cachePath   string
+		serve       bool
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Sync a resource file and serve it through the etcd adapter",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts, err := flags.options()
+			if err != nil {
+				return err
+			}
+			if adapterAddr != "" {
+				opts = append(opts, client.WithAdapterAddr(adapterAddr))
+			}
+			if cachePath != "" {
+				opts = append(opts, client.WithBoltCache(cachePath))
+			}
+			executor, err := client.NewKindExecutor(flags.logger(), opts...)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = executor.Close()
+			}()
+			if err := executor.Execute(cmd.Context(), adctypes.Config{}, flags.args()); err != nil {
+				return err
+			}
+			stats := executor.Stats()
+			for _, warning := range stats.LastWarnings {
+				fmt.Fprintf(cmd.OutOrStdout(), "warning: %s\n", warning)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "applied %d events, etcd adapter on %s\n",
+				stats.LastEvents, executor.AdapterAddr())
+			if serve {
+				// Keep serving the synced state until interrupted
+				<-cmd.Context().Done()
+			}
+			return nil
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVar(&adapterAddr, "adapter-addr", "", "address the etcd adapter listens on")
+	cmd.Flags().StringVar(&cachePath, "cache", "", "bolt cache file persisting the synced state")
+	cmd.Flags().BoolVar(&serve, "serve", false, "keep serving the etcd adapter until interrupted")
+	return cmd
+}
+
+func newExportCmd() *cobra.Command {
+	var (
+		snapshot       string
+		includeSecrets bool
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a cache snapshot as an ADC YAML document",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cache, err := kine.NewBoltCache(snapshot)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = cache.(io.Closer).Close()
+			}()
+			opts := []kine.ListOption{kine.WithoutCopy()}
+			if includeSecrets {
+				opts = append(opts, kine.IncludeSecrets())
+			}
+			return kine.ExportYAML(cache, cmd.OutOrStdout(), opts...)
+		},
+	}
+	cmd.Flags().StringVar(&snapshot, "snapshot", "", "bolt cache file to export")
+	cmd.Flags().BoolVar(&includeSecrets, "include-secrets", false, "keep SSL private keys")
+	_ = cmd.MarkFlagRequired("snapshot")
+	return cmd
+}
+
+// runPlan plans the sync of flags with a diff-only executor
+func runPlan(cmd *cobra.Command, flags *syncFlags, opts []client.KindExecutorOption) (*client.SyncPlan, error) {
+	executor, err := client.NewKindExecutor(flags.logger(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = executor.Close()
+	}()
+	return executor.Plan(cmd.Context(), flags.args())
+}
+
+// writeWarnings writes the transfer warnings and route conflicts of a plan
+func writeWarnings(w io.Writer, plan *client.SyncPlan) {
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning.Error())
+	}
+	for _, conflict := range plan.Conflicts {
+		fmt.Fprintf(w, "warning: %s\n", conflict.Error())
+	}
+}
+
+// writePlan writes the events of a plan in execution order, followed by a
+// summary
+func writePlan(w io.Writer, plan *client.SyncPlan) error {
+	counts := make(map[kine.EventType]int)
+	for _, event := range plan.Events {
+		counts[event.Type]++
+		line := fmt.Sprintf("%s %s %s (%s)", event.Type, event.ResourceType, event.ResourceID, event.ResourceName)
+		if event.ParentID != "" {
+			line += " of " + event.ParentID
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n",
+		counts[kine.EventTypeCreate], counts[kine.EventTypeUpdate], counts[kine.EventTypeDelete])
+	return err
+}
@@ -0,0 +1,130 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// writeResourceFile writes an ADC resource file with one service and a
+// route of the given URI
+func writeResourceFile(t *testing.T, uri string) string {
+	t.Helper()
+	resources := &adctypes.Resources{
+		Services: []*adctypes.Service{{
+			Metadata: adctypes.Metadata{Name: "httpbin"},
+			Hosts:    []string{"httpbin.example.com"},
+			Upstream: &adctypes.Upstream{
+				Nodes: adctypes.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}},
+			},
+			Routes: []*adctypes.Route{{
+				Metadata: adctypes.Metadata{Name: "get"},
+				Uris:     []string{uri},
+			}},
+		}},
+	}
+	data, err := json.Marshal(resources)
+	if err != nil {
+		t.Fatalf("failed to marshal resources: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "resources.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write resources: %v", err)
+	}
+	return path
+}
+
+// run runs kinesync with args and returns its output
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+func TestValidate(t *testing.T) {
+	out, err := run(t, "validate", "-f", writeResourceFile(t, "/get"))
+	if err != nil {
+		t.Fatalf("failed to validate: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "2 resources valid") {
+		t.Errorf("expected a service and route to be valid, got:\n%s", out)
+	}
+
+	// Services need an upstream
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"services": [{"name": "httpbin"}]}`), 0o600); err != nil {
+		t.Fatalf("failed to write resources: %v", err)
+	}
+	if out, err := run(t, "validate", "-f", invalid); err == nil {
+		t.Errorf("expected a service without upstream to fail validation, got:\n%s", out)
+	}
+}
+
+func TestApplyPlanExport(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "kine.db")
+	selector := "--label-selector=k8s/kind=Ingress,k8s/namespace=default,k8s/name=httpbin"
+
+	out, err := run(t, "apply", "-f", writeResourceFile(t, "/get"), selector,
+		"--adapter-addr", "127.0.0.1:0", "--cache", snapshot)
+	if err != nil {
+		t.Fatalf("failed to apply: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "applied 2 events") {
+		t.Errorf("expected 2 applied events, got:\n%s", out)
+	}
+
+	// The applied state plans no change, a new URI updates the route
+	out, err = run(t, "plan", "-f", writeResourceFile(t, "/get"), selector, "--snapshot", snapshot)
+	if err != nil {
+		t.Fatalf("failed to plan: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Plan: 0 to create, 0 to update, 0 to delete.") {
+		t.Errorf("expected an empty plan, got:\n%s", out)
+	}
+	out, err = run(t, "plan", "-f", writeResourceFile(t, "/anything"), selector, "--snapshot", snapshot)
+	if err != nil {
+		t.Fatalf("failed to plan: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "UPDATE route") || !strings.Contains(out, "Plan: 0 to create, 1 to update, 0 to delete.") {
+		t.Errorf("expected a route update, got:\n%s", out)
+	}
+	if !strings.Contains(out, "(get) of ") {
+		t.Errorf("expected the route update to name its service, got:\n%s", out)
+	}
+
+	out, err = run(t, "export", "--snapshot", snapshot)
+	if err != nil {
+		t.Fatalf("failed to export: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "name: httpbin") || !strings.Contains(out, "/get") {
+		t.Errorf("expected the applied service in the export, got:\n%s", out)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -65,7 +66,11 @@ func New(log logr.Logger, defaultMode string, timeout time.Duration) (*Client, e
 	var executor ADCExecutor
 	// support pingsix mode
 	if defaultMode == "pingsix" {
-		executor = NewKindExecutor(log)
+		kindExecutor, err := NewKindExecutor(log)
+		if err != nil {
+			return nil, err
+		}
+		executor = kindExecutor
 	} else {
 		executor = NewHTTPADCExecutor(log, serverURL, timeout)
 	}
@@ -80,6 +85,19 @@ func New(log logr.Logger, defaultMode string, timeout time.Duration) (*Client, e
 	}, nil
 }
 
+// SetupDebugHandler registers the debug endpoints of the client and its
+// executor on mux
+func (c *Client) SetupDebugHandler(pathPrefix string, mux *http.ServeMux) {
+	c.ADCDebugProvider.SetupHandler(pathPrefix, mux)
+	if executor, ok := c.executor.(*KindExecutor); ok {
+		mux.Handle("/kine/export", executor.ExportHandler())
+		mux.Handle("/kine/lookup", executor.LookupHandler())
+		mux.Handle("/kine/republish", executor.RepublishHandler())
+		mux.Handle("/kine/orphans", executor.OrphansHandler())
+		mux.Handle("/kine/syncs", executor.SyncsHandler())
+	}
+}
+
 type Task struct {
 	Key           types.NamespacedNameKind
 	Name          string
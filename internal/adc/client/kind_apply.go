@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// maxApplyErrorDetails bounds the failures spelled out by ApplyError.Error
+const maxApplyErrorDetails = 3
+
+// errParentNotApplied is returned for events skipped because the event of
+// their parent, the service of a route or the upstream of a service, failed
+var errParentNotApplied = errors.New("parent was not applied")
+
+// EventRef identifies the event of a batch
+type EventRef struct {
+	Type         kine.EventType
+	ResourceType kine.ResourceType
+	ResourceID   string
+}
+
+func refOf(event kine.Event) EventRef {
+	return EventRef{Type: event.Type, ResourceType: event.ResourceType, ResourceID: event.ResourceID}
+}
+
+func (r EventRef) String() string {
+	return fmt.Sprintf("%s %s %q", r.Type, r.ResourceType, r.ResourceID)
+}
+
+// EventError is the failure of a single event of a batch
+type EventError struct {
+	EventRef
+	Err error
+}
+
+func (e *EventError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EventError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyError reports the events of a batch that could not be applied to the
+// cache, along with those that were. Applied events are also sent to the
+// etcd adapter, failed ones are left out.
+type ApplyError struct {
+	Applied []EventRef
+	Failed  []*EventError
+}
+
+func (e *ApplyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to apply %d of %d cache changes (%d applied): ",
+		len(e.Failed), len(e.Failed)+len(e.Applied), len(e.Applied))
+	for i, failed := range e.Failed {
+		if i == maxApplyErrorDetails {
+			fmt.Fprintf(&b, "; and %d more", len(e.Failed)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(failed.Error())
+	}
+	return b.String()
+}
+
+func (e *ApplyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, failed := range e.Failed {
+		errs = append(errs, failed)
+	}
+	return errs
+}
+
+// parentRef returns the event a create or update depends on, the parent
+// service of a route or upstream of a service, if any
+func parentRef(event kine.Event) (kine.ResourceType, bool) {
+	if event.Type == kine.EventTypeDelete || event.ParentID == "" {
+		return "", false
+	}
+	switch event.ResourceType {
+	case kine.ResourceTypeRoute:
+		return kine.ResourceTypeService, true
+	case kine.ResourceTypeService:
+		return kine.ResourceTypeUpstream, true
+	}
+	return "", false
+}
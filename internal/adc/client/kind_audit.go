@@ -0,0 +1,118 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// AuditRecord describes a single event applied to the gateway
+type AuditRecord struct {
+	Timestamp    time.Time                   `json:"timestamp"`
+	SyncID       string                      `json:"syncId,omitempty"`
+	Sequence     int                         `json:"sequence"`
+	EventType    kine.EventType              `json:"eventType"`
+	ResourceType kine.ResourceType           `json:"resourceType"`
+	ResourceID   string                      `json:"resourceId"`
+	ResourceName string                      `json:"resourceName,omitempty"`
+	ParentID     string                      `json:"parentId,omitempty"`
+	Labels       map[string]string           `json:"labels,omitempty"`
+	Changes      map[string]kine.FieldChange `json:"changes,omitempty"`
+	// Warning describes the problem reported by an AuditEventWarning record
+	Warning string `json:"warning,omitempty"`
+}
+
+// AuditEventWarning is the event type of records reporting a problem found
+// by a sync, such as a route conflict, rather than an applied event
+const AuditEventWarning kine.EventType = "WARNING"
+
+// AuditSink records the events applied by the KindExecutor. It is called
+// after the etcd adapter accepted the batch.
+type AuditSink interface {
+	Record(records []AuditRecord) error
+}
+
+// FileAuditSink appends audit records as JSON lines to a file
+type FileAuditSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileAuditSink creates an AuditSink writing to the file at path
+func NewFileAuditSink(path string) *FileAuditSink {
+	return &FileAuditSink{path: path}
+}
+
+func (s *FileAuditSink) Record(records []AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	encoder := json.NewEncoder(f)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to write audit record: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// buildAuditRecords converts applied events into audit records
+func buildAuditRecords(events []kine.Event, now time.Time) []AuditRecord {
+	records := make([]AuditRecord, 0, len(events))
+	for _, event := range events {
+		record := AuditRecord{
+			Timestamp:    now,
+			SyncID:       event.SyncID,
+			Sequence:     event.Sequence,
+			EventType:    event.Type,
+			ResourceType: event.ResourceType,
+			ResourceID:   event.ResourceID,
+			ResourceName: event.ResourceName,
+			ParentID:     event.ParentID,
+		}
+		obj := event.NewValue
+		if obj == nil {
+			obj = event.OldValue
+		}
+		if labels := kine.KineLabelIndexer.GetLabels(obj); len(labels) > 0 {
+			record.Labels = labels
+		}
+		if event.Type == kine.EventTypeUpdate {
+			record.Changes = event.Changes
+			if record.Changes == nil {
+				// Errors only drop the field level diff, the record is still useful
+				if changes, err := kine.ComputeChanges(event.OldValue, event.NewValue); err == nil {
+					record.Changes = changes
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
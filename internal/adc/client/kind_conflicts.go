@@ -0,0 +1,184 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+// detectRouteConflicts checks the desired routes of a sync against each
+// other and against the cached routes of other owners. Cached routes owned
+// by the sync are replaced by the desired ones and left out. Only conflicts
+// involving a desired route are returned, with the desired route first.
+func (e *KindExecutor) detectRouteConflicts(labels map[string]string, desired []*kine.Route) ([]*kine.RouteConflict, error) {
+	if len(desired) == 0 {
+		return nil, nil
+	}
+	desiredIDs := make(map[string]bool, len(desired))
+	for _, route := range desired {
+		desiredIDs[route.ID] = true
+	}
+
+	routes := append([]*kine.Route(nil), desired...)
+	// Without selector labels the sync replaces every cached route
+	if len(labels) > 0 {
+		cached, err := e.cache.ListRoutes(kine.WithoutCopy())
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range cached {
+			if desiredIDs[route.ID] || ownedBy(route.Labels, labels) {
+				continue
+			}
+			routes = append(routes, route)
+		}
+	}
+
+	var conflicts []*kine.RouteConflict
+	for _, conflict := range kine.DetectRouteConflicts(routes) {
+		if !desiredIDs[conflict.RouteID] && desiredIDs[conflict.OtherRouteID] {
+			// Name the desired route first
+			conflict.RouteID, conflict.OtherRouteID = conflict.OtherRouteID, conflict.RouteID
+			conflict.Owner, conflict.OtherOwner = conflict.OtherOwner, conflict.Owner
+			conflict.URI, conflict.OtherURI = conflict.OtherURI, conflict.URI
+		}
+		if desiredIDs[conflict.RouteID] {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// checkPluginReferences returns the dangling plugin references of the
+// transferred resources. Referenced upstreams exist when transferred or
+// cached and not deleted by the events of the sync, referenced consumers
+// when in the synced file.
+func (e *KindExecutor) checkPluginReferences(resources *kine.TransferredResources, events []kine.Event) ([]*kine.DanglingReference, error) {
+	upstreams := make(map[string]bool, len(resources.Upstreams))
+	for _, upstream := range resources.Upstreams {
+		upstreams[upstream.ID] = true
+	}
+	cached, err := e.cache.ListUpstreams(kine.WithoutCopy())
+	if err != nil {
+		return nil, err
+	}
+	for _, upstream := range cached {
+		upstreams[upstream.ID] = true
+	}
+	for _, event := range events {
+		if event.Type == kine.EventTypeDelete && event.ResourceType == kine.ResourceTypeUpstream {
+			delete(upstreams, event.ResourceID)
+		}
+	}
+
+	return kine.CheckPluginReferences(resources, func(kind kine.ReferenceKind, id string) bool {
+		switch kind {
+		case kine.ReferenceConsumer:
+			return slices.Contains(resources.ConsumerNames, id)
+		case kine.ReferenceUpstream:
+			return upstreams[id]
+		default:
+			return true
+		}
+	}), nil
+}
+
+// detectKeyCollisions fails if two distinct resources of the event batch and
+// the cache map to the same etcd adapter key under keyOf, the later write
+// would clobber the earlier one. Deleted resources release their keys first.
+func (e *KindExecutor) detectKeyCollisions(events []kine.Event, keyOf func(kine.ResourceType, string) string) error {
+	owners := make(map[string]string)
+	for _, resourceType := range kine.ResourceTypes {
+		revisions, err := e.cache.Revisions(resourceType)
+		if err != nil {
+			return fmt.Errorf("failed to read cached %s revisions: %w", resourceType, err)
+		}
+		for id := range revisions {
+			owners[keyOf(resourceType, id)] = fmt.Sprintf("%s %s", resourceType, id)
+		}
+	}
+	for _, event := range events {
+		if event.Type != kine.EventTypeDelete {
+			continue
+		}
+		key := keyOf(event.ResourceType, event.ResourceID)
+		if owners[key] == fmt.Sprintf("%s %s", event.ResourceType, event.ResourceID) {
+			delete(owners, key)
+		}
+	}
+	for _, event := range events {
+		if event.Type == kine.EventTypeDelete {
+			continue
+		}
+		key := keyOf(event.ResourceType, event.ResourceID)
+		resource := fmt.Sprintf("%s %s", event.ResourceType, event.ResourceID)
+		if owner, ok := owners[key]; ok && owner != resource {
+			return fmt.Errorf("%w: %s and %s map to the same etcd key %s", ErrConflict, owner, resource, key)
+		}
+		owners[key] = resource
+	}
+	return nil
+}
+
+// ownedBy reports whether the kind, namespace and name labels of a resource
+// match the selector labels
+func ownedBy(resourceLabels, selectorLabels map[string]string) bool {
+	for _, key := range []string{label.LabelKind, label.LabelNamespace, label.LabelName} {
+		if resourceLabels[key] != selectorLabels[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordConflictAudit hands one warning record per route conflict to the
+// audit sink, if any. The record names the desired route of the conflict,
+// which detectRouteConflicts puts first.
+func (e *KindExecutor) recordConflictAudit(log logr.Logger, syncID string, conflicts []*kine.RouteConflict) {
+	if e.opts.AuditSink == nil || len(conflicts) == 0 {
+		return
+	}
+	records := buildConflictAuditRecords(syncID, conflicts, time.Now())
+	if err := e.opts.AuditSink.Record(records); err != nil {
+		log.Error(err, "failed to record audit log", "conflicts", len(conflicts))
+	}
+}
+
+// buildConflictAuditRecords converts route conflicts into warning records
+func buildConflictAuditRecords(syncID string, conflicts []*kine.RouteConflict, now time.Time) []AuditRecord {
+	records := make([]AuditRecord, 0, len(conflicts))
+	for i, conflict := range conflicts {
+		records = append(records, AuditRecord{
+			Timestamp:    now,
+			SyncID:       syncID,
+			Sequence:     i,
+			EventType:    AuditEventWarning,
+			ResourceType: kine.ResourceTypeRoute,
+			ResourceID:   conflict.RouteID,
+			Warning:      conflict.Error(),
+		})
+	}
+	return records
+}
@@ -0,0 +1,145 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// DebugHandler serves the cached resources as canonical JSON, for checking
+// what the executor wrote to the gateway:
+//
+//	GET /routes, /services, /upstreams, /ssls, /global_rules
+//	GET /stats
+//	GET /syncs, see GetRecentSyncs
+//
+// The kind, namespace and name query parameters select the resources of one
+// owner, the leading ones select those of a kind or of a kind in a
+// namespace. SSL private keys are redacted.
+func (e *KindExecutor) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /routes", e.debugListHandler(func(opts []kine.ListOption) (any, error) {
+		return e.cache.ListRoutes(opts...)
+	}))
+	mux.Handle("GET /services", e.debugListHandler(func(opts []kine.ListOption) (any, error) {
+		return e.cache.ListServices(opts...)
+	}))
+	mux.Handle("GET /upstreams", e.debugListHandler(func(opts []kine.ListOption) (any, error) {
+		return e.cache.ListUpstreams(opts...)
+	}))
+	mux.Handle("GET /ssls", e.debugListHandler(func(opts []kine.ListOption) (any, error) {
+		ssls, err := e.cache.ListSSL(opts...)
+		for _, ssl := range ssls {
+			if ssl.Key != "" {
+				ssl.Key = kine.RedactedValue
+			}
+		}
+		return ssls, err
+	}))
+	mux.Handle("GET /global_rules", e.debugListHandler(func(opts []kine.ListOption) (any, error) {
+		return e.cache.ListGlobalRules(opts...)
+	}))
+	mux.Handle("GET /stats", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeCanonicalJSON(w, e.Stats())
+	}))
+	mux.Handle("GET /syncs", e.SyncsHandler())
+	return mux
+}
+
+// debugListHandler serves the objects listed by list with the label
+// selector of the query parameters
+func (e *KindExecutor) debugListHandler(list func([]kine.ListOption) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts []kine.ListOption
+		query := r.URL.Query()
+		if kind := query.Get("kind"); kind != "" {
+			opts = append(opts, &kine.KindLabelSelector{
+				Kind:      kind,
+				Namespace: query.Get("namespace"),
+				Name:      query.Get("name"),
+				Partial:   true,
+			})
+		} else if query.Has("namespace") || query.Has("name") {
+			http.Error(w, "the namespace and name query parameters require kind", http.StatusBadRequest)
+			return
+		}
+		objs, err := list(opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeCanonicalJSON(w, objs)
+	})
+}
+
+// writeCanonicalJSON writes v as canonical JSON
+func writeCanonicalJSON(w http.ResponseWriter, v any) {
+	data, err := kine.CanonicalJSON(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// startDebugServer serves DebugHandler on the configured debug address,
+// which must be a loopback one: the cache holds the whole gateway
+// configuration
+func (e *KindExecutor) startDebugServer() error {
+	host, _, err := net.SplitHostPort(e.opts.DebugAddr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %q: %w", e.opts.DebugAddr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug address %q is not a loopback address", e.opts.DebugAddr)
+	}
+	ln, err := net.Listen("tcp", e.opts.DebugAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on debug address %s: %w", e.opts.DebugAddr, err)
+	}
+	e.debugServer = &http.Server{
+		Handler:           e.DebugHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	e.log.Info("debug server started", "addr", ln.Addr().String())
+	go func() {
+		if err := e.debugServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.log.Error(err, "debug server stopped")
+		}
+	}()
+	return nil
+}
+
+// stopDebugServer stops the debug server, if any, waiting for the requests
+// in flight
+func (e *KindExecutor) stopDebugServer() error {
+	if e.debugServer == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return e.debugServer.Shutdown(ctx)
+}
@@ -0,0 +1,115 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// decodeResources streams ADC resources from r. Services are handed to
+// onService as they are decoded and not kept in the returned Resources, so
+// that memory is bounded by a single service instead of the whole input.
+// Other resources are decoded as json.Unmarshal would.
+func decodeResources(r io.Reader, onService func(*adctypes.Service) error) (*adctypes.Resources, error) {
+	var resources adctypes.Resources
+	decoder := json.NewDecoder(r)
+
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return &resources, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object, got %v", tok)
+	}
+	for decoder.More() {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		// Match field names case-insensitively, like json.Unmarshal
+		switch key := tok.(string); {
+		case strings.EqualFold(key, "services"):
+			if err := decodeServices(decoder, onService); err != nil {
+				return nil, err
+			}
+		case strings.EqualFold(key, "ssls"):
+			err = decoder.Decode(&resources.SSLs)
+		case strings.EqualFold(key, "global_rules"):
+			err = decoder.Decode(&resources.GlobalRules)
+		case strings.EqualFold(key, "protos"):
+			err = decoder.Decode(&resources.Protos)
+		case strings.EqualFold(key, "plugin_metadata"):
+			err = decoder.Decode(&resources.PluginMetadata)
+		case strings.EqualFold(key, "consumers"):
+			err = decoder.Decode(&resources.Consumers)
+		case strings.EqualFold(key, "consumer_groups"):
+			err = decoder.Decode(&resources.ConsumerGroups)
+		default:
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after resources")
+	}
+	return &resources, nil
+}
+
+// decodeServices streams the elements of the services array to onService.
+// Null elements are rejected, they describe no service.
+func decodeServices(decoder *json.Decoder, onService func(*adctypes.Service) error) error {
+	tok, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected services to be an array, got %v", tok)
+	}
+	for i := 0; decoder.More(); i++ {
+		var service *adctypes.Service
+		if err := decoder.Decode(&service); err != nil {
+			return err
+		}
+		if service == nil {
+			return fmt.Errorf("services[%d] is null", i)
+		}
+		if err := onService(service); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
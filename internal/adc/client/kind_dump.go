@@ -0,0 +1,360 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+const (
+	// dumpManifestFile is the name of the manifest written by Dump
+	dumpManifestFile = "manifest.json"
+	// dumpResourcesFile is the name of the ADC YAML export written by Dump
+	dumpResourcesFile = "resources.yaml"
+)
+
+// syncStats tracks the outcome of the syncs run by a KindExecutor
+type syncStats struct {
+	mu sync.Mutex
+
+	count      int
+	failures   int
+	lastSyncID string
+	lastSyncAt time.Time
+	lastEvents int
+	lastError  string
+	// lastWarnings are the warnings of the last sync
+	lastWarnings []string
+	// secondaryFailures counts the batches the secondary backend failed
+	secondaryFailures int
+}
+
+func (s *syncStats) record(syncID string, events int, warnings []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	s.lastSyncID = syncID
+	s.lastSyncAt = time.Now()
+	s.lastEvents = events
+	s.lastWarnings = warnings
+	s.lastError = ""
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+	}
+}
+
+// SyncStats summarizes the syncs run by a KindExecutor
+type SyncStats struct {
+	Count      int       `json:"count"`
+	Failures   int       `json:"failures"`
+	LastSyncID string    `json:"lastSyncId,omitempty"`
+	LastSyncAt time.Time `json:"lastSyncAt,omitempty"`
+	LastEvents int       `json:"lastEvents"`
+	LastError  string    `json:"lastError,omitempty"`
+	// LastWarnings lists the transfer warnings and route conflicts of the
+	// last sync
+	LastWarnings []string `json:"lastWarnings,omitempty"`
+	// SecondaryFailures counts the event batches the secondary backend
+	// failed to receive
+	SecondaryFailures int `json:"secondaryFailures,omitempty"`
+}
+
+func (s *syncStats) snapshot() SyncStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SyncStats{
+		Count:      s.count,
+		Failures:   s.failures,
+		LastSyncID: s.lastSyncID,
+		LastSyncAt: s.lastSyncAt,
+		LastEvents: s.lastEvents,
+		LastError:  s.lastError,
+
+		LastWarnings:      s.lastWarnings,
+		SecondaryFailures: s.secondaryFailures,
+	}
+}
+
+func (s *syncStats) recordSecondaryFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secondaryFailures++
+}
+
+// Stats returns a summary of the syncs run so far. In diff-only mode the
+// event counts are those of the planned events.
+func (e *KindExecutor) Stats() SyncStats {
+	return e.stats.snapshot()
+}
+
+// DumpManifest describes a state dump written by Dump
+type DumpManifest struct {
+	CreatedAt      time.Time                    `json:"createdAt"`
+	AdapterAddress string                       `json:"adapterAddress"`
+	KeyPrefix      string                       `json:"keyPrefix"`
+	PrivateKeys    bool                         `json:"privateKeys"`
+	Sync           SyncStats                    `json:"sync"`
+	ResourceCounts map[kine.ResourceType]int    `json:"resourceCounts"`
+	ResourceFiles  map[kine.ResourceType]string `json:"resourceFiles"`
+}
+
+// DumpOption configures Dump
+type DumpOption interface {
+	ApplyToDump(*DumpOptions)
+}
+
+// DumpOptions contains the configuration of a state dump
+type DumpOptions struct {
+	// IncludePrivateKeys keeps SSL private keys in the dump, they are
+	// redacted by default
+	IncludePrivateKeys bool
+}
+
+func (o *DumpOptions) ApplyToDump(do *DumpOptions) {
+	if o.IncludePrivateKeys {
+		do.IncludePrivateKeys = o.IncludePrivateKeys
+	}
+}
+
+func (o *DumpOptions) ApplyOptions(opts []DumpOption) *DumpOptions {
+	for _, opt := range opts {
+		opt.ApplyToDump(o)
+	}
+	return o
+}
+
+type includePrivateKeysOption bool
+
+func (i includePrivateKeysOption) ApplyToDump(o *DumpOptions) {
+	o.IncludePrivateKeys = bool(i)
+}
+
+// WithPrivateKeys keeps SSL private keys in the dump
+func WithPrivateKeys() DumpOption {
+	return includePrivateKeysOption(true)
+}
+
+// Dump writes the cached state to dir for support bundles: one JSON file per
+// resource type, the ADC YAML export and a manifest with the sync stats.
+// Every file is written atomically, the manifest last.
+func (e *KindExecutor) Dump(dir string, opts ...DumpOption) error {
+	dumpOpts := (&DumpOptions{}).ApplyOptions(opts)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+
+	ssls, err := e.cache.ListSSL()
+	if err != nil {
+		return fmt.Errorf("failed to list ssls: %w", err)
+	}
+	if !dumpOpts.IncludePrivateKeys {
+		for _, ssl := range ssls {
+			if ssl.Key != "" {
+				ssl.Key = kine.RedactedValue
+			}
+		}
+	}
+
+	lists := []struct {
+		resourceType kine.ResourceType
+		list         func() (any, int, error)
+	}{
+		{kine.ResourceTypeRoute, func() (any, int, error) {
+			routes, err := e.cache.ListRoutes(kine.WithoutCopy())
+			return routes, len(routes), err
+		}},
+		{kine.ResourceTypeService, func() (any, int, error) {
+			services, err := e.cache.ListServices(kine.WithoutCopy())
+			return services, len(services), err
+		}},
+		{kine.ResourceTypeUpstream, func() (any, int, error) {
+			upstreams, err := e.cache.ListUpstreams(kine.WithoutCopy())
+			return upstreams, len(upstreams), err
+		}},
+		{kine.ResourceTypeSSL, func() (any, int, error) {
+			return ssls, len(ssls), nil
+		}},
+		{kine.ResourceTypeGlobalRule, func() (any, int, error) {
+			globalRules, err := e.cache.ListGlobalRules(kine.WithoutCopy())
+			return globalRules, len(globalRules), err
+		}},
+		{kine.ResourceTypeProto, func() (any, int, error) {
+			protos, err := e.cache.ListProtos(kine.WithoutCopy())
+			return protos, len(protos), err
+		}},
+		{kine.ResourceTypePluginMetadata, func() (any, int, error) {
+			pluginMetadata, err := e.cache.ListPluginMetadata(kine.WithoutCopy())
+			return pluginMetadata, len(pluginMetadata), err
+		}},
+	}
+
+	_, keyPrefix := getConfig()
+	manifest := DumpManifest{
+		CreatedAt:      time.Now(),
+		AdapterAddress: e.AdapterAddr(),
+		KeyPrefix:      keyPrefix,
+		PrivateKeys:    dumpOpts.IncludePrivateKeys,
+		Sync:           e.stats.snapshot(),
+		ResourceCounts: make(map[kine.ResourceType]int, len(lists)),
+		ResourceFiles:  make(map[kine.ResourceType]string, len(lists)),
+	}
+	for _, l := range lists {
+		objs, count, err := l.list()
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", l.resourceType, err)
+		}
+		file := string(l.resourceType) + ".json"
+		if err := writeJSONFileAtomic(filepath.Join(dir, file), objs); err != nil {
+			return err
+		}
+		manifest.ResourceCounts[l.resourceType] = count
+		manifest.ResourceFiles[l.resourceType] = file
+	}
+
+	var exported bytes.Buffer
+	if err := kine.ExportYAML(e.cache, &exported, exportOptions(dumpOpts.IncludePrivateKeys)...); err != nil {
+		return fmt.Errorf("failed to export resources: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, dumpResourcesFile), exported.Bytes()); err != nil {
+		return err
+	}
+	return writeJSONFileAtomic(filepath.Join(dir, dumpManifestFile), manifest)
+}
+
+// exportOptions returns the list options of an export
+func exportOptions(includeSecrets bool) []kine.ListOption {
+	opts := []kine.ListOption{kine.WithoutCopy()}
+	if includeSecrets {
+		opts = append(opts, kine.IncludeSecrets())
+	}
+	return opts
+}
+
+// ExportHandler serves the cached state as an ADC YAML document. Secrets
+// are redacted unless the include-secrets query parameter is true.
+func (e *KindExecutor) ExportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		includeSecrets, _ := strconv.ParseBool(r.URL.Query().Get("include-secrets"))
+		var exported bytes.Buffer
+		if err := kine.ExportYAML(e.cache, &exported, exportOptions(includeSecrets)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(exported.Bytes())
+	})
+}
+
+// NameLookup holds the cached objects sharing a name
+type NameLookup struct {
+	Routes    []*kine.Route    `json:"routes"`
+	Services  []*kine.Service  `json:"services"`
+	Upstreams []*kine.Upstream `json:"upstreams"`
+	SSLs      []*kine.SSL      `json:"ssls"`
+}
+
+// LookupByName returns every cached route, service, upstream and SSL named
+// name. SSL private keys are redacted.
+func (e *KindExecutor) LookupByName(name string) (*NameLookup, error) {
+	var (
+		lookup NameLookup
+		err    error
+	)
+	if lookup.Routes, err = e.cache.ListRoutesByName(name); err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	if lookup.Services, err = e.cache.ListServicesByName(name); err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	if lookup.Upstreams, err = e.cache.ListUpstreamsByName(name); err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+	if lookup.SSLs, err = e.cache.ListSSLByName(name); err != nil {
+		return nil, fmt.Errorf("failed to list ssls: %w", err)
+	}
+	for _, ssl := range lookup.SSLs {
+		if ssl.Key != "" {
+			ssl.Key = kine.RedactedValue
+		}
+	}
+	return &lookup, nil
+}
+
+// LookupHandler serves the cached objects named by the name query parameter
+// as JSON
+func (e *KindExecutor) LookupHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing name query parameter", http.StatusBadRequest)
+			return
+		}
+		lookup, err := e.LookupByName(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(lookup)
+	})
+}
+
+// writeJSONFileAtomic writes v as indented JSON to path atomically
+func writeJSONFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file renamed to path, so that
+// readers never observe a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to rename %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"errors"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// Classes of the errors returned by syncs, to be told apart with errors.Is:
+// invalid input is rejected until it changes, while unavailable backends
+// are worth retrying. The classes shared with the kine package are the
+// same errors, either can be matched.
+var (
+	// ErrInvalidInput is wrapped by errors of syncs whose input cannot be
+	// synced: bad args, unreadable files, invalid resources or options
+	ErrInvalidInput = kine.ErrInvalidInput
+	// ErrTransferFailed is wrapped by errors of the conversion of the ADC
+	// resources of a sync to Kine resources
+	ErrTransferFailed = kine.ErrTransferFailed
+	// ErrDiffFailed is wrapped by errors of the diff of a sync
+	ErrDiffFailed = kine.ErrDiffFailed
+	// ErrConflict is wrapped by errors of resources claiming an ID or an
+	// etcd key owned by another
+	ErrConflict = kine.ErrConflict
+	// ErrApplyFailed is wrapped by errors of events that could not be
+	// applied to the cache or logged to the event WAL
+	ErrApplyFailed = errors.New("failed to apply events")
+	// ErrBackendUnavailable is wrapped by errors of the etcd adapter not
+	// accepting events or connections
+	ErrBackendUnavailable = errors.New("etcd adapter unavailable")
+)
+
+func (e *ApplyError) Is(target error) bool {
+	return target == ErrApplyFailed
+}
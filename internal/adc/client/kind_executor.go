@@ -19,18 +19,30 @@ package client
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/api7/etcd-adapter/pkg/adapter"
+	"github.com/api7/etcd-adapter/pkg/backends/btree"
 	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/clock"
 
 	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
 	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
 )
 
 const (
@@ -41,6 +53,13 @@ const (
 	// Environment variable names
 	envEtcdAdapterAddr = "ETCD_ADAPTER_ADDR"
 	envApisixKeyPrefix = "APISIX_KEY_PREFIX"
+	envKineCachePath   = "KINE_CACHE_PATH"
+	envKineResync      = "KINE_RESYNC_INTERVAL"
+	envKineDebugAddr   = "KINE_DEBUG_ADDR"
+
+	// Cache backends
+	CacheBackendMemDB = "memdb"
+	CacheBackendBolt  = "bolt"
 )
 
 // getConfig returns configuration values from environment variables with defaults
@@ -65,166 +84,1632 @@ type KindExecutor struct {
 	cache   kine.Cache
 	differ  kine.Differ
 	adapter adapter.Adapter
+	opts    *KindExecutorOptions
+	stats   syncStats
+	clock   clock.WithTicker
+
+	// statuses holds the last sync status per label selector
+	statuses statusRegistry
+
+	// adapterAddr is the address the etcd adapter listener is bound to
+	adapterAddr string
+	listener    net.Listener
+	// cancel stops the background goroutines of the executor
+	cancel context.CancelFunc
+	// pacer rate limits and coalesces adapter events, nil when disabled
+	pacer *eventPacer
+	// tracer traces the sync pipeline, nil when disabled
+	tracer trace.Tracer
+	// wal logs the batches sent to the etcd adapter, nil when disabled
+	wal *eventWAL
+	// debugServer serves the cache contents, nil when disabled
+	debugServer *http.Server
+
+	// syncMu serializes syncs and resyncs
+	syncMu sync.Mutex
+
+	// lastResult is the result of the last sync
+	resultMu   sync.Mutex
+	lastResult *SyncResult
+	// history keeps the records of the recent syncs
+	history syncHistory
+	// tombstones tracks the tombstones written in DeletionTombstone mode
+	tombstones tombstones
+}
+
+// KindExecutorOption configures a KindExecutor
+type KindExecutorOption interface {
+	ApplyToKindExecutor(*KindExecutorOptions)
+}
+
+// KindExecutorOptions contains the configuration of a KindExecutor
+type KindExecutorOptions struct {
+	// AdapterAddr is the address the etcd adapter listens on. A zero port,
+	// such as 127.0.0.1:0, lets the OS pick a free one, and the unix://
+	// scheme selects a unix socket.
+	AdapterAddr string
+	// AdapterSocketMode is the file mode of a unix socket adapter address,
+	// 0660 when zero
+	AdapterSocketMode fs.FileMode
+	// AdapterTLSCertFile and AdapterTLSKeyFile serve the etcd adapter over
+	// TLS. The files are reloaded on SIGHUP and when they change. Only the
+	// gRPC API is usable over TLS, the HTTP gateway of the adapter dials
+	// itself in plaintext.
+	AdapterTLSCertFile string
+	AdapterTLSKeyFile  string
+	// AdapterClientCAFile requires adapter clients to present a certificate
+	// signed by one of its CAs. Needs AdapterTLSCertFile.
+	AdapterClientCAFile string
+	// CacheBackend selects the cache implementation, memdb by default
+	CacheBackend string
+	// CachePath is the database file used by the bolt cache backend
+	CachePath string
+	// AuditSink records every event applied to the gateway
+	AuditSink AuditSink
+	// BestEffortTransfer skips invalid resources with a warning instead of
+	// failing the whole sync
+	BestEffortTransfer bool
+	// AllowDuplicateIDs lets the last desired resource win when several
+	// share an ID, logging a warning instead of failing the sync
+	AllowDuplicateIDs bool
+	// NamespacedIDs scopes generated resource IDs by the owning kind and
+	// namespace. Turning it on changes the IDs of existing resources: the
+	// first sync afterwards deletes them under their old IDs and recreates
+	// them under the new ones.
+	NamespacedIDs bool
+	// ZeroWeightPolicy handles services whose upstream nodes all have weight
+	// 0, failing the sync by default
+	ZeroWeightPolicy kine.ZeroWeightPolicy
+	// SyncTimeout bounds every sync, from loading the resource file to
+	// sending the events. The --timeout argument overrides it. Unbounded
+	// when zero.
+	SyncTimeout time.Duration
+	// SharedUpstreams stores identical inline service upstreams once and
+	// references them by upstream_id. Unreferenced shared upstreams are
+	// only removed by full syncs.
+	SharedUpstreams bool
+	// SplitUpstreams stores the upstreams embedded in traffic-split configs
+	// like SharedUpstreams, referenced by upstream_id from the configs
+	SplitUpstreams bool
+	// DerivePriorities gives routes without an explicit priority one
+	// derived from the specificity of their paths, so that exact and
+	// longer paths win over shorter prefixes
+	DerivePriorities bool
+	// PropagateTimeouts gives routes without a timeout the one of the
+	// upstream serving them, explicit route timeouts win
+	PropagateTimeouts bool
+	// PluginValidator checks the plugin configs of the synced routes,
+	// services and global rules. Plugin configs are not checked when nil.
+	PluginValidator kine.PluginValidator
+	// ForceOwnership lets a sync take over resources owned by another
+	// source instead of failing with an ownership conflict. Meant for
+	// migrations between owners.
+	ForceOwnership bool
+	// DetectRouteConflicts checks the synced routes against the cached
+	// routes of other owners and reports those matching the same requests
+	// as warnings in the stats, the sync status and the audit log
+	DetectRouteConflicts bool
+	// CheckPluginReferences checks the consumers and upstreams referenced
+	// from the plugin configs of the synced resources, see
+	// kine.PluginReferences, and reports the missing ones as warnings.
+	// Consumers are looked up among those of the synced file, upstreams
+	// in the cache and the synced file.
+	CheckPluginReferences bool
+	// ResyncInterval periodically repairs etcd adapter contents that drifted
+	// from the cache. Disabled when zero.
+	ResyncInterval time.Duration
+	// OrphanScanInterval periodically reports the cached resources lacking
+	// an owner label, see CleanupOrphans. Disabled when zero.
+	OrphanScanInterval time.Duration
+	// DeleteOrphans also deletes the orphaned resources found by periodic
+	// scans, which only report them otherwise
+	DeleteOrphans bool
+	// SyncHistorySize is the number of recent syncs kept for
+	// GetRecentSyncs, DefaultSyncHistorySize when zero. A negative size
+	// keeps none.
+	SyncHistorySize int
+	// DebugAddr is the loopback address of an HTTP server serving the
+	// cache contents, see DebugHandler. The KINE_DEBUG_ADDR environment
+	// variable sets it. Disabled when empty.
+	DebugAddr string
+	// SecondaryBackend also receives the event batches of syncs, drift
+	// repairs and republishes, before pacing, for migrations and to capture
+	// event streams. Its failures are logged and counted in the stats but
+	// never fail a sync.
+	SecondaryBackend Backend
+	// EventRateLimit caps the events sent to the etcd adapter per second,
+	// allowing bursts of EventBurst events. Unlimited when zero.
+	EventRateLimit float64
+	EventBurst     int
+	// EventDebounce delays sending events by the window, coalescing
+	// successive events of the same resource into the latest one
+	EventDebounce time.Duration
+	// TracerProvider traces syncs with a span per pipeline stage. Tracing
+	// is disabled when nil.
+	TracerProvider trace.TracerProvider
+	// DiffOnly runs syncs up to the diff: resources are loaded, transferred,
+	// validated and diffed, but the cache is left untouched and nothing is
+	// sent. No etcd adapter is started, so the adapter options, resyncs and
+	// event pacing are ignored. Meant for validating resources in CI.
+	DiffOnly bool
+	// WALPath is the file of the write-ahead log of the batches sent to the
+	// etcd adapter. Batches logged but never accepted by the adapter, as
+	// when the process crashed after updating the cache, are sent again on
+	// the next start. Disabled when empty.
+	WALPath string
+	// WALMaxSize is the size in bytes past which the WAL is truncated once
+	// no batch is pending, 64MiB when zero
+	WALMaxSize int64
+	// ValueSizeWarning is the size in bytes of the marshaled value of a
+	// resource past which syncs log a warning, 1MiB when zero
+	ValueSizeWarning int
+	// MaxValueSize is the size in bytes of the marshaled value of a resource
+	// past which syncs fail before touching the cache, 1.5MiB when zero like
+	// the default request limit of etcd
+	MaxValueSize int
+	// ProtectedGlobalRules lists the IDs of global rules that syncs never
+	// delete, such as always-on prometheus or real-ip rules, so that
+	// removing their custom resource does not take them off the gateway.
+	// Their deletions are logged and dropped, keeping them cached.
+	ProtectedGlobalRules []string
+	// GlobalRuleMode is how global rules are written to the etcd adapter,
+	// GlobalRulePerPlugin when empty
+	GlobalRuleMode GlobalRuleMode
+	// DeletionMode is how deleted resources are removed from the etcd
+	// adapter, DeletionDelete when empty. The cache drops them right away
+	// in either mode.
+	DeletionMode DeletionMode
+	// TombstoneGracePeriod is how long tombstones are kept before they are
+	// deleted, DefaultTombstoneGracePeriod when zero
+	TombstoneGracePeriod time.Duration
+}
+
+func (o *KindExecutorOptions) ApplyToKindExecutor(eo *KindExecutorOptions) {
+	if o.AdapterAddr != "" {
+		eo.AdapterAddr = o.AdapterAddr
+	}
+	if o.AdapterSocketMode != 0 {
+		eo.AdapterSocketMode = o.AdapterSocketMode
+	}
+	if o.AdapterTLSCertFile != "" {
+		eo.AdapterTLSCertFile = o.AdapterTLSCertFile
+	}
+	if o.AdapterTLSKeyFile != "" {
+		eo.AdapterTLSKeyFile = o.AdapterTLSKeyFile
+	}
+	if o.AdapterClientCAFile != "" {
+		eo.AdapterClientCAFile = o.AdapterClientCAFile
+	}
+	if o.CacheBackend != "" {
+		eo.CacheBackend = o.CacheBackend
+	}
+	if o.CachePath != "" {
+		eo.CachePath = o.CachePath
+	}
+	if o.AuditSink != nil {
+		eo.AuditSink = o.AuditSink
+	}
+	if o.BestEffortTransfer {
+		eo.BestEffortTransfer = o.BestEffortTransfer
+	}
+	if o.AllowDuplicateIDs {
+		eo.AllowDuplicateIDs = o.AllowDuplicateIDs
+	}
+	if o.NamespacedIDs {
+		eo.NamespacedIDs = o.NamespacedIDs
+	}
+	if o.ZeroWeightPolicy != "" {
+		eo.ZeroWeightPolicy = o.ZeroWeightPolicy
+	}
+	if o.SyncTimeout != 0 {
+		eo.SyncTimeout = o.SyncTimeout
+	}
+	if o.SharedUpstreams {
+		eo.SharedUpstreams = o.SharedUpstreams
+	}
+	if o.SplitUpstreams {
+		eo.SplitUpstreams = o.SplitUpstreams
+	}
+	if o.DerivePriorities {
+		eo.DerivePriorities = o.DerivePriorities
+	}
+	if o.PropagateTimeouts {
+		eo.PropagateTimeouts = o.PropagateTimeouts
+	}
+	if o.PluginValidator != nil {
+		eo.PluginValidator = o.PluginValidator
+	}
+	if o.ForceOwnership {
+		eo.ForceOwnership = o.ForceOwnership
+	}
+	if o.DetectRouteConflicts {
+		eo.DetectRouteConflicts = o.DetectRouteConflicts
+	}
+	if o.CheckPluginReferences {
+		eo.CheckPluginReferences = o.CheckPluginReferences
+	}
+	if o.ResyncInterval > 0 {
+		eo.ResyncInterval = o.ResyncInterval
+	}
+	if o.OrphanScanInterval > 0 {
+		eo.OrphanScanInterval = o.OrphanScanInterval
+	}
+	if o.DeleteOrphans {
+		eo.DeleteOrphans = o.DeleteOrphans
+	}
+	if o.SyncHistorySize != 0 {
+		eo.SyncHistorySize = o.SyncHistorySize
+	}
+	if o.DebugAddr != "" {
+		eo.DebugAddr = o.DebugAddr
+	}
+	if o.SecondaryBackend != nil {
+		eo.SecondaryBackend = o.SecondaryBackend
+	}
+	if o.EventRateLimit > 0 {
+		eo.EventRateLimit = o.EventRateLimit
+	}
+	if o.EventBurst > 0 {
+		eo.EventBurst = o.EventBurst
+	}
+	if o.EventDebounce > 0 {
+		eo.EventDebounce = o.EventDebounce
+	}
+	if o.TracerProvider != nil {
+		eo.TracerProvider = o.TracerProvider
+	}
+	if o.DiffOnly {
+		eo.DiffOnly = o.DiffOnly
+	}
+	if o.WALPath != "" {
+		eo.WALPath = o.WALPath
+	}
+	if o.WALMaxSize > 0 {
+		eo.WALMaxSize = o.WALMaxSize
+	}
+	if o.ValueSizeWarning > 0 {
+		eo.ValueSizeWarning = o.ValueSizeWarning
+	}
+	if o.MaxValueSize > 0 {
+		eo.MaxValueSize = o.MaxValueSize
+	}
+	if o.ProtectedGlobalRules != nil {
+		eo.ProtectedGlobalRules = o.ProtectedGlobalRules
+	}
+	if o.GlobalRuleMode != "" {
+		eo.GlobalRuleMode = o.GlobalRuleMode
+	}
+	if o.DeletionMode != "" {
+		eo.DeletionMode = o.DeletionMode
+	}
+	if o.TombstoneGracePeriod > 0 {
+		eo.TombstoneGracePeriod = o.TombstoneGracePeriod
+	}
+}
+
+func (o *KindExecutorOptions) ApplyOptions(opts []KindExecutorOption) *KindExecutorOptions {
+	for _, opt := range opts {
+		opt.ApplyToKindExecutor(o)
+	}
+	return o
+}
+
+type adapterAddrOption string
+
+func (a adapterAddrOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AdapterAddr = string(a)
+}
+
+// WithAdapterAddr makes the etcd adapter listen on addr
+func WithAdapterAddr(addr string) KindExecutorOption {
+	return adapterAddrOption(addr)
+}
+
+type adapterSocketModeOption fs.FileMode
+
+func (m adapterSocketModeOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AdapterSocketMode = fs.FileMode(m)
+}
+
+// WithAdapterSocketMode sets the file mode of the etcd adapter unix socket
+func WithAdapterSocketMode(mode fs.FileMode) KindExecutorOption {
+	return adapterSocketModeOption(mode)
+}
+
+type adapterTLSOption struct {
+	certFile string
+	keyFile  string
+}
+
+func (t adapterTLSOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AdapterTLSCertFile = t.certFile
+	o.AdapterTLSKeyFile = t.keyFile
+}
+
+// WithAdapterTLS serves the etcd adapter over TLS with the given
+// certificate and key files
+func WithAdapterTLS(certFile, keyFile string) KindExecutorOption {
+	return adapterTLSOption{certFile: certFile, keyFile: keyFile}
+}
+
+type adapterClientCAOption string
+
+func (c adapterClientCAOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AdapterClientCAFile = string(c)
+}
+
+// WithAdapterClientCA requires etcd adapter clients to present a
+// certificate signed by a CA of the given file
+func WithAdapterClientCA(caFile string) KindExecutorOption {
+	return adapterClientCAOption(caFile)
+}
+
+type boltCacheOption string
+
+func (p boltCacheOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.CacheBackend = CacheBackendBolt
+	o.CachePath = string(p)
+}
+
+// WithBoltCache persists the executor cache in the bolt database at path
+func WithBoltCache(path string) KindExecutorOption {
+	return boltCacheOption(path)
+}
+
+type auditSinkOption struct {
+	sink AuditSink
+}
+
+func (a auditSinkOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AuditSink = a.sink
+}
+
+// WithAuditSink records the applied events to the given sink
+func WithAuditSink(sink AuditSink) KindExecutorOption {
+	return auditSinkOption{sink: sink}
+}
+
+type bestEffortTransferOption bool
+
+func (b bestEffortTransferOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.BestEffortTransfer = bool(b)
+}
+
+// WithBestEffortTransfer makes syncs skip resources that fail to transfer,
+// reporting them as warnings, instead of failing
+func WithBestEffortTransfer() KindExecutorOption {
+	return bestEffortTransferOption(true)
+}
+
+type allowDuplicateIDsOption bool
+
+func (a allowDuplicateIDsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.AllowDuplicateIDs = bool(a)
+}
+
+// WithAllowDuplicateIDs keeps the last of several desired resources sharing
+// an ID instead of failing the sync. Intended for migrations.
+func WithAllowDuplicateIDs() KindExecutorOption {
+	return allowDuplicateIDsOption(true)
+}
+
+type namespacedIDsOption bool
+
+func (n namespacedIDsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.NamespacedIDs = bool(n)
+}
+
+// WithNamespacedIDs includes the owning namespace in generated resource IDs,
+// so that same-named resources in different namespaces do not collide
+func WithNamespacedIDs() KindExecutorOption {
+	return namespacedIDsOption(true)
+}
+
+type zeroWeightPolicyOption kine.ZeroWeightPolicy
+
+func (p zeroWeightPolicyOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.ZeroWeightPolicy = kine.ZeroWeightPolicy(p)
+}
+
+// WithZeroWeightPolicy sets what syncs do with services whose upstream
+// nodes all have weight 0
+func WithZeroWeightPolicy(policy kine.ZeroWeightPolicy) KindExecutorOption {
+	return zeroWeightPolicyOption(policy)
+}
+
+type syncTimeoutOption time.Duration
+
+func (t syncTimeoutOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.SyncTimeout = time.Duration(t)
+}
+
+// WithSyncTimeout bounds every sync by timeout
+func WithSyncTimeout(timeout time.Duration) KindExecutorOption {
+	return syncTimeoutOption(timeout)
+}
+
+type sharedUpstreamsOption bool
+
+func (u sharedUpstreamsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.SharedUpstreams = bool(u)
+}
+
+// WithSharedUpstreams deduplicates identical inline service upstreams
+func WithSharedUpstreams() KindExecutorOption {
+	return sharedUpstreamsOption(true)
+}
+
+type splitUpstreamsOption bool
+
+func (u splitUpstreamsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.SplitUpstreams = bool(u)
+}
+
+// WithSplitUpstreams extracts the upstreams embedded in traffic-split
+// configs into shared upstreams
+func WithSplitUpstreams() KindExecutorOption {
+	return splitUpstreamsOption(true)
+}
+
+type derivePrioritiesOption bool
+
+func (p derivePrioritiesOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.DerivePriorities = bool(p)
+}
+
+// WithDerivedPriorities derives the priority of routes without one from
+// the specificity of their paths
+func WithDerivedPriorities() KindExecutorOption {
+	return derivePrioritiesOption(true)
+}
+
+type propagateTimeoutsOption bool
+
+func (p propagateTimeoutsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.PropagateTimeouts = bool(p)
+}
+
+// WithTimeoutPropagation copies the timeout of the upstream serving a route
+// onto the route when it has none
+func WithTimeoutPropagation() KindExecutorOption {
+	return propagateTimeoutsOption(true)
+}
+
+type pluginValidatorOption struct {
+	validator kine.PluginValidator
+}
+
+func (p pluginValidatorOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.PluginValidator = p.validator
+}
+
+// WithPluginValidator checks the synced plugin configs with the validator
+func WithPluginValidator(validator kine.PluginValidator) KindExecutorOption {
+	return pluginValidatorOption{validator: validator}
+}
+
+type forceOwnershipOption bool
+
+func (f forceOwnershipOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.ForceOwnership = bool(f)
+}
+
+// WithForceOwnership makes the syncing source win ownership conflicts
+func WithForceOwnership() KindExecutorOption {
+	return forceOwnershipOption(true)
+}
+
+type routeConflictDetectionOption bool
+
+func (d routeConflictDetectionOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.DetectRouteConflicts = bool(d)
+}
+
+// WithRouteConflictDetection reports routes of different owners matching
+// the same requests
+func WithRouteConflictDetection() KindExecutorOption {
+	return routeConflictDetectionOption(true)
+}
+
+type pluginReferenceCheckOption bool
+
+func (c pluginReferenceCheckOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.CheckPluginReferences = bool(c)
+}
+
+// WithPluginReferenceCheck reports plugin configs referencing missing
+// consumers or upstreams
+func WithPluginReferenceCheck() KindExecutorOption {
+	return pluginReferenceCheckOption(true)
+}
+
+type debugAddrOption string
+
+func (d debugAddrOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.DebugAddr = string(d)
+}
+
+// WithDebugAddr serves the cache contents on the loopback address addr
+func WithDebugAddr(addr string) KindExecutorOption {
+	return debugAddrOption(addr)
+}
+
+type secondaryBackendOption struct {
+	backend Backend
+}
+
+func (s secondaryBackendOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.SecondaryBackend = s.backend
+}
+
+// WithSecondaryBackend also sends the event batches to backend
+func WithSecondaryBackend(backend Backend) KindExecutorOption {
+	return secondaryBackendOption{backend: backend}
+}
+
+type resyncIntervalOption time.Duration
+
+func (r resyncIntervalOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.ResyncInterval = time.Duration(r)
+}
+
+// WithResyncInterval repairs etcd adapter drift every interval
+func WithResyncInterval(interval time.Duration) KindExecutorOption {
+	return resyncIntervalOption(interval)
+}
+
+type orphanScanOption struct {
+	interval      time.Duration
+	deleteOrphans bool
+}
+
+func (s orphanScanOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.OrphanScanInterval = s.interval
+	o.DeleteOrphans = s.deleteOrphans
+}
+
+// WithOrphanScan reports the cached resources lacking an owner label every
+// interval, deleting them when deleteOrphans is set
+func WithOrphanScan(interval time.Duration, deleteOrphans bool) KindExecutorOption {
+	return orphanScanOption{interval: interval, deleteOrphans: deleteOrphans}
+}
+
+type syncHistoryOption int
+
+func (s syncHistoryOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.SyncHistorySize = int(s)
+}
+
+// WithSyncHistory keeps the size most recent syncs for GetRecentSyncs, or
+// none when size is negative
+func WithSyncHistory(size int) KindExecutorOption {
+	return syncHistoryOption(size)
+}
+
+type eventRateLimitOption struct {
+	rate  float64
+	burst int
+}
+
+func (r eventRateLimitOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.EventRateLimit = r.rate
+	o.EventBurst = r.burst
+}
+
+// WithEventRateLimit sends at most rate events per second to the etcd
+// adapter, with bursts of up to burst events
+func WithEventRateLimit(rate float64, burst int) KindExecutorOption {
+	return eventRateLimitOption{rate: rate, burst: burst}
+}
+
+type eventDebounceOption time.Duration
+
+func (d eventDebounceOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.EventDebounce = time.Duration(d)
+}
+
+// WithEventDebounce coalesces events of the same resource sent within window
+func WithEventDebounce(window time.Duration) KindExecutorOption {
+	return eventDebounceOption(window)
+}
+
+type tracerProviderOption struct {
+	provider trace.TracerProvider
+}
+
+func (t tracerProviderOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.TracerProvider = t.provider
+}
+
+// WithTracerProvider traces syncs with tracers of the given provider
+func WithTracerProvider(provider trace.TracerProvider) KindExecutorOption {
+	return tracerProviderOption{provider: provider}
+}
+
+type diffOnlyOption bool
+
+func (d diffOnlyOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.DiffOnly = bool(d)
+}
+
+// WithDiffOnly makes syncs stop after the diff, without starting the etcd
+// adapter
+func WithDiffOnly() KindExecutorOption {
+	return diffOnlyOption(true)
+}
+
+type eventWALOption struct {
+	path    string
+	maxSize int64
+}
+
+func (w eventWALOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.WALPath = w.path
+	o.WALMaxSize = w.maxSize
+}
+
+// WithEventWAL logs the batches sent to the etcd adapter in the file at
+// path, truncated past maxSize bytes, to replay them after a crash
+func WithEventWAL(path string, maxSize int64) KindExecutorOption {
+	return eventWALOption{path: path, maxSize: maxSize}
+}
+
+type valueSizeLimitsOption struct {
+	warning int
+	max     int
+}
+
+func (l valueSizeLimitsOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.ValueSizeWarning = l.warning
+	o.MaxValueSize = l.max
+}
+
+// WithValueSizeLimits warns about resources whose marshaled value exceeds
+// warning bytes and fails syncs with values exceeding max bytes
+func WithValueSizeLimits(warning, max int) KindExecutorOption {
+	return valueSizeLimitsOption{warning: warning, max: max}
+}
+
+type protectedGlobalRulesOption []string
+
+func (p protectedGlobalRulesOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.ProtectedGlobalRules = p
+}
+
+// WithProtectedGlobalRules keeps the global rules with the given IDs when
+// syncs would delete them
+func WithProtectedGlobalRules(ids ...string) KindExecutorOption {
+	return protectedGlobalRulesOption(ids)
+}
+
+type globalRuleModeOption GlobalRuleMode
+
+func (m globalRuleModeOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.GlobalRuleMode = GlobalRuleMode(m)
+}
+
+// WithGlobalRuleMode sets how global rules are written to the etcd adapter
+func WithGlobalRuleMode(mode GlobalRuleMode) KindExecutorOption {
+	return globalRuleModeOption(mode)
+}
+
+type deletionModeOption DeletionMode
+
+func (m deletionModeOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.DeletionMode = DeletionMode(m)
+}
+
+// WithDeletionMode sets how deleted resources are removed from the etcd
+// adapter
+func WithDeletionMode(mode DeletionMode) KindExecutorOption {
+	return deletionModeOption(mode)
+}
+
+type tombstoneGracePeriodOption time.Duration
+
+func (p tombstoneGracePeriodOption) ApplyToKindExecutor(o *KindExecutorOptions) {
+	o.TombstoneGracePeriod = time.Duration(p)
+}
+
+// WithTombstoneGracePeriod keeps the tombstones of DeletionTombstone mode
+// for gracePeriod before deleting them
+func WithTombstoneGracePeriod(gracePeriod time.Duration) KindExecutorOption {
+	return tombstoneGracePeriodOption(gracePeriod)
+}
+
+// defaultKindExecutorOptions returns the options derived from the environment
+func defaultKindExecutorOptions() (*KindExecutorOptions, error) {
+	adapterAddr, _ := getConfig()
+	opts := &KindExecutorOptions{
+		AdapterAddr:  adapterAddr,
+		CacheBackend: CacheBackendMemDB,
+	}
+	if path := os.Getenv(envKineCachePath); path != "" {
+		opts.CacheBackend = CacheBackendBolt
+		opts.CachePath = path
+	}
+	opts.DebugAddr = os.Getenv(envKineDebugAddr)
+	if interval := os.Getenv(envKineResync); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s: %w", ErrInvalidInput, envKineResync, err)
+		}
+		opts.ResyncInterval = d
+	}
+	return opts, nil
+}
+
+// newCache creates the cache backend selected by the options
+func newCache(opts *KindExecutorOptions) (kine.Cache, error) {
+	switch opts.CacheBackend {
+	case CacheBackendMemDB:
+		return kine.NewMemDBCache()
+	case CacheBackendBolt:
+		if opts.CachePath == "" {
+			return nil, fmt.Errorf("%w: bolt cache backend requires a cache path", ErrInvalidInput)
+		}
+		return kine.NewBoltCache(opts.CachePath)
+	default:
+		return nil, fmt.Errorf("%w: unknown cache backend: %s", ErrInvalidInput, opts.CacheBackend)
+	}
 }
 
-func newEtcdAdapter(log logr.Logger) adapter.Adapter {
-	a := adapter.NewEtcdAdapter(nil)
+// newEtcdAdapter starts an etcd adapter listening on the configured address
+// and returns it with its listener
+func newEtcdAdapter(ctx context.Context, log logr.Logger, opts *KindExecutorOptions) (adapter.Adapter, net.Listener, error) {
+	backend := btree.NewBTreeCache()
+	a := &etcdAdapter{
+		Adapter: adapter.NewEtcdAdapter(&adapter.AdapterOptions{Backend: backend}),
+		backend: backend,
+	}
+
+	var certs *certReloader
+	if opts.AdapterTLSCertFile != "" || opts.AdapterTLSKeyFile != "" || opts.AdapterClientCAFile != "" {
+		if opts.AdapterTLSCertFile == "" || opts.AdapterTLSKeyFile == "" {
+			return nil, nil, fmt.Errorf("%w: adapter TLS requires both a certificate and a key file", ErrInvalidInput)
+		}
+		var err error
+		certs, err = newCertReloader(opts.AdapterTLSCertFile, opts.AdapterTLSKeyFile, opts.AdapterClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	etcdAdapterAddr, _ := getConfig()
-	ln, err := net.Listen("tcp", etcdAdapterAddr)
+	ln, err := listenAdapter(opts.AdapterAddr, opts.AdapterSocketMode)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("%w: failed to listen on %s: %w", ErrBackendUnavailable, opts.AdapterAddr, err)
+	}
+	if certs != nil {
+		if err := certs.watch(ctx, log); err != nil {
+			_ = ln.Close()
+			return nil, nil, err
+		}
+		ln = tls.NewListener(ln, certs.tlsConfig())
 	}
+	boundAddr := adapterListenerAddr(ln)
+	log.Info("etcd adapter started", "addr", boundAddr)
 	go func() {
-		if err := a.Serve(context.Background(), ln); err != nil {
-			panic(err)
+		if err := a.Serve(ctx, ln); err != nil {
+			log.Error(err, "etcd adapter stopped", "addr", boundAddr)
 		}
-		log.Info("etcd adapter started")
 	}()
 
-	return a
+	return a, ln, nil
 }
 
 // NewKindExecutor creates a new KindExecutor
-func NewKindExecutor(log logr.Logger) *KindExecutor {
-	cache, err := kine.NewMemDBCache()
+func NewKindExecutor(log logr.Logger, opts ...KindExecutorOption) (*KindExecutor, error) {
+	options, err := defaultKindExecutorOptions()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	options.ApplyOptions(opts)
+	switch options.GlobalRuleMode {
+	case "", GlobalRulePerPlugin, GlobalRuleAggregated:
+	default:
+		return nil, fmt.Errorf("%w: unknown global rule mode %q, expected %s or %s",
+			ErrInvalidInput, options.GlobalRuleMode, GlobalRulePerPlugin, GlobalRuleAggregated)
+	}
+	switch options.DeletionMode {
+	case "", DeletionDelete, DeletionTombstone:
+	default:
+		return nil, fmt.Errorf("%w: unknown deletion mode %q, expected %s or %s",
+			ErrInvalidInput, options.DeletionMode, DeletionDelete, DeletionTombstone)
 	}
+	cache, err := newCache(options)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	differ := kine.NewDiffer(cache)
-	return &KindExecutor{
-		log:     log,
-		cache:   cache,
-		differ:  differ,
-		adapter: newEtcdAdapter(log),
+	if options.DiffOnly {
+		log.Info("diff-only mode, not starting the etcd adapter")
+		return &KindExecutor{
+			log:    log,
+			cache:  cache,
+			differ: differ,
+			opts:   options,
+			clock:  clock.RealClock{},
+			cancel: cancel,
+			tracer: newTracer(options),
+		}, nil
+	}
+	etcdAdapter, ln, err := newEtcdAdapter(ctx, log, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	e := &KindExecutor{
+		log:         log,
+		cache:       cache,
+		differ:      differ,
+		adapter:     etcdAdapter,
+		opts:        options,
+		clock:       clock.RealClock{},
+		adapterAddr: adapterListenerAddr(ln),
+		listener:    ln,
+		cancel:      cancel,
+		tracer:      newTracer(options),
+	}
+	if options.WALPath != "" {
+		// Pending batches must reach the adapter before any new one
+		if err := e.startWAL(ctx); err != nil {
+			_ = e.Close()
+			return nil, err
+		}
+	}
+	if options.DebugAddr != "" {
+		if err := e.startDebugServer(); err != nil {
+			_ = e.Close()
+			return nil, err
+		}
+	}
+	e.startPacer(ctx)
+	if options.ResyncInterval > 0 {
+		go e.runResyncLoop(ctx, options.ResyncInterval)
+	}
+	if options.OrphanScanInterval > 0 {
+		go e.runOrphanScanLoop(ctx, options.OrphanScanInterval)
+	}
+	if options.DeletionMode == DeletionTombstone {
+		go e.runTombstoneJanitor(ctx)
+	}
+	return e, nil
+}
+
+// startPacer starts pacing adapter events when rate limiting or debouncing
+// is configured
+func (e *KindExecutor) startPacer(ctx context.Context) {
+	if e.opts.EventRateLimit <= 0 && e.opts.EventDebounce <= 0 {
+		return
 	}
+	e.pacer = newEventPacer(e.log, e.clock, e.adapter.EventCh,
+		e.opts.EventRateLimit, e.opts.EventBurst, e.opts.EventDebounce)
+	go e.pacer.run(ctx)
 }
 
+// Close stops the etcd adapter, removing its unix socket file if any, and
+// closes the cache
+func (e *KindExecutor) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	var errs []error
+	if err := e.stopDebugServer(); err != nil {
+		errs = append(errs, err)
+	}
+	if e.listener != nil {
+		if err := e.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+		if network, path := splitAdapterAddr(e.adapterAddr); network == "unix" {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if e.wal != nil {
+		if err := e.wal.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if closer, ok := e.cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AdapterAddr returns the address the etcd adapter listener is bound to,
+// with the actual port when the configured one was zero. It is empty in
+// diff-only mode.
+func (e *KindExecutor) AdapterAddr() string {
+	return e.adapterAddr
+}
+
+// Execute runs the sync described by args, see SyncResources for its
+// result
 func (e *KindExecutor) Execute(ctx context.Context, config adctypes.Config, args []string) error {
-	return e.runKindSync(ctx, config, args)
+	_, err := e.SyncResources(ctx, config, args)
+	return err
+}
+
+// SyncPlan is what a sync would change, as computed by Plan
+type SyncPlan struct {
+	SyncID string
+	// Events are the diff events of the sync, in execution order, with
+	// secrets redacted
+	Events []kine.Event
+	// Warnings lists the resources skipped or altered by the transfer
+	Warnings []kine.TransferWarning
+	// Conflicts lists the detected route conflicts, when enabled
+	Conflicts []*kine.RouteConflict
+	// References lists the dangling plugin references, when checked
+	References []*kine.DanglingReference
 }
 
-func (e *KindExecutor) runKindSync(_ context.Context, _ adctypes.Config, args []string) error {
-	// Parse args to extract labels, types, and file path
-	labels, adcTypes, filePath, err := e.parseArgs(args)
+// Plan runs the sync described by args up to the diff and returns the
+// events it would apply. The cache is left untouched and nothing is sent,
+// whatever the mode of the executor, and the sync is not recorded in the
+// stats and statuses.
+func (e *KindExecutor) Plan(ctx context.Context, args []string) (*SyncPlan, error) {
+	syncID := uuid.NewString()
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	result := &syncResult{}
+	parsed, err := e.parseSyncArgs(ctx, args, result)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel, phase := e.withSyncTimeout(ctx, parsed.timeout)
+	defer cancel()
+	events, err := e.planKindSync(ctx, syncID, parsed, result)
 	if err != nil {
-		return fmt.Errorf("failed to parse args: %w", err)
+		return nil, phase.annotate(ctx, err)
+	}
+	// Plans are printed and logged, they never reach the gateway
+	for i := range events {
+		events[i] = events[i].Redacted()
 	}
+	return &SyncPlan{
+		SyncID:     syncID,
+		Events:     events,
+		Warnings:   result.warnings,
+		Conflicts:  result.conflicts,
+		References: result.references,
+	}, nil
+}
+
+// DeleteAllFor deletes the cached resources selected by selector, such as
+// those of a deleted parent resource, without going through a resource
+// file. Deletes are ordered like the ones of a sync. Nothing matching is not
+// an error.
+func (e *KindExecutor) DeleteAllFor(ctx context.Context, selector kine.KindLabelSelector) error {
+	syncID := uuid.NewString()
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
 
-	// Load resources from file
-	resources, err := e.loadResourcesFromFile(filePath)
+	result := &syncResult{labels: selectorLabels(selector)}
+	ctx, span := e.startSpan(ctx, spanDeleteAllFor)
+	if span != nil {
+		span.SetAttributes(attrSyncID.String(syncID))
+	}
+	applied, err := e.deleteAllFor(ctx, syncID, result)
+	e.stats.record(syncID, applied, result.warningMessages(), err)
+	e.recordStatus(syncID, result, err)
+	setSelectorAttributes(span, result.labels)
+	setEventAttributes(span, result.events)
+	endSpan(span, err)
+	return err
+}
+
+func (e *KindExecutor) deleteAllFor(ctx context.Context, syncID string, result *syncResult) (int, error) {
+	log := e.log.WithValues("syncID", syncID)
+
+	// Diffing nothing against the selected resources deletes all of them
+	diffCtx, span := e.startSpan(ctx, spanDiff)
+	events, err := e.differ.Diff(diffCtx, &kine.TransferredResources{}, e.protectGlobalRules(log, &kine.DiffOptions{
+		Labels: result.labels,
+		SyncID: syncID,
+	}))
+	setEventAttributes(span, events)
+	endSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to load resources from file %s: %w", filePath, err)
+		return 0, err
 	}
+	log.Info("deleting resources", "labels", result.labels, "totalEvents", len(events))
+	if err := e.applyEvents(ctx, log, events); err != nil {
+		return 0, err
+	}
+	e.recordInputHash(log, result.labels, "")
+	result.events = events
+	return len(events), nil
+}
+
+// protectGlobalRules sets the protected global rules of the executor on
+// diff options, logging the deletions the diff drops
+func (e *KindExecutor) protectGlobalRules(log logr.Logger, opts *kine.DiffOptions) *kine.DiffOptions {
+	opts.ProtectedGlobalRules = e.opts.ProtectedGlobalRules
+	opts.OnProtected = func(event kine.Event) {
+		labels := kine.KineLabelIndexer.GetLabels(event.OldValue)
+		log.Info("keeping protected global rule", "resourceID", event.ResourceID,
+			"ownerKind", labels[label.LabelKind], "ownerNamespace", labels[label.LabelNamespace],
+			"ownerName", labels[label.LabelName])
+	}
+	return opts
+}
 
-	// Transfer ADC resources to Kine resources
-	e.log.V(1).Info("transferring ADC resources to Kine resources")
-	transferredResources, err := kine.TransferResources(resources)
+// ResetState empties the cache and forgets the sync statuses, for warm
+// starts and migrations that rebuild the state from scratch. With
+// deleteFromAdapter, the previously cached resources are also deleted from
+// the etcd adapter, otherwise the adapter keeps serving them.
+func (e *KindExecutor) ResetState(ctx context.Context, deleteFromAdapter bool) error {
+	syncID := uuid.NewString()
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	log := e.log.WithValues("syncID", syncID)
+
+	if deleteFromAdapter {
+		// Diffing nothing without a selector deletes everything cached
+		events, err := e.differ.Diff(ctx, &kine.TransferredResources{}, &kine.DiffOptions{SyncID: syncID})
+		if err != nil {
+			return err
+		}
+		log.Info("deleting cached resources", "totalEvents", len(events))
+		if err := e.applyEvents(ctx, log, events); err != nil {
+			return err
+		}
+	}
+	if err := e.cache.Reset(); err != nil {
+		return fmt.Errorf("failed to reset cache: %w", err)
+	}
+	e.statuses.reset()
+	log.Info("reset executor state", "deleteFromAdapter", deleteFromAdapter)
+	return nil
+}
+
+// runKindSync syncs the resources described by args and returns the number
+// of events applied, or planned in diff-only mode. The outcome is also
+// collected into result.
+func (e *KindExecutor) runKindSync(ctx context.Context, syncID string, _ adctypes.Config, args []string, result *syncResult) (int, error) {
+	parsed, err := e.parseSyncArgs(ctx, args, result)
+	if err != nil {
+		return 0, err
+	}
+	log := e.syncLogger(syncID, parsed.verbosity)
+	if e.skipUnchangedInput(log, parsed) {
+		return 0, nil
+	}
+	ctx, cancel, phase := e.withSyncTimeout(ctx, parsed.timeout)
+	defer cancel()
+	events, err := e.planKindSync(ctx, syncID, parsed, result)
+	if err != nil {
+		return 0, phase.annotate(ctx, err)
+	}
+	if e.opts.DiffOnly {
+		log.Info("diff-only mode, not applying events", "totalEvents", len(events))
+		result.events = events
+		return len(events), nil
+	}
+
+	// Forget the input hash first, a partially applied sync must not be
+	// skipped when retried
+	e.recordInputHash(log, parsed.labels, "")
+	if err := e.applyEvents(ctx, log, events); err != nil {
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			return len(applyErr.Applied), err
+		}
+		return 0, phase.annotate(ctx, err)
+	}
+	e.recordInputHash(log, parsed.labels, parsed.inputHash)
+	e.recordConflictAudit(log, syncID, result.conflicts)
+
+	result.events = events
+	return len(events), nil
+}
+
+// parseSyncArgs parses the arguments of a sync, collecting its selector
+// labels into result
+func (e *KindExecutor) parseSyncArgs(ctx context.Context, args []string, result *syncResult) (*syncArgs, error) {
+	_, span := e.startSpan(ctx, spanParseArgs)
+	parsed, err := e.parseArgs(args)
+	if err == nil {
+		setSelectorAttributes(span, parsed.labels)
+	}
+	endSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to transfer resources: %w", err)
+		return nil, fmt.Errorf("failed to parse args: %w", err)
+	}
+	result.labels = parsed.labels
+	return parsed, nil
+}
+
+// planKindSync loads, transfers and diffs the resources described by the
+// parsed args and returns the diff events. Transfer warnings and route
+// conflicts are collected into result.
+func (e *KindExecutor) planKindSync(ctx context.Context, syncID string, parsed *syncArgs, result *syncResult) ([]kine.Event, error) {
+	log := e.syncLogger(syncID, parsed.verbosity)
+	labels, force := parsed.labels, parsed.force
+
+	// Load resources from file, transferring ADC resources to Kine
+	// resources as they are decoded
+	log.V(1).Info("transferring ADC resources to Kine resources")
+	_, span := e.startSpan(ctx, spanTransfer)
+	transferredResources, err := e.transferResourcesFromFile(parsed.filePath, e.transferOptions(labels))
+	if err == nil {
+		setTransferAttributes(span, transferredResources)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result.warnings = transferredResources.Warnings
+	for _, warning := range transferredResources.Warnings {
+		log.Error(warning.Cause, "transfer warning",
+			"kind", warning.Kind, "name", warning.Name, "labels", warning.Labels)
+	}
+	if e.opts.DetectRouteConflicts {
+		conflicts, err := e.detectRouteConflicts(labels, transferredResources.Routes)
+		if err != nil {
+			// Detection is advisory, it never fails the sync
+			log.Error(err, "failed to detect route conflicts")
+		}
+		result.conflicts = conflicts
+		for _, conflict := range conflicts {
+			log.Info("route conflict", "route", conflict.RouteID, "owner", conflict.Owner,
+				"otherRoute", conflict.OtherRouteID, "otherOwner", conflict.OtherOwner,
+				"host", conflict.Host, "method", conflict.Method)
+		}
 	}
 
 	// Convert ADC types to Kine types
-	kineTypes := e.convertADCTypesToKineTypes(adcTypes)
+	kineTypes, err := e.convertADCTypesToKineTypes(parsed.types)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert resource types: %w", err)
+	}
+	result.excluded = excludedByTypes(transferredResources, kineTypes)
+	for _, resourceType := range kine.ResourceTypes {
+		if n := result.excluded[resourceType]; n > 0 {
+			log.Info("WARNING: resources present in input but excluded by type filter",
+				"resourceType", resourceType, "count", n, "types", parsed.types)
+		}
+	}
+	if parsed.strictTypes && len(result.excluded) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrExcludedByTypeFilter, strings.Join(result.excludedMessages(), "; "))
+	}
 
 	// Generate diff events
-	e.log.V(1).Info("generating diff events")
+	log.V(1).Info("generating diff events")
 	diffOpts := &kine.DiffOptions{
-		Labels: labels,
-		Types:  kineTypes,
+		Labels:            labels,
+		Types:             kineTypes,
+		AllowDuplicateIDs: e.opts.AllowDuplicateIDs,
+		SyncID:            syncID,
+		ForceOwnership:    e.opts.ForceOwnership,
+		// The audit log records field level changes of updates
+		IncludeChanges: e.opts.AuditSink != nil,
+		ForceUpdate:    force,
+		// Resources skipped by a best-effort transfer keep their last
+		// applied state rather than being deleted
+		Keep: transferredResources.Skipped,
+		OnUpstreamMismatch: func(mismatch *kine.UpstreamMismatch) {
+			log.Info("WARNING: service embeds an upstream differing from its upstream_id",
+				"serviceID", mismatch.ServiceID, "upstreamID", mismatch.UpstreamID)
+			result.mismatches = append(result.mismatches, mismatch)
+		},
+	}
+	if force {
+		log.Info("WARNING: force update requested, rewriting every unchanged resource to the gateway",
+			"labels", labels)
+	}
+	if e.opts.AllowDuplicateIDs {
+		for _, dup := range kine.FindDuplicateIDs(transferredResources) {
+			log.Error(dup, "duplicate resource id, last writer wins")
+		}
 	}
-	events, err := e.differ.Diff(transferredResources, diffOpts)
+	diffCtx, span := e.startSpan(ctx, spanDiff)
+	events, err := e.differ.Diff(diffCtx, transferredResources, e.protectGlobalRules(log, diffOpts))
+	setEventAttributes(span, events)
+	endSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to diff resources: %w", err)
+		return nil, err
 	}
 
-	e.log.Info("diff completed", "totalEvents", len(events))
+	log.Info("diff completed", "totalEvents", len(events))
+	if e.opts.CheckPluginReferences {
+		references, err := e.checkPluginReferences(transferredResources, events)
+		if err != nil {
+			// The check is advisory, it never fails the sync
+			log.Error(err, "failed to check plugin references")
+		}
+		result.references = references
+		for _, ref := range references {
+			log.Info("dangling plugin reference", "resourceType", ref.ResourceType, "resourceID", ref.ResourceID,
+				"plugin", ref.Plugin, "kind", ref.Kind, "id", ref.ID, "pointer", ref.Pointer)
+		}
+	}
+	if len(events) == 0 && len(labels) > 0 && transferredResources.Empty() {
+		if matched, err := e.matchesCachedResources(labels); err == nil && !matched {
+			log.Info("label selector matches no cached or desired resources", "labels", labels)
+		}
+	}
+	return events, nil
+}
 
-	// Process events: apply cache changes and send to etcd adapter
+// applyEvents applies diff events to the cache and sends them to the etcd
+// adapter
+func (e *KindExecutor) applyEvents(ctx context.Context, log logr.Logger, events []kine.Event) error {
+	if e.opts.DiffOnly {
+		// Deletes and resets only plan in diff-only mode too
+		log.Info("diff-only mode, not applying events", "totalEvents", len(events))
+		return nil
+	}
+	// Keep one event per resource, so that the cache and the adapter only
+	// see the final state of each
+	events, err := kine.CompactEvents(events)
+	if err != nil {
+		return err
+	}
+	// Convert kine events to adapter events before touching the cache,
+	// so that a cancellation leaves the cache untouched
 	adapterEvents := make([]*adapter.Event, 0, len(events))
 	for _, event := range events {
-		// Apply cache changes
-		if err := e.applyCacheChange(event); err != nil {
-			e.log.Error(err, "failed to apply cache change", "event", event)
-			return fmt.Errorf("failed to apply cache change: %w", err)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := eventValue(event); err != nil {
+			log.Error(err, "invalid event", "type", event.Type,
+				"resourceType", event.ResourceType, "resourceID", event.ResourceID)
+			return fmt.Errorf("%w: invalid event: %w", ErrApplyFailed, err)
 		}
-
-		// Convert kine event to adapter event
 		adapterEvent, err := e.convertToAdapterEvent(event)
 		if err != nil {
-			e.log.Error(err, "failed to convert event", "event", event)
-			return fmt.Errorf("failed to convert event: %w", err)
+			log.Error(err, "failed to convert event", "op", event.Type,
+				"resourceType", event.ResourceType, "resourceID", event.ResourceID)
+			return fmt.Errorf("%w: failed to convert event: %w", ErrApplyFailed, err)
 		}
 		adapterEvents = append(adapterEvents, adapterEvent)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := e.detectKeyCollisions(events, adapterKey); err != nil {
+		log.Error(err, "etcd key collision")
+		return err
+	}
+	if e.opts.GlobalRuleMode == GlobalRuleAggregated {
+		if err := e.aggregateGlobalRules(events, adapterEvents); err != nil {
+			return err
+		}
+	}
+	e.tombstoneDeletes(adapterEvents)
+
+	// Log the batch before the cache changes, so that it is replayed if the
+	// process dies before the adapter got it
+	var sent func()
+	if e.wal != nil && len(adapterEvents) > 0 {
+		seq, err := e.wal.append(withoutNil(adapterEvents))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrApplyFailed, err)
+		}
+		sent = func() {
+			if err := e.wal.commit(seq); err != nil {
+				log.Error(err, "failed to mark batch as sent in event WAL")
+			}
+		}
+	}
+
+	// Apply cache changes, only the applied events reach the adapter. The
+	// WAL keeps the whole batch, a replay of failed events is repaired by
+	// the next resync.
+	applied, applyErr := e.applyCacheChanges(ctx, log, events)
+	if applyErr != nil {
+		events, adapterEvents = keepApplied(events, applied), keepApplied(adapterEvents, applied)
+	}
+	adapterEvents = withoutNil(adapterEvents)
+	logEvents(log, events)
 
 	// Send events to etcd adapter
-	if len(adapterEvents) > 0 {
-		e.log.V(1).Info("sending events to etcd adapter", "count", len(adapterEvents))
-		e.adapter.EventCh() <- adapterEvents
-		e.log.Info("successfully sent events to etcd adapter")
-	} else {
-		e.log.Info("no events to send to etcd adapter")
+	_, span := e.startSpan(ctx, spanSend)
+	err = e.sendEvents(ctx, log, events, adapterEvents, sent)
+	if span != nil {
+		span.SetAttributes(attrEvents.Int(len(adapterEvents)))
+	}
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if e.opts.DeletionMode == DeletionTombstone {
+		e.tombstones.track(adapterEvents, e.clock.Now())
+	}
+	return applyErr
+}
+
+// applyCacheChanges applies diff events to the cache. A failing event does
+// not stop the batch: the creates and updates of its children are skipped
+// and the other events applied. It returns whether each event was applied,
+// with an *ApplyError listing the failures if any.
+func (e *KindExecutor) applyCacheChanges(ctx context.Context, log logr.Logger, events []kine.Event) (applied []bool, err error) {
+	_, span := e.startSpan(ctx, spanApplyCache)
+	defer func() { endSpan(span, err) }()
+	setEventAttributes(span, events)
+
+	applied = make([]bool, len(events))
+	failedParents := make(map[string]bool)
+	report := &ApplyError{}
+	for i, event := range events {
+		var err error
+		if parentType, ok := parentRef(event); ok && failedParents[string(parentType)+"/"+event.ParentID] {
+			err = fmt.Errorf("%s: %w %s", refOf(event), errParentNotApplied, event.ParentID)
+		} else {
+			err = e.applyCacheChange(event)
+		}
+		if err != nil {
+			log.Error(err, "failed to apply cache change", "type", event.Type,
+				"resourceType", event.ResourceType, "resourceID", event.ResourceID)
+			if event.Type != kine.EventTypeDelete {
+				failedParents[string(event.ResourceType)+"/"+event.ResourceID] = true
+			}
+			report.Failed = append(report.Failed, &EventError{EventRef: refOf(event), Err: err})
+			continue
+		}
+		applied[i] = true
+		report.Applied = append(report.Applied, refOf(event))
 	}
+	if len(report.Failed) > 0 {
+		return applied, report
+	}
+	return applied, nil
+}
 
+// keepApplied returns the items whose event was applied
+func keepApplied[T any](items []T, applied []bool) []T {
+	kept := make([]T, 0, len(items))
+	for i, item := range items {
+		if applied[i] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// sendEvents sends adapter events to the etcd adapter, through the pacer
+// when enabled, and audits the diff events they were converted from. sent,
+// if any, is called once the adapter accepted the events.
+func (e *KindExecutor) sendEvents(ctx context.Context, log logr.Logger, events []kine.Event, adapterEvents []*adapter.Event, sent func()) error {
+	if len(adapterEvents) > 0 && e.pacer != nil {
+		log.V(1).Info("queueing events for etcd adapter", "count", len(adapterEvents))
+		e.pacer.enqueueNotify(adapterEvents, sent)
+		recordSent(ctx)
+		e.sendSecondary(ctx, log, adapterEvents)
+		e.recordAudit(log, events)
+	} else if len(adapterEvents) > 0 {
+		log.V(1).Info("sending events to etcd adapter", "count", len(adapterEvents))
+		select {
+		case e.adapter.EventCh() <- adapterEvents:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: failed to send events: %w", ErrBackendUnavailable, ctx.Err())
+		}
+		log.Info("successfully sent events to etcd adapter")
+		recordSent(ctx)
+		if sent != nil {
+			sent()
+		}
+		e.sendSecondary(ctx, log, adapterEvents)
+		e.recordAudit(log, events)
+	} else {
+		log.Info("no events to send to etcd adapter")
+		if sent != nil {
+			// Every event of the logged batch failed to apply
+			sent()
+		}
+	}
 	return nil
 }
 
-// convertADCTypesToKineTypes converts ADC resource types to Kine resource types
-// ADC Service -> Kine Service + Route
-// ADC SSL -> Kine SSL
-// ADC GlobalRule -> Kine GlobalRule
-func (e *KindExecutor) convertADCTypesToKineTypes(adcTypes []string) []string {
+// selectorLabels returns the labels kine.SelectorFromLabels turns back into
+// selector, leaving out the trailing empty values of partial selectors
+func selectorLabels(selector kine.KindLabelSelector) map[string]string {
+	labels := map[string]string{
+		label.LabelKind:      selector.Kind,
+		label.LabelNamespace: selector.Namespace,
+		label.LabelName:      selector.Name,
+	}
+	if selector.Partial && selector.Name == "" {
+		delete(labels, label.LabelName)
+		if selector.Namespace == "" {
+			delete(labels, label.LabelNamespace)
+		}
+	}
+	return labels
+}
+
+// matchesCachedResources reports whether any cached resource is selected by
+// the kind, namespace and name labels
+func (e *KindExecutor) matchesCachedResources(labels map[string]string) (bool, error) {
+	selector, err := kine.SelectorFromLabels(labels)
+	if err != nil {
+		return false, err
+	}
+	matched := false
+	count := func(n int, err error) error {
+		matched = matched || n > 0
+		return err
+	}
+	routes, err := e.cache.ListRoutes(selector, kine.WithoutCopy())
+	if err := count(len(routes), err); err != nil {
+		return false, err
+	}
+	services, err := e.cache.ListServices(selector, kine.WithoutCopy())
+	if err := count(len(services), err); err != nil {
+		return false, err
+	}
+	upstreams, err := e.cache.ListUpstreams(selector, kine.WithoutCopy())
+	if err := count(len(upstreams), err); err != nil {
+		return false, err
+	}
+	ssls, err := e.cache.ListSSL(selector, kine.WithoutCopy())
+	if err := count(len(ssls), err); err != nil {
+		return false, err
+	}
+	globalRules, err := e.cache.ListGlobalRules(selector, kine.WithoutCopy())
+	if err := count(len(globalRules), err); err != nil {
+		return false, err
+	}
+	protos, err := e.cache.ListProtos(selector, kine.WithoutCopy())
+	if err := count(len(protos), err); err != nil {
+		return false, err
+	}
+	pluginMetadata, err := e.cache.ListPluginMetadata(selector, kine.WithoutCopy())
+	if err := count(len(pluginMetadata), err); err != nil {
+		return false, err
+	}
+	return matched, nil
+}
+
+// recordAudit hands the applied events to the audit sink, if any.
+// Audit failures are logged but never fail the sync.
+func (e *KindExecutor) recordAudit(log logr.Logger, events []kine.Event) {
+	if e.opts.AuditSink == nil {
+		return
+	}
+	if err := e.opts.AuditSink.Record(buildAuditRecords(events, time.Now())); err != nil {
+		log.Error(err, "failed to record audit log", "events", len(events))
+	}
+}
+
+// convertADCTypesToKineTypes converts ADC resource types, or Kine resource
+// type names, to Kine resource types with kine.ParseResourceType. An ADC
+// Service transfers to Kine Services, Routes and Upstreams. ADC consumers
+// have no Kine counterpart and are ignored, other unknown types fail.
+func (e *KindExecutor) convertADCTypesToKineTypes(adcTypes []string) ([]string, error) {
 	if len(adcTypes) == 0 {
 		// If no types specified, return empty to include all types
-		return nil
+		return nil, nil
 	}
 
-	kineTypesSet := make(map[string]bool)
+	var names []string
 	for _, adcType := range adcTypes {
-		switch adcType {
-		case adctypes.TypeService:
-			// ADC Service transfers to both Kine Service and Route
-			kineTypesSet[string(kine.ResourceTypeService)] = true
-			kineTypesSet[string(kine.ResourceTypeRoute)] = true
-			kineTypesSet[string(kine.ResourceTypeUpstream)] = true
-		case adctypes.TypeSSL:
-			kineTypesSet[string(kine.ResourceTypeSSL)] = true
-		case adctypes.TypeGlobalRule:
-			kineTypesSet[string(kine.ResourceTypeGlobalRule)] = true
+		if adcType != adctypes.TypeConsumer {
+			names = append(names, adcType)
+		}
+	}
+	resourceTypes, err := kine.ParseResourceTypes(names)
+	if err != nil {
+		return nil, err
+	}
+	kineTypesSet := make(map[kine.ResourceType]bool)
+	for _, resourceType := range resourceTypes {
+		kineTypesSet[resourceType] = true
+		if resourceType == kine.ResourceTypeService {
+			kineTypesSet[kine.ResourceTypeRoute] = true
+			kineTypesSet[kine.ResourceTypeUpstream] = true
 		}
 	}
 
-	// Convert set to slice
+	// Convert set to slice, in resource type order
 	kineTypes := make([]string, 0, len(kineTypesSet))
-	for kineType := range kineTypesSet {
-		kineTypes = append(kineTypes, kineType)
+	for _, resourceType := range kine.ResourceTypes {
+		if kineTypesSet[resourceType] {
+			kineTypes = append(kineTypes, string(resourceType))
+		}
 	}
 
 	e.log.V(1).Info("converted ADC types to Kine types", "adcTypes", adcTypes, "kineTypes", kineTypes)
-	return kineTypes
+	return kineTypes, nil
 }
 
 // applyCacheChange applies a single event to the cache
 func (e *KindExecutor) applyCacheChange(event kine.Event) error {
+	value, err := eventValue(event)
+	if err != nil {
+		return err
+	}
+	if event.Type == kine.EventTypeDelete {
+		// Delete by the event ID, the old value may be a stale copy
+		err = kine.DeleteByID(e.cache, event.ResourceType, event.ResourceID)
+	} else {
+		// Event values are created by the transfer for this sync and only
+		// read afterwards, the cache can keep them without a copy
+		err = e.cache.InsertOwned(value)
+		if err == nil && event.Forced {
+			// Unchanged content keeps its revision on insert
+			err = e.cache.Touch(event.ResourceType, event.ResourceID)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s %q: %w", event.Type, event.ResourceType, event.ResourceID, err)
+	}
+	return nil
+}
+
+// errInvalidEventValue is returned for events whose value is missing or
+// does not match their resource type
+var errInvalidEventValue = errors.New("invalid event value")
+
+// eventValue returns the value an event applies to the cache, the new value
+// of creates and updates and the old value of deletes. It fails when the
+// value is nil or not of the type of the event resource, such as a map left
+// by a JSON round trip.
+func eventValue(event kine.Event) (any, error) {
+	var value any
 	switch event.Type {
 	case kine.EventTypeCreate, kine.EventTypeUpdate:
-		return e.cache.Insert(event.NewValue)
+		value = event.NewValue
 	case kine.EventTypeDelete:
-		return e.cache.Delete(event.OldValue)
+		value = event.OldValue
 	default:
-		return fmt.Errorf("unknown event type: %s", event.Type)
+		return nil, fmt.Errorf("unknown event type: %s", event.Type)
+	}
+
+	var ok bool
+	switch event.ResourceType {
+	case kine.ResourceTypeRoute:
+		ok = isResource[kine.Route](value)
+	case kine.ResourceTypeService:
+		ok = isResource[kine.Service](value)
+	case kine.ResourceTypeUpstream:
+		ok = isResource[kine.Upstream](value)
+	case kine.ResourceTypeSSL:
+		ok = isResource[kine.SSL](value)
+	case kine.ResourceTypeGlobalRule:
+		ok = isResource[kine.GlobalRule](value)
+	case kine.ResourceTypeProto:
+		ok = isResource[kine.Proto](value)
+	case kine.ResourceTypePluginMetadata:
+		ok = isResource[kine.PluginMetadata](value)
+	default:
+		return nil, fmt.Errorf("%s %s %q: %w", event.Type, event.ResourceType, event.ResourceID, kine.ErrUnknownResourceType)
 	}
+	if !ok {
+		return nil, fmt.Errorf("%s %s %q: %w: got %T", event.Type, event.ResourceType, event.ResourceID, errInvalidEventValue, value)
+	}
+	return value, nil
 }
 
-// convertToAdapterEvent converts a kine event to an adapter event
-func (e *KindExecutor) convertToAdapterEvent(event kine.Event) (*adapter.Event, error) {
-	// Build key with /apisix prefix
+// isResource reports whether value is a non-nil *T
+func isResource[T any](value any) bool {
+	v, ok := value.(*T)
+	return ok && v != nil
+}
+
+// adapterKey returns the etcd key of a resource under the APISIX key prefix.
+// IDs are validated at transfer time, any "/" or space that slips through
+// is escaped so that the ID stays a single, reversible key segment.
+func adapterKey(resourceType kine.ResourceType, id string) string {
 	_, apisixKeyPrefix := getConfig()
-	key := fmt.Sprintf("%s/%s/%s", apisixKeyPrefix, event.ResourceType, event.ResourceID)
+	return fmt.Sprintf("%s/%s/%s", apisixKeyPrefix, resourceType.KeySegment(), url.PathEscape(id))
+}
 
+// convertToAdapterEvent converts a kine event to an adapter event
+func (e *KindExecutor) convertToAdapterEvent(event kine.Event) (*adapter.Event, error) {
 	adapterEvent := &adapter.Event{
-		Key: key,
+		Key: adapterKey(event.ResourceType, event.ResourceID),
 	}
 
 	// Set event type
@@ -241,64 +1726,195 @@ func (e *KindExecutor) convertToAdapterEvent(event kine.Event) (*adapter.Event,
 
 	// Serialize value for CREATE and UPDATE events
 	if event.Type != kine.EventTypeDelete {
-		valueBytes, err := json.Marshal(event.NewValue)
+		valueBytes, err := kine.CanonicalJSON(event.NewValue)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal new value: %w", err)
 		}
+		if err := e.checkValueSize(event, len(valueBytes)); err != nil {
+			return nil, err
+		}
 		adapterEvent.Value = valueBytes
 	}
 
 	return adapterEvent, nil
 }
 
-// parseArgs parses the command line arguments to extract labels, types, and file path
-func (e *KindExecutor) parseArgs(args []string) (map[string]string, []string, string, error) {
-	labels := make(map[string]string)
-	var types []string
-	var filePath string
+const (
+	// defaultValueSizeWarning is the value size past which syncs warn
+	defaultValueSizeWarning = 1 << 20
+	// defaultMaxValueSize is the default request size limit of etcd
+	defaultMaxValueSize = 1536 << 10
+)
+
+// checkValueSize warns about marshaled values above the soft size limit and
+// rejects those above the hard one, which etcd would refuse
+func (e *KindExecutor) checkValueSize(event kine.Event, size int) error {
+	warning, limit := e.opts.ValueSizeWarning, e.opts.MaxValueSize
+	if warning <= 0 {
+		warning = defaultValueSizeWarning
+	}
+	if limit <= 0 {
+		limit = defaultMaxValueSize
+	}
+	if size > limit {
+		hint := ""
+		if event.ResourceType == kine.ResourceTypeSSL {
+			hint = ", split the certificate chain into several SSLs"
+		}
+		return fmt.Errorf("%w: %s %s %q: value of %d bytes exceeds the limit of %d bytes%s",
+			ErrInvalidInput, event.Type, event.ResourceType, event.ResourceID, size, limit, hint)
+	}
+	if size > warning {
+		e.log.Info("WARNING: large resource value, etcd may reject it", "resourceType", event.ResourceType,
+			"resourceID", event.ResourceID, "size", size, "warningSize", warning, "maxSize", limit)
+	}
+	return nil
+}
+
+// syncArgs are the parsed arguments of a sync
+type syncArgs struct {
+	labels   map[string]string
+	types    []string
+	filePath string
+	// force updates unchanged resources
+	force bool
+	// timeout bounds the sync, unbounded when zero
+	timeout time.Duration
+	// verbosity raises the log verbosity of the sync
+	verbosity int
+	// inputHash is the opaque hash of the input of the sync, see ShouldSync
+	inputHash string
+	// strictTypes fails the sync when the type filter excludes resources
+	// present in the input
+	strictTypes bool
+}
+
+// parseArgs parses the command line arguments to extract labels, types, file
+// path, whether unchanged resources are force updated, the sync timeout, the
+// log verbosity, the input hash and whether types are strict
+func (e *KindExecutor) parseArgs(args []string) (*syncArgs, error) {
+	parsed := &syncArgs{
+		labels:  make(map[string]string),
+		timeout: e.opts.SyncTimeout,
+	}
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "-f":
 			if i+1 < len(args) {
-				filePath = args[i+1]
+				parsed.filePath = args[i+1]
 				i++
 			}
 		case "--label-selector":
 			if i+1 < len(args) {
 				labelPair := args[i+1]
 				parts := strings.SplitN(labelPair, "=", 2)
-				if len(parts) == 2 {
-					labels[parts[0]] = parts[1]
+				// Selectors are typed by hand, ignore stray whitespace
+				if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" {
+					parsed.labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
 				}
 				i++
 			}
 		case "--include-resource-type":
 			if i+1 < len(args) {
-				types = append(types, args[i+1])
+				parsed.types = append(parsed.types, args[i+1])
+				i++
+			}
+		case "--force":
+			parsed.force = true
+		case "--timeout":
+			if i+1 < len(args) {
+				timeout, err := time.ParseDuration(args[i+1])
+				if err != nil || timeout <= 0 {
+					return nil, fmt.Errorf("%w: invalid --timeout %q, expected a positive duration", ErrInvalidInput, args[i+1])
+				}
+				parsed.timeout = timeout
+				i++
+			}
+		case "--v":
+			if i+1 < len(args) {
+				verbosity, err := strconv.Atoi(args[i+1])
+				if err != nil || verbosity < 0 {
+					return nil, fmt.Errorf("%w: invalid --v %q, expected a non-negative integer", ErrInvalidInput, args[i+1])
+				}
+				parsed.verbosity = verbosity
+				i++
+			}
+		case "--input-hash":
+			if i+1 < len(args) {
+				parsed.inputHash = args[i+1]
 				i++
 			}
+		case "--strict-types":
+			parsed.strictTypes = true
 		}
 	}
 
-	if filePath == "" {
-		return nil, nil, "", errors.New("file path not found in args")
+	if parsed.filePath == "" {
+		return nil, fmt.Errorf("%w: file path not found in args", ErrInvalidInput)
 	}
 
-	return labels, types, filePath, nil
+	return parsed, nil
 }
 
-// loadResourcesFromFile loads ADC resources from the specified file
-func (e *KindExecutor) loadResourcesFromFile(filePath string) (*adctypes.Resources, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+// transferOptions returns the transfer options configured for the executor,
+// owning the transferred resources by the selector labels of the sync
+func (e *KindExecutor) transferOptions(labels map[string]string) *kine.TransferOptions {
+	return &kine.TransferOptions{
+		BestEffort:       e.opts.BestEffortTransfer,
+		NamespacedIDs:    e.opts.NamespacedIDs,
+		SharedUpstreams:  e.opts.SharedUpstreams,
+		SplitUpstreams:   e.opts.SplitUpstreams,
+		DerivePriorities: e.opts.DerivePriorities,
+		PluginValidator:  e.opts.PluginValidator,
+		OwnerLabels:      labels,
+		ZeroWeightPolicy: e.opts.ZeroWeightPolicy,
+
+		PropagateTimeouts: e.opts.PropagateTimeouts,
 	}
+}
 
-	var resources adctypes.Resources
-	if err := json.Unmarshal(data, &resources); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal resources: %w", err)
+// transferResourcesFromFile streams the ADC resources of the specified file
+// into Kine resources. Services are transferred as they are decoded, so the
+// whole file is never held in memory.
+func (e *KindExecutor) transferResourcesFromFile(filePath string, opts *kine.TransferOptions) (*kine.TransferredResources, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load resources from file %s: failed to read file: %w", ErrInvalidInput, filePath, err)
 	}
+	defer func() { _ = f.Close() }()
 
-	return &resources, nil
+	var transferErr error
+	transferrer := kine.NewTransferrer(opts)
+	resources, err := decodeResources(f, func(service *adctypes.Service) error {
+		transferErr = transferrer.AddService(service)
+		return transferErr
+	})
+	if transferErr != nil {
+		return nil, transferErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load resources from file %s: failed to unmarshal resources: %w",
+			ErrInvalidInput, filePath, err)
+	}
+	for _, ssl := range resources.SSLs {
+		if err := transferrer.AddSSL(ssl); err != nil {
+			return nil, err
+		}
+	}
+	if err := transferrer.AddGlobalRules(resources.GlobalRules); err != nil {
+		return nil, err
+	}
+	for _, proto := range resources.Protos {
+		if err := transferrer.AddProto(proto); err != nil {
+			return nil, err
+		}
+	}
+	if err := transferrer.AddPluginMetadata(resources.PluginMetadata); err != nil {
+		return nil, err
+	}
+	for _, consumer := range resources.Consumers {
+		transferrer.AddConsumer(consumer)
+	}
+	return transferrer.Result(), nil
 }
@@ -0,0 +1,3389 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine/testutil"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+// fakeAdapter records the event batches sent by the executor and applies
+// them to an in-memory store
+type fakeAdapter struct {
+	ch chan []*adapter.Event
+
+	mu      sync.Mutex
+	batches [][]*adapter.Event
+	store   map[string][]byte
+}
+
+func newFakeAdapter() *fakeAdapter {
+	return &fakeAdapter{
+		ch:    make(chan []*adapter.Event, 16),
+		store: make(map[string][]byte),
+	}
+}
+
+func (a *fakeAdapter) EventCh() chan<- []*adapter.Event {
+	return a.ch
+}
+
+func (a *fakeAdapter) Serve(context.Context, net.Listener) error {
+	return nil
+}
+
+func (a *fakeAdapter) Shutdown(context.Context) error {
+	return nil
+}
+
+func (a *fakeAdapter) List(_ context.Context, prefix string) (map[string][]byte, error) {
+	a.received()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	values := make(map[string][]byte)
+	for key, value := range a.store {
+		if strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// received drains and applies the batches sent so far
+func (a *fakeAdapter) received() [][]*adapter.Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for {
+		select {
+		case batch := <-a.ch:
+			a.batches = append(a.batches, batch)
+			for _, ev := range batch {
+				switch ev.Type {
+				case adapter.EventDelete:
+					delete(a.store, ev.Key)
+				case adapter.EventAdd:
+					// Like the etcd adapter, creates of existing keys
+					// fail and are ignored
+					if _, ok := a.store[ev.Key]; !ok {
+						a.store[ev.Key] = ev.Value
+					}
+				default:
+					a.store[ev.Key] = ev.Value
+				}
+			}
+		default:
+			return a.batches
+		}
+	}
+}
+
+// put writes a key directly into the store, bypassing the executor
+func (a *fakeAdapter) put(key string, value []byte) {
+	a.received()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store[key] = value
+}
+
+func (a *fakeAdapter) get(key string) ([]byte, bool) {
+	a.received()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	value, ok := a.store[key]
+	return value, ok
+}
+
+// memoryAuditSink keeps audit records in memory
+type memoryAuditSink struct {
+	records []AuditRecord
+	err     error
+}
+
+func (s *memoryAuditSink) Record(records []AuditRecord) error {
+	s.records = append(s.records, records...)
+	return s.err
+}
+
+// newTestKindExecutor creates a KindExecutor backed by a fake adapter
+func newTestKindExecutor(t *testing.T, opts ...KindExecutorOption) (*KindExecutor, *fakeAdapter) {
+	t.Helper()
+	options := (&KindExecutorOptions{CacheBackend: CacheBackendMemDB}).ApplyOptions(opts)
+	cache, err := newCache(options)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	fake := newFakeAdapter()
+	return &KindExecutor{
+		log:     logr.Discard(),
+		cache:   cache,
+		differ:  kine.NewDiffer(cache),
+		adapter: fake,
+		opts:    options,
+		clock:   clock.RealClock{},
+		tracer:  newTracer(options),
+
+		adapterAddr: defaultEtcdAdapterAddr,
+	}, fake
+}
+
+func TestNewKindExecutorUnixSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("unix socket permissions are only checked on linux")
+	}
+	path := filepath.Join(t.TempDir(), "run", "etcd.sock")
+	addr := "unix://" + path
+
+	// Leave a stale socket file behind, as a crashed process would
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create socket directory: %v", err)
+	}
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	executor, err := NewKindExecutor(logr.Discard(), WithAdapterAddr(addr), WithAdapterSocketMode(0o600))
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+	if executor.AdapterAddr() != addr {
+		t.Errorf("expected adapter address %s, got %s", addr, executor.AdapterAddr())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected socket mode 0600, got %o", info.Mode().Perm())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := DialAdapter(ctx, executor.AdapterAddr(), nil)
+	if err != nil {
+		t.Fatalf("failed to dial etcd adapter: %v", err)
+	}
+	_ = conn.Close()
+
+	// A socket still accepting connections is not treated as stale
+	if _, err := NewKindExecutor(logr.Discard(), WithAdapterAddr(addr)); err == nil {
+		t.Error("expected an error for a socket in use")
+	}
+
+	if err := executor.Close(); err != nil {
+		t.Fatalf("failed to close executor: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket file to be removed, got %v", err)
+	}
+}
+
+func TestNewKindExecutorDiffOnly(t *testing.T) {
+	// Find a free port for the adapter address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	executor, err := NewKindExecutor(logr.Discard(), WithDiffOnly(), WithAdapterAddr(addr))
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+	defer func() {
+		_ = executor.Close()
+	}()
+	if executor.AdapterAddr() != "" {
+		t.Errorf("expected no adapter address, got %s", executor.AdapterAddr())
+	}
+	// Nothing is bound to the configured address
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected %s to be free: %v", addr, err)
+	}
+	_ = ln.Close()
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	plan, err := executor.Plan(context.Background(), args)
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if len(plan.Events) != 1 || plan.Events[0].Type != kine.EventTypeCreate {
+		t.Fatalf("expected a planned create, got %v", plan.Events)
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if stats := executor.Stats(); stats.Count != 1 || stats.LastEvents != 1 {
+		t.Errorf("expected one sync with one planned event, got %+v", stats)
+	}
+	status, ok := executor.GetStatus(selectorFromLabels(testLabels))
+	if !ok || status.Created != 1 {
+		t.Errorf("expected a status with one planned create, got %+v (%v)", status, ok)
+	}
+	// The cache is left untouched, so the sync plans the same again
+	ssls, err := executor.cache.ListSSL()
+	if err != nil {
+		t.Fatalf("failed to list ssls: %v", err)
+	}
+	if len(ssls) != 0 {
+		t.Errorf("expected an untouched cache, got %d ssls", len(ssls))
+	}
+	if err := executor.RepublishAll(context.Background()); err == nil {
+		t.Error("expected republishing to fail without an adapter")
+	}
+}
+
+// testCA signs certificates for the adapter TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+	file := filepath.Join(dir, name+".crt")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a certificate and key named after the common name to dir
+func (ca *testCA) issue(t *testing.T, dir, commonName string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, commonName+".crt")
+	keyFile = filepath.Join(dir, commonName+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", file, err)
+	}
+}
+
+// copyFile replaces dst with the contents of src
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", dst, err)
+	}
+}
+
+func TestNewKindExecutorTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+	serverCert, serverKey := ca.issue(t, dir, "adapter-1", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+	wrongCert, wrongKey := otherCA.issue(t, dir, "intruder", x509.ExtKeyUsageClientAuth)
+
+	// The executor serves copies, so that the test can rotate them
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile(t, serverCert, certFile)
+	copyFile(t, serverKey, keyFile)
+
+	executor, err := NewKindExecutor(logr.Discard(),
+		WithAdapterAddr("127.0.0.1:0"),
+		WithAdapterTLS(certFile, keyFile),
+		WithAdapterClientCA(ca.file),
+	)
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+
+	// handshake returns the common name of the adapter certificate
+	handshake := func(certFile, keyFile string) (string, error) {
+		config, err := AdapterClientTLSConfig(ca.file, certFile, keyFile)
+		if err != nil {
+			t.Fatalf("failed to build client TLS config: %v", err)
+		}
+		// TLS 1.2 reports rejected client certificates during the handshake
+		config.MaxVersion = tls.VersionTLS12
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := DialAdapter(ctx, executor.AdapterAddr(), config)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = conn.Close() }()
+		return conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	name, err := handshake(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("expected the handshake to succeed: %v", err)
+	}
+	if name != "adapter-1" {
+		t.Errorf("expected adapter-1 certificate, got %s", name)
+	}
+	if _, err := handshake(wrongCert, wrongKey); err == nil {
+		t.Error("expected a client certificate of another CA to be rejected")
+	}
+	if _, err := handshake("", ""); err == nil {
+		t.Error("expected a client without certificate to be rejected")
+	}
+
+	// Rotated certificates are picked up without a restart
+	rotatedCert, rotatedKey := ca.issue(t, dir, "adapter-2", x509.ExtKeyUsageServerAuth)
+	copyFile(t, rotatedKey, keyFile)
+	copyFile(t, rotatedCert, certFile)
+	deadline := time.Now().Add(5 * time.Second)
+	for name != "adapter-2" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		if name, err = handshake(clientCert, clientKey); err != nil {
+			name = ""
+		}
+	}
+	if name != "adapter-2" {
+		t.Errorf("expected the rotated adapter-2 certificate, got %q", name)
+	}
+}
+
+func TestNewKindExecutorTLSRequiresKeyPair(t *testing.T) {
+	_, err := NewKindExecutor(logr.Discard(), WithAdapterAddr("127.0.0.1:0"), WithAdapterClientCA("ca.crt"))
+	if err == nil {
+		t.Error("expected an error for a client CA without a server certificate")
+	}
+}
+
+func TestNewKindExecutorEphemeralPorts(t *testing.T) {
+	executors := make([]*KindExecutor, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range executors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			executors[i], errs[i] = NewKindExecutor(logr.Discard(), WithAdapterAddr("127.0.0.1:0"))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("failed to create executor %d: %v", i, err)
+		}
+		executor := executors[i]
+		t.Cleanup(func() { _ = executor.Close() })
+	}
+	addrs := map[string]bool{}
+	for _, executor := range executors {
+		addr := executor.AdapterAddr()
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "0" {
+			t.Fatalf("expected a bound address with a real port, got %q (%v)", addr, err)
+		}
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			t.Fatalf("failed to dial etcd adapter at %s: %v", addr, err)
+		}
+		_ = conn.Close()
+		addrs[addr] = true
+	}
+	if len(addrs) != 2 {
+		t.Errorf("expected distinct adapter addresses, got %v", addrs)
+	}
+
+	// A busy address is reported as an error instead of a panic
+	if _, err := NewKindExecutor(logr.Discard(), WithAdapterAddr(executors[0].AdapterAddr())); err == nil {
+		t.Error("expected an error for an address in use")
+	}
+}
+
+// writeResources writes ADC resources to a temporary file and returns sync args
+func writeResources(t *testing.T, resources *adctypes.Resources, labels map[string]string) []string {
+	t.Helper()
+	data, err := json.Marshal(resources)
+	if err != nil {
+		t.Fatalf("failed to marshal resources: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "resources.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write resources: %v", err)
+	}
+	return BuildADCExecuteArgs(path, labels, nil)
+}
+
+var testLabels = map[string]string{
+	"k8s/kind":      "ApisixTls",
+	"k8s/namespace": "default",
+	"k8s/name":      "tls",
+}
+
+func testSSLResources(key string) *adctypes.Resources {
+	return &adctypes.Resources{
+		SSLs: []*adctypes.SSL{
+			{
+				Metadata: adctypes.Metadata{
+					ID:     "ssl-1",
+					Name:   "tls",
+					Labels: testLabels,
+				},
+				Certificates: []adctypes.Certificate{
+					{Certificate: "cert-data", Key: key},
+				},
+				Snis: []string{"example.com"},
+			},
+		},
+	}
+}
+
+func TestKindExecutorCompactsEvents(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	rule := func(id, plugin string) *kine.GlobalRule {
+		return &kine.GlobalRule{ID: id, Plugins: map[string]any{plugin: map[string]any{}}}
+	}
+	if err := executor.cache.InsertGlobalRule(rule("kept", "prometheus")); err != nil {
+		t.Fatalf("failed to insert global rule: %v", err)
+	}
+
+	events := []kine.Event{
+		{Type: kine.EventTypeDelete, ResourceType: kine.ResourceTypeGlobalRule, ResourceID: "kept",
+			OldValue: rule("kept", "prometheus")},
+		{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeGlobalRule, ResourceID: "kept",
+			NewValue: rule("kept", "real-ip")},
+		{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeGlobalRule, ResourceID: "dropped",
+			NewValue: rule("dropped", "cors")},
+		{Type: kine.EventTypeDelete, ResourceType: kine.ResourceTypeGlobalRule, ResourceID: "dropped",
+			OldValue: rule("dropped", "cors")},
+	}
+	if err := executor.applyEvents(context.Background(), logr.Discard(), events); err != nil {
+		t.Fatalf("failed to apply events: %v", err)
+	}
+
+	batches := fake.received()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("expected a single event, got %v", batches)
+	}
+	if event := batches[0][0]; event.Type != adapter.EventUpdate ||
+		event.Key != adapterKey(kine.ResourceTypeGlobalRule, "kept") || !strings.Contains(string(event.Value), "real-ip") {
+		t.Errorf("expected an update of the kept rule to real-ip, got %v %s %s", event.Type, event.Key, event.Value)
+	}
+	cached, err := executor.cache.GetGlobalRule("kept")
+	if err != nil || cached.Plugins["real-ip"] == nil {
+		t.Errorf("expected the cached rule to hold real-ip, got %v, %v", cached, err)
+	}
+	if _, err := executor.cache.GetGlobalRule("dropped"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected the created then deleted rule not to be cached, got %v", err)
+	}
+}
+
+func TestKindExecutorGlobalRuleModes(t *testing.T) {
+	resources := func(rules adctypes.GlobalRule) []string {
+		return writeResources(t, &adctypes.Resources{GlobalRules: rules}, testLabels)
+	}
+	sync := func(executor *KindExecutor, fake *fakeAdapter, rules adctypes.GlobalRule) []*adapter.Event {
+		t.Helper()
+		before := len(fake.received())
+		if err := executor.Execute(context.Background(), adctypes.Config{}, resources(rules)); err != nil {
+			t.Fatalf("failed to execute: %v", err)
+		}
+		var events []*adapter.Event
+		for _, batch := range fake.received()[before:] {
+			events = append(events, batch...)
+		}
+		return events
+	}
+	rules := adctypes.GlobalRule{
+		"prometheus": map[string]any{},
+		"real-ip":    map[string]any{"source": "http_x_forwarded_for"},
+	}
+
+	// Per plugin mode writes a key per global rule
+	executor, fake := newTestKindExecutor(t)
+	events := sync(executor, fake, rules)
+	if len(events) != 2 {
+		t.Fatalf("expected an event per global rule, got %d", len(events))
+	}
+	for _, id := range []string{"prometheus", "real-ip"} {
+		if _, ok := fake.get(adapterKey(kine.ResourceTypeGlobalRule, id)); !ok {
+			t.Errorf("expected a key for global rule %s", id)
+		}
+	}
+
+	// Aggregated mode writes one key merging all the plugins
+	executor, fake = newTestKindExecutor(t, WithGlobalRuleMode(GlobalRuleAggregated))
+	key := adapterKey(kine.ResourceTypeGlobalRule, aggregatedGlobalRuleID)
+	events = sync(executor, fake, rules)
+	if len(events) != 1 || events[0].Key != key {
+		t.Fatalf("expected a single event for %s, got %v", key, events)
+	}
+	var aggregated kine.GlobalRule
+	value, _ := fake.get(key)
+	if err := json.Unmarshal(value, &aggregated); err != nil {
+		t.Fatalf("failed to decode aggregated global rule: %v", err)
+	}
+	if len(aggregated.Plugins) != 2 || aggregated.Plugins["prometheus"] == nil || aggregated.Plugins["real-ip"] == nil {
+		t.Errorf("expected both plugins in the aggregated rule, got %s", value)
+	}
+
+	// A change of one plugin rewrites the key once
+	rules["prometheus"] = map[string]any{"prefer_name": true}
+	events = sync(executor, fake, rules)
+	if len(events) != 1 || events[0].Type != adapter.EventUpdate || !strings.Contains(string(events[0].Value), "prefer_name") {
+		t.Fatalf("expected a single update of the aggregated rule, got %v", events)
+	}
+
+	// Deleting one plugin keeps the others
+	delete(rules, "real-ip")
+	events = sync(executor, fake, rules)
+	if len(events) != 1 || strings.Contains(string(events[0].Value), "real-ip") ||
+		!strings.Contains(string(events[0].Value), "prometheus") {
+		t.Fatalf("expected an update without real-ip, got %v", events)
+	}
+	if _, err := executor.cache.GetGlobalRule("real-ip"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected real-ip to be deleted from the cache, got %v", err)
+	}
+	for _, id := range []string{"prometheus", "real-ip"} {
+		if _, ok := fake.get(adapterKey(kine.ResourceTypeGlobalRule, id)); ok {
+			t.Errorf("expected no per plugin key for %s", id)
+		}
+	}
+
+	// Resyncs compare the aggregated key
+	before := len(fake.received())
+	if err := executor.resync(context.Background()); err != nil {
+		t.Fatalf("failed to resync: %v", err)
+	}
+	if after := len(fake.received()); after != before {
+		t.Errorf("expected no drift in aggregated mode, got %d batches", after-before)
+	}
+
+	// Deleting the last plugin deletes the key
+	events = sync(executor, fake, adctypes.GlobalRule{})
+	if len(events) != 1 || events[0].Type != adapter.EventDelete || events[0].Key != key {
+		t.Fatalf("expected the aggregated rule to be deleted, got %v", events)
+	}
+
+	if _, err := NewKindExecutor(logr.Discard(), WithGlobalRuleMode("merged")); !errors.Is(err, ErrInvalidInput) {
+		t.Error("expected an unknown global rule mode to be rejected")
+	}
+	if _, err := NewKindExecutor(logr.Discard(), WithDeletionMode("soft")); !errors.Is(err, ErrInvalidInput) {
+		t.Error("expected an unknown deletion mode to be rejected")
+	}
+}
+
+func TestKindExecutorProtectedGlobalRules(t *testing.T) {
+	var logs strings.Builder
+	executor, fake := newTestKindExecutor(t, WithProtectedGlobalRules("prometheus"))
+	executor.log = funcr.New(func(prefix, args string) {
+		logs.WriteString(prefix + args + "\n")
+	}, funcr.Options{})
+
+	resources := &adctypes.Resources{GlobalRules: adctypes.GlobalRule{
+		"prometheus": map[string]any{},
+		"real-ip":    map[string]any{"source": "http_x_forwarded_for"},
+	}}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// Protected rules are still created and updated
+	resources.GlobalRules["prometheus"] = map[string]any{"prefer_name": true}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if value, _ := fake.get(adapterKey(kine.ResourceTypeGlobalRule, "prometheus")); !strings.Contains(string(value), "prefer_name") {
+		t.Errorf("expected the protected rule to be updated, got %s", value)
+	}
+
+	// An empty desired set only deletes the unprotected rule
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if _, err := executor.cache.GetGlobalRule("prometheus"); err != nil {
+		t.Errorf("expected the protected rule to stay cached: %v", err)
+	}
+	if _, ok := fake.get(adapterKey(kine.ResourceTypeGlobalRule, "prometheus")); !ok {
+		t.Error("expected the protected rule to stay in etcd")
+	}
+	if _, err := executor.cache.GetGlobalRule("real-ip"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected the unprotected rule to be deleted, got %v", err)
+	}
+	if _, ok := fake.get(adapterKey(kine.ResourceTypeGlobalRule, "real-ip")); ok {
+		t.Error("expected the unprotected rule to be deleted from etcd")
+	}
+	if !strings.Contains(logs.String(), `"msg"="keeping protected global rule"`) ||
+		!strings.Contains(logs.String(), `"resourceID"="prometheus"`) {
+		t.Errorf("expected the suppressed deletion to be logged, got %s", logs.String())
+	}
+
+	// Deleting everything for the owner keeps it too
+	selector := kine.KindLabelSelector{
+		Kind:      testLabels[label.LabelKind],
+		Namespace: testLabels[label.LabelNamespace],
+		Name:      testLabels[label.LabelName],
+	}
+	if err := executor.DeleteAllFor(context.Background(), selector); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := executor.cache.GetGlobalRule("prometheus"); err != nil {
+		t.Errorf("expected the protected rule to survive deleting its owner: %v", err)
+	}
+}
+
+func TestKindExecutorRedactsSecrets(t *testing.T) {
+	var logs strings.Builder
+	sink := &memoryAuditSink{}
+	executor, _ := newTestKindExecutor(t, WithAuditSink(sink))
+	executor.log = funcr.New(func(prefix, args string) {
+		logs.WriteString(prefix + args + "\n")
+	}, funcr.Options{Verbosity: 10})
+
+	args := writeResources(t, testSSLResources("first-private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	args = writeResources(t, testSSLResources("second-private-key"), testLabels)
+	plan, err := executor.Plan(context.Background(), args)
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	for _, event := range plan.Events {
+		executor.log.Info("planned event", "event", event)
+	}
+	// Events logged as is are redacted too
+	executor.log.Info("raw event", "event", kine.Event{
+		Type:         kine.EventTypeCreate,
+		ResourceType: kine.ResourceTypeSSL,
+		ResourceID:   "ssl-2",
+		NewValue:     &kine.SSL{Metadata: adctypes.Metadata{ID: "ssl-2"}, Key: "third-private-key"},
+	})
+
+	audit, err := json.Marshal(sink.records)
+	if err != nil {
+		t.Fatalf("failed to marshal audit records: %v", err)
+	}
+	for name, rendered := range map[string]string{"logs": logs.String(), "audit log": string(audit)} {
+		if strings.Contains(rendered, "private-key") {
+			t.Errorf("expected no key material in the %s, got %s", name, rendered)
+		}
+	}
+	if !strings.Contains(logs.String(), kine.RedactedValue) {
+		t.Errorf("expected logged events to be redacted, got %s", logs.String())
+	}
+	if len(plan.Events) != 1 || plan.Events[0].NewValue.(*kine.SSL).Key != kine.RedactedValue {
+		t.Errorf("expected the planned SSL key to be redacted, got %+v", plan.Events)
+	}
+
+	// The gateway and the cache keep the real key
+	ssl, err := executor.cache.GetSSL("ssl-1")
+	if err != nil || ssl.Key != "second-private-key" {
+		t.Errorf("expected the cached key to be kept, got %+v (%v)", ssl, err)
+	}
+}
+
+func TestKindExecutorValueSizeLimits(t *testing.T) {
+	withPluginConfig := func(size int) *adctypes.Resources {
+		resources := testServiceResources(1, 1)
+		resources.Services[0].Routes[0].Plugins = adctypes.Plugins{
+			"response-rewrite": map[string]any{"body": strings.Repeat("x", size)},
+		}
+		return resources
+	}
+
+	var logs strings.Builder
+	executor, fake := newTestKindExecutor(t)
+	executor.log = funcr.New(func(prefix, args string) {
+		logs.WriteString(prefix + args + "\n")
+	}, funcr.Options{})
+
+	err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, withPluginConfig(2<<20), testLabels))
+	if err == nil || !strings.Contains(err.Error(), `CREATE routes "route-0-0": value of`) ||
+		!strings.Contains(err.Error(), "exceeds the limit of 1572864 bytes") {
+		t.Fatalf("expected the 2MB route to fail the sync, got %v", err)
+	}
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected an oversized value to be invalid input, got %v", err)
+	}
+	if _, err := executor.cache.GetService("svc-0"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected nothing to be committed, got %v", err)
+	}
+	if batches := fake.received(); len(batches) != 0 {
+		t.Errorf("expected nothing to be sent, got %d batches", len(batches))
+	}
+
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, withPluginConfig(1200<<10), testLabels)); err != nil {
+		t.Fatalf("expected a value below the limit to sync, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "large resource value") || !strings.Contains(logs.String(), `"resourceID"="route-0-0"`) {
+		t.Errorf("expected a warning for the large route, got %s", logs.String())
+	}
+
+	// SSL errors suggest splitting the chain
+	executor, _ = newTestKindExecutor(t, WithValueSizeLimits(10, 100))
+	err = executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, testSSLResources("private-key"), testLabels))
+	if err == nil || !strings.Contains(err.Error(), "split the certificate chain into several SSLs") {
+		t.Fatalf("expected the SSL error to suggest splitting, got %v", err)
+	}
+}
+
+func TestKindExecutorSyncVerbosity(t *testing.T) {
+	var logs strings.Builder
+	executor, _ := newTestKindExecutor(t)
+	executor.log = funcr.New(func(prefix, args string) {
+		logs.WriteString(prefix + args + "\n")
+	}, funcr.Options{})
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if strings.Contains(logs.String(), `"msg"="applying event"`) {
+		t.Errorf("expected no event lines at the default verbosity, got %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `"msg"="applying events" "syncID"=`) ||
+		!strings.Contains(logs.String(), `"created"=1 "updated"=0 "deleted"=0`) {
+		t.Errorf("expected a summary line, got %s", logs.String())
+	}
+
+	logs.Reset()
+	args = writeResources(t, testSSLResources("other-private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, append(args, "--v", "1")); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	want := `"msg"="applying event" "syncID"=`
+	fields := `"op"="UPDATE" "resourceType"="ssls" "resourceID"="ssl-1" "resourceName"="tls" ` +
+		`"ownerKind"="ApisixTls" "ownerNamespace"="default" "ownerName"="tls"`
+	if !strings.Contains(logs.String(), want) || !strings.Contains(logs.String(), fields) {
+		t.Errorf("expected structured event lines, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), "private-key") {
+		t.Errorf("expected no key material in the logs, got %s", logs.String())
+	}
+
+	// The verbosity only applies to the sync asking for it
+	logs.Reset()
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if strings.Contains(logs.String(), `"msg"="applying event"`) {
+		t.Errorf("expected no event lines after the verbose sync, got %s", logs.String())
+	}
+}
+
+func TestKindExecutorAudit(t *testing.T) {
+	sink := &memoryAuditSink{}
+	executor, _ := newTestKindExecutor(t, WithAuditSink(sink))
+
+	args := writeResources(t, testSSLResources("first-private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	args = writeResources(t, testSSLResources("second-private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(sink.records))
+	}
+	create, update := sink.records[0], sink.records[1]
+	if create.EventType != kine.EventTypeCreate || create.ResourceType != kine.ResourceTypeSSL || create.ResourceID != "ssl-1" {
+		t.Errorf("unexpected create record: %+v", create)
+	}
+	if create.Labels["k8s/name"] != "tls" {
+		t.Errorf("expected owner labels in record, got %v", create.Labels)
+	}
+	if update.EventType != kine.EventTypeUpdate {
+		t.Fatalf("expected update record, got %s", update.EventType)
+	}
+	if _, ok := update.Changes["/key"]; !ok {
+		t.Errorf("expected key change in update record, got %v", update.Changes)
+	}
+	if create.SyncID == "" || update.SyncID == "" || create.SyncID == update.SyncID {
+		t.Errorf("expected a distinct sync id per execute, got %q and %q", create.SyncID, update.SyncID)
+	}
+
+	data, err := json.Marshal(sink.records)
+	if err != nil {
+		t.Fatalf("failed to marshal records: %v", err)
+	}
+	if strings.Contains(string(data), "private-key") {
+		t.Errorf("audit records leak key material: %s", data)
+	}
+}
+
+func TestKindExecutorAuditFailureDoesNotFailSync(t *testing.T) {
+	sink := &memoryAuditSink{err: errors.New("disk full")}
+	executor, fake := newTestKindExecutor(t, WithAuditSink(sink))
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("expected sync to succeed despite audit failure: %v", err)
+	}
+	if len(fake.received()) != 1 {
+		t.Error("expected events to be sent to the adapter")
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := NewFileAuditSink(path)
+	records := []AuditRecord{
+		{EventType: kine.EventTypeCreate, ResourceType: kine.ResourceTypeRoute, ResourceID: "r1"},
+		{EventType: kine.EventTypeDelete, ResourceType: kine.ResourceTypeRoute, ResourceID: "r2"},
+	}
+	if err := sink.Record(records); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines, got %d", len(lines))
+	}
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("failed to parse audit line: %v", err)
+	}
+	if record.ResourceID != "r2" || record.EventType != kine.EventTypeDelete {
+		t.Errorf("unexpected record: %+v", record)
+	}
+}
+
+func TestKindExecutorCanceledContext(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	err := executor.Execute(ctx, adctypes.Config{}, args)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	ssls, err := executor.cache.ListSSL()
+	if err != nil {
+		t.Fatalf("failed to list ssls: %v", err)
+	}
+	if len(ssls) != 0 {
+		t.Errorf("expected no cache mutations, got %d ssls", len(ssls))
+	}
+	if len(fake.received()) != 0 {
+		t.Error("expected no events sent to the adapter")
+	}
+}
+
+func TestKindExecutorEventWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	ctx := context.Background()
+
+	executor, fake := newTestKindExecutor(t, WithEventWAL(path, 0))
+	if err := executor.startWAL(ctx); err != nil {
+		t.Fatalf("failed to start WAL: %v", err)
+	}
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(ctx, adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if len(fake.received()) != 1 {
+		t.Fatal("expected events to be sent to the adapter")
+	}
+
+	// Crash after the cache commit: the adapter never takes the batch
+	fake.ch = make(chan []*adapter.Event)
+	sendCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	args = writeResources(t, testServiceResources(1, 0), testLabels)
+	if err := executor.Execute(sendCtx, adctypes.Config{}, args); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the send to time out, got %v", err)
+	}
+	if _, err := executor.cache.GetService("svc-0"); err != nil {
+		t.Fatalf("expected the service in the cache: %v", err)
+	}
+	if err := executor.wal.Close(); err != nil {
+		t.Fatalf("failed to close WAL: %v", err)
+	}
+
+	// A torn record at the tail is skipped
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	if _, err := file.Write([]byte{0, 0, 1, 0, 42}); err != nil {
+		t.Fatalf("failed to corrupt WAL: %v", err)
+	}
+	_ = file.Close()
+
+	restarted, fake := newTestKindExecutor(t, WithEventWAL(path, 0))
+	if err := restarted.startWAL(ctx); err != nil {
+		t.Fatalf("failed to replay WAL: %v", err)
+	}
+	defer restarted.wal.Close()
+	batches := fake.received()
+	if len(batches) != 1 {
+		t.Fatalf("expected only the unsent batch to be replayed, got %d batches", len(batches))
+	}
+	if _, ok := fake.get("/apisix/services/svc-0"); !ok {
+		t.Errorf("expected the replayed service in the adapter, got %v", batches[0])
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("expected the WAL to be truncated after replay, got %v, %v", info, err)
+	}
+}
+
+func TestEventWALCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	wal, pending, err := openEventWAL(path, 1)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending batches, got %d", len(pending))
+	}
+	batch := func(key string) []*adapter.Event {
+		return []*adapter.Event{{Key: key, Value: []byte(`{}`), Type: adapter.EventAdd}}
+	}
+
+	seq, err := wal.append(batch("/a"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := wal.commit(seq); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if wal.size != 0 {
+		t.Errorf("expected the WAL past its maximum size to be truncated, got %d bytes", wal.size)
+	}
+
+	// A later pending batch keeps the log from being truncated
+	first, err := wal.append(batch("/b"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.append(batch("/c")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := wal.commit(first); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close WAL: %v", err)
+	}
+
+	wal, pending, err = openEventWAL(path, 1)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	if len(pending) != 1 || pending[0][0].Key != "/c" {
+		t.Fatalf("expected the uncommitted batch to be pending, got %v", pending)
+	}
+	if wal.seq <= first {
+		t.Errorf("expected sequence numbers to continue after reopening, got %d", wal.seq)
+	}
+}
+
+func TestKindExecutorForceUpdate(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	args := writeResources(t, testServiceResources(2, 0), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	cached, err := executor.cache.Revisions(kine.ResourceTypeService)
+	if err != nil {
+		t.Fatalf("failed to read revisions: %v", err)
+	}
+
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if batches := fake.received(); len(batches) != 1 {
+		t.Fatalf("expected no events for unchanged resources, got %d batches", len(batches))
+	}
+
+	if err := executor.Execute(context.Background(), adctypes.Config{}, append(args, "--force")); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != 2 {
+		t.Fatalf("expected a forced batch, got %d batches", len(batches))
+	}
+	// Two services, the global rule and the SSL
+	if len(batches[1]) != 4 {
+		t.Errorf("expected 4 forced updates, got %d events", len(batches[1]))
+	}
+	for _, ev := range batches[1] {
+		if ev.Type != adapter.EventUpdate {
+			t.Errorf("expected only updates, got %v %s", ev.Type, ev.Key)
+		}
+	}
+	touched, err := executor.cache.Revisions(kine.ResourceTypeService)
+	if err != nil {
+		t.Fatalf("failed to read revisions: %v", err)
+	}
+	for id, revision := range cached {
+		if touched[id] <= revision {
+			t.Errorf("expected the revision of %s to bump past %d, got %d", id, revision, touched[id])
+		}
+	}
+}
+
+func TestKindExecutorDump(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := executor.Dump(dir); err != nil {
+		t.Fatalf("failed to dump: %v", err)
+	}
+
+	var ssls []*kine.SSL
+	readJSONFile(t, filepath.Join(dir, "ssls.json"), &ssls)
+	if len(ssls) != 1 || ssls[0].ID != "ssl-1" {
+		t.Fatalf("unexpected dumped ssls: %+v", ssls)
+	}
+	if ssls[0].Key != kine.RedactedValue {
+		t.Errorf("expected redacted key, got %q", ssls[0].Key)
+	}
+	var routes []*kine.Route
+	readJSONFile(t, filepath.Join(dir, "routes.json"), &routes)
+	if len(routes) != 0 {
+		t.Errorf("expected no dumped routes, got %d", len(routes))
+	}
+
+	var manifest DumpManifest
+	readJSONFile(t, filepath.Join(dir, dumpManifestFile), &manifest)
+	if manifest.Sync.Count != 1 || manifest.Sync.LastSyncID == "" || manifest.Sync.LastEvents != 1 {
+		t.Errorf("unexpected sync stats: %+v", manifest.Sync)
+	}
+	if manifest.ResourceCounts[kine.ResourceTypeSSL] != 1 {
+		t.Errorf("unexpected resource counts: %v", manifest.ResourceCounts)
+	}
+	if manifest.AdapterAddress == "" || manifest.PrivateKeys {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+	exported, err := os.ReadFile(filepath.Join(dir, dumpResourcesFile))
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+	if !strings.Contains(string(exported), "ssl-1") || strings.Contains(string(exported), "private-key") {
+		t.Errorf("expected a redacted export of ssl-1, got:\n%s", exported)
+	}
+
+	// The cache itself must keep the key
+	cached, err := executor.cache.ListSSL()
+	if err != nil {
+		t.Fatalf("failed to list ssls: %v", err)
+	}
+	if cached[0].Key != "private-key" {
+		t.Errorf("dump redacted the cached key: %q", cached[0].Key)
+	}
+
+	if err := executor.Dump(dir, WithPrivateKeys()); err != nil {
+		t.Fatalf("failed to dump: %v", err)
+	}
+	readJSONFile(t, filepath.Join(dir, "ssls.json"), &ssls)
+	if ssls[0].Key != "private-key" {
+		t.Errorf("expected private key with WithPrivateKeys, got %q", ssls[0].Key)
+	}
+}
+
+func readJSONFile(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+}
+
+func TestKindExecutorResync(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	executor.clock = fakeClock
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	sslKey := "/apisix/ssls/ssl-1"
+	want, ok := fake.get(sslKey)
+	if !ok {
+		t.Fatalf("expected %s in the adapter", sslKey)
+	}
+
+	// Diverge the adapter behind the executor's back
+	fake.put(sslKey, []byte(`{"id":"ssl-1","key":"tampered"}`))
+	fake.put("/apisix/routes/stray", []byte(`{"id":"stray"}`))
+	fake.put("/apisix/stream_routes/unmanaged", []byte(`{}`))
+
+	// A resync is skipped while a sync is in flight
+	executor.syncMu.Lock()
+	if err := executor.resync(context.Background()); err != nil {
+		t.Fatalf("failed to resync: %v", err)
+	}
+	executor.syncMu.Unlock()
+	if got, _ := fake.get(sslKey); string(got) == string(want) {
+		t.Fatal("expected resync to be skipped while a sync is in flight")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go executor.runResyncLoop(ctx, time.Minute)
+	for !fakeClock.HasWaiters() {
+		time.Sleep(time.Millisecond)
+	}
+	fakeClock.Step(time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := fake.get(sslKey)
+		_, stray := fake.get("/apisix/routes/stray")
+		if string(got) == string(want) && !stray {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("adapter not repaired: %s=%s, stray=%v", sslKey, got, stray)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := fake.get("/apisix/stream_routes/unmanaged"); !ok {
+		t.Error("expected keys of unmanaged resource types to be kept")
+	}
+}
+
+func TestKindExecutorDeletionModes(t *testing.T) {
+	serviceKey := adapterKey(kine.ResourceTypeService, "svc-1")
+	routeKey := adapterKey(kine.ResourceTypeRoute, "route-1-0")
+	// sync syncs n services and returns the adapter events of the sync
+	sync := func(t *testing.T, executor *KindExecutor, fake *fakeAdapter, n int) map[string]*adapter.Event {
+		t.Helper()
+		before := len(fake.received())
+		if err := executor.Execute(context.Background(), adctypes.Config{},
+			writeResources(t, testServiceResources(n, 1), testLabels)); err != nil {
+			t.Fatalf("failed to execute: %v", err)
+		}
+		events := make(map[string]*adapter.Event)
+		for _, batch := range fake.received()[before:] {
+			for _, event := range batch {
+				events[event.Key] = event
+			}
+		}
+		return events
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		executor, fake := newTestKindExecutor(t)
+		sync(t, executor, fake, 2)
+		events := sync(t, executor, fake, 1)
+		for _, key := range []string{serviceKey, routeKey} {
+			if event := events[key]; event == nil || event.Type != adapter.EventDelete {
+				t.Errorf("expected %s to be deleted, got %+v", key, event)
+			}
+		}
+	})
+
+	t.Run("tombstone", func(t *testing.T) {
+		executor, fake := newTestKindExecutor(t,
+			WithDeletionMode(DeletionTombstone), WithTombstoneGracePeriod(time.Minute))
+		fakeClock := clocktesting.NewFakeClock(time.Now())
+		executor.clock = fakeClock
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go executor.runTombstoneJanitor(ctx)
+		for !fakeClock.HasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+
+		sync(t, executor, fake, 2)
+		events := sync(t, executor, fake, 1)
+		for _, key := range []string{serviceKey, routeKey} {
+			if event := events[key]; event == nil || event.Type != adapter.EventUpdate ||
+				string(event.Value) != string(tombstoneValue) {
+				t.Errorf("expected a tombstone written to %s, got %+v", key, event)
+			}
+		}
+		// The cache drops the deleted resources right away
+		if _, err := executor.cache.GetService("svc-1"); !errors.Is(err, kine.ErrNotFound) {
+			t.Errorf("expected the deleted service to leave the cache, got %v", err)
+		}
+		// Resyncs keep the tombstones
+		if err := executor.resync(ctx); err != nil {
+			t.Fatalf("failed to resync: %v", err)
+		}
+		if value, ok := fake.get(serviceKey); !ok || string(value) != string(tombstoneValue) {
+			t.Fatalf("expected the tombstone to be kept, got %s (found %v)", value, ok)
+		}
+
+		// The janitor deletes the tombstones once the grace period elapsed
+		before := len(fake.received())
+		fakeClock.Step(time.Minute)
+		batches := waitForBatches(t, fake, before+1)
+		if len(batches[before]) != 2 {
+			t.Fatalf("expected the janitor to delete 2 keys, got %d", len(batches[before]))
+		}
+		for _, event := range batches[before] {
+			if event.Type != adapter.EventDelete || (event.Key != serviceKey && event.Key != routeKey) {
+				t.Errorf("unexpected janitor event %v %s", event.Type, event.Key)
+			}
+		}
+		if _, ok := fake.get(serviceKey); ok {
+			t.Error("expected the tombstone to be deleted")
+		}
+
+		// Keys written again before the grace period elapsed are kept
+		sync(t, executor, fake, 2)
+		sync(t, executor, fake, 1)
+		events = sync(t, executor, fake, 2)
+		// The adapter ignores creates of existing keys, the tombstones are
+		// overwritten by updates
+		for _, key := range []string{serviceKey, routeKey} {
+			if event := events[key]; event == nil || event.Type != adapter.EventUpdate {
+				t.Errorf("expected %s to be recreated by an update, got %+v", key, event)
+			}
+		}
+		before = len(fake.received())
+		fakeClock.Step(time.Minute)
+		if err := executor.purgeTombstones(ctx); err != nil {
+			t.Fatalf("failed to delete tombstones: %v", err)
+		}
+		if len(fake.received()) != before {
+			t.Errorf("expected no tombstone to delete, got %v", fake.received()[before:])
+		}
+		if value, ok := fake.get(serviceKey); !ok || string(value) == string(tombstoneValue) {
+			t.Errorf("expected the recreated service to be kept, got %s (found %v)", value, ok)
+		}
+	})
+}
+
+// waitForBatches waits until the fake adapter received n batches
+func waitForBatches(t *testing.T, fake *fakeAdapter, n int) [][]*adapter.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		batches := fake.received()
+		if len(batches) >= n {
+			return batches
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d adapter batches, got %d", n, len(batches))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKindExecutorEventDebounce(t *testing.T) {
+	executor, fake := newTestKindExecutor(t, WithEventDebounce(time.Second))
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	executor.clock = fakeClock
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	executor.startPacer(ctx)
+
+	step := func() {
+		for !fakeClock.HasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+		fakeClock.Step(time.Second)
+	}
+
+	resources := testServiceResources(1, 0)
+	if err := executor.Execute(ctx, adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	step()
+	waitForBatches(t, fake, 1)
+
+	// Rapid updates of the upstream of one service
+	for weight := 1; weight <= 10; weight++ {
+		resources.Services[0].Upstream.Nodes[0].Weight = weight
+		if err := executor.Execute(ctx, adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+			t.Fatalf("failed to execute: %v", err)
+		}
+	}
+	if got := len(fake.received()); got != 1 {
+		t.Fatalf("expected updates to wait for the debounce window, got %d batches", got)
+	}
+	step()
+	batches := waitForBatches(t, fake, 2)
+	if len(batches[1]) != 1 {
+		t.Fatalf("expected a single coalesced event, got %d", len(batches[1]))
+	}
+	ev := batches[1][0]
+	if ev.Key != "/apisix/services/svc-0" || ev.Type != adapter.EventUpdate {
+		t.Fatalf("unexpected event %s %v", ev.Key, ev.Type)
+	}
+	if !strings.Contains(string(ev.Value), `"10.0.0.1:80":10`) {
+		t.Errorf("expected the latest upstream weight, got %s", ev.Value)
+	}
+	if executor.pacer.coalesced != 9 {
+		t.Errorf("expected 9 coalesced events, got %d", executor.pacer.coalesced)
+	}
+}
+
+func TestEventPacerCoalescing(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	pacer := newEventPacer(logr.Discard(), fakeClock, nil, 0, 0, time.Second)
+	add := func(key, value string) *adapter.Event {
+		return &adapter.Event{Key: key, Value: []byte(value), Type: adapter.EventAdd}
+	}
+	update := func(key, value string) *adapter.Event {
+		return &adapter.Event{Key: key, Value: []byte(value), Type: adapter.EventUpdate}
+	}
+	del := func(key string) *adapter.Event {
+		return &adapter.Event{Key: key, Type: adapter.EventDelete}
+	}
+
+	pacer.enqueue([]*adapter.Event{add("x", "1"), update("z", "1")})
+	// The add of x stays ahead of z, the update of z moves last
+	pacer.enqueue([]*adapter.Event{update("x", "2"), update("z", "2")})
+	// The update of x moves after the delete of y
+	pacer.enqueue([]*adapter.Event{del("y"), update("x", "3")})
+	// A created and deleted key never reaches the adapter
+	pacer.enqueue([]*adapter.Event{add("w", "1"), del("w")})
+	// A deleted and recreated key becomes an update
+	pacer.enqueue([]*adapter.Event{del("v"), add("v", "1")})
+
+	batch, wait := pacer.take()
+	if wait != 0 {
+		t.Fatalf("unexpected wait without rate limit: %v", wait)
+	}
+	var got []string
+	for _, ev := range batch {
+		got = append(got, fmt.Sprintf("%v %s=%s", ev.Type, ev.Key, ev.Value))
+	}
+	want := []string{
+		fmt.Sprintf("%v x=1", adapter.EventAdd),
+		fmt.Sprintf("%v z=2", adapter.EventUpdate),
+		fmt.Sprintf("%v y=", adapter.EventDelete),
+		fmt.Sprintf("%v x=3", adapter.EventUpdate),
+		fmt.Sprintf("%v v=1", adapter.EventUpdate),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected batch:\n got %v\nwant %v", got, want)
+	}
+	if pacer.pending() != 0 {
+		t.Errorf("expected an empty queue, got %d events", pacer.pending())
+	}
+}
+
+func TestEventPacerCoalescingOrder(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	// One event per batch, so that a misordered event goes out on its own
+	pacer := newEventPacer(logr.Discard(), fakeClock, nil, 1, 1, 0)
+	event := func(eventType adapter.EventType, key, value string) *adapter.Event {
+		return &adapter.Event{Key: key, Value: []byte(value), Type: eventType}
+	}
+
+	pacer.enqueue([]*adapter.Event{event(adapter.EventUpdate, "route/r", "s1")})
+	// The route moves to a service created by the same sync
+	pacer.enqueue([]*adapter.Event{
+		event(adapter.EventAdd, "service/s2", "new"),
+		event(adapter.EventUpdate, "route/r", "s2"),
+	})
+	// A service is deleted once no route references it
+	pacer.enqueue([]*adapter.Event{
+		event(adapter.EventUpdate, "service/s1", "changed"),
+		event(adapter.EventUpdate, "route/q", "s1"),
+	})
+	pacer.enqueue([]*adapter.Event{
+		event(adapter.EventUpdate, "route/q", "s3"),
+		event(adapter.EventDelete, "service/s1", ""),
+	})
+
+	var got []string
+	for range 10 {
+		batch, _ := pacer.take()
+		for _, ev := range batch {
+			got = append(got, fmt.Sprintf("%v %s=%s", ev.Type, ev.Key, ev.Value))
+		}
+		fakeClock.Step(time.Second)
+	}
+	want := []string{
+		fmt.Sprintf("%v service/s2=new", adapter.EventAdd),
+		fmt.Sprintf("%v route/r=s2", adapter.EventUpdate),
+		fmt.Sprintf("%v route/q=s3", adapter.EventUpdate),
+		fmt.Sprintf("%v service/s1=", adapter.EventDelete),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected events:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestEventPacerRateLimit(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	pacer := newEventPacer(logr.Discard(), fakeClock, nil, 2, 3, 0)
+	var events []*adapter.Event
+	for i := range 5 {
+		events = append(events, &adapter.Event{Key: fmt.Sprintf("key-%d", i), Type: adapter.EventAdd})
+	}
+	drained := 0
+	pacer.enqueueNotify(events, func() { drained++ })
+
+	batch, _ := pacer.take()
+	if len(batch) != 3 {
+		t.Fatalf("expected a burst of 3 events, got %d", len(batch))
+	}
+	if pacer.drained() != nil {
+		t.Fatal("expected no drain callback while events are queued")
+	}
+	batch, wait := pacer.take()
+	if len(batch) != 0 || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms for a token, got %d events and %v", len(batch), wait)
+	}
+	fakeClock.Step(time.Second)
+	batch, _ = pacer.take()
+	if len(batch) != 2 || batch[0].Key != "key-3" {
+		t.Fatalf("expected the remaining 2 events in order, got %v", batch)
+	}
+	if onDrain := pacer.drained(); onDrain != nil {
+		onDrain()
+	}
+	if drained != 1 || pacer.drained() != nil {
+		t.Errorf("expected the drain callback to run once, got %d calls", drained)
+	}
+}
+
+// testServiceResources builds services with routesPerService routes each
+func testServiceResources(services, routesPerService int) *adctypes.Resources {
+	resources := &adctypes.Resources{
+		GlobalRules: adctypes.GlobalRule{"prometheus": map[string]any{}},
+		SSLs:        testSSLResources("private-key").SSLs,
+	}
+	for i := range services {
+		service := &adctypes.Service{
+			Metadata: adctypes.Metadata{
+				ID:     fmt.Sprintf("svc-%d", i),
+				Name:   fmt.Sprintf("svc-%d", i),
+				Labels: testLabels,
+			},
+			Hosts: []string{fmt.Sprintf("svc-%d.example.com", i)},
+			Upstream: &adctypes.Upstream{
+				Nodes: adctypes.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}},
+			},
+		}
+		for j := range routesPerService {
+			service.Routes = append(service.Routes, &adctypes.Route{
+				Metadata: adctypes.Metadata{
+					ID:   fmt.Sprintf("route-%d-%d", i, j),
+					Name: fmt.Sprintf("route-%d-%d", i, j),
+				},
+				Uris: []string{fmt.Sprintf("/svc-%d/route-%d", i, j)},
+			})
+		}
+		resources.Services = append(resources.Services, service)
+	}
+	return resources
+}
+
+func TestDecodeResources(t *testing.T) {
+	resources := testServiceResources(3, 2)
+	data, err := json.Marshal(resources)
+	if err != nil {
+		t.Fatalf("failed to marshal resources: %v", err)
+	}
+	var want adctypes.Resources
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("failed to unmarshal resources: %v", err)
+	}
+
+	var services []*adctypes.Service
+	got, err := decodeResources(strings.NewReader(string(data)), func(service *adctypes.Service) error {
+		services = append(services, service)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to decode resources: %v", err)
+	}
+	if len(got.Services) != 0 {
+		t.Errorf("expected services to be streamed, got %d kept", len(got.Services))
+	}
+	got.Services = services
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("decoded resources differ from json.Unmarshal:\n got: %+v\nwant: %+v", got, &want)
+	}
+
+	for _, input := range []string{`{"services": {}}`, `{"services": [null]}`, `{"ssls": [}`, `[]`, `{} {}`} {
+		if _, err := decodeResources(strings.NewReader(input), func(*adctypes.Service) error { return nil }); err == nil {
+			t.Errorf("expected an error decoding %s", input)
+		}
+	}
+}
+
+func TestKindExecutorNullResources(t *testing.T) {
+	for _, input := range []string{`{"services": [null]}`, `{"ssls": [null]}`} {
+		for _, opts := range [][]KindExecutorOption{nil, {WithBestEffortTransfer()}} {
+			executor, _ := newTestKindExecutor(t, opts...)
+			path := filepath.Join(t.TempDir(), "resources.json")
+			if err := os.WriteFile(path, []byte(input), 0o600); err != nil {
+				t.Fatalf("failed to write resources: %v", err)
+			}
+			err := executor.Execute(context.Background(), adctypes.Config{}, BuildADCExecuteArgs(path, testLabels, nil))
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("expected %s to be rejected as invalid input, got %v", input, err)
+			}
+		}
+	}
+}
+
+func TestKindExecutorStreamingTransfer(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	resources := testServiceResources(3, 2)
+	parsed, err := executor.parseArgs(writeResources(t, resources, testLabels))
+	if err != nil {
+		t.Fatalf("failed to parse args: %v", err)
+	}
+
+	got, err := executor.transferResourcesFromFile(parsed.filePath, &kine.TransferOptions{})
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	want, err := kine.TransferResources(resources)
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streaming transfer differs from TransferResources:\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+// BenchmarkLoadResources compares the memory retained while loading a
+// 100k route file in one piece and streamed
+func BenchmarkLoadResources(b *testing.B) {
+	data, err := json.Marshal(testutil.GenerateResources(testutil.ResourceSpec{Services: 10000, RoutesPerService: 10}))
+	if err != nil {
+		b.Fatalf("failed to marshal resources: %v", err)
+	}
+	path := filepath.Join(b.TempDir(), "resources.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		b.Fatalf("failed to write resources: %v", err)
+	}
+	executor := &KindExecutor{log: logr.Discard()}
+
+	// heapAfter reports the heap in use once load returns, while its
+	// intermediates are still reachable
+	heapAfter := func(b *testing.B, load func() (any, any)) {
+		b.ReportAllocs()
+		var heap uint64
+		for range b.N {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			raw, transferred := load()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			runtime.KeepAlive(raw)
+			runtime.KeepAlive(transferred)
+			heap += after.HeapAlloc - before.HeapAlloc
+		}
+		b.ReportMetric(float64(heap)/float64(b.N)/(1<<20), "heap-MB")
+	}
+
+	b.Run("unmarshal", func(b *testing.B) {
+		heapAfter(b, func() (any, any) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var resources adctypes.Resources
+			if err := json.Unmarshal(raw, &resources); err != nil {
+				b.Fatal(err)
+			}
+			transferred, err := kine.TransferResources(&resources)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return []any{raw, &resources}, transferred
+		})
+	})
+	b.Run("streaming", func(b *testing.B) {
+		heapAfter(b, func() (any, any) {
+			transferred, err := executor.transferResourcesFromFile(path, &kine.TransferOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			return nil, transferred
+		})
+	})
+}
+
+func BenchmarkConvertToAdapterEvent(b *testing.B) {
+	transferred, err := kine.TransferResources(testServiceResources(1000, 10))
+	if err != nil {
+		b.Fatalf("failed to transfer resources: %v", err)
+	}
+	events := make([]kine.Event, 0, len(transferred.Routes))
+	for _, route := range transferred.Routes {
+		events = append(events, kine.Event{
+			Type:         kine.EventTypeCreate,
+			ResourceType: kine.ResourceTypeRoute,
+			ResourceID:   route.ID,
+			NewValue:     route,
+		})
+	}
+	executor := &KindExecutor{log: logr.Discard()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, event := range events {
+			if _, err := executor.convertToAdapterEvent(event); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestKindExecutorParseArgsTrimsLabels(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	parsed, err := executor.parseArgs([]string{
+		"-f", "resources.json",
+		"--label-selector", "k8s/kind=ApisixTls ",
+		"--label-selector", " k8s/namespace = default",
+		"--label-selector", " =ignored",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse args: %v", err)
+	}
+	want := map[string]string{"k8s/kind": "ApisixTls", "k8s/namespace": "default"}
+	if !reflect.DeepEqual(parsed.labels, want) {
+		t.Errorf("expected labels %v, got %v", want, parsed.labels)
+	}
+}
+
+func TestKindExecutorParseArgsTimeout(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithSyncTimeout(time.Minute))
+	parsed, err := executor.parseArgs([]string{"-f", "resources.json"})
+	if err != nil || parsed.timeout != time.Minute {
+		t.Fatalf("expected the executor timeout, got %v (%v)", parsed, err)
+	}
+	parsed, err = executor.parseArgs([]string{"-f", "resources.json", "--timeout", "1.5s"})
+	if err != nil || parsed.timeout != 1500*time.Millisecond {
+		t.Fatalf("expected --timeout to override the executor timeout, got %v (%v)", parsed, err)
+	}
+	for _, invalid := range []string{"soon", "0s", "-1s"} {
+		if _, err := executor.parseArgs([]string{"-f", "resources.json", "--timeout", invalid}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("expected --timeout %s to be rejected", invalid)
+		}
+	}
+}
+
+// blockingAdapter never reads the events sent to it, like a stalled backend
+type blockingAdapter struct {
+	*fakeAdapter
+	ch chan []*adapter.Event
+}
+
+func (a *blockingAdapter) EventCh() chan<- []*adapter.Event {
+	return a.ch
+}
+
+func TestKindExecutorSyncTimeout(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	executor.adapter = &blockingAdapter{fakeAdapter: fake, ch: make(chan []*adapter.Event)}
+	args := writeResources(t, testServiceResources(1, 1), testLabels)
+
+	err := executor.Execute(context.Background(), adctypes.Config{}, append(args, "--timeout", "50ms"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the sync to time out, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "sync timed out after 50ms during send: ") {
+		t.Errorf("expected the send phase to be named, got %v", err)
+	}
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("expected a blocked adapter to be unavailable, got %v", err)
+	}
+
+	// Expiring before the diff names the phase that was running
+	executor, _ = newTestKindExecutor(t, WithSyncTimeout(time.Nanosecond))
+	err = executor.Execute(context.Background(), adctypes.Config{}, args)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the sync to time out, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "sync timed out after 1ns during transfer: ") {
+		t.Errorf("expected the transfer phase to be named, got %v", err)
+	}
+}
+
+func TestKindExecutorSelectorCaseAndSpaces(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// An empty sync scoped by a hand-typed selector deletes the ssl
+	typed := map[string]string{
+		"k8s/kind":      "apisixtls ",
+		"k8s/namespace": " default",
+		"k8s/name":      "tls",
+	}
+	args = writeResources(t, &adctypes.Resources{}, typed)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].Type != adapter.EventDelete {
+		t.Fatalf("expected the ssl to be deleted, got %v", batches)
+	}
+}
+
+func TestKindExecutorOwnershipPingPong(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	otherLabels := map[string]string{
+		"k8s/kind":      "ApisixTls",
+		"k8s/namespace": "default",
+		"k8s/name":      "other-tls",
+	}
+	otherResources := testSSLResources("other-key")
+	otherResources.SSLs[0].Labels = otherLabels
+
+	ownerA := writeResources(t, testSSLResources("private-key"), testLabels)
+	ownerB := writeResources(t, otherResources, otherLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, ownerA); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// The second owner stops at the conflict instead of overwriting ssl-1
+	err := executor.Execute(context.Background(), adctypes.Config{}, ownerB)
+	var conflict *kine.OwnershipConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected an ownership conflict, got %v", err)
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, ownerA); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if batches := fake.received(); len(batches) != 1 {
+		t.Fatalf("expected only the first sync to emit events, got %d batches", len(batches))
+	}
+
+	// An explicit takeover updates ssl-1 in place
+	executor.opts.ForceOwnership = true
+	if err := executor.Execute(context.Background(), adctypes.Config{}, ownerB); err != nil {
+		t.Fatalf("failed to take over: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].Type != adapter.EventUpdate {
+		t.Fatalf("expected a takeover update, got %v", batches)
+	}
+}
+
+func TestKindExecutorExportHandler(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	for query, wantKey := range map[string]bool{"": false, "?include-secrets=true": true} {
+		rec := httptest.NewRecorder()
+		executor.ExportHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kine/export"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := strings.Contains(rec.Body.String(), "private-key"); got != wantKey {
+			t.Errorf("query %q: expected private key included=%v, got:\n%s", query, wantKey, rec.Body.String())
+		}
+	}
+}
+
+func TestKindExecutorGetStatus(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	selector := kine.KindLabelSelector{
+		Kind:      testLabels[label.LabelKind],
+		Namespace: testLabels[label.LabelNamespace],
+		Name:      testLabels[label.LabelName],
+	}
+	if _, ok := executor.GetStatus(selector); ok {
+		t.Fatal("expected no status before the first sync")
+	}
+
+	resources := testServiceResources(1, 2)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	status, ok := executor.GetStatus(selector)
+	if !ok || !status.Succeeded || status.Error != "" {
+		t.Fatalf("expected a successful status, got %+v (found %v)", status, ok)
+	}
+	// One service, two routes, the SSL and the global rule
+	if status.Created != 5 || status.Updated != 0 || status.Deleted != 0 {
+		t.Errorf("unexpected event counts %+v", status)
+	}
+	selector.Kind = strings.ToUpper(selector.Kind)
+	if _, ok := executor.GetStatus(selector); !ok {
+		t.Error("expected kinds to match case-insensitively")
+	}
+
+	// A failed sync replaces the status
+	retries := int64(-1)
+	resources.Services[0].Upstream.Retries = &retries
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err == nil {
+		t.Fatal("expected the sync to fail")
+	}
+	status, ok = executor.GetStatus(selector)
+	if !ok || status.Succeeded || !strings.Contains(status.Error, "retries") {
+		t.Fatalf("expected a failed status, got %+v (found %v)", status, ok)
+	}
+
+	// Deleting every resource of the selector evicts its status
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if status, ok := executor.GetStatus(selector); ok {
+		t.Errorf("expected the status to be evicted, got %+v", status)
+	}
+}
+
+func TestKindExecutorApplyCacheChangeInvalidValues(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	tests := []struct {
+		name  string
+		event kine.Event
+	}{
+		{
+			name:  "nil new value on create",
+			event: kine.Event{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeRoute, ResourceID: "route-1"},
+		},
+		{
+			name:  "nil old value on delete",
+			event: kine.Event{Type: kine.EventTypeDelete, ResourceType: kine.ResourceTypeRoute, ResourceID: "route-1"},
+		},
+		{
+			name: "typed nil new value on update",
+			event: kine.Event{Type: kine.EventTypeUpdate, ResourceType: kine.ResourceTypeService, ResourceID: "svc-1",
+				NewValue: (*kine.Service)(nil)},
+		},
+		{
+			name: "route event carrying a service",
+			event: kine.Event{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeRoute, ResourceID: "route-1",
+				NewValue: &kine.Service{Metadata: adctypes.Metadata{ID: "route-1"}}},
+		},
+		{
+			name: "value round-tripped through JSON",
+			event: kine.Event{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeRoute, ResourceID: "route-1",
+				NewValue: map[string]any{"id": "route-1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := executor.applyCacheChange(tt.event)
+			if !errors.Is(err, errInvalidEventValue) {
+				t.Fatalf("expected an invalid event value error, got %v", err)
+			}
+			for _, part := range []string{string(tt.event.Type), string(tt.event.ResourceType), tt.event.ResourceID} {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("expected error %q to mention %q", err, part)
+				}
+			}
+		})
+	}
+
+	// A malformed event fails the batch before the cache is touched
+	events := []kine.Event{
+		{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeService, ResourceID: "svc-1",
+			NewValue: &kine.Service{Metadata: adctypes.Metadata{ID: "svc-1"}}},
+		{Type: kine.EventTypeCreate, ResourceType: kine.ResourceTypeRoute, ResourceID: "route-1"},
+	}
+	if err := executor.applyEvents(context.Background(), logr.Discard(), events); !errors.Is(err, errInvalidEventValue) {
+		t.Fatalf("expected an invalid event value error, got %v", err)
+	}
+	if _, err := executor.cache.GetService("svc-1"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected the cache to be untouched, got %v", err)
+	}
+}
+
+// failingCache fails the inserts of the objects with the given IDs
+type failingCache struct {
+	kine.Cache
+	failIDs map[string]bool
+}
+
+func (c *failingCache) Insert(obj any) error {
+	if err := c.fail(obj); err != nil {
+		return err
+	}
+	return c.Cache.Insert(obj)
+}
+
+func (c *failingCache) InsertOwned(obj any) error {
+	if err := c.fail(obj); err != nil {
+		return err
+	}
+	return c.Cache.InsertOwned(obj)
+}
+
+func (c *failingCache) fail(obj any) error {
+	var id string
+	switch obj := obj.(type) {
+	case *kine.Service:
+		id = obj.ID
+	case *kine.Route:
+		id = obj.ID
+	}
+	if c.failIDs[id] {
+		return errors.New("injected failure")
+	}
+	return nil
+}
+
+func TestKindExecutorApplyErrorReport(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	executor.cache = &failingCache{Cache: executor.cache, failIDs: map[string]bool{"svc-1": true, "route-2-0": true}}
+
+	args := writeResources(t, testServiceResources(3, 2), testLabels)
+	err := executor.Execute(context.Background(), adctypes.Config{}, args)
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("expected an apply error, got %v", err)
+	}
+	var failed []string
+	for _, eventErr := range applyErr.Failed {
+		failed = append(failed, eventErr.String())
+	}
+	slices.Sort(failed)
+	want := []string{
+		`CREATE routes "route-1-0"`,
+		`CREATE routes "route-1-1"`,
+		`CREATE routes "route-2-0"`,
+		`CREATE services "svc-1"`,
+	}
+	if !slices.Equal(failed, want) {
+		t.Errorf("expected failures %v, got %v", want, failed)
+	}
+	if !errors.Is(err, errParentNotApplied) {
+		t.Errorf("expected the routes of svc-1 to be skipped, got %v", err)
+	}
+	// Two services, three routes, the global rule and the SSL
+	if len(applyErr.Applied) != 7 {
+		t.Errorf("expected 7 applied events, got %v", applyErr.Applied)
+	}
+	if !strings.HasPrefix(err.Error(), "failed to apply 4 of 11 cache changes (7 applied): ") ||
+		!strings.HasSuffix(err.Error(), "; and 1 more") {
+		t.Errorf("unexpected summary %q", err)
+	}
+	if !errors.Is(err, ErrApplyFailed) {
+		t.Errorf("expected ErrApplyFailed, got %v", err)
+	}
+
+	batches := fake.received()
+	if len(batches) != 1 || len(batches[0]) != 7 {
+		t.Fatalf("expected the applied events to be sent, got %v", batches)
+	}
+	for _, event := range batches[0] {
+		if strings.HasSuffix(event.Key, "/svc-1") || strings.Contains(event.Key, "route-1-") ||
+			strings.HasSuffix(event.Key, "/route-2-0") {
+			t.Errorf("expected failed event %s to be left out", event.Key)
+		}
+	}
+	if _, err := executor.cache.GetRoute("route-2-1"); err != nil {
+		t.Errorf("expected independent routes to be applied, got %v", err)
+	}
+}
+
+func TestKindExecutorApplyCacheChangeStaleDelete(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	stored := &kine.Service{Metadata: adctypes.Metadata{ID: "svc-1", Name: "svc-1", Labels: testLabels}}
+	if err := executor.cache.InsertService(stored); err != nil {
+		t.Fatalf("failed to insert service: %v", err)
+	}
+
+	stale := stored.DeepCopy()
+	stale.Name = "renamed"
+	stale.Labels = map[string]string{label.LabelKind: "HTTPRoute"}
+	err := executor.applyCacheChange(kine.Event{
+		Type:         kine.EventTypeDelete,
+		ResourceType: kine.ResourceTypeService,
+		ResourceID:   stored.ID,
+		OldValue:     stale,
+	})
+	if err != nil {
+		t.Fatalf("failed to delete with a stale old value: %v", err)
+	}
+	if _, err := executor.cache.GetService(stored.ID); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected the service to be deleted, got %v", err)
+	}
+	services, err := executor.cache.ListServicesByName(stored.Name)
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	if len(services) != 0 {
+		t.Errorf("expected the name index entry to be removed, got %v", services)
+	}
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestKindExecutorTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	executor, _ := newTestKindExecutor(t, WithTracerProvider(provider))
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, testServiceResources(1, 1), testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, ok := byName[spanExecute]
+	if !ok {
+		t.Fatalf("expected a %s span, got %v", spanExecute, spans.Snapshots())
+	}
+	if root.Parent.IsValid() {
+		t.Errorf("expected %s to be a root span", spanExecute)
+	}
+	var children []string
+	for _, span := range spans {
+		if span.Name == spanExecute {
+			continue
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("expected %s to be a child of %s", span.Name, spanExecute)
+		}
+		children = append(children, span.Name)
+	}
+	// Spans are exported in the order they end
+	expected := []string{spanParseArgs, spanTransfer, spanDiff, spanApplyCache, spanSend}
+	if !reflect.DeepEqual(children, expected) {
+		t.Errorf("expected child spans %v, got %v", expected, children)
+	}
+
+	rootAttrs := spanAttributes(root)
+	if got := rootAttrs[attrKind].AsString(); got != testLabels[label.LabelKind] {
+		t.Errorf("expected selector kind %q, got %q", testLabels[label.LabelKind], got)
+	}
+	if got := rootAttrs[attrName].AsString(); got != testLabels[label.LabelName] {
+		t.Errorf("expected selector name %q, got %q", testLabels[label.LabelName], got)
+	}
+	if rootAttrs[attrSyncID].AsString() == "" {
+		t.Error("expected the root span to carry the sync id")
+	}
+	events := rootAttrs[attrEvents].AsInt64()
+	if events == 0 || rootAttrs[attrCreated].AsInt64() != events {
+		t.Errorf("expected only creates, got %d events and %d creates", events, rootAttrs[attrCreated].AsInt64())
+	}
+	for _, name := range []string{spanDiff, spanApplyCache, spanSend} {
+		if got := spanAttributes(byName[name])[attrEvents].AsInt64(); got != events {
+			t.Errorf("expected %s to count %d events, got %d", name, events, got)
+		}
+	}
+	if got := spanAttributes(byName[spanTransfer])[attrResources].AsInt64(); got == 0 {
+		t.Error("expected the transfer span to count the transferred resources")
+	}
+	if root.Status.Code == codes.Error {
+		t.Errorf("expected an ok root span, got %v", root.Status)
+	}
+
+	// A failing sync records the error on the failing stage and the root
+	exporter.Reset()
+	err := executor.Execute(context.Background(), adctypes.Config{},
+		BuildADCExecuteArgs(filepath.Join(t.TempDir(), "missing.json"), testLabels, nil))
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a missing file to fail the sync as invalid input, got %v", err)
+	}
+	failed := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		failed[span.Name] = span
+	}
+	for _, name := range []string{spanExecute, spanTransfer} {
+		span, ok := failed[name]
+		if !ok {
+			t.Fatalf("expected a %s span", name)
+		}
+		if span.Status.Code != codes.Error || len(span.Events) == 0 {
+			t.Errorf("expected %s to record the error, got status %v and events %v", name, span.Status, span.Events)
+		}
+	}
+	if _, ok := failed[spanDiff]; ok {
+		t.Errorf("expected no %s span after a failed transfer", spanDiff)
+	}
+}
+
+func TestKindExecutorTracingDisabled(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	if executor.tracer != nil {
+		t.Fatal("expected no tracer without a tracer provider")
+	}
+	ctx := context.Background()
+	spanCtx, span := executor.startSpan(ctx, spanExecute)
+	if span != nil || spanCtx != ctx {
+		t.Error("expected startSpan to be a no-op without a tracer")
+	}
+	endSpan(span, errors.New("ignored"))
+	setEventAttributes(span, []kine.Event{{Type: kine.EventTypeCreate}})
+}
+
+func TestKindExecutorResetState(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	selector := selectorFromLabels(testLabels)
+	args := writeResources(t, testServiceResources(1, 2), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	cached, err := executor.cachedValues()
+	if err != nil {
+		t.Fatalf("failed to list cached values: %v", err)
+	}
+
+	if err := executor.ResetState(context.Background(), false); err != nil {
+		t.Fatalf("failed to reset state: %v", err)
+	}
+	if values, err := executor.cachedValues(); err != nil || len(values) != 0 {
+		t.Fatalf("expected an empty cache, got %d values (%v)", len(values), err)
+	}
+	if _, ok := executor.GetStatus(selector); ok {
+		t.Error("expected the status to be cleared")
+	}
+	if batches := fake.received(); len(batches) != 1 {
+		t.Fatalf("expected no events to be sent, got %d batches", len(batches))
+	}
+
+	// The next sync starts from scratch and recreates everything
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches := waitForBatches(t, fake, 2)
+	if len(batches[1]) != len(cached) {
+		t.Fatalf("expected %d events after the reset, got %d", len(cached), len(batches[1]))
+	}
+	for _, event := range batches[1] {
+		if event.Type != adapter.EventAdd {
+			t.Errorf("expected an add event for %s, got %v", event.Key, event.Type)
+		}
+	}
+
+	// Deleting from the adapter sends a delete for every cached resource
+	if err := executor.ResetState(context.Background(), true); err != nil {
+		t.Fatalf("failed to reset state: %v", err)
+	}
+	batches = waitForBatches(t, fake, 3)
+	deleted := make(map[string]bool)
+	for _, event := range batches[2] {
+		if event.Type != adapter.EventDelete {
+			t.Errorf("expected a delete event for %s, got %v", event.Key, event.Type)
+		}
+		deleted[event.Key] = true
+	}
+	for key := range cached {
+		if !deleted[key] {
+			t.Errorf("expected %s to be deleted", key)
+		}
+	}
+	if values, err := executor.cachedValues(); err != nil || len(values) != 0 {
+		t.Fatalf("expected an empty cache, got %d values (%v)", len(values), err)
+	}
+}
+
+func TestKindExecutorDeleteAllFor(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	resources := testServiceResources(2, 2)
+	for _, service := range resources.Services {
+		for _, route := range service.Routes {
+			route.Labels = testLabels
+		}
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	otherLabels := map[string]string{
+		label.LabelKind:      "HTTPRoute",
+		label.LabelNamespace: "other",
+		label.LabelName:      "other",
+	}
+	other := &adctypes.Resources{
+		Services: []*adctypes.Service{{
+			Metadata: adctypes.Metadata{ID: "other-svc", Name: "other-svc", Labels: otherLabels},
+			Upstream: &adctypes.Upstream{
+				Nodes: adctypes.UpstreamNodes{{Host: "10.0.0.2", Port: 80, Weight: 100}},
+			},
+			Routes: []*adctypes.Route{{
+				Metadata: adctypes.Metadata{ID: "other-route", Name: "other-route", Labels: otherLabels},
+				Uris:     []string{"/other"},
+			}},
+		}},
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, other, otherLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	synced := len(fake.received())
+
+	selector := kine.KindLabelSelector{
+		Kind:      testLabels[label.LabelKind],
+		Namespace: testLabels[label.LabelNamespace],
+		Name:      testLabels[label.LabelName],
+	}
+	if err := executor.DeleteAllFor(context.Background(), selector); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != synced+1 {
+		t.Fatalf("expected one delete batch, got %d", len(batches)-synced)
+	}
+
+	// Deletes follow the sync order: routes, services, upstreams, SSLs,
+	// global rules, by ID within a type
+	order := []string{"routes", "services", "upstreams", "ssls", "global_rules"}
+	rank := func(key string) (int, string) {
+		parts := strings.Split(strings.TrimPrefix(key, "/apisix/"), "/")
+		for i, resourceType := range order {
+			if parts[0] == resourceType {
+				return i, parts[1]
+			}
+		}
+		t.Fatalf("unexpected key %s", key)
+		return 0, ""
+	}
+	deletes := batches[synced]
+	if len(deletes) != 8 {
+		t.Errorf("expected 8 deletes, got %d", len(deletes))
+	}
+	for i, ev := range deletes {
+		if ev.Type != adapter.EventDelete {
+			t.Errorf("expected a delete for %s, got %v", ev.Key, ev.Type)
+		}
+		if i == 0 {
+			continue
+		}
+		prevRank, prevID := rank(deletes[i-1].Key)
+		curRank, curID := rank(ev.Key)
+		if prevRank > curRank || (prevRank == curRank && prevID > curID) {
+			t.Errorf("delete of %s sent before %s", deletes[i-1].Key, ev.Key)
+		}
+	}
+
+	// Resources of other selectors are untouched
+	for _, key := range []string{"/apisix/services/other-svc", "/apisix/routes/other-route"} {
+		if _, ok := fake.get(key); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+	routes, err := executor.cache.ListRoutes()
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	if len(routes) != 1 || routes[0].ID != "other-route" {
+		t.Errorf("expected only other-route to stay cached, got %v", routes)
+	}
+
+	// Nothing left to delete is not an error
+	if err := executor.DeleteAllFor(context.Background(), selector); err != nil {
+		t.Fatalf("expected deleting nothing to succeed, got %v", err)
+	}
+	if len(fake.received()) != synced+1 {
+		t.Error("expected no batch when nothing matches")
+	}
+}
+
+func TestKindExecutorRepublishAll(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	args := writeResources(t, testServiceResources(3, 2), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	want, err := executor.cachedValues()
+	if err != nil {
+		t.Fatalf("failed to read cached values: %v", err)
+	}
+	synced := len(fake.received())
+
+	if err := executor.RepublishAll(context.Background()); err != nil {
+		t.Fatalf("failed to republish: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != synced+1 {
+		t.Fatalf("expected one republished batch, got %d", len(batches)-synced)
+	}
+	seen := map[string]int{}
+	for _, ev := range batches[synced] {
+		if ev.Type != adapter.EventAdd {
+			t.Errorf("expected add event for %s, got %v", ev.Key, ev.Type)
+		}
+		if string(ev.Value) != string(want[ev.Key]) {
+			t.Errorf("unexpected value for %s: %s", ev.Key, ev.Value)
+		}
+		seen[ev.Key]++
+	}
+	if len(seen) != len(want) {
+		t.Errorf("expected %d republished keys, got %d", len(want), len(seen))
+	}
+	for key := range want {
+		if seen[key] != 1 {
+			t.Errorf("expected %s to be republished once, got %d", key, seen[key])
+		}
+	}
+}
+
+func TestKindExecutorLookupHandler(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	args := writeResources(t, testSSLResources("private-key"), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	executor.LookupHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kine/lookup?name=tls", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var lookup NameLookup
+	if err := json.Unmarshal(rec.Body.Bytes(), &lookup); err != nil {
+		t.Fatalf("failed to decode lookup: %v", err)
+	}
+	if len(lookup.SSLs) != 1 || lookup.SSLs[0].ID != "ssl-1" {
+		t.Fatalf("unexpected ssls: %+v", lookup.SSLs)
+	}
+	if lookup.SSLs[0].Key != kine.RedactedValue {
+		t.Errorf("expected redacted key, got %q", lookup.SSLs[0].Key)
+	}
+
+	rec = httptest.NewRecorder()
+	executor.LookupHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kine/lookup", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without a name, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestConvertToAdapterEventEscapesIDs(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	event, err := executor.convertToAdapterEvent(kine.Event{
+		Type:         kine.EventTypeDelete,
+		ResourceType: kine.ResourceTypeRoute,
+		ResourceID:   "foo/bar baz",
+	})
+	if err != nil {
+		t.Fatalf("failed to convert event: %v", err)
+	}
+	prefix := "/apisix/routes/"
+	segment, ok := strings.CutPrefix(event.Key, prefix)
+	if !ok || strings.Contains(segment, "/") {
+		t.Fatalf("expected a single key segment under %s, got %s", prefix, event.Key)
+	}
+	if id, err := url.PathUnescape(segment); err != nil || id != "foo/bar baz" {
+		t.Errorf("expected the key segment to unescape to the id, got %q (%v)", id, err)
+	}
+}
+
+func TestKindExecutorKeyCollisions(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	if err := executor.cache.InsertGlobalRule(&kine.GlobalRule{
+		ID:      "cors",
+		Plugins: map[string]any{"cors": map[string]any{}},
+	}); err != nil {
+		t.Fatalf("failed to insert global rule: %v", err)
+	}
+	route := &kine.Route{Metadata: adctypes.Metadata{ID: "cors"}, URIs: []string{"/"}}
+	routeEvent := kine.Event{
+		Type:         kine.EventTypeCreate,
+		ResourceType: kine.ResourceTypeRoute,
+		ResourceID:   route.ID,
+		NewValue:     route,
+	}
+
+	if err := executor.detectKeyCollisions([]kine.Event{routeEvent}, adapterKey); err != nil {
+		t.Fatalf("expected distinct keys per resource type, got %v", err)
+	}
+
+	// A layout without the type segment maps both to the same key
+	flatKey := func(_ kine.ResourceType, id string) string { return "/apisix/" + id }
+	err := executor.detectKeyCollisions([]kine.Event{routeEvent}, flatKey)
+	if err == nil || err.Error() != "conflict: global_rules cors and routes cors map to the same etcd key /apisix/cors" {
+		t.Fatalf("expected a collision naming both resources, got %v", err)
+	}
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+
+	// Within the batch
+	upstreamEvent := kine.Event{
+		Type:         kine.EventTypeCreate,
+		ResourceType: kine.ResourceTypeUpstream,
+		ResourceID:   "shared",
+		NewValue:     &kine.Upstream{Metadata: adctypes.Metadata{ID: "shared"}},
+	}
+	serviceEvent := kine.Event{
+		Type:         kine.EventTypeCreate,
+		ResourceType: kine.ResourceTypeService,
+		ResourceID:   "shared",
+		NewValue:     &kine.Service{Metadata: adctypes.Metadata{ID: "shared"}},
+	}
+	err = executor.detectKeyCollisions([]kine.Event{upstreamEvent, serviceEvent}, flatKey)
+	if err == nil || !strings.Contains(err.Error(), "upstreams shared and services shared") {
+		t.Fatalf("expected a collision within the batch, got %v", err)
+	}
+
+	// Deleting the global rule releases its key
+	deleteEvent := kine.Event{
+		Type:         kine.EventTypeDelete,
+		ResourceType: kine.ResourceTypeGlobalRule,
+		ResourceID:   "cors",
+	}
+	if err := executor.detectKeyCollisions([]kine.Event{routeEvent, deleteEvent}, flatKey); err != nil {
+		t.Fatalf("expected the deleted global rule to release its key, got %v", err)
+	}
+}
+
+func TestKindExecutorRouteConflicts(t *testing.T) {
+	sink := &memoryAuditSink{}
+	executor, _ := newTestKindExecutor(t, WithRouteConflictDetection(), WithAuditSink(sink))
+	otherLabels := map[string]string{
+		label.LabelKind:      "HTTPRoute",
+		label.LabelNamespace: "default",
+		label.LabelName:      "web",
+	}
+	claim := func(labels map[string]string, id string) []string {
+		resources := testServiceResources(1, 1)
+		resources.SSLs, resources.GlobalRules = nil, nil
+		service := resources.Services[0]
+		service.ID, service.Name = "svc-"+id, "svc-"+id
+		service.Labels = labels
+		service.Routes[0].ID, service.Routes[0].Name = id, id
+		service.Routes[0].Labels = labels
+		service.Routes[0].Hosts = []string{"example.com"}
+		service.Routes[0].Uris = []string{"/api/*"}
+		return writeResources(t, resources, labels)
+	}
+
+	if err := executor.Execute(context.Background(), adctypes.Config{}, claim(testLabels, "route-a")); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if len(sink.records) == 0 || sink.records[len(sink.records)-1].EventType == AuditEventWarning {
+		t.Fatalf("expected no conflict for the first owner, got %+v", sink.records)
+	}
+	// Syncing the same owner again does not conflict with its cached routes
+	if err := executor.Execute(context.Background(), adctypes.Config{}, claim(testLabels, "route-a")); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if warnings := executor.stats.snapshot().LastWarnings; len(warnings) != 0 {
+		t.Fatalf("expected no warnings on resync, got %v", warnings)
+	}
+
+	// The second owner claiming the same requests still syncs, with a warning
+	if err := executor.Execute(context.Background(), adctypes.Config{}, claim(otherLabels, "route-b")); err != nil {
+		t.Fatalf("expected conflicts not to fail the sync, got %v", err)
+	}
+	warnings := executor.stats.snapshot().LastWarnings
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "route-a") || !strings.Contains(warnings[0], "route-b") {
+		t.Fatalf("expected a warning naming both routes, got %v", warnings)
+	}
+	status, ok := executor.GetStatus(kine.KindLabelSelector{Kind: "HTTPRoute", Namespace: "default", Name: "web"})
+	if !ok || !status.Succeeded || !slices.Equal(status.Warnings, warnings) {
+		t.Fatalf("expected a successful status with the warning, got %+v (found %v)", status, ok)
+	}
+	record := sink.records[len(sink.records)-1]
+	if record.EventType != AuditEventWarning || record.ResourceType != kine.ResourceTypeRoute ||
+		record.ResourceID != "route-b" || record.Warning != warnings[0] {
+		t.Errorf("unexpected conflict audit record %+v", record)
+	}
+}
+
+func TestKindExecutorPluginReferences(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithPluginReferenceCheck())
+	sync := func(plugins adctypes.Plugins) []string {
+		resources := testServiceResources(1, 1)
+		resources.SSLs, resources.GlobalRules = nil, nil
+		resources.Consumers = []*adctypes.Consumer{{Username: "alice"}}
+		resources.Services[0].Routes[0].Plugins = plugins
+		if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+			t.Fatalf("expected dangling references not to fail the sync, got %v", err)
+		}
+		return executor.stats.snapshot().LastWarnings
+	}
+
+	if warnings := sync(adctypes.Plugins{
+		"consumer-restriction": map[string]any{"whitelist": []any{"alice"}},
+	}); len(warnings) != 0 {
+		t.Fatalf("expected no warning for an existing consumer, got %v", warnings)
+	}
+
+	warnings := sync(adctypes.Plugins{
+		"consumer-restriction": map[string]any{"whitelist": []any{"alice", "bob"}},
+	})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `missing consumer "bob" at /whitelist/1`) {
+		t.Fatalf("expected a warning for the missing consumer, got %v", warnings)
+	}
+
+	warnings = sync(adctypes.Plugins{
+		"traffic-split": map[string]any{
+			"rules": []any{map[string]any{
+				"weighted_upstreams": []any{map[string]any{"upstream_id": "canary", "weight": 10}},
+			}},
+		},
+	})
+	if len(warnings) != 1 ||
+		!strings.Contains(warnings[0], `missing upstream "canary" at /rules/0/weighted_upstreams/0/upstream_id`) {
+		t.Fatalf("expected a warning for the missing upstream, got %v", warnings)
+	}
+	plan, err := executor.Plan(context.Background(), writeResources(t, func() *adctypes.Resources {
+		resources := testServiceResources(1, 1)
+		resources.SSLs, resources.GlobalRules = nil, nil
+		resources.Services[0].Routes[0].Plugins = adctypes.Plugins{
+			"consumer-restriction": map[string]any{"blacklist": []any{"mallory"}},
+		}
+		return resources
+	}(), testLabels))
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if len(plan.References) != 1 || plan.References[0].ID != "mallory" ||
+		plan.References[0].ResourceType != kine.ResourceTypeRoute {
+		t.Errorf("expected the plan to list the dangling reference, got %v", plan.References)
+	}
+}
+
+func TestKindExecutorProtos(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	proto := &adctypes.Proto{
+		Metadata: adctypes.Metadata{ID: "helloworld", Labels: testLabels},
+		Content:  `syntax = "proto3"; package helloworld;`,
+	}
+	resources := &adctypes.Resources{Protos: []*adctypes.Proto{proto}}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("expected a single event, got %v", batches)
+	}
+	event := batches[0][0]
+	if event.Type != adapter.EventAdd || event.Key != "/apisix/protos/helloworld" {
+		t.Errorf("unexpected proto event %v %s", event.Type, event.Key)
+	}
+	if !strings.Contains(string(event.Value), `"content":"syntax = \"proto3\"; package helloworld;"`) {
+		t.Errorf("expected the proto content in %s", event.Value)
+	}
+
+	// Dropping the proto from the desired state deletes it
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches = fake.received()
+	if len(batches) != 2 || batches[1][0].Type != adapter.EventDelete || batches[1][0].Key != event.Key {
+		t.Errorf("expected the proto to be deleted, got %v", batches)
+	}
+}
+
+func TestKindExecutorPluginMetadata(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	resources := &adctypes.Resources{
+		PluginMetadata: adctypes.PluginMetadata{"http-logger": map[string]any{
+			"log_format": map[string]any{"host": "$host"},
+		}},
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches := fake.received()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("expected a single event, got %v", batches)
+	}
+	event := batches[0][0]
+	if event.Type != adapter.EventAdd || event.Key != "/apisix/plugin_metadata/http-logger" {
+		t.Errorf("unexpected plugin metadata event %v %s", event.Type, event.Key)
+	}
+	// APISIX expects the config fields next to the id
+	if !strings.Contains(string(event.Value), `"log_format":{"host":"$host"}`) ||
+		!strings.Contains(string(event.Value), `"id":"http-logger"`) {
+		t.Errorf("expected the flattened config in %s", event.Value)
+	}
+
+	// Dropping the metadata from the desired state deletes it
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	batches = fake.received()
+	if len(batches) != 2 || batches[1][0].Type != adapter.EventDelete || batches[1][0].Key != event.Key {
+		t.Errorf("expected the plugin metadata to be deleted, got %v", batches)
+	}
+}
+
+func TestKindExecutorInputHash(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "kine.db")
+	newExecutor := func() (*KindExecutor, *fakeAdapter) {
+		executor, fake := newTestKindExecutor(t, &KindExecutorOptions{CacheBackend: CacheBackendBolt, CachePath: cachePath})
+		t.Cleanup(func() {
+			_ = executor.cache.(io.Closer).Close()
+		})
+		return executor, fake
+	}
+	executor, fake := newExecutor()
+	selector := selectorFromLabels(testLabels)
+	sync := func(executor *KindExecutor, args []string, extra ...string) {
+		t.Helper()
+		if err := executor.Execute(context.Background(), adctypes.Config{}, append(slices.Clone(args), extra...)); err != nil {
+			t.Fatalf("failed to execute: %v", err)
+		}
+	}
+	v1 := writeResources(t, testServiceResources(1, 1), testLabels)
+	v2 := writeResources(t, testServiceResources(2, 1), testLabels)
+
+	if !executor.ShouldSync(selector, "v1") {
+		t.Error("expected a sync of an unknown input")
+	}
+	sync(executor, v1, "--input-hash", "v1")
+	sent := len(fake.received())
+	if executor.ShouldSync(selector, "v1") {
+		t.Error("expected no sync of an unchanged input")
+	}
+	if !executor.ShouldSync(selector, "v2") || !executor.ShouldSync(selector, "") {
+		t.Error("expected a sync of a changed or unhashed input")
+	}
+
+	// The executor skips the syncs of unchanged inputs too, even though the
+	// resource file would change the cache
+	sync(executor, v2, "--input-hash", "v1")
+	if len(fake.received()) != sent {
+		t.Errorf("expected the sync of an unchanged input to be skipped, got %d batches", len(fake.received())-sent)
+	}
+	// Force mode bypasses the hash
+	sync(executor, v2, "--input-hash", "v1", "--force")
+	if len(fake.received()) == sent {
+		t.Error("expected a forced sync to apply events")
+	}
+	sync(executor, v2, "--input-hash", "v2")
+	if executor.ShouldSync(selector, "v2") || !executor.ShouldSync(selector, "v1") {
+		t.Error("expected the hash of the last sync to be recorded")
+	}
+
+	// The hash survives a restart on the bolt cache
+	_ = executor.cache.(io.Closer).Close()
+	restored, fake := newExecutor()
+	if restored.ShouldSync(selector, "v2") {
+		t.Error("expected the input hash to survive a restart")
+	}
+	sync(restored, v1, "--input-hash", "v2")
+	if len(fake.received()) != 0 {
+		t.Errorf("expected the restored executor to skip the unchanged input, got %v", fake.received())
+	}
+
+	// Syncs without a hash and deletes forget it
+	sync(restored, v2)
+	if !restored.ShouldSync(selector, "v2") {
+		t.Error("expected a sync without a hash to forget the previous one")
+	}
+	sync(restored, v2, "--input-hash", "v2")
+	if err := restored.DeleteAllFor(context.Background(), selector); err != nil {
+		t.Fatalf("failed to delete resources: %v", err)
+	}
+	if !restored.ShouldSync(selector, "v2") {
+		t.Error("expected a delete to forget the input hash")
+	}
+}
+
+func TestKindExecutorDebugHandler(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, testServiceResources(2, 1), testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	otherLabels := map[string]string{"k8s/kind": "HTTPRoute", "k8s/namespace": "default", "k8s/name": "other"}
+	other := &adctypes.Resources{Services: []*adctypes.Service{{
+		Metadata: adctypes.Metadata{ID: "other", Name: "other", Labels: otherLabels},
+		Upstream: &adctypes.Upstream{Nodes: adctypes.UpstreamNodes{{Host: "10.0.0.2", Port: 80, Weight: 100}}},
+		Routes:   []*adctypes.Route{{Metadata: adctypes.Metadata{ID: "other", Name: "other"}, Uris: []string{"/other"}}},
+	}}}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, other, otherLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	get := func(method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		executor.DebugHandler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	ids := func(target string) []string {
+		t.Helper()
+		rec := get(http.MethodGet, target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to succeed, got %d: %s", target, rec.Code, rec.Body)
+		}
+		var objs []adctypes.Metadata
+		if err := json.Unmarshal(rec.Body.Bytes(), &objs); err != nil {
+			t.Fatalf("failed to decode %s: %v", target, err)
+		}
+		var ids []string
+		for _, obj := range objs {
+			ids = append(ids, obj.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if got := ids("/routes"); !slices.Equal(got, []string{"other", "route-0-0", "route-1-0"}) {
+		t.Errorf("expected all routes, got %v", got)
+	}
+	if got := ids("/services?kind=ApisixTls&namespace=default&name=tls"); !slices.Equal(got, []string{"svc-0", "svc-1"}) {
+		t.Errorf("expected the services of the owner, got %v", got)
+	}
+	if got := ids("/services?kind=HTTPRoute"); !slices.Equal(got, []string{"other"}) {
+		t.Errorf("expected the services of the kind, got %v", got)
+	}
+	if got := ids("/global_rules"); !slices.Equal(got, []string{"prometheus"}) {
+		t.Errorf("expected the global rule, got %v", got)
+	}
+	if got := ids("/upstreams"); len(got) != 0 {
+		t.Errorf("expected no shared upstreams, got %v", got)
+	}
+	rec := get(http.MethodGet, "/ssls")
+	var ssls []*kine.SSL
+	if err := json.Unmarshal(rec.Body.Bytes(), &ssls); err != nil || len(ssls) != 1 || ssls[0].Key != kine.RedactedValue {
+		t.Errorf("expected the SSL key to be redacted, got %s (%v)", rec.Body, err)
+	}
+	if ssl, err := executor.cache.GetSSL("ssl-1"); err != nil || ssl.Key != "private-key" {
+		t.Errorf("expected the cached SSL key to be kept, got %v (%v)", ssl, err)
+	}
+
+	rec = get(http.MethodGet, "/stats")
+	var stats SyncStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Count != 2 {
+		t.Errorf("expected the stats of 2 syncs, got %s (%v)", rec.Body, err)
+	}
+	if rec := get(http.MethodGet, "/routes?name=tls"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a name without kind to be rejected, got %d", rec.Code)
+	}
+	if rec := get(http.MethodPost, "/routes"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected writes to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestKindExecutorDebugServer(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithDebugAddr("0.0.0.0:0"))
+	if err := executor.startDebugServer(); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Errorf("expected a non-loopback address to be rejected, got %v", err)
+	}
+
+	executor, _ = newTestKindExecutor(t, WithDebugAddr("127.0.0.1:0"))
+	if err := executor.startDebugServer(); err != nil {
+		t.Fatalf("failed to start debug server: %v", err)
+	}
+	if err := executor.Close(); err != nil {
+		t.Fatalf("failed to close executor: %v", err)
+	}
+}
+
+// recordingBackend records the batches it receives, failing with err
+type recordingBackend struct {
+	batches [][]*adapter.Event
+	err     error
+}
+
+func (b *recordingBackend) Send(_ context.Context, events []*adapter.Event) error {
+	b.batches = append(b.batches, events)
+	return b.err
+}
+
+func TestKindExecutorSecondaryBackend(t *testing.T) {
+	secondary := &recordingBackend{}
+	executor, fake := newTestKindExecutor(t, WithSecondaryBackend(secondary))
+	args := writeResources(t, testServiceResources(2, 1), testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if !reflect.DeepEqual(secondary.batches, fake.received()) {
+		t.Errorf("expected the secondary backend to get the adapter batches %v, got %v", fake.received(), secondary.batches)
+	}
+	if err := executor.RepublishAll(context.Background()); err != nil {
+		t.Fatalf("failed to republish: %v", err)
+	}
+	if len(secondary.batches) != 2 || !reflect.DeepEqual(secondary.batches[1], fake.received()[1]) {
+		t.Errorf("expected the secondary backend to get the republished batch, got %d batches", len(secondary.batches))
+	}
+
+	// Secondary failures are counted but never fail the sync
+	secondary.err = errors.New("secondary unavailable")
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, testServiceResources(1, 1), testLabels)); err != nil {
+		t.Fatalf("expected the sync to succeed, got %v", err)
+	}
+	if stats := executor.Stats(); stats.SecondaryFailures != 1 || stats.Failures != 0 {
+		t.Errorf("expected a secondary failure only, got %+v", stats)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	backend := NewFileBackend(path)
+	batches := [][]*adapter.Event{
+		{{Type: adapter.EventAdd, Key: "/apisix/routes/r1", Value: []byte(`{"id":"r1"}`)}},
+		{{Type: adapter.EventDelete, Key: "/apisix/routes/r1"}},
+	}
+	for _, batch := range batches {
+		if err := backend.Send(context.Background(), batch); err != nil {
+			t.Fatalf("failed to send batch: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read event file: %v", err)
+	}
+	want := `[{"type":"ADD","key":"/apisix/routes/r1","value":{"id":"r1"}}]` + "\n" +
+		`[{"type":"DELETE","key":"/apisix/routes/r1"}]` + "\n"
+	if string(data) != want {
+		t.Errorf("expected event file\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestKindExecutorDeletesLabelLessRoutes(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	// The routes of testServiceResources carry no labels, only their
+	// service does
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, testServiceResources(1, 2), testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	route, err := executor.cache.GetRoute("route-0-0")
+	if err != nil {
+		t.Fatalf("failed to get route: %v", err)
+	}
+	if !maps.Equal(route.Labels, testLabels) {
+		t.Errorf("expected the route to inherit the owner labels, got %v", route.Labels)
+	}
+
+	// The parent resource disappeared, its sync is empty
+	before := len(fake.received())
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, &adctypes.Resources{}, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	routes, err := executor.cache.ListRoutes()
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	if len(routes) != 0 {
+		t.Errorf("expected the label-less routes to be deleted, got %d", len(routes))
+	}
+	deleted := 0
+	for _, batch := range fake.received()[before:] {
+		for _, event := range batch {
+			if event.Type == adapter.EventDelete && strings.HasPrefix(event.Key, adapterKey(kine.ResourceTypeRoute, "")) {
+				deleted++
+			}
+		}
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 route deletes sent to the adapter, got %d", deleted)
+	}
+}
+
+func TestKindExecutorCleanupOrphans(t *testing.T) {
+	executor, fake := newTestKindExecutor(t)
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, testServiceResources(1, 1), testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	// A route cached without owner labels by a past bug, no sync can
+	// match it anymore
+	serviceID := "svc-0"
+	if err := executor.cache.InsertRoute(&kine.Route{
+		Metadata:  adctypes.Metadata{ID: "orphan"},
+		URIs:      []string{"/orphan"},
+		ServiceID: &serviceID,
+	}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	before := len(fake.received())
+
+	report, err := executor.CleanupOrphans(context.Background(), false)
+	if err != nil {
+		t.Fatalf("failed to scan orphans: %v", err)
+	}
+	want := []Orphan{{ResourceType: kine.ResourceTypeRoute, ResourceID: "orphan"}}
+	if report.Deleted || !reflect.DeepEqual(report.Orphans, want) {
+		t.Errorf("expected the orphaned route to be reported only, got %+v", report)
+	}
+	if _, err := executor.cache.GetRoute("orphan"); err != nil {
+		t.Errorf("expected a dry run to keep the orphaned route: %v", err)
+	}
+	if len(fake.received()) != before {
+		t.Errorf("expected a dry run to send nothing to the adapter")
+	}
+
+	// Deletion must be confirmed explicitly
+	handler := executor.OrphansHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kine/orphans?delete=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if !report.Deleted || !reflect.DeepEqual(report.Orphans, want) {
+		t.Errorf("expected the orphaned route to be deleted, got %+v", report)
+	}
+	if _, err := executor.cache.GetRoute("orphan"); !errors.Is(err, kine.ErrNotFound) {
+		t.Errorf("expected the orphaned route to be removed from the cache, got %v", err)
+	}
+	if _, err := executor.cache.GetService(serviceID); err != nil {
+		t.Errorf("expected the labeled service to be kept: %v", err)
+	}
+	var deletes []string
+	for _, batch := range fake.received()[before:] {
+		for _, event := range batch {
+			if event.Type == adapter.EventDelete {
+				deletes = append(deletes, event.Key)
+			}
+		}
+	}
+	if !slices.Equal(deletes, []string{adapterKey(kine.ResourceTypeRoute, "orphan")}) {
+		t.Errorf("expected a delete of the orphaned route sent to the adapter, got %v", deletes)
+	}
+
+	report, err = executor.CleanupOrphans(context.Background(), true)
+	if err != nil {
+		t.Fatalf("failed to scan orphans: %v", err)
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("expected no orphans left, got %+v", report.Orphans)
+	}
+}
+
+func TestKindExecutorSplitUpstreams(t *testing.T) {
+	executor, fake := newTestKindExecutor(t, WithSplitUpstreams())
+	resources := testServiceResources(1, 1)
+	resources.SSLs, resources.GlobalRules = nil, nil
+	resources.Services[0].Routes[0].Plugins = adctypes.Plugins{
+		"traffic-split": map[string]any{
+			"rules": []any{map[string]any{
+				"weighted_upstreams": []any{
+					map[string]any{
+						"upstream": map[string]any{"nodes": []any{
+							map[string]any{"host": "10.0.0.2", "port": 8080, "weight": 1},
+						}},
+						"weight": 10,
+					},
+					map[string]any{"weight": 90},
+				},
+			}},
+		},
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{}, writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	upstreams, err := executor.cache.ListUpstreams()
+	if err != nil || len(upstreams) != 1 {
+		t.Fatalf("expected the canary upstream to be cached, got %v (%v)", upstreams, err)
+	}
+	var sent bool
+	for _, event := range fake.received()[0] {
+		sent = sent || event.Key == adapterKey(kine.ResourceTypeUpstream, upstreams[0].ID)
+	}
+	if !sent {
+		t.Errorf("expected the canary upstream to be sent")
+	}
+
+	// The canary upstream carries no owner labels, but is referenced
+	report, err := executor.CleanupOrphans(context.Background(), false)
+	if err != nil {
+		t.Fatalf("failed to scan orphans: %v", err)
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("expected no orphans, got %+v", report.Orphans)
+	}
+}
+
+func TestKindExecutorTimeoutPropagation(t *testing.T) {
+	executor, fake := newTestKindExecutor(t, WithTimeoutPropagation())
+	resources := testServiceResources(1, 2)
+	resources.Services[0].Upstream.Timeout = &adctypes.Timeout{Connect: 5, Send: 10, Read: 60}
+	resources.Services[0].Routes[1].Timeout = &adctypes.Timeout{Connect: 1, Send: 2, Read: 3}
+	args := writeResources(t, resources, testLabels)
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	want := map[string]kine.Timeout{
+		"route-0-0": {Connect: 5, Send: 10, Read: 60},
+		"route-0-1": {Connect: 1, Send: 2, Read: 3},
+	}
+	routes, err := executor.cache.ListRoutes()
+	if err != nil || len(routes) != len(want) {
+		t.Fatalf("expected %d cached routes, got %v (%v)", len(want), routes, err)
+	}
+	for _, route := range routes {
+		if route.Timeout == nil || *route.Timeout != want[route.Name] {
+			t.Errorf("expected route %s timeout %+v, got %+v", route.Name, want[route.Name], route.Timeout)
+		}
+	}
+
+	// Syncing the same input again sends nothing
+	if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	if batches := fake.received(); len(batches) != 1 {
+		t.Errorf("expected no events on the second sync, got %d batches", len(batches))
+	}
+}
+
+func TestKindExecutorBestEffortKeepsSkipped(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithBestEffortTransfer())
+	resources := testServiceResources(1, 2)
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// Breaking the service skips it, its last applied state stays
+	resources.Services[0].Upstream = nil
+	result, err := executor.SyncResources(context.Background(), adctypes.Config{},
+		writeResources(t, resources, testLabels))
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if len(result.Warnings) != 1 {
+		t.Errorf("expected the broken service to be reported, got %v", result.Warnings)
+	}
+	if n := result.Count(kine.EventTypeDelete); n != 0 {
+		t.Errorf("expected no deletes, got %d", n)
+	}
+	if _, err := executor.cache.GetService("svc-0"); err != nil {
+		t.Errorf("expected the skipped service to stay cached: %v", err)
+	}
+	if routes, err := executor.cache.ListRoutes(); err != nil || len(routes) != 2 {
+		t.Errorf("expected the routes of the skipped service to stay cached, got %v (%v)", routes, err)
+	}
+}
+
+func TestKindExecutorSyncResult(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	if executor.GetLastResult() != nil {
+		t.Errorf("expected no result before the first sync")
+	}
+	resources := testServiceResources(1, 2)
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// Syncing the same resources again has nothing to do
+	result, err := executor.SyncResources(context.Background(), adctypes.Config{},
+		writeResources(t, resources, testLabels))
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if result.Total() != 0 || result.Sent || len(result.Warnings) != 0 {
+		t.Errorf("expected a no-op result, got %+v", result)
+	}
+	if result.SyncID == "" {
+		t.Errorf("expected the result to carry the sync ID")
+	}
+	for _, phase := range []string{"parseArgs", "transfer", "diff", "send"} {
+		if _, ok := result.Phases[phase]; !ok {
+			t.Errorf("expected the duration of the %s phase, got %v", phase, result.Phases)
+		}
+	}
+	if executor.GetLastResult() != result {
+		t.Errorf("expected the last result to be kept")
+	}
+
+	// Changing, removing and adding a route
+	resources.Services[0].Routes[0].Uris = []string{"/changed"}
+	resources.Services[0].Routes[1] = &adctypes.Route{
+		Metadata: adctypes.Metadata{ID: "route-0-2", Name: "route-0-2"},
+		Uris:     []string{"/svc-0/route-2"},
+	}
+	if err := executor.Execute(context.Background(), adctypes.Config{},
+		writeResources(t, resources, testLabels)); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	result = executor.GetLastResult()
+	want := map[kine.EventType]map[kine.ResourceType]int{
+		kine.EventTypeCreate: {kine.ResourceTypeRoute: 1},
+		kine.EventTypeUpdate: {kine.ResourceTypeRoute: 1},
+		kine.EventTypeDelete: {kine.ResourceTypeRoute: 1},
+	}
+	if !reflect.DeepEqual(result.Events, want) {
+		t.Errorf("expected one route create, update and delete, got %v", result.Events)
+	}
+	if result.Total() != 3 || result.Count(kine.EventTypeUpdate) != 1 || !result.Sent {
+		t.Errorf("expected 3 sent events, got %+v", result)
+	}
+}
+
+func TestKindExecutorRecentSyncs(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithSyncHistory(3))
+	var syncIDs []string
+	for i := 1; i <= 4; i++ {
+		res, err := executor.SyncResources(context.Background(), adctypes.Config{},
+			writeResources(t, testServiceResources(i, 1), testLabels))
+		if err != nil {
+			t.Fatalf("failed to sync: %v", err)
+		}
+		syncIDs = append(syncIDs, res.SyncID)
+	}
+	res, err := executor.SyncResources(context.Background(), adctypes.Config{}, []string{"sync"})
+	if err == nil {
+		t.Fatal("expected a sync without file to fail")
+	}
+	syncIDs = append(syncIDs, res.SyncID)
+
+	// The buffer wrapped, keeping the last three syncs oldest first
+	records := executor.GetRecentSyncs()
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	for i, record := range records {
+		if record.SyncID != syncIDs[i+2] {
+			t.Errorf("expected record %d to be sync %s, got %s", i, syncIDs[i+2], record.SyncID)
+		}
+	}
+	record := records[1]
+	if !reflect.DeepEqual(record.Selector, testLabels) || record.FinishedAt.Before(record.StartedAt) ||
+		record.Events[kine.EventTypeCreate][kine.ResourceTypeRoute] != 1 {
+		t.Errorf("unexpected record %+v", record)
+	}
+	want := EventIdentity{
+		Type:         kine.EventTypeCreate,
+		ResourceType: kine.ResourceTypeRoute,
+		ResourceID:   "route-3-0",
+		ResourceName: "route-3-0",
+	}
+	if !slices.Contains(record.FirstEvents, want) {
+		t.Errorf("expected the created route among the events, got %+v", record.FirstEvents)
+	}
+	if failed := records[2]; failed.Error == "" || len(failed.FirstEvents) != 0 {
+		t.Errorf("expected the failed sync to be recorded with its error, got %+v", failed)
+	}
+
+	rec := httptest.NewRecorder()
+	executor.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/syncs", nil))
+	var served []SyncRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil || len(served) != 3 {
+		t.Fatalf("expected the debug endpoint to serve 3 records, got %s (%v)", rec.Body.String(), err)
+	}
+	if strings.Contains(rec.Body.String(), "10.0.0") {
+		t.Errorf("expected no resource values in the history, got %s", rec.Body.String())
+	}
+}
+
+func TestKindExecutorRecentSyncsConcurrentReads(t *testing.T) {
+	executor, _ := newTestKindExecutor(t, WithSyncHistory(2))
+	args := writeResources(t, testServiceResources(2, 2), testLabels)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 10 {
+			if err := executor.Execute(context.Background(), adctypes.Config{}, args); err != nil {
+				t.Errorf("failed to execute: %v", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if records := executor.GetRecentSyncs(); len(records) != 2 {
+				t.Fatalf("expected 2 records, got %d", len(records))
+			}
+			return
+		default:
+		}
+		for _, record := range executor.GetRecentSyncs() {
+			_ = record.SyncID
+			_ = len(record.FirstEvents)
+		}
+		executor.SyncsHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/kine/syncs", nil))
+	}
+}
+
+func TestKindExecutorExcludedByTypeFilter(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	resources := testServiceResources(1, 1)
+	resources.Protos = []*adctypes.Proto{{Metadata: adctypes.Metadata{ID: "proto"}, Content: "syntax = \"proto3\";"}}
+	resources.PluginMetadata = adctypes.PluginMetadata{"http-logger": map[string]any{}}
+	args := append(writeResources(t, resources, testLabels), "--include-resource-type", adctypes.TypeService)
+
+	result, err := executor.SyncResources(context.Background(), adctypes.Config{}, args)
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	want := map[kine.ResourceType]int{
+		kine.ResourceTypeSSL:            1,
+		kine.ResourceTypeGlobalRule:     1,
+		kine.ResourceTypeProto:          1,
+		kine.ResourceTypePluginMetadata: 1,
+	}
+	if !reflect.DeepEqual(result.Excluded, want) {
+		t.Errorf("expected the non service resources to be excluded, got %v", result.Excluded)
+	}
+	if !slices.Contains(result.Warnings, "1 ssls present in input but excluded by type filter") {
+		t.Errorf("expected a warning about the excluded SSL, got %v", result.Warnings)
+	}
+	if result.Count(kine.EventTypeCreate) != 2 {
+		t.Errorf("expected the service and its route to be created, got %v", result.Events)
+	}
+	if ssls, _ := executor.cache.ListSSL(); len(ssls) != 0 {
+		t.Errorf("expected the excluded SSL not to be synced, got %d", len(ssls))
+	}
+
+	// Strict types fail the sync before anything is applied
+	resources.Services[0].Routes[0].Uris = []string{"/changed"}
+	args = append(writeResources(t, resources, testLabels),
+		"--include-resource-type", adctypes.TypeService, "--strict-types")
+	_, err = executor.SyncResources(context.Background(), adctypes.Config{}, args)
+	if !errors.Is(err, ErrExcludedByTypeFilter) {
+		t.Fatalf("expected an excluded resources error, got %v", err)
+	}
+	route, err := executor.cache.GetRoute("route-0-0")
+	if err != nil {
+		t.Fatalf("failed to get route: %v", err)
+	}
+	if slices.Equal(route.URIs, []string{"/changed"}) {
+		t.Errorf("expected the failed strict sync to leave the route unchanged")
+	}
+
+	// Without a type filter nothing is excluded
+	result, err = executor.SyncResources(context.Background(), adctypes.Config{},
+		append(writeResources(t, resources, testLabels), "--strict-types"))
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if len(result.Excluded) != 0 {
+		t.Errorf("expected no excluded resources, got %v", result.Excluded)
+	}
+}
+
+func TestConvertADCTypesToKineTypes(t *testing.T) {
+	executor, _ := newTestKindExecutor(t)
+	kineTypes, err := executor.convertADCTypesToKineTypes([]string{
+		adctypes.TypeService, adctypes.TypeConsumer, adctypes.TypeGlobalRule, "ssls",
+	})
+	if err != nil {
+		t.Fatalf("failed to convert types: %v", err)
+	}
+	want := []string{"routes", "services", "upstreams", "ssls", "global_rules"}
+	if !slices.Equal(kineTypes, want) {
+		t.Errorf("expected %v, got %v", want, kineTypes)
+	}
+	if _, err := executor.convertADCTypesToKineTypes([]string{"servics"}); !errors.Is(err, kine.ErrUnknownResourceType) {
+		t.Errorf("expected an unknown resource type error, got %v", err)
+	}
+}
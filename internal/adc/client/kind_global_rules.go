@@ -0,0 +1,129 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// GlobalRuleMode is how global rules are written to the etcd adapter
+type GlobalRuleMode string
+
+const (
+	// GlobalRulePerPlugin writes each global rule, one per plugin, to its
+	// own key, the default
+	GlobalRulePerPlugin GlobalRuleMode = "per-plugin"
+	// GlobalRuleAggregated writes a single global rule merging the plugins
+	// of all cached global rules, for gateways reading one document
+	GlobalRuleAggregated GlobalRuleMode = "aggregated"
+)
+
+// aggregatedGlobalRuleID is the ID of the global rule written in aggregated
+// mode
+const aggregatedGlobalRuleID = "1"
+
+// aggregatedGlobalRule returns the global rule merging the plugins of the
+// cached global rules once the global rule events are applied, nil when
+// none remains. Plugins are merged in global rule ID order.
+func (e *KindExecutor) aggregatedGlobalRule(events []kine.Event) (*kine.GlobalRule, error) {
+	rules, err := e.cache.ListGlobalRules(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list global rules: %w", err)
+	}
+	byID := make(map[string]*kine.GlobalRule, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+	for _, event := range events {
+		if event.ResourceType != kine.ResourceTypeGlobalRule {
+			continue
+		}
+		if event.Type == kine.EventTypeDelete {
+			delete(byID, event.ResourceID)
+			continue
+		}
+		rule, ok := event.NewValue.(*kine.GlobalRule)
+		if !ok {
+			return nil, fmt.Errorf("global rule %s: %w", event.ResourceID, errInvalidEventValue)
+		}
+		byID[event.ResourceID] = rule
+	}
+	if len(byID) == 0 {
+		return nil, nil
+	}
+	aggregated := &kine.GlobalRule{ID: aggregatedGlobalRuleID, Plugins: make(map[string]any)}
+	for _, id := range slices.Sorted(maps.Keys(byID)) {
+		maps.Copy(aggregated.Plugins, byID[id].Plugins)
+	}
+	return aggregated, nil
+}
+
+// aggregateGlobalRules replaces the adapter events of global rules with a
+// single event writing, or deleting, the aggregated global rule. The
+// aggregated event takes the slot of the first global rule event and the
+// others are cleared, so that adapterEvents stays aligned with events.
+// Batches without global rule events are left alone.
+func (e *KindExecutor) aggregateGlobalRules(events []kine.Event, adapterEvents []*adapter.Event) error {
+	first := slices.IndexFunc(events, func(event kine.Event) bool {
+		return event.ResourceType == kine.ResourceTypeGlobalRule
+	})
+	if first < 0 {
+		return nil
+	}
+	rule, err := e.aggregatedGlobalRule(events)
+	if err != nil {
+		return err
+	}
+	aggregated := &adapter.Event{
+		Key:  adapterKey(kine.ResourceTypeGlobalRule, aggregatedGlobalRuleID),
+		Type: adapter.EventDelete,
+	}
+	if rule != nil {
+		value, err := kine.CanonicalJSON(rule)
+		if err != nil {
+			return fmt.Errorf("failed to marshal aggregated global rule: %w", err)
+		}
+		event := kine.Event{Type: kine.EventTypeUpdate, ResourceType: kine.ResourceTypeGlobalRule,
+			ResourceID: aggregatedGlobalRuleID}
+		if err := e.checkValueSize(event, len(value)); err != nil {
+			return err
+		}
+		// Updates of missing keys fall back to creates in the adapter
+		aggregated.Type, aggregated.Value = adapter.EventUpdate, value
+	}
+	for i, event := range events {
+		if event.ResourceType == kine.ResourceTypeGlobalRule {
+			adapterEvents[i] = nil
+		}
+	}
+	adapterEvents[first] = aggregated
+	return nil
+}
+
+// withoutNil returns the adapter events left by aggregateGlobalRules
+func withoutNil(adapterEvents []*adapter.Event) []*adapter.Event {
+	return slices.DeleteFunc(slices.Clone(adapterEvents), func(event *adapter.Event) bool {
+		return event == nil
+	})
+}
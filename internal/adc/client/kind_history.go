@@ -0,0 +1,141 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+const (
+	// DefaultSyncHistorySize is the number of recent syncs kept by default
+	DefaultSyncHistorySize = 20
+	// syncHistoryEvents caps the event identities kept per sync
+	syncHistoryEvents = 50
+)
+
+// SyncRecord describes a past sync, for telling what the executor did at a
+// given time. It holds the identities of the synced objects, never their
+// values.
+type SyncRecord struct {
+	SyncID     string            `json:"syncId"`
+	Selector   map[string]string `json:"selector,omitempty"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	// Events counts the events of the sync by event type and resource
+	// type. Failed syncs count none.
+	Events   map[kine.EventType]map[kine.ResourceType]int `json:"events,omitempty"`
+	Warnings []string                                     `json:"warnings,omitempty"`
+	Error    string                                       `json:"error,omitempty"`
+	// FirstEvents identifies the first events of the sync, in the order
+	// they were applied
+	FirstEvents []EventIdentity `json:"firstEvents,omitempty"`
+}
+
+// EventIdentity identifies the object of an event
+type EventIdentity struct {
+	Type         kine.EventType    `json:"type"`
+	ResourceType kine.ResourceType `json:"resourceType"`
+	ResourceID   string            `json:"resourceId"`
+	ResourceName string            `json:"resourceName,omitempty"`
+}
+
+// syncHistory is a ring buffer of the most recent sync records
+type syncHistory struct {
+	mu      sync.Mutex
+	records []SyncRecord
+	// next is the index the next record is written to once the buffer is
+	// full
+	next int
+}
+
+// add records a sync, overwriting the oldest one once size records are
+// kept
+func (h *syncHistory) add(record SyncRecord, size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.records) < size {
+		h.records = append(h.records, record)
+		return
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+}
+
+// snapshot returns the recorded syncs from the oldest to the most recent
+func (h *syncHistory) snapshot() []SyncRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := make([]SyncRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// recordHistory adds a finished sync to the history of the executor
+func (e *KindExecutor) recordHistory(res *SyncResult, started time.Time, result *syncResult, err error) {
+	size := e.opts.SyncHistorySize
+	if size == 0 {
+		size = DefaultSyncHistorySize
+	}
+	if size < 0 {
+		return
+	}
+	record := SyncRecord{
+		SyncID:     res.SyncID,
+		Selector:   result.labels,
+		StartedAt:  started,
+		FinishedAt: started.Add(res.Duration),
+		Events:     res.Events,
+		Warnings:   res.Warnings,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		for _, event := range result.events[:min(len(result.events), syncHistoryEvents)] {
+			record.FirstEvents = append(record.FirstEvents, EventIdentity{
+				Type:         event.Type,
+				ResourceType: event.ResourceType,
+				ResourceID:   event.ResourceID,
+				ResourceName: event.ResourceName,
+			})
+		}
+	}
+	e.history.add(record, size)
+}
+
+// GetRecentSyncs returns the most recent syncs run by Execute or
+// SyncResources, from the oldest to the most recent. The number of syncs
+// kept is set by the SyncHistorySize option.
+func (e *KindExecutor) GetRecentSyncs() []SyncRecord {
+	return e.history.snapshot()
+}
+
+// SyncsHandler serves the recent syncs as JSON, see GetRecentSyncs
+func (e *KindExecutor) SyncsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeCanonicalJSON(w, e.GetRecentSyncs())
+	})
+}
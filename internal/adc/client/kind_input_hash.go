@@ -0,0 +1,77 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"github.com/go-logr/logr"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// ShouldSync reports whether a sync of the resources selected by selector
+// from the input hashed to hash may change anything. It is false when the
+// last successful sync of the selector had the same non-empty --input-hash
+// and its resources are still cached, so that controllers can skip syncs
+// of unchanged parent resources. The hashes are kept in the cache, a bolt
+// cache keeps them across restarts.
+func (e *KindExecutor) ShouldSync(selector kine.KindLabelSelector, hash string) bool {
+	if hash == "" {
+		return true
+	}
+	stored, err := e.cache.InputHash(selector)
+	if err != nil {
+		e.log.Error(err, "failed to get input hash, syncing", "selector", selector)
+		return true
+	}
+	if stored != hash {
+		return true
+	}
+	// The resources may have been deleted since, by a partial DeleteAllFor
+	matched, err := e.matchesCachedResources(selectorLabels(selector))
+	return err != nil || !matched
+}
+
+// skipUnchangedInput reports whether a sync can be skipped because its
+// input is unchanged. Forced and diff-only syncs never are.
+func (e *KindExecutor) skipUnchangedInput(log logr.Logger, parsed *syncArgs) bool {
+	if parsed.inputHash == "" || parsed.force || e.opts.DiffOnly {
+		return false
+	}
+	if e.ShouldSync(selectorFromLabels(parsed.labels), parsed.inputHash) {
+		return false
+	}
+	log.Info("input unchanged since the last sync, skipping", "labels", parsed.labels, "inputHash", parsed.inputHash)
+	return true
+}
+
+// recordInputHash records the input hash of the resources selected by
+// labels, forgetting it when hash is empty. Failures are logged, they only
+// cost a sync that could have been skipped.
+func (e *KindExecutor) recordInputHash(log logr.Logger, labels map[string]string, hash string) {
+	selector := selectorFromLabels(labels)
+	stored, err := e.cache.InputHash(selector)
+	if err == nil && stored == hash {
+		return
+	}
+	if err == nil {
+		err = e.cache.SetInputHash(selector, hash)
+	}
+	if err != nil {
+		log.Error(err, "failed to record input hash", "labels", labels)
+	}
+}
@@ -0,0 +1,121 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// unixSocketScheme prefixes adapter addresses naming a unix socket,
+	// such as unix:///var/run/pingsix/etcd.sock
+	unixSocketScheme = "unix://"
+
+	// defaultAdapterSocketMode is the file mode of adapter unix sockets
+	defaultAdapterSocketMode fs.FileMode = 0o660
+)
+
+// splitAdapterAddr returns the network and address of an adapter address
+func splitAdapterAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, unixSocketScheme); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// listenAdapter listens on a TCP address or, with the unix:// scheme, on a
+// unix socket created with the given mode. A stale socket file left behind
+// by a previous process is removed first.
+func listenAdapter(addr string, mode fs.FileMode) (net.Listener, error) {
+	network, address := splitAdapterAddr(addr)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(address), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if mode == 0 {
+		mode = defaultAdapterSocketMode
+	}
+	if err := os.Chmod(address, mode); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to set socket mode: %w", err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket file at path unless a process still
+// accepts connections on it. Other kinds of files are left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// adapterListenerAddr formats the address of an adapter listener the way
+// it is configured, keeping the unix:// scheme of sockets
+func adapterListenerAddr(ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return unixSocketScheme + ln.Addr().String()
+	}
+	return ln.Addr().String()
+}
+
+// DialAdapter connects to an etcd adapter address as accepted by
+// WithAdapterAddr, either host:port or unix:///path/to/socket. Health checks
+// and clients verifying applied state use it to reach the adapter. A non
+// nil tlsConfig, see AdapterClientTLSConfig, makes it a TLS connection.
+func DialAdapter(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	network, address := splitAdapterAddr(addr)
+	if tlsConfig != nil {
+		return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, address)
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
@@ -0,0 +1,96 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"github.com/go-logr/logr"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+// verboseSink emits the V(n) lines of a logger at V(n-boost), raising the
+// verbosity of a single sync without touching the global one
+type verboseSink struct {
+	logr.LogSink
+	boost int
+}
+
+// Init is a no-op, the wrapped sink was initialized by its own logger
+func (s *verboseSink) Init(logr.RuntimeInfo) {}
+
+func (s *verboseSink) level(level int) int {
+	return max(level-s.boost, 0)
+}
+
+func (s *verboseSink) Enabled(level int) bool {
+	return s.LogSink.Enabled(s.level(level))
+}
+
+func (s *verboseSink) Info(level int, msg string, keysAndValues ...any) {
+	s.LogSink.Info(s.level(level), msg, keysAndValues...)
+}
+
+func (s *verboseSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &verboseSink{LogSink: s.LogSink.WithValues(keysAndValues...), boost: s.boost}
+}
+
+func (s *verboseSink) WithName(name string) logr.LogSink {
+	return &verboseSink{LogSink: s.LogSink.WithName(name), boost: s.boost}
+}
+
+// syncLogger returns the logger of a sync. A positive verbosity, set by the
+// --v argument, raises the verbosity of that sync only.
+func (e *KindExecutor) syncLogger(syncID string, verbosity int) logr.Logger {
+	log := e.log
+	if sink := log.GetSink(); verbosity > 0 && sink != nil {
+		// Account for the frame of verboseSink in caller information
+		if withDepth, ok := sink.(logr.CallDepthLogSink); ok {
+			sink = withDepth.WithCallDepth(1)
+		}
+		log = logr.New(&verboseSink{LogSink: sink, boost: verbosity})
+	}
+	return log.WithValues("syncID", syncID)
+}
+
+// logEvents logs one line per applied event at V(1), identifying the
+// resource and its owner without its value, and a summary line
+func logEvents(log logr.Logger, events []kine.Event) {
+	var created, updated, deleted int
+	for _, event := range events {
+		value := event.NewValue
+		switch event.Type {
+		case kine.EventTypeCreate:
+			created++
+		case kine.EventTypeUpdate:
+			updated++
+		case kine.EventTypeDelete:
+			deleted++
+			value = event.OldValue
+		}
+		if !log.V(1).Enabled() {
+			continue
+		}
+		labels := kine.KineLabelIndexer.GetLabels(value)
+		log.V(1).Info("applying event", "op", event.Type, "resourceType", event.ResourceType,
+			"resourceID", event.ResourceID, "resourceName", event.ResourceName,
+			"ownerKind", labels[label.LabelKind], "ownerNamespace", labels[label.LabelNamespace],
+			"ownerName", labels[label.LabelName])
+	}
+	log.Info("applying events", "created", created, "updated", updated, "deleted", deleted)
+}
@@ -0,0 +1,235 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// Orphan is a cached object lacking an owner label. No label selector
+// matches it, so syncs never update nor delete it.
+type Orphan struct {
+	ResourceType kine.ResourceType `json:"resourceType"`
+	ResourceID   string            `json:"resourceId"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// OrphanReport lists the orphans found by a scan, in deletion order
+type OrphanReport struct {
+	Orphans []Orphan `json:"orphans"`
+	// Deleted reports whether the orphans were deleted from the cache and
+	// the etcd adapter
+	Deleted bool `json:"deleted"`
+}
+
+// CleanupOrphans reports the cached objects lacking an owner label, left
+// by past bugs, and deletes them from the cache and the etcd adapter when
+// deleteOrphans is set. Services and upstreams still referenced by a
+// labeled route or service, such as shared upstreams, and protected global
+// rules are kept.
+func (e *KindExecutor) CleanupOrphans(ctx context.Context, deleteOrphans bool) (*OrphanReport, error) {
+	if deleteOrphans && e.opts.DiffOnly {
+		return nil, errors.New("diff-only executor cannot delete orphaned resources")
+	}
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	log := e.log.WithValues("syncID", uuid.NewString())
+
+	report := &OrphanReport{Orphans: []Orphan{}}
+	var events []kine.Event
+	for _, resourceType := range kine.ResourceTypes {
+		objs, err := e.cache.ListUnlabeled(resourceType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list unlabeled %s: %w", resourceType, err)
+		}
+		for _, obj := range objs {
+			events = append(events, kine.Event{
+				Type:         kine.EventTypeDelete,
+				ResourceType: resourceType,
+				ResourceID:   orphanID(obj),
+				OldValue:     obj,
+			})
+		}
+	}
+	events, err := e.keepUnreferenced(events)
+	if err != nil {
+		return nil, err
+	}
+	for i, event := range events {
+		events[i].Sequence = i
+		report.Orphans = append(report.Orphans, Orphan{
+			ResourceType: event.ResourceType,
+			ResourceID:   event.ResourceID,
+			Labels:       kine.KineLabelIndexer.GetLabels(event.OldValue),
+		})
+		log.Info("found orphaned resource", "resourceType", event.ResourceType, "resourceID", event.ResourceID)
+	}
+	if !deleteOrphans || len(events) == 0 {
+		return report, nil
+	}
+
+	log.Info("deleting orphaned resources", "totalEvents", len(events))
+	if err := e.applyEvents(ctx, log, events); err != nil {
+		return nil, err
+	}
+	report.Deleted = true
+	return report, nil
+}
+
+// keepUnreferenced drops the orphan deletions of services and upstreams
+// referenced by a route or service that is not itself deleted, including
+// upstreams referenced from their plugin configs, and of protected global
+// rules
+func (e *KindExecutor) keepUnreferenced(events []kine.Event) ([]kine.Event, error) {
+	deleted := make(map[string]bool, len(events))
+	for _, event := range events {
+		deleted[string(event.ResourceType)+"/"+event.ResourceID] = true
+	}
+	referenced := make(map[string]bool)
+	reference := func(resourceType kine.ResourceType, id *string) {
+		if id != nil {
+			referenced[string(resourceType)+"/"+*id] = true
+		}
+	}
+	referencePlugins := func(plugins map[string]any) {
+		for plugin, config := range plugins {
+			extract, ok := kine.PluginReferences[plugin]
+			if !ok {
+				continue
+			}
+			for _, ref := range extract(config) {
+				if ref.Kind == kine.ReferenceUpstream {
+					reference(kine.ResourceTypeUpstream, &ref.ID)
+				}
+			}
+		}
+	}
+	routes, err := e.cache.ListRoutes(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	for _, route := range routes {
+		if !deleted[string(kine.ResourceTypeRoute)+"/"+route.ID] {
+			reference(kine.ResourceTypeService, route.ServiceID)
+			reference(kine.ResourceTypeUpstream, route.UpstreamID)
+			referencePlugins(route.Plugins)
+		}
+	}
+	services, err := e.cache.ListServices(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, service := range services {
+		if !deleted[string(kine.ResourceTypeService)+"/"+service.ID] || referenced[string(kine.ResourceTypeService)+"/"+service.ID] {
+			reference(kine.ResourceTypeUpstream, service.UpstreamID)
+			referencePlugins(service.Plugins)
+		}
+	}
+
+	return slices.DeleteFunc(events, func(event kine.Event) bool {
+		if event.ResourceType == kine.ResourceTypeGlobalRule && slices.Contains(e.opts.ProtectedGlobalRules, event.ResourceID) {
+			return true
+		}
+		return referenced[string(event.ResourceType)+"/"+event.ResourceID]
+	}), nil
+}
+
+// orphanID returns the ID of a cached object
+func orphanID(obj any) string {
+	switch t := obj.(type) {
+	case *kine.Route:
+		return t.ID
+	case *kine.Service:
+		return t.ID
+	case *kine.Upstream:
+		return t.ID
+	case *kine.SSL:
+		return t.ID
+	case *kine.GlobalRule:
+		return t.ID
+	case *kine.Proto:
+		return t.ID
+	case *kine.PluginMetadata:
+		return t.ID
+	default:
+		return ""
+	}
+}
+
+// runOrphanScanLoop reports, and deletes with DeleteOrphans, the orphaned
+// resources every interval until ctx is done
+func (e *KindExecutor) runOrphanScanLoop(ctx context.Context, interval time.Duration) {
+	ticker := e.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			report, err := e.CleanupOrphans(ctx, e.opts.DeleteOrphans)
+			if err != nil {
+				e.log.Error(err, "failed to clean up orphaned resources")
+				continue
+			}
+			if len(report.Orphans) > 0 && !report.Deleted {
+				e.log.Info("orphaned resources kept, deletion is disabled", "count", len(report.Orphans))
+			}
+		}
+	}
+}
+
+// OrphansHandler reports the orphaned resources as JSON on GET requests.
+// POST requests with the delete=true query parameter also delete them,
+// other POST requests are dry runs.
+func (e *KindExecutor) OrphansHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deleteOrphans bool
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if value := r.URL.Query().Get("delete"); value != "" {
+				var err error
+				if deleteOrphans, err = strconv.ParseBool(value); err != nil {
+					http.Error(w, fmt.Sprintf("invalid delete parameter: %v", err), http.StatusBadRequest)
+					return
+				}
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := e.CleanupOrphans(r.Context(), deleteOrphans)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeCanonicalJSON(w, report)
+	})
+}
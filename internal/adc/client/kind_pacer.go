@@ -0,0 +1,291 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	pkgmetrics "github.com/apache/apisix-ingress-controller/pkg/metrics"
+)
+
+// eventPacer queues adapter events, coalescing successive events of a key
+// within the debounce window and emitting them at a bounded rate, so that
+// churn storms do not make the gateway reload its configuration for every
+// single update.
+//
+// Coalescing never moves an event ahead of the events queued before it,
+// which it may depend on, such as a route update on the creation of its new
+// service. An event only merges into the queued event of its key in place
+// when nothing was queued after that one. Otherwise a queued update of the
+// key is cancelled and the merged event is queued last, while queued adds
+// and deletes, which later events may depend on in turn, stay and the event
+// is queued after them.
+type eventPacer struct {
+	log    logr.Logger
+	clock  clock.WithTicker
+	out    func() chan<- []*adapter.Event
+	rate   float64
+	burst  int
+	window time.Duration
+
+	mu sync.Mutex
+	// queue holds the pending events in emission order, nil for events
+	// cancelled by coalescing
+	queue []*adapter.Event
+	// index maps keys to their position in queue
+	index     map[string]int
+	coalesced int
+
+	tokens   float64
+	refilled time.Time
+	wake     chan struct{}
+	// onDrain is called once the queue is emptied, nil if none
+	onDrain func()
+}
+
+func newEventPacer(log logr.Logger, clk clock.WithTicker, out func() chan<- []*adapter.Event, rate float64, burst int, window time.Duration) *eventPacer {
+	if burst < 1 {
+		burst = 1
+	}
+	return &eventPacer{
+		log:      log,
+		clock:    clk,
+		out:      out,
+		rate:     rate,
+		burst:    burst,
+		window:   window,
+		index:    make(map[string]int),
+		tokens:   float64(burst),
+		refilled: clk.Now(),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// enqueue adds events to the queue, coalescing them with queued events of
+// the same keys
+func (p *eventPacer) enqueue(events []*adapter.Event) {
+	p.enqueueNotify(events, nil)
+}
+
+// enqueueNotify enqueues events and calls onDrain, if not nil, once they
+// and every event queued before them were emitted. It replaces the onDrain
+// of earlier calls, which the new one covers.
+func (p *eventPacer) enqueueNotify(events []*adapter.Event, onDrain func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if onDrain != nil {
+		p.onDrain = onDrain
+	}
+
+	coalesced := 0
+	for _, ev := range events {
+		pos, ok := p.index[ev.Key]
+		switch {
+		case !ok:
+			p.push(ev)
+			continue
+		case pos == len(p.queue)-1:
+			merged := mergeEvents(p.queue[pos], ev)
+			if merged == nil {
+				// An add followed by a delete never reaches the adapter
+				delete(p.index, ev.Key)
+				p.queue = p.queue[:pos]
+				p.trim()
+				coalesced += 2
+				continue
+			}
+			p.queue[pos] = merged
+		case p.queue[pos].Type == adapter.EventUpdate:
+			merged := mergeEvents(p.queue[pos], ev)
+			p.queue[pos] = nil
+			p.push(merged)
+		default:
+			p.push(ev)
+			continue
+		}
+		coalesced++
+	}
+	if coalesced > 0 {
+		p.coalesced += coalesced
+		pkgmetrics.RecordCoalescedEvents(coalesced)
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *eventPacer) push(ev *adapter.Event) {
+	p.index[ev.Key] = len(p.queue)
+	p.queue = append(p.queue, ev)
+}
+
+// trim drops the cancelled events at the end of the queue, so that its last
+// event is a pending one
+func (p *eventPacer) trim() {
+	for len(p.queue) > 0 && p.queue[len(p.queue)-1] == nil {
+		p.queue = p.queue[:len(p.queue)-1]
+	}
+}
+
+// mergeEvents returns the event equivalent to prev followed by next on the
+// same key, nil when they cancel out
+func mergeEvents(prev, next *adapter.Event) *adapter.Event {
+	switch {
+	case prev == nil:
+		return next
+	case next.Type == adapter.EventDelete:
+		if prev.Type == adapter.EventAdd {
+			return nil
+		}
+		return next
+	case prev.Type == adapter.EventAdd:
+		// The key is still unknown to the adapter
+		return &adapter.Event{Key: next.Key, Value: next.Value, Type: adapter.EventAdd}
+	default:
+		// Updates of missing keys fall back to creates in the adapter
+		return &adapter.Event{Key: next.Key, Value: next.Value, Type: adapter.EventUpdate}
+	}
+}
+
+// pending returns the number of queued events
+func (p *eventPacer) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, ev := range p.queue {
+		if ev != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// run emits the queued events until ctx is done. Events still queued then
+// are dropped, the cache keeps the state for the next resync.
+func (p *eventPacer) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			if n := p.pending(); n > 0 {
+				p.log.Info("dropping paced etcd adapter events", "count", n)
+			}
+			return
+		case <-p.wake:
+		}
+
+		// Let successive events of the same keys coalesce
+		if p.window > 0 {
+			select {
+			case <-ctx.Done():
+				continue
+			case <-p.clock.After(p.window):
+			}
+		}
+
+		for {
+			batch, wait := p.take()
+			if len(batch) > 0 {
+				select {
+				case p.out() <- batch:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if len(batch) == 0 && wait == 0 {
+				if onDrain := p.drained(); onDrain != nil {
+					onDrain()
+				}
+				break
+			}
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-p.clock.After(wait):
+				}
+			}
+		}
+	}
+}
+
+// drained returns the pending onDrain callback when the queue is empty,
+// clearing it
+func (p *eventPacer) drained() func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ev := range p.queue {
+		if ev != nil {
+			return nil
+		}
+	}
+	onDrain := p.onDrain
+	p.onDrain = nil
+	return onDrain
+}
+
+// take removes the events the rate limit allows from the head of the
+// queue. When it allows none, it returns how long to wait for a token.
+func (p *eventPacer) take() ([]*adapter.Event, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	queued := make([]*adapter.Event, 0, len(p.queue))
+	for _, ev := range p.queue {
+		if ev != nil {
+			queued = append(queued, ev)
+		}
+	}
+	if len(queued) == 0 {
+		p.reset(nil)
+		return nil, 0
+	}
+
+	n := len(queued)
+	if p.rate > 0 {
+		now := p.clock.Now()
+		p.tokens = math.Min(float64(p.burst), p.tokens+now.Sub(p.refilled).Seconds()*p.rate)
+		p.refilled = now
+		if p.tokens < 1 {
+			p.reset(queued)
+			return nil, time.Duration((1 - p.tokens) / p.rate * float64(time.Second))
+		}
+		n = min(n, int(p.tokens))
+		p.tokens -= float64(n)
+	}
+	p.reset(queued[n:])
+	return queued[:n], 0
+}
+
+// reset replaces the queue with events, rebuilding the index
+func (p *eventPacer) reset(events []*adapter.Event) {
+	p.queue = nil
+	p.index = make(map[string]int, len(events))
+	for _, ev := range events {
+		p.push(ev)
+	}
+}
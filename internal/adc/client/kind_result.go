@@ -0,0 +1,179 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	adctypes "github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// SyncResult is the outcome of a sync, for callers to tell a sync with
+// nothing to do from one applying changes or reporting warnings
+type SyncResult struct {
+	SyncID string
+	// Events counts the events of the sync by event type and resource
+	// type. Failed syncs count none.
+	Events map[kine.EventType]map[kine.ResourceType]int
+	// Warnings lists resources skipped or altered by the transfer, the
+	// detected route conflicts and the resources excluded by the type
+	// filter
+	Warnings []string
+	// Excluded counts the resources present in the input but left out by
+	// the type filter, per resource type
+	Excluded map[kine.ResourceType]int
+	// Phases holds the time spent in each phase of the sync by name:
+	// parseArgs, transfer, diff, applyCache and send
+	Phases map[string]time.Duration
+	// Duration is the time spent in the whole sync
+	Duration time.Duration
+	// Sent reports whether events were sent to the etcd adapter, or queued
+	// for it when events are paced
+	Sent bool
+}
+
+// Count returns the number of events of the given type
+func (r *SyncResult) Count(eventType kine.EventType) int {
+	count := 0
+	for _, n := range r.Events[eventType] {
+		count += n
+	}
+	return count
+}
+
+// Total returns the number of events of the sync, zero when it had
+// nothing to do
+func (r *SyncResult) Total() int {
+	total := 0
+	for eventType := range r.Events {
+		total += r.Count(eventType)
+	}
+	return total
+}
+
+// syncRecorderKey is the context key of the syncRecorder of a sync
+type syncRecorderKey struct{}
+
+// syncRecorder times the phases of a sync and records whether it sent
+// events. Phases are entered by startSpan and last until the next one.
+type syncRecorder struct {
+	now    func() time.Time
+	start  time.Time
+	phase  string
+	since  time.Time
+	phases map[string]time.Duration
+	sent   bool
+}
+
+// withSyncRecorder records the phases of the sync run with the returned
+// context
+func (e *KindExecutor) withSyncRecorder(ctx context.Context) (context.Context, *syncRecorder) {
+	now := e.clock.Now
+	recorder := &syncRecorder{now: now, start: now(), phases: make(map[string]time.Duration)}
+	return context.WithValue(ctx, syncRecorderKey{}, recorder), recorder
+}
+
+// recordPhase ends the running phase of the sync run with ctx, if any, and
+// starts the one of the span name, without its prefix
+func recordPhase(ctx context.Context, span string) {
+	if recorder, ok := ctx.Value(syncRecorderKey{}).(*syncRecorder); ok {
+		recorder.finish()
+		recorder.phase = strings.TrimPrefix(span, "kine.")
+		recorder.since = recorder.now()
+	}
+}
+
+// recordSent marks the sync run with ctx as having sent events
+func recordSent(ctx context.Context) {
+	if recorder, ok := ctx.Value(syncRecorderKey{}).(*syncRecorder); ok {
+		recorder.sent = true
+	}
+}
+
+// finish ends the running phase, if any
+func (r *syncRecorder) finish() {
+	if r.phase != "" {
+		r.phases[r.phase] += r.now().Sub(r.since)
+		r.phase = ""
+	}
+}
+
+// result returns the SyncResult of a finished sync
+func (r *syncRecorder) result(syncID string, result *syncResult, err error) *SyncResult {
+	r.finish()
+	res := &SyncResult{
+		SyncID:   syncID,
+		Events:   make(map[kine.EventType]map[kine.ResourceType]int),
+		Warnings: append(result.warningMessages(), result.excludedMessages()...),
+		Excluded: result.excluded,
+		Phases:   r.phases,
+		Duration: r.now().Sub(r.start),
+		Sent:     r.sent,
+	}
+	if err == nil {
+		for _, event := range result.events {
+			if res.Events[event.Type] == nil {
+				res.Events[event.Type] = make(map[kine.ResourceType]int)
+			}
+			res.Events[event.Type][event.ResourceType]++
+		}
+	}
+	return res
+}
+
+// SyncResources runs the sync described by args like Execute and returns
+// its result, also when it failed. The result of the last sync is kept for
+// GetLastResult, and a record of the recent ones for GetRecentSyncs.
+func (e *KindExecutor) SyncResources(ctx context.Context, config adctypes.Config, args []string) (*SyncResult, error) {
+	// The sync ID correlates the events and log lines of one sync
+	syncID := uuid.NewString()
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	ctx, span := e.startSpan(ctx, spanExecute)
+	if span != nil {
+		span.SetAttributes(attrSyncID.String(syncID))
+	}
+	ctx, recorder := e.withSyncRecorder(ctx)
+	result := &syncResult{}
+	applied, err := e.runKindSync(ctx, syncID, config, args, result)
+	e.stats.record(syncID, applied, result.warningMessages(), err)
+	e.recordStatus(syncID, result, err)
+	setSelectorAttributes(span, result.labels)
+	setEventAttributes(span, result.events)
+	endSpan(span, err)
+
+	res := recorder.result(syncID, result, err)
+	e.resultMu.Lock()
+	e.lastResult = res
+	e.resultMu.Unlock()
+	e.recordHistory(res, recorder.start, result, err)
+	return res, err
+}
+
+// GetLastResult returns the result of the last sync run by Execute or
+// SyncResources, nil before the first one
+func (e *KindExecutor) GetLastResult() *SyncResult {
+	e.resultMu.Lock()
+	defer e.resultMu.Unlock()
+	return e.lastResult
+}
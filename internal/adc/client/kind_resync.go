@@ -0,0 +1,294 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+	"github.com/google/uuid"
+	"github.com/k3s-io/kine/pkg/server"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+)
+
+// adapterStore is implemented by adapters whose contents can be read back.
+// Resyncs compare them with the cache to repair drift.
+type adapterStore interface {
+	// List returns the values of the keys under prefix
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+}
+
+// etcdAdapter exposes the backend of the etcd adapter for resyncs
+type etcdAdapter struct {
+	adapter.Adapter
+
+	backend server.Backend
+}
+
+func (a *etcdAdapter) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	_, kvs, err := a.backend.List(ctx, prefix, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(kvs))
+	for _, kv := range kvs {
+		values[kv.Key] = kv.Value
+	}
+	return values, nil
+}
+
+// runResyncLoop resyncs the adapter with the cache every interval until ctx
+// is done
+func (e *KindExecutor) runResyncLoop(ctx context.Context, interval time.Duration) {
+	ticker := e.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := e.resync(ctx); err != nil {
+				e.log.Error(err, "failed to resync etcd adapter")
+			}
+		}
+	}
+}
+
+// resync repairs adapter keys that drifted from the cache, which holds the
+// last desired state: missing or modified keys are rewritten and unknown keys
+// of the managed resource types are deleted. The cycle is skipped while a
+// sync is in flight.
+func (e *KindExecutor) resync(ctx context.Context) error {
+	store, ok := e.adapter.(adapterStore)
+	if !ok {
+		return fmt.Errorf("etcd adapter %T does not support resync", e.adapter)
+	}
+	if !e.syncMu.TryLock() {
+		e.log.V(1).Info("sync in flight, skipping resync")
+		return nil
+	}
+	defer e.syncMu.Unlock()
+	if e.pacer != nil && e.pacer.pending() > 0 {
+		e.log.V(1).Info("paced events pending, skipping resync")
+		return nil
+	}
+
+	syncID := uuid.NewString()
+	log := e.log.WithValues("syncID", syncID)
+
+	desired, err := e.cachedValues()
+	if err != nil {
+		return err
+	}
+	// Tombstones are kept until the janitor deletes them
+	for _, key := range e.tombstones.pending() {
+		desired[key] = tombstoneValue
+	}
+	_, apisixKeyPrefix := getConfig()
+	actual := make(map[string][]byte)
+	for _, resourceType := range kine.ResourceTypes {
+		values, err := store.List(ctx, fmt.Sprintf("%s/%s/", apisixKeyPrefix, resourceType.KeySegment()))
+		if err != nil {
+			return fmt.Errorf("%w: failed to list %s: %w", ErrBackendUnavailable, resourceType, err)
+		}
+		for key, value := range values {
+			actual[key] = value
+		}
+	}
+
+	var events []*adapter.Event
+	for key, value := range desired {
+		if current, ok := actual[key]; !ok || !bytes.Equal(current, value) {
+			// Updates of missing keys fall back to creates in the adapter
+			events = append(events, &adapter.Event{Key: key, Value: value, Type: adapter.EventUpdate})
+		}
+	}
+	for key := range actual {
+		if _, ok := desired[key]; !ok {
+			events = append(events, &adapter.Event{Key: key, Type: adapter.EventDelete})
+		}
+	}
+	if len(events) == 0 {
+		log.V(1).Info("etcd adapter in sync with cache")
+		return nil
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return strings.Compare(events[i].Key, events[j].Key) < 0
+	})
+
+	log.Info("repairing etcd adapter drift", "count", len(events))
+	select {
+	case e.adapter.EventCh() <- events:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: failed to send events: %w", ErrBackendUnavailable, ctx.Err())
+	}
+	e.sendSecondary(ctx, log, events)
+	return nil
+}
+
+// RepublishAll sends every cached object to the etcd adapter as an add
+// event, so that a late connecting or restarted gateway, or an adapter
+// that lost its data, gets the full state again. Adds of existing keys
+// overwrite them with the same value. The etcd adapter does not report new
+// watchers or compactions, so callers trigger it explicitly.
+func (e *KindExecutor) RepublishAll(ctx context.Context) error {
+	if e.opts.DiffOnly {
+		return errors.New("diff-only executor has no etcd adapter to republish to")
+	}
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
+	values, err := e.cachedValues()
+	if err != nil {
+		return err
+	}
+	events := make([]*adapter.Event, 0, len(values))
+	for key, value := range values {
+		events = append(events, &adapter.Event{Key: key, Value: value, Type: adapter.EventAdd})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return strings.Compare(events[i].Key, events[j].Key) < 0
+	})
+
+	e.log.Info("republishing cached state to etcd adapter", "count", len(events))
+	select {
+	case e.adapter.EventCh() <- events:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: failed to send events: %w", ErrBackendUnavailable, ctx.Err())
+	}
+	e.sendSecondary(ctx, e.log, events)
+	return nil
+}
+
+// RepublishHandler republishes the cached state on POST requests, to
+// recover from adapter data loss
+func (e *KindExecutor) RepublishHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := e.RepublishAll(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// cachedValues returns the adapter keys and canonical values of the cached
+// resources
+func (e *KindExecutor) cachedValues() (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	add := func(resourceType kine.ResourceType, id string, obj any) error {
+		value, err := kine.CanonicalJSON(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s: %w", resourceType, id, err)
+		}
+		values[adapterKey(resourceType, id)] = value
+		return nil
+	}
+
+	routes, err := e.cache.ListRoutes(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	for _, route := range routes {
+		if err := add(kine.ResourceTypeRoute, route.ID, route); err != nil {
+			return nil, err
+		}
+	}
+	services, err := e.cache.ListServices(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, service := range services {
+		if err := add(kine.ResourceTypeService, service.ID, service); err != nil {
+			return nil, err
+		}
+	}
+	upstreams, err := e.cache.ListUpstreams(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+	for _, upstream := range upstreams {
+		if err := add(kine.ResourceTypeUpstream, upstream.ID, upstream); err != nil {
+			return nil, err
+		}
+	}
+	ssls, err := e.cache.ListSSL(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssls: %w", err)
+	}
+	for _, ssl := range ssls {
+		if err := add(kine.ResourceTypeSSL, ssl.ID, ssl); err != nil {
+			return nil, err
+		}
+	}
+	globalRules, err := e.cache.ListGlobalRules(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list global rules: %w", err)
+	}
+	if e.opts.GlobalRuleMode == GlobalRuleAggregated {
+		aggregated, err := e.aggregatedGlobalRule(nil)
+		if err != nil {
+			return nil, err
+		}
+		globalRules = nil
+		if aggregated != nil {
+			globalRules = append(globalRules, aggregated)
+		}
+	}
+	for _, globalRule := range globalRules {
+		if err := add(kine.ResourceTypeGlobalRule, globalRule.ID, globalRule); err != nil {
+			return nil, err
+		}
+	}
+	protos, err := e.cache.ListProtos(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list protos: %w", err)
+	}
+	for _, proto := range protos {
+		if err := add(kine.ResourceTypeProto, proto.ID, proto); err != nil {
+			return nil, err
+		}
+	}
+	pluginMetadata, err := e.cache.ListPluginMetadata(kine.WithoutCopy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugin metadata: %w", err)
+	}
+	for _, metadata := range pluginMetadata {
+		if err := add(kine.ResourceTypePluginMetadata, metadata.ID, metadata); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+	"github.com/go-logr/logr"
+)
+
+// Backend receives the event batches the KindExecutor sends to the etcd
+// adapter, as a secondary backend for migrations and comparisons. It must
+// not modify the events.
+type Backend interface {
+	Send(ctx context.Context, events []*adapter.Event) error
+}
+
+// FileBackendEvent is an event written by a FileBackend
+type FileBackendEvent struct {
+	// Type is ADD, UPDATE or DELETE
+	Type  string          `json:"type"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// FileBackend appends event batches to a file, one JSON array of
+// FileBackendEvent per line, to capture the event stream of a sync
+type FileBackend struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileBackend creates a Backend writing to the file at path
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+func (b *FileBackend) Send(_ context.Context, events []*adapter.Event) error {
+	batch := make([]FileBackendEvent, 0, len(events))
+	for _, event := range events {
+		batch = append(batch, FileBackendEvent{
+			Type:  adapterEventType(event.Type),
+			Key:   event.Key,
+			Value: event.Value,
+		})
+	}
+	line, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event batch: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open event file: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write event batch: %w", err)
+	}
+	return f.Close()
+}
+
+// adapterEventType returns the name of an etcd adapter event type
+func adapterEventType(t adapter.EventType) string {
+	switch t {
+	case adapter.EventAdd:
+		return "ADD"
+	case adapter.EventUpdate:
+		return "UPDATE"
+	case adapter.EventDelete:
+		return "DELETE"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", t)
+	}
+}
+
+// sendSecondary sends a batch of the etcd adapter to the secondary backend,
+// if any. Failures are logged and counted in the stats, they never fail the
+// sync.
+func (e *KindExecutor) sendSecondary(ctx context.Context, log logr.Logger, events []*adapter.Event) {
+	if e.opts.SecondaryBackend == nil || len(events) == 0 {
+		return
+	}
+	if err := e.opts.SecondaryBackend.Send(ctx, events); err != nil {
+		e.stats.recordSecondaryFailure()
+		log.Error(err, "failed to send events to secondary backend", "count", len(events))
+	}
+}
@@ -0,0 +1,207 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+// SyncStatus is the outcome of the last sync of the resources of one
+// parent resource, for controllers to report status conditions
+type SyncStatus struct {
+	SyncID string
+	Time   time.Time
+	// Succeeded is false when the sync failed with Error
+	Succeeded bool
+	Error     string
+	// Created, Updated and Deleted count the events applied by the sync
+	Created int
+	Updated int
+	Deleted int
+	// Warnings lists resources skipped or altered by the transfer and the
+	// detected route conflicts
+	Warnings []string
+}
+
+// syncResult collects what a sync did while it runs
+type syncResult struct {
+	labels    map[string]string
+	events    []kine.Event
+	warnings  []kine.TransferWarning
+	conflicts []*kine.RouteConflict
+	// references are the dangling plugin references of the synced
+	// resources
+	references []*kine.DanglingReference
+	// mismatches are the synced services embedding an upstream differing
+	// from the one they reference
+	mismatches []*kine.UpstreamMismatch
+	// excluded counts the transferred resources left out by the type
+	// filter per resource type
+	excluded map[kine.ResourceType]int
+}
+
+// warningMessages returns the transfer warnings, route conflicts, dangling
+// plugin references and upstream mismatches of the sync
+func (r *syncResult) warningMessages() []string {
+	var messages []string
+	for _, warning := range r.warnings {
+		messages = append(messages, warning.Error())
+	}
+	for _, conflict := range r.conflicts {
+		messages = append(messages, conflict.Error())
+	}
+	for _, ref := range r.references {
+		messages = append(messages, ref.Error())
+	}
+	for _, mismatch := range r.mismatches {
+		messages = append(messages, mismatch.Error())
+	}
+	return messages
+}
+
+// ErrExcludedByTypeFilter fails the syncs run with --strict-types whose
+// type filter left out resources present in the input
+var ErrExcludedByTypeFilter = fmt.Errorf("%w: resources excluded by type filter", ErrInvalidInput)
+
+// excludedMessages describes the resources excluded by the type filter, in
+// resource type order
+func (r *syncResult) excludedMessages() []string {
+	var messages []string
+	for _, resourceType := range kine.ResourceTypes {
+		if n := r.excluded[resourceType]; n > 0 {
+			messages = append(messages, fmt.Sprintf("%d %s present in input but excluded by type filter", n, resourceType))
+		}
+	}
+	return messages
+}
+
+// excludedByTypes counts the transferred resources whose type is not in
+// types, none when types is empty as every type is synced
+func excludedByTypes(resources *kine.TransferredResources, types []string) map[kine.ResourceType]int {
+	if len(types) == 0 {
+		return nil
+	}
+	excluded := resources.Counts()
+	for _, t := range types {
+		delete(excluded, kine.ResourceType(t))
+	}
+	return excluded
+}
+
+// statusRegistry keeps the last SyncStatus per label selector
+type statusRegistry struct {
+	mu       sync.RWMutex
+	statuses map[kine.KindLabelSelector]SyncStatus
+}
+
+// statusKey normalizes a selector the way the cache label index does
+func statusKey(selector kine.KindLabelSelector) kine.KindLabelSelector {
+	return kine.KindLabelSelector{
+		Kind:      strings.ToLower(strings.TrimSpace(selector.Kind)),
+		Namespace: strings.TrimSpace(selector.Namespace),
+		Name:      strings.TrimSpace(selector.Name),
+	}
+}
+
+func (r *statusRegistry) set(selector kine.KindLabelSelector, status SyncStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[kine.KindLabelSelector]SyncStatus)
+	}
+	r.statuses[statusKey(selector)] = status
+}
+
+func (r *statusRegistry) get(selector kine.KindLabelSelector) (SyncStatus, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status, ok := r.statuses[statusKey(selector)]
+	return status, ok
+}
+
+func (r *statusRegistry) evict(selector kine.KindLabelSelector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.statuses, statusKey(selector))
+}
+
+func (r *statusRegistry) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = nil
+}
+
+// selectorFromLabels returns the selector of the kind, namespace and name
+// labels of a sync
+func selectorFromLabels(labels map[string]string) kine.KindLabelSelector {
+	return kine.KindLabelSelector{
+		Kind:      labels[label.LabelKind],
+		Namespace: labels[label.LabelNamespace],
+		Name:      labels[label.LabelName],
+	}
+}
+
+// recordStatus stores the outcome of a sync under its label selector. The
+// entry is evicted instead once a successful sync left no cached resource
+// of the selector, except in diff-only mode where syncs leave the cache
+// untouched.
+func (e *KindExecutor) recordStatus(syncID string, result *syncResult, err error) {
+	if result.labels == nil {
+		return
+	}
+	selector := selectorFromLabels(result.labels)
+	if err == nil && len(result.labels) > 0 && !e.opts.DiffOnly {
+		if matched, matchErr := e.matchesCachedResources(result.labels); matchErr == nil && !matched {
+			e.statuses.evict(selector)
+			return
+		}
+	}
+
+	status := SyncStatus{
+		SyncID:    syncID,
+		Time:      e.clock.Now(),
+		Succeeded: err == nil,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	for _, event := range result.events {
+		switch event.Type {
+		case kine.EventTypeCreate:
+			status.Created++
+		case kine.EventTypeUpdate:
+			status.Updated++
+		case kine.EventTypeDelete:
+			status.Deleted++
+		}
+	}
+	status.Warnings = result.warningMessages()
+	e.statuses.set(selector, status)
+}
+
+// GetStatus returns the status of the last sync of the resources selected
+// by selector. Kinds match case-insensitively.
+func (e *KindExecutor) GetStatus(selector kine.KindLabelSelector) (SyncStatus, bool) {
+	return e.statuses.get(selector)
+}
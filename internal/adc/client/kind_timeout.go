@@ -0,0 +1,64 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// syncPhaseKey is the context key of the syncPhase of a sync
+type syncPhaseKey struct{}
+
+// syncPhase tracks the phase a sync with a timeout is running, so that
+// timeout errors name it. Phases are entered by startSpan.
+type syncPhase struct {
+	timeout time.Duration
+	name    string
+}
+
+// withSyncTimeout bounds ctx by timeout, unless zero, and tracks the phases
+// of the sync run with the returned context
+func (e *KindExecutor) withSyncTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, *syncPhase) {
+	if timeout <= 0 {
+		return ctx, func() {}, nil
+	}
+	phase := &syncPhase{timeout: timeout}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, syncPhaseKey{}, phase), timeout)
+	return ctx, cancel, phase
+}
+
+// enterPhase records the span name, without its prefix, as the phase of the
+// sync run with ctx, if it has a timeout
+func enterPhase(ctx context.Context, span string) {
+	if phase, ok := ctx.Value(syncPhaseKey{}).(*syncPhase); ok {
+		phase.name = strings.TrimPrefix(span, "kine.")
+	}
+}
+
+// annotate wraps the errors of syncs that ran out of time with the phase
+// that was running
+func (p *syncPhase) annotate(ctx context.Context, err error) error {
+	if p == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("sync timed out after %s during %s: %w", p.timeout, p.name, err)
+}
@@ -0,0 +1,193 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// certReloader serves the etcd adapter certificate and client CAs from
+// files, reloading them on SIGHUP or when the files change so that
+// rotations do not need a restart
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// newCertReloader loads the certificate, key and optional client CA files
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the files again. The previous certificates stay in use when
+// they cannot be loaded.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load adapter certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		clientCAs, err = loadCertPool(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// tlsConfig returns a server config resolving the certificates on each
+// handshake. Client certificates are required when a client CA is set.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if r.clientCAs != nil {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = r.clientCAs
+			}
+			return config, nil
+		},
+	}
+}
+
+// watch reloads the certificates on SIGHUP and on changes of their
+// directories until ctx is done. Directories are watched rather than the
+// files, since secret volumes are updated by swapping symlinks.
+func (r *certReloader) watch(ctx context.Context, log logr.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch adapter certificates: %w", err)
+	}
+	dirs := map[string]bool{}
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" || dirs[filepath.Dir(file)] {
+			continue
+		}
+		dirs[filepath.Dir(file)] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("failed to watch adapter certificates: %w", err)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		defer func() { _ = watcher.Close() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err, "adapter certificate watch failed")
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Error(err, "failed to reload adapter certificates, keeping the previous ones")
+				continue
+			}
+			log.Info("reloaded adapter certificates")
+		}
+	}()
+	return nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in CA file " + file)
+	}
+	return pool, nil
+}
+
+// AdapterClientTLSConfig returns the TLS config clients such as health
+// checks use to reach an adapter served with TLS: caFile verifies the
+// adapter certificate, and certFile and keyFile, when set, authenticate
+// the client
+func AdapterClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
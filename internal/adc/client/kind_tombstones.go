@@ -0,0 +1,192 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+)
+
+// DeletionMode is how deleted resources are removed from the etcd adapter
+type DeletionMode string
+
+const (
+	// DeletionDelete deletes the keys of deleted resources, the default
+	DeletionDelete DeletionMode = "delete"
+	// DeletionTombstone overwrites the keys of deleted resources with a
+	// tombstone value, deleted by a janitor once the tombstone grace period
+	// elapsed. Meant for gateways handling key deletions poorly while they
+	// reload their configuration.
+	DeletionTombstone DeletionMode = "tombstone"
+)
+
+// DefaultTombstoneGracePeriod is how long tombstones are kept by default
+const DefaultTombstoneGracePeriod = time.Minute
+
+// tombstoneValue is the value written to the keys of deleted resources in
+// tombstone mode
+var tombstoneValue = []byte(`{"deleted":true}`)
+
+// tombstones tracks the keys holding a tombstone since when it was written
+type tombstones struct {
+	mu      sync.Mutex
+	written map[string]time.Time
+}
+
+// tombstoneDeletes turns the delete events of adapterEvents into updates
+// writing a tombstone, in tombstone mode. Creates of keys still holding a
+// tombstone become updates too, the adapter ignores creates of existing
+// keys.
+func (e *KindExecutor) tombstoneDeletes(adapterEvents []*adapter.Event) {
+	if e.opts.DeletionMode != DeletionTombstone {
+		return
+	}
+	for _, event := range adapterEvents {
+		switch {
+		case event == nil:
+		case event.Type == adapter.EventDelete:
+			// Updates of missing keys fall back to creates in the adapter
+			event.Type, event.Value = adapter.EventUpdate, tombstoneValue
+		case event.Type == adapter.EventAdd && e.tombstones.has(event.Key):
+			event.Type = adapter.EventUpdate
+		}
+	}
+}
+
+// isTombstone reports whether an adapter event writes a tombstone
+func isTombstone(event *adapter.Event) bool {
+	return event.Type == adapter.EventUpdate && bytes.Equal(event.Value, tombstoneValue)
+}
+
+// track records the tombstones written by the sent adapter events at now,
+// and forgets those of the keys written again
+func (t *tombstones) track(adapterEvents []*adapter.Event, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, event := range adapterEvents {
+		switch {
+		case isTombstone(event):
+			if t.written == nil {
+				t.written = make(map[string]time.Time)
+			}
+			if _, ok := t.written[event.Key]; !ok {
+				t.written[event.Key] = now
+			}
+		default:
+			delete(t.written, event.Key)
+		}
+	}
+}
+
+// has reports whether key holds a tombstone
+func (t *tombstones) has(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.written[key]
+	return ok
+}
+
+// pending returns the keys holding a tombstone
+func (t *tombstones) pending() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.written))
+	for key := range t.written {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// expire forgets and returns the keys holding a tombstone written at least
+// gracePeriod before now
+func (t *tombstones) expire(now time.Time, gracePeriod time.Duration) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var keys []string
+	for key, written := range t.written {
+		if now.Sub(written) >= gracePeriod {
+			keys = append(keys, key)
+			delete(t.written, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// tombstoneGracePeriod returns how long tombstones are kept
+func (e *KindExecutor) tombstoneGracePeriod() time.Duration {
+	if e.opts.TombstoneGracePeriod > 0 {
+		return e.opts.TombstoneGracePeriod
+	}
+	return DefaultTombstoneGracePeriod
+}
+
+// runTombstoneJanitor deletes the expired tombstones every grace period
+// until ctx is done
+func (e *KindExecutor) runTombstoneJanitor(ctx context.Context) {
+	ticker := e.clock.NewTicker(e.tombstoneGracePeriod())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := e.purgeTombstones(ctx); err != nil {
+				e.log.Error(err, "failed to delete tombstones")
+			}
+		}
+	}
+}
+
+// purgeTombstones deletes the keys holding a tombstone for at least the
+// grace period. Syncs writing a key again forget its tombstone, the
+// janitor holds the sync lock so that none does in between. The cycle is
+// skipped while paced events, which may hold tombstones, are pending.
+func (e *KindExecutor) purgeTombstones(ctx context.Context) error {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	if e.pacer != nil && e.pacer.pending() > 0 {
+		e.log.V(1).Info("paced events pending, skipping tombstone deletion")
+		return nil
+	}
+	keys := e.tombstones.expire(e.clock.Now(), e.tombstoneGracePeriod())
+	if len(keys) == 0 {
+		return nil
+	}
+	events := make([]*adapter.Event, 0, len(keys))
+	for _, key := range keys {
+		events = append(events, &adapter.Event{Key: key, Type: adapter.EventDelete})
+	}
+
+	e.log.Info("deleting expired tombstones", "count", len(events))
+	select {
+	case e.adapter.EventCh() <- events:
+	case <-ctx.Done():
+		// Tombstones not deleted are deleted by the next resync
+		return ctx.Err()
+	}
+	e.sendSecondary(ctx, e.log, events)
+	return nil
+}
@@ -0,0 +1,139 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+const tracerName = "github.com/apache/apisix-ingress-controller/internal/adc/client"
+
+// Span names of the sync pipeline
+const (
+	spanExecute      = "kine.Execute"
+	spanDeleteAllFor = "kine.DeleteAllFor"
+	spanParseArgs    = "kine.parseArgs"
+	spanTransfer     = "kine.transfer"
+	spanDiff         = "kine.diff"
+	spanApplyCache   = "kine.applyCache"
+	spanSend         = "kine.send"
+)
+
+// Span attribute keys
+const (
+	attrSyncID    = attribute.Key("kine.sync_id")
+	attrKind      = attribute.Key("kine.selector.kind")
+	attrNamespace = attribute.Key("kine.selector.namespace")
+	attrName      = attribute.Key("kine.selector.name")
+	attrEvents    = attribute.Key("kine.events")
+	attrCreated   = attribute.Key("kine.events.created")
+	attrUpdated   = attribute.Key("kine.events.updated")
+	attrDeleted   = attribute.Key("kine.events.deleted")
+	attrResources = attribute.Key("kine.resources")
+	attrWarnings  = attribute.Key("kine.warnings")
+)
+
+// newTracer returns the tracer of the configured provider, nil when tracing
+// is disabled
+func newTracer(opts *KindExecutorOptions) trace.Tracer {
+	if opts.TracerProvider == nil {
+		return nil
+	}
+	return opts.TracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts a span when tracing is enabled. The returned span is nil
+// otherwise, and the helpers below accept a nil span. The span name is also
+// recorded as the phase of a sync with a timeout.
+func (e *KindExecutor) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	enterPhase(ctx, name)
+	recordPhase(ctx, name)
+	if e.tracer == nil {
+		return ctx, nil
+	}
+	return e.tracer.Start(ctx, name)
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setSelectorAttributes annotates span with the label selector of a sync
+func setSelectorAttributes(span trace.Span, labels map[string]string) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(
+		attrKind.String(labels[label.LabelKind]),
+		attrNamespace.String(labels[label.LabelNamespace]),
+		attrName.String(labels[label.LabelName]),
+	)
+}
+
+// setEventAttributes annotates span with the event counts by type
+func setEventAttributes(span trace.Span, events []kine.Event) {
+	if span == nil {
+		return
+	}
+	var created, updated, deleted int
+	for _, event := range events {
+		switch event.Type {
+		case kine.EventTypeCreate:
+			created++
+		case kine.EventTypeUpdate:
+			updated++
+		case kine.EventTypeDelete:
+			deleted++
+		}
+	}
+	span.SetAttributes(
+		attrEvents.Int(len(events)),
+		attrCreated.Int(created),
+		attrUpdated.Int(updated),
+		attrDeleted.Int(deleted),
+	)
+}
+
+// setTransferAttributes annotates span with the number of transferred
+// resources and warnings
+func setTransferAttributes(span trace.Span, resources *kine.TransferredResources) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(
+		attrResources.Int(len(resources.Routes)+len(resources.Services)+len(resources.Upstreams)+
+			len(resources.SSLs)+len(resources.GlobalRules)+len(resources.Protos)+
+			len(resources.PluginMetadata)),
+		attrWarnings.Int(len(resources.Warnings)),
+	)
+}
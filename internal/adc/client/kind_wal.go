@@ -0,0 +1,238 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/api7/etcd-adapter/pkg/adapter"
+)
+
+const (
+	// defaultWALMaxSize is the size past which the event WAL is truncated
+	// once no batch is pending
+	defaultWALMaxSize = 64 << 20
+	// walReplayTimeout bounds the replay of pending batches on startup
+	walReplayTimeout = 30 * time.Second
+	// walHeaderSize is the size of the length and checksum preceding every
+	// record
+	walHeaderSize = 8
+)
+
+// walRecord is a record of the event WAL. Batch records hold the events of
+// a batch, commit records mark every batch up to Seq as accepted by the etcd
+// adapter.
+type walRecord struct {
+	Seq    uint64           `json:"seq"`
+	Events []*adapter.Event `json:"events,omitempty"`
+	Commit bool             `json:"commit,omitempty"`
+}
+
+// eventWAL is a write-ahead log of the batches sent to the etcd adapter.
+// Batches are appended before the cache changes they come from and marked
+// once the adapter accepted them, so that the batches of a process that
+// crashed in between can be sent again on the next start. Adds and updates
+// are upserts and deletes of missing keys are no-ops, so replaying a batch
+// the adapter already got is harmless.
+//
+// Records are a big endian payload length and CRC-32 checksum followed by
+// the JSON payload. A torn or corrupted record ends the log: it and the
+// records after it are ignored.
+type eventWAL struct {
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// seq is the sequence number of the last appended batch
+	seq uint64
+}
+
+// openEventWAL opens the WAL at path, creating it if needed, and returns it
+// with the batches that were never marked as accepted, in append order
+func openEventWAL(path string, maxSize int64) (*eventWAL, [][]*adapter.Event, error) {
+	if maxSize <= 0 {
+		maxSize = defaultWALMaxSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open event WAL: %w", err)
+	}
+	records, size, err := readWALRecords(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("failed to read event WAL %s: %w", path, err)
+	}
+	w := &eventWAL{maxSize: maxSize, file: file}
+	var committed uint64
+	for _, record := range records {
+		w.seq = max(w.seq, record.Seq)
+		if record.Commit {
+			committed = max(committed, record.Seq)
+		}
+	}
+	var pending [][]*adapter.Event
+	for _, record := range records {
+		if !record.Commit && record.Seq > committed && len(record.Events) > 0 {
+			pending = append(pending, record.Events)
+		}
+	}
+	// Drop the corrupted tail, so that new records are not appended after it
+	if err := file.Truncate(size); err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("failed to truncate event WAL: %w", err)
+	}
+	w.size = size
+	return w, pending, nil
+}
+
+// readWALRecords reads the records of r up to the first invalid one and
+// returns them with the size of the valid prefix
+func readWALRecords(r io.Reader) ([]walRecord, int64, error) {
+	reader := bufio.NewReader(r)
+	var (
+		records []walRecord
+		size    int64
+		header  [walHeaderSize]byte
+	)
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, size, nil
+			}
+			return nil, 0, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, size, nil
+			}
+			return nil, 0, err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return records, size, nil
+		}
+		var record walRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return records, size, nil
+		}
+		records = append(records, record)
+		size += walHeaderSize + int64(length)
+	}
+}
+
+// append logs a batch and returns its sequence number, once synced to disk
+func (w *eventWAL) append(events []*adapter.Event) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	if err := w.write(walRecord{Seq: w.seq, Events: events}); err != nil {
+		return 0, fmt.Errorf("failed to append to event WAL: %w", err)
+	}
+	return w.seq, nil
+}
+
+// commit marks the batches up to seq as accepted by the etcd adapter. The
+// log is truncated when it outgrew its maximum size and no later batch is
+// pending.
+func (w *eventWAL) commit(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq == w.seq && w.size >= w.maxSize {
+		return w.truncate()
+	}
+	if err := w.write(walRecord{Seq: seq, Commit: true}); err != nil {
+		return fmt.Errorf("failed to commit event WAL: %w", err)
+	}
+	return nil
+}
+
+// reset empties the log, once its pending batches were replayed
+func (w *eventWAL) reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.truncate()
+}
+
+func (w *eventWAL) truncate() error {
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate event WAL: %w", err)
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+func (w *eventWAL) write(record walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	n, err := w.file.Write(buf)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *eventWAL) Close() error {
+	return w.file.Close()
+}
+
+// startWAL opens the event WAL and sends the batches left pending by the
+// previous process to the etcd adapter before truncating it
+func (e *KindExecutor) startWAL(ctx context.Context) error {
+	wal, pending, err := openEventWAL(e.opts.WALPath, e.opts.WALMaxSize)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		e.log.Info("replaying etcd adapter batches from event WAL", "batches", len(pending))
+		ctx, cancel := context.WithTimeout(ctx, walReplayTimeout)
+		defer cancel()
+		for _, events := range pending {
+			select {
+			case e.adapter.EventCh() <- events:
+			case <-ctx.Done():
+				_ = wal.Close()
+				return fmt.Errorf("failed to replay event WAL: %w", ctx.Err())
+			}
+		}
+	}
+	if err := wal.reset(); err != nil {
+		_ = wal.Close()
+		return err
+	}
+	e.wal = wal
+	return nil
+}
@@ -0,0 +1,581 @@
+package kine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// labelBucketSuffix is appended to a table name to form the bucket holding
+// its label index. Keys in that bucket are the label index key followed by
+// the object ID, values are empty.
+const labelBucketSuffix = ".label"
+
+// boltCache implements Cache on top of a bbolt database file, so that the
+// cached state survives restarts. Objects are stored JSON-encoded with one
+// bucket per table.
+type boltCache struct {
+	boltReader
+
+	db *bolt.DB
+}
+
+// boltReader implements ReadTxn on top of a view function, which runs each
+// read in its own read transaction for the cache and in the same one within
+// Read
+type boltReader struct {
+	view func(fn func(*bolt.Tx) error) error
+}
+
+// NewBoltCache creates a Cache object persisted in the bbolt database at path
+func NewBoltCache(path string) (Cache, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, resourceType := range ResourceTypes {
+			table := resourceType.TableName()
+			if _, err := tx.CreateBucketIfNotExists([]byte(table)); err != nil {
+				return err
+			}
+			if err := reindexLabels(tx, table); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(revisionTable)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(inputHashTable))
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create bolt buckets: %w", err)
+	}
+	return &boltCache{
+		boltReader: boltReader{view: db.View},
+		db:         db,
+	}, nil
+}
+
+// Close releases the underlying database file
+func (c *boltCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *boltCache) Insert(obj any) error {
+	switch t := obj.(type) {
+	case *Route:
+		return c.InsertRoute(t)
+	case *Service:
+		return c.InsertService(t)
+	case *Upstream:
+		return c.InsertUpstream(t)
+	case *SSL:
+		return c.InsertSSL(t)
+	case *GlobalRule:
+		return c.InsertGlobalRule(t)
+	case *Proto:
+		return c.InsertProto(t)
+	case *PluginMetadata:
+		return c.InsertPluginMetadata(t)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, obj)
+	}
+}
+
+// InsertOwned is Insert, bolt stores a serialized copy anyway
+func (c *boltCache) InsertOwned(obj any) error {
+	return c.Insert(obj)
+}
+
+func (c *boltCache) Delete(obj any) error {
+	switch t := obj.(type) {
+	case *Route:
+		return c.DeleteRoute(t)
+	case *Service:
+		return c.DeleteService(t)
+	case *Upstream:
+		return c.DeleteUpstream(t)
+	case *SSL:
+		return c.DeleteSSL(t)
+	case *GlobalRule:
+		return c.DeleteGlobalRule(t)
+	case *Proto:
+		return c.DeleteProto(t)
+	case *PluginMetadata:
+		return c.DeletePluginMetadata(t)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, obj)
+	}
+}
+
+// Insert methods
+func (c *boltCache) InsertRoute(r *Route) error {
+	return c.insert("route", r.ID, r)
+}
+
+func (c *boltCache) InsertService(s *Service) error {
+	return c.insert("service", s.ID, s)
+}
+
+func (c *boltCache) InsertUpstream(u *Upstream) error {
+	return c.insert("upstream", u.ID, u)
+}
+
+func (c *boltCache) InsertSSL(ssl *SSL) error {
+	return c.insert("ssl", ssl.ID, ssl)
+}
+
+func (c *boltCache) InsertGlobalRule(gr *GlobalRule) error {
+	return c.insert("global_rule", gr.ID, gr)
+}
+
+func (c *boltCache) InsertProto(p *Proto) error {
+	return c.insert("proto", p.ID, p)
+}
+
+func (c *boltCache) InsertPluginMetadata(m *PluginMetadata) error {
+	return c.insert("plugin_metadata", m.ID, m)
+}
+
+func (c *boltCache) insert(table, id string, obj any) error {
+	if id == "" {
+		return fmt.Errorf("%w: %s without id", ErrInvalidInput, table)
+	}
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object: %w", err)
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(table))
+		labels := tx.Bucket([]byte(table + labelBucketSuffix))
+
+		// Drop the label entry of the previous version, labels may have changed
+		if old := bucket.Get([]byte(id)); old != nil {
+			if err := deleteLabelEntry(labels, table, id, old); err != nil {
+				return err
+			}
+		}
+		if err := bucket.Put([]byte(id), value); err != nil {
+			return err
+		}
+		if err := updateBoltRevision(tx, table, id, obj); err != nil {
+			return err
+		}
+		ok, key, err := KineLabelIndexer.FromObject(obj)
+		if err != nil || !ok {
+			return err
+		}
+		return labels.Put(append(key, id...), nil)
+	})
+}
+
+func (c *boltCache) Read(fn func(ReadTxn) error) error {
+	return c.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltReader{view: func(view func(*bolt.Tx) error) error { return view(tx) }})
+	})
+}
+
+// Get methods
+func (r *boltReader) GetRoute(id string) (*Route, error) {
+	route := &Route{}
+	if err := r.get("route", id, route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+func (r *boltReader) GetService(id string) (*Service, error) {
+	service := &Service{}
+	if err := r.get("service", id, service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func (r *boltReader) GetUpstream(id string) (*Upstream, error) {
+	upstream := &Upstream{}
+	if err := r.get("upstream", id, upstream); err != nil {
+		return nil, err
+	}
+	return upstream, nil
+}
+
+func (r *boltReader) GetSSL(id string) (*SSL, error) {
+	ssl := &SSL{}
+	if err := r.get("ssl", id, ssl); err != nil {
+		return nil, err
+	}
+	return ssl, nil
+}
+
+func (r *boltReader) GetGlobalRule(id string) (*GlobalRule, error) {
+	globalRule := &GlobalRule{}
+	if err := r.get("global_rule", id, globalRule); err != nil {
+		return nil, err
+	}
+	return globalRule, nil
+}
+
+func (r *boltReader) GetProto(id string) (*Proto, error) {
+	proto := &Proto{}
+	if err := r.get("proto", id, proto); err != nil {
+		return nil, err
+	}
+	return proto, nil
+}
+
+func (r *boltReader) GetPluginMetadata(id string) (*PluginMetadata, error) {
+	pluginMetadata := &PluginMetadata{}
+	if err := r.get("plugin_metadata", id, pluginMetadata); err != nil {
+		return nil, err
+	}
+	return pluginMetadata, nil
+}
+
+func (r *boltReader) get(table, id string, out any) error {
+	return r.view(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(table)).Get([]byte(id))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, out)
+	})
+}
+
+// List methods
+func (r *boltReader) ListRoutes(opts ...ListOption) ([]*Route, error) {
+	return boltList[Route](r, "route", opts...)
+}
+
+func (r *boltReader) ListServices(opts ...ListOption) ([]*Service, error) {
+	return boltList[Service](r, "service", opts...)
+}
+
+func (r *boltReader) ListUpstreams(opts ...ListOption) ([]*Upstream, error) {
+	return boltList[Upstream](r, "upstream", opts...)
+}
+
+func (r *boltReader) ListSSL(opts ...ListOption) ([]*SSL, error) {
+	return boltList[SSL](r, "ssl", opts...)
+}
+
+func (r *boltReader) ListGlobalRules(opts ...ListOption) ([]*GlobalRule, error) {
+	return boltList[GlobalRule](r, "global_rule", opts...)
+}
+
+func (r *boltReader) ListProtos(opts ...ListOption) ([]*Proto, error) {
+	return boltList[Proto](r, "proto", opts...)
+}
+
+func (r *boltReader) ListPluginMetadata(opts ...ListOption) ([]*PluginMetadata, error) {
+	return boltList[PluginMetadata](r, "plugin_metadata", opts...)
+}
+
+// ListByName methods
+func (r *boltReader) ListRoutesByName(name string, opts ...ListOption) ([]*Route, error) {
+	return r.ListRoutes(append(opts, WithName(name))...)
+}
+
+func (r *boltReader) ListServicesByName(name string, opts ...ListOption) ([]*Service, error) {
+	return r.ListServices(append(opts, WithName(name))...)
+}
+
+func (r *boltReader) ListUpstreamsByName(name string, opts ...ListOption) ([]*Upstream, error) {
+	return r.ListUpstreams(append(opts, WithName(name))...)
+}
+
+func (r *boltReader) ListSSLByName(name string, opts ...ListOption) ([]*SSL, error) {
+	return r.ListSSL(append(opts, WithName(name))...)
+}
+
+// ListRoutesByHost decodes every candidate route, hosts are not indexed
+func (r *boltReader) ListRoutesByHost(host string, opts ...ListOption) ([]*Route, error) {
+	keys := hostLookupKeys(host)
+	var routes []*Route
+	err := r.ForEachRoute(func(route *Route) bool {
+		if routeMatchesHost(route, keys) {
+			routes = append(routes, route)
+		}
+		return true
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// ForEach methods
+func (r *boltReader) ForEachRoute(fn func(*Route) bool, opts ...ListOption) error {
+	return r.forEach("route", func(value []byte) (bool, error) {
+		route := &Route{}
+		if err := json.Unmarshal(value, route); err != nil {
+			return false, err
+		}
+		return fn(route), nil
+	}, opts...)
+}
+
+// boltList decodes every object of a table matching the list options.
+// Decoded objects are always fresh, so WithoutCopy has no effect here.
+func boltList[T any](r *boltReader, table string, opts ...ListOption) ([]*T, error) {
+	var objs []*T
+	err := r.forEach(table, func(value []byte) (bool, error) {
+		obj := new(T)
+		if err := json.Unmarshal(value, obj); err != nil {
+			return false, err
+		}
+		objs = append(objs, obj)
+		return true, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// forEach walks the encoded objects of a table matching the list options,
+// using the label bucket when a KindLabelSelector is given. Names are not
+// indexed: a Name filter decodes the name of every candidate.
+func (r *boltReader) forEach(table string, fn func([]byte) (bool, error), opts ...ListOption) error {
+	listOpts := &ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.Name != "" {
+		if !hasNames(table) {
+			return nil
+		}
+		inner := fn
+		fn = func(value []byte) (bool, error) {
+			var meta struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(value, &meta); err != nil {
+				return false, err
+			}
+			if meta.Name != listOpts.Name {
+				return true, nil
+			}
+			return inner(value)
+		}
+	}
+	return r.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(table))
+		if listOpts.KindLabelSelector == nil {
+			cursor := bucket.Cursor()
+			for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+				next, err := fn(v)
+				if err != nil || !next {
+					return err
+				}
+			}
+			return nil
+		}
+
+		prefix, err := listOpts.KindLabelSelector.indexKey()
+		if err != nil {
+			return err
+		}
+		cursor := tx.Bucket([]byte(table + labelBucketSuffix)).Cursor()
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			// Entries are the label index key, ending with a NUL, followed
+			// by the object ID
+			end := bytes.IndexByte(k[len(prefix)-1:], 0)
+			if end < 0 {
+				continue
+			}
+			value := bucket.Get(k[len(prefix)+end:])
+			if value == nil {
+				continue
+			}
+			next, err := fn(value)
+			if err != nil || !next {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete methods
+func (c *boltCache) DeleteRoute(r *Route) error {
+	return c.delete("route", r.ID)
+}
+
+func (c *boltCache) DeleteService(s *Service) error {
+	return c.delete("service", s.ID)
+}
+
+func (c *boltCache) DeleteUpstream(u *Upstream) error {
+	return c.delete("upstream", u.ID)
+}
+
+func (c *boltCache) DeleteSSL(ssl *SSL) error {
+	return c.delete("ssl", ssl.ID)
+}
+
+func (c *boltCache) DeleteGlobalRule(gr *GlobalRule) error {
+	return c.delete("global_rule", gr.ID)
+}
+
+func (c *boltCache) DeleteProto(p *Proto) error {
+	return c.delete("proto", p.ID)
+}
+
+func (c *boltCache) DeletePluginMetadata(m *PluginMetadata) error {
+	return c.delete("plugin_metadata", m.ID)
+}
+
+func (c *boltCache) DeleteRouteByID(id string) error {
+	return c.delete("route", id)
+}
+
+func (c *boltCache) DeleteServiceByID(id string) error {
+	return c.delete("service", id)
+}
+
+func (c *boltCache) DeleteUpstreamByID(id string) error {
+	return c.delete("upstream", id)
+}
+
+func (c *boltCache) DeleteSSLByID(id string) error {
+	return c.delete("ssl", id)
+}
+
+func (c *boltCache) DeleteGlobalRuleByID(id string) error {
+	return c.delete("global_rule", id)
+}
+
+func (c *boltCache) DeleteProtoByID(id string) error {
+	return c.delete("proto", id)
+}
+
+func (c *boltCache) DeletePluginMetadataByID(id string) error {
+	return c.delete("plugin_metadata", id)
+}
+
+func (c *boltCache) delete(table, id string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(table))
+		old := bucket.Get([]byte(id))
+		if old == nil {
+			return ErrNotFound
+		}
+		if err := deleteLabelEntry(tx.Bucket([]byte(table+labelBucketSuffix)), table, id, old); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(revisionTable)).Delete([]byte(revisionKey(table, id))); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+func (c *boltCache) Reset() error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, resourceType := range ResourceTypes {
+			if err := resetBucket(tx, resourceType.TableName()); err != nil {
+				return err
+			}
+		}
+		return resetBoltInputHashes(tx)
+	})
+}
+
+func (c *boltCache) ResetTable(resourceType ResourceType) error {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if err := resetBucket(tx, table); err != nil {
+			return err
+		}
+		return resetBoltInputHashes(tx)
+	})
+}
+
+// resetBucket recreates the bucket of a table and its label index empty and
+// drops the revisions of its objects
+func resetBucket(tx *bolt.Tx, table string) error {
+	if err := deleteBoltRevisions(tx, table); err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket([]byte(table)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket([]byte(table)); err != nil {
+		return err
+	}
+	return reindexLabels(tx, table)
+}
+
+// reindexLabels rebuilds the label index of a table, so that entries written
+// with an older index key format do not linger
+func reindexLabels(tx *bolt.Tx, table string) error {
+	name := []byte(table + labelBucketSuffix)
+	if tx.Bucket(name) != nil {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	labels, err := tx.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(table)).ForEach(func(id, value []byte) error {
+		obj, err := decodeBoltObject(table, value)
+		if err != nil {
+			return err
+		}
+		ok, key, err := KineLabelIndexer.FromObject(obj)
+		if err != nil || !ok {
+			return err
+		}
+		return labels.Put(append(key, id...), nil)
+	})
+}
+
+// deleteLabelEntry removes the label index entry of the encoded object
+func deleteLabelEntry(labels *bolt.Bucket, table, id string, value []byte) error {
+	obj, err := decodeBoltObject(table, value)
+	if err != nil {
+		return err
+	}
+	ok, key, err := KineLabelIndexer.FromObject(obj)
+	if err != nil || !ok {
+		return err
+	}
+	return labels.Delete(append(key, id...))
+}
+
+// decodeBoltObject decodes a stored value into the kine type of its table
+func decodeBoltObject(table string, value []byte) (any, error) {
+	var obj any
+	switch table {
+	case "route":
+		obj = &Route{}
+	case "service":
+		obj = &Service{}
+	case "upstream":
+		obj = &Upstream{}
+	case "ssl":
+		obj = &SSL{}
+	case "global_rule":
+		obj = &GlobalRule{}
+	case "proto":
+		obj = &Proto{}
+	case "plugin_metadata":
+		obj = &PluginMetadata{}
+	default:
+		return nil, fmt.Errorf("unknown table: %s", table)
+	}
+	if err := json.Unmarshal(value, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
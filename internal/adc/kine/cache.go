@@ -1,8 +1,10 @@
 package kine
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/hashicorp/go-memdb"
@@ -13,6 +15,8 @@ import (
 
 const (
 	KineLabelIndex = "label"
+	KineNameIndex  = "name"
+	KineHostIndex  = "host"
 )
 
 var (
@@ -26,6 +30,21 @@ var (
 // Schema Definition
 // =============================================================================
 
+// tableOf returns the table holding the given resource type
+func tableOf(resourceType ResourceType) (string, error) {
+	table := resourceType.TableName()
+	if table == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownResourceType, resourceType)
+	}
+	return table, nil
+}
+
+// hasNames reports whether the objects of a table have a name. Global rules
+// and plugin metadata are only known by plugin name, their ID.
+func hasNames(table string) bool {
+	return table != "global_rule" && table != "plugin_metadata"
+}
+
 var _schema = &memdb.DBSchema{
 	Tables: map[string]*memdb.TableSchema{
 		"route": {
@@ -36,6 +55,18 @@ var _schema = &memdb.DBSchema{
 					Unique:  true,
 					Indexer: &memdb.StringFieldIndex{Field: "ID"},
 				},
+				KineNameIndex: {
+					Name:         KineNameIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &memdb.StringFieldIndex{Field: "Name"},
+				},
+				KineHostIndex: {
+					Name:         KineHostIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      routeHostIndexer{},
+				},
 				"label": {
 					Name:         "label",
 					Unique:       false,
@@ -52,6 +83,12 @@ var _schema = &memdb.DBSchema{
 					Unique:  true,
 					Indexer: &memdb.StringFieldIndex{Field: "ID"},
 				},
+				KineNameIndex: {
+					Name:         KineNameIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &memdb.StringFieldIndex{Field: "Name"},
+				},
 				"label": {
 					Name:         "label",
 					Unique:       false,
@@ -68,6 +105,12 @@ var _schema = &memdb.DBSchema{
 					Unique:  true,
 					Indexer: &memdb.StringFieldIndex{Field: "ID"},
 				},
+				KineNameIndex: {
+					Name:         KineNameIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &memdb.StringFieldIndex{Field: "Name"},
+				},
 				"label": {
 					Name:         "label",
 					Unique:       false,
@@ -84,6 +127,34 @@ var _schema = &memdb.DBSchema{
 					Unique:  true,
 					Indexer: &memdb.StringFieldIndex{Field: "ID"},
 				},
+				KineNameIndex: {
+					Name:         KineNameIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &memdb.StringFieldIndex{Field: "Name"},
+				},
+				"label": {
+					Name:         "label",
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &KineLabelIndexer,
+				},
+			},
+		},
+		"proto": {
+			Name: "proto",
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": {
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				KineNameIndex: {
+					Name:         KineNameIndex,
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &memdb.StringFieldIndex{Field: "Name"},
+				},
 				"label": {
 					Name:         "label",
 					Unique:       false,
@@ -100,17 +171,161 @@ var _schema = &memdb.DBSchema{
 					Unique:  true,
 					Indexer: &memdb.StringFieldIndex{Field: "ID"},
 				},
+				"label": {
+					Name:         "label",
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &KineLabelIndexer,
+				},
+			},
+		},
+		"plugin_metadata": {
+			Name: "plugin_metadata",
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": {
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"label": {
+					Name:         "label",
+					Unique:       false,
+					AllowMissing: true,
+					Indexer:      &KineLabelIndexer,
+				},
+			},
+		},
+		revisionTable: {
+			Name: revisionTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": {
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "Key"},
+				},
+			},
+		},
+		inputHashTable: {
+			Name: inputHashTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": {
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "Owner"},
+				},
 			},
 		},
 	},
 }
 
+// =============================================================================
+// Host Indexer
+// =============================================================================
+
+// routeHostIndexer indexes routes by each of their normalized hosts, taken
+// from both Host and Hosts
+type routeHostIndexer struct{}
+
+func (routeHostIndexer) FromObject(obj any) (bool, [][]byte, error) {
+	route, ok := obj.(*Route)
+	if !ok {
+		return false, nil, fmt.Errorf("unexpected object type %T for the host index", obj)
+	}
+	hosts := routeHosts(route)
+	if len(hosts) == 0 {
+		return false, nil, nil
+	}
+	vals := make([][]byte, 0, len(hosts))
+	for _, host := range hosts {
+		// Null terminated like memdb string indexes
+		vals = append(vals, []byte(host+"\x00"))
+	}
+	return true, vals, nil
+}
+
+func (routeHostIndexer) FromArgs(args ...any) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	host, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("argument is not a string")
+	}
+	return []byte(indexedHost(host) + "\x00"), nil
+}
+
+// indexedHost returns the indexed form of a host: normalized like transfers
+// do, so that IDN and mixed case lookups match, and without the trailing
+// dot of a fully qualified name
+func indexedHost(host string) string {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return ""
+	}
+	if ascii, err := normalizeHost(host); err == nil {
+		return ascii
+	}
+	return strings.ToLower(host)
+}
+
+// routeHosts returns the distinct normalized hosts of a route
+func routeHosts(route *Route) []string {
+	hosts := make([]string, 0, len(route.Hosts)+1)
+	seen := make(map[string]bool, len(route.Hosts)+1)
+	add := func(host string) {
+		host = indexedHost(host)
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	if route.Host != nil {
+		add(*route.Host)
+	}
+	for _, host := range route.Hosts {
+		add(host)
+	}
+	return hosts
+}
+
+// hostLookupKeys returns the normalized host followed by the wildcard hosts
+// matching it, from the most to the least specific: api.example.com is
+// matched by *.example.com and *.com.
+func hostLookupKeys(host string) []string {
+	host = indexedHost(host)
+	if host == "" {
+		return nil
+	}
+	keys := []string{host}
+	rest := strings.TrimPrefix(host, "*.")
+	for {
+		i := strings.IndexByte(rest, '.')
+		if i < 0 {
+			return keys
+		}
+		rest = rest[i+1:]
+		keys = append(keys, "*."+rest)
+	}
+}
+
+// routeMatchesHost reports whether any host of route is one of keys
+func routeMatchesHost(route *Route, keys []string) bool {
+	for _, host := range routeHosts(route) {
+		if slices.Contains(keys, host) {
+			return true
+		}
+	}
+	return false
+}
+
 // =============================================================================
 // Label Indexer
 // =============================================================================
 
 var KineLabelIndexer = LabelIndexer{
 	LabelKeys: []string{label.LabelKind, label.LabelNamespace, label.LabelName},
+	// Kinds are typed by hand in label selectors, "ingress" must match "Ingress"
+	FoldCase: []string{label.LabelKind},
 	GetLabels: func(obj any) map[string]string {
 		switch t := obj.(type) {
 		case *Route:
@@ -121,6 +336,12 @@ var KineLabelIndexer = LabelIndexer{
 			return t.Labels
 		case *SSL:
 			return t.Labels
+		case *GlobalRule:
+			return t.Labels
+		case *Proto:
+			return t.Labels
+		case *PluginMetadata:
+			return t.Labels
 		default:
 			return nil
 		}
@@ -129,9 +350,22 @@ var KineLabelIndexer = LabelIndexer{
 
 type LabelIndexer struct {
 	LabelKeys []string
+	// FoldCase lists the label keys whose values are indexed lowercased,
+	// so that they match case-insensitively
+	FoldCase  []string
 	GetLabels func(obj any) map[string]string
 }
 
+// normalize returns the indexed form of the value of a label key
+func (li *LabelIndexer) normalize(key, value string) string {
+	for _, k := range li.FoldCase {
+		if k == key {
+			return strings.ToLower(value)
+		}
+	}
+	return value
+}
+
 // ref: https://pkg.go.dev/github.com/hashicorp/go-memdb#Txn.Get
 // by adding suffixes to avoid prefix matching
 func (li *LabelIndexer) genKey(labelValues []string) []byte {
@@ -147,7 +381,7 @@ func (li *LabelIndexer) FromObject(obj any) (bool, []byte, error) {
 	var labelValues []string
 	for _, key := range li.LabelKeys {
 		if value, exists := labels[key]; exists {
-			labelValues = append(labelValues, value)
+			labelValues = append(labelValues, li.normalize(key, value))
 		}
 	}
 
@@ -158,31 +392,121 @@ func (li *LabelIndexer) FromObject(obj any) (bool, []byte, error) {
 	return true, li.genKey(labelValues), nil
 }
 
+// FromArgs returns the key of the given label values, in LabelKeys order.
+// With fewer values than LabelKeys, it returns the prefix shared by the keys
+// of all objects having these leading values, for prefix lookups.
 func (li *LabelIndexer) FromArgs(args ...any) ([]byte, error) {
-	if len(args) != len(li.LabelKeys) {
-		return nil, fmt.Errorf("expected %d arguments, got %d", len(li.LabelKeys), len(args))
+	if len(args) == 0 || len(args) > len(li.LabelKeys) {
+		return nil, fmt.Errorf("label selector needs 1 to %d values (%s), got %d",
+			len(li.LabelKeys), strings.Join(li.LabelKeys, ", "), len(args))
 	}
 
 	labelValues := make([]string, 0, len(args))
-	for _, arg := range args {
+	for i, arg := range args {
 		value, ok := arg.(string)
 		if !ok {
-			return nil, fmt.Errorf("argument is not a string")
+			return nil, fmt.Errorf("label selector value %v of %s is not a string", arg, li.LabelKeys[i])
 		}
-		labelValues = append(labelValues, value)
+		labelValues = append(labelValues, li.normalize(li.LabelKeys[i], value))
 	}
 
+	if len(labelValues) < len(li.LabelKeys) {
+		return []byte(strings.Join(labelValues, "/") + "/"), nil
+	}
 	return li.genKey(labelValues), nil
 }
 
+// PrefixFromArgs implements memdb.PrefixIndexer, so that partial label
+// values can be looked up with the _prefix suffix of the index
+func (li *LabelIndexer) PrefixFromArgs(args ...any) ([]byte, error) {
+	return li.FromArgs(args...)
+}
+
 // =============================================================================
 // Cache Interface
 // =============================================================================
 
-// Cache interface for Kine types
+// ReadTxn reads cached objects
+type ReadTxn interface {
+	// GetRoute finds the route from cache according to the primary index (id)
+	GetRoute(string) (*Route, error)
+	// GetService finds the service from cache according to the primary index (id)
+	GetService(string) (*Service, error)
+	// GetUpstream finds the upstream from cache according to the primary index (id)
+	GetUpstream(string) (*Upstream, error)
+	// GetSSL finds the SSL from cache according to the primary index (id)
+	GetSSL(string) (*SSL, error)
+	// GetGlobalRule finds the global rule from cache according to the primary index (id)
+	GetGlobalRule(string) (*GlobalRule, error)
+	// GetProto finds the proto from cache according to the primary index (id)
+	GetProto(string) (*Proto, error)
+	// GetPluginMetadata finds the plugin metadata from cache according to the primary index (plugin name)
+	GetPluginMetadata(string) (*PluginMetadata, error)
+
+	// ListRoutes lists all route objects in cache
+	ListRoutes(...ListOption) ([]*Route, error)
+	// ListServices lists all service objects in cache
+	ListServices(...ListOption) ([]*Service, error)
+	// ListUpstreams lists all upstream objects in cache
+	ListUpstreams(...ListOption) ([]*Upstream, error)
+	// ListSSL lists all SSL objects in cache
+	ListSSL(...ListOption) ([]*SSL, error)
+	// ListGlobalRules lists all global rule objects in cache
+	ListGlobalRules(...ListOption) ([]*GlobalRule, error)
+	// ListProtos lists all proto objects in cache
+	ListProtos(...ListOption) ([]*Proto, error)
+	// ListPluginMetadata lists all plugin metadata objects in cache
+	ListPluginMetadata(...ListOption) ([]*PluginMetadata, error)
+
+	// ForEachRoute walks the route objects in cache, handing a copy of each
+	// to fn (or the stored object with WithoutCopy). Iteration stops early
+	// when fn returns false.
+	ForEachRoute(fn func(*Route) bool, opts ...ListOption) error
+
+	// ListRoutesByName lists the route objects with the given name. Names
+	// are not unique, so all matches are returned; no match is not an error.
+	ListRoutesByName(name string, opts ...ListOption) ([]*Route, error)
+	// ListServicesByName lists the service objects with the given name
+	ListServicesByName(name string, opts ...ListOption) ([]*Service, error)
+	// ListUpstreamsByName lists the upstream objects with the given name
+	ListUpstreamsByName(name string, opts ...ListOption) ([]*Upstream, error)
+	// ListSSLByName lists the SSL objects with the given name
+	ListSSLByName(name string, opts ...ListOption) ([]*SSL, error)
+
+	// ListRoutesByHost lists the route objects serving host through their
+	// host or hosts, exactly or with a wildcard such as *.example.com.
+	// Hosts match case-insensitively.
+	ListRoutesByHost(host string, opts ...ListOption) ([]*Route, error)
+
+	// ListUnlabeled lists the objects of the given type lacking one of the
+	// owner labels of KineLabelIndexer. No label selector matches them, so
+	// label scoped syncs never reconcile nor delete them.
+	ListUnlabeled(resourceType ResourceType) ([]any, error)
+
+	// Revision returns the revision the cache assigned to the object of the
+	// given type and id. Every insert changing the content of an object
+	// assigns it a new, higher revision, re-inserting identical content
+	// keeps it. ErrNotFound is returned for objects not in cache.
+	Revision(resourceType ResourceType, id string) (uint64, error)
+	// Revisions returns the revisions of all objects of the given type by ID
+	Revisions(resourceType ResourceType) (map[string]uint64, error)
+	// ContentHashes returns the content hashes of all objects of the given
+	// type by ID, as computed by ContentHash when they were inserted
+	ContentHashes(resourceType ResourceType) (map[string][]byte, error)
+}
+
+// Cache interface for Kine types. Its read methods each read the latest
+// state, use Read for several reads that must be consistent.
 type Cache interface {
+	ReadTxn
+
 	// Insert adds or updates an object to cache
 	Insert(obj any) error
+	// InsertOwned adds or updates an object to cache like Insert, without
+	// copying it first: the caller hands the object over and must not
+	// retain or mutate it. Race builds detect mutations on later reads
+	// and writes of the object.
+	InsertOwned(obj any) error
 	// Delete removes an object from cache
 	Delete(obj any) error
 
@@ -196,17 +520,10 @@ type Cache interface {
 	InsertSSL(*SSL) error
 	// InsertGlobalRule adds or updates global rule to cache
 	InsertGlobalRule(*GlobalRule) error
-
-	// GetRoute finds the route from cache according to the primary index (id)
-	GetRoute(string) (*Route, error)
-	// GetService finds the service from cache according to the primary index (id)
-	GetService(string) (*Service, error)
-	// GetUpstream finds the upstream from cache according to the primary index (id)
-	GetUpstream(string) (*Upstream, error)
-	// GetSSL finds the SSL from cache according to the primary index (id)
-	GetSSL(string) (*SSL, error)
-	// GetGlobalRule finds the global rule from cache according to the primary index (id)
-	GetGlobalRule(string) (*GlobalRule, error)
+	// InsertProto adds or updates proto to cache
+	InsertProto(*Proto) error
+	// InsertPluginMetadata adds or updates plugin metadata to cache
+	InsertPluginMetadata(*PluginMetadata) error
 
 	// DeleteRoute deletes the specified route in cache
 	DeleteRoute(*Route) error
@@ -218,17 +535,51 @@ type Cache interface {
 	DeleteSSL(*SSL) error
 	// DeleteGlobalRule deletes the specified global rule in cache
 	DeleteGlobalRule(*GlobalRule) error
-
-	// ListRoutes lists all route objects in cache
-	ListRoutes(...ListOption) ([]*Route, error)
-	// ListServices lists all service objects in cache
-	ListServices(...ListOption) ([]*Service, error)
-	// ListUpstreams lists all upstream objects in cache
-	ListUpstreams(...ListOption) ([]*Upstream, error)
-	// ListSSL lists all SSL objects in cache
-	ListSSL(...ListOption) ([]*SSL, error)
-	// ListGlobalRules lists all global rule objects in cache
-	ListGlobalRules(...ListOption) ([]*GlobalRule, error)
+	// DeleteProto deletes the specified proto in cache
+	DeleteProto(*Proto) error
+	// DeletePluginMetadata deletes the specified plugin metadata in cache
+	DeletePluginMetadata(*PluginMetadata) error
+
+	// DeleteRouteByID deletes the route with the given id in cache. Unlike
+	// DeleteRoute, it does not depend on the other fields of a possibly
+	// stale copy of the route. ErrNotFound is returned for unknown ids.
+	DeleteRouteByID(string) error
+	// DeleteServiceByID deletes the service with the given id in cache
+	DeleteServiceByID(string) error
+	// DeleteUpstreamByID deletes the upstream with the given id in cache
+	DeleteUpstreamByID(string) error
+	// DeleteSSLByID deletes the SSL with the given id in cache
+	DeleteSSLByID(string) error
+	// DeleteGlobalRuleByID deletes the global rule with the given id in cache
+	DeleteGlobalRuleByID(string) error
+	// DeleteProtoByID deletes the proto with the given id in cache
+	DeleteProtoByID(string) error
+	// DeletePluginMetadataByID deletes the plugin metadata of the given plugin in cache
+	DeletePluginMetadataByID(string) error
+
+	// Reset deletes all objects of all tables in a single transaction.
+	// Concurrent readers see either the old or the emptied cache.
+	Reset() error
+	// ResetTable deletes all objects of the given resource type
+	ResetTable(ResourceType) error
+	// Touch assigns the next revision to the object of the given type and
+	// id, which reinserting it unchanged does not. ErrNotFound is returned
+	// for unknown ids.
+	Touch(ResourceType, string) error
+
+	// SetInputHash records the opaque hash of the input the resources of
+	// the owner selected by selector were synced from, or forgets it when
+	// hash is empty. Reset and ResetTable forget the hashes of all owners.
+	SetInputHash(selector KindLabelSelector, hash string) error
+	// InputHash returns the input hash recorded for the owner selected by
+	// selector, empty when none is
+	InputHash(selector KindLabelSelector) (string, error)
+
+	// Read calls fn with a ReadTxn reading a single consistent snapshot of
+	// all tables, unaffected by concurrent writes. The ReadTxn must not be
+	// used after fn returns, and fn must not call the cache itself: the
+	// bolt backend may deadlock on nested transactions.
+	Read(fn func(ReadTxn) error) error
 }
 
 // ListOption interface for list options
@@ -239,12 +590,30 @@ type ListOption interface {
 // ListOptions contains filtering options for list operations
 type ListOptions struct {
 	KindLabelSelector *KindLabelSelector
+	// Name only keeps objects with exactly this name. Global rules have no
+	// name and never match.
+	Name string
+	// WithoutCopy returns the stored objects instead of deep copies.
+	// Callers must not mutate the results.
+	WithoutCopy bool
+	// IncludeSecrets keeps secret material, such as SSL keys, in exports.
+	// Cache list operations always return it.
+	IncludeSecrets bool
 }
 
 func (o *ListOptions) ApplyToList(lo *ListOptions) {
 	if o.KindLabelSelector != nil {
 		lo.KindLabelSelector = o.KindLabelSelector
 	}
+	if o.Name != "" {
+		lo.Name = o.Name
+	}
+	if o.WithoutCopy {
+		lo.WithoutCopy = o.WithoutCopy
+	}
+	if o.IncludeSecrets {
+		lo.IncludeSecrets = o.IncludeSecrets
+	}
 }
 
 func (o *ListOptions) ApplyOptions(opts []ListOption) *ListOptions {
@@ -259,18 +628,97 @@ type KindLabelSelector struct {
 	Kind      string
 	Name      string
 	Namespace string
+	// Partial selects every name when Name is empty, and every namespace
+	// and name when Namespace is empty too, listing the objects of a kind
+	// or of a kind in a namespace. Otherwise empty values only select
+	// objects whose label is empty.
+	Partial bool
+}
+
+// indexArgs returns the label values of the selector to look up in the
+// label index, only the leading non-empty ones of partial selectors
+func (o *KindLabelSelector) indexArgs() ([]any, error) {
+	args := []any{o.Kind, o.Namespace, o.Name}
+	if !o.Partial {
+		return args, nil
+	}
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+	for _, arg := range args {
+		if arg == "" {
+			return nil, fmt.Errorf("%w: partial label selector needs a kind, and a namespace to select a name", ErrInvalidInput)
+		}
+	}
+	return args, nil
+}
+
+// indexKey returns the label index key of the selector, a prefix of the
+// keys it selects
+func (o *KindLabelSelector) indexKey() ([]byte, error) {
+	args, err := o.indexArgs()
+	if err != nil {
+		return nil, err
+	}
+	return KineLabelIndexer.FromArgs(args...)
+}
+
+// matches reports whether the label index key of an object is selected
+func (o *KindLabelSelector) matches(selectorKey []byte, obj any) (bool, error) {
+	ok, key, err := KineLabelIndexer.FromObject(obj)
+	if err != nil || !ok {
+		return false, err
+	}
+	return bytes.HasPrefix(key, selectorKey), nil
 }
 
 func (o *KindLabelSelector) ApplyToList(opts *ListOptions) {
 	opts.KindLabelSelector = o
 }
 
+type nameOption string
+
+func (o nameOption) ApplyToList(opts *ListOptions) {
+	opts.Name = string(o)
+}
+
+// WithName filters list operations to objects with the given name
+func WithName(name string) ListOption {
+	return nameOption(name)
+}
+
+type withoutCopyOption struct{}
+
+func (withoutCopyOption) ApplyToList(opts *ListOptions) {
+	opts.WithoutCopy = true
+}
+
+type includeSecretsOption struct{}
+
+func (includeSecretsOption) ApplyToList(opts *ListOptions) {
+	opts.IncludeSecrets = true
+}
+
+// IncludeSecrets makes exports keep secret material instead of redacting it
+func IncludeSecrets() ListOption {
+	return includeSecretsOption{}
+}
+
+// WithoutCopy makes list operations hand out the stored objects directly,
+// skipping the deep copy. The results are read-only: do not mutate them.
+func WithoutCopy() ListOption {
+	return withoutCopyOption{}
+}
+
 // =============================================================================
 // Cache Implementation
 // =============================================================================
 
 type dbCache struct {
 	db *memdb.MemDB
+	// revision is the last assigned object revision, only updated within
+	// write transactions
+	revision uint64
 }
 
 // NewMemDBCache creates a Cache object backed with a memory DB
@@ -296,8 +744,33 @@ func (c *dbCache) Insert(obj any) error {
 		return c.InsertSSL(t)
 	case *GlobalRule:
 		return c.InsertGlobalRule(t)
+	case *Proto:
+		return c.InsertProto(t)
+	case *PluginMetadata:
+		return c.InsertPluginMetadata(t)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, obj)
+	}
+}
+
+func (c *dbCache) InsertOwned(obj any) error {
+	switch t := obj.(type) {
+	case *Route:
+		return c.insert("route", t.ID, t)
+	case *Service:
+		return c.insert("service", t.ID, t)
+	case *Upstream:
+		return c.insert("upstream", t.ID, t)
+	case *SSL:
+		return c.insert("ssl", t.ID, t)
+	case *GlobalRule:
+		return c.insert("global_rule", t.ID, t)
+	case *Proto:
+		return c.insert("proto", t.ID, t)
+	case *PluginMetadata:
+		return c.insert("plugin_metadata", t.ID, t)
 	default:
-		return errors.New("unsupported type")
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, obj)
 	}
 }
 
@@ -313,87 +786,224 @@ func (c *dbCache) Delete(obj any) error {
 		return c.DeleteSSL(t)
 	case *GlobalRule:
 		return c.DeleteGlobalRule(t)
+	case *Proto:
+		return c.DeleteProto(t)
+	case *PluginMetadata:
+		return c.DeletePluginMetadata(t)
 	default:
-		return errors.New("unsupported type")
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, obj)
 	}
 }
 
 // Insert methods
 func (c *dbCache) InsertRoute(r *Route) error {
-	return c.insert("route", r.DeepCopy())
+	return c.insert("route", r.ID, r.DeepCopy())
 }
 
 func (c *dbCache) InsertService(s *Service) error {
-	return c.insert("service", s.DeepCopy())
+	return c.insert("service", s.ID, s.DeepCopy())
 }
 
 func (c *dbCache) InsertUpstream(u *Upstream) error {
-	return c.insert("upstream", u.DeepCopy())
+	return c.insert("upstream", u.ID, u.DeepCopy())
 }
 
 func (c *dbCache) InsertSSL(ssl *SSL) error {
-	return c.insert("ssl", ssl.DeepCopy())
+	return c.insert("ssl", ssl.ID, ssl.DeepCopy())
 }
 
 func (c *dbCache) InsertGlobalRule(gr *GlobalRule) error {
-	return c.insert("global_rule", gr.DeepCopy())
+	return c.insert("global_rule", gr.ID, gr.DeepCopy())
 }
 
-func (c *dbCache) insert(table string, obj any) error {
+func (c *dbCache) InsertProto(p *Proto) error {
+	return c.insert("proto", p.ID, p.DeepCopy())
+}
+
+func (c *dbCache) InsertPluginMetadata(m *PluginMetadata) error {
+	return c.insert("plugin_metadata", m.ID, m.DeepCopy())
+}
+
+func (c *dbCache) insert(table, id string, obj any) error {
 	txn := c.db.Txn(true)
 	defer txn.Abort()
+	if checkOwnedMutations {
+		existing, err := txn.First(table, "id", id)
+		if err != nil {
+			return err
+		}
+		if err := verifyUnmutated(txn, table, id, existing); err != nil {
+			return err
+		}
+	}
 	if err := txn.Insert(table, obj); err != nil {
 		return err
 	}
+	if err := c.updateRevision(txn, table, id, obj); err != nil {
+		return err
+	}
 	txn.Commit()
 	return nil
 }
 
+// Read methods
+func (c *dbCache) Read(fn func(ReadTxn) error) error {
+	txn := c.db.Txn(false)
+	defer txn.Abort()
+	return fn(&dbReader{txn: txn})
+}
+
+// reader returns a dbReader on a new read transaction
+func (c *dbCache) reader() *dbReader {
+	return &dbReader{txn: c.db.Txn(false)}
+}
+
 // Get methods
 func (c *dbCache) GetRoute(id string) (*Route, error) {
-	obj, err := c.get("route", id)
+	return c.reader().GetRoute(id)
+}
+
+func (c *dbCache) GetService(id string) (*Service, error) {
+	return c.reader().GetService(id)
+}
+
+func (c *dbCache) GetUpstream(id string) (*Upstream, error) {
+	return c.reader().GetUpstream(id)
+}
+
+func (c *dbCache) GetSSL(id string) (*SSL, error) {
+	return c.reader().GetSSL(id)
+}
+
+func (c *dbCache) GetGlobalRule(id string) (*GlobalRule, error) {
+	return c.reader().GetGlobalRule(id)
+}
+
+func (c *dbCache) GetProto(id string) (*Proto, error) {
+	return c.reader().GetProto(id)
+}
+
+func (c *dbCache) GetPluginMetadata(id string) (*PluginMetadata, error) {
+	return c.reader().GetPluginMetadata(id)
+}
+
+// List methods
+func (c *dbCache) ListRoutes(opts ...ListOption) ([]*Route, error) {
+	return c.reader().ListRoutes(opts...)
+}
+
+func (c *dbCache) ListServices(opts ...ListOption) ([]*Service, error) {
+	return c.reader().ListServices(opts...)
+}
+
+func (c *dbCache) ListUpstreams(opts ...ListOption) ([]*Upstream, error) {
+	return c.reader().ListUpstreams(opts...)
+}
+
+func (c *dbCache) ListSSL(opts ...ListOption) ([]*SSL, error) {
+	return c.reader().ListSSL(opts...)
+}
+
+func (c *dbCache) ListGlobalRules(opts ...ListOption) ([]*GlobalRule, error) {
+	return c.reader().ListGlobalRules(opts...)
+}
+
+func (c *dbCache) ListProtos(opts ...ListOption) ([]*Proto, error) {
+	return c.reader().ListProtos(opts...)
+}
+
+func (c *dbCache) ListPluginMetadata(opts ...ListOption) ([]*PluginMetadata, error) {
+	return c.reader().ListPluginMetadata(opts...)
+}
+
+func (c *dbCache) ListRoutesByName(name string, opts ...ListOption) ([]*Route, error) {
+	return c.reader().ListRoutesByName(name, opts...)
+}
+
+func (c *dbCache) ListServicesByName(name string, opts ...ListOption) ([]*Service, error) {
+	return c.reader().ListServicesByName(name, opts...)
+}
+
+func (c *dbCache) ListUpstreamsByName(name string, opts ...ListOption) ([]*Upstream, error) {
+	return c.reader().ListUpstreamsByName(name, opts...)
+}
+
+func (c *dbCache) ListSSLByName(name string, opts ...ListOption) ([]*SSL, error) {
+	return c.reader().ListSSLByName(name, opts...)
+}
+
+func (c *dbCache) ListRoutesByHost(host string, opts ...ListOption) ([]*Route, error) {
+	return c.reader().ListRoutesByHost(host, opts...)
+}
+
+func (c *dbCache) ForEachRoute(fn func(*Route) bool, opts ...ListOption) error {
+	return c.reader().ForEachRoute(fn, opts...)
+}
+
+// dbReader implements ReadTxn on a memdb read transaction, which reads an
+// immutable snapshot of the database
+type dbReader struct {
+	txn *memdb.Txn
+}
+
+func (r *dbReader) GetRoute(id string) (*Route, error) {
+	obj, err := r.get("route", id)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*Route).DeepCopy(), nil
 }
 
-func (c *dbCache) GetService(id string) (*Service, error) {
-	obj, err := c.get("service", id)
+func (r *dbReader) GetService(id string) (*Service, error) {
+	obj, err := r.get("service", id)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*Service).DeepCopy(), nil
 }
 
-func (c *dbCache) GetUpstream(id string) (*Upstream, error) {
-	obj, err := c.get("upstream", id)
+func (r *dbReader) GetUpstream(id string) (*Upstream, error) {
+	obj, err := r.get("upstream", id)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*Upstream).DeepCopy(), nil
 }
 
-func (c *dbCache) GetSSL(id string) (*SSL, error) {
-	obj, err := c.get("ssl", id)
+func (r *dbReader) GetSSL(id string) (*SSL, error) {
+	obj, err := r.get("ssl", id)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*SSL).DeepCopy(), nil
 }
 
-func (c *dbCache) GetGlobalRule(id string) (*GlobalRule, error) {
-	obj, err := c.get("global_rule", id)
+func (r *dbReader) GetGlobalRule(id string) (*GlobalRule, error) {
+	obj, err := r.get("global_rule", id)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*GlobalRule).DeepCopy(), nil
 }
 
-func (c *dbCache) get(table, id string) (any, error) {
-	txn := c.db.Txn(false)
-	defer txn.Abort()
-	obj, err := txn.First(table, "id", id)
+func (r *dbReader) GetProto(id string) (*Proto, error) {
+	obj, err := r.get("proto", id)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*Proto).DeepCopy(), nil
+}
+
+func (r *dbReader) GetPluginMetadata(id string) (*PluginMetadata, error) {
+	obj, err := r.get("plugin_metadata", id)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*PluginMetadata).DeepCopy(), nil
+}
+
+func (r *dbReader) get(table, id string) (any, error) {
+	obj, err := r.txn.First(table, "id", id)
 	if err != nil {
 		if err == memdb.ErrNotFound {
 			return nil, ErrNotFound
@@ -403,114 +1013,416 @@ func (c *dbCache) get(table, id string) (any, error) {
 	if obj == nil {
 		return nil, ErrNotFound
 	}
+	if checkOwnedMutations {
+		if err := verifyUnmutated(r.txn, table, id, obj); err != nil {
+			return nil, err
+		}
+	}
 	return obj, nil
 }
 
 // List methods
-func (c *dbCache) ListRoutes(opts ...ListOption) ([]*Route, error) {
-	raws, err := c.list("route", opts...)
+func (r *dbReader) ListRoutes(opts ...ListOption) ([]*Route, error) {
+	raws, err := r.list("route", opts...)
 	if err != nil {
 		return nil, err
 	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
 	routes := make([]*Route, 0, len(raws))
 	for _, raw := range raws {
-		routes = append(routes, raw.(*Route).DeepCopy())
+		obj := raw.(*Route)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		routes = append(routes, obj)
 	}
 	return routes, nil
 }
 
-func (c *dbCache) ListServices(opts ...ListOption) ([]*Service, error) {
-	raws, err := c.list("service", opts...)
+func (r *dbReader) ListServices(opts ...ListOption) ([]*Service, error) {
+	raws, err := r.list("service", opts...)
 	if err != nil {
 		return nil, err
 	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
 	services := make([]*Service, 0, len(raws))
 	for _, raw := range raws {
-		services = append(services, raw.(*Service).DeepCopy())
+		obj := raw.(*Service)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		services = append(services, obj)
 	}
 	return services, nil
 }
 
-func (c *dbCache) ListUpstreams(opts ...ListOption) ([]*Upstream, error) {
-	raws, err := c.list("upstream", opts...)
+func (r *dbReader) ListUpstreams(opts ...ListOption) ([]*Upstream, error) {
+	raws, err := r.list("upstream", opts...)
 	if err != nil {
 		return nil, err
 	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
 	upstreams := make([]*Upstream, 0, len(raws))
 	for _, raw := range raws {
-		upstreams = append(upstreams, raw.(*Upstream).DeepCopy())
+		obj := raw.(*Upstream)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		upstreams = append(upstreams, obj)
 	}
 	return upstreams, nil
 }
 
-func (c *dbCache) ListSSL(opts ...ListOption) ([]*SSL, error) {
-	raws, err := c.list("ssl", opts...)
+func (r *dbReader) ListSSL(opts ...ListOption) ([]*SSL, error) {
+	raws, err := r.list("ssl", opts...)
 	if err != nil {
 		return nil, err
 	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
 	ssls := make([]*SSL, 0, len(raws))
 	for _, raw := range raws {
-		ssls = append(ssls, raw.(*SSL).DeepCopy())
+		obj := raw.(*SSL)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		ssls = append(ssls, obj)
 	}
 	return ssls, nil
 }
 
-func (c *dbCache) ListGlobalRules(opts ...ListOption) ([]*GlobalRule, error) {
-	raws, err := c.list("global_rule", opts...)
+func (r *dbReader) ListGlobalRules(opts ...ListOption) ([]*GlobalRule, error) {
+	raws, err := r.list("global_rule", opts...)
 	if err != nil {
 		return nil, err
 	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
 	globalRules := make([]*GlobalRule, 0, len(raws))
 	for _, raw := range raws {
-		globalRules = append(globalRules, raw.(*GlobalRule).DeepCopy())
+		obj := raw.(*GlobalRule)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		globalRules = append(globalRules, obj)
 	}
 	return globalRules, nil
 }
 
-func (c *dbCache) list(table string, opts ...ListOption) ([]any, error) {
-	txn := c.db.Txn(false)
-	defer txn.Abort()
+func (r *dbReader) ListProtos(opts ...ListOption) ([]*Proto, error) {
+	raws, err := r.list("proto", opts...)
+	if err != nil {
+		return nil, err
+	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
+	protos := make([]*Proto, 0, len(raws))
+	for _, raw := range raws {
+		obj := raw.(*Proto)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		protos = append(protos, obj)
+	}
+	return protos, nil
+}
+
+func (r *dbReader) ListPluginMetadata(opts ...ListOption) ([]*PluginMetadata, error) {
+	raws, err := r.list("plugin_metadata", opts...)
+	if err != nil {
+		return nil, err
+	}
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
+	pluginMetadata := make([]*PluginMetadata, 0, len(raws))
+	for _, raw := range raws {
+		obj := raw.(*PluginMetadata)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		pluginMetadata = append(pluginMetadata, obj)
+	}
+	return pluginMetadata, nil
+}
+
+// ListByName methods
+func (r *dbReader) ListRoutesByName(name string, opts ...ListOption) ([]*Route, error) {
+	return r.ListRoutes(append(opts, WithName(name))...)
+}
+
+func (r *dbReader) ListServicesByName(name string, opts ...ListOption) ([]*Service, error) {
+	return r.ListServices(append(opts, WithName(name))...)
+}
+
+func (r *dbReader) ListUpstreamsByName(name string, opts ...ListOption) ([]*Upstream, error) {
+	return r.ListUpstreams(append(opts, WithName(name))...)
+}
+
+func (r *dbReader) ListSSLByName(name string, opts ...ListOption) ([]*SSL, error) {
+	return r.ListSSL(append(opts, WithName(name))...)
+}
+
+// ForEach methods
+func (r *dbReader) ForEachRoute(fn func(*Route) bool, opts ...ListOption) error {
+	withoutCopy := (&ListOptions{}).ApplyOptions(opts).WithoutCopy
+	return r.forEach("route", func(raw any) bool {
+		obj := raw.(*Route)
+		if !withoutCopy {
+			obj = obj.DeepCopy()
+		}
+		return fn(obj)
+	}, opts...)
+}
+
+// ListRoutesByHost looks up the host and then each wildcard host matching
+// it in the host index. Other list options are checked against each match.
+func (r *dbReader) ListRoutesByHost(host string, opts ...ListOption) ([]*Route, error) {
+	listOpts := (&ListOptions{}).ApplyOptions(opts)
+	var selectorKey []byte
+	if selector := listOpts.KindLabelSelector; selector != nil {
+		key, err := selector.indexKey()
+		if err != nil {
+			return nil, err
+		}
+		selectorKey = key
+	}
+
+	var routes []*Route
+	seen := make(map[string]bool)
+	for _, key := range hostLookupKeys(host) {
+		iter, err := r.txn.Get("route", KineHostIndex, key)
+		if err != nil {
+			return nil, err
+		}
+		for obj := iter.Next(); obj != nil; obj = iter.Next() {
+			route := obj.(*Route)
+			if seen[route.ID] || (listOpts.Name != "" && route.Name != listOpts.Name) {
+				continue
+			}
+			if selectorKey != nil {
+				ok, err := listOpts.KindLabelSelector.matches(selectorKey, obj)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			seen[route.ID] = true
+			if !listOpts.WithoutCopy {
+				route = route.DeepCopy()
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+func (r *dbReader) list(table string, opts ...ListOption) ([]any, error) {
+	var objs []any
+	err := r.forEach(table, func(obj any) bool {
+		objs = append(objs, obj)
+		return true
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// forEach walks the stored objects of a table matching the list options,
+// stopping as soon as fn returns false. The objects passed to fn are the
+// stored ones and must not be mutated.
+func (r *dbReader) forEach(table string, fn func(any) bool, opts ...ListOption) error {
 	listOpts := &ListOptions{}
 	listOpts.ApplyOptions(opts)
 	index := "id"
 	var args []any
-	if listOpts.KindLabelSelector != nil {
+	var selectorKey []byte
+	if selector := listOpts.KindLabelSelector; selector != nil {
+		var err error
+		if args, err = selector.indexArgs(); err != nil {
+			return err
+		}
 		index = KineLabelIndex
-		args = []any{listOpts.KindLabelSelector.Kind, listOpts.KindLabelSelector.Namespace, listOpts.KindLabelSelector.Name}
+		if len(args) < len(KineLabelIndexer.LabelKeys) {
+			// Partial selectors look up the keys starting with their values
+			index += "_prefix"
+		}
 	}
-	iter, err := txn.Get(table, index, args...)
+	if listOpts.Name != "" {
+		if !hasNames(table) {
+			return nil
+		}
+		// The name index is the more selective one, the label selector
+		// is then checked against each candidate
+		if listOpts.KindLabelSelector != nil {
+			key, err := KineLabelIndexer.FromArgs(args...)
+			if err != nil {
+				return err
+			}
+			selectorKey = key
+		}
+		index = KineNameIndex
+		args = []any{listOpts.Name}
+	}
+	iter, err := r.txn.Get(table, index, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var objs []any
 	for obj := iter.Next(); obj != nil; obj = iter.Next() {
-		objs = append(objs, obj)
+		if selectorKey != nil {
+			ok, err := listOpts.KindLabelSelector.matches(selectorKey, obj)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if !fn(obj) {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *dbCache) Reset() error {
+	txn := c.db.Txn(true)
+	defer txn.Abort()
+	for _, resourceType := range ResourceTypes {
+		if _, err := txn.DeleteAll(resourceType.TableName(), "id"); err != nil {
+			return err
+		}
+	}
+	if _, err := txn.DeleteAll(revisionTable, "id"); err != nil {
+		return err
+	}
+	if _, err := txn.DeleteAll(inputHashTable, "id"); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (c *dbCache) ResetTable(resourceType ResourceType) error {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return err
+	}
+	txn := c.db.Txn(true)
+	defer txn.Abort()
+	if _, err := txn.DeleteAll(table, "id"); err != nil {
+		return err
+	}
+	if _, err := txn.DeleteAll(revisionTable, "id_prefix", revisionKey(table, "")); err != nil {
+		return err
+	}
+	if _, err := txn.DeleteAll(inputHashTable, "id"); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+// DeleteByID deletes the resource of the given type and id from cache
+func DeleteByID(c Cache, resourceType ResourceType, id string) error {
+	switch resourceType {
+	case ResourceTypeRoute:
+		return c.DeleteRouteByID(id)
+	case ResourceTypeService:
+		return c.DeleteServiceByID(id)
+	case ResourceTypeUpstream:
+		return c.DeleteUpstreamByID(id)
+	case ResourceTypeSSL:
+		return c.DeleteSSLByID(id)
+	case ResourceTypeGlobalRule:
+		return c.DeleteGlobalRuleByID(id)
+	case ResourceTypeProto:
+		return c.DeleteProtoByID(id)
+	case ResourceTypePluginMetadata:
+		return c.DeletePluginMetadataByID(id)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownResourceType, resourceType)
 	}
-	return objs, nil
 }
 
 // Delete methods
 func (c *dbCache) DeleteRoute(r *Route) error {
-	return c.delete("route", r)
+	return c.delete("route", r.ID, r)
 }
 
 func (c *dbCache) DeleteService(s *Service) error {
-	return c.delete("service", s)
+	return c.delete("service", s.ID, s)
 }
 
 func (c *dbCache) DeleteUpstream(u *Upstream) error {
-	return c.delete("upstream", u)
+	return c.delete("upstream", u.ID, u)
 }
 
 func (c *dbCache) DeleteSSL(ssl *SSL) error {
-	return c.delete("ssl", ssl)
+	return c.delete("ssl", ssl.ID, ssl)
 }
 
 func (c *dbCache) DeleteGlobalRule(gr *GlobalRule) error {
-	return c.delete("global_rule", gr)
+	return c.delete("global_rule", gr.ID, gr)
+}
+
+func (c *dbCache) DeleteProto(p *Proto) error {
+	return c.delete("proto", p.ID, p)
+}
+
+func (c *dbCache) DeletePluginMetadata(m *PluginMetadata) error {
+	return c.delete("plugin_metadata", m.ID, m)
+}
+
+func (c *dbCache) DeleteRouteByID(id string) error {
+	return c.deleteByID("route", id)
+}
+
+func (c *dbCache) DeleteServiceByID(id string) error {
+	return c.deleteByID("service", id)
+}
+
+func (c *dbCache) DeleteUpstreamByID(id string) error {
+	return c.deleteByID("upstream", id)
+}
+
+func (c *dbCache) DeleteSSLByID(id string) error {
+	return c.deleteByID("ssl", id)
+}
+
+func (c *dbCache) DeleteGlobalRuleByID(id string) error {
+	return c.deleteByID("global_rule", id)
+}
+
+func (c *dbCache) DeleteProtoByID(id string) error {
+	return c.deleteByID("proto", id)
+}
+
+func (c *dbCache) DeletePluginMetadataByID(id string) error {
+	return c.deleteByID("plugin_metadata", id)
 }
 
-func (c *dbCache) delete(table string, obj any) error {
+// deleteByID deletes the stored object with the given id, looking it up in
+// the same transaction so that the delete matches the stored index values
+func (c *dbCache) deleteByID(table, id string) error {
+	txn := c.db.Txn(true)
+	defer txn.Abort()
+	obj, err := txn.First(table, "id", id)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return ErrNotFound
+	}
+	if err := txn.Delete(table, obj); err != nil {
+		return err
+	}
+	if _, err := txn.DeleteAll(revisionTable, "id", revisionKey(table, id)); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (c *dbCache) delete(table, id string, obj any) error {
 	txn := c.db.Txn(true)
 	defer txn.Abort()
 	if err := txn.Delete(table, obj); err != nil {
@@ -519,6 +1431,9 @@ func (c *dbCache) delete(table string, obj any) error {
 		}
 		return err
 	}
+	if _, err := txn.DeleteAll(revisionTable, "id", revisionKey(table, id)); err != nil {
+		return err
+	}
 	txn.Commit()
 	return nil
 }
@@ -541,6 +1456,7 @@ func (r *Route) DeepCopy() *Route {
 		Plugins:  copyPlugins(r.Plugins),
 		Upstream: r.Upstream.DeepCopy(),
 		Timeout:  copyTimeout(r.Timeout),
+		Vars:     copyVars(r.Vars),
 	}
 	if r.URI != nil {
 		uri := *r.URI
@@ -558,6 +1474,10 @@ func (r *Route) DeepCopy() *Route {
 		serviceID := *r.ServiceID
 		copied.ServiceID = &serviceID
 	}
+	if r.Status != nil {
+		status := *r.Status
+		copied.Status = &status
+	}
 	return copied
 }
 
@@ -575,6 +1495,7 @@ func (s *Service) DeepCopy() *Service {
 		upstreamID := *s.UpstreamID
 		copied.UpstreamID = &upstreamID
 	}
+	copied.EnableWebsocket = copyBool(s.EnableWebsocket)
 	return copied
 }
 
@@ -592,6 +1513,8 @@ func (u *Upstream) DeepCopy() *Upstream {
 		Scheme:   u.Scheme,
 		PassHost: u.PassHost,
 		Timeout:  copyTimeout(u.Timeout),
+
+		DNSResolveOnNodes: u.DNSResolveOnNodes,
 	}
 	if u.Retries != nil {
 		retries := *u.Retries
@@ -605,6 +1528,10 @@ func (u *Upstream) DeepCopy() *Upstream {
 		upstreamHost := *u.UpstreamHost
 		copied.UpstreamHost = &upstreamHost
 	}
+	if u.KeepalivePool != nil {
+		keepalivePool := *u.KeepalivePool
+		copied.KeepalivePool = &keepalivePool
+	}
 	return copied
 }
 
@@ -627,6 +1554,28 @@ func (g *GlobalRule) DeepCopy() *GlobalRule {
 	return &GlobalRule{
 		ID:      g.ID,
 		Plugins: copyPlugins(g.Plugins),
+		Labels:  copyLabels(g.Labels),
+	}
+}
+
+func (p *Proto) DeepCopy() *Proto {
+	if p == nil {
+		return nil
+	}
+	return &Proto{
+		Metadata: copyMetadata(p.Metadata),
+		Content:  p.Content,
+	}
+}
+
+func (m *PluginMetadata) DeepCopy() *PluginMetadata {
+	if m == nil {
+		return nil
+	}
+	return &PluginMetadata{
+		ID:     m.ID,
+		Config: copyPlugins(m.Config),
+		Labels: copyLabels(m.Labels),
 	}
 }
 
@@ -644,13 +1593,12 @@ func (a *ActiveCheck) DeepCopy() *ActiveCheck {
 		return nil
 	}
 	copied := &ActiveCheck{
-		Type:                   a.Type,
-		Timeout:                a.Timeout,
-		HTTPPath:               a.HTTPPath,
-		HTTPSVerifyCertificate: a.HTTPSVerifyCertificate,
-		ReqHeaders:             copyStringSlice(a.ReqHeaders),
-		Healthy:                a.Healthy.DeepCopy(),
-		Unhealthy:              a.Unhealthy.DeepCopy(),
+		Type:       a.Type,
+		Timeout:    a.Timeout,
+		HTTPPath:   a.HTTPPath,
+		ReqHeaders: copyStringSlice(a.ReqHeaders),
+		Healthy:    a.Healthy.DeepCopy(),
+		Unhealthy:  a.Unhealthy.DeepCopy(),
 	}
 	if a.Host != nil {
 		host := *a.Host
@@ -660,6 +1608,14 @@ func (a *ActiveCheck) DeepCopy() *ActiveCheck {
 		port := *a.Port
 		copied.Port = &port
 	}
+	if a.HTTPSVerifyCertificate != nil {
+		verify := *a.HTTPSVerifyCertificate
+		copied.HTTPSVerifyCertificate = &verify
+	}
+	if a.HTTPSSni != nil {
+		sni := *a.HTTPSSni
+		copied.HTTPSSni = &sni
+	}
 	return copied
 }
 
@@ -707,11 +1663,57 @@ func copyPlugins(plugins map[string]any) map[string]any {
 	if plugins == nil {
 		return nil
 	}
-	// Note: This is a shallow copy of the map
-	// For deep copy of plugin configs, we'd need to serialize/deserialize
 	copied := make(map[string]any, len(plugins))
 	for k, v := range plugins {
-		copied[k] = v
+		copied[k] = copyValue(v)
+	}
+	return copied
+}
+
+// copyValue deep copies the maps and slices of a decoded JSON value, such as
+// a plugin config, so that copies share none of their nested values
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		if t == nil {
+			return t
+		}
+		copied := make(map[string]any, len(t))
+		for k, item := range t {
+			copied[k] = copyValue(item)
+		}
+		return copied
+	case []any:
+		if t == nil {
+			return t
+		}
+		copied := make([]any, len(t))
+		for i, item := range t {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	case map[string]string:
+		return copyLabels(t)
+	case []string:
+		return copyStringSlice(t)
+	default:
+		return v
+	}
+}
+
+func copyVars(vars adc.Vars) adc.Vars {
+	if vars == nil {
+		return nil
+	}
+	copied := make(adc.Vars, len(vars))
+	for i, expr := range vars {
+		if expr == nil {
+			continue
+		}
+		copied[i] = make([]adc.StringOrSlice, len(expr))
+		for j := range expr {
+			expr[j].DeepCopyInto(&copied[i][j])
+		}
 	}
 	return copied
 }
@@ -727,6 +1729,14 @@ func copyTimeout(t *Timeout) *Timeout {
 	}
 }
 
+func copyBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	copied := *b
+	return &copied
+}
+
 func copyNodes(nodes map[string]uint32) map[string]uint32 {
 	if nodes == nil {
 		return nil
@@ -1,9 +1,19 @@
 package kine
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine/testutil"
 	"github.com/apache/apisix-ingress-controller/internal/controller/label"
 )
 
@@ -11,6 +21,32 @@ const (
 	testRouteID = "route-1"
 )
 
+// cacheImplementations lists the Cache backends the cache tests run against
+var cacheImplementations = []struct {
+	name     string
+	newCache func(t *testing.T) (Cache, error)
+}{
+	{
+		name: "memdb",
+		newCache: func(_ *testing.T) (Cache, error) {
+			return NewMemDBCache()
+		},
+	},
+	{
+		name: "bolt",
+		newCache: func(t *testing.T) (Cache, error) {
+			cache, err := NewBoltCache(filepath.Join(t.TempDir(), "kine.db"))
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() {
+				_ = cache.(io.Closer).Close()
+			})
+			return cache, nil
+		},
+	},
+}
+
 func TestNewMemDBCache(t *testing.T) {
 	cache, err := NewMemDBCache()
 	if err != nil {
@@ -22,487 +58,1596 @@ func TestNewMemDBCache(t *testing.T) {
 }
 
 func TestCacheRoute(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Create a test route
-	route := &Route{
-		Metadata: adc.Metadata{
-			ID:   testRouteID,
-			Name: "test-route",
-			Labels: map[string]string{
-				label.LabelKind:      "Ingress",
-				label.LabelNamespace: "default",
-				label.LabelName:      "test",
-			},
-		},
-		URIs:    []string{"/api"},
-		Methods: []Method{MethodGET, MethodPOST},
-	}
+			// Create a test route
+			route := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: "test-route",
+					Labels: map[string]string{
+						label.LabelKind:      "Ingress",
+						label.LabelNamespace: "default",
+						label.LabelName:      "test",
+					},
+				},
+				URIs:    []string{"/api"},
+				Methods: []Method{MethodGET, MethodPOST},
+			}
 
-	// Test Insert
-	err = cache.InsertRoute(route)
-	if err != nil {
-		t.Fatalf("Failed to insert route: %v", err)
-	}
+			// Test Insert
+			err = cache.InsertRoute(route)
+			if err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
 
-	// Test Get
-	retrieved, err := cache.GetRoute(testRouteID)
-	if err != nil {
-		t.Fatalf("Failed to get route: %v", err)
-	}
-	if retrieved.ID != testRouteID {
-		t.Errorf("Expected ID %q, got %q", testRouteID, retrieved.ID)
-	}
-	if retrieved.Name != "test-route" {
-		t.Errorf("Expected Name 'test-route', got '%s'", retrieved.Name)
-	}
+			// Test Get
+			retrieved, err := cache.GetRoute(testRouteID)
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if retrieved.ID != testRouteID {
+				t.Errorf("Expected ID %q, got %q", testRouteID, retrieved.ID)
+			}
+			if retrieved.Name != "test-route" {
+				t.Errorf("Expected Name 'test-route', got '%s'", retrieved.Name)
+			}
 
-	// Test List
-	routes, err := cache.ListRoutes()
-	if err != nil {
-		t.Fatalf("Failed to list routes: %v", err)
-	}
-	if len(routes) != 1 {
-		t.Errorf("Expected 1 route, got %d", len(routes))
-	}
+			// Test List
+			routes, err := cache.ListRoutes()
+			if err != nil {
+				t.Fatalf("Failed to list routes: %v", err)
+			}
+			if len(routes) != 1 {
+				t.Errorf("Expected 1 route, got %d", len(routes))
+			}
 
-	// Test Delete
-	err = cache.DeleteRoute(route)
-	if err != nil {
-		t.Fatalf("Failed to delete route: %v", err)
-	}
+			// Test Delete
+			err = cache.DeleteRoute(route)
+			if err != nil {
+				t.Fatalf("Failed to delete route: %v", err)
+			}
 
-	// Verify deletion
-	_, err = cache.GetRoute(testRouteID)
-	if err != ErrNotFound {
-		t.Error("Expected ErrNotFound after deletion")
+			// Verify deletion
+			_, err = cache.GetRoute(testRouteID)
+			if err != ErrNotFound {
+				t.Error("Expected ErrNotFound after deletion")
+			}
+		})
 	}
 }
 
 func TestCacheService(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Create a test service
-	service := &Service{
-		Metadata: adc.Metadata{
-			ID:   "service-1",
-			Name: "test-service",
-			Labels: map[string]string{
-				label.LabelKind:      "Service",
-				label.LabelNamespace: "default",
-				label.LabelName:      "my-service",
-			},
-		},
-		Hosts: []string{"example.com"},
-	}
+			// Create a test service
+			service := &Service{
+				Metadata: adc.Metadata{
+					ID:   "service-1",
+					Name: "test-service",
+					Labels: map[string]string{
+						label.LabelKind:      "Service",
+						label.LabelNamespace: "default",
+						label.LabelName:      "my-service",
+					},
+				},
+				Hosts: []string{"example.com"},
+			}
 
-	// Test Insert
-	err = cache.InsertService(service)
-	if err != nil {
-		t.Fatalf("Failed to insert service: %v", err)
-	}
+			// Test Insert
+			err = cache.InsertService(service)
+			if err != nil {
+				t.Fatalf("Failed to insert service: %v", err)
+			}
 
-	// Test Get
-	retrieved, err := cache.GetService("service-1")
-	if err != nil {
-		t.Fatalf("Failed to get service: %v", err)
-	}
-	if retrieved.ID != "service-1" {
-		t.Errorf("Expected ID 'service-1', got '%s'", retrieved.ID)
-	}
+			// Test Get
+			retrieved, err := cache.GetService("service-1")
+			if err != nil {
+				t.Fatalf("Failed to get service: %v", err)
+			}
+			if retrieved.ID != "service-1" {
+				t.Errorf("Expected ID 'service-1', got '%s'", retrieved.ID)
+			}
 
-	// Test List
-	services, err := cache.ListServices()
-	if err != nil {
-		t.Fatalf("Failed to list services: %v", err)
-	}
-	if len(services) != 1 {
-		t.Errorf("Expected 1 service, got %d", len(services))
-	}
+			// Test List
+			services, err := cache.ListServices()
+			if err != nil {
+				t.Fatalf("Failed to list services: %v", err)
+			}
+			if len(services) != 1 {
+				t.Errorf("Expected 1 service, got %d", len(services))
+			}
 
-	// Test Delete
-	err = cache.DeleteService(service)
-	if err != nil {
-		t.Fatalf("Failed to delete service: %v", err)
+			// Test Delete
+			err = cache.DeleteService(service)
+			if err != nil {
+				t.Fatalf("Failed to delete service: %v", err)
+			}
+		})
 	}
 }
 
 func TestCacheUpstream(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Create a test upstream
-	upstream := &Upstream{
-		Metadata: adc.Metadata{
-			ID:   "upstream-1",
-			Name: "test-upstream",
-		},
-		Nodes: map[string]uint32{
-			"127.0.0.1:8080": 100,
-		},
-		Type: SelectionTypeRoundRobin,
-	}
+			// Create a test upstream
+			upstream := &Upstream{
+				Metadata: adc.Metadata{
+					ID:   "upstream-1",
+					Name: "test-upstream",
+				},
+				Nodes: map[string]uint32{
+					"127.0.0.1:8080": 100,
+				},
+				Type: SelectionTypeRoundRobin,
+			}
 
-	// Test Insert
-	err = cache.InsertUpstream(upstream)
-	if err != nil {
-		t.Fatalf("Failed to insert upstream: %v", err)
-	}
+			// Test Insert
+			err = cache.InsertUpstream(upstream)
+			if err != nil {
+				t.Fatalf("Failed to insert upstream: %v", err)
+			}
 
-	// Test Get
-	retrieved, err := cache.GetUpstream("upstream-1")
-	if err != nil {
-		t.Fatalf("Failed to get upstream: %v", err)
-	}
-	if retrieved.ID != "upstream-1" {
-		t.Errorf("Expected ID 'upstream-1', got '%s'", retrieved.ID)
-	}
+			// Test Get
+			retrieved, err := cache.GetUpstream("upstream-1")
+			if err != nil {
+				t.Fatalf("Failed to get upstream: %v", err)
+			}
+			if retrieved.ID != "upstream-1" {
+				t.Errorf("Expected ID 'upstream-1', got '%s'", retrieved.ID)
+			}
 
-	// Test List
-	upstreams, err := cache.ListUpstreams()
-	if err != nil {
-		t.Fatalf("Failed to list upstreams: %v", err)
-	}
-	if len(upstreams) != 1 {
-		t.Errorf("Expected 1 upstream, got %d", len(upstreams))
-	}
+			// Test List
+			upstreams, err := cache.ListUpstreams()
+			if err != nil {
+				t.Fatalf("Failed to list upstreams: %v", err)
+			}
+			if len(upstreams) != 1 {
+				t.Errorf("Expected 1 upstream, got %d", len(upstreams))
+			}
 
-	// Test Delete
-	err = cache.DeleteUpstream(upstream)
-	if err != nil {
-		t.Fatalf("Failed to delete upstream: %v", err)
+			// Test Delete
+			err = cache.DeleteUpstream(upstream)
+			if err != nil {
+				t.Fatalf("Failed to delete upstream: %v", err)
+			}
+		})
 	}
 }
 
 func TestCacheSSL(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Create a test SSL
-	ssl := &SSL{
-		Metadata: adc.Metadata{
-			ID:   "ssl-1",
-			Name: "test-ssl",
-			Labels: map[string]string{
-				label.LabelKind:      "Secret",
-				label.LabelNamespace: "default",
-				label.LabelName:      "tls-secret",
-			},
-		},
-		Cert: "cert-data",
-		Key:  "key-data",
-		SNIs: []string{"example.com"},
-	}
+			// Create a test SSL
+			ssl := &SSL{
+				Metadata: adc.Metadata{
+					ID:   "ssl-1",
+					Name: "test-ssl",
+					Labels: map[string]string{
+						label.LabelKind:      "Secret",
+						label.LabelNamespace: "default",
+						label.LabelName:      "tls-secret",
+					},
+				},
+				Cert: "cert-data",
+				Key:  "key-data",
+				SNIs: []string{"example.com"},
+			}
 
-	// Test Insert
-	err = cache.InsertSSL(ssl)
-	if err != nil {
-		t.Fatalf("Failed to insert SSL: %v", err)
-	}
+			// Test Insert
+			err = cache.InsertSSL(ssl)
+			if err != nil {
+				t.Fatalf("Failed to insert SSL: %v", err)
+			}
 
-	// Test Get
-	retrieved, err := cache.GetSSL("ssl-1")
-	if err != nil {
-		t.Fatalf("Failed to get SSL: %v", err)
-	}
-	if retrieved.ID != "ssl-1" {
-		t.Errorf("Expected ID 'ssl-1', got '%s'", retrieved.ID)
-	}
+			// Test Get
+			retrieved, err := cache.GetSSL("ssl-1")
+			if err != nil {
+				t.Fatalf("Failed to get SSL: %v", err)
+			}
+			if retrieved.ID != "ssl-1" {
+				t.Errorf("Expected ID 'ssl-1', got '%s'", retrieved.ID)
+			}
 
-	// Test List
-	ssls, err := cache.ListSSL()
-	if err != nil {
-		t.Fatalf("Failed to list SSLs: %v", err)
-	}
-	if len(ssls) != 1 {
-		t.Errorf("Expected 1 SSL, got %d", len(ssls))
-	}
+			// Test List
+			ssls, err := cache.ListSSL()
+			if err != nil {
+				t.Fatalf("Failed to list SSLs: %v", err)
+			}
+			if len(ssls) != 1 {
+				t.Errorf("Expected 1 SSL, got %d", len(ssls))
+			}
 
-	// Test Delete
-	err = cache.DeleteSSL(ssl)
-	if err != nil {
-		t.Fatalf("Failed to delete SSL: %v", err)
+			// Test Delete
+			err = cache.DeleteSSL(ssl)
+			if err != nil {
+				t.Fatalf("Failed to delete SSL: %v", err)
+			}
+		})
 	}
 }
 
 func TestCacheGlobalRule(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Create a test global rule
-	globalRule := &GlobalRule{
-		ID: "cors",
-		Plugins: map[string]any{
-			"cors": map[string]any{
-				"allow_origins": "**",
-			},
-		},
+			// Create a test global rule
+			globalRule := &GlobalRule{
+				ID: "cors",
+				Plugins: map[string]any{
+					"cors": map[string]any{
+						"allow_origins": "**",
+					},
+				},
+			}
+
+			// Test Insert
+			err = cache.InsertGlobalRule(globalRule)
+			if err != nil {
+				t.Fatalf("Failed to insert global rule: %v", err)
+			}
+
+			// Test Get
+			retrieved, err := cache.GetGlobalRule("cors")
+			if err != nil {
+				t.Fatalf("Failed to get global rule: %v", err)
+			}
+			if retrieved.ID != "cors" {
+				t.Errorf("Expected ID 'cors', got '%s'", retrieved.ID)
+			}
+
+			// Test List
+			globalRules, err := cache.ListGlobalRules()
+			if err != nil {
+				t.Fatalf("Failed to list global rules: %v", err)
+			}
+			if len(globalRules) != 1 {
+				t.Errorf("Expected 1 global rule, got %d", len(globalRules))
+			}
+
+			// Test Delete
+			err = cache.DeleteGlobalRule(globalRule)
+			if err != nil {
+				t.Fatalf("Failed to delete global rule: %v", err)
+			}
+		})
 	}
+}
 
-	// Test Insert
-	err = cache.InsertGlobalRule(globalRule)
-	if err != nil {
-		t.Fatalf("Failed to insert global rule: %v", err)
+// testProtoContent is a small protobuf definition for proto tests
+const testProtoContent = `syntax = "proto3";
+package helloworld;
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply) {}
+}
+message HelloRequest {
+  string name = 1;
+}
+message HelloReply {
+  string message = 1;
+}`
+
+func TestCacheProto(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			proto := &Proto{
+				Metadata: adc.Metadata{
+					ID:     "helloworld",
+					Name:   "helloworld",
+					Labels: map[string]string{label.LabelKind: "ApisixRoute", label.LabelNamespace: "default", label.LabelName: "grpc"},
+				},
+				Content: testProtoContent,
+			}
+			if err := cache.Insert(proto); err != nil {
+				t.Fatalf("Failed to insert proto: %v", err)
+			}
+
+			retrieved, err := cache.GetProto("helloworld")
+			if err != nil {
+				t.Fatalf("Failed to get proto: %v", err)
+			}
+			if retrieved.Content != testProtoContent {
+				t.Errorf("Expected the proto content to round trip, got %q", retrieved.Content)
+			}
+
+			protos, err := cache.ListProtos(&KindLabelSelector{Kind: "ApisixRoute", Namespace: "default", Name: "grpc"})
+			if err != nil {
+				t.Fatalf("Failed to list protos: %v", err)
+			}
+			if len(protos) != 1 {
+				t.Errorf("Expected 1 proto, got %d", len(protos))
+			}
+
+			if err := DeleteByID(cache, ResourceTypeProto, "helloworld"); err != nil {
+				t.Fatalf("Failed to delete proto: %v", err)
+			}
+			if _, err := cache.GetProto("helloworld"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+		})
 	}
+}
 
-	// Test Get
-	retrieved, err := cache.GetGlobalRule("cors")
-	if err != nil {
-		t.Fatalf("Failed to get global rule: %v", err)
+func TestCachePluginMetadata(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			metadata := &PluginMetadata{
+				ID:     "http-logger",
+				Config: map[string]any{"log_format": map[string]any{"host": "$host"}, "name": "access"},
+				Labels: map[string]string{label.LabelKind: "GatewayProxy", label.LabelNamespace: "default", label.LabelName: "gw"},
+			}
+			if err := cache.Insert(metadata); err != nil {
+				t.Fatalf("Failed to insert plugin metadata: %v", err)
+			}
+
+			retrieved, err := cache.GetPluginMetadata("http-logger")
+			if err != nil {
+				t.Fatalf("Failed to get plugin metadata: %v", err)
+			}
+			if !arePluginMetadataEqual(retrieved, metadata) {
+				t.Errorf("Expected the plugin metadata to round trip, got %+v", retrieved)
+			}
+
+			listed, err := cache.ListPluginMetadata(&KindLabelSelector{Kind: "GatewayProxy", Namespace: "default", Name: "gw"})
+			if err != nil {
+				t.Fatalf("Failed to list plugin metadata: %v", err)
+			}
+			if len(listed) != 1 {
+				t.Errorf("Expected 1 plugin metadata, got %d", len(listed))
+			}
+			// Plugin metadata has no name, a name field of the config does
+			// not count as one
+			listed, err = cache.ListPluginMetadata(&ListOptions{Name: "access"})
+			if err != nil {
+				t.Fatalf("Failed to list plugin metadata by name: %v", err)
+			}
+			if len(listed) != 0 {
+				t.Errorf("Expected no plugin metadata listed by name, got %d", len(listed))
+			}
+
+			if err := DeleteByID(cache, ResourceTypePluginMetadata, "http-logger"); err != nil {
+				t.Fatalf("Failed to delete plugin metadata: %v", err)
+			}
+			if _, err := cache.GetPluginMetadata("http-logger"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+		})
 	}
-	if retrieved.ID != "cors" {
-		t.Errorf("Expected ID 'cors', got '%s'", retrieved.ID)
+}
+
+func TestCacheListWithLabelSelector(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			// Insert routes with different labels
+			route1 := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: testRouteID,
+					Labels: map[string]string{
+						label.LabelKind:      "Ingress",
+						label.LabelNamespace: "default",
+						label.LabelName:      "ing-1",
+					},
+				},
+				URIs: []string{"/api1"},
+			}
+
+			route2 := &Route{
+				Metadata: adc.Metadata{
+					ID:   "route-2",
+					Name: "route-2",
+					Labels: map[string]string{
+						label.LabelKind:      "Ingress",
+						label.LabelNamespace: "default",
+						label.LabelName:      "ing-2",
+					},
+				},
+				URIs: []string{"/api2"},
+			}
+
+			route3 := &Route{
+				Metadata: adc.Metadata{
+					ID:   "route-3",
+					Name: "route-3",
+					Labels: map[string]string{
+						label.LabelKind:      "Ingress",
+						label.LabelNamespace: "kube-system",
+						label.LabelName:      "ing-3",
+					},
+				},
+				URIs: []string{"/api3"},
+			}
+
+			if err := cache.InsertRoute(route1); err != nil {
+				t.Fatalf("Failed to insert route1: %v", err)
+			}
+			if err := cache.InsertRoute(route2); err != nil {
+				t.Fatalf("Failed to insert route2: %v", err)
+			}
+			if err := cache.InsertRoute(route3); err != nil {
+				t.Fatalf("Failed to insert route3: %v", err)
+			}
+
+			// List all routes
+			allRoutes, err := cache.ListRoutes()
+			if err != nil {
+				t.Fatalf("Failed to list all routes: %v", err)
+			}
+			if len(allRoutes) != 3 {
+				t.Errorf("Expected 3 routes, got %d", len(allRoutes))
+			}
+
+			// List routes with label selector (default namespace)
+			selector := &KindLabelSelector{
+				Kind:      "Ingress",
+				Namespace: "default",
+				Name:      "ing-1",
+			}
+			filteredRoutes, err := cache.ListRoutes(selector)
+			if err != nil {
+				t.Fatalf("Failed to list filtered routes: %v", err)
+			}
+			if len(filteredRoutes) != 1 {
+				t.Errorf("Expected 1 route, got %d", len(filteredRoutes))
+			}
+			if filteredRoutes[0].ID != testRouteID {
+				t.Errorf("Expected %s, got %s", testRouteID, filteredRoutes[0].ID)
+			}
+
+			// Kinds match case-insensitively
+			selector.Kind = "ingress"
+			filteredRoutes, err = cache.ListRoutes(selector)
+			if err != nil {
+				t.Fatalf("Failed to list filtered routes: %v", err)
+			}
+			if len(filteredRoutes) != 1 || filteredRoutes[0].ID != testRouteID {
+				t.Errorf("Expected %s with a lowercase kind, got %v", testRouteID, filteredRoutes)
+			}
+
+			// Empty values of full selectors only match empty labels
+			filteredRoutes, err = cache.ListRoutes(&KindLabelSelector{Kind: "Ingress"})
+			if err != nil {
+				t.Fatalf("Failed to list filtered routes: %v", err)
+			}
+			if len(filteredRoutes) != 0 {
+				t.Errorf("Expected no route for a full selector with empty values, got %d", len(filteredRoutes))
+			}
+
+			// Partial selectors list across namespaces and names
+			for _, tc := range []struct {
+				selector *KindLabelSelector
+				want     int
+			}{
+				{&KindLabelSelector{Kind: "ingress", Partial: true}, 3},
+				{&KindLabelSelector{Kind: "Ingress", Namespace: "default", Partial: true}, 2},
+				{&KindLabelSelector{Kind: "Ingress", Namespace: "kube-system", Name: "ing-3", Partial: true}, 1},
+				{&KindLabelSelector{Kind: "Gateway", Partial: true}, 0},
+			} {
+				filteredRoutes, err := cache.ListRoutes(tc.selector)
+				if err != nil {
+					t.Fatalf("Failed to list routes of %+v: %v", tc.selector, err)
+				}
+				if len(filteredRoutes) != tc.want {
+					t.Errorf("Expected %d routes for %+v, got %d", tc.want, tc.selector, len(filteredRoutes))
+				}
+			}
+			named, err := cache.ListRoutesByName("route-2", &KindLabelSelector{Kind: "Ingress", Partial: true})
+			if err != nil {
+				t.Fatalf("Failed to list routes by name: %v", err)
+			}
+			if len(named) != 1 || named[0].ID != "route-2" {
+				t.Errorf("Expected route-2 by name and kind, got %v", named)
+			}
+			if _, err := cache.ListRoutes(&KindLabelSelector{Kind: "Ingress", Name: "ing-1", Partial: true}); err == nil {
+				t.Error("Expected an error for a partial selector with a name but no namespace")
+			}
+		})
 	}
+}
 
-	// Test List
-	globalRules, err := cache.ListGlobalRules()
+func TestLabelIndexerFromArgs(t *testing.T) {
+	full, err := KineLabelIndexer.FromArgs("Ingress", "default", "ing")
 	if err != nil {
-		t.Fatalf("Failed to list global rules: %v", err)
+		t.Fatalf("Failed to build key: %v", err)
 	}
-	if len(globalRules) != 1 {
-		t.Errorf("Expected 1 global rule, got %d", len(globalRules))
+	if string(full) != "ingress/default/ing\x00" {
+		t.Errorf("Unexpected full key %q", full)
 	}
-
-	// Test Delete
-	err = cache.DeleteGlobalRule(globalRule)
+	prefix, err := KineLabelIndexer.FromArgs("Ingress")
 	if err != nil {
-		t.Fatalf("Failed to delete global rule: %v", err)
+		t.Fatalf("Failed to build prefix: %v", err)
+	}
+	if !bytes.HasPrefix(full, prefix) || string(prefix) != "ingress/" {
+		t.Errorf("Expected a prefix of %q, got %q", full, prefix)
+	}
+	for _, args := range [][]any{nil, {"a", "b", "c", "d"}} {
+		_, err := KineLabelIndexer.FromArgs(args...)
+		if err == nil || !strings.Contains(err.Error(), "label selector needs 1 to 3 values") {
+			t.Errorf("Expected an arity error for %d values, got %v", len(args), err)
+		}
 	}
 }
 
-func TestCacheListWithLabelSelector(t *testing.T) {
-	cache, err := NewMemDBCache()
-	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+func TestCacheListByName(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
 
-	// Insert routes with different labels
-	route1 := &Route{
-		Metadata: adc.Metadata{
-			ID:   testRouteID,
-			Name: testRouteID,
-			Labels: map[string]string{
-				label.LabelKind:      "Ingress",
-				label.LabelNamespace: "default",
-				label.LabelName:      "ing-1",
-			},
-		},
-		URIs: []string{"/api1"},
+			// Two routes share a name, one has its own
+			for i, name := range []string{"shared", "shared", "other"} {
+				route := &Route{
+					Metadata: adc.Metadata{
+						ID:   fmt.Sprintf("route-%d", i),
+						Name: name,
+						Labels: map[string]string{
+							label.LabelKind:      "Ingress",
+							label.LabelNamespace: "default",
+							label.LabelName:      fmt.Sprintf("ing-%d", i),
+						},
+					},
+				}
+				if err := cache.InsertRoute(route); err != nil {
+					t.Fatalf("Failed to insert route: %v", err)
+				}
+			}
+			service := &Service{Metadata: adc.Metadata{ID: "service-1", Name: "shared"}}
+			if err := cache.InsertService(service); err != nil {
+				t.Fatalf("Failed to insert service: %v", err)
+			}
+
+			routes, err := cache.ListRoutesByName("shared")
+			if err != nil {
+				t.Fatalf("Failed to list routes by name: %v", err)
+			}
+			if len(routes) != 2 {
+				t.Fatalf("Expected 2 routes named shared, got %d", len(routes))
+			}
+			for _, route := range routes {
+				if route.Name != "shared" {
+					t.Errorf("Expected route named shared, got %s", route.Name)
+				}
+			}
+
+			// The label selector narrows the name lookup
+			routes, err = cache.ListRoutesByName("shared", &KindLabelSelector{
+				Kind:      "Ingress",
+				Namespace: "default",
+				Name:      "ing-1",
+			})
+			if err != nil {
+				t.Fatalf("Failed to list routes by name and label: %v", err)
+			}
+			if len(routes) != 1 || routes[0].ID != "route-1" {
+				t.Errorf("Expected route-1, got %v", routes)
+			}
+
+			services, err := cache.ListServicesByName("shared")
+			if err != nil {
+				t.Fatalf("Failed to list services by name: %v", err)
+			}
+			if len(services) != 1 || services[0].ID != "service-1" {
+				t.Errorf("Expected service-1, got %v", services)
+			}
+
+			// Unknown names yield no objects and no error
+			routes, err = cache.ListRoutesByName("missing")
+			if err != nil {
+				t.Fatalf("Expected no error for an unknown name, got %v", err)
+			}
+			if len(routes) != 0 {
+				t.Errorf("Expected no routes, got %d", len(routes))
+			}
+			upstreams, err := cache.ListUpstreamsByName("shared")
+			if err != nil {
+				t.Fatalf("Failed to list upstreams by name: %v", err)
+			}
+			if len(upstreams) != 0 {
+				t.Errorf("Expected no upstreams, got %d", len(upstreams))
+			}
+
+			// Renamed objects leave the old name
+			renamed := &Route{Metadata: adc.Metadata{ID: "route-2", Name: "shared"}}
+			if err := cache.InsertRoute(renamed); err != nil {
+				t.Fatalf("Failed to rename route: %v", err)
+			}
+			routes, err = cache.ListRoutesByName("other")
+			if err != nil {
+				t.Fatalf("Failed to list routes by name: %v", err)
+			}
+			if len(routes) != 0 {
+				t.Errorf("Expected no routes named other after the rename, got %d", len(routes))
+			}
+		})
 	}
+}
 
-	route2 := &Route{
-		Metadata: adc.Metadata{
-			ID:   "route-2",
-			Name: "route-2",
-			Labels: map[string]string{
+func TestCacheListRoutesByHost(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			single := "single.example.org"
+			ingressLabels := map[string]string{
 				label.LabelKind:      "Ingress",
 				label.LabelNamespace: "default",
-				label.LabelName:      "ing-2",
-			},
-		},
-		URIs: []string{"/api2"},
-	}
+				label.LabelName:      "ing",
+			}
+			for _, route := range []*Route{
+				{Metadata: adc.Metadata{ID: "exact", Labels: ingressLabels},
+					Hosts: []string{"api.example.com", "api.example.net"}},
+				{Metadata: adc.Metadata{ID: "wildcard", Labels: map[string]string{label.LabelKind: "HTTPRoute"}},
+					Hosts: []string{"*.example.com"}},
+				{Metadata: adc.Metadata{ID: "single"}, Host: &single},
+				{Metadata: adc.Metadata{ID: "both"}, Host: &single, Hosts: []string{"single.example.org", "other.org"}},
+				{Metadata: adc.Metadata{ID: "none"}},
+			} {
+				if err := cache.InsertRoute(route); err != nil {
+					t.Fatalf("Failed to insert route: %v", err)
+				}
+			}
 
-	route3 := &Route{
-		Metadata: adc.Metadata{
-			ID:   "route-3",
-			Name: "route-3",
-			Labels: map[string]string{
-				label.LabelKind:      "Ingress",
-				label.LabelNamespace: "kube-system",
-				label.LabelName:      "ing-3",
-			},
-		},
-		URIs: []string{"/api3"},
-	}
+			tests := []struct {
+				host string
+				opts []ListOption
+				want []string
+			}{
+				{host: "api.example.com", want: []string{"exact", "wildcard"}},
+				{host: "API.Example.com.", want: []string{"exact", "wildcard"}},
+				{host: "api.example.net", want: []string{"exact"}},
+				{host: "www.example.com", want: []string{"wildcard"}},
+				{host: "a.b.example.com", want: []string{"wildcard"}},
+				{host: "*.example.com", want: []string{"wildcard"}},
+				{host: "example.com"},
+				{host: "single.example.org", want: []string{"both", "single"}},
+				{host: "other.org", want: []string{"both"}},
+				{host: ""},
+				{
+					host: "api.example.com",
+					opts: []ListOption{&KindLabelSelector{Kind: "ingress", Namespace: "default", Name: "ing"}},
+					want: []string{"exact"},
+				},
+			}
+			for _, tt := range tests {
+				routes, err := cache.ListRoutesByHost(tt.host, tt.opts...)
+				if err != nil {
+					t.Fatalf("Failed to list routes by host %q: %v", tt.host, err)
+				}
+				var ids []string
+				for _, route := range routes {
+					ids = append(ids, route.ID)
+				}
+				slices.Sort(ids)
+				if !slices.Equal(ids, tt.want) {
+					t.Errorf("Host %q: expected routes %v, got %v", tt.host, tt.want, ids)
+				}
+			}
 
-	if err := cache.InsertRoute(route1); err != nil {
-		t.Fatalf("Failed to insert route1: %v", err)
+			// Results are copies unless WithoutCopy is given
+			routes, err := cache.ListRoutesByHost("api.example.net")
+			if err != nil || len(routes) != 1 {
+				t.Fatalf("Failed to list routes by host: %v", err)
+			}
+			routes[0].Hosts[0] = "mutated.example.com"
+			stored, err := cache.GetRoute("exact")
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if stored.Hosts[0] != "api.example.com" {
+				t.Errorf("Expected the cached route to be unchanged, got hosts %v", stored.Hosts)
+			}
+
+			// The index follows updates of the hosts
+			stored.Hosts = []string{"new.example.net"}
+			if err := cache.InsertRoute(stored); err != nil {
+				t.Fatalf("Failed to update route: %v", err)
+			}
+			if routes, _ := cache.ListRoutesByHost("api.example.net"); len(routes) != 0 {
+				t.Errorf("Expected no route for the old host, got %d", len(routes))
+			}
+			if routes, _ := cache.ListRoutesByHost("new.example.net"); len(routes) != 1 {
+				t.Errorf("Expected the route under its new host, got %d", len(routes))
+			}
+		})
 	}
-	if err := cache.InsertRoute(route2); err != nil {
-		t.Fatalf("Failed to insert route2: %v", err)
+}
+
+func TestCacheGenericInsertDelete(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			// Test generic Insert
+			route := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: "test-route",
+				},
+				URIs: []string{"/test"},
+			}
+
+			err = cache.Insert(route)
+			if err != nil {
+				t.Fatalf("Failed to insert via generic Insert: %v", err)
+			}
+
+			// Verify insertion
+			retrieved, err := cache.GetRoute(testRouteID)
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if retrieved.ID != testRouteID {
+				t.Errorf("Expected ID %q, got %q", testRouteID, retrieved.ID)
+			}
+
+			// Test generic Delete
+			err = cache.Delete(route)
+			if err != nil {
+				t.Fatalf("Failed to delete via generic Delete: %v", err)
+			}
+
+			// Verify deletion
+			_, err = cache.GetRoute(testRouteID)
+			if err != ErrNotFound {
+				t.Error("Expected ErrNotFound after deletion")
+			}
+		})
 	}
-	if err := cache.InsertRoute(route3); err != nil {
-		t.Fatalf("Failed to insert route3: %v", err)
+}
+
+func TestCacheDeleteByID(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			stored := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: "current-name",
+					Labels: map[string]string{
+						label.LabelKind:      "Ingress",
+						label.LabelNamespace: "default",
+						label.LabelName:      "current",
+					},
+				},
+				URIs: []string{"/test"},
+			}
+			if err := cache.InsertRoute(stored); err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+			// A stale copy differs from the stored route in its indexed fields
+			stale := stored.DeepCopy()
+			stale.Name = "stale-name"
+			stale.Labels = map[string]string{label.LabelKind: "Ingress", label.LabelName: "stale"}
+
+			if err := DeleteByID(cache, ResourceTypeRoute, stale.ID); err != nil {
+				t.Fatalf("Failed to delete route by id: %v", err)
+			}
+			if _, err := cache.GetRoute(testRouteID); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound after deletion, got %v", err)
+			}
+			for _, name := range []string{"current-name", "stale-name"} {
+				routes, err := cache.ListRoutesByName(name)
+				if err != nil {
+					t.Fatalf("Failed to list routes by name: %v", err)
+				}
+				if len(routes) != 0 {
+					t.Errorf("Expected no route named %q, got %d", name, len(routes))
+				}
+			}
+			routes, err := cache.ListRoutes(&KindLabelSelector{Kind: "Ingress", Namespace: "default", Name: "current"})
+			if err != nil {
+				t.Fatalf("Failed to list routes by labels: %v", err)
+			}
+			if len(routes) != 0 {
+				t.Errorf("Expected the label index entry to be removed, got %d routes", len(routes))
+			}
+
+			if err := cache.DeleteRouteByID(testRouteID); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound deleting a missing route, got %v", err)
+			}
+			for _, resourceType := range []ResourceType{
+				ResourceTypeService, ResourceTypeUpstream, ResourceTypeSSL, ResourceTypeGlobalRule,
+			} {
+				if err := DeleteByID(cache, resourceType, "missing"); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound deleting a missing %s, got %v", resourceType, err)
+				}
+			}
+			if err := DeleteByID(cache, "plugins", "missing"); !errors.Is(err, ErrUnknownResourceType) {
+				t.Errorf("Expected ErrUnknownResourceType, got %v", err)
+			}
+		})
 	}
+}
 
-	// List all routes
-	allRoutes, err := cache.ListRoutes()
-	if err != nil {
-		t.Fatalf("Failed to list all routes: %v", err)
+func TestCacheReset(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			labels := map[string]string{
+				label.LabelKind:      "Ingress",
+				label.LabelNamespace: "default",
+				label.LabelName:      "ing-1",
+			}
+			insertAll := func() {
+				t.Helper()
+				for _, obj := range []any{
+					&Route{Metadata: adc.Metadata{ID: testRouteID, Name: testRouteID, Labels: labels}},
+					&Service{Metadata: adc.Metadata{ID: "svc-1", Name: "svc-1", Labels: labels}},
+					&Upstream{Metadata: adc.Metadata{ID: "ups-1", Name: "ups-1", Labels: labels}},
+					&SSL{Metadata: adc.Metadata{ID: "ssl-1", Name: "ssl-1", Labels: labels}},
+					&GlobalRule{ID: "prometheus", Labels: labels},
+				} {
+					if err := cache.Insert(obj); err != nil {
+						t.Fatalf("Failed to insert %T: %v", obj, err)
+					}
+				}
+			}
+			selector := &KindLabelSelector{Kind: "Ingress", Namespace: "default", Name: "ing-1"}
+			insertAll()
+
+			// Resetting one table leaves the others intact
+			if err := cache.ResetTable(ResourceTypeRoute); err != nil {
+				t.Fatalf("Failed to reset route table: %v", err)
+			}
+			if routes, err := cache.ListRoutes(selector); err != nil || len(routes) != 0 {
+				t.Errorf("Expected no routes after the reset, got %d (%v)", len(routes), err)
+			}
+			if _, err := cache.GetService("svc-1"); err != nil {
+				t.Errorf("Expected the service to stay cached: %v", err)
+			}
+			if services, err := cache.ListServices(selector); err != nil || len(services) != 1 {
+				t.Errorf("Expected the service label index to stay intact, got %d (%v)", len(services), err)
+			}
+			if err := cache.ResetTable("plugins"); !errors.Is(err, ErrUnknownResourceType) {
+				t.Errorf("Expected ErrUnknownResourceType, got %v", err)
+			}
+
+			// Resetting everything empties all tables and their indexes
+			if err := cache.Reset(); err != nil {
+				t.Fatalf("Failed to reset cache: %v", err)
+			}
+			routes, _ := cache.ListRoutes()
+			services, _ := cache.ListServices(selector)
+			upstreams, _ := cache.ListUpstreams()
+			ssls, _ := cache.ListSSLByName("ssl-1")
+			rules, _ := cache.ListGlobalRules()
+			if n := len(routes) + len(services) + len(upstreams) + len(ssls) + len(rules); n != 0 {
+				t.Errorf("Expected an empty cache after the reset, got %d objects", n)
+			}
+
+			// The cache is usable again after a reset
+			insertAll()
+			if services, err := cache.ListServices(selector); err != nil || len(services) != 1 {
+				t.Errorf("Expected the service after reinserting, got %d (%v)", len(services), err)
+			}
+		})
 	}
-	if len(allRoutes) != 3 {
-		t.Errorf("Expected 3 routes, got %d", len(allRoutes))
+}
+
+// runTearingWriter inserts a route and then its service and removes both
+// in one transaction, over and over until the returned stop is called. A
+// consistent reader never sees the service without the route.
+func runTearingWriter(t *testing.T, cache Cache) (stop func()) {
+	t.Helper()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			route := &Route{Metadata: adc.Metadata{ID: testRouteID, Name: testRouteID}}
+			service := &Service{Metadata: adc.Metadata{ID: "svc-1", Name: "svc-1"}}
+			if err := cache.InsertRoute(route); err != nil {
+				t.Errorf("Failed to insert route: %v", err)
+				return
+			}
+			if err := cache.InsertService(service); err != nil {
+				t.Errorf("Failed to insert service: %v", err)
+				return
+			}
+			if err := cache.Reset(); err != nil {
+				t.Errorf("Failed to reset cache: %v", err)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
 	}
+}
+
+func TestCacheReadSnapshot(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			stop := runTearingWriter(t, cache)
+			defer stop()
 
-	// List routes with label selector (default namespace)
-	selector := &KindLabelSelector{
-		Kind:      "Ingress",
-		Namespace: "default",
-		Name:      "ing-1",
+			for i := 0; i < 50; i++ {
+				err := cache.Read(func(tx ReadTxn) error {
+					services, err := tx.ListServices()
+					if err != nil {
+						return err
+					}
+					// Give the writer a chance to run between the reads
+					runtime.Gosched()
+					routes, err := tx.ListRoutes()
+					if err != nil {
+						return err
+					}
+					if len(services) > 0 && len(routes) == 0 {
+						return errors.New("torn read: service without its route")
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+			}
+		})
 	}
-	filteredRoutes, err := cache.ListRoutes(selector)
-	if err != nil {
-		t.Fatalf("Failed to list filtered routes: %v", err)
+}
+
+func TestCacheUpdate(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			// Insert initial route
+			route := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: "test-route",
+				},
+				URIs: []string{"/api"},
+			}
+
+			err = cache.InsertRoute(route)
+			if err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+
+			// Update route (insert with same ID)
+			updatedRoute := &Route{
+				Metadata: adc.Metadata{
+					ID:   testRouteID,
+					Name: "updated-route",
+				},
+				URIs: []string{"/api/v2"},
+			}
+
+			err = cache.InsertRoute(updatedRoute)
+			if err != nil {
+				t.Fatalf("Failed to update route: %v", err)
+			}
+
+			// Verify update
+			retrieved, err := cache.GetRoute(testRouteID)
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if retrieved.Name != "updated-route" {
+				t.Errorf("Expected Name 'updated-route', got %q", retrieved.Name)
+			}
+			if len(retrieved.URIs) != 1 || retrieved.URIs[0] != "/api/v2" {
+				t.Error("Route URIs not updated correctly")
+			}
+		})
 	}
-	if len(filteredRoutes) != 1 {
-		t.Errorf("Expected 1 route, got %d", len(filteredRoutes))
+}
+
+func TestDeepCopyCompleteness(t *testing.T) {
+	t.Run("route", func(t *testing.T) { testutil.AssertDeepCopy(t, (*Route).DeepCopy) })
+	t.Run("service", func(t *testing.T) { testutil.AssertDeepCopy(t, (*Service).DeepCopy) })
+	t.Run("upstream", func(t *testing.T) { testutil.AssertDeepCopy(t, (*Upstream).DeepCopy) })
+	t.Run("ssl", func(t *testing.T) { testutil.AssertDeepCopy(t, (*SSL).DeepCopy) })
+	t.Run("global rule", func(t *testing.T) { testutil.AssertDeepCopy(t, (*GlobalRule).DeepCopy) })
+	t.Run("proto", func(t *testing.T) { testutil.AssertDeepCopy(t, (*Proto).DeepCopy) })
+	t.Run("plugin metadata", func(t *testing.T) { testutil.AssertDeepCopy(t, (*PluginMetadata).DeepCopy) })
+}
+
+func TestCacheDeepCopy(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			// Create a route with complex nested data
+			route := &Route{
+				Metadata: adc.Metadata{
+					ID:   "route-1",
+					Name: "test-route",
+					Labels: map[string]string{
+						"key": "value",
+					},
+				},
+				URIs:    []string{"/api"},
+				Methods: []Method{MethodGET},
+				Plugins: map[string]any{
+					"cors": map[string]any{
+						"enabled": true,
+					},
+				},
+			}
+
+			err = cache.InsertRoute(route)
+			if err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+
+			// Get route from cache
+			retrieved, err := cache.GetRoute("route-1")
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+
+			// Modify retrieved copy
+			retrieved.Name = "modified"
+			retrieved.URIs[0] = "/modified"
+
+			// Get route again and verify original is unchanged
+			retrieved2, err := cache.GetRoute("route-1")
+			if err != nil {
+				t.Fatalf("Failed to get route again: %v", err)
+			}
+
+			if retrieved2.Name != "test-route" {
+				t.Error("Original route was modified (deep copy failed)")
+			}
+			if retrieved2.URIs[0] != "/api" {
+				t.Error("Original route URIs were modified (deep copy failed)")
+			}
+		})
 	}
-	if filteredRoutes[0].ID != testRouteID {
-		t.Errorf("Expected %s, got %s", testRouteID, filteredRoutes[0].ID)
+}
+
+func TestCacheForEachRoute(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+
+			for i := 0; i < 5; i++ {
+				route := &Route{
+					Metadata: adc.Metadata{
+						ID:   fmt.Sprintf("route-%d", i),
+						Name: fmt.Sprintf("route-%d", i),
+					},
+					URIs: []string{"/api"},
+				}
+				if err := cache.InsertRoute(route); err != nil {
+					t.Fatalf("Failed to insert route: %v", err)
+				}
+			}
+
+			// Walk all routes
+			var visited int
+			err = cache.ForEachRoute(func(r *Route) bool {
+				visited++
+				// Mutating the handed out copy must not affect the cache
+				r.URIs[0] = "/modified"
+				return true
+			})
+			if err != nil {
+				t.Fatalf("Failed to iterate routes: %v", err)
+			}
+			if visited != 5 {
+				t.Errorf("Expected 5 routes visited, got %d", visited)
+			}
+
+			retrieved, err := cache.GetRoute("route-0")
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if retrieved.URIs[0] != "/api" {
+				t.Error("Cached route was modified through ForEachRoute")
+			}
+
+			// Stop early
+			visited = 0
+			err = cache.ForEachRoute(func(r *Route) bool {
+				visited++
+				return visited < 2
+			})
+			if err != nil {
+				t.Fatalf("Failed to iterate routes: %v", err)
+			}
+			if visited != 2 {
+				t.Errorf("Expected iteration to stop after 2 routes, got %d", visited)
+			}
+		})
 	}
 }
 
-func TestCacheGenericInsertDelete(t *testing.T) {
+func newBenchmarkCache(b *testing.B, n int) Cache {
+	b.Helper()
 	cache, err := NewMemDBCache()
 	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
-	}
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		route := &Route{
+			Metadata: adc.Metadata{
+				ID:   fmt.Sprintf("route-%d", i),
+				Name: fmt.Sprintf("route-%d", i),
+				Labels: map[string]string{
+					label.LabelKind:      "Ingress",
+					label.LabelNamespace: "default",
+					label.LabelName:      "bench",
+				},
+			},
+			URIs:    []string{fmt.Sprintf("/api/%d", i)},
+			Methods: []Method{MethodGET},
+		}
+		if err := cache.InsertRoute(route); err != nil {
+			b.Fatalf("Failed to insert route: %v", err)
+		}
+	}
+	return cache
+}
 
-	// Test generic Insert
-	route := &Route{
-		Metadata: adc.Metadata{
-			ID:   testRouteID,
-			Name: "test-route",
-		},
-		URIs: []string{"/test"},
+func BenchmarkListRoutes(b *testing.B) {
+	cache := newBenchmarkCache(b, 40000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		routes, err := cache.ListRoutes()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, r := range routes {
+			_ = r.ID
+		}
 	}
+}
 
-	err = cache.Insert(route)
-	if err != nil {
-		t.Fatalf("Failed to insert via generic Insert: %v", err)
+func BenchmarkForEachRoute(b *testing.B) {
+	cache := newBenchmarkCache(b, 40000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := cache.ForEachRoute(func(r *Route) bool {
+			_ = r.ID
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
 	}
+}
 
-	// Verify insertion
-	retrieved, err := cache.GetRoute(testRouteID)
-	if err != nil {
-		t.Fatalf("Failed to get route: %v", err)
-	}
-	if retrieved.ID != testRouteID {
-		t.Errorf("Expected ID %q, got %q", testRouteID, retrieved.ID)
+// benchmarkRoutes returns n routes to insert into a cache
+func benchmarkRoutes(n int) []*Route {
+	routes := make([]*Route, n)
+	for i := range routes {
+		routes[i] = &Route{
+			Metadata: adc.Metadata{
+				ID:   fmt.Sprintf("route-%d", i),
+				Name: fmt.Sprintf("route-%d", i),
+				Labels: map[string]string{
+					label.LabelKind:      "Ingress",
+					label.LabelNamespace: "default",
+					label.LabelName:      "bench",
+				},
+			},
+			URIs:    []string{fmt.Sprintf("/api/%d", i)},
+			Methods: []Method{MethodGET},
+			Plugins: map[string]any{"proxy-rewrite": map[string]any{"uri": "/", "headers": map[string]any{"X-Route": fmt.Sprint(i)}}},
+		}
 	}
+	return routes
+}
 
-	// Test generic Delete
-	err = cache.Delete(route)
+func BenchmarkInsert(b *testing.B) {
+	benchmarkInsert(b, Cache.Insert)
+}
+
+func BenchmarkInsertOwned(b *testing.B) {
+	benchmarkInsert(b, Cache.InsertOwned)
+}
+
+func benchmarkInsert(b *testing.B, insert func(Cache, any) error) {
+	cache, err := NewMemDBCache()
 	if err != nil {
-		t.Fatalf("Failed to delete via generic Delete: %v", err)
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	routes := benchmarkRoutes(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Owned inserts take the objects over, hand over fresh ones
+		b.StopTimer()
+		batch := make([]*Route, len(routes))
+		for j, route := range routes {
+			batch[j] = route.DeepCopy()
+		}
+		b.StartTimer()
+		for _, route := range batch {
+			if err := insert(cache, route); err != nil {
+				b.Fatal(err)
+			}
+		}
 	}
+}
 
-	// Verify deletion
-	_, err = cache.GetRoute(testRouteID)
-	if err != ErrNotFound {
-		t.Error("Expected ErrNotFound after deletion")
+func TestCacheInsertOwned(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			route := benchmarkRoutes(1)[0]
+			if err := cache.InsertOwned(route); err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+			if err := cache.InsertOwned(&Proto{Metadata: adc.Metadata{ID: "proto"}, Content: "syntax = \"proto3\";"}); err != nil {
+				t.Fatalf("Failed to insert proto: %v", err)
+			}
+			if err := cache.InsertOwned("route"); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("Expected unsupported types to be rejected as invalid input, got %v", err)
+			}
+
+			// Gets still copy, mutating what they return leaves the cache as is
+			got, err := cache.GetRoute(route.ID)
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if !reflect.DeepEqual(got, route) {
+				t.Errorf("Expected the inserted route, got %+v", got)
+			}
+			got.URIs[0] = "/mutated"
+			again, err := cache.GetRoute(route.ID)
+			if err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if again.URIs[0] != route.URIs[0] {
+				t.Errorf("Expected gets to return copies, got %v", again.URIs)
+			}
+		})
 	}
 }
 
-func TestCacheUpdate(t *testing.T) {
-	cache, err := NewMemDBCache()
+func TestBoltCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kine.db")
+	cache, err := NewBoltCache(path)
 	if err != nil {
 		t.Fatalf("Failed to create cache: %v", err)
 	}
-
-	// Insert initial route
 	route := &Route{
 		Metadata: adc.Metadata{
 			ID:   testRouteID,
 			Name: "test-route",
+			Labels: map[string]string{
+				label.LabelKind:      "Ingress",
+				label.LabelNamespace: "default",
+				label.LabelName:      "test",
+			},
 		},
 		URIs: []string{"/api"},
 	}
-
-	err = cache.InsertRoute(route)
-	if err != nil {
+	if err := cache.InsertRoute(route); err != nil {
 		t.Fatalf("Failed to insert route: %v", err)
 	}
-
-	// Update route (insert with same ID)
-	updatedRoute := &Route{
-		Metadata: adc.Metadata{
-			ID:   testRouteID,
-			Name: "updated-route",
-		},
-		URIs: []string{"/api/v2"},
+	if err := cache.(io.Closer).Close(); err != nil {
+		t.Fatalf("Failed to close cache: %v", err)
 	}
 
-	err = cache.InsertRoute(updatedRoute)
+	// Reopen and verify the route and its label index survived
+	cache, err = NewBoltCache(path)
 	if err != nil {
-		t.Fatalf("Failed to update route: %v", err)
+		t.Fatalf("Failed to reopen cache: %v", err)
 	}
-
-	// Verify update
-	retrieved, err := cache.GetRoute(testRouteID)
+	defer func() {
+		_ = cache.(io.Closer).Close()
+	}()
+	routes, err := cache.ListRoutes(&KindLabelSelector{Kind: "Ingress", Namespace: "default", Name: "test"})
 	if err != nil {
-		t.Fatalf("Failed to get route: %v", err)
-	}
-	if retrieved.Name != "updated-route" {
-		t.Errorf("Expected Name 'updated-route', got %q", retrieved.Name)
+		t.Fatalf("Failed to list routes: %v", err)
 	}
-	if len(retrieved.URIs) != 1 || retrieved.URIs[0] != "/api/v2" {
-		t.Error("Route URIs not updated correctly")
+	if len(routes) != 1 || routes[0].ID != testRouteID {
+		t.Fatalf("Expected persisted route %q, got %v", testRouteID, routes)
 	}
-}
 
-func TestCacheDeepCopy(t *testing.T) {
-	cache, err := NewMemDBCache()
+	// Relabeling must move the route out of the old selector
+	route.Labels[label.LabelName] = "other"
+	if err := cache.InsertRoute(route); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	routes, err = cache.ListRoutes(&KindLabelSelector{Kind: "Ingress", Namespace: "default", Name: "test"})
 	if err != nil {
-		t.Fatalf("Failed to create cache: %v", err)
+		t.Fatalf("Failed to list routes: %v", err)
 	}
-
-	// Create a route with complex nested data
-	route := &Route{
-		Metadata: adc.Metadata{
-			ID:   "route-1",
-			Name: "test-route",
-			Labels: map[string]string{
-				"key": "value",
-			},
-		},
-		URIs:    []string{"/api"},
-		Methods: []Method{MethodGET},
-		Plugins: map[string]any{
-			"cors": map[string]any{
-				"enabled": true,
-			},
-		},
+	if len(routes) != 0 {
+		t.Errorf("Expected no routes under the old selector, got %d", len(routes))
 	}
 
-	err = cache.InsertRoute(route)
+	// The revision survives reopening, and the counter keeps increasing
+	revision, err := cache.Revision(ResourceTypeRoute, testRouteID)
 	if err != nil {
-		t.Fatalf("Failed to insert route: %v", err)
+		t.Fatalf("Failed to get revision: %v", err)
 	}
-
-	// Get route from cache
-	retrieved, err := cache.GetRoute("route-1")
+	if err := cache.(io.Closer).Close(); err != nil {
+		t.Fatalf("Failed to close cache: %v", err)
+	}
+	cache, err = NewBoltCache(path)
 	if err != nil {
-		t.Fatalf("Failed to get route: %v", err)
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	if got, err := cache.Revision(ResourceTypeRoute, testRouteID); err != nil || got != revision {
+		t.Fatalf("Expected persisted revision %d, got %d (%v)", revision, got, err)
+	}
+	route.URIs = []string{"/v2"}
+	if err := cache.InsertRoute(route); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	if got, _ := cache.Revision(ResourceTypeRoute, testRouteID); got <= revision {
+		t.Errorf("Expected revision above %d after reopening, got %d", revision, got)
 	}
+}
 
-	// Modify retrieved copy
-	retrieved.Name = "modified"
-	retrieved.URIs[0] = "/modified"
+func TestCacheRevision(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			route := &Route{
+				Metadata: adc.Metadata{ID: testRouteID, Name: "test-route"},
+				URIs:     []string{"/api"},
+			}
+			revision := func() uint64 {
+				t.Helper()
+				rev, err := cache.Revision(ResourceTypeRoute, testRouteID)
+				if err != nil {
+					t.Fatalf("Failed to get revision: %v", err)
+				}
+				return rev
+			}
 
-	// Get route again and verify original is unchanged
-	retrieved2, err := cache.GetRoute("route-1")
-	if err != nil {
-		t.Fatalf("Failed to get route again: %v", err)
+			if _, err := cache.Revision(ResourceTypeRoute, testRouteID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound before insert, got %v", err)
+			}
+			if err := cache.InsertRoute(route); err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+			first := revision()
+			if first == 0 {
+				t.Fatal("Expected a non-zero revision")
+			}
+
+			// Identical content keeps its revision
+			if err := cache.InsertRoute(route.DeepCopy()); err != nil {
+				t.Fatalf("Failed to re-insert route: %v", err)
+			}
+			if got := revision(); got != first {
+				t.Errorf("Expected revision %d after identical insert, got %d", first, got)
+			}
+
+			// Touching bumps it regardless
+			if err := cache.Touch(ResourceTypeRoute, testRouteID); err != nil {
+				t.Fatalf("Failed to touch route: %v", err)
+			}
+			touched := revision()
+			if touched <= first {
+				t.Errorf("Expected revision above %d after touch, got %d", first, touched)
+			}
+			if err := cache.Touch(ResourceTypeRoute, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound touching a missing route, got %v", err)
+			}
+
+			route.URIs = []string{"/v2"}
+			if err := cache.InsertRoute(route); err != nil {
+				t.Fatalf("Failed to update route: %v", err)
+			}
+			second := revision()
+			if second <= touched {
+				t.Errorf("Expected revision above %d after update, got %d", touched, second)
+			}
+
+			// Revisions never go back, even for objects inserted again after
+			// a delete or a reset
+			if err := cache.InsertService(&Service{Metadata: adc.Metadata{ID: "svc", Name: "svc"}}); err != nil {
+				t.Fatalf("Failed to insert service: %v", err)
+			}
+			revisions, err := cache.Revisions(ResourceTypeRoute)
+			if err != nil {
+				t.Fatalf("Failed to list revisions: %v", err)
+			}
+			if len(revisions) != 1 || revisions[testRouteID] != second {
+				t.Errorf("Expected route revisions {%s: %d}, got %v", testRouteID, second, revisions)
+			}
+			if err := cache.DeleteRouteByID(testRouteID); err != nil {
+				t.Fatalf("Failed to delete route: %v", err)
+			}
+			if _, err := cache.Revision(ResourceTypeRoute, testRouteID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+			if err := cache.InsertRoute(route); err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+			if err := cache.ResetTable(ResourceTypeRoute); err != nil {
+				t.Fatalf("Failed to reset routes: %v", err)
+			}
+			if _, err := cache.Revision(ResourceTypeService, "svc"); err != nil {
+				t.Errorf("Expected the service revision to survive a route reset, got %v", err)
+			}
+			if err := cache.InsertRoute(route); err != nil {
+				t.Fatalf("Failed to insert route: %v", err)
+			}
+			if got := revision(); got <= second {
+				t.Errorf("Expected revision above %d after reset, got %d", second, got)
+			}
+		})
 	}
+}
 
-	if retrieved2.Name != "test-route" {
-		t.Error("Original route was modified (deep copy failed)")
+func TestCacheInputHash(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			owner := KindLabelSelector{Kind: "HTTPRoute", Namespace: "default", Name: "web"}
+			other := KindLabelSelector{Kind: "HTTPRoute", Namespace: "default", Name: "api"}
+			inputHash := func(selector KindLabelSelector) string {
+				t.Helper()
+				hash, err := cache.InputHash(selector)
+				if err != nil {
+					t.Fatalf("Failed to get input hash: %v", err)
+				}
+				return hash
+			}
+
+			if hash := inputHash(owner); hash != "" {
+				t.Errorf("Expected no input hash, got %q", hash)
+			}
+			if err := cache.SetInputHash(owner, "v1"); err != nil {
+				t.Fatalf("Failed to set input hash: %v", err)
+			}
+			if err := cache.SetInputHash(other, "v2"); err != nil {
+				t.Fatalf("Failed to set input hash: %v", err)
+			}
+			// Kinds match case-insensitively, like the label index
+			if hash := inputHash(KindLabelSelector{Kind: "httproute", Namespace: "default", Name: "web"}); hash != "v1" {
+				t.Errorf("Expected input hash v1, got %q", hash)
+			}
+
+			if err := cache.SetInputHash(owner, ""); err != nil {
+				t.Fatalf("Failed to forget input hash: %v", err)
+			}
+			if hash := inputHash(owner); hash != "" {
+				t.Errorf("Expected the input hash to be forgotten, got %q", hash)
+			}
+			if hash := inputHash(other); hash != "v2" {
+				t.Errorf("Expected the other input hash to be kept, got %q", hash)
+			}
+
+			if err := cache.ResetTable(ResourceTypeRoute); err != nil {
+				t.Fatalf("Failed to reset routes: %v", err)
+			}
+			if hash := inputHash(other); hash != "" {
+				t.Errorf("Expected a reset to forget input hashes, got %q", hash)
+			}
+		})
 	}
-	if retrieved2.URIs[0] != "/api" {
-		t.Error("Original route URIs were modified (deep copy failed)")
+}
+
+func TestCacheListUnlabeled(t *testing.T) {
+	for _, impl := range cacheImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			cache, err := impl.newCache(t)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			owned := map[string]string{
+				label.LabelKind:      "Ingress",
+				label.LabelNamespace: "default",
+				label.LabelName:      "test",
+			}
+			routes := []*Route{
+				{Metadata: adc.Metadata{ID: "owned", Labels: owned}, URIs: []string{"/owned"}},
+				{Metadata: adc.Metadata{ID: "bare"}, URIs: []string{"/bare"}},
+				{Metadata: adc.Metadata{ID: "partial", Labels: map[string]string{label.LabelKind: "Ingress"}}, URIs: []string{"/partial"}},
+			}
+			for _, route := range routes {
+				if err := cache.InsertRoute(route); err != nil {
+					t.Fatalf("Failed to insert route: %v", err)
+				}
+			}
+			if err := cache.InsertGlobalRule(&GlobalRule{ID: "prometheus", Labels: owned}); err != nil {
+				t.Fatalf("Failed to insert global rule: %v", err)
+			}
+
+			objs, err := cache.ListUnlabeled(ResourceTypeRoute)
+			if err != nil {
+				t.Fatalf("Failed to list unlabeled routes: %v", err)
+			}
+			var ids []string
+			for _, obj := range objs {
+				ids = append(ids, obj.(*Route).ID)
+			}
+			slices.Sort(ids)
+			if !slices.Equal(ids, []string{"bare", "partial"}) {
+				t.Errorf("Expected the bare and partially labeled routes, got %v", ids)
+			}
+			if objs, err := cache.ListUnlabeled(ResourceTypeGlobalRule); err != nil || len(objs) != 0 {
+				t.Errorf("Expected no unlabeled global rule, got %v (%v)", objs, err)
+			}
+			if _, err := cache.ListUnlabeled("stream_routes"); !errors.Is(err, ErrUnknownResourceType) {
+				t.Errorf("Expected an unknown resource type error, got %v", err)
+			}
+		})
 	}
 }
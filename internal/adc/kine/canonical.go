@@ -0,0 +1,69 @@
+package kine
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledEncoderSize bounds the buffers kept in encoderPool, so that one
+// huge object does not pin its buffer for the lifetime of the process
+const maxPooledEncoderSize = 1 << 20
+
+// canonicalEncoder pairs a reusable buffer with an encoder writing to it
+// and a reader over it
+type canonicalEncoder struct {
+	buf    bytes.Buffer
+	enc    *json.Encoder
+	reader bytes.Reader
+}
+
+var encoderPool = sync.Pool{
+	New: func() any {
+		e := &canonicalEncoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// encode encodes v into the buffer, replacing its contents. The result is
+// only valid until the next encode.
+func (e *canonicalEncoder) encode(v any) ([]byte, error) {
+	e.buf.Reset()
+	if err := e.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode terminates values with a newline, json.Marshal does not
+	return bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")), nil
+}
+
+// CanonicalJSON encodes a kine object as key-sorted JSON. Objects are
+// round-tripped through generic maps, so every object key is sorted,
+// including struct fields, and equal objects always encode to identical
+// bytes. Numbers keep their original representation.
+func CanonicalJSON(obj any) ([]byte, error) {
+	e := encoderPool.Get().(*canonicalEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledEncoderSize {
+			encoderPool.Put(e)
+		}
+	}()
+
+	data, err := e.encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	e.reader.Reset(data)
+	decoder := json.NewDecoder(&e.reader)
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	data, err = e.encode(tree)
+	if err != nil {
+		return nil, err
+	}
+	// The buffer goes back to the pool, hand out a copy
+	return bytes.Clone(data), nil
+}
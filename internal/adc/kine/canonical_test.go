@@ -0,0 +1,52 @@
+package kine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	route := &Route{
+		Metadata: adc.Metadata{
+			ID:     "route1",
+			Name:   "route1",
+			Labels: map[string]string{"z": "1", "a": "2", "m": "3"},
+		},
+		URIs: []string{"/b", "/a"},
+		Plugins: map[string]any{
+			"proxy-rewrite": map[string]any{
+				"headers": map[string]any{"set": map[string]any{"X-B": "b", "X-A": "a"}},
+				"uri":     "/",
+			},
+			"limit-count": map[string]any{"count": 10, "time_window": 60},
+		},
+		Upstream: &Upstream{
+			Nodes: map[string]uint32{"10.0.0.2:80": 1, "10.0.0.1:80": 2, "10.0.0.3:80": 3},
+		},
+	}
+
+	first, err := CanonicalJSON(route)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := CanonicalJSON(route.DeepCopy())
+		if err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatalf("expected identical output:\n%s\n%s", first, again)
+		}
+	}
+
+	expected := `{"id":"route1","labels":{"a":"2","m":"3","z":"1"},"name":"route1",` +
+		`"plugins":{"limit-count":{"count":10,"time_window":60},` +
+		`"proxy-rewrite":{"headers":{"set":{"X-A":"a","X-B":"b"}},"uri":"/"}},` +
+		`"upstream":{"nodes":{"10.0.0.1:80":2,"10.0.0.2:80":1,"10.0.0.3:80":3}},` +
+		`"uris":["/b","/a"]}`
+	if string(first) != expected {
+		t.Errorf("unexpected canonical JSON:\n got: %s\nwant: %s", first, expected)
+	}
+}
@@ -0,0 +1,128 @@
+package kine
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces secret material in logs, audit records and changes
+const RedactedValue = "<redacted>"
+
+// FieldChange describes the old and new value of a single changed field
+type FieldChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// sensitivePaths returns the JSON pointer paths holding secret material
+// for the given kine object
+func sensitivePaths(obj any) map[string]bool {
+	switch obj.(type) {
+	case *SSL:
+		return map[string]bool{"/key": true}
+	default:
+		return nil
+	}
+}
+
+// redactSecrets returns a copy of a kine object with the secret material
+// found at its sensitivePaths replaced by RedactedValue. Other objects are
+// returned as is.
+func redactSecrets(obj any) any {
+	if ssl, ok := obj.(*SSL); ok && ssl != nil && ssl.Key != "" {
+		redacted := *ssl
+		redacted.Key = RedactedValue
+		return &redacted
+	}
+	return obj
+}
+
+// ComputeChanges compares the JSON representation of two kine objects and
+// returns the changed fields keyed by JSON pointer (RFC 6901) path. Maps are
+// compared key by key, arrays and scalars as whole values. Values of secret
+// fields (SSL keys) are redacted, only the fact that they changed is kept.
+func ComputeChanges(oldObj, newObj any) (map[string]FieldChange, error) {
+	oldTree, err := toJSONTree(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := toJSONTree(newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+	collectChanges("", oldTree, newTree, changes)
+
+	sensitive := sensitivePaths(newObj)
+	if sensitive == nil {
+		sensitive = sensitivePaths(oldObj)
+	}
+	for path, change := range changes {
+		if !sensitive[path] {
+			continue
+		}
+		if change.Old != nil {
+			change.Old = RedactedValue
+		}
+		if change.New != nil {
+			change.New = RedactedValue
+		}
+		changes[path] = change
+	}
+	return changes, nil
+}
+
+// ChangedPaths returns the sorted paths of a change set
+func ChangedPaths(changes map[string]FieldChange) []string {
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func toJSONTree(obj any) (any, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	if v := reflect.ValueOf(obj); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func collectChanges(path string, oldValue, newValue any, changes map[string]FieldChange) {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		for key, ov := range oldMap {
+			collectChanges(path+"/"+escapePointer(key), ov, newMap[key], changes)
+		}
+		for key, nv := range newMap {
+			if _, exists := oldMap[key]; !exists {
+				collectChanges(path+"/"+escapePointer(key), nil, nv, changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes[path] = FieldChange{Old: oldValue, New: newValue}
+	}
+}
+
+// escapePointer escapes a JSON pointer reference token
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
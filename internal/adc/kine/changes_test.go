@@ -0,0 +1,59 @@
+package kine
+
+import (
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestComputeChanges(t *testing.T) {
+	oldRoute := &Route{
+		Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+		URIs:     []string{"/api"},
+		Plugins: map[string]any{
+			"limit-count": map[string]any{"count": 10, "time_window": 60},
+		},
+	}
+	newRoute := oldRoute.DeepCopy()
+	newRoute.Plugins = map[string]any{
+		"limit-count": map[string]any{"count": 20, "time_window": 60},
+	}
+
+	changes, err := ComputeChanges(oldRoute, newRoute)
+	if err != nil {
+		t.Fatalf("failed to compute changes: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %v", changes)
+	}
+	change, ok := changes["/plugins/limit-count/count"]
+	if !ok {
+		t.Fatalf("expected change at /plugins/limit-count/count, got %v", ChangedPaths(changes))
+	}
+	if change.Old != float64(10) || change.New != float64(20) {
+		t.Errorf("unexpected change values: %+v", change)
+	}
+}
+
+func TestComputeChangesRedactsSSLKey(t *testing.T) {
+	oldSSL := &SSL{
+		Metadata: adc.Metadata{ID: "ssl1"},
+		Cert:     "cert",
+		Key:      "old-private-key",
+		SNIs:     []string{"example.com"},
+	}
+	newSSL := oldSSL.DeepCopy()
+	newSSL.Key = "new-private-key"
+
+	changes, err := ComputeChanges(oldSSL, newSSL)
+	if err != nil {
+		t.Fatalf("failed to compute changes: %v", err)
+	}
+	change, ok := changes["/key"]
+	if !ok {
+		t.Fatalf("expected change at /key, got %v", ChangedPaths(changes))
+	}
+	if change.Old != RedactedValue || change.New != RedactedValue {
+		t.Errorf("expected key change to be redacted, got %+v", change)
+	}
+}
@@ -0,0 +1,166 @@
+package kine
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RouteConflict reports two routes of different owners matching the same
+// requests. Which one the gateway picks depends on priorities and insertion
+// order, so one of the owners silently loses.
+type RouteConflict struct {
+	// Host and Method are the overlapping host and method, empty when both
+	// routes match any
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
+
+	RouteID string `json:"routeId"`
+	Owner   string `json:"owner"`
+	URI     string `json:"uri"`
+
+	OtherRouteID string `json:"otherRouteId"`
+	OtherOwner   string `json:"otherOwner"`
+	OtherURI     string `json:"otherUri"`
+}
+
+func (c *RouteConflict) Error() string {
+	host, method := c.Host, c.Method
+	if host == "" {
+		host = "any host"
+	}
+	if method == "" {
+		method = "any method"
+	}
+	return fmt.Sprintf("route %s of %s (%s) and route %s of %s (%s) overlap on %s with %s",
+		c.RouteID, c.Owner, c.URI, c.OtherRouteID, c.OtherOwner, c.OtherURI, host, method)
+}
+
+// routeClaim is one host and URI matched by a route
+type routeClaim struct {
+	route *Route
+	owner string
+	uri   string
+}
+
+// DetectRouteConflicts groups routes by host and reports the pairs of
+// routes of different owners whose methods and URIs overlap. URIs ending
+// with * are prefixes, overlapping the URIs and prefixes they cover. Routes
+// without owner labels and disabled routes are ignored, and each pair is
+// reported once.
+func DetectRouteConflicts(routes []*Route) []*RouteConflict {
+	claims := make(map[string][]routeClaim)
+	for _, route := range routes {
+		owner := ownerOf(route.Labels)
+		if owner == "" || route.GetStatus() == RouteStatusDisabled {
+			continue
+		}
+		hosts := routeHosts(route)
+		if len(hosts) == 0 {
+			hosts = []string{""}
+		}
+		for _, host := range hosts {
+			for _, uri := range routeURIs(route) {
+				claims[host] = append(claims[host], routeClaim{route: route, owner: owner, uri: uri})
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(claims))
+	for host := range claims {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var conflicts []*RouteConflict
+	reported := make(map[[2]string]bool)
+	for _, host := range hosts {
+		hostClaims := claims[host]
+		for i, a := range hostClaims {
+			for _, b := range hostClaims[i+1:] {
+				if a.route.ID == b.route.ID || strings.EqualFold(a.owner, b.owner) {
+					continue
+				}
+				if a.route.ID > b.route.ID {
+					a, b = b, a
+				}
+				pair := [2]string{a.route.ID, b.route.ID}
+				if reported[pair] || !urisOverlap(a.uri, b.uri) {
+					continue
+				}
+				method, ok := overlappingMethod(a.route.Methods, b.route.Methods)
+				if !ok {
+					continue
+				}
+				reported[pair] = true
+				conflicts = append(conflicts, &RouteConflict{
+					Host:         host,
+					Method:       method,
+					RouteID:      a.route.ID,
+					Owner:        a.owner,
+					URI:          a.uri,
+					OtherRouteID: b.route.ID,
+					OtherOwner:   b.owner,
+					OtherURI:     b.uri,
+				})
+			}
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].RouteID != conflicts[j].RouteID {
+			return conflicts[i].RouteID < conflicts[j].RouteID
+		}
+		return conflicts[i].OtherRouteID < conflicts[j].OtherRouteID
+	})
+	return conflicts
+}
+
+// routeURIs returns the distinct URIs of a route
+func routeURIs(route *Route) []string {
+	uris := make([]string, 0, len(route.URIs)+1)
+	if route.URI != nil {
+		uris = append(uris, *route.URI)
+	}
+	for _, uri := range route.URIs {
+		if !slices.Contains(uris, uri) {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// urisOverlap reports whether a request URI exists that both URIs match
+func urisOverlap(a, b string) bool {
+	prefixA, isPrefixA := strings.CutSuffix(a, "*")
+	prefixB, isPrefixB := strings.CutSuffix(b, "*")
+	switch {
+	case isPrefixA && isPrefixB:
+		return strings.HasPrefix(prefixA, prefixB) || strings.HasPrefix(prefixB, prefixA)
+	case isPrefixA:
+		return strings.HasPrefix(b, prefixA)
+	case isPrefixB:
+		return strings.HasPrefix(a, prefixB)
+	default:
+		return a == b
+	}
+}
+
+// overlappingMethod returns a method matched by both method lists, where an
+// empty list matches any method
+func overlappingMethod(a, b []Method) (string, bool) {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return "", true
+	case len(a) == 0:
+		return string(b[0]), true
+	case len(b) == 0:
+		return string(a[0]), true
+	}
+	for _, method := range a {
+		if slices.Contains(b, method) {
+			return string(method), true
+		}
+	}
+	return "", false
+}
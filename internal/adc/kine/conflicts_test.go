@@ -0,0 +1,136 @@
+package kine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+func ownedRoute(id, kind, name string, hosts []string, methods []Method, uris ...string) *Route {
+	return &Route{
+		Metadata: adc.Metadata{
+			ID:   id,
+			Name: id,
+			Labels: map[string]string{
+				label.LabelKind:      kind,
+				label.LabelNamespace: "default",
+				label.LabelName:      name,
+			},
+		},
+		Hosts:   hosts,
+		Methods: methods,
+		URIs:    uris,
+	}
+}
+
+func TestDetectRouteConflicts(t *testing.T) {
+	host := []string{exampleHost}
+	tests := []struct {
+		name   string
+		routes []*Route
+		want   []RouteConflict
+	}{
+		{
+			name: "exact duplicate",
+			routes: []*Route{
+				ownedRoute("b", "Ingress", "ing", host, []Method{MethodGET}, "/api"),
+				ownedRoute("a", "HTTPRoute", "web", host, []Method{MethodPOST, MethodGET}, "/api"),
+			},
+			want: []RouteConflict{{
+				Host: exampleHost, Method: "GET",
+				RouteID: "a", Owner: "HTTPRoute default/web", URI: "/api",
+				OtherRouteID: "b", OtherOwner: "Ingress default/ing", OtherURI: "/api",
+			}},
+		},
+		{
+			name: "prefix overlap",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api/*"),
+				ownedRoute("b", "HTTPRoute", "web", host, []Method{MethodGET}, "/health", "/api/users"),
+			},
+			want: []RouteConflict{{
+				Host: exampleHost, Method: "GET",
+				RouteID: "a", Owner: "Ingress default/ing", URI: "/api/*",
+				OtherRouteID: "b", OtherOwner: "HTTPRoute default/web", OtherURI: "/api/users",
+			}},
+		},
+		{
+			name: "nested prefixes on any host",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", nil, nil, "/*"),
+				ownedRoute("b", "HTTPRoute", "web", nil, nil, "/static/*"),
+			},
+			want: []RouteConflict{{
+				RouteID: "a", Owner: "Ingress default/ing", URI: "/*",
+				OtherRouteID: "b", OtherOwner: "HTTPRoute default/web", OtherURI: "/static/*",
+			}},
+		},
+		{
+			name: "same owner",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api"),
+				ownedRoute("b", "ingress", "ing", host, nil, "/api"),
+			},
+		},
+		{
+			name: "different hosts",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api"),
+				ownedRoute("b", "HTTPRoute", "web", []string{"other.com"}, nil, "/api"),
+			},
+		},
+		{
+			name: "disjoint methods",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, []Method{MethodGET}, "/api"),
+				ownedRoute("b", "HTTPRoute", "web", host, []Method{MethodPOST}, "/api"),
+			},
+		},
+		{
+			name: "prefix not covering",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api/*"),
+				ownedRoute("b", "HTTPRoute", "web", host, nil, "/api", "/apis/*"),
+			},
+		},
+		{
+			name: "disabled route",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api"),
+				func() *Route {
+					route := ownedRoute("b", "HTTPRoute", "web", host, nil, "/api")
+					status := RouteStatusDisabled
+					route.Status = &status
+					return route
+				}(),
+			},
+		},
+		{
+			name: "unowned route",
+			routes: []*Route{
+				ownedRoute("a", "Ingress", "ing", host, nil, "/api"),
+				{Metadata: adc.Metadata{ID: "b"}, Hosts: host, URIs: []string{"/api"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := DetectRouteConflicts(tt.routes)
+			if len(conflicts) != len(tt.want) {
+				t.Fatalf("expected %d conflicts, got %v", len(tt.want), conflicts)
+			}
+			for i, conflict := range conflicts {
+				if *conflict != tt.want[i] {
+					t.Errorf("expected conflict %+v, got %+v", tt.want[i], *conflict)
+				}
+				for _, part := range []string{conflict.Owner, conflict.OtherOwner} {
+					if !strings.Contains(conflict.Error(), part) {
+						t.Errorf("expected %q to identify owner %q", conflict.Error(), part)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,21 @@
 package kine
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/apache/apisix-ingress-controller/api/adc"
 	"github.com/apache/apisix-ingress-controller/internal/controller/label"
@@ -19,38 +30,250 @@ const (
 	EventTypeDelete EventType = "DELETE"
 )
 
-// ResourceType represents the type of Kine resource
-type ResourceType string
-
-const (
-	ResourceTypeRoute      ResourceType = "routes"
-	ResourceTypeService    ResourceType = "services"
-	ResourceTypeUpstream   ResourceType = "upstreams"
-	ResourceTypeSSL        ResourceType = "ssls"
-	ResourceTypeGlobalRule ResourceType = "global_rules"
-)
-
 // Event represents a change event for a resource
 type Event struct {
 	Type         EventType    `json:"type"`
 	ResourceType ResourceType `json:"resourceType"`
 	ResourceID   string       `json:"resourceId"`
 	ResourceName string       `json:"resourceName"`
-	ParentID     string       `json:"parentId,omitempty"`
-	OldValue     any          `json:"oldValue,omitempty"`
-	NewValue     any          `json:"newValue,omitempty"`
+	// ParentID identifies the object the resource belongs to: the service
+	// of a route, the shared upstream of a service, or the name of the ADC
+	// SSL an SSL was split from when it had several certificates
+	ParentID string `json:"parentId,omitempty"`
+	OldValue any    `json:"oldValue,omitempty"`
+	NewValue any    `json:"newValue,omitempty"`
+	// Changes holds the changed fields of an UPDATE event, keyed by JSON
+	// pointer path. Only set when DiffOptions.IncludeChanges is enabled.
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+	// SyncID identifies the sync that produced the event
+	SyncID string `json:"syncId,omitempty"`
+	// Sequence is the position of the event in execution order within its sync
+	Sequence int `json:"sequence"`
+	// ModRevision is the cache revision of the old value of UPDATE and
+	// DELETE events, letting consumers detect that the cached object
+	// changed since the diff
+	ModRevision uint64 `json:"modRevision,omitempty"`
+	// Forced marks UPDATE events of unchanged objects, emitted because of
+	// DiffOptions.ForceUpdate
+	Forced bool `json:"forced,omitempty"`
+}
+
+// Redacted returns a copy of the event whose values have their secret
+// material, the private keys of SSLs, replaced by RedactedValue, for logs
+// and plans. Values written to the gateway come from the event itself.
+func (e Event) Redacted() Event {
+	e.OldValue = redactSecrets(e.OldValue)
+	e.NewValue = redactSecrets(e.NewValue)
+	return e
+}
+
+// MarshalLog implements logr.Marshaler, so that logged events are redacted
+func (e Event) MarshalLog() any {
+	type loggedEvent Event
+	return loggedEvent(e.Redacted())
 }
 
 // DiffOptions contains options for diff operation
 type DiffOptions struct {
 	Labels map[string]string
 	Types  []string
+	// AllowDuplicateIDs lets the last of several desired resources sharing
+	// an ID win instead of failing the diff. Meant for migrations only.
+	AllowDuplicateIDs bool
+	// IgnoreFields lists dot separated field paths, such as "Metadata.Desc"
+	// or "Labels", excluded from the comparison of every resource type
+	// having that field. Changes limited to these fields produce no events.
+	IgnoreFields []string
+	// IncludeChanges populates Event.Changes for UPDATE events
+	IncludeChanges bool
+	// SyncID is stamped on every generated event
+	SyncID string
+	// ForceOwnership lets desired resources take over resources owned by
+	// another label set instead of failing with an OwnershipConflictError
+	ForceOwnership bool
+	// DerivedFrom holds, by resource type and ID, the cache revision each
+	// desired object was derived from. Objects still cached at that
+	// revision are taken as unchanged without comparing them.
+	DerivedFrom map[ResourceType]map[string]uint64
+	// ForceUpdate emits UPDATE events for the desired objects found equal
+	// to their cached version, so that they are rewritten to the gateway.
+	// Creates and deletes are computed as usual.
+	ForceUpdate bool
+	// ProtectedGlobalRules lists the IDs of global rules that are never
+	// deleted, such as always-on prometheus or real-ip rules. Their DELETE
+	// events are dropped, so that they stay cached as they stay in etcd.
+	// Creates and updates still flow.
+	ProtectedGlobalRules []string
+	// OnProtected is called with every DELETE event dropped for a protected
+	// global rule, to report it
+	OnProtected func(Event)
+	// OnUpstreamMismatch is called with every desired service embedding an
+	// upstream that differs from the one its upstream_id references, to
+	// report it. The embedded upstream is dropped either way.
+	OnUpstreamMismatch func(*UpstreamMismatch)
+	// Keep identifies cached objects retained although no desired object
+	// matches them, such as those of the resources skipped by a best-effort
+	// transfer, see TransferredResources.Skipped. Their DELETE events are
+	// dropped, so that a broken resource keeps serving its last good state.
+	Keep *KeepSet
+}
+
+// KeepSet identifies cached objects by ID and by owner. The routes of kept
+// services and the upstreams kept services reference are kept with them.
+type KeepSet struct {
+	// IDs holds the IDs of the kept objects by resource type
+	IDs map[ResourceType]map[string]bool
+	// Owners holds the kind, namespace and name labels of the owners whose
+	// cached objects are all kept
+	Owners []map[string]string
+}
+
+// add keeps the object of the given type and ID, when known, and the
+// objects of the owner its labels identify
+func (k *KeepSet) add(resourceType ResourceType, id string, labels map[string]string) {
+	if id != "" {
+		if k.IDs == nil {
+			k.IDs = make(map[ResourceType]map[string]bool)
+		}
+		if k.IDs[resourceType] == nil {
+			k.IDs[resourceType] = make(map[string]bool)
+		}
+		k.IDs[resourceType][id] = true
+	}
+	if owner := ownerOf(labels); owner != "" && !k.keepsOwner(owner) {
+		k.Owners = append(k.Owners, map[string]string{
+			label.LabelKind:      labels[label.LabelKind],
+			label.LabelNamespace: labels[label.LabelNamespace],
+			label.LabelName:      labels[label.LabelName],
+		})
+	}
+}
+
+// keepsOwner reports whether the objects of owner, as formatted by ownerOf,
+// are kept
+func (k *KeepSet) keepsOwner(owner string) bool {
+	return slices.ContainsFunc(k.Owners, func(labels map[string]string) bool {
+		return strings.EqualFold(ownerOf(labels), owner)
+	})
+}
+
+// keeps reports whether the cached object of the given type, ID and labels
+// is kept by ID or by owner
+func (k *KeepSet) keeps(resourceType ResourceType, id string, labels map[string]string) bool {
+	if k.IDs[resourceType][id] {
+		return true
+	}
+	owner := ownerOf(labels)
+	return owner != "" && k.keepsOwner(owner)
+}
+
+// OwnershipConflictError is returned when a desired resource would
+// overwrite a cached resource owned by a different source
+type OwnershipConflictError struct {
+	ResourceType ResourceType
+	ID           string
+	Owner        string
+	Claimant     string
+}
+
+func (e *OwnershipConflictError) Error() string {
+	return fmt.Sprintf("%s %s is owned by %s, refusing to overwrite it for %s",
+		e.ResourceType, e.ID, e.Owner, e.Claimant)
+}
+
+// ownerOf formats the owner identified by the kind, namespace and name labels
+func ownerOf(labels map[string]string) string {
+	kind, namespace, name := labels[label.LabelKind], labels[label.LabelNamespace], labels[label.LabelName]
+	if kind == "" && namespace == "" && name == "" {
+		return ""
+	}
+	return kind + " " + namespace + "/" + name
+}
+
+// DuplicateIDError is returned when two desired resources of the same type
+// share an ID, which would make one of them silently disappear
+type DuplicateIDError struct {
+	ResourceType ResourceType
+	ID           string
+	FirstName    string
+	FirstLabels  map[string]string
+	SecondName   string
+	SecondLabels map[string]string
+}
+
+func (e *DuplicateIDError) Error() string {
+	return fmt.Sprintf("duplicate %s id %s: %q (labels %v) conflicts with %q (labels %v)",
+		e.ResourceType, e.ID, e.FirstName, e.FirstLabels, e.SecondName, e.SecondLabels)
+}
+
+// FindDuplicateIDs reports the resources sharing an ID within each resource
+// type. Identical copies of the same object are not considered duplicates.
+func FindDuplicateIDs(resources *TransferredResources) []*DuplicateIDError {
+	var dups []*DuplicateIDError
+	check := func(resourceType ResourceType, n int, metadata func(int) adc.Metadata, equal func(i, j int) bool) {
+		seen := make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			m := metadata(i)
+			first, exists := seen[m.ID]
+			if !exists {
+				seen[m.ID] = i
+				continue
+			}
+			if equal(first, i) {
+				continue
+			}
+			firstMeta := metadata(first)
+			dups = append(dups, &DuplicateIDError{
+				ResourceType: resourceType,
+				ID:           m.ID,
+				FirstName:    firstMeta.Name,
+				FirstLabels:  firstMeta.Labels,
+				SecondName:   m.Name,
+				SecondLabels: m.Labels,
+			})
+		}
+	}
+	check(ResourceTypeRoute, len(resources.Routes),
+		func(i int) adc.Metadata { return resources.Routes[i].Metadata },
+		func(i, j int) bool { return areRoutesEqual(resources.Routes[i], resources.Routes[j]) })
+	check(ResourceTypeService, len(resources.Services),
+		func(i int) adc.Metadata { return resources.Services[i].Metadata },
+		func(i, j int) bool { return areServicesEqual(resources.Services[i], resources.Services[j]) })
+	check(ResourceTypeUpstream, len(resources.Upstreams),
+		func(i int) adc.Metadata { return resources.Upstreams[i].Metadata },
+		func(i, j int) bool { return areUpstreamsEqual(resources.Upstreams[i], resources.Upstreams[j]) })
+	check(ResourceTypeSSL, len(resources.SSLs),
+		func(i int) adc.Metadata { return resources.SSLs[i].Metadata },
+		func(i, j int) bool { return areSSLsEqual(resources.SSLs[i], resources.SSLs[j]) })
+	check(ResourceTypeGlobalRule, len(resources.GlobalRules),
+		func(i int) adc.Metadata {
+			rule := resources.GlobalRules[i]
+			return adc.Metadata{ID: rule.ID, Name: rule.ID, Labels: rule.Labels}
+		},
+		func(i, j int) bool { return areGlobalRulesEqual(resources.GlobalRules[i], resources.GlobalRules[j]) })
+	check(ResourceTypeProto, len(resources.Protos),
+		func(i int) adc.Metadata { return resources.Protos[i].Metadata },
+		func(i, j int) bool { return areProtosEqual(resources.Protos[i], resources.Protos[j]) })
+	check(ResourceTypePluginMetadata, len(resources.PluginMetadata),
+		func(i int) adc.Metadata {
+			metadata := resources.PluginMetadata[i]
+			return adc.Metadata{ID: metadata.ID, Name: metadata.ID, Labels: metadata.Labels}
+		},
+		func(i, j int) bool {
+			return arePluginMetadataEqual(resources.PluginMetadata[i], resources.PluginMetadata[j])
+		})
+	return dups
 }
 
 // Differ interface for comparing resources and generating events
 type Differ interface {
-	// Diff compares resources and generates events
-	Diff(newResources *TransferredResources, opts *DiffOptions) ([]Event, error)
+	// Diff compares resources and generates events. It aborts with the
+	// context error once ctx is done.
+	Diff(ctx context.Context, newResources *TransferredResources, opts *DiffOptions) ([]Event, error)
+	// DiffOne compares a single desired object with its cached version
+	// without listing the whole table. A nil desired object means the
+	// resource is deleted. It returns a nil event when nothing changed.
+	DiffOne(resourceType ResourceType, desired any, id string) (*Event, error)
 }
 
 // TransferredResources contains all transferred Kine resources
@@ -60,6 +283,55 @@ type TransferredResources struct {
 	Upstreams   []*Upstream
 	SSLs        []*SSL
 	GlobalRules []*GlobalRule
+	Protos      []*Proto
+
+	PluginMetadata []*PluginMetadata
+
+	// Warnings lists the resources skipped by a best-effort transfer and
+	// the problems the transfer worked around, such as unknown upstream
+	// schemes or zero weight upstreams
+	Warnings []TransferWarning
+	// Skipped identifies the cached objects of the resources skipped by a
+	// best-effort transfer, to be retained by the diff with DiffOptions.Keep.
+	// It is nil when nothing was skipped.
+	Skipped *KeepSet
+
+	// ConsumerNames lists the usernames of the consumers of the input.
+	// Consumers are not synced, their names are kept for checking plugin
+	// references to them.
+	ConsumerNames []string
+
+	// Hashes holds the ContentHash of the transferred objects by resource
+	// type and ID. The differ takes objects hashing like their cached copy
+	// as unchanged without comparing them, and compares those without hash.
+	Hashes map[ResourceType]map[string][]byte
+}
+
+// Empty reports whether no resource was transferred
+func (r *TransferredResources) Empty() bool {
+	return len(r.Routes) == 0 && len(r.Services) == 0 && len(r.Upstreams) == 0 &&
+		len(r.SSLs) == 0 && len(r.GlobalRules) == 0 && len(r.Protos) == 0 &&
+		len(r.PluginMetadata) == 0
+}
+
+// Counts returns the number of transferred objects per resource type,
+// leaving out the types without any
+func (r *TransferredResources) Counts() map[ResourceType]int {
+	counts := make(map[ResourceType]int)
+	for resourceType, n := range map[ResourceType]int{
+		ResourceTypeRoute:          len(r.Routes),
+		ResourceTypeService:        len(r.Services),
+		ResourceTypeUpstream:       len(r.Upstreams),
+		ResourceTypeSSL:            len(r.SSLs),
+		ResourceTypeGlobalRule:     len(r.GlobalRules),
+		ResourceTypeProto:          len(r.Protos),
+		ResourceTypePluginMetadata: len(r.PluginMetadata),
+	} {
+		if n > 0 {
+			counts[resourceType] = n
+		}
+	}
+	return counts
 }
 
 // differ implements the Differ interface
@@ -67,6 +339,31 @@ type differ struct {
 	cache Cache
 }
 
+// SelectorFromLabels builds the cache selector of a label scoped sync from
+// its kind, namespace and name labels. Without a name label it selects
+// every name of the namespace, and without a namespace label too every
+// namespace of the kind, so that a sync can own all the resources of a kind
+// or of a namespace. Labels present with an empty value, like the namespace
+// of cluster scoped objects, only select objects whose label is empty.
+func SelectorFromLabels(labels map[string]string) (*KindLabelSelector, error) {
+	kind, hasKind := labels[label.LabelKind]
+	namespace, hasNamespace := labels[label.LabelNamespace]
+	name, hasName := labels[label.LabelName]
+	switch {
+	case !hasKind || kind == "":
+		return nil, fmt.Errorf("%w: label selector %v has no %s label", ErrInvalidInput, labels, label.LabelKind)
+	case hasName && !hasNamespace:
+		return nil, fmt.Errorf("%w: label selector %v selects a name without a %s label",
+			ErrInvalidInput, labels, label.LabelNamespace)
+	}
+	return &KindLabelSelector{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Partial:   !hasName,
+	}, nil
+}
+
 // NewDiffer creates a new Differ instance
 func NewDiffer(cache Cache) Differ {
 	return &differ{
@@ -74,106 +371,877 @@ func NewDiffer(cache Cache) Differ {
 	}
 }
 
-// Diff compares resources and generates events
-func (d *differ) Diff(newResources *TransferredResources, opts *DiffOptions) ([]Event, error) {
-	var events []Event
+// Diff compares resources and generates events. Its errors wrap
+// ErrDiffFailed, and ErrConflict or ErrInvalidInput when the desired
+// resources are at fault.
+func (d *differ) Diff(ctx context.Context, newResources *TransferredResources, opts *DiffOptions) ([]Event, error) {
+	events, err := d.diff(ctx, newResources, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiffFailed, err)
+	}
+	return events, nil
+}
 
-	// Filter resource types to diff
-	typesToDiff := make(map[string]bool)
-	if len(opts.Types) > 0 {
-		for _, t := range opts.Types {
-			typesToDiff[t] = true
+func (d *differ) diff(ctx context.Context, newResources *TransferredResources, opts *DiffOptions) ([]Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !opts.AllowDuplicateIDs {
+		if dups := FindDuplicateIDs(newResources); len(dups) > 0 {
+			errs := make([]error, 0, len(dups))
+			for _, dup := range dups {
+				errs = append(errs, dup)
+			}
+			return nil, errors.Join(errs...)
 		}
 	}
 
+	// Filter resource types to diff
+	types, err := ParseResourceTypes(opts.Types)
+	if err != nil {
+		return nil, err
+	}
+	typesToDiff := make(map[ResourceType]bool, len(types))
+	for _, t := range types {
+		typesToDiff[t] = true
+	}
+
+	cmpOpts, err := ignoreFieldsOptions(opts.IgnoreFields)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build KindSelector from labels if provided
 	var listOpts []ListOption
 	if len(opts.Labels) > 0 {
-		kindSelector := &KindLabelSelector{
-			Kind:      opts.Labels[label.LabelKind],
-			Namespace: opts.Labels[label.LabelNamespace],
-			Name:      opts.Labels[label.LabelName],
+		kindSelector, err := SelectorFromLabels(opts.Labels)
+		if err != nil {
+			return nil, err
 		}
 		listOpts = append(listOpts, kindSelector)
 	}
+	// The differ only reads cached objects, so skip the deep copies
+	listOpts = append(listOpts, WithoutCopy())
 
-	// Diff routes
-	if len(typesToDiff) == 0 || typesToDiff[string(ResourceTypeRoute)] {
-		routeEvents, err := d.diffRoutes(newResources.Routes, listOpts)
-		if err != nil {
-			return nil, fmt.Errorf("failed to diff routes: %w", err)
+	diffed := func(resourceType ResourceType) bool {
+		return len(typesToDiff) == 0 || typesToDiff[resourceType]
+	}
+	// Every cache read of the diff goes through one read transaction, so
+	// that it compares against a consistent snapshot
+	var events []Event
+	err = d.cache.Read(func(tx ReadTxn) error {
+		var err error
+		events, err = diffSnapshot(ctx, tx, newResources, opts, listOpts, diffed, cmpOpts)
+		return err
+	})
+	return events, err
+}
+
+// diffSnapshot implements diff against the cache snapshot tx reads
+func diffSnapshot(
+	ctx context.Context,
+	tx ReadTxn,
+	newResources *TransferredResources,
+	opts *DiffOptions,
+	listOpts []ListOption,
+	diffed func(ResourceType) bool,
+	cmpOpts []cmp.Option,
+) ([]Event, error) {
+	var events []Event
+	cached, err := readCached(tx, newResources, listOpts, diffed)
+	if err != nil {
+		return nil, err
+	}
+	newResources, err = normalizeServiceUpstreams(tx, newResources, cached, opts.OnUpstreamMismatch)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.ForceUpdate && (len(opts.DerivedFrom) > 0 || len(newResources.Hashes) > 0) {
+		newResources = skipUnchanged(newResources, cached, opts.DerivedFrom)
+	}
+
+	// Each pass compares a different resource type, so they can run
+	// concurrently
+	passes := []struct {
+		resourceType ResourceType
+		name         string
+		run          func(context.Context) ([]Event, error)
+	}{
+		{ResourceTypeRoute, "routes", func(ctx context.Context) ([]Event, error) {
+			return diffRoutes(ctx, newResources.Routes, cached.routes, cmpOpts)
+		}},
+		{ResourceTypeService, "services", func(ctx context.Context) ([]Event, error) {
+			return diffServices(ctx, newResources.Services, cached.services, cmpOpts)
+		}},
+		{ResourceTypeUpstream, "upstreams", func(ctx context.Context) ([]Event, error) {
+			return diffUpstreams(ctx, newResources.Upstreams, cached.upstreams, cached.unscopedUpstreams, cmpOpts)
+		}},
+		{ResourceTypeSSL, "ssls", func(ctx context.Context) ([]Event, error) {
+			return diffSSLs(ctx, newResources.SSLs, cached.ssls, cmpOpts)
+		}},
+		{ResourceTypeGlobalRule, "global rules", func(ctx context.Context) ([]Event, error) {
+			return diffGlobalRules(ctx, newResources.GlobalRules, cached.globalRules, cached.unscopedGlobalRules,
+				cmpOpts, opts.ForceOwnership)
+		}},
+		{ResourceTypeProto, "protos", func(ctx context.Context) ([]Event, error) {
+			return diffProtos(ctx, newResources.Protos, cached.protos, cmpOpts, opts.IncludeChanges)
+		}},
+		{ResourceTypePluginMetadata, "plugin metadata", func(ctx context.Context) ([]Event, error) {
+			return diffPluginMetadata(ctx, newResources.PluginMetadata, cached.pluginMetadata,
+				cached.unscopedPluginMetadata, cmpOpts, opts.ForceOwnership)
+		}},
+	}
+
+	results := make([][]Event, len(passes))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i, pass := range passes {
+		if !diffed(pass.resourceType) {
+			continue
+		}
+		g.Go(func() error {
+			passEvents, err := pass.run(gctx)
+			if err != nil {
+				return fmt.Errorf("failed to diff %s: %w", pass.name, err)
+			}
+			results[i] = passEvents
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for _, passEvents := range results {
+		events = append(events, passEvents...)
+	}
+	if len(opts.ProtectedGlobalRules) > 0 {
+		events = dropProtectedDeletes(events, opts)
+	}
+	if opts.Keep != nil {
+		events = dropKeptDeletes(events, opts.Keep)
+	}
+	if opts.ForceUpdate {
+		events = appendForcedUpdates(events, newResources, cached, diffed)
+	}
+	if len(opts.Labels) > 0 {
+		if events, err = checkOwnership(tx, events, opts.ForceOwnership, cmpOpts); err != nil {
+			return nil, err
+		}
+	}
+	for i := range events {
+		if events[i].Type != EventTypeCreate {
+			events[i].ModRevision = cached.revisions[events[i].ResourceType][events[i].ResourceID]
+		}
+	}
+	setParentIDs(events, newResources.SSLs, cached.ssls)
+
+	// Sort events by execution order and number them accordingly
+	sortEvents(events)
+	for i := range events {
+		events[i].SyncID = opts.SyncID
+		events[i].Sequence = i
+	}
+
+	if opts.IncludeChanges {
+		if err := populateChanges(events); err != nil {
+			return nil, err
 		}
-		events = append(events, routeEvents...)
 	}
 
-	// Diff services
-	if len(typesToDiff) == 0 || typesToDiff[string(ResourceTypeService)] {
-		serviceEvents, err := d.diffServices(newResources.Services, listOpts)
+	return events, nil
+}
+
+// dropProtectedDeletes removes the DELETE events of protected global rules
+func dropProtectedDeletes(events []Event, opts *DiffOptions) []Event {
+	return slices.DeleteFunc(events, func(event Event) bool {
+		protected := event.Type == EventTypeDelete && event.ResourceType == ResourceTypeGlobalRule &&
+			slices.Contains(opts.ProtectedGlobalRules, event.ResourceID)
+		if protected && opts.OnProtected != nil {
+			opts.OnProtected(event)
+		}
+		return protected
+	})
+}
+
+// dropKeptDeletes removes the DELETE events of the objects keep retains,
+// with the routes of the kept services and the upstreams they reference
+func dropKeptDeletes(events []Event, keep *KeepSet) []Event {
+	keptServices := maps.Clone(keep.IDs[ResourceTypeService])
+	if keptServices == nil {
+		keptServices = make(map[string]bool)
+	}
+	keptUpstreams := make(map[string]bool)
+	for _, event := range events {
+		service, ok := event.OldValue.(*Service)
+		if !ok || event.Type != EventTypeDelete || !keep.keeps(event.ResourceType, event.ResourceID, service.Labels) {
+			continue
+		}
+		keptServices[event.ResourceID] = true
+		if service.UpstreamID != nil {
+			keptUpstreams[*service.UpstreamID] = true
+		}
+	}
+	return slices.DeleteFunc(events, func(event Event) bool {
+		if event.Type != EventTypeDelete {
+			return false
+		}
+		switch old := event.OldValue.(type) {
+		case *Route:
+			if old.ServiceID != nil && keptServices[*old.ServiceID] {
+				return true
+			}
+		case *Upstream:
+			if keptUpstreams[event.ResourceID] {
+				return true
+			}
+		}
+		return keep.keeps(event.ResourceType, event.ResourceID, KineLabelIndexer.GetLabels(event.OldValue))
+	})
+}
+
+// cachedResources holds the cached objects a diff compares against by ID,
+// read from a single cache snapshot
+type cachedResources struct {
+	routes      map[string]*Route
+	services    map[string]*Service
+	upstreams   map[string]*Upstream
+	ssls        map[string]*SSL
+	globalRules map[string]*GlobalRule
+	protos      map[string]*Proto
+
+	pluginMetadata map[string]*PluginMetadata
+
+	// unscopedUpstreams, unscopedGlobalRules and unscopedPluginMetadata
+	// hold the desired upstreams, global rules and plugin metadata found in
+	// the cache outside of the label scope
+	unscopedUpstreams      map[string]*Upstream
+	unscopedGlobalRules    map[string]*GlobalRule
+	unscopedPluginMetadata map[string]*PluginMetadata
+
+	// revisions and hashes hold the revisions and content hashes of all
+	// cached objects of the diffed resource types, in and out of the label
+	// scope
+	revisions map[ResourceType]map[string]uint64
+	hashes    map[ResourceType]map[string][]byte
+}
+
+// readCached reads the cached objects of the diffed resource types from the
+// read transaction of the diff. Reading the tables one by one would let a
+// concurrent sync slip in between, showing for instance a service without
+// the routes just created with it and producing bogus deletes.
+func readCached(
+	tx ReadTxn,
+	newResources *TransferredResources,
+	listOpts []ListOption,
+	diffed func(ResourceType) bool,
+) (*cachedResources, error) {
+	cached := &cachedResources{
+		routes:              make(map[string]*Route),
+		services:            make(map[string]*Service),
+		upstreams:           make(map[string]*Upstream),
+		ssls:                make(map[string]*SSL),
+		globalRules:         make(map[string]*GlobalRule),
+		protos:              make(map[string]*Proto),
+		unscopedUpstreams:   make(map[string]*Upstream),
+		unscopedGlobalRules: make(map[string]*GlobalRule),
+
+		pluginMetadata:         make(map[string]*PluginMetadata),
+		unscopedPluginMetadata: make(map[string]*PluginMetadata),
+
+		revisions: make(map[ResourceType]map[string]uint64),
+		hashes:    make(map[ResourceType]map[string][]byte),
+	}
+	if diffed(ResourceTypeRoute) {
+		// Stream cached routes into the map without an intermediate slice
+		err := tx.ForEachRoute(func(route *Route) bool {
+			cached.routes[route.ID] = route
+			return true
+		}, listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached routes: %w", err)
+		}
+	}
+	if diffed(ResourceTypeService) {
+		services, err := tx.ListServices(listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached services: %w", err)
+		}
+		for _, service := range services {
+			cached.services[service.ID] = service
+		}
+	}
+	if diffed(ResourceTypeUpstream) {
+		upstreams, err := tx.ListUpstreams(listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached upstreams: %w", err)
+		}
+		for _, upstream := range upstreams {
+			cached.upstreams[upstream.ID] = upstream
+		}
+		// Shared upstreams carry no owner labels, so a label scoped
+		// listing misses them
+		for _, upstream := range newResources.Upstreams {
+			if _, ok := cached.upstreams[upstream.ID]; ok {
+				continue
+			}
+			existing, err := tx.GetUpstream(upstream.ID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cached upstream %s: %w", upstream.ID, err)
+			}
+			cached.unscopedUpstreams[upstream.ID] = existing
+		}
+	}
+	if diffed(ResourceTypeSSL) {
+		ssls, err := tx.ListSSL(listOpts...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to diff services: %w", err)
+			return nil, fmt.Errorf("failed to list cached ssls: %w", err)
+		}
+		for _, ssl := range ssls {
+			cached.ssls[ssl.ID] = ssl
+		}
+	}
+	if diffed(ResourceTypeGlobalRule) {
+		rules, err := tx.ListGlobalRules(listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached global rules: %w", err)
+		}
+		for _, rule := range rules {
+			cached.globalRules[rule.ID] = rule
+		}
+		// Rules outside of the label scope may still be cached under
+		// another owner
+		for _, rule := range newResources.GlobalRules {
+			if _, ok := cached.globalRules[rule.ID]; ok {
+				continue
+			}
+			existing, err := tx.GetGlobalRule(rule.ID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cached global rule %s: %w", rule.ID, err)
+			}
+			cached.unscopedGlobalRules[rule.ID] = existing
+		}
+	}
+	if diffed(ResourceTypeProto) {
+		protos, err := tx.ListProtos(listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached protos: %w", err)
+		}
+		for _, proto := range protos {
+			cached.protos[proto.ID] = proto
+		}
+	}
+	if diffed(ResourceTypePluginMetadata) {
+		allMetadata, err := tx.ListPluginMetadata(listOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached plugin metadata: %w", err)
+		}
+		for _, metadata := range allMetadata {
+			cached.pluginMetadata[metadata.ID] = metadata
+		}
+		// Like global rules, plugin metadata outside of the label scope
+		// may still be cached under another owner
+		for _, metadata := range newResources.PluginMetadata {
+			if _, ok := cached.pluginMetadata[metadata.ID]; ok {
+				continue
+			}
+			existing, err := tx.GetPluginMetadata(metadata.ID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cached plugin metadata %s: %w", metadata.ID, err)
+			}
+			cached.unscopedPluginMetadata[metadata.ID] = existing
+		}
+	}
+	for _, resourceType := range ResourceTypes {
+		if !diffed(resourceType) {
+			continue
+		}
+		revisions, err := tx.Revisions(resourceType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached %s revisions: %w", resourceType, err)
+		}
+		cached.revisions[resourceType] = revisions
+		if len(newResources.Hashes[resourceType]) == 0 {
+			continue
+		}
+		hashes, err := tx.ContentHashes(resourceType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached %s hashes: %w", resourceType, err)
+		}
+		cached.hashes[resourceType] = hashes
+	}
+	return cached, nil
+}
+
+// skipUnchanged leaves out the desired objects derived from the revision
+// still cached or hashing like their cached copy, together with these
+// copies, so that the passes neither compare nor delete them. Only objects
+// whose hash differs go through the slower comparison, which may still find
+// them equal, for instance when they differ by defaults.
+func skipUnchanged(
+	desired *TransferredResources,
+	cached *cachedResources,
+	derivedFrom map[ResourceType]map[string]uint64,
+) *TransferredResources {
+	unchanged := func(resourceType ResourceType) func(string) bool {
+		return func(id string) bool {
+			if revision, ok := derivedFrom[resourceType][id]; ok {
+				if cachedRevision, ok := cached.revisions[resourceType][id]; ok && revision == cachedRevision {
+					return true
+				}
+			}
+			hash, ok := desired.Hashes[resourceType][id]
+			cachedHash, cachedOK := cached.hashes[resourceType][id]
+			return ok && cachedOK && bytes.Equal(hash, cachedHash)
 		}
-		events = append(events, serviceEvents...)
 	}
+	kept := *desired
+	kept.Routes = keepChanged(desired.Routes, func(r *Route) string { return r.ID },
+		unchanged(ResourceTypeRoute), cached.routes)
+	kept.Services = keepChanged(desired.Services, func(s *Service) string { return s.ID },
+		unchanged(ResourceTypeService), cached.services)
+	kept.Upstreams = keepChanged(desired.Upstreams, func(u *Upstream) string { return u.ID },
+		unchanged(ResourceTypeUpstream), cached.upstreams, cached.unscopedUpstreams)
+	kept.SSLs = keepChanged(desired.SSLs, func(s *SSL) string { return s.ID },
+		unchanged(ResourceTypeSSL), cached.ssls)
+	kept.GlobalRules = keepChanged(desired.GlobalRules, func(r *GlobalRule) string { return r.ID },
+		unchanged(ResourceTypeGlobalRule), cached.globalRules, cached.unscopedGlobalRules)
+	kept.Protos = keepChanged(desired.Protos, func(p *Proto) string { return p.ID },
+		unchanged(ResourceTypeProto), cached.protos)
+	kept.PluginMetadata = keepChanged(desired.PluginMetadata, func(m *PluginMetadata) string { return m.ID },
+		unchanged(ResourceTypePluginMetadata), cached.pluginMetadata, cached.unscopedPluginMetadata)
+	return &kept
+}
 
-	// Diff upstreams
-	if len(typesToDiff) == 0 || typesToDiff[string(ResourceTypeUpstream)] {
-		upstreamEvents, err := d.diffUpstreams(newResources.Upstreams, listOpts)
+// UpstreamMismatch reports a service embedding an upstream that differs
+// from the upstream its upstream_id references
+type UpstreamMismatch struct {
+	ServiceID  string
+	UpstreamID string
+}
+
+func (m *UpstreamMismatch) Error() string {
+	return fmt.Sprintf("service %s embeds an upstream differing from its upstream_id %s, keeping the reference",
+		m.ServiceID, m.UpstreamID)
+}
+
+// normalizeServiceUpstreams drops the embedded upstream of the desired
+// services referencing an upstream by upstream_id, so that they are
+// compared and stored with the reference only and changes of the
+// redundant copy cause no updates. Embedded upstreams differing from the
+// referenced one, besides their metadata, are reported to onMismatch.
+// The desired services are not modified, normalized copies replace them.
+func normalizeServiceUpstreams(
+	tx ReadTxn,
+	desired *TransferredResources,
+	cached *cachedResources,
+	onMismatch func(*UpstreamMismatch),
+) (*TransferredResources, error) {
+	var desiredUpstreams map[string]*Upstream
+	referenced := func(id string) (*Upstream, error) {
+		if desiredUpstreams == nil {
+			desiredUpstreams = make(map[string]*Upstream, len(desired.Upstreams))
+			for _, upstream := range desired.Upstreams {
+				desiredUpstreams[upstream.ID] = upstream
+			}
+		}
+		for _, upstreams := range []map[string]*Upstream{desiredUpstreams, cached.upstreams, cached.unscopedUpstreams} {
+			if upstream, ok := upstreams[id]; ok {
+				return upstream, nil
+			}
+		}
+		upstream, err := tx.GetUpstream(id)
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return upstream, err
+	}
+
+	var normalized *TransferredResources
+	for i, service := range desired.Services {
+		if service.UpstreamID == nil || service.Upstream == nil {
+			continue
+		}
+		upstream, err := referenced(*service.UpstreamID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to diff upstreams: %w", err)
+			return nil, fmt.Errorf("failed to get upstream %s of service %s: %w", *service.UpstreamID, service.ID, err)
+		}
+		if upstream != nil && onMismatch != nil &&
+			!areUpstreamsEqual(service.Upstream, upstream, cmpopts.IgnoreFields(Upstream{}, "Metadata")) {
+			onMismatch(&UpstreamMismatch{ServiceID: service.ID, UpstreamID: *service.UpstreamID})
+		}
+
+		if normalized == nil {
+			copied := *desired
+			copied.Services = slices.Clone(desired.Services)
+			copied.Hashes = maps.Clone(desired.Hashes)
+			if hashes, ok := copied.Hashes[ResourceTypeService]; ok {
+				copied.Hashes[ResourceTypeService] = maps.Clone(hashes)
+			}
+			normalized = &copied
+		}
+		withReference := *service
+		withReference.Upstream = nil
+		normalized.Services[i] = &withReference
+		// The hash covered the embedded upstream, the comparison decides
+		delete(normalized.Hashes[ResourceTypeService], service.ID)
+	}
+	if normalized == nil {
+		return desired, nil
+	}
+	return normalized, nil
+}
+
+// setParentIDs sets the ParentID of the route, service and SSL events from
+// the new value of creates and updates and the old value of deletes. SSLs
+// are taken as split from an ADC SSL with several certificates when other
+// desired or cached SSLs share their owner and name.
+func setParentIDs(events []Event, desiredSSLs []*SSL, cachedSSLs map[string]*SSL) {
+	sslGroup := func(ssl *SSL) string {
+		return ownerOf(ssl.Labels) + "\x00" + ssl.Name
+	}
+	desiredGroups, cachedGroups := make(map[string]int), make(map[string]int)
+	for _, ssl := range desiredSSLs {
+		desiredGroups[sslGroup(ssl)]++
+	}
+	for _, ssl := range cachedSSLs {
+		cachedGroups[sslGroup(ssl)]++
+	}
+
+	for i := range events {
+		value := events[i].NewValue
+		if events[i].Type == EventTypeDelete {
+			value = events[i].OldValue
+		}
+		switch obj := value.(type) {
+		case *Route:
+			if obj.ServiceID != nil {
+				events[i].ParentID = *obj.ServiceID
+			}
+		case *Service:
+			if obj.UpstreamID != nil {
+				events[i].ParentID = *obj.UpstreamID
+			}
+		case *SSL:
+			if group := sslGroup(obj); obj.Name != "" && (desiredGroups[group] > 1 || cachedGroups[group] > 1) {
+				events[i].ParentID = obj.Name
+			}
+		}
+	}
+}
+
+// appendForcedUpdates appends an UPDATE event for every desired object of
+// the diffed types found in the cache without an event
+func appendForcedUpdates(
+	events []Event,
+	desired *TransferredResources,
+	cached *cachedResources,
+	diffed func(ResourceType) bool,
+) []Event {
+	evented := make(map[ResourceType]map[string]bool)
+	for _, event := range events {
+		if evented[event.ResourceType] == nil {
+			evented[event.ResourceType] = make(map[string]bool)
 		}
-		events = append(events, upstreamEvents...)
+		evented[event.ResourceType][event.ResourceID] = true
 	}
+	forced := func(resourceType ResourceType) map[string]bool {
+		if !diffed(resourceType) {
+			return nil
+		}
+		if evented[resourceType] == nil {
+			evented[resourceType] = make(map[string]bool)
+		}
+		return evented[resourceType]
+	}
+	events = appendForced(events, ResourceTypeRoute, forced(ResourceTypeRoute), desired.Routes,
+		func(r *Route) (string, string) { return r.ID, r.Name }, cached.routes)
+	events = appendForced(events, ResourceTypeService, forced(ResourceTypeService), desired.Services,
+		func(s *Service) (string, string) { return s.ID, s.Name }, cached.services)
+	events = appendForced(events, ResourceTypeUpstream, forced(ResourceTypeUpstream), desired.Upstreams,
+		func(u *Upstream) (string, string) { return u.ID, u.Name }, cached.upstreams, cached.unscopedUpstreams)
+	events = appendForced(events, ResourceTypeSSL, forced(ResourceTypeSSL), desired.SSLs,
+		func(s *SSL) (string, string) { return s.ID, s.Name }, cached.ssls)
+	events = appendForced(events, ResourceTypeGlobalRule, forced(ResourceTypeGlobalRule), desired.GlobalRules,
+		func(r *GlobalRule) (string, string) { return r.ID, r.ID }, cached.globalRules, cached.unscopedGlobalRules)
+	events = appendForced(events, ResourceTypeProto, forced(ResourceTypeProto), desired.Protos,
+		func(p *Proto) (string, string) { return p.ID, p.Name }, cached.protos)
+	events = appendForced(events, ResourceTypePluginMetadata, forced(ResourceTypePluginMetadata), desired.PluginMetadata,
+		func(m *PluginMetadata) (string, string) { return m.ID, m.ID }, cached.pluginMetadata, cached.unscopedPluginMetadata)
+	return events
+}
 
-	// Diff SSLs
-	if len(typesToDiff) == 0 || typesToDiff[string(ResourceTypeSSL)] {
-		sslEvents, err := d.diffSSLs(newResources.SSLs, listOpts)
+// appendForced appends the forced UPDATE events of the desired objects of
+// one type. evented holds the IDs having an event already, nil when the type
+// is not diffed. The last of several desired objects sharing an ID wins.
+func appendForced[T any](
+	events []Event,
+	resourceType ResourceType,
+	evented map[string]bool,
+	objs []*T,
+	idAndName func(*T) (string, string),
+	cachedMaps ...map[string]*T,
+) []Event {
+	if evented == nil {
+		return events
+	}
+	for i := len(objs) - 1; i >= 0; i-- {
+		id, name := idAndName(objs[i])
+		if evented[id] {
+			continue
+		}
+		for _, m := range cachedMaps {
+			if old, ok := m[id]; ok {
+				evented[id] = true
+				events = append(events, Event{
+					Type:         EventTypeUpdate,
+					ResourceType: resourceType,
+					ResourceID:   id,
+					ResourceName: name,
+					OldValue:     old,
+					NewValue:     objs[i],
+					Forced:       true,
+				})
+				break
+			}
+		}
+	}
+	return events
+}
+
+// keepChanged returns the objects not unchanged, removing the unchanged
+// ones from the cached maps. Only objects found in the cached maps can be
+// unchanged, the others are outside of the diffed scope.
+func keepChanged[T any](objs []*T, idOf func(*T) string, unchanged func(string) bool, cachedMaps ...map[string]*T) []*T {
+	// Decide by ID first, objects may share an ID when duplicates are allowed
+	skipped := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		id := idOf(obj)
+		if _, ok := skipped[id]; ok {
+			continue
+		}
+		cached := slices.ContainsFunc(cachedMaps, func(m map[string]*T) bool {
+			_, ok := m[id]
+			return ok
+		})
+		skipped[id] = cached && unchanged(id)
+	}
+	kept := make([]*T, 0, len(objs))
+	for _, obj := range objs {
+		if !skipped[idOf(obj)] {
+			kept = append(kept, obj)
+		}
+	}
+	for id, skip := range skipped {
+		if !skip {
+			continue
+		}
+		for _, cachedMap := range cachedMaps {
+			delete(cachedMap, id)
+		}
+	}
+	return kept
+}
+
+// checkOwnership looks up the IDs of CREATE events in the whole cache. A
+// label scoped diff does not see resources of other owners, so creating one
+// of their IDs would silently overwrite them and the owners would undo each
+// other's syncs forever. Such events fail with an OwnershipConflictError,
+// or become updates taking the resource over when force is set. Objects
+// equal to their cached copy under cmpOpts are dropped.
+func checkOwnership(tx ReadTxn, events []Event, force bool, cmpOpts []cmp.Option) ([]Event, error) {
+	var conflicts []error
+	checked := events[:0]
+	for _, event := range events {
+		if event.Type != EventTypeCreate {
+			checked = append(checked, event)
+			continue
+		}
+		existing, err := diffOneIn(tx, event.ResourceType, event.NewValue, event.ResourceID, cmpOpts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to diff ssls: %w", err)
+			return nil, err
+		}
+		if existing == nil {
+			// Identical to the cached object, nothing to apply
+			continue
+		}
+		if existing.Type == EventTypeUpdate {
+			owner := ownerOf(KineLabelIndexer.GetLabels(existing.OldValue))
+			claimant := ownerOf(KineLabelIndexer.GetLabels(event.NewValue))
+			if !force && owner != "" && claimant != "" && !strings.EqualFold(owner, claimant) {
+				conflicts = append(conflicts, &OwnershipConflictError{
+					ResourceType: event.ResourceType,
+					ID:           event.ResourceID,
+					Owner:        owner,
+					Claimant:     claimant,
+				})
+				continue
+			}
+			// The etcd adapter ignores creates of existing keys
+			event.Type, event.OldValue = EventTypeUpdate, existing.OldValue
 		}
-		events = append(events, sslEvents...)
+		checked = append(checked, event)
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
 	}
+	return checked, nil
+}
 
-	// Diff global rules
-	if len(typesToDiff) == 0 || typesToDiff[string(ResourceTypeGlobalRule)] {
-		globalRuleEvents, err := d.diffGlobalRules(newResources.GlobalRules, listOpts)
+// populateChanges computes the field level changes of UPDATE events
+func populateChanges(events []Event) error {
+	for i := range events {
+		if events[i].Type != EventTypeUpdate {
+			continue
+		}
+		changes, err := ComputeChanges(events[i].OldValue, events[i].NewValue)
 		if err != nil {
-			return nil, fmt.Errorf("failed to diff global rules: %w", err)
+			return fmt.Errorf("failed to compute changes of %s %s: %w",
+				events[i].ResourceType, events[i].ResourceID, err)
 		}
-		events = append(events, globalRuleEvents...)
+		events[i].Changes = changes
 	}
+	return nil
+}
 
-	// Sort events by execution order
-	sortEvents(events)
+// DiffOne compares a single desired object with the cache
+func (d *differ) DiffOne(resourceType ResourceType, desired any, id string) (*Event, error) {
+	var event *Event
+	err := d.cache.Read(func(tx ReadTxn) error {
+		var err error
+		event, err = diffOneIn(tx, resourceType, desired, id, nil)
+		return err
+	})
+	return event, err
+}
 
-	return events, nil
+// diffOneIn implements DiffOne against the cache snapshot tx reads,
+// comparing objects under cmpOpts
+func diffOneIn(tx ReadTxn, resourceType ResourceType, desired any, id string, cmpOpts []cmp.Option) (*Event, error) {
+	switch resourceType {
+	case ResourceTypeRoute:
+		return diffOne(resourceType, desired, id, tx.GetRoute, areRoutesEqual,
+			func(r *Route) string { return r.Name }, cmpOpts)
+	case ResourceTypeService:
+		return diffOne(resourceType, desired, id, tx.GetService, areServicesEqual,
+			func(s *Service) string { return s.Name }, cmpOpts)
+	case ResourceTypeUpstream:
+		return diffOne(resourceType, desired, id, tx.GetUpstream, areUpstreamsEqual,
+			func(u *Upstream) string { return u.Name }, cmpOpts)
+	case ResourceTypeSSL:
+		return diffOne(resourceType, desired, id, tx.GetSSL, areSSLsEqual,
+			func(ssl *SSL) string { return ssl.Name }, cmpOpts)
+	case ResourceTypeGlobalRule:
+		return diffOne(resourceType, desired, id, tx.GetGlobalRule, areGlobalRulesEqual,
+			func(gr *GlobalRule) string { return gr.ID }, cmpOpts)
+	case ResourceTypeProto:
+		return diffOne(resourceType, desired, id, tx.GetProto, areProtosEqual,
+			func(p *Proto) string { return p.Name }, cmpOpts)
+	case ResourceTypePluginMetadata:
+		return diffOne(resourceType, desired, id, tx.GetPluginMetadata, arePluginMetadataEqual,
+			func(m *PluginMetadata) string { return m.ID }, cmpOpts)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownResourceType, resourceType)
+	}
 }
 
-// diffRoutes compares new routes with cached routes
-func (d *differ) diffRoutes(newRoutes []*Route, listOpts []ListOption) ([]Event, error) {
-	// Get cached routes
-	cachedRoutes, err := d.cache.ListRoutes(listOpts...)
+// lookup returns a get function reading objects from m
+func lookup[T any](m map[string]*T) func(string) (*T, error) {
+	return func(id string) (*T, error) {
+		if obj, ok := m[id]; ok {
+			return obj, nil
+		}
+		return nil, ErrNotFound
+	}
+}
+
+// diffOne implements DiffOne for a single resource type
+func diffOne[T any](
+	resourceType ResourceType,
+	desired any,
+	id string,
+	get func(string) (*T, error),
+	equal func(a, b *T, opts ...cmp.Option) bool,
+	name func(*T) string,
+	cmpOpts []cmp.Option,
+) (*Event, error) {
+	var newObj *T
+	if desired != nil {
+		obj, ok := desired.(*T)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected object type %T for %s", ErrInvalidInput, desired, resourceType)
+		}
+		newObj = obj
+	}
+
+	cached, err := get(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: failed to get cached %s %s: %w", ErrDiffFailed, resourceType, id, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to list cached routes: %w", err)
+		cached = nil
+	}
+
+	switch {
+	case newObj == nil && cached == nil:
+		return nil, nil
+	case newObj == nil:
+		return &Event{
+			Type:         EventTypeDelete,
+			ResourceType: resourceType,
+			ResourceID:   id,
+			ResourceName: name(cached),
+			OldValue:     cached,
+		}, nil
+	case cached == nil:
+		return &Event{
+			Type:         EventTypeCreate,
+			ResourceType: resourceType,
+			ResourceID:   id,
+			ResourceName: name(newObj),
+			NewValue:     newObj,
+		}, nil
+	case equal(cached, newObj, cmpOpts...):
+		return nil, nil
+	default:
+		return &Event{
+			Type:         EventTypeUpdate,
+			ResourceType: resourceType,
+			ResourceID:   id,
+			ResourceName: name(newObj),
+			OldValue:     cached,
+			NewValue:     newObj,
+		}, nil
 	}
+}
 
+// diffRoutes compares new routes with cached routes
+func diffRoutes(ctx context.Context, newRoutes []*Route, cachedMap map[string]*Route, cmpOpts []cmp.Option) ([]Event, error) {
 	// Build maps for comparison
 	newMap := make(map[string]*Route)
 	for _, route := range newRoutes {
 		newMap[route.ID] = route
 	}
 
-	cachedMap := make(map[string]*Route)
-	for _, route := range cachedRoutes {
-		cachedMap[route.ID] = route
-	}
-
 	var events []Event
 
 	// Find CREATE and UPDATE events
 	for id, newRoute := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if cachedRoute, exists := cachedMap[id]; exists {
 			// Check if update is needed
-			if !areRoutesEqual(cachedRoute, newRoute) {
+			if !areRoutesEqual(cachedRoute, newRoute, cmpOpts...) {
 				events = append(events, Event{
 					Type:         EventTypeUpdate,
 					ResourceType: ResourceTypeRoute,
@@ -197,6 +1265,9 @@ func (d *differ) diffRoutes(newRoutes []*Route, listOpts []ListOption) ([]Event,
 
 	// Find DELETE events
 	for id, cachedRoute := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, exists := newMap[id]; !exists {
 			events = append(events, Event{
 				Type:         EventTypeDelete,
@@ -211,32 +1282,24 @@ func (d *differ) diffRoutes(newRoutes []*Route, listOpts []ListOption) ([]Event,
 	return events, nil
 }
 
-// diffServices compares new services with cached services
-func (d *differ) diffServices(newServices []*Service, listOpts []ListOption) ([]Event, error) {
-	// Get cached services
-	cachedServices, err := d.cache.ListServices(listOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list cached services: %w", err)
-	}
-
+// diffServices compares new services with cached services
+func diffServices(ctx context.Context, newServices []*Service, cachedMap map[string]*Service, cmpOpts []cmp.Option) ([]Event, error) {
 	// Build maps for comparison
 	newMap := make(map[string]*Service)
 	for _, service := range newServices {
 		newMap[service.ID] = service
 	}
 
-	cachedMap := make(map[string]*Service)
-	for _, service := range cachedServices {
-		cachedMap[service.ID] = service
-	}
-
 	var events []Event
 
 	// Find CREATE and UPDATE events
 	for id, newService := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if cachedService, exists := cachedMap[id]; exists {
 			// Check if update is needed
-			if !areServicesEqual(cachedService, newService) {
+			if !areServicesEqual(cachedService, newService, cmpOpts...) {
 				events = append(events, Event{
 					Type:         EventTypeUpdate,
 					ResourceType: ResourceTypeService,
@@ -260,6 +1323,9 @@ func (d *differ) diffServices(newServices []*Service, listOpts []ListOption) ([]
 
 	// Find DELETE events
 	for id, cachedService := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, exists := newMap[id]; !exists {
 			events = append(events, Event{
 				Type:         EventTypeDelete,
@@ -274,32 +1340,30 @@ func (d *differ) diffServices(newServices []*Service, listOpts []ListOption) ([]
 	return events, nil
 }
 
-// diffUpstreams compares new upstreams with cached upstreams
-func (d *differ) diffUpstreams(newUpstreams []*Upstream, listOpts []ListOption) ([]Event, error) {
-	// Get cached upstreams
-	cachedUpstreams, err := d.cache.ListUpstreams(listOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list cached upstreams: %w", err)
-	}
-
+// diffUpstreams compares new upstreams with cached upstreams. Desired
+// upstreams cached outside of the label scope are looked up in unscopedMap.
+func diffUpstreams(
+	ctx context.Context,
+	newUpstreams []*Upstream,
+	cachedMap, unscopedMap map[string]*Upstream,
+	cmpOpts []cmp.Option,
+) ([]Event, error) {
 	// Build maps for comparison
 	newMap := make(map[string]*Upstream)
 	for _, upstream := range newUpstreams {
 		newMap[upstream.ID] = upstream
 	}
 
-	cachedMap := make(map[string]*Upstream)
-	for _, upstream := range cachedUpstreams {
-		cachedMap[upstream.ID] = upstream
-	}
-
 	var events []Event
 
 	// Find CREATE and UPDATE events
 	for id, newUpstream := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if cachedUpstream, exists := cachedMap[id]; exists {
 			// Check if update is needed
-			if !areUpstreamsEqual(cachedUpstream, newUpstream) {
+			if !areUpstreamsEqual(cachedUpstream, newUpstream, cmpOpts...) {
 				events = append(events, Event{
 					Type:         EventTypeUpdate,
 					ResourceType: ResourceTypeUpstream,
@@ -310,19 +1374,24 @@ func (d *differ) diffUpstreams(newUpstreams []*Upstream, listOpts []ListOption)
 				})
 			}
 		} else {
-			// Create new upstream
-			events = append(events, Event{
-				Type:         EventTypeCreate,
-				ResourceType: ResourceTypeUpstream,
-				ResourceID:   id,
-				ResourceName: newUpstream.Name,
-				NewValue:     newUpstream,
-			})
+			// Shared upstreams carry no owner labels, so a label scoped
+			// listing misses them. Look them up before creating.
+			event, err := diffOne(ResourceTypeUpstream, newUpstream, id, lookup(unscopedMap), areUpstreamsEqual,
+				func(u *Upstream) string { return u.Name }, cmpOpts)
+			if err != nil {
+				return nil, err
+			}
+			if event != nil {
+				events = append(events, *event)
+			}
 		}
 	}
 
 	// Find DELETE events
 	for id, cachedUpstream := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, exists := newMap[id]; !exists {
 			events = append(events, Event{
 				Type:         EventTypeDelete,
@@ -338,31 +1407,23 @@ func (d *differ) diffUpstreams(newUpstreams []*Upstream, listOpts []ListOption)
 }
 
 // diffSSLs compares new SSLs with cached SSLs
-func (d *differ) diffSSLs(newSSLs []*SSL, listOpts []ListOption) ([]Event, error) {
-	// Get cached SSLs
-	cachedSSLs, err := d.cache.ListSSL(listOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list cached ssls: %w", err)
-	}
-
+func diffSSLs(ctx context.Context, newSSLs []*SSL, cachedMap map[string]*SSL, cmpOpts []cmp.Option) ([]Event, error) {
 	// Build maps for comparison
 	newMap := make(map[string]*SSL)
 	for _, ssl := range newSSLs {
 		newMap[ssl.ID] = ssl
 	}
 
-	cachedMap := make(map[string]*SSL)
-	for _, ssl := range cachedSSLs {
-		cachedMap[ssl.ID] = ssl
-	}
-
 	var events []Event
 
 	// Find CREATE and UPDATE events
 	for id, newSSL := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if cachedSSL, exists := cachedMap[id]; exists {
 			// Check if update is needed
-			if !areSSLsEqual(cachedSSL, newSSL) {
+			if !areSSLsEqual(cachedSSL, newSSL, cmpOpts...) {
 				events = append(events, Event{
 					Type:         EventTypeUpdate,
 					ResourceType: ResourceTypeSSL,
@@ -386,6 +1447,9 @@ func (d *differ) diffSSLs(newSSLs []*SSL, listOpts []ListOption) ([]Event, error
 
 	// Find DELETE events
 	for id, cachedSSL := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, exists := newMap[id]; !exists {
 			events = append(events, Event{
 				Type:         EventTypeDelete,
@@ -400,32 +1464,60 @@ func (d *differ) diffSSLs(newSSLs []*SSL, listOpts []ListOption) ([]Event, error
 	return events, nil
 }
 
-// diffGlobalRules compares new global rules with cached global rules
-func (d *differ) diffGlobalRules(newGlobalRules []*GlobalRule, _ []ListOption) ([]Event, error) {
-	// Get cached global rules - note: global rules don't support label filtering
-	cachedGlobalRules, err := d.cache.ListGlobalRules()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list cached global rules: %w", err)
-	}
-
+// diffGlobalRules compares new global rules with cached global rules. Global
+// rules are keyed by plugin name, so several sources may claim the same one.
+// Unless force is set, overwriting a rule owned by another label set fails.
+// Desired rules cached outside of the label scope are looked up in
+// unscopedMap.
+func diffGlobalRules(
+	ctx context.Context,
+	newGlobalRules []*GlobalRule,
+	cachedMap, unscopedMap map[string]*GlobalRule,
+	cmpOpts []cmp.Option,
+	force bool,
+) ([]Event, error) {
 	// Build maps for comparison
 	newMap := make(map[string]*GlobalRule)
 	for _, rule := range newGlobalRules {
 		newMap[rule.ID] = rule
 	}
 
-	cachedMap := make(map[string]*GlobalRule)
-	for _, rule := range cachedGlobalRules {
-		cachedMap[rule.ID] = rule
+	// Rules outside of the label scope may still be cached under another
+	// owner, look them up so that they are updated instead of created
+	var conflicts []error
+	existingMap := make(map[string]*GlobalRule, len(newMap))
+	for id, newRule := range newMap {
+		existing, ok := cachedMap[id]
+		if !ok {
+			if existing, ok = unscopedMap[id]; !ok {
+				continue
+			}
+		}
+		existingMap[id] = existing
+		owner, claimant := ownerOf(existing.Labels), ownerOf(newRule.Labels)
+		if !force && owner != "" && claimant != "" && !strings.EqualFold(owner, claimant) {
+			conflicts = append(conflicts, &OwnershipConflictError{
+				ResourceType: ResourceTypeGlobalRule,
+				ID:           id,
+				Owner:        owner,
+				Claimant:     claimant,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
 	}
 
 	var events []Event
 
 	// Find CREATE and UPDATE events
 	for id, newRule := range newMap {
-		if cachedRule, exists := cachedMap[id]; exists {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if cachedRule, exists := existingMap[id]; exists {
 			// Check if update is needed
-			if !areGlobalRulesEqual(cachedRule, newRule) {
+			if !areGlobalRulesEqual(cachedRule, newRule, cmpOpts...) {
 				events = append(events, Event{
 					Type:         EventTypeUpdate,
 					ResourceType: ResourceTypeGlobalRule,
@@ -449,6 +1541,9 @@ func (d *differ) diffGlobalRules(newGlobalRules []*GlobalRule, _ []ListOption) (
 
 	// Find DELETE events
 	for id, cachedRule := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, exists := newMap[id]; !exists {
 			events = append(events, Event{
 				Type:         EventTypeDelete,
@@ -463,38 +1558,438 @@ func (d *differ) diffGlobalRules(newGlobalRules []*GlobalRule, _ []ListOption) (
 	return events, nil
 }
 
+// diffPluginMetadata compares new plugin metadata with cached plugin
+// metadata. Like global rules, plugin metadata is keyed by plugin name and
+// shared by every source configuring the plugin, so unless force is set,
+// overwriting metadata owned by another label set fails. Desired metadata
+// cached outside of the label scope is looked up in unscopedMap.
+func diffPluginMetadata(
+	ctx context.Context,
+	newPluginMetadata []*PluginMetadata,
+	cachedMap, unscopedMap map[string]*PluginMetadata,
+	cmpOpts []cmp.Option,
+	force bool,
+) ([]Event, error) {
+	// Build maps for comparison
+	newMap := make(map[string]*PluginMetadata)
+	for _, metadata := range newPluginMetadata {
+		newMap[metadata.ID] = metadata
+	}
+
+	var conflicts []error
+	existingMap := make(map[string]*PluginMetadata, len(newMap))
+	for id, newMetadata := range newMap {
+		existing, ok := cachedMap[id]
+		if !ok {
+			if existing, ok = unscopedMap[id]; !ok {
+				continue
+			}
+		}
+		existingMap[id] = existing
+		owner, claimant := ownerOf(existing.Labels), ownerOf(newMetadata.Labels)
+		if !force && owner != "" && claimant != "" && !strings.EqualFold(owner, claimant) {
+			conflicts = append(conflicts, &OwnershipConflictError{
+				ResourceType: ResourceTypePluginMetadata,
+				ID:           id,
+				Owner:        owner,
+				Claimant:     claimant,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
+	}
+
+	var events []Event
+
+	// Find CREATE and UPDATE events
+	for id, newMetadata := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if cachedMetadata, exists := existingMap[id]; exists {
+			// Check if update is needed
+			if !arePluginMetadataEqual(cachedMetadata, newMetadata, cmpOpts...) {
+				events = append(events, Event{
+					Type:         EventTypeUpdate,
+					ResourceType: ResourceTypePluginMetadata,
+					ResourceID:   id,
+					ResourceName: id, // PluginMetadata uses the plugin name as ID
+					OldValue:     cachedMetadata,
+					NewValue:     newMetadata,
+				})
+			}
+		} else {
+			// Create new plugin metadata
+			events = append(events, Event{
+				Type:         EventTypeCreate,
+				ResourceType: ResourceTypePluginMetadata,
+				ResourceID:   id,
+				ResourceName: id,
+				NewValue:     newMetadata,
+			})
+		}
+	}
+
+	// Find DELETE events
+	for id, cachedMetadata := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, exists := newMap[id]; !exists {
+			events = append(events, Event{
+				Type:         EventTypeDelete,
+				ResourceType: ResourceTypePluginMetadata,
+				ResourceID:   id,
+				ResourceName: id,
+				OldValue:     cachedMetadata,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// diffProtos compares new protos with cached protos. Proto contents can be
+// large, so they are compared by digest, and unless keepContent is set the
+// old value of UPDATE events carries the digest in place of the content.
+func diffProtos(
+	ctx context.Context,
+	newProtos []*Proto,
+	cachedMap map[string]*Proto,
+	cmpOpts []cmp.Option,
+	keepContent bool,
+) ([]Event, error) {
+	// Build maps for comparison
+	newMap := make(map[string]*Proto)
+	for _, proto := range newProtos {
+		newMap[proto.ID] = proto
+	}
+
+	var events []Event
+
+	// Find CREATE and UPDATE events
+	for id, newProto := range newMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if cachedProto, exists := cachedMap[id]; exists {
+			// Check if update is needed
+			if !areProtosEqual(cachedProto, newProto, cmpOpts...) {
+				oldValue := cachedProto
+				if !keepContent {
+					oldValue = protoWithDigest(cachedProto)
+				}
+				events = append(events, Event{
+					Type:         EventTypeUpdate,
+					ResourceType: ResourceTypeProto,
+					ResourceID:   id,
+					ResourceName: newProto.Name,
+					OldValue:     oldValue,
+					NewValue:     newProto,
+				})
+			}
+		} else {
+			// Create new proto
+			events = append(events, Event{
+				Type:         EventTypeCreate,
+				ResourceType: ResourceTypeProto,
+				ResourceID:   id,
+				ResourceName: newProto.Name,
+				NewValue:     newProto,
+			})
+		}
+	}
+
+	// Find DELETE events
+	for id, cachedProto := range cachedMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, exists := newMap[id]; !exists {
+			events = append(events, Event{
+				Type:         EventTypeDelete,
+				ResourceType: ResourceTypeProto,
+				ResourceID:   id,
+				ResourceName: cachedProto.Name,
+				OldValue:     cachedProto,
+			})
+		}
+	}
+
+	return events, nil
+}
+
 // Comparison functions for different resource types
 
+// equalOpts treats nil and empty slices/maps as equal, since both serialize
+// to the same JSON and persistent caches cannot tell them apart. Fields left
+// at their zero value compare equal to the documented default, so objects
+// with server-populated defaults do not trigger updates forever. Numbers
+// held in interfaces compare by value whatever their type, since plugin
+// configs decoded from JSON hold float64s where the desired configs may hold
+// ints. Checking the path first spares a reflective call on every value.
+var equalOpts = []cmp.Option{
+	cmpopts.EquateEmpty(),
+	cmp.FilterPath(isInterface, cmp.FilterValues(bothNumbers, cmp.Comparer(numbersEqual))),
+	cmp.Transformer("routeDefaults", routeWithDefaults),
+	cmp.Transformer("serviceDefaults", serviceWithDefaults),
+	cmp.Transformer("upstreamDefaults", upstreamWithDefaults),
+	cmp.Transformer("activeCheckDefaults", activeCheckWithDefaults),
+	cmp.Transformer("healthDefaults", healthWithDefaults),
+	cmp.Transformer("unhealthyDefaults", unhealthyWithDefaults),
+}
+
+// comparedTypes lists the struct types compared by the differ
+var comparedTypes = []any{Route{}, Service{}, Upstream{}, SSL{}, GlobalRule{}, Proto{}, PluginMetadata{}}
+
+// ignoreFieldsOptions translates dot separated field paths into cmp options
+// ignoring them on every compared type having that field. Paths matching no
+// type are rejected here, since cmpopts.IgnoreFields panics on them.
+func ignoreFieldsOptions(paths []string) ([]cmp.Option, error) {
+	var opts []cmp.Option
+	for _, path := range paths {
+		matched := false
+		for _, typ := range comparedTypes {
+			if !hasFieldPath(reflect.TypeOf(typ), path) {
+				continue
+			}
+			opts = append(opts, cmpopts.IgnoreFields(typ, path))
+			matched = true
+		}
+		if !matched {
+			return nil, fmt.Errorf("%w: invalid ignore field %q: no resource type has this field", ErrInvalidInput, path)
+		}
+	}
+	return opts, nil
+}
+
+// hasFieldPath reports whether the dot separated field path resolves on t
+func hasFieldPath(t reflect.Type, path string) bool {
+	for _, name := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		field, ok := t.FieldByName(name)
+		if !ok || !field.IsExported() {
+			return false
+		}
+		t = field.Type
+	}
+	return true
+}
+
+// numberValue returns the value of a number of any numeric type
+func numberValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// isInterface reports whether the compared values are held in interfaces
+func isInterface(p cmp.Path) bool {
+	return p.Last().Type().Kind() == reflect.Interface
+}
+
+// bothNumbers reports whether x and y are both numbers
+func bothNumbers(x, y any) bool {
+	_, okX := numberValue(x)
+	_, okY := numberValue(y)
+	return okX && okY
+}
+
+// numbersEqual compares two numbers by value
+func numbersEqual(x, y any) bool {
+	vx, _ := numberValue(x)
+	vy, _ := numberValue(y)
+	return vx == vy
+}
+
+// routeWithDefaults returns a copy of the route with defaults applied
+func routeWithDefaults(r *Route) *Route {
+	if r == nil || r.Status != nil {
+		return r
+	}
+	c := *r
+	status := RouteStatusEnabled
+	c.Status = &status
+	return &c
+}
+
+// serviceWithDefaults returns a copy of the service with defaults applied
+func serviceWithDefaults(s *Service) *Service {
+	if s == nil || (s.EnableWebsocket != nil && (s.UpstreamID == nil || s.Upstream == nil)) {
+		return s
+	}
+	c := *s
+	if c.EnableWebsocket == nil {
+		enableWebsocket := false
+		c.EnableWebsocket = &enableWebsocket
+	}
+	// Services referencing an upstream compare by the reference, an
+	// embedded copy is redundant
+	if c.UpstreamID != nil {
+		c.Upstream = nil
+	}
+	return &c
+}
+
+// upstreamWithDefaults returns a copy of the upstream with defaults applied
+func upstreamWithDefaults(u *Upstream) *Upstream {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	if c.Type == "" {
+		c.Type = SelectionTypeRoundRobin
+	}
+	if c.HashOn == "" {
+		c.HashOn = UpstreamHashOnVars
+	}
+	if c.Scheme == "" {
+		c.Scheme = UpstreamSchemeHTTP
+	}
+	if c.PassHost == "" {
+		c.PassHost = UpstreamPassHostPass
+	}
+	c.Key = u.GetKey()
+	return &c
+}
+
+// activeCheckWithDefaults returns a copy of the active check with defaults applied
+func activeCheckWithDefaults(a *ActiveCheck) *ActiveCheck {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	if c.Type == "" {
+		c.Type = ActiveCheckTypeHTTP
+	}
+	c.Timeout = a.GetTimeout()
+	c.HTTPPath = a.GetHTTPPath()
+	if c.Type == ActiveCheckTypeHTTPS {
+		verify := a.GetHTTPSVerifyCertificate()
+		c.HTTPSVerifyCertificate = &verify
+	} else {
+		// Non https probes ignore the certificate settings
+		c.HTTPSVerifyCertificate = nil
+		c.HTTPSSni = nil
+	}
+	return &c
+}
+
+// healthWithDefaults returns a copy of the healthy check with defaults applied
+func healthWithDefaults(h *Health) *Health {
+	if h == nil {
+		return nil
+	}
+	c := *h
+	c.Interval = h.GetInterval()
+	c.HTTPStatuses = h.GetHTTPStatuses()
+	c.Successes = h.GetSuccesses()
+	return &c
+}
+
+// unhealthyWithDefaults returns a copy of the unhealthy check with defaults applied
+func unhealthyWithDefaults(u *Unhealthy) *Unhealthy {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	c.HTTPFailures = u.GetHTTPFailures()
+	c.TCPFailures = u.GetTCPFailures()
+	return &c
+}
+
 // areRoutesEqual compares two routes for equality using go-cmp
-func areRoutesEqual(a, b *Route) bool {
-	return cmp.Equal(a, b)
+func areRoutesEqual(a, b *Route, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
 }
 
 // areServicesEqual compares two services for equality using go-cmp
-func areServicesEqual(a, b *Service) bool {
-	return cmp.Equal(a, b)
+func areServicesEqual(a, b *Service, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
 }
 
 // areUpstreamsEqual compares two upstreams for equality using go-cmp
-func areUpstreamsEqual(a, b *Upstream) bool {
-	return cmp.Equal(a, b)
+func areUpstreamsEqual(a, b *Upstream, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
 }
 
 // areSSLsEqual compares two SSLs for equality using go-cmp
-func areSSLsEqual(a, b *SSL) bool {
-	return cmp.Equal(a, b)
+func areSSLsEqual(a, b *SSL, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
 }
 
 // areGlobalRulesEqual compares two global rules for equality using go-cmp
-func areGlobalRulesEqual(a, b *GlobalRule) bool {
-	return cmp.Equal(a, b)
+func areGlobalRulesEqual(a, b *GlobalRule, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
+}
+
+// areProtosEqual compares two protos for equality using go-cmp, comparing
+// contents by digest
+func areProtosEqual(a, b *Proto, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Transformer("protoDigest", protoWithDigest), cmp.Options(opts))
+}
+
+// arePluginMetadataEqual compares two plugin metadata for equality using go-cmp
+func arePluginMetadataEqual(a, b *PluginMetadata, opts ...cmp.Option) bool {
+	return cmp.Equal(a, b, cmp.Options(equalOpts), cmp.Options(opts))
+}
+
+// protoWithDigest returns a copy of the proto with its content replaced by
+// the content digest
+func protoWithDigest(p *Proto) *Proto {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Content = p.ContentDigest()
+	return &c
 }
 
 // sortEvents sorts events by execution order
 // Order:
-// 1. DELETE events (reverse dependency order: Route -> Service -> Upstream -> SSL -> GlobalRule)
-// 2. UPDATE events (same as DELETE order: Route -> Service -> Upstream -> SSL -> GlobalRule)
-// 3. CREATE events (forward dependency order: GlobalRule -> SSL -> Upstream -> Service -> Route)
+// 1. DELETE events (reverse dependency order: Route -> Service -> Upstream -> SSL -> GlobalRule ->
+// PluginMetadata -> Proto)
+// 2. UPDATE events (same as DELETE order)
+// 3. CREATE events (forward dependency order: Proto -> PluginMetadata -> GlobalRule -> SSL -> Upstream ->
+// Service -> Route)
+// Protos come first since the grpc-transcode plugin of routes, services and
+// global rules references them, then plugin metadata, so that plugins find
+// their metadata when enabled.
+// Events of the same type and resource type are ordered by resource ID.
 func sortEvents(events []Event) {
 	// Define order priority for each resource type
 	// DELETE and UPDATE use the same order (reverse dependency order)
@@ -504,14 +1999,19 @@ func sortEvents(events []Event) {
 		ResourceTypeUpstream:   2,
 		ResourceTypeSSL:        3,
 		ResourceTypeGlobalRule: 4,
+
+		ResourceTypePluginMetadata: 5,
+		ResourceTypeProto:          6,
 	}
 
 	createOrder := map[ResourceType]int{
-		ResourceTypeGlobalRule: 0,
-		ResourceTypeSSL:        1,
-		ResourceTypeUpstream:   2,
-		ResourceTypeService:    3,
-		ResourceTypeRoute:      4,
+		ResourceTypeProto:          0,
+		ResourceTypePluginMetadata: 1,
+		ResourceTypeGlobalRule:     2,
+		ResourceTypeSSL:            3,
+		ResourceTypeUpstream:       4,
+		ResourceTypeService:        5,
+		ResourceTypeRoute:          6,
 	}
 
 	sort.Slice(events, func(i, j int) bool {
@@ -523,16 +2023,85 @@ func sortEvents(events []Event) {
 		}
 
 		// Within same event type, sort by resource type
-		if ei.Type == EventTypeDelete || ei.Type == EventTypeUpdate {
+		if ei.ResourceType != ej.ResourceType {
+			if ei.Type == EventTypeCreate {
+				return createOrder[ei.ResourceType] < createOrder[ej.ResourceType]
+			}
 			return deleteUpdateOrder[ei.ResourceType] < deleteUpdateOrder[ej.ResourceType]
 		}
-		if ei.Type == EventTypeCreate {
-			return createOrder[ei.ResourceType] < createOrder[ej.ResourceType]
-		}
 
-		// Default: maintain original order (stable sort)
-		return false
+		// Break ties by ID so the order does not depend on map iteration
+		return ei.ResourceID < ej.ResourceID
+	})
+}
+
+// CompactEvents merges the events of a batch touching the same resource
+// into the one taking it from its state before the batch to its final
+// state: a delete then create becomes an update to the final value, a
+// create then delete disappears, and consecutive updates keep the final
+// value. Batches with several events per resource come from coalesced or
+// merged syncs. The compacted events are sorted in execution order; events
+// are returned as is when no resource has several.
+func CompactEvents(events []Event) ([]Event, error) {
+	type eventKey struct {
+		resourceType ResourceType
+		id           string
+	}
+	first := make(map[eventKey]int, len(events))
+	compacted := make([]Event, 0, len(events))
+	merged := false
+	for _, event := range events {
+		key := eventKey{event.ResourceType, event.ResourceID}
+		i, ok := first[key]
+		if !ok {
+			first[key] = len(compacted)
+			compacted = append(compacted, event)
+			continue
+		}
+		merged = true
+		before := compacted[i]
+		// Resources created then deleted leave an event without a type
+		existed := before.Type != EventTypeCreate && before.Type != ""
+		next := event
+		switch {
+		case !existed && event.Type == EventTypeDelete:
+			// Keep the place of the resource, a later update of it must
+			// still become a create
+			next = Event{ResourceType: event.ResourceType, ResourceID: event.ResourceID}
+		case !existed:
+			next.Type = EventTypeCreate
+			next.OldValue = nil
+			next.ModRevision = 0
+		case event.Type == EventTypeDelete:
+			next.OldValue = before.OldValue
+			next.ModRevision = before.ModRevision
+		default:
+			next.Type = EventTypeUpdate
+			next.OldValue = before.OldValue
+			next.ModRevision = before.ModRevision
+			next.Forced = before.Forced && event.Forced
+		}
+		if next.Changes != nil || before.Changes != nil {
+			next.Changes = nil
+			if next.Type == EventTypeUpdate {
+				changes, err := ComputeChanges(next.OldValue, next.NewValue)
+				if err != nil {
+					return nil, fmt.Errorf("failed to compute changes of %s %s: %w",
+						next.ResourceType, next.ResourceID, err)
+				}
+				next.Changes = changes
+			}
+		}
+		compacted[i] = next
+	}
+	if !merged {
+		return events, nil
+	}
+	compacted = slices.DeleteFunc(compacted, func(event Event) bool {
+		return event.Type == ""
 	})
+	sortEvents(compacted)
+	return compacted, nil
 }
 
 // eventTypePriority returns the priority of an event type
@@ -549,38 +2118,292 @@ func eventTypePriority(et EventType) int {
 	}
 }
 
-// TransferResources converts ADC resources to Kine resources
-func TransferResources(resources *adc.Resources) (*TransferredResources, error) {
-	result := &TransferredResources{}
+// TransferResources converts ADC resources to Kine resources.
+// By default the first invalid resource aborts the transfer; with the
+// BestEffort option it is skipped and recorded in the result's Warnings.
+// Errors wrap ErrTransferFailed, and ErrInvalidInput or ErrConflict for
+// colliding IDs.
+func TransferResources(resources *adc.Resources, opts ...TransferOption) (*TransferredResources, error) {
+	return TransferResourcesWithOptions(resources, (&TransferOptions{}).ApplyOptions(opts))
+}
 
-	// Transfer services (which includes routes and upstream)
+// TransferResourcesWithOptions is TransferResources configured by an options
+// struct, as built once by callers holding their own configuration. A nil
+// opts transfers with the defaults. opts is not modified.
+func TransferResourcesWithOptions(resources *adc.Resources, opts *TransferOptions) (*TransferredResources, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	t := NewTransferrer(opts)
+	// The counts are known up front, spare the result slices regrowing
+	routes := 0
 	for _, adcService := range resources.Services {
-		kineService, kineRoutes, kineUpstreams, err := TransferService(adcService)
-		if err != nil {
-			return nil, fmt.Errorf("failed to transfer service %s: %w", adcService.Name, err)
+		if adcService != nil {
+			routes += len(adcService.Routes)
+		}
+	}
+	t.result.Services = make([]*Service, 0, len(resources.Services))
+	t.result.Routes = make([]*Route, 0, routes)
+	for _, adcService := range resources.Services {
+		if err := t.AddService(adcService); err != nil {
+			return nil, err
+		}
+	}
+	for _, adcSSL := range resources.SSLs {
+		if err := t.AddSSL(adcSSL); err != nil {
+			return nil, err
 		}
-		if kineService != nil {
-			result.Services = append(result.Services, kineService)
+	}
+	if err := t.AddGlobalRules(resources.GlobalRules); err != nil {
+		return nil, err
+	}
+	for _, adcProto := range resources.Protos {
+		if err := t.AddProto(adcProto); err != nil {
+			return nil, err
 		}
-		result.Routes = append(result.Routes, kineRoutes...)
+	}
+	if err := t.AddPluginMetadata(resources.PluginMetadata); err != nil {
+		return nil, err
+	}
+	for _, adcConsumer := range resources.Consumers {
+		t.AddConsumer(adcConsumer)
+	}
+	return t.Result(), nil
+}
+
+// Transferrer converts ADC resources to Kine resources one at a time, so
+// that callers decoding large inputs need not hold every ADC resource.
+// Adding the resources of an adc.Resources in order gives the same result
+// as TransferResources.
+type Transferrer struct {
+	opts            *TransferOptions
+	result          *TransferredResources
+	sharedUpstreams map[string]bool
+}
 
-		result.Upstreams = append(result.Upstreams, kineUpstreams...)
+// NewTransferrer creates an empty Transferrer. Generated IDs are checked
+// for collisions across all the resources it transfers.
+func NewTransferrer(opts ...TransferOption) *Transferrer {
+	transferOpts := (&TransferOptions{}).ApplyOptions(opts)
+	transferOpts.ids = newIDRegistry()
+	return &Transferrer{
+		opts:            transferOpts,
+		result:          &TransferredResources{},
+		sharedUpstreams: make(map[string]bool),
 	}
+}
 
-	// Transfer SSLs
-	for _, adcSSL := range resources.SSLs {
-		kineSSLs, err := TransferSSL(adcSSL)
+// nameOf returns the name of an ADC resource for messages, which may be
+// about a nil one
+func nameOf(resource any) string {
+	switch resource := resource.(type) {
+	case *adc.Service:
+		if resource != nil {
+			return resource.Name
+		}
+	case *adc.SSL:
+		if resource != nil {
+			return resource.Name
+		}
+	}
+	return "<nil>"
+}
+
+// skip records a resource skipped by a best-effort transfer, keeping the
+// cached object of the given type and ID and those of its owner
+func (t *Transferrer) skip(warning TransferWarning, resourceType ResourceType, ids ...string) {
+	t.result.Warnings = append(t.result.Warnings, warning)
+	if t.result.Skipped == nil {
+		t.result.Skipped = &KeepSet{}
+	}
+	t.result.Skipped.add(resourceType, "", warning.Labels)
+	for _, id := range ids {
+		t.result.Skipped.add(resourceType, id, nil)
+	}
+}
+
+// AddService transfers a service with its routes and upstreams
+func (t *Transferrer) AddService(adcService *adc.Service) error {
+	transferOpts, result := t.opts, t.result
+	transferOpts.warn = func(cause error) {
+		result.Warnings = append(result.Warnings, TransferWarning{
+			Kind:   adc.TypeService,
+			Name:   adcService.Name,
+			Labels: copyLabels(adcService.Labels),
+			Cause:  cause,
+		})
+	}
+	kineService, kineRoutes, kineUpstreams, err := transferService(adcService, transferOpts)
+	if err == nil && transferOpts.SharedUpstreams && kineService != nil && kineService.Upstream != nil {
+		var shared *Upstream
+		if shared, err = shareUpstream(kineService.Upstream, transferOpts); err == nil {
+			kineService.Upstream = nil
+			kineService.UpstreamID = &shared.ID
+			kineUpstreams = append(kineUpstreams, shared)
+		} else {
+			err = fmt.Errorf("failed to share upstream: %w", err)
+		}
+	}
+	if err == nil {
+		err = transferOpts.ids.takeCollision()
+	}
+	if err != nil {
+		if transferOpts.BestEffort && adcService != nil {
+			var serviceID string
+			if adcService.ID != "" || adcService.Name != "" {
+				serviceID = generateServiceID(adcService, transferOpts.untracked())
+			}
+			t.skip(TransferWarning{
+				Kind:   adc.TypeService,
+				Name:   adcService.Name,
+				Labels: copyLabels(adcService.Labels),
+				Cause:  err,
+			}, ResourceTypeService, serviceID)
+			return nil
+		}
+		return fmt.Errorf("%w service %s: %w", ErrTransferFailed, nameOf(adcService), invalidInput(err))
+	}
+	if kineService != nil {
+		result.Services = append(result.Services, kineService)
+	}
+	result.Routes = append(result.Routes, kineRoutes...)
+
+	for _, kineUpstream := range kineUpstreams {
+		// Shared upstreams are added once, whichever services share them
+		if kineUpstream != nil && isSharedUpstream(kineUpstream) {
+			if t.sharedUpstreams[kineUpstream.ID] {
+				continue
+			}
+			t.sharedUpstreams[kineUpstream.ID] = true
+		}
+		result.Upstreams = append(result.Upstreams, kineUpstream)
+	}
+	return nil
+}
+
+// AddSSL transfers an SSL
+func (t *Transferrer) AddSSL(adcSSL *adc.SSL) error {
+	transferOpts, result := t.opts, t.result
+	transferOpts.warn = func(cause error) {
+		result.Warnings = append(result.Warnings, TransferWarning{
+			Kind:   adc.TypeSSL,
+			Name:   adcSSL.Name,
+			Labels: copyLabels(adcSSL.Labels),
+			Cause:  cause,
+		})
+	}
+	kineSSLs, err := transferSSL(adcSSL, transferOpts)
+	if err == nil {
+		err = transferOpts.ids.takeCollision()
+	}
+	if err != nil {
+		if transferOpts.BestEffort && adcSSL != nil {
+			var sslIDs []string
+			if adcSSL.ID != "" || adcSSL.Name != "" {
+				for i := range adcSSL.Certificates {
+					sslIDs = append(sslIDs, generateSSLID(adcSSL, i, transferOpts.untracked()))
+				}
+			}
+			t.skip(TransferWarning{
+				Kind:   adc.TypeSSL,
+				Name:   adcSSL.Name,
+				Labels: copyLabels(adcSSL.Labels),
+				Cause:  err,
+			}, ResourceTypeSSL, sslIDs...)
+			return nil
+		}
+		return fmt.Errorf("%w ssl %s: %w", ErrTransferFailed, nameOf(adcSSL), invalidInput(err))
+	}
+	result.SSLs = append(result.SSLs, kineSSLs...)
+	return nil
+}
+
+// AddGlobalRules transfers the global rules
+func (t *Transferrer) AddGlobalRules(adcGlobalRule adc.GlobalRule) error {
+	for _, kineGlobalRule := range transferGlobalRule(adcGlobalRule, t.opts) {
+		err := t.opts.validatePlugins(ResourceTypeGlobalRule, kineGlobalRule.ID, kineGlobalRule.Plugins)
+		if err != nil {
+			if t.opts.BestEffort {
+				t.skip(TransferWarning{
+					Kind:   adc.TypeGlobalRule,
+					Name:   kineGlobalRule.ID,
+					Labels: copyLabels(t.opts.OwnerLabels),
+					Cause:  err,
+				}, ResourceTypeGlobalRule, kineGlobalRule.ID)
+				continue
+			}
+			return fmt.Errorf("%w global rule %s: %w", ErrTransferFailed, kineGlobalRule.ID, invalidInput(err))
+		}
+		t.result.GlobalRules = append(t.result.GlobalRules, kineGlobalRule)
+	}
+	return nil
+}
+
+// AddProto transfers a proto
+func (t *Transferrer) AddProto(adcProto *adc.Proto) error {
+	if adcProto == nil {
+		return fmt.Errorf("%w proto: %w", ErrTransferFailed, invalidInput(errors.New("adc proto is nil")))
+	}
+	transferOpts, result := t.opts, t.result
+	transferOpts.warn = func(cause error) {
+		result.Warnings = append(result.Warnings, TransferWarning{
+			Kind:   adc.TypeProto,
+			Name:   adcProto.Name,
+			Labels: copyLabels(adcProto.Labels),
+			Cause:  cause,
+		})
+	}
+	kineProto, err := transferProto(adcProto, transferOpts)
+	if err == nil {
+		err = transferOpts.ids.takeCollision()
+	}
+	if err != nil {
+		if t.opts.BestEffort {
+			t.skip(TransferWarning{
+				Kind:   adc.TypeProto,
+				Name:   adcProto.Name,
+				Labels: copyLabels(adcProto.Labels),
+				Cause:  err,
+			}, ResourceTypeProto, adcProto.ID)
+			return nil
+		}
+		return fmt.Errorf("%w proto %s: %w", ErrTransferFailed, adcProto.ID, invalidInput(err))
+	}
+	t.result.Protos = append(t.result.Protos, kineProto)
+	return nil
+}
+
+// AddPluginMetadata transfers the plugin metadata
+func (t *Transferrer) AddPluginMetadata(adcPluginMetadata adc.PluginMetadata) error {
+	for _, name := range slices.Sorted(maps.Keys(adcPluginMetadata)) {
+		kineMetadata, err := transferPluginMetadata(name, adcPluginMetadata[name], t.opts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to transfer ssl %s: %w", adcSSL.Name, err)
+			if t.opts.BestEffort {
+				t.skip(TransferWarning{
+					Kind:   adc.TypePluginMetadata,
+					Name:   name,
+					Labels: copyLabels(t.opts.OwnerLabels),
+					Cause:  err,
+				}, ResourceTypePluginMetadata, name)
+				continue
+			}
+			return fmt.Errorf("%w plugin metadata %s: %w", ErrTransferFailed, name, invalidInput(err))
 		}
-		result.SSLs = append(result.SSLs, kineSSLs...)
+		t.result.PluginMetadata = append(t.result.PluginMetadata, kineMetadata)
 	}
+	return nil
+}
 
-	// Transfer global rules
-	if len(resources.GlobalRules) > 0 {
-		kineGlobalRules := TransferGlobalRule(resources.GlobalRules)
-		result.GlobalRules = append(result.GlobalRules, kineGlobalRules...)
+// AddConsumer records the username of an ADC consumer, see
+// TransferredResources.ConsumerNames
+func (t *Transferrer) AddConsumer(adcConsumer *adc.Consumer) {
+	if adcConsumer != nil && adcConsumer.Username != "" {
+		t.result.ConsumerNames = append(t.result.ConsumerNames, adcConsumer.Username)
 	}
+}
 
-	return result, nil
+// Result returns the resources transferred so far
+func (t *Transferrer) Result() *TransferredResources {
+	t.result.Hashes = hashResources(t.result)
+	return t.result
 }
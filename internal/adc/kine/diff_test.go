@@ -1,11 +1,21 @@
 package kine
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/adc/kine/testutil"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
 )
 
 const (
@@ -79,7 +89,7 @@ func TestDiffer_DiffRoutes(t *testing.T) {
 		},
 	}
 
-	events, err := differ.Diff(newResources, opts)
+	events, err := differ.Diff(context.Background(), newResources, opts)
 	if err != nil {
 		t.Fatalf("failed to diff: %v", err)
 	}
@@ -146,7 +156,7 @@ func TestDiffer_DiffServices(t *testing.T) {
 		},
 	}
 
-	events, err := differ.Diff(newResources, opts)
+	events, err := differ.Diff(context.Background(), newResources, opts)
 	if err != nil {
 		t.Fatalf("failed to diff: %v", err)
 	}
@@ -237,7 +247,7 @@ func TestDiffer_DiffUpstreams(t *testing.T) {
 		},
 	}
 
-	events, err := differ.Diff(newResources, opts)
+	events, err := differ.Diff(context.Background(), newResources, opts)
 	if err != nil {
 		t.Fatalf("failed to diff: %v", err)
 	}
@@ -306,7 +316,7 @@ func TestDiffer_DiffUpstreamsDelete(t *testing.T) {
 		},
 	}
 
-	events, err := differ.Diff(newResources, opts)
+	events, err := differ.Diff(context.Background(), newResources, opts)
 	if err != nil {
 		t.Fatalf("failed to diff: %v", err)
 	}
@@ -327,6 +337,31 @@ func TestDiffer_DiffUpstreamsDelete(t *testing.T) {
 	}
 }
 
+func TestDiffer_ConsistentSnapshot(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	stop := runTearingWriter(t, cache)
+	defer stop()
+
+	differ := NewDiffer(cache)
+	for i := 0; i < 500; i++ {
+		// Diffing nothing deletes whatever the snapshot holds
+		events, err := differ.Diff(context.Background(), &TransferredResources{}, &DiffOptions{})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		deleted := make(map[ResourceType]bool)
+		for _, event := range events {
+			deleted[event.ResourceType] = true
+		}
+		if deleted[ResourceTypeService] && !deleted[ResourceTypeRoute] {
+			t.Fatalf("torn view: service deleted without its route in %v", events)
+		}
+	}
+}
+
 func TestSortEvents(t *testing.T) {
 	events := []Event{
 		{Type: EventTypeCreate, ResourceType: ResourceTypeRoute},
@@ -729,3 +764,2061 @@ func TestCmpEqual(t *testing.T) {
 		t.Error("expected route1 and route3 to be different")
 	}
 }
+
+func TestDiffer_DoesNotMutateCache(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	labels := map[string]string{
+		"k8s/kind":      "ApisixRoute",
+		"k8s/namespace": "default",
+		"k8s/name":      "test",
+	}
+	for _, id := range []string{"route1", "route2"} {
+		route := &Route{
+			Metadata: adc.Metadata{ID: id, Name: id, Labels: labels},
+			URIs:     []string{"/" + id},
+			Plugins:  map[string]any{"cors": map[string]any{"allow_origins": "*"}},
+		}
+		if err := cache.InsertRoute(route); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+
+	before, err := cache.ListRoutes()
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+
+	// Update route1, delete route2
+	newResources := &TransferredResources{
+		Routes: []*Route{
+			{
+				Metadata: adc.Metadata{ID: "route1", Name: "route1", Labels: labels},
+				URIs:     []string{"/route1", "/extra"},
+			},
+		},
+	}
+	if _, err := NewDiffer(cache).Diff(context.Background(), newResources, &DiffOptions{Labels: labels}); err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+
+	after, err := cache.ListRoutes()
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	if diff := cmp.Diff(before, after); diff != "" {
+		t.Errorf("cached routes were mutated by Diff (-before +after):\n%s", diff)
+	}
+}
+
+func TestListWithoutCopy(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if err := cache.InsertRoute(&Route{Metadata: adc.Metadata{ID: "route1"}}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+
+	first, err := cache.ListRoutes(WithoutCopy())
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	second, err := cache.ListRoutes(WithoutCopy())
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	if first[0] != second[0] {
+		t.Error("expected WithoutCopy to return the stored object")
+	}
+
+	copied, err := cache.ListRoutes()
+	if err != nil {
+		t.Fatalf("failed to list routes: %v", err)
+	}
+	if copied[0] == first[0] {
+		t.Error("expected ListRoutes to return a copy by default")
+	}
+}
+
+func BenchmarkDiffRoutes(b *testing.B) {
+	const n = 20000
+	cache, err := NewMemDBCache()
+	if err != nil {
+		b.Fatalf("failed to create cache: %v", err)
+	}
+	labels := map[string]string{
+		"k8s/kind":      "ApisixRoute",
+		"k8s/namespace": "default",
+		"k8s/name":      "bench",
+	}
+	newResources := &TransferredResources{Routes: make([]*Route, 0, n)}
+	for i := 0; i < n; i++ {
+		route := &Route{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("route-%d", i), Name: fmt.Sprintf("route-%d", i), Labels: labels},
+			URIs:     []string{fmt.Sprintf("/api/%d", i)},
+			Methods:  []Method{MethodGET},
+		}
+		if err := cache.InsertRoute(route); err != nil {
+			b.Fatalf("failed to insert route: %v", err)
+		}
+		newResources.Routes = append(newResources.Routes, route.DeepCopy())
+	}
+	differ := NewDiffer(cache)
+	opts := &DiffOptions{Labels: labels}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := differ.Diff(context.Background(), newResources, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkRouteCounts are the route counts of the scale benchmarks
+var benchmarkRouteCounts = []int{1000, 10000, 50000}
+
+// benchmarkResources generates resources with the given number of routes,
+// ten per service
+func benchmarkResources(routes int) *adc.Resources {
+	return testutil.GenerateResources(testutil.ResourceSpec{Services: routes / 10, RoutesPerService: 10})
+}
+
+func BenchmarkTransferResources(b *testing.B) {
+	for _, n := range benchmarkRouteCounts {
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			resources := benchmarkResources(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := TransferResources(resources); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	for _, n := range benchmarkRouteCounts {
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			transferred, err := TransferResources(benchmarkResources(n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			cache, err := NewMemDBCache()
+			if err != nil {
+				b.Fatalf("failed to create cache: %v", err)
+			}
+			events, err := NewDiffer(cache).Diff(context.Background(), transferred, &DiffOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, event := range events {
+				if err := cache.Insert(event.NewValue); err != nil {
+					b.Fatal(err)
+				}
+			}
+			differ := NewDiffer(cache)
+			opts := &DiffOptions{Labels: testutil.DefaultLabels}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := differ.Diff(context.Background(), transferred, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDiffUnchanged diffs routes identical to the cached ones, with
+// and without the content hashes letting the differ skip comparing them
+func BenchmarkDiffUnchanged(b *testing.B) {
+	transferred, err := TransferResources(benchmarkResources(20000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	cache, err := NewMemDBCache()
+	if err != nil {
+		b.Fatalf("failed to create cache: %v", err)
+	}
+	events, err := NewDiffer(cache).Diff(context.Background(), transferred, &DiffOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, event := range events {
+		if err := cache.Insert(event.NewValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+	compared := *transferred
+	compared.Hashes = nil
+	for _, bench := range []struct {
+		name      string
+		resources *TransferredResources
+	}{
+		{"hashed", transferred},
+		{"compared", &compared},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			differ := NewDiffer(cache)
+			opts := &DiffOptions{Labels: testutil.DefaultLabels}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				events, err := differ.Diff(context.Background(), bench.resources, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(events) != 0 {
+					b.Fatalf("expected no events, got %d", len(events))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSortEvents(b *testing.B) {
+	for _, n := range benchmarkRouteCounts {
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			transferred, err := TransferResources(benchmarkResources(n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			cache, err := NewMemDBCache()
+			if err != nil {
+				b.Fatalf("failed to create cache: %v", err)
+			}
+			events, err := NewDiffer(cache).Diff(context.Background(), transferred, &DiffOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			// Reverse the sorted events, the worst case of an unsorted input
+			slices.Reverse(events)
+			unsorted := make([]Event, len(events))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				copy(unsorted, events)
+				sortEvents(unsorted)
+			}
+		})
+	}
+}
+
+func TestTransferResourcesBestEffort(t *testing.T) {
+	newService := func(name string, withUpstream bool) *adc.Service {
+		svc := &adc.Service{
+			Metadata: adc.Metadata{
+				Name: name,
+				Labels: map[string]string{
+					"k8s/kind":      "ApisixRoute",
+					"k8s/namespace": "default",
+					"k8s/name":      name,
+				},
+			},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{Name: "route"}, Uris: []string{"/" + name}},
+			},
+		}
+		if withUpstream {
+			svc.Upstream = &adc.Upstream{
+				Nodes: []adc.UpstreamNode{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+			}
+		}
+		return svc
+	}
+	resources := &adc.Resources{
+		Services: []*adc.Service{
+			newService("svc-a", true),
+			newService("svc-bad", false),
+			newService("svc-c", true),
+		},
+	}
+
+	// Strict mode is the default and fails on the bad service
+	if _, err := TransferResources(resources); err == nil {
+		t.Fatal("expected strict transfer to fail")
+	}
+
+	transferred, err := TransferResources(resources, BestEffort())
+	if err != nil {
+		t.Fatalf("expected best-effort transfer to succeed: %v", err)
+	}
+	if len(transferred.Services) != 2 {
+		t.Errorf("expected 2 services, got %d", len(transferred.Services))
+	}
+	if len(transferred.Routes) != 2 {
+		t.Errorf("expected 2 routes, got %d", len(transferred.Routes))
+	}
+	if len(transferred.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d", len(transferred.Warnings))
+	}
+	warning := transferred.Warnings[0]
+	if warning.Kind != adc.TypeService || warning.Name != "svc-bad" {
+		t.Errorf("unexpected warning: %v", warning)
+	}
+	if warning.Labels["k8s/name"] != "svc-bad" {
+		t.Errorf("expected warning to carry labels, got %v", warning.Labels)
+	}
+	if warning.Cause == nil {
+		t.Error("expected warning to carry the cause")
+	}
+}
+
+func TestTransferResourcesNil(t *testing.T) {
+	for _, resources := range []*adc.Resources{
+		{Services: []*adc.Service{nil}},
+		{SSLs: []*adc.SSL{nil}},
+		{Protos: []*adc.Proto{nil}},
+	} {
+		for _, opts := range [][]TransferOption{nil, {BestEffort()}} {
+			if _, err := TransferResources(resources, opts...); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("expected nil resources to be rejected as invalid input, got %v", err)
+			}
+		}
+	}
+}
+
+func TestTransferResourcesWithOptions(t *testing.T) {
+	labels := map[string]string{"k8s/kind": "ApisixRoute", "k8s/namespace": "default", "k8s/name": "svc"}
+	resources := &adc.Resources{
+		Services: []*adc.Service{
+			{
+				Metadata: adc.Metadata{Name: "svc", Labels: labels},
+				Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}}},
+				Routes:   []*adc.Route{{Metadata: adc.Metadata{Name: "route"}, Uris: []string{"/"}}},
+			},
+			{Metadata: adc.Metadata{Name: "svc-bad", Labels: labels}, Routes: []*adc.Route{{Uris: []string{"/"}}}},
+		},
+		GlobalRules: adc.GlobalRule{"prometheus": map[string]any{}},
+	}
+
+	// nil options are the defaults, failing on the bad service
+	if _, err := TransferResourcesWithOptions(resources, nil); err == nil {
+		t.Fatal("expected the default transfer to fail")
+	}
+
+	opts := &TransferOptions{BestEffort: true, NamespacedIDs: true, OwnerLabels: labels}
+	got, err := TransferResourcesWithOptions(resources, opts)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	want, err := TransferResources(resources, BestEffort(), NamespacedIDs(), OwnerLabels(labels))
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b error) bool { return a.Error() == b.Error() })); diff != "" {
+		t.Errorf("options struct and functional options differ (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&TransferOptions{BestEffort: true, NamespacedIDs: true, OwnerLabels: labels}, opts,
+		cmp.AllowUnexported(TransferOptions{})); diff != "" {
+		t.Errorf("expected the options to be left untouched (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffer_CanceledContext(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	newResources := &TransferredResources{
+		Routes: []*Route{{Metadata: adc.Metadata{ID: "route1"}, URIs: []string{"/test"}}},
+	}
+	events, err := NewDiffer(cache).Diff(ctx, newResources, &DiffOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if events != nil {
+		t.Errorf("expected no events, got %d", len(events))
+	}
+}
+
+func TestDiffer_DeterministicOrder(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	newResources := &TransferredResources{}
+	for i := 0; i < 50; i++ {
+		newResources.Routes = append(newResources.Routes, &Route{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("route-%02d", i)},
+			URIs:     []string{"/test"},
+		})
+		newResources.Services = append(newResources.Services, &Service{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("service-%02d", i)},
+		})
+		newResources.SSLs = append(newResources.SSLs, &SSL{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("ssl-%02d", i)},
+		})
+	}
+
+	differ := NewDiffer(cache)
+	first, err := differ.Diff(context.Background(), newResources, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(first) != 150 {
+		t.Fatalf("expected 150 events, got %d", len(first))
+	}
+	for i := 0; i < 5; i++ {
+		events, err := differ.Diff(context.Background(), newResources, &DiffOptions{})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		for j := range events {
+			if events[j].ResourceType != first[j].ResourceType || events[j].ResourceID != first[j].ResourceID {
+				t.Fatalf("event order differs at %d: %s/%s vs %s/%s", j,
+					events[j].ResourceType, events[j].ResourceID, first[j].ResourceType, first[j].ResourceID)
+			}
+		}
+	}
+	// Creates follow dependency order: SSL -> Service -> Route
+	if first[0].ResourceType != ResourceTypeSSL || first[0].ResourceID != "ssl-00" {
+		t.Errorf("unexpected first event: %s/%s", first[0].ResourceType, first[0].ResourceID)
+	}
+	if first[149].ResourceType != ResourceTypeRoute || first[149].ResourceID != "route-49" {
+		t.Errorf("unexpected last event: %s/%s", first[149].ResourceType, first[149].ResourceID)
+	}
+}
+
+func BenchmarkDiffMixed(b *testing.B) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		b.Fatalf("failed to create cache: %v", err)
+	}
+	newResources := &TransferredResources{}
+	for i := 0; i < 30000; i++ {
+		route := &Route{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("route-%d", i)},
+			URIs:     []string{fmt.Sprintf("/api/%d", i)},
+		}
+		if err := cache.InsertRoute(route); err != nil {
+			b.Fatal(err)
+		}
+		newResources.Routes = append(newResources.Routes, route.DeepCopy())
+	}
+	for i := 0; i < 10000; i++ {
+		service := &Service{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("service-%d", i)},
+			Hosts:    []string{fmt.Sprintf("svc-%d.example.com", i)},
+		}
+		if err := cache.InsertService(service); err != nil {
+			b.Fatal(err)
+		}
+		newResources.Services = append(newResources.Services, service.DeepCopy())
+	}
+	differ := NewDiffer(cache)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := differ.Diff(context.Background(), newResources, &DiffOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDiffer_DuplicateIDs(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	differ := NewDiffer(cache)
+
+	newResources := &TransferredResources{
+		Routes: []*Route{
+			{
+				Metadata: adc.Metadata{ID: "route1", Name: "payments", Labels: map[string]string{"k8s/namespace": "default"}},
+				URIs:     []string{"/pay"},
+			},
+			{
+				Metadata: adc.Metadata{ID: "route1", Name: "payments", Labels: map[string]string{"k8s/namespace": "staging"}},
+				URIs:     []string{"/pay"},
+			},
+		},
+		SSLs: []*SSL{
+			{Metadata: adc.Metadata{ID: "ssl1", Name: "tls-a"}},
+			{Metadata: adc.Metadata{ID: "ssl1", Name: "tls-b"}},
+		},
+	}
+
+	_, err = differ.Diff(context.Background(), newResources, &DiffOptions{})
+	if err == nil {
+		t.Fatal("expected duplicate id error")
+	}
+	var dup *DuplicateIDError
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected DuplicateIDError, got %v", err)
+	}
+	if !errors.Is(err, ErrDiffFailed) || !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a diff error of conflict, got %v", err)
+	}
+	for _, want := range []string{"route1", "default", "staging", "ssl1", "tls-a", "tls-b"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+
+	// Last writer wins when explicitly allowed
+	events, err := differ.Diff(context.Background(), newResources, &DiffOptions{AllowDuplicateIDs: true})
+	if err != nil {
+		t.Fatalf("expected diff to succeed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(events))
+	}
+}
+
+func TestDiffer_IncludeChanges(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if err := cache.InsertRoute(&Route{
+		Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+		URIs:     []string{"/"},
+		Plugins:  adc.Plugins{"limit-count": map[string]any{"count": 10}},
+	}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	if err := cache.InsertUpstream(&Upstream{
+		Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"},
+		Nodes:    map[string]uint32{"127.0.0.1:8080": 100},
+		Type:     SelectionTypeRoundRobin,
+	}); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+
+	newResources := &TransferredResources{
+		Routes: []*Route{{
+			Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+			URIs:     []string{"/"},
+			Plugins:  adc.Plugins{"limit-count": map[string]any{"count": 20}},
+		}},
+		Upstreams: []*Upstream{{
+			Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"},
+			Nodes:    map[string]uint32{"127.0.0.1:8080": 50},
+			Type:     SelectionTypeRoundRobin,
+		}},
+	}
+
+	differ := NewDiffer(cache)
+	events, err := differ.Diff(context.Background(), newResources, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	for _, event := range events {
+		if event.Changes != nil {
+			t.Errorf("expected no changes without IncludeChanges, got %v", event.Changes)
+		}
+	}
+
+	events, err = differ.Diff(context.Background(), newResources, &DiffOptions{IncludeChanges: true})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	changes := make(map[string]map[string]FieldChange)
+	for _, event := range events {
+		changes[event.ResourceID] = event.Changes
+	}
+
+	routeChanges := changes["route1"]
+	if len(routeChanges) != 1 {
+		t.Errorf("expected 1 route change, got %v", routeChanges)
+	}
+	if change, ok := routeChanges["/plugins/limit-count/count"]; !ok || change.Old != float64(10) || change.New != float64(20) {
+		t.Errorf("unexpected plugin change: %v", routeChanges)
+	}
+
+	upstreamChanges := changes["upstream1"]
+	if len(upstreamChanges) != 1 {
+		t.Errorf("expected 1 upstream change, got %v", upstreamChanges)
+	}
+	if change, ok := upstreamChanges["/nodes/127.0.0.1:8080"]; !ok || change.Old != float64(100) || change.New != float64(50) {
+		t.Errorf("unexpected node weight change: %v", upstreamChanges)
+	}
+}
+
+func TestDiffer_IgnoresDefaults(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	// The cached object carries the defaults explicitly
+	cached := &Upstream{
+		Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"},
+		Nodes:    map[string]uint32{"127.0.0.1:8080": 100},
+		Type:     SelectionTypeRoundRobin,
+		HashOn:   UpstreamHashOnVars,
+		Key:      "uri",
+		Scheme:   UpstreamSchemeHTTP,
+		PassHost: UpstreamPassHostPass,
+		Checks: &HealthCheck{
+			Active: &ActiveCheck{
+				Type:      ActiveCheckTypeHTTP,
+				Timeout:   1,
+				HTTPPath:  "/",
+				Healthy:   &Health{Interval: 1, HTTPStatuses: []uint32{200, 302}, Successes: 2},
+				Unhealthy: &Unhealthy{HTTPFailures: 5, TCPFailures: 2},
+			},
+		},
+	}
+	if err := cache.InsertUpstream(cached); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+	if err := cache.InsertRoute(&Route{
+		Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+		URIs:     []string{"/"},
+		Upstream: &Upstream{
+			Nodes:  map[string]uint32{"127.0.0.1:8080": 100},
+			Scheme: UpstreamSchemeHTTP,
+		},
+	}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+
+	// The desired objects leave the defaults as zero values
+	newUpstream := &Upstream{
+		Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"},
+		Nodes:    map[string]uint32{"127.0.0.1:8080": 100},
+		Checks: &HealthCheck{
+			Active: &ActiveCheck{
+				Healthy:   &Health{},
+				Unhealthy: &Unhealthy{},
+			},
+		},
+	}
+	newRoute := &Route{
+		Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+		URIs:     []string{"/"},
+		Upstream: &Upstream{Nodes: map[string]uint32{"127.0.0.1:8080": 100}},
+	}
+
+	differ := NewDiffer(cache)
+	events, err := differ.Diff(context.Background(), &TransferredResources{
+		Routes:    []*Route{newRoute},
+		Upstreams: []*Upstream{newUpstream},
+	}, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events for defaulted fields, got %+v", events)
+	}
+
+	// A change away from a default is still detected
+	newUpstream.Scheme = UpstreamSchemeHTTPS
+	newUpstream.Checks.Active.Healthy.Interval = 5
+	events, err = differ.Diff(context.Background(), &TransferredResources{
+		Routes:    []*Route{newRoute},
+		Upstreams: []*Upstream{newUpstream},
+	}, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate || events[0].ResourceID != "upstream1" {
+		t.Fatalf("expected an upstream update, got %+v", events)
+	}
+}
+
+func TestDiffer_HealthCheckHTTPSSettings(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	newUpstream := func(active *ActiveCheck) *Upstream {
+		return &Upstream{
+			Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"},
+			Nodes:    map[string]uint32{"127.0.0.1:8443": 100},
+			Checks:   &HealthCheck{Active: active},
+		}
+	}
+	verify := true
+	if err := cache.InsertUpstream(newUpstream(&ActiveCheck{
+		Type:                   ActiveCheckTypeHTTPS,
+		HTTPSVerifyCertificate: &verify,
+	})); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+
+	differ := NewDiffer(cache)
+	diff := func(upstream *Upstream) []Event {
+		events, err := differ.Diff(context.Background(), &TransferredResources{
+			Upstreams: []*Upstream{upstream},
+		}, &DiffOptions{})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		return events
+	}
+
+	// An unset verification flag means verify
+	if events := diff(newUpstream(&ActiveCheck{Type: ActiveCheckTypeHTTPS})); len(events) != 0 {
+		t.Errorf("expected no events for the defaulted verification flag, got %+v", events)
+	}
+	sni := "backend.example.com"
+	events := diff(newUpstream(&ActiveCheck{Type: ActiveCheckTypeHTTPS, HTTPSSni: &sni}))
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Errorf("expected an update for a new https_sni, got %+v", events)
+	}
+	disabled := false
+	events = diff(newUpstream(&ActiveCheck{Type: ActiveCheckTypeHTTPS, HTTPSVerifyCertificate: &disabled}))
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Errorf("expected an update when disabling verification, got %+v", events)
+	}
+}
+
+func TestDiffer_DiffOne(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	differ := NewDiffer(cache)
+
+	route := &Route{
+		Metadata: adc.Metadata{ID: "route1", Name: "route1"},
+		URIs:     []string{"/"},
+		Upstream: &Upstream{Nodes: map[string]uint32{"127.0.0.1:8080": 100}},
+	}
+	ssl := &SSL{
+		Metadata: adc.Metadata{ID: "ssl1", Name: "tls"},
+		Cert:     "cert",
+		Key:      "key",
+		SNIs:     []string{exampleHost},
+	}
+
+	// Create
+	event, err := differ.DiffOne(ResourceTypeRoute, route, "route1")
+	if err != nil {
+		t.Fatalf("failed to diff route: %v", err)
+	}
+	if event == nil || event.Type != EventTypeCreate {
+		t.Fatalf("expected route CREATE event, got %+v", event)
+	}
+	event, err = differ.DiffOne(ResourceTypeSSL, ssl, "ssl1")
+	if err != nil {
+		t.Fatalf("failed to diff ssl: %v", err)
+	}
+	if event == nil || event.Type != EventTypeCreate {
+		t.Fatalf("expected ssl CREATE event, got %+v", event)
+	}
+	if err := cache.InsertRoute(route.DeepCopy()); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	if err := cache.InsertSSL(ssl.DeepCopy()); err != nil {
+		t.Fatalf("failed to insert ssl: %v", err)
+	}
+
+	// No change, defaults are normalized like in the bulk path
+	unchanged := route.DeepCopy()
+	unchanged.Upstream.Scheme = UpstreamSchemeHTTP
+	event, err = differ.DiffOne(ResourceTypeRoute, unchanged, "route1")
+	if err != nil {
+		t.Fatalf("failed to diff route: %v", err)
+	}
+	if event != nil {
+		t.Errorf("expected no route event, got %+v", event)
+	}
+	event, err = differ.DiffOne(ResourceTypeSSL, ssl.DeepCopy(), "ssl1")
+	if err != nil {
+		t.Fatalf("failed to diff ssl: %v", err)
+	}
+	if event != nil {
+		t.Errorf("expected no ssl event, got %+v", event)
+	}
+
+	// Update
+	updatedRoute := route.DeepCopy()
+	updatedRoute.URIs = []string{"/v2"}
+	event, err = differ.DiffOne(ResourceTypeRoute, updatedRoute, "route1")
+	if err != nil {
+		t.Fatalf("failed to diff route: %v", err)
+	}
+	if event == nil || event.Type != EventTypeUpdate || event.OldValue == nil {
+		t.Errorf("expected route UPDATE event, got %+v", event)
+	}
+	rotated := ssl.DeepCopy()
+	rotated.Key = "rotated-key"
+	event, err = differ.DiffOne(ResourceTypeSSL, rotated, "ssl1")
+	if err != nil {
+		t.Fatalf("failed to diff ssl: %v", err)
+	}
+	if event == nil || event.Type != EventTypeUpdate {
+		t.Errorf("expected ssl UPDATE event, got %+v", event)
+	}
+
+	// Delete
+	event, err = differ.DiffOne(ResourceTypeRoute, nil, "route1")
+	if err != nil {
+		t.Fatalf("failed to diff route: %v", err)
+	}
+	if event == nil || event.Type != EventTypeDelete || event.ResourceName != "route1" {
+		t.Errorf("expected route DELETE event, got %+v", event)
+	}
+	event, err = differ.DiffOne(ResourceTypeSSL, nil, "ssl1")
+	if err != nil {
+		t.Fatalf("failed to diff ssl: %v", err)
+	}
+	if event == nil || event.Type != EventTypeDelete {
+		t.Errorf("expected ssl DELETE event, got %+v", event)
+	}
+
+	// Deleting a resource that is not cached is a no-op
+	event, err = differ.DiffOne(ResourceTypeSSL, nil, "missing")
+	if err != nil {
+		t.Fatalf("failed to diff ssl: %v", err)
+	}
+	if event != nil {
+		t.Errorf("expected no event for missing ssl, got %+v", event)
+	}
+
+	// Mismatching object types are rejected
+	if _, err := differ.DiffOne(ResourceTypeSSL, route, "route1"); err == nil {
+		t.Error("expected error for mismatching object type")
+	}
+}
+
+func TestParseResourceTypes(t *testing.T) {
+	types, err := ParseResourceTypes([]string{"routes", "ssls"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(types) != 2 || types[0] != ResourceTypeRoute || types[1] != ResourceTypeSSL {
+		t.Errorf("unexpected types: %v", types)
+	}
+
+	// Singular names are aliases of the plural ones
+	types, err = ParseResourceTypes([]string{"route", "global_rule"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(types) != 2 || types[0] != ResourceTypeRoute || types[1] != ResourceTypeGlobalRule {
+		t.Errorf("unexpected types: %v", types)
+	}
+
+	// Typo of a resource type
+	_, err = ParseResourceTypes([]string{"routs"})
+	if !errors.Is(err, ErrUnknownResourceType) {
+		t.Fatalf("expected ErrUnknownResourceType, got %v", err)
+	}
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected unknown resource types to be invalid input, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"routs"`) || !strings.Contains(err.Error(), "global_rules") {
+		t.Errorf("expected error to name the typo and accepted values, got %v", err)
+	}
+
+	// Mixed valid and invalid input reports every invalid name
+	_, err = ParseResourceTypes([]string{"services", "upstrems", "ssls", "globalrules"})
+	if !errors.Is(err, ErrUnknownResourceType) {
+		t.Fatalf("expected ErrUnknownResourceType, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"upstrems"`) || !strings.Contains(err.Error(), `"globalrules"`) {
+		t.Errorf("expected error to list all invalid names, got %v", err)
+	}
+}
+
+func TestDiffer_UnknownType(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	differ := NewDiffer(cache)
+	_, err = differ.Diff(context.Background(), &TransferredResources{}, &DiffOptions{Types: []string{"routs"}})
+	if !errors.Is(err, ErrUnknownResourceType) {
+		t.Fatalf("expected ErrUnknownResourceType, got %v", err)
+	}
+}
+
+func TestDiffer_IgnoreFields(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	cached := &Route{
+		Metadata: adc.Metadata{
+			ID:     "route1",
+			Name:   "route1",
+			Desc:   "old description",
+			Labels: map[string]string{"team": "a"},
+		},
+		URIs: []string{"/"},
+	}
+	if err := cache.InsertRoute(cached); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	differ := NewDiffer(cache)
+
+	relabeled := cached.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "b"}
+	relabeled.Desc = "new description"
+
+	for _, fields := range [][]string{{"Labels", "Desc"}, {"Metadata.Labels", "Metadata.Desc"}} {
+		events, err := differ.Diff(context.Background(), &TransferredResources{Routes: []*Route{relabeled}},
+			&DiffOptions{IgnoreFields: fields})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("expected no events when ignoring %v, got %d", fields, len(events))
+		}
+	}
+
+	// Without ignored fields the label change is an update
+	events, err := differ.Diff(context.Background(), &TransferredResources{Routes: []*Route{relabeled}}, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("expected 1 event without ignored fields, got %d", len(events))
+	}
+
+	// A URI change is still detected
+	moved := relabeled.DeepCopy()
+	moved.URIs = []string{"/v2"}
+	events, err = differ.Diff(context.Background(), &TransferredResources{Routes: []*Route{moved}},
+		&DiffOptions{IgnoreFields: []string{"Metadata.Labels"}})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Errorf("expected 1 UPDATE event for uri change, got %+v", events)
+	}
+
+	// Invalid paths are rejected instead of panicking
+	_, err = differ.Diff(context.Background(), &TransferredResources{}, &DiffOptions{IgnoreFields: []string{"Metadata.Nope"}})
+	if err == nil {
+		t.Error("expected error for invalid ignore field")
+	}
+}
+
+func TestDiffer_SyncIDAndSequence(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if err := cache.InsertRoute(&Route{
+		Metadata: adc.Metadata{ID: "stale", Name: "stale"},
+		URIs:     []string{"/stale"},
+	}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+
+	newResources := &TransferredResources{
+		Routes: []*Route{
+			{Metadata: adc.Metadata{ID: "route1", Name: "route1"}, URIs: []string{"/1"}},
+			{Metadata: adc.Metadata{ID: "route2", Name: "route2"}, URIs: []string{"/2"}},
+		},
+		Upstreams: []*Upstream{
+			{Metadata: adc.Metadata{ID: "upstream1", Name: "upstream1"}, Nodes: map[string]uint32{"127.0.0.1:80": 1}},
+		},
+		SSLs: []*SSL{
+			{Metadata: adc.Metadata{ID: "ssl1", Name: "ssl1"}, SNIs: []string{exampleHost}},
+		},
+	}
+
+	events, err := NewDiffer(cache).Diff(context.Background(), newResources, &DiffOptions{SyncID: "sync-1"})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(events))
+	}
+
+	sorted := make([]Event, len(events))
+	copy(sorted, events)
+	sortEvents(sorted)
+	seen := make(map[int]bool)
+	for i, event := range events {
+		if event.SyncID != "sync-1" {
+			t.Errorf("event %d: expected sync id sync-1, got %q", i, event.SyncID)
+		}
+		if event.Sequence != i {
+			t.Errorf("event %d: expected sequence %d, got %d", i, i, event.Sequence)
+		}
+		if seen[event.Sequence] {
+			t.Errorf("duplicate sequence %d", event.Sequence)
+		}
+		seen[event.Sequence] = true
+		if sorted[i].ResourceID != event.ResourceID || sorted[i].Type != event.Type {
+			t.Errorf("event %d: sequence does not follow sortEvents order", i)
+		}
+	}
+}
+
+func TestDiffer_KeepalivePoolChange(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	cached := &Upstream{
+		Metadata:      adc.Metadata{ID: "upstream1", Name: "upstream1"},
+		Nodes:         map[string]uint32{"127.0.0.1:8080": 100},
+		KeepalivePool: &KeepalivePool{Size: 320, IdleTimeout: 60, Requests: 1000},
+	}
+	if err := cache.InsertUpstream(cached); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+
+	updated := cached.DeepCopy()
+	updated.KeepalivePool.Size = 64
+	events, err := NewDiffer(cache).Diff(context.Background(),
+		&TransferredResources{Upstreams: []*Upstream{updated}}, &DiffOptions{IncludeChanges: true})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event, got %+v", events)
+	}
+	if _, ok := events[0].Changes["/keepalive_pool/size"]; !ok {
+		t.Errorf("expected keepalive_pool size change, got %v", events[0].Changes)
+	}
+}
+
+func TestDiffer_RouteStatusToggle(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	serviceID := "service1"
+	cached := &Route{
+		Metadata:  adc.Metadata{ID: testRouteID, Name: testRouteID},
+		URIs:      []string{"/api"},
+		ServiceID: &serviceID,
+	}
+	if err := cache.InsertRoute(cached); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	diff := func(status *int) []Event {
+		t.Helper()
+		desired := cached.DeepCopy()
+		desired.Status = status
+		events, err := NewDiffer(cache).Diff(context.Background(),
+			&TransferredResources{Routes: []*Route{desired}}, &DiffOptions{IncludeChanges: true})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		if len(events) == 1 {
+			if err := cache.InsertRoute(events[0].NewValue.(*Route)); err != nil {
+				t.Fatalf("failed to update route: %v", err)
+			}
+		}
+		return events
+	}
+
+	enabled, disabled := RouteStatusEnabled, RouteStatusDisabled
+	if events := diff(&enabled); len(events) != 0 {
+		t.Fatalf("expected an explicit enabled status to match the default, got %+v", events)
+	}
+	events := diff(&disabled)
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event disabling the route, got %+v", events)
+	}
+	if _, ok := events[0].Changes["/status"]; !ok {
+		t.Errorf("expected a status change, got %v", events[0].Changes)
+	}
+	if events := diff(&disabled); len(events) != 0 {
+		t.Fatalf("expected no event for an unchanged status, got %+v", events)
+	}
+	if events := diff(nil); len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event enabling the route, got %+v", events)
+	}
+	if cached.Status != nil {
+		t.Errorf("expected the cached route to be left untouched, got status %d", *cached.Status)
+	}
+}
+
+func TestDiffer_ServiceWebsocketToggle(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	upstreamID := "upstream1"
+	cached := &Service{
+		Metadata:   adc.Metadata{ID: "service1", Name: "service1"},
+		UpstreamID: &upstreamID,
+	}
+	if err := cache.InsertService(cached); err != nil {
+		t.Fatalf("failed to insert service: %v", err)
+	}
+	diff := func(enableWebsocket *bool) []Event {
+		t.Helper()
+		desired := cached.DeepCopy()
+		desired.EnableWebsocket = enableWebsocket
+		events, err := NewDiffer(cache).Diff(context.Background(),
+			&TransferredResources{Services: []*Service{desired}}, &DiffOptions{IncludeChanges: true})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		return events
+	}
+
+	disabled, enabled := false, true
+	if events := diff(&disabled); len(events) != 0 {
+		t.Fatalf("expected an explicit false to match the default, got %+v", events)
+	}
+	events := diff(&enabled)
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event, got %+v", events)
+	}
+	if _, ok := events[0].Changes["/enable_websocket"]; !ok {
+		t.Errorf("expected an enable_websocket change, got %v", events[0].Changes)
+	}
+	if copied := events[0].NewValue.(*Service).DeepCopy(); copied.EnableWebsocket == &enabled || !*copied.EnableWebsocket {
+		t.Error("expected DeepCopy to copy enable_websocket")
+	}
+}
+
+func TestDiffer_Protos(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	resources, err := TransferResources(&adc.Resources{
+		Protos: []*adc.Proto{{Metadata: adc.Metadata{ID: "helloworld"}, Content: testProtoContent}},
+		Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "grpc"},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 50051, Weight: 100}}},
+			Routes: []*adc.Route{{
+				Metadata: adc.Metadata{Name: "say-hello"},
+				Uris:     []string{"/hello"},
+				Plugins:  adc.Plugins{"grpc-transcode": map[string]any{"proto_id": "helloworld", "service": "helloworld.Greeter", "method": "SayHello"}},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+
+	differ := NewDiffer(cache)
+	events, err := differ.Diff(context.Background(), resources, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 3 || events[0].ResourceType != ResourceTypeProto || events[0].Type != EventTypeCreate ||
+		events[2].ResourceType != ResourceTypeRoute {
+		t.Fatalf("expected the proto to be created before the routes, got %+v", events)
+	}
+	for _, event := range events {
+		if err := cache.Insert(event.NewValue); err != nil {
+			t.Fatalf("failed to insert %s: %v", event.ResourceType, err)
+		}
+	}
+
+	updated := strings.Replace(testProtoContent, "string name = 1;", "string name = 1;\n  string locale = 2;", 1)
+	resources.Protos[0] = &Proto{Metadata: resources.Protos[0].Metadata, Content: updated}
+	for _, includeChanges := range []bool{false, true} {
+		events, err := differ.Diff(context.Background(), &TransferredResources{Protos: resources.Protos},
+			&DiffOptions{Types: []string{string(ResourceTypeProto)}, IncludeChanges: includeChanges})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		if len(events) != 1 || events[0].Type != EventTypeUpdate {
+			t.Fatalf("expected 1 UPDATE event, got %+v", events)
+		}
+		oldValue := events[0].OldValue.(*Proto)
+		wantOld := testProtoContent
+		if !includeChanges {
+			wantOld = (&Proto{Content: testProtoContent}).ContentDigest()
+		}
+		if oldValue.Content != wantOld {
+			t.Errorf("includeChanges=%v: expected old content %q, got %q", includeChanges, wantOld, oldValue.Content)
+		}
+		if events[0].NewValue.(*Proto).Content != updated {
+			t.Errorf("expected the new value to carry the full content")
+		}
+		if _, ok := events[0].Changes["/content"]; includeChanges && !ok {
+			t.Errorf("expected a content change, got %v", events[0].Changes)
+		}
+	}
+	if cached, err := cache.GetProto("helloworld"); err != nil || cached.Content != testProtoContent {
+		t.Errorf("expected the cached proto to be left untouched, got %+v (%v)", cached, err)
+	}
+}
+
+func TestTransferResourcesSharedUpstreams(t *testing.T) {
+	newResources := func(nodeHost string) *adc.Resources {
+		resources := &adc.Resources{}
+		for _, name := range []string{"svc-a", "svc-b", "svc-c"} {
+			resources.Services = append(resources.Services, &adc.Service{
+				Metadata: adc.Metadata{Name: name},
+				Upstream: &adc.Upstream{
+					Nodes: adc.UpstreamNodes{{Host: nodeHost, Port: 8080, Weight: 100}},
+				},
+			})
+		}
+		return resources
+	}
+
+	result, err := TransferResources(newResources("10.0.0.1"), SharedUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if len(result.Upstreams) != 1 {
+		t.Fatalf("expected 1 shared upstream, got %d", len(result.Upstreams))
+	}
+	sharedID := result.Upstreams[0].ID
+	for _, service := range result.Services {
+		if service.Upstream != nil {
+			t.Errorf("service %s: expected no inline upstream", service.Name)
+		}
+		if service.UpstreamID == nil || *service.UpstreamID != sharedID {
+			t.Errorf("service %s: expected upstream_id %s", service.Name, sharedID)
+		}
+	}
+
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	differ := NewDiffer(cache)
+	apply := func(events []Event) {
+		t.Helper()
+		for _, event := range events {
+			var err error
+			if event.Type == EventTypeDelete {
+				err = cache.Delete(event.OldValue)
+			} else {
+				err = cache.Insert(event.NewValue)
+			}
+			if err != nil {
+				t.Fatalf("failed to apply event: %v", err)
+			}
+		}
+	}
+
+	events, err := differ.Diff(context.Background(), result, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	apply(events)
+
+	// An endpoint change touches the single shared upstream once, services
+	// only move their upstream_id reference
+	result, err = TransferResources(newResources("10.0.0.2"), SharedUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	events, err = differ.Diff(context.Background(), result, &DiffOptions{IncludeChanges: true})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, event := range events {
+		counts[string(event.Type)+" "+string(event.ResourceType)]++
+		if event.ResourceType == ResourceTypeService {
+			if paths := ChangedPaths(event.Changes); !cmp.Equal(paths, []string{"/upstream_id"}) {
+				t.Errorf("service %s: expected only upstream_id to change, got %v", event.ResourceName, paths)
+			}
+		}
+	}
+	expected := map[string]int{
+		"CREATE upstreams": 1,
+		"DELETE upstreams": 1,
+		"UPDATE services":  3,
+	}
+	if !cmp.Equal(counts, expected) {
+		t.Errorf("unexpected events: %v", counts)
+	}
+}
+
+func TestTransferResourcesSharedUpstreamBestEffort(t *testing.T) {
+	newService := func(name string, timeout float64) *adc.Service {
+		return &adc.Service{
+			Metadata: adc.Metadata{Name: name},
+			Upstream: &adc.Upstream{
+				Nodes:   adc.UpstreamNodes{{Host: "10.0.0.1", Port: 8080, Weight: 100}},
+				Timeout: &adc.Timeout{Connect: timeout, Send: timeout, Read: timeout},
+			},
+		}
+	}
+	// An infinite timeout cannot be hashed into a shared upstream ID
+	resources := &adc.Resources{Services: []*adc.Service{newService("svc-a", 5), newService("svc-bad", math.Inf(1))}}
+
+	if _, err := TransferResources(resources, SharedUpstreams()); err == nil {
+		t.Fatal("expected the strict transfer to fail")
+	}
+	result, err := TransferResources(resources, SharedUpstreams(), BestEffort())
+	if err != nil {
+		t.Fatalf("expected the best-effort transfer to succeed: %v", err)
+	}
+	if len(result.Services) != 1 || result.Services[0].Name != "svc-a" {
+		t.Errorf("expected only svc-a to be transferred, got %v", result.Services)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Name != "svc-bad" {
+		t.Errorf("expected svc-bad to be skipped with a warning, got %v", result.Warnings)
+	}
+}
+
+func TestDiffer_SharedUpstreamLabelScoped(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	shared, err := shareUpstream(&Upstream{Nodes: map[string]uint32{"10.0.0.1:8080": 100}}, &TransferOptions{})
+	if err != nil {
+		t.Fatalf("failed to share upstream: %v", err)
+	}
+	if err := cache.InsertUpstream(shared); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+
+	// A label scoped sync does not recreate the unlabeled shared upstream
+	events, err := NewDiffer(cache).Diff(context.Background(),
+		&TransferredResources{Upstreams: []*Upstream{shared.DeepCopy()}},
+		&DiffOptions{Labels: map[string]string{
+			"k8s/kind":      "HTTPRoute",
+			"k8s/namespace": "default",
+			"k8s/name":      "api",
+		}})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+}
+
+func TestDiffer_ServiceEmbeddedAndReferencedUpstream(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	shared, err := shareUpstream(&Upstream{Nodes: map[string]uint32{"10.0.0.1:8080": 100}}, &TransferOptions{})
+	if err != nil {
+		t.Fatalf("failed to share upstream: %v", err)
+	}
+	service := &Service{
+		Metadata:   adc.Metadata{ID: "service1", Name: "service1"},
+		UpstreamID: &shared.ID,
+	}
+	if err := cache.InsertUpstream(shared); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+	if err := cache.InsertService(service); err != nil {
+		t.Fatalf("failed to insert service: %v", err)
+	}
+	diff := func(desired *TransferredResources) ([]Event, []*UpstreamMismatch) {
+		t.Helper()
+		var mismatches []*UpstreamMismatch
+		events, err := NewDiffer(cache).Diff(context.Background(), desired, &DiffOptions{
+			OnUpstreamMismatch: func(m *UpstreamMismatch) { mismatches = append(mismatches, m) },
+		})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		return events, mismatches
+	}
+	withEmbedded := func(upstream *Upstream) *Service {
+		desired := service.DeepCopy()
+		desired.Upstream = upstream
+		return desired
+	}
+
+	// An embedded copy of the referenced upstream causes no update
+	desired := withEmbedded(&Upstream{Metadata: adc.Metadata{Name: "inline"}, Nodes: shared.Nodes})
+	events, mismatches := diff(&TransferredResources{Services: []*Service{desired}, Upstreams: []*Upstream{shared}})
+	if len(events) != 0 || len(mismatches) != 0 {
+		t.Fatalf("expected no events nor mismatches, got %+v and %v", events, mismatches)
+	}
+	if desired.Upstream == nil {
+		t.Error("expected the desired service to be left as is")
+	}
+
+	// Node changes go to the referenced upstream only
+	moved := shared.DeepCopy()
+	moved.Nodes = map[string]uint32{"10.0.0.2:8080": 100}
+	events, mismatches = diff(&TransferredResources{
+		Services:  []*Service{withEmbedded(&Upstream{Nodes: moved.Nodes})},
+		Upstreams: []*Upstream{moved},
+	})
+	if len(events) != 1 || events[0].ResourceType != ResourceTypeUpstream || len(mismatches) != 0 {
+		t.Fatalf("expected only the upstream to be updated, got %+v and %v", events, mismatches)
+	}
+
+	// A conflicting embedded upstream is reported, the reference wins
+	events, mismatches = diff(&TransferredResources{
+		Services:  []*Service{withEmbedded(&Upstream{Nodes: moved.Nodes})},
+		Upstreams: []*Upstream{shared},
+	})
+	want := []*UpstreamMismatch{{ServiceID: service.ID, UpstreamID: shared.ID}}
+	if len(events) != 0 || len(mismatches) != 1 || *mismatches[0] != *want[0] {
+		t.Fatalf("expected a mismatch and no events, got %+v and %v", events, mismatches)
+	}
+
+	// New services are created with the reference only
+	created := withEmbedded(&Upstream{Nodes: shared.Nodes})
+	created.ID = "service2"
+	events, _ = diff(&TransferredResources{
+		Services:  []*Service{service.DeepCopy(), created},
+		Upstreams: []*Upstream{shared},
+	})
+	if len(events) != 1 || events[0].Type != EventTypeCreate {
+		t.Fatalf("expected 1 CREATE event, got %+v", events)
+	}
+	if value := events[0].NewValue.(*Service); value.Upstream != nil || *value.UpstreamID != shared.ID {
+		t.Errorf("expected the created service to carry the reference only, got %+v", value)
+	}
+}
+
+func TestDiffer_NamespaceWideSelector(t *testing.T) {
+	route := func(namespace, name string, uri string) *Route {
+		return &Route{
+			Metadata: adc.Metadata{
+				ID:   namespace + "-" + name,
+				Name: name,
+				Labels: map[string]string{
+					label.LabelKind:      "ApisixRoute",
+					label.LabelNamespace: namespace,
+					label.LabelName:      name,
+				},
+			},
+			URIs: []string{uri},
+		}
+	}
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, cached := range []*Route{
+		route("default", "a", "/a"),
+		route("default", "b", "/b"),
+		route("staging", "c", "/c"),
+	} {
+		if err := cache.InsertRoute(cached); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+	differ := NewDiffer(cache)
+	namespaceWide := map[string]string{label.LabelKind: "ApisixRoute", label.LabelNamespace: "default"}
+
+	// The namespace is diffed as one unit across names, other namespaces
+	// are out of scope
+	desired := &TransferredResources{Routes: []*Route{route("default", "a", "/a2"), route("default", "d", "/d")}}
+	events, err := differ.Diff(context.Background(), desired, &DiffOptions{Labels: namespaceWide})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, string(event.Type)+" "+event.ResourceID)
+	}
+	slices.Sort(got)
+	want := []string{"CREATE default-d", "DELETE default-b", "UPDATE default-a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected events %v, got %v", want, got)
+	}
+
+	// A kind-wide selector reaches every namespace
+	events, err = differ.Diff(context.Background(), &TransferredResources{},
+		&DiffOptions{Labels: map[string]string{label.LabelKind: "ApisixRoute"}})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 3 {
+		t.Errorf("expected every route to be deleted, got %+v", events)
+	}
+
+	for _, labels := range []map[string]string{
+		{label.LabelKind: "ApisixRoute", label.LabelName: "a"},
+		{label.LabelNamespace: "default"},
+	} {
+		if _, err := differ.Diff(context.Background(), &TransferredResources{}, &DiffOptions{Labels: labels}); err == nil {
+			t.Errorf("expected label selector %v to be rejected", labels)
+		}
+	}
+}
+
+func TestDiffer_GlobalRuleOwnership(t *testing.T) {
+	ownerA := map[string]string{"k8s/kind": "GatewayProxy", "k8s/namespace": "default", "k8s/name": "a"}
+	ownerB := map[string]string{"k8s/kind": "GatewayProxy", "k8s/namespace": "default", "k8s/name": "b"}
+
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if err := cache.InsertGlobalRule(&GlobalRule{
+		ID:      "limit-req",
+		Plugins: map[string]any{"limit-req": map[string]any{"rate": 1}},
+		Labels:  ownerA,
+	}); err != nil {
+		t.Fatalf("failed to insert global rule: %v", err)
+	}
+	differ := NewDiffer(cache)
+	desired := func(owner map[string]string, rate int) *TransferredResources {
+		return &TransferredResources{
+			GlobalRules: TransferGlobalRule(adc.GlobalRule{"limit-req": map[string]any{"rate": rate}}, OwnerLabels(owner)),
+		}
+	}
+
+	// Same owner update
+	events, err := differ.Diff(context.Background(), desired(ownerA, 2), &DiffOptions{Labels: ownerA})
+	if err != nil {
+		t.Fatalf("unexpected error for same owner update: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event, got %+v", events)
+	}
+
+	// Another owner claiming the same plugin is a conflict
+	_, err = differ.Diff(context.Background(), desired(ownerB, 3), &DiffOptions{Labels: ownerB})
+	var conflict *OwnershipConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected OwnershipConflictError, got %v", err)
+	}
+	if !errors.Is(err, ErrDiffFailed) || !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a diff error of conflict, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "GatewayProxy default/a") || !strings.Contains(err.Error(), "GatewayProxy default/b") {
+		t.Errorf("expected error to name both owners, got %v", err)
+	}
+
+	// Forcing lets the new owner take the rule over
+	events, err = differ.Diff(context.Background(), desired(ownerB, 3), &DiffOptions{Labels: ownerB, ForceOwnership: true})
+	if err != nil {
+		t.Fatalf("unexpected error with force: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event, got %+v", events)
+	}
+
+	// A scoped sync of another owner does not delete the rule
+	events, err = differ.Diff(context.Background(), &TransferredResources{}, &DiffOptions{Labels: ownerB})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for another owner's scope, got %+v", events)
+	}
+}
+
+func TestDiffer_PluginMetadata(t *testing.T) {
+	owner := map[string]string{"k8s/kind": "GatewayProxy", "k8s/namespace": "default", "k8s/name": "a"}
+	other := map[string]string{"k8s/kind": "GatewayProxy", "k8s/namespace": "default", "k8s/name": "b"}
+
+	cache, err := NewBoltCache(filepath.Join(t.TempDir(), "kine.db"))
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer func() { _ = cache.(io.Closer).Close() }()
+	differ := NewDiffer(cache)
+	desired := func(labels map[string]string, metadata adc.PluginMetadata) *TransferredResources {
+		t.Helper()
+		resources, err := TransferResources(&adc.Resources{PluginMetadata: metadata}, OwnerLabels(labels))
+		if err != nil {
+			t.Fatalf("failed to transfer resources: %v", err)
+		}
+		return resources
+	}
+	diff := func(resources *TransferredResources, opts *DiffOptions) []Event {
+		t.Helper()
+		events, err := differ.Diff(context.Background(), resources, opts)
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		for _, event := range events {
+			if event.Type == EventTypeDelete {
+				err = DeleteByID(cache, event.ResourceType, event.ResourceID)
+			} else {
+				err = cache.Insert(event.NewValue)
+			}
+			if err != nil {
+				t.Fatalf("failed to apply %s: %v", event.Type, err)
+			}
+		}
+		return events
+	}
+	logFormat := func(maxBody int) adc.PluginMetadata {
+		return adc.PluginMetadata{"http-logger": map[string]any{
+			"log_format": map[string]any{"host": "$host"},
+			"max_body":   maxBody,
+		}}
+	}
+
+	// Create
+	events := diff(desired(owner, logFormat(1024)), &DiffOptions{Labels: owner})
+	if len(events) != 1 || events[0].Type != EventTypeCreate || events[0].ResourceID != "http-logger" {
+		t.Fatalf("expected 1 CREATE event, got %+v", events)
+	}
+
+	// The cache decodes numbers as float64, the desired ints still match
+	if events := diff(desired(owner, logFormat(1024)), &DiffOptions{Labels: owner}); len(events) != 0 {
+		t.Fatalf("expected no events for unchanged metadata, got %+v", events)
+	}
+
+	// Config change
+	events = diff(desired(owner, logFormat(2048)), &DiffOptions{Labels: owner})
+	if len(events) != 1 || events[0].Type != EventTypeUpdate {
+		t.Fatalf("expected 1 UPDATE event, got %+v", events)
+	}
+
+	// Another owner claiming the same plugin is a conflict
+	_, err = differ.Diff(context.Background(), desired(other, logFormat(4096)), &DiffOptions{Labels: other})
+	var conflict *OwnershipConflictError
+	if !errors.As(err, &conflict) || conflict.ResourceType != ResourceTypePluginMetadata {
+		t.Fatalf("expected OwnershipConflictError, got %v", err)
+	}
+
+	// A scoped sync of another owner does not delete the metadata
+	if events := diff(&TransferredResources{}, &DiffOptions{Labels: other}); len(events) != 0 {
+		t.Fatalf("expected no events for another owner's scope, got %+v", events)
+	}
+
+	// Removal
+	events = diff(&TransferredResources{}, &DiffOptions{Labels: owner})
+	if len(events) != 1 || events[0].Type != EventTypeDelete || events[0].ResourceID != "http-logger" {
+		t.Fatalf("expected 1 DELETE event, got %+v", events)
+	}
+}
+
+func TestDiffer_CreateOwnership(t *testing.T) {
+	ownerA := map[string]string{"k8s/kind": "Ingress", "k8s/namespace": "default", "k8s/name": "a"}
+	ownerB := map[string]string{"k8s/kind": "Ingress", "k8s/namespace": "default", "k8s/name": "b"}
+	route := func(owner map[string]string) *Route {
+		return &Route{
+			Metadata: adc.Metadata{ID: "route-x", Name: "route-x", Labels: owner},
+			URIs:     []string{"/x"},
+		}
+	}
+
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if err := cache.InsertRoute(route(ownerA)); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	differ := NewDiffer(cache)
+
+	// Owner B's scope does not see the route, creating it is a conflict
+	desired := &TransferredResources{Routes: []*Route{route(ownerB)}}
+	_, err = differ.Diff(context.Background(), desired, &DiffOptions{Labels: ownerB})
+	var conflict *OwnershipConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected OwnershipConflictError, got %v", err)
+	}
+	if conflict.ResourceType != ResourceTypeRoute || conflict.ID != "route-x" ||
+		conflict.Owner != "Ingress default/a" || conflict.Claimant != "Ingress default/b" {
+		t.Errorf("unexpected conflict: %+v", conflict)
+	}
+
+	// Forcing turns the create into an update taking the route over
+	events, err := differ.Diff(context.Background(), desired, &DiffOptions{Labels: ownerB, ForceOwnership: true})
+	if err != nil {
+		t.Fatalf("unexpected error with force: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTypeUpdate || events[0].OldValue.(*Route).Labels["k8s/name"] != "a" {
+		t.Fatalf("expected 1 UPDATE event from owner a, got %+v", events)
+	}
+}
+
+// snapshotOnlyCache fails the test on cache reads outside of a read
+// transaction
+type snapshotOnlyCache struct {
+	Cache
+	t *testing.T
+}
+
+func (c *snapshotOnlyCache) GetRoute(id string) (*Route, error) {
+	c.t.Errorf("route %s read outside of the diff snapshot", id)
+	return c.Cache.GetRoute(id)
+}
+
+func (c *snapshotOnlyCache) GetUpstream(id string) (*Upstream, error) {
+	c.t.Errorf("upstream %s read outside of the diff snapshot", id)
+	return c.Cache.GetUpstream(id)
+}
+
+func TestDiffer_CreateOwnershipSnapshot(t *testing.T) {
+	ownerA := map[string]string{"k8s/kind": "Ingress", "k8s/namespace": "default", "k8s/name": "a"}
+	ownerB := map[string]string{"k8s/kind": "Ingress", "k8s/namespace": "default", "k8s/name": "b"}
+	upstreamID := "upstream-a"
+	upstream := func(node string) *Upstream {
+		return &Upstream{Metadata: adc.Metadata{ID: upstreamID, Labels: ownerA}, Nodes: map[string]uint32{node: 100}}
+	}
+	route := func(owner map[string]string) *Route {
+		return &Route{Metadata: adc.Metadata{ID: "route-x", Name: "route-x", Labels: owner}, URIs: []string{"/x"}}
+	}
+
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, obj := range []any{route(ownerA), upstream("10.0.0.1:80")} {
+		if err := cache.Insert(obj); err != nil {
+			t.Fatalf("failed to insert %T: %v", obj, err)
+		}
+	}
+	differ := NewDiffer(&snapshotOnlyCache{Cache: cache, t: t})
+
+	// Owner B references the upstream of owner A, embedding another copy
+	desired := &TransferredResources{
+		Routes: []*Route{route(ownerB)},
+		Services: []*Service{{
+			Metadata:   adc.Metadata{ID: "svc-b", Name: "svc-b", Labels: ownerB},
+			UpstreamID: &upstreamID,
+			Upstream:   upstream("10.0.0.2:80"),
+		}},
+	}
+	var mismatches []*UpstreamMismatch
+	events, err := differ.Diff(context.Background(), desired, &DiffOptions{
+		Labels: ownerB,
+		// Ignoring the labels, the route is the one cached for owner a
+		IgnoreFields:       []string{"Labels"},
+		OnUpstreamMismatch: func(mismatch *UpstreamMismatch) { mismatches = append(mismatches, mismatch) },
+	})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 1 || events[0].ResourceID != "svc-b" {
+		t.Errorf("expected only the service to be created, got %+v", events)
+	}
+	if len(mismatches) != 1 {
+		t.Errorf("expected the embedded upstream to mismatch the cached one, got %v", mismatches)
+	}
+}
+
+func TestDiffer_DerivedFrom(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, id := range []string{"kept", "stale", "gone"} {
+		if err := cache.InsertRoute(&Route{
+			Metadata: adc.Metadata{ID: id, Name: id},
+			URIs:     []string{"/" + id},
+		}); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+	revisions, err := cache.Revisions(ResourceTypeRoute)
+	if err != nil {
+		t.Fatalf("failed to read revisions: %v", err)
+	}
+	// The stale route changed since the desired state was derived from it
+	if err := cache.InsertRoute(&Route{
+		Metadata: adc.Metadata{ID: "stale", Name: "stale"},
+		URIs:     []string{"/changed"},
+	}); err != nil {
+		t.Fatalf("failed to update route: %v", err)
+	}
+
+	newResources := &TransferredResources{
+		Routes: []*Route{
+			// Declared unchanged, so its differing content is not compared
+			{Metadata: adc.Metadata{ID: "kept", Name: "kept"}, URIs: []string{"/other"}},
+			{Metadata: adc.Metadata{ID: "stale", Name: "stale"}, URIs: []string{"/stale"}},
+			{Metadata: adc.Metadata{ID: "new", Name: "new"}, URIs: []string{"/new"}},
+		},
+	}
+	events, err := NewDiffer(cache).Diff(context.Background(), newResources, &DiffOptions{
+		Types: []string{string(ResourceTypeRoute)},
+		DerivedFrom: map[ResourceType]map[string]uint64{
+			ResourceTypeRoute: {
+				"kept":  revisions["kept"],
+				"stale": revisions["stale"],
+				"new":   revisions["stale"],
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+
+	current, err := cache.Revisions(ResourceTypeRoute)
+	if err != nil {
+		t.Fatalf("failed to read revisions: %v", err)
+	}
+	got := make(map[string]Event, len(events))
+	for _, event := range events {
+		got[event.ResourceID] = event
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected events for stale, new and gone, got %v", got)
+	}
+	if event := got["stale"]; event.Type != EventTypeUpdate || event.ModRevision != current["stale"] {
+		t.Errorf("expected an update of stale at revision %d, got %s at %d",
+			current["stale"], event.Type, event.ModRevision)
+	}
+	if event := got["new"]; event.Type != EventTypeCreate || event.ModRevision != 0 {
+		t.Errorf("expected a create of new without revision, got %s at %d", event.Type, event.ModRevision)
+	}
+	if event := got["gone"]; event.Type != EventTypeDelete || event.ModRevision != current["gone"] {
+		t.Errorf("expected a delete of gone at revision %d, got %s at %d",
+			current["gone"], event.Type, event.ModRevision)
+	}
+}
+
+func TestDiffer_ForceUpdate(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	newResources := &TransferredResources{}
+	for i := 0; i < 3; i++ {
+		route := &Route{
+			Metadata: adc.Metadata{ID: fmt.Sprintf("route-%d", i), Name: fmt.Sprintf("route-%d", i)},
+			URIs:     []string{"/"},
+		}
+		if err := cache.InsertRoute(route); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+		newResources.Routes = append(newResources.Routes, route.DeepCopy())
+	}
+	if err := cache.InsertRoute(&Route{Metadata: adc.Metadata{ID: "gone", Name: "gone"}, URIs: []string{"/"}}); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	// Matching hashes must not skip the forced updates
+	newResources.Hashes = hashResources(newResources)
+
+	for _, force := range []bool{false, true} {
+		events, err := NewDiffer(cache).Diff(context.Background(), newResources, &DiffOptions{ForceUpdate: force})
+		if err != nil {
+			t.Fatalf("failed to diff: %v", err)
+		}
+		var updates, deletes int
+		for _, event := range events {
+			switch event.Type {
+			case EventTypeUpdate:
+				updates++
+				if !event.Forced || event.OldValue == nil || event.NewValue == nil {
+					t.Errorf("expected a forced update with both values, got %+v", event)
+				}
+			case EventTypeDelete:
+				deletes++
+			default:
+				t.Errorf("unexpected event %s %s", event.Type, event.ResourceID)
+			}
+		}
+		wantUpdates := 0
+		if force {
+			wantUpdates = 3
+		}
+		if updates != wantUpdates || deletes != 1 {
+			t.Errorf("force %v: expected %d updates and 1 delete, got %d and %d", force, wantUpdates, updates, deletes)
+		}
+	}
+}
+
+func TestDiffer_ParentIDs(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	serviceID, upstreamID := "svc", "shared-upstream"
+	route := func(id, uri string) *Route {
+		return &Route{Metadata: adc.Metadata{ID: id, Name: id}, URIs: []string{uri}, ServiceID: &serviceID}
+	}
+	ssl := func(id, name, cert string) *SSL {
+		return &SSL{Metadata: adc.Metadata{ID: id, Name: name}, Cert: cert, Key: "key", SNIs: []string{exampleHost}}
+	}
+	for _, obj := range []any{
+		route("updated", "/a"),
+		route("deleted", "/b"),
+		&Service{Metadata: adc.Metadata{ID: serviceID, Name: serviceID}, UpstreamID: &upstreamID},
+		ssl("split-0", "split", "cert-0"),
+		ssl("split-1", "split", "cert-1"),
+	} {
+		if err := cache.Insert(obj); err != nil {
+			t.Fatalf("failed to insert %T: %v", obj, err)
+		}
+	}
+
+	newResources := &TransferredResources{
+		Routes: []*Route{route("updated", "/changed"), route("created", "/c")},
+		Services: []*Service{
+			{Metadata: adc.Metadata{ID: serviceID, Name: serviceID, Desc: "changed"}, UpstreamID: &upstreamID},
+		},
+		SSLs: []*SSL{
+			// One certificate of the split SSL changed, the other was removed
+			ssl("split-0", "split", "cert-0-renewed"),
+			ssl("single", "single", "cert"),
+		},
+	}
+	events, err := NewDiffer(cache).Diff(context.Background(), newResources, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+
+	got := make(map[string]string, len(events))
+	for _, event := range events {
+		got[string(event.Type)+" "+event.ResourceID] = event.ParentID
+	}
+	want := map[string]string{
+		"UPDATE updated": serviceID,
+		"CREATE created": serviceID,
+		"DELETE deleted": serviceID,
+		"UPDATE svc":     upstreamID,
+		"UPDATE split-0": "split",
+		"DELETE split-1": "split",
+		"CREATE single":  "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected parent IDs (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffer_Keep(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	keptID, deletedID, upstreamID := "kept", "deleted", "upstream"
+	owned := map[string]string{"k8s/kind": "ApisixRoute", "k8s/namespace": "default", "k8s/name": "owned"}
+	for _, obj := range []any{
+		&Service{Metadata: adc.Metadata{ID: keptID, Name: keptID}, UpstreamID: &upstreamID},
+		&Route{Metadata: adc.Metadata{ID: "kept-route", Name: "kept-route"}, URIs: []string{"/a"}, ServiceID: &keptID},
+		&Upstream{Metadata: adc.Metadata{ID: upstreamID, Name: upstreamID},
+			Nodes: map[string]uint32{"10.0.0.1:80": 100}},
+		&Service{Metadata: adc.Metadata{ID: deletedID, Name: deletedID}},
+		&Route{Metadata: adc.Metadata{ID: "deleted-route", Name: "deleted-route"}, URIs: []string{"/b"}, ServiceID: &deletedID},
+		&Route{Metadata: adc.Metadata{ID: "owned-route", Name: "owned-route", Labels: owned}, URIs: []string{"/c"}},
+	} {
+		if err := cache.Insert(obj); err != nil {
+			t.Fatalf("failed to insert %T: %v", obj, err)
+		}
+	}
+
+	keep := &KeepSet{}
+	keep.add(ResourceTypeService, keptID, nil)
+	keep.add(ResourceTypeRoute, "", owned)
+	events, err := NewDiffer(cache).Diff(context.Background(), &TransferredResources{}, &DiffOptions{Keep: keep})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, string(event.Type)+" "+event.ResourceID)
+	}
+	// The kept service takes its routes and upstream along, the owned
+	// route is kept by owner
+	want := []string{"DELETE deleted-route", "DELETE deleted"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompactEvents(t *testing.T) {
+	route := func(id, uri string) *Route {
+		return &Route{Metadata: adc.Metadata{ID: id, Name: id}, URIs: []string{uri}}
+	}
+	create := func(id, uri string) Event {
+		return Event{Type: EventTypeCreate, ResourceType: ResourceTypeRoute, ResourceID: id, NewValue: route(id, uri)}
+	}
+	update := func(id, oldURI, newURI string, revision uint64) Event {
+		return Event{Type: EventTypeUpdate, ResourceType: ResourceTypeRoute, ResourceID: id,
+			OldValue: route(id, oldURI), NewValue: route(id, newURI), ModRevision: revision}
+	}
+	del := func(id, uri string, revision uint64) Event {
+		return Event{Type: EventTypeDelete, ResourceType: ResourceTypeRoute, ResourceID: id,
+			OldValue: route(id, uri), ModRevision: revision}
+	}
+	uriOf := func(value any) string {
+		if value == nil {
+			return ""
+		}
+		return value.(*Route).URIs[0]
+	}
+
+	tests := []struct {
+		name   string
+		events []Event
+		// want holds type, old uri, new uri and revision of each event
+		want []string
+	}{
+		{
+			name:   "delete then create",
+			events: []Event{del("r", "/old", 3), create("r", "/new")},
+			want:   []string{"UPDATE /old /new 3"},
+		},
+		{
+			name:   "create then delete",
+			events: []Event{create("r", "/new"), del("r", "/new", 0)},
+			want:   nil,
+		},
+		{
+			name:   "create then delete then create",
+			events: []Event{create("r", "/a"), del("r", "/a", 0), create("r", "/b")},
+			want:   []string{"CREATE  /b 0"},
+		},
+		{
+			name:   "create then update",
+			events: []Event{create("r", "/a"), update("r", "/a", "/b", 0)},
+			want:   []string{"CREATE  /b 0"},
+		},
+		{
+			name:   "update then update",
+			events: []Event{update("r", "/a", "/b", 3), update("r", "/b", "/c", 4)},
+			want:   []string{"UPDATE /a /c 3"},
+		},
+		{
+			name:   "update then delete",
+			events: []Event{update("r", "/a", "/b", 3), del("r", "/b", 4)},
+			want:   []string{"DELETE /a  3"},
+		},
+		{
+			name:   "delete then create then delete",
+			events: []Event{del("r", "/a", 3), create("r", "/b"), del("r", "/b", 0)},
+			want:   []string{"DELETE /a  3"},
+		},
+		{
+			name:   "surviving events are sorted",
+			events: []Event{create("b", "/b"), del("a", "/a", 1), create("a", "/a2"), del("c", "/c", 2)},
+			want:   []string{"DELETE /c  2", "UPDATE /a /a2 1", "CREATE  /b 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := CompactEvents(tt.events)
+			if err != nil {
+				t.Fatalf("failed to compact events: %v", err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, fmt.Sprintf("%s %s %s %d",
+					event.Type, uriOf(event.OldValue), uriOf(event.NewValue), event.ModRevision))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Batches without repeated resources are left alone
+	events := []Event{create("b", "/b"), create("a", "/a")}
+	compacted, err := CompactEvents(events)
+	if err != nil {
+		t.Fatalf("failed to compact events: %v", err)
+	}
+	if len(compacted) != 2 || compacted[0].ResourceID != "b" {
+		t.Errorf("expected the events unchanged, got %v", compacted)
+	}
+
+	// Changes are recomputed for the merged update
+	withChanges := []Event{update("r", "/a", "/b", 3), update("r", "/b", "/c", 4)}
+	if err := populateChanges(withChanges); err != nil {
+		t.Fatalf("failed to populate changes: %v", err)
+	}
+	compacted, err = CompactEvents(withChanges)
+	if err != nil {
+		t.Fatalf("failed to compact events: %v", err)
+	}
+	change, ok := compacted[0].Changes["/uris"]
+	if !ok || fmt.Sprint(change.Old, change.New) != "[/a] [/c]" {
+		t.Errorf("expected the change of /uris from /a to /c, got %v", compacted[0].Changes)
+	}
+}
@@ -0,0 +1,54 @@
+package kine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Classes of the errors returned by the package, to be told apart with
+// errors.Is. Returned errors wrap one of them along with the identity of
+// the resource at fault, callers can then reject bad input without retrying
+// it while retrying the rest.
+var (
+	// ErrInvalidInput is wrapped by errors of resources that cannot be
+	// synced as they are: missing or invalid fields, unsupported features,
+	// invalid plugin configurations or unknown resource types
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrTransferFailed is wrapped by errors of the conversion of ADC
+	// resources to Kine resources, along with the class of their cause
+	ErrTransferFailed = errors.New("failed to transfer")
+	// ErrDiffFailed is wrapped by errors of Differ.Diff
+	ErrDiffFailed = errors.New("failed to diff resources")
+	// ErrConflict is wrapped by errors of resources claiming an ID owned by
+	// another: ownership conflicts, duplicate and colliding IDs
+	ErrConflict = errors.New("conflict")
+)
+
+// invalidInput classifies an error of the resources being transferred as
+// invalid input, unless it is already classified
+func invalidInput(err error) error {
+	if err == nil || errors.Is(err, ErrInvalidInput) || errors.Is(err, ErrConflict) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+}
+
+func (e *OwnershipConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *DuplicateIDError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *IDCollisionError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *PluginConfigError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func (e *InvalidHostError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
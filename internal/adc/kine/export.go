@@ -0,0 +1,315 @@
+package kine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// ExportResources converts the cached Kine resources back to ADC resources,
+// the reverse of TransferResources. Routes are nested under their service
+// and upstreams referenced by upstream_id are inlined, as are the shared
+// upstreams referenced by traffic-split configs. Standalone upstreams are
+// not linked to a service and are left out. Secrets are redacted unless
+// the IncludeSecrets option is given.
+func ExportResources(cache Cache, opts ...ListOption) (*adc.Resources, error) {
+	listOpts := (&ListOptions{}).ApplyOptions(opts)
+
+	services, err := cache.ListServices(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	routes, err := cache.ListRoutes(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	ssls, err := cache.ListSSL(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssls: %w", err)
+	}
+	globalRules, err := cache.ListGlobalRules(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list global rules: %w", err)
+	}
+	protos, err := cache.ListProtos(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list protos: %w", err)
+	}
+	pluginMetadata, err := cache.ListPluginMetadata(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugin metadata: %w", err)
+	}
+
+	routesByService := make(map[string][]*Route)
+	for _, route := range routes {
+		if route.ServiceID != nil {
+			routesByService[*route.ServiceID] = append(routesByService[*route.ServiceID], route)
+		}
+	}
+
+	resources := &adc.Resources{}
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+	for _, service := range services {
+		upstream := service.Upstream
+		if upstream == nil && service.UpstreamID != nil {
+			// Shared upstreams carry no labels, look them up unfiltered
+			upstream, err = cache.GetUpstream(*service.UpstreamID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get upstream %s of service %s: %w",
+					*service.UpstreamID, service.ID, err)
+			}
+		}
+		plugins, err := inlineSplitUpstreams(exportPlugins(service.Plugins), cache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export plugins of service %s: %w", service.ID, err)
+		}
+		adcService := &adc.Service{
+			Metadata: exportMetadata(service.Metadata),
+			Hosts:    copyStringSlice(service.Hosts),
+			Plugins:  plugins,
+			Upstream: exportUpstream(upstream),
+
+			EnableWebsocket: copyBool(service.EnableWebsocket),
+		}
+		serviceRoutes := routesByService[service.ID]
+		sort.Slice(serviceRoutes, func(i, j int) bool { return serviceRoutes[i].ID < serviceRoutes[j].ID })
+		for _, route := range serviceRoutes {
+			adcRoute := exportRoute(route)
+			adcRoute.Plugins, err = inlineSplitUpstreams(adcRoute.Plugins, cache)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export plugins of route %s: %w", route.ID, err)
+			}
+			adcService.Routes = append(adcService.Routes, adcRoute)
+		}
+		resources.Services = append(resources.Services, adcService)
+	}
+
+	sort.Slice(ssls, func(i, j int) bool { return ssls[i].ID < ssls[j].ID })
+	for _, ssl := range ssls {
+		key := ssl.Key
+		if !listOpts.IncludeSecrets && key != "" {
+			key = RedactedValue
+		}
+		sslType := adc.Server
+		resources.SSLs = append(resources.SSLs, &adc.SSL{
+			Metadata:     exportMetadata(ssl.Metadata),
+			Certificates: []adc.Certificate{{Certificate: ssl.Cert, Key: key}},
+			Snis:         copyStringSlice(ssl.SNIs),
+			Type:         &sslType,
+		})
+	}
+
+	if len(globalRules) > 0 {
+		resources.GlobalRules = make(adc.GlobalRule, len(globalRules))
+		for _, globalRule := range globalRules {
+			for name, config := range exportPlugins(globalRule.Plugins) {
+				resources.GlobalRules[name] = config
+			}
+		}
+	}
+
+	sort.Slice(protos, func(i, j int) bool { return protos[i].ID < protos[j].ID })
+	for _, proto := range protos {
+		resources.Protos = append(resources.Protos, &adc.Proto{
+			Metadata: exportMetadata(proto.Metadata),
+			Content:  proto.Content,
+		})
+	}
+
+	if len(pluginMetadata) > 0 {
+		resources.PluginMetadata = make(adc.PluginMetadata, len(pluginMetadata))
+		for _, metadata := range pluginMetadata {
+			resources.PluginMetadata[metadata.ID] = map[string]any(exportPlugins(metadata.Config))
+		}
+	}
+
+	return resources, nil
+}
+
+// ExportYAML writes the cached resources as an ADC YAML document, in the
+// format of adc dump. Resources are sorted by ID and object keys by name,
+// so that unchanged state always exports identically.
+func ExportYAML(cache Cache, w io.Writer, opts ...ListOption) error {
+	resources, err := ExportResources(cache, opts...)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(resources)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resources: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func exportMetadata(metadata adc.Metadata) adc.Metadata {
+	return adc.Metadata{
+		ID:     metadata.ID,
+		Name:   metadata.Name,
+		Desc:   metadata.Desc,
+		Labels: copyLabels(metadata.Labels),
+	}
+}
+
+func exportPlugins(plugins map[string]any) adc.Plugins {
+	if plugins == nil {
+		return nil
+	}
+	exported := make(adc.Plugins, len(plugins))
+	for name, config := range plugins {
+		exported[name] = config
+	}
+	return exported
+}
+
+func exportRoute(route *Route) *adc.Route {
+	adcRoute := &adc.Route{
+		Metadata: exportMetadata(route.Metadata),
+		Hosts:    copyStringSlice(route.Hosts),
+		Plugins:  exportPlugins(route.Plugins),
+		Timeout:  exportTimeout(route.Timeout),
+		Uris:     copyStringSlice(route.URIs),
+		Vars:     copyVars(route.Vars),
+	}
+	if route.URI != nil {
+		adcRoute.Uris = append(adcRoute.Uris, *route.URI)
+	}
+	if route.Host != nil {
+		adcRoute.Hosts = append(adcRoute.Hosts, *route.Host)
+	}
+	for _, method := range route.Methods {
+		adcRoute.Methods = append(adcRoute.Methods, string(method))
+	}
+	if route.Priority != 0 {
+		priority := int64(route.Priority)
+		adcRoute.Priority = &priority
+	}
+	if route.Status != nil {
+		status := int64(*route.Status)
+		adcRoute.Status = &status
+	}
+	adcRoute.Upstream = exportUpstream(route.Upstream)
+	if route.UpstreamID != nil {
+		adcRoute.UpstreamID = *route.UpstreamID
+	}
+	return adcRoute
+}
+
+func exportUpstream(upstream *Upstream) *adc.Upstream {
+	if upstream == nil {
+		return nil
+	}
+	adcUpstream := &adc.Upstream{
+		Metadata: adc.Metadata{
+			ID:   upstream.ID,
+			Name: upstream.Name,
+			Desc: upstream.Desc,
+		},
+		Nodes:    exportNodes(upstream.Nodes),
+		Type:     adc.UpstreamType(upstream.Type),
+		HashOn:   string(upstream.HashOn),
+		Key:      upstream.Key,
+		Scheme:   string(upstream.Scheme),
+		PassHost: string(upstream.PassHost),
+		Timeout:  exportTimeout(upstream.Timeout),
+		Checks:   exportHealthCheck(upstream.Checks),
+	}
+	if upstream.Retries != nil {
+		retries := int64(*upstream.Retries)
+		adcUpstream.Retries = &retries
+	}
+	if upstream.RetryTimeout != nil {
+		retryTimeout := float64(*upstream.RetryTimeout)
+		adcUpstream.RetryTimeout = &retryTimeout
+	}
+	if upstream.UpstreamHost != nil {
+		adcUpstream.UpstreamHost = *upstream.UpstreamHost
+	}
+	if pool := upstream.KeepalivePool; pool != nil {
+		adcUpstream.KeepalivePool = &adc.UpstreamKeepalivePool{
+			Size:        int64(pool.Size),
+			IdleTimeout: pool.IdleTimeout,
+			Requests:    int64(pool.Requests),
+		}
+	}
+	return adcUpstream
+}
+
+// exportNodes converts "host:port" node keys back to ADC nodes sorted by key
+func exportNodes(nodes map[string]uint32) adc.UpstreamNodes {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	adcNodes := make(adc.UpstreamNodes, 0, len(nodes))
+	for _, key := range keys {
+		host, port := key, 0
+		if i := strings.LastIndex(key, ":"); i >= 0 {
+			if p, err := strconv.Atoi(key[i+1:]); err == nil {
+				host, port = key[:i], p
+			}
+		}
+		adcNodes = append(adcNodes, adc.UpstreamNode{Host: host, Port: port, Weight: int(nodes[key])})
+	}
+	return adcNodes
+}
+
+// exportTimeout converts a Kine timeout to ADC
+func exportTimeout(timeout *Timeout) *adc.Timeout {
+	if timeout == nil {
+		return nil
+	}
+	return &adc.Timeout{
+		Connect: timeout.Connect,
+		Send:    timeout.Send,
+		Read:    timeout.Read,
+	}
+}
+
+func exportHealthCheck(check *HealthCheck) *adc.UpstreamHealthCheck {
+	if check == nil || check.Active == nil {
+		return nil
+	}
+	active := check.Active
+	adcActive := &adc.UpstreamActiveHealthCheck{
+		Type:               string(active.Type),
+		Timeout:            int(active.Timeout),
+		HTTPPath:           active.HTTPPath,
+		HTTPRequestHeaders: copyStringSlice(active.ReqHeaders),
+	}
+	if active.Host != nil {
+		adcActive.Host = *active.Host
+	}
+	if active.Port != nil {
+		adcActive.Port = int32(*active.Port)
+	}
+	if active.Type == ActiveCheckTypeHTTPS {
+		if active.HTTPSVerifyCertificate != nil {
+			verify := *active.HTTPSVerifyCertificate
+			adcActive.HTTPSVerifyCert = &verify
+		}
+		if active.HTTPSSni != nil {
+			adcActive.HTTPSSni = *active.HTTPSSni
+		}
+	}
+	if active.Healthy != nil {
+		adcActive.Healthy.Interval = int(active.Healthy.Interval)
+		adcActive.Healthy.Successes = int(active.Healthy.Successes)
+		for _, status := range active.Healthy.HTTPStatuses {
+			adcActive.Healthy.HTTPStatuses = append(adcActive.Healthy.HTTPStatuses, int(status))
+		}
+	}
+	if active.Unhealthy != nil {
+		adcActive.Unhealthy.HTTPFailures = int(active.Unhealthy.HTTPFailures)
+		adcActive.Unhealthy.TCPFailures = int(active.Unhealthy.TCPFailures)
+	}
+	return &adc.UpstreamHealthCheck{Active: adcActive}
+}
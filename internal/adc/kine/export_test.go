@@ -0,0 +1,99 @@
+package kine
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestExportYAML(t *testing.T) {
+	labels := map[string]string{"k8s/kind": "Ingress", "k8s/namespace": "default", "k8s/name": "ing"}
+	retries := int64(2)
+	priority := int64(10)
+	resources := &adc.Resources{
+		Services: []*adc.Service{{
+			Metadata: adc.Metadata{ID: "svc-1", Name: "svc-1", Labels: labels},
+			Hosts:    []string{"example.com"},
+			Plugins:  adc.Plugins{"cors": map[string]any{}},
+			Upstream: &adc.Upstream{
+				Nodes:   adc.UpstreamNodes{{Host: "10.0.0.2", Port: 80, Weight: 1}, {Host: "10.0.0.1", Port: 8080, Weight: 2}},
+				Type:    adc.Roundrobin,
+				Retries: &retries,
+				Timeout: &adc.Timeout{Connect: 1, Send: 2, Read: 3},
+			},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{ID: "route-b", Name: "route-b", Labels: labels}, Uris: []string{"/b"}, Methods: []string{"GET"}},
+				{Metadata: adc.Metadata{ID: "route-a", Name: "route-a", Labels: labels}, Uris: []string{"/a"}, Priority: &priority},
+			},
+		}},
+		SSLs: []*adc.SSL{{
+			Metadata:     adc.Metadata{ID: "ssl-1", Name: "tls", Labels: labels},
+			Certificates: []adc.Certificate{{Certificate: "cert-data", Key: "private-key"}},
+			Snis:         []string{"example.com"},
+		}},
+		GlobalRules: adc.GlobalRule{"prometheus": map[string]any{"prefer_name": true}},
+	}
+	transferred, err := TransferResources(resources)
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	objs := []any{transferred.Services[0], transferred.SSLs[0], transferred.GlobalRules[0]}
+	for _, route := range transferred.Routes {
+		objs = append(objs, route)
+	}
+	for _, obj := range objs {
+		if err := cache.Insert(obj); err != nil {
+			t.Fatalf("failed to insert %T: %v", obj, err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := ExportYAML(cache, &out); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if strings.Contains(out.String(), "private-key") || !strings.Contains(out.String(), RedactedValue) {
+		t.Errorf("expected the ssl key to be redacted:\n%s", out.String())
+	}
+	var again bytes.Buffer
+	if err := ExportYAML(cache, &again); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if out.String() != again.String() {
+		t.Errorf("expected stable output:\n%s\n%s", out.String(), again.String())
+	}
+
+	// The export transfers back to the cached resources
+	out.Reset()
+	if err := ExportYAML(cache, &out, IncludeSecrets()); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	var exported adc.Resources
+	if err := yaml.Unmarshal(out.Bytes(), &exported); err != nil {
+		t.Fatalf("failed to parse export: %v\n%s", err, out.String())
+	}
+	if len(exported.Services) != 1 || len(exported.Services[0].Routes) != 2 || exported.Services[0].Routes[0].ID != "route-a" {
+		t.Fatalf("expected routes nested and sorted under their service, got %+v", exported.Services)
+	}
+	roundTrip, err := TransferResources(&exported)
+	if err != nil {
+		t.Fatalf("failed to transfer export: %v", err)
+	}
+	// Exported routes are sorted by ID
+	sort.Slice(transferred.Routes, func(i, j int) bool { return transferred.Routes[i].ID < transferred.Routes[j].ID })
+	if !reflect.DeepEqual(roundTrip.Routes, transferred.Routes) ||
+		!reflect.DeepEqual(roundTrip.Services, transferred.Services) ||
+		!reflect.DeepEqual(roundTrip.SSLs, transferred.SSLs) ||
+		!reflect.DeepEqual(roundTrip.GlobalRules, transferred.GlobalRules) {
+		t.Errorf("round trip differs:\n got: %+v\nwant: %+v", roundTrip, transferred)
+	}
+}
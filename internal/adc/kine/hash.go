@@ -0,0 +1,65 @@
+package kine
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// ContentHash hashes the JSON encoding of a kine object. Objects with the
+// same hash are equal, so the differ only compares objects whose hash
+// differs from their cached copy's, and the cache keeps the revision of
+// objects re-inserted with the same hash. Kine objects hold no volatile
+// fields such as timestamps; revisions are kept beside the objects.
+//
+// The encoding is canonical without the round trip of CanonicalJSON: kine
+// objects are structs, whose fields encode in declaration order, and maps,
+// whose keys encode sorted. It is streamed into the hash.
+func ContentHash(obj any) ([]byte, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(obj); err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// hashResources computes the content hash of each transferred object by
+// resource type and ID. Objects failing to encode get no hash and are
+// always compared.
+func hashResources(r *TransferredResources) map[ResourceType]map[string][]byte {
+	hashes := make(map[ResourceType]map[string][]byte, len(ResourceTypes))
+	add := func(resourceType ResourceType, id string, obj any) {
+		hash, err := ContentHash(obj)
+		if err != nil {
+			// Drop the hash of a previous object sharing the ID
+			delete(hashes[resourceType], id)
+			return
+		}
+		if hashes[resourceType] == nil {
+			hashes[resourceType] = make(map[string][]byte)
+		}
+		hashes[resourceType][id] = hash
+	}
+	for _, route := range r.Routes {
+		add(ResourceTypeRoute, route.ID, route)
+	}
+	for _, service := range r.Services {
+		add(ResourceTypeService, service.ID, service)
+	}
+	for _, upstream := range r.Upstreams {
+		add(ResourceTypeUpstream, upstream.ID, upstream)
+	}
+	for _, ssl := range r.SSLs {
+		add(ResourceTypeSSL, ssl.ID, ssl)
+	}
+	for _, rule := range r.GlobalRules {
+		add(ResourceTypeGlobalRule, rule.ID, rule)
+	}
+	for _, proto := range r.Protos {
+		add(ResourceTypeProto, proto.ID, proto)
+	}
+	for _, metadata := range r.PluginMetadata {
+		add(ResourceTypePluginMetadata, metadata.ID, metadata)
+	}
+	return hashes
+}
@@ -0,0 +1,136 @@
+package kine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+// randomRoute builds a route from small value sets, so that random routes
+// are often equal or differ by a single field
+func randomRoute(rng *rand.Rand, id string) *Route {
+	route := &Route{
+		Metadata: adc.Metadata{
+			ID:   id,
+			Name: id,
+			Labels: map[string]string{
+				label.LabelKind:      "Ingress",
+				label.LabelNamespace: "default",
+				label.LabelName:      []string{"a", "b"}[rng.Intn(2)],
+			},
+		},
+		URIs:     [][]string{{"/"}, {"/a"}, {"/a", "/b"}}[rng.Intn(3)],
+		Priority: uint32(rng.Intn(2)),
+	}
+	if rng.Intn(2) == 0 {
+		route.Hosts = []string{exampleHost}
+	}
+	if rng.Intn(2) == 0 {
+		route.Methods = []Method{MethodGET}
+	}
+	switch rng.Intn(3) {
+	case 0:
+		status := RouteStatusEnabled
+		route.Status = &status
+	case 1:
+		status := RouteStatusDisabled
+		route.Status = &status
+	}
+	if rng.Intn(2) == 0 {
+		// Decoded JSON numbers are float64, desired ones are often ints
+		count := []any{10, 10.0, 20}[rng.Intn(3)]
+		route.Plugins = map[string]any{
+			"limit-count": map[string]any{"count": count, "time_window": 60},
+		}
+	}
+	if rng.Intn(2) == 0 {
+		route.Timeout = &Timeout{Connect: float64(rng.Intn(2) + 1)}
+	}
+	return route
+}
+
+func TestContentHashMatchesEqual(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var equalHashes, equalByCompare int
+	for i := 0; i < 2000; i++ {
+		a, b := randomRoute(rng, "route"), randomRoute(rng, "route")
+		hashA, err := ContentHash(a)
+		if err != nil {
+			t.Fatalf("failed to hash route: %v", err)
+		}
+		hashB, err := ContentHash(b)
+		if err != nil {
+			t.Fatalf("failed to hash route: %v", err)
+		}
+		hashCopy, err := ContentHash(a.DeepCopy())
+		if err != nil {
+			t.Fatalf("failed to hash route: %v", err)
+		}
+		if !bytes.Equal(hashA, hashCopy) {
+			t.Fatalf("copies of %+v hash differently", a)
+		}
+
+		equal := areRoutesEqual(a, b)
+		if bytes.Equal(hashA, hashB) {
+			equalHashes++
+			if !equal {
+				t.Fatalf("routes hash alike but differ:\n%+v\n%+v", a, b)
+			}
+		} else if equal {
+			equalByCompare++
+		}
+	}
+	// Both paths of the differ must have been exercised
+	if equalHashes == 0 || equalByCompare == 0 {
+		t.Fatalf("expected equal hashes and equal routes hashing differently, got %d and %d",
+			equalHashes, equalByCompare)
+	}
+}
+
+func TestDiffer_HashesMatchComparison(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for round := 0; round < 20; round++ {
+		cache, err := NewMemDBCache()
+		if err != nil {
+			t.Fatalf("failed to create cache: %v", err)
+		}
+		desired := &TransferredResources{}
+		for i := 0; i < 50; i++ {
+			id := fmt.Sprintf("route-%d", i)
+			if rng.Intn(4) > 0 {
+				if err := cache.InsertRoute(randomRoute(rng, id)); err != nil {
+					t.Fatalf("failed to insert route: %v", err)
+				}
+			}
+			if rng.Intn(4) > 0 {
+				desired.Routes = append(desired.Routes, randomRoute(rng, id))
+			}
+		}
+
+		diff := func(hashes map[ResourceType]map[string][]byte) []string {
+			t.Helper()
+			resources := *desired
+			resources.Hashes = hashes
+			events, err := NewDiffer(cache).Diff(context.Background(), &resources, &DiffOptions{})
+			if err != nil {
+				t.Fatalf("failed to diff: %v", err)
+			}
+			got := make([]string, 0, len(events))
+			for _, event := range events {
+				got = append(got, string(event.Type)+" "+event.ResourceID)
+			}
+			slices.Sort(got)
+			return got
+		}
+		compared, hashed := diff(nil), diff(hashResources(desired))
+		if !slices.Equal(compared, hashed) {
+			t.Fatalf("round %d: hashed diff %v differs from compared diff %v", round, hashed, compared)
+		}
+	}
+}
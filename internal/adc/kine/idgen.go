@@ -0,0 +1,106 @@
+package kine
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// IDGenerator derives a resource ID from the hash input of a resource
+// without an explicit ID, such as the name of a service. Generated IDs must
+// match ID_REGEX and APISIX caps IDs at 64 characters.
+type IDGenerator interface {
+	GenerateID(input string) string
+}
+
+// IDGeneratorFunc adapts a function to the IDGenerator interface
+type IDGeneratorFunc func(input string) string
+
+func (f IDGeneratorFunc) GenerateID(input string) string {
+	return f(input)
+}
+
+var (
+	// SHA1IDGenerator generates the hex SHA-1 of the input, the default
+	SHA1IDGenerator IDGenerator = IDGeneratorFunc(sha1Hash)
+	// SHA256IDGenerator generates the hex SHA-256 of the input, 64
+	// characters long
+	SHA256IDGenerator IDGenerator = IDGeneratorFunc(sha256Hash)
+)
+
+// sha1Hash generates SHA1 hash of the input string
+func sha1Hash(input string) string {
+	sum := sha1.Sum([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256Hash generates SHA256 hash of the input string
+func sha256Hash(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// IDCollisionError is returned when two distinct hash inputs generate the
+// same ID during a transfer, which would make one resource overwrite the
+// other
+type IDCollisionError struct {
+	ID     string
+	First  string
+	Second string
+}
+
+func (e *IDCollisionError) Error() string {
+	return fmt.Sprintf("generated id %s collides: both %q and %q map to it", e.ID, e.First, e.Second)
+}
+
+// idRegistry remembers the hash input of each generated ID
+type idRegistry struct {
+	inputs    map[string]string
+	collision error
+}
+
+func newIDRegistry() *idRegistry {
+	return &idRegistry{inputs: make(map[string]string)}
+}
+
+// record registers the input of a generated ID, remembering the first
+// collision
+func (r *idRegistry) record(id, input string) {
+	first, ok := r.inputs[id]
+	if !ok {
+		r.inputs[id] = input
+		return
+	}
+	if first != input && r.collision == nil {
+		r.collision = &IDCollisionError{ID: id, First: first, Second: input}
+	}
+}
+
+// takeCollision returns and clears the collision recorded since the last call
+func (r *idRegistry) takeCollision() error {
+	err := r.collision
+	r.collision = nil
+	return err
+}
+
+// untracked returns a copy of o generating IDs without recording them, to
+// regenerate IDs already checked for collisions
+func (o *TransferOptions) untracked() *TransferOptions {
+	untracked := *o
+	untracked.ids = nil
+	return &untracked
+}
+
+// generateID generates the ID of the given hash input
+func (o *TransferOptions) generateID(input string) string {
+	generator := o.IDGenerator
+	if generator == nil {
+		generator = SHA1IDGenerator
+	}
+	id := generator.GenerateID(input)
+	if o.ids != nil {
+		o.ids.record(id, input)
+	}
+	return id
+}
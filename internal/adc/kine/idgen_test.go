@@ -0,0 +1,143 @@
+package kine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestIDGenerators(t *testing.T) {
+	resources := &adc.Resources{
+		Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Metadata: adc.Metadata{Name: "upstream"},
+				Nodes:    adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+			},
+			Routes: []*adc.Route{{Metadata: adc.Metadata{Name: "route"}, Uris: []string{"/"}}},
+		}},
+		SSLs: []*adc.SSL{{
+			Metadata:     adc.Metadata{Name: "ssl"},
+			Certificates: []adc.Certificate{{Certificate: "cert", Key: "key"}},
+			Snis:         []string{exampleHost},
+		}},
+	}
+
+	tests := []struct {
+		name                          string
+		opts                          []TransferOption
+		service, route, upstream, ssl string
+	}{
+		{
+			// The default must never change, it would replace every resource
+			name:     "default sha1",
+			service:  "a0089182becd921781d5ba1e58fa4d129b24060f",
+			route:    "93e777bee6d995ba278e80670b2e86f742c9611e",
+			upstream: "fd54d5aa0112760b77af49308da7e6c75ab1adf2",
+			ssl:      "20a24593f82e573953076a0eeaf8f3cfb817a534",
+		},
+		{
+			name:     "sha256",
+			opts:     []TransferOption{UseIDGenerator(SHA256IDGenerator)},
+			service:  "348c658682ae8701d3e9d21f191872491cf15e6acbb1681770b1cb787c1cf7ff",
+			route:    "31e85723ff00bb2ede6b3e3e5d01d2471e3824c9717b596a16cf53f99b4e364a",
+			upstream: "1581e27de87bffae0bd4d745cd7964e68528d7a83e2e4c259a782d275df6f558",
+			ssl:      "dc5a2e46e9ef93ecfa28d22ce4a3bca1765a20af1e7336b70bd5cab4e5590d87",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TransferResources(resources, tt.opts...)
+			if err != nil {
+				t.Fatalf("failed to transfer resources: %v", err)
+			}
+			if got := result.Services[0].ID; got != tt.service {
+				t.Errorf("service id = %s, want %s", got, tt.service)
+			}
+			if got := result.Routes[0].ID; got != tt.route {
+				t.Errorf("route id = %s, want %s", got, tt.route)
+			}
+			if got := *result.Routes[0].ServiceID; got != tt.service {
+				t.Errorf("route service id = %s, want %s", got, tt.service)
+			}
+			if got := result.Services[0].Upstream.ID; got != tt.upstream {
+				t.Errorf("upstream id = %s, want %s", got, tt.upstream)
+			}
+			if got := result.SSLs[0].ID; got != tt.ssl {
+				t.Errorf("ssl id = %s, want %s", got, tt.ssl)
+			}
+		})
+	}
+}
+
+func TestTransferIDCollision(t *testing.T) {
+	// Keeping only the first letter makes distinct names collide
+	firstLetter := UseIDGenerator(IDGeneratorFunc(func(input string) string { return input[:1] }))
+	resources := &adc.Resources{}
+	for _, name := range []string{"alpha", "avocado", "beta"} {
+		resources.Services = append(resources.Services, &adc.Service{
+			Metadata: adc.Metadata{Name: name},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}}},
+		})
+	}
+
+	_, err := TransferResources(resources, firstLetter)
+	var collision *IDCollisionError
+	if !errors.As(err, &collision) {
+		t.Fatalf("expected IDCollisionError, got %v", err)
+	}
+	if !errors.Is(err, ErrTransferFailed) || !errors.Is(err, ErrConflict) || errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected a transfer error of conflict, got %v", err)
+	}
+	if collision.ID != "a" || collision.First != "alpha" || collision.Second != "avocado" {
+		t.Errorf("unexpected collision %+v", collision)
+	}
+
+	result, err := TransferResources(resources, firstLetter, BestEffort())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(result.Services) != 2 || len(result.Warnings) != 1 || result.Warnings[0].Name != "avocado" {
+		t.Errorf("expected the colliding service to be skipped, got %+v", result)
+	}
+
+	// Services transferred twice keep their ID without colliding
+	transferrer := NewTransferrer()
+	for range 2 {
+		if err := transferrer.AddService(resources.Services[0]); err != nil {
+			t.Fatalf("failed to add service: %v", err)
+		}
+	}
+}
+
+func TestSharedUpstreamIDGenerator(t *testing.T) {
+	resources := &adc.Resources{Services: []*adc.Service{canaryService(canarySplit())}}
+	result, err := TransferResources(resources, SharedUpstreams(), SplitUpstreams(), UseIDGenerator(SHA256IDGenerator))
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	// The shared service upstream and the split canary upstream
+	if len(result.Upstreams) != 2 {
+		t.Fatalf("expected 2 shared upstreams, got %d", len(result.Upstreams))
+	}
+	for _, upstream := range result.Upstreams {
+		if len(upstream.ID) != 64 {
+			t.Errorf("expected a sha256 id for shared upstream %s", upstream.ID)
+		}
+	}
+
+	// Shared upstream IDs are checked for collisions too
+	sameShared := UseIDGenerator(IDGeneratorFunc(func(input string) string {
+		if strings.HasPrefix(input, "{") {
+			return "shared"
+		}
+		return sha1Hash(input)
+	}))
+	_, err = TransferResources(resources, SharedUpstreams(), SplitUpstreams(), sameShared)
+	var collision *IDCollisionError
+	if !errors.As(err, &collision) {
+		t.Errorf("expected an IDCollisionError, got %v", err)
+	}
+}
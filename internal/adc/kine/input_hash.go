@@ -0,0 +1,79 @@
+package kine
+
+import (
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// inputHashTable is the memdb table and bolt bucket holding the input hash
+// of the last sync of every owner, keyed by the owner selector
+const inputHashTable = "input_hash"
+
+// inputHash records the opaque hash of the input the cached resources of an
+// owner were last synced from
+type inputHash struct {
+	Owner string
+	Hash  string
+}
+
+// inputHashKey returns the key of the input hash record of the owner
+// selected by selector, normalized the way the label index is
+func inputHashKey(selector KindLabelSelector) string {
+	return strings.ToLower(strings.TrimSpace(selector.Kind)) + "/" +
+		strings.TrimSpace(selector.Namespace) + "/" + strings.TrimSpace(selector.Name)
+}
+
+func (c *dbCache) SetInputHash(selector KindLabelSelector, hash string) error {
+	txn := c.db.Txn(true)
+	defer txn.Abort()
+	key := inputHashKey(selector)
+	if hash == "" {
+		if _, err := txn.DeleteAll(inputHashTable, "id", key); err != nil {
+			return err
+		}
+	} else if err := txn.Insert(inputHashTable, &inputHash{Owner: key, Hash: hash}); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (c *dbCache) InputHash(selector KindLabelSelector) (string, error) {
+	txn := c.db.Txn(false)
+	defer txn.Abort()
+	obj, err := txn.First(inputHashTable, "id", inputHashKey(selector))
+	if err != nil || obj == nil {
+		return "", err
+	}
+	return obj.(*inputHash).Hash, nil
+}
+
+func (c *boltCache) SetInputHash(selector KindLabelSelector, hash string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(inputHashTable))
+		key := []byte(inputHashKey(selector))
+		if hash == "" {
+			return bucket.Delete(key)
+		}
+		return bucket.Put(key, []byte(hash))
+	})
+}
+
+func (c *boltCache) InputHash(selector KindLabelSelector) (string, error) {
+	var hash string
+	err := c.db.View(func(tx *bolt.Tx) error {
+		hash = string(tx.Bucket([]byte(inputHashTable)).Get([]byte(inputHashKey(selector))))
+		return nil
+	})
+	return hash, err
+}
+
+// resetBoltInputHashes forgets the input hashes of all owners
+func resetBoltInputHashes(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket([]byte(inputHashTable)); err != nil {
+		return err
+	}
+	_, err := tx.CreateBucket([]byte(inputHashTable))
+	return err
+}
@@ -0,0 +1,30 @@
+package kine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+// verifyUnmutated fails when a stored object no longer has the content hash
+// recorded when it was inserted, which happens when the caller of
+// InsertOwned mutates the object afterwards. Only race builds check it, the
+// hash costs a marshal per read.
+func verifyUnmutated(txn *memdb.Txn, table, id string, obj any) error {
+	if obj == nil {
+		return nil
+	}
+	record, err := txn.First(revisionTable, "id", revisionKey(table, id))
+	if err != nil || record == nil {
+		return err
+	}
+	hash, err := ContentHash(obj)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, record.(*objectRevision).Hash) {
+		return fmt.Errorf("cached %s %s was mutated after it was inserted", table, id)
+	}
+	return nil
+}
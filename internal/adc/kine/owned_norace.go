@@ -0,0 +1,7 @@
+//go:build !race
+
+package kine
+
+// checkOwnedMutations makes the memdb cache detect objects mutated after
+// InsertOwned handed them over
+const checkOwnedMutations = false
@@ -0,0 +1,38 @@
+//go:build race
+
+package kine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCacheInsertOwnedMutationDetection(t *testing.T) {
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	route := benchmarkRoutes(1)[0]
+	if err := cache.InsertOwned(route); err != nil {
+		t.Fatalf("Failed to insert route: %v", err)
+	}
+
+	// The caller broke the contract and kept mutating the route
+	route.URIs = append(route.URIs, "/mutated")
+	if _, err := cache.GetRoute(route.ID); err == nil || !strings.Contains(err.Error(), "mutated") {
+		t.Errorf("Expected the mutation to be detected on read, got %v", err)
+	}
+	if err := cache.InsertRoute(benchmarkRoutes(1)[0]); err == nil || !strings.Contains(err.Error(), "mutated") {
+		t.Errorf("Expected the mutation to be detected on write, got %v", err)
+	}
+
+	// Copied inserts are immune
+	copied := benchmarkRoutes(2)[1]
+	if err := cache.InsertRoute(copied); err != nil {
+		t.Fatalf("Failed to insert route: %v", err)
+	}
+	copied.URIs = nil
+	if _, err := cache.GetRoute(copied.ID); err != nil {
+		t.Errorf("Expected a copied route to be unaffected, got %v", err)
+	}
+}
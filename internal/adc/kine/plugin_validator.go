@@ -0,0 +1,177 @@
+package kine
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// PluginValidator checks plugin configurations during the transfer, so that
+// invalid ones fail the sync instead of the data plane
+type PluginValidator interface {
+	// ValidatePlugin returns an error if the configuration of the named
+	// plugin is invalid, joining a *PluginFieldError per invalid field
+	ValidatePlugin(name string, config any) error
+}
+
+// NoopPluginValidator accepts every plugin configuration, the default
+type NoopPluginValidator struct{}
+
+func (NoopPluginValidator) ValidatePlugin(string, any) error {
+	return nil
+}
+
+// PluginFieldError reports an invalid field of a plugin configuration
+type PluginFieldError struct {
+	// Pointer is the JSON pointer of the field in the plugin configuration,
+	// empty for the configuration itself
+	Pointer string
+	Reason  string
+}
+
+func (e *PluginFieldError) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Sprintf("%s: %s", pointer, e.Reason)
+}
+
+// PluginConfigError reports an invalid plugin configuration of a resource
+type PluginConfigError struct {
+	ResourceType ResourceType
+	// ResourceName is the name of the resource, or its ID when unnamed
+	ResourceName string
+	Plugin       string
+	Err          error
+}
+
+func (e *PluginConfigError) Error() string {
+	return fmt.Sprintf("invalid %s config of %s %s: %v", e.Plugin, e.ResourceType, e.ResourceName, e.Err)
+}
+
+func (e *PluginConfigError) Unwrap() error {
+	return e.Err
+}
+
+//go:embed schemas/*.json
+var pluginSchemas embed.FS
+
+// DefaultPluginSchemas returns the JSON schemas shipped with the package by
+// plugin name: limit-count, limit-req, cors and proxy-rewrite
+func DefaultPluginSchemas() map[string][]byte {
+	schemas, err := readPluginSchemas(pluginSchemas, "schemas")
+	if err != nil {
+		// The schemas are embedded, reading them cannot fail
+		panic(err)
+	}
+	return schemas
+}
+
+// LoadPluginSchemas reads the JSON schemas of dir by plugin name, from
+// files named after the plugin with a .json extension
+func LoadPluginSchemas(dir string) (map[string][]byte, error) {
+	return readPluginSchemas(os.DirFS(dir), ".")
+}
+
+func readPluginSchemas(fsys fs.FS, dir string) (map[string][]byte, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string][]byte, len(files))
+	for _, file := range files {
+		schema, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plugin schema: %w", err)
+		}
+		schemas[strings.TrimSuffix(path.Base(file), ".json")] = schema
+	}
+	return schemas, nil
+}
+
+// SchemaPluginValidator validates plugin configurations against JSON
+// schemas by plugin name. Plugins without a schema are accepted.
+type SchemaPluginValidator struct {
+	schemas map[string]*gojsonschema.Schema
+}
+
+// NewSchemaPluginValidator compiles the JSON schemas of plugins by name
+func NewSchemaPluginValidator(schemas map[string][]byte) (*SchemaPluginValidator, error) {
+	v := &SchemaPluginValidator{schemas: make(map[string]*gojsonschema.Schema, len(schemas))}
+	for name, schema := range schemas {
+		compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of plugin %s: %w", name, err)
+		}
+		v.schemas[name] = compiled
+	}
+	return v, nil
+}
+
+func (v *SchemaPluginValidator) ValidatePlugin(name string, config any) error {
+	schema, ok := v.schemas[name]
+	if !ok {
+		return nil
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(config))
+	if err != nil {
+		return fmt.Errorf("failed to validate config: %w", err)
+	}
+	fieldErrs := make([]*PluginFieldError, 0, len(result.Errors()))
+	for _, resultErr := range result.Errors() {
+		fieldErrs = append(fieldErrs, &PluginFieldError{
+			Pointer: resultPointer(resultErr),
+			Reason:  resultErr.Description(),
+		})
+	}
+	slices.SortStableFunc(fieldErrs, func(a, b *PluginFieldError) int {
+		return strings.Compare(a.Pointer, b.Pointer)
+	})
+	errs := make([]error, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		errs = append(errs, fieldErr)
+	}
+	return errors.Join(errs...)
+}
+
+// resultPointer returns the JSON pointer of the field a schema error is
+// about. Schemas report missing required fields on the object holding
+// them, the pointer names the field itself.
+func resultPointer(resultErr gojsonschema.ResultError) string {
+	pointer := strings.TrimPrefix(resultErr.Context().String("/"), gojsonschema.STRING_CONTEXT_ROOT)
+	if resultErr.Type() == "required" {
+		if property, ok := resultErr.Details()["property"].(string); ok {
+			pointer += "/" + property
+		}
+	}
+	return pointer
+}
+
+// validatePlugins checks the plugins of a resource with the plugin
+// validator of the options, in plugin name order
+func (o *TransferOptions) validatePlugins(resourceType ResourceType, name string, plugins map[string]any) error {
+	if o.PluginValidator == nil {
+		return nil
+	}
+	var errs []error
+	for _, plugin := range slices.Sorted(maps.Keys(plugins)) {
+		if err := o.PluginValidator.ValidatePlugin(plugin, plugins[plugin]); err != nil {
+			errs = append(errs, &PluginConfigError{
+				ResourceType: resourceType,
+				ResourceName: name,
+				Plugin:       plugin,
+				Err:          err,
+			})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,146 @@
+package kine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestSchemaPluginValidator(t *testing.T) {
+	validator, err := NewSchemaPluginValidator(DefaultPluginSchemas())
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	tests := []struct {
+		plugin string
+		config map[string]any
+		// pointer is the offending field, empty for a valid config
+		pointer string
+	}{
+		{"limit-count", map[string]any{"count": 10.0, "time_window": 60}, ""},
+		{"limit-count", map[string]any{"count": "10", "time_window": 60}, "/count"},
+		{"limit-req", map[string]any{"rate": 1.5, "burst": 2, "key": "remote_addr"}, ""},
+		{"limit-req", map[string]any{"rate": 1.5, "burst": 2}, "/key"},
+		{"cors", map[string]any{"allow_origins": "*", "max_age": 5}, ""},
+		{"cors", map[string]any{"allow_origins_by_regex": []any{"ok", 1}}, "/allow_origins_by_regex/1"},
+		{"proxy-rewrite", map[string]any{"uri": "/v2", "headers": map[string]any{"set": map[string]any{}}}, ""},
+		{"proxy-rewrite", map[string]any{"scheme": "ftp"}, "/scheme"},
+		// Plugins without a schema are accepted
+		{"key-auth", map[string]any{"header": 1}, ""},
+	}
+	for _, tt := range tests {
+		err := validator.ValidatePlugin(tt.plugin, tt.config)
+		if tt.pointer == "" {
+			if err != nil {
+				t.Errorf("expected %s config %v to be valid: %v", tt.plugin, tt.config, err)
+			}
+			continue
+		}
+		var fieldErr *PluginFieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Pointer != tt.pointer {
+			t.Errorf("expected %s config %v to fail at %s, got %v", tt.plugin, tt.config, tt.pointer, err)
+		}
+	}
+}
+
+func TestLoadPluginSchemas(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"type": "object", "properties": {"header": {"type": "string"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "key-auth.json"), []byte(schema), 0o600); err != nil {
+		t.Fatalf("failed to write schema: %v", err)
+	}
+	schemas, err := LoadPluginSchemas(dir)
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+	validator, err := NewSchemaPluginValidator(schemas)
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	if err := validator.ValidatePlugin("key-auth", map[string]any{"header": "apikey"}); err != nil {
+		t.Errorf("expected a valid key-auth config: %v", err)
+	}
+	if err := validator.ValidatePlugin("key-auth", map[string]any{"header": 1}); err == nil {
+		t.Error("expected an invalid key-auth config to fail")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"type": 1}`), 0o600); err != nil {
+		t.Fatalf("failed to write schema: %v", err)
+	}
+	schemas, err = LoadPluginSchemas(dir)
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+	if _, err := NewSchemaPluginValidator(schemas); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected an invalid schema error naming the plugin, got %v", err)
+	}
+}
+
+func TestTransferValidatesPlugins(t *testing.T) {
+	validator, err := NewSchemaPluginValidator(DefaultPluginSchemas())
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	resources := &adc.Resources{
+		Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}}},
+			Routes: []*adc.Route{{
+				Metadata: adc.Metadata{Name: "limited"},
+				Uris:     []string{"/"},
+				Plugins:  adc.Plugins{"limit-count": map[string]any{"count": "ten", "time_window": 60}},
+			}},
+		}},
+		GlobalRules: adc.GlobalRule{
+			"cors":          map[string]any{"max_age": "forever"},
+			"proxy-rewrite": map[string]any{"uri": "/v2"},
+		},
+	}
+
+	// Without a validator, plugins are not checked
+	if _, err := TransferResources(resources); err != nil {
+		t.Fatalf("expected no plugin validation by default: %v", err)
+	}
+
+	_, err = TransferResources(resources, ValidatePlugins(validator))
+	var configErr *PluginConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a plugin config error, got %v", err)
+	}
+	if !errors.Is(err, ErrTransferFailed) || !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected a transfer error of invalid input, got %v", err)
+	}
+	if configErr.ResourceType != ResourceTypeRoute || configErr.ResourceName != "limited" || configErr.Plugin != "limit-count" {
+		t.Errorf("expected the limit-count config of route limited, got %+v", configErr)
+	}
+	var fieldErr *PluginFieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Pointer != "/count" {
+		t.Errorf("expected the /count field, got %v", err)
+	}
+
+	// Best effort transfers skip the invalid resources with a warning
+	transferred, err := TransferResources(resources, ValidatePlugins(validator), BestEffort())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(transferred.Services) != 0 || len(transferred.GlobalRules) != 1 || transferred.GlobalRules[0].ID != "proxy-rewrite" {
+		t.Errorf("expected only the proxy-rewrite global rule, got %d services and %v",
+			len(transferred.Services), transferred.GlobalRules)
+	}
+	if len(transferred.Warnings) != 2 || !strings.Contains(transferred.Warnings[1].Error(), "/max_age") {
+		t.Errorf("expected warnings for the route and the cors global rule, got %v", transferred.Warnings)
+	}
+
+	// Service plugins are checked too
+	resources.Services[0].Routes[0].Plugins = nil
+	resources.Services[0].Plugins = adc.Plugins{"limit-req": map[string]any{"rate": -1, "burst": 0, "key": "remote_addr"}}
+	resources.GlobalRules = nil
+	if _, err := TransferResources(resources, ValidatePlugins(validator)); !errors.As(err, &configErr) ||
+		configErr.ResourceType != ResourceTypeService || configErr.Plugin != "limit-req" {
+		t.Errorf("expected the limit-req config of the service to fail, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package kine
+
+import "strings"
+
+// Derived priorities pack the specificity of a route into the bits of its
+// priority, most significant first: whether all its URIs are exact, the
+// length of its shortest literal path, then how few methods it matches.
+const (
+	exactPriorityShift  = 24
+	lengthPriorityShift = 8
+	maxPriorityLength   = 1<<(exactPriorityShift-lengthPriorityShift) - 1
+	maxPriorityMethods  = 1<<lengthPriorityShift - 1
+)
+
+// DerivePriority returns a priority ordering routes by specificity, as the
+// Gateway API precedence rules do: exact paths before prefixes, longer
+// paths before shorter ones, and routes restricted to fewer methods before
+// routes matching more or any. A route with several URIs ranks by its least
+// specific one, the broadest request it matches. The priority only depends
+// on the URIs and methods of the route, so it is the same across syncs.
+func DerivePriority(route *Route) uint32 {
+	exact, length := true, -1
+	for _, uri := range routeURIs(route) {
+		uriExact, uriLength := uriSpecificity(uri)
+		exact = exact && uriExact
+		if length < 0 || uriLength < length {
+			length = uriLength
+		}
+	}
+	if length < 0 {
+		// Routes without URIs match any path
+		exact, length = false, 0
+	}
+
+	var priority uint32
+	if exact {
+		priority = 1 << exactPriorityShift
+	}
+	priority |= uint32(min(length, maxPriorityLength)) << lengthPriorityShift
+	if len(route.Methods) > 0 {
+		priority |= uint32(maxPriorityMethods + 1 - min(len(route.Methods), maxPriorityMethods))
+	}
+	return priority
+}
+
+// uriSpecificity reports whether a URI matches a single path and the length
+// of its literal part. URIs ending with * or a {*name} catch-all are
+// prefixes, and {name} parameters end the literal part.
+func uriSpecificity(uri string) (bool, int) {
+	if prefix, ok := strings.CutSuffix(uri, "*"); ok {
+		return false, len(prefix)
+	}
+	if i := strings.Index(uri, "{"); i >= 0 {
+		return false, i
+	}
+	return true, len(uri)
+}
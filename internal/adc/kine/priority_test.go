@@ -0,0 +1,161 @@
+package kine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestDerivePriority(t *testing.T) {
+	// Each case holds routes from the most to the least specific, following
+	// the precedence examples of the Gateway API HTTPRoute rules
+	tests := []struct {
+		name   string
+		routes []*Route
+	}{
+		{
+			name: "exact before prefix",
+			routes: []*Route{
+				{URIs: []string{"/foo"}},
+				{URIs: []string{"/foo", "/foo/{*p}"}},
+			},
+		},
+		{
+			name: "longest prefix first",
+			routes: []*Route{
+				{URIs: []string{"/foo/bar", "/foo/bar/{*p}"}},
+				{URIs: []string{"/foo", "/foo/{*p}"}},
+				{URIs: []string{"/", "/{*p}"}},
+			},
+		},
+		{
+			name: "short exact before long prefix",
+			routes: []*Route{
+				{URIs: []string{"/a"}},
+				{URIs: []string{"/a/very/long/prefix/*"}},
+			},
+		},
+		{
+			name: "longest exact first",
+			routes: []*Route{
+				{URIs: []string{"/foo/bar"}},
+				{URIs: []string{"/foo"}},
+			},
+		},
+		{
+			name: "method match before any method",
+			routes: []*Route{
+				{URIs: []string{"/foo/*"}, Methods: []Method{MethodGET}},
+				{URIs: []string{"/foo/*"}, Methods: []Method{MethodGET, MethodPOST}},
+				{URIs: []string{"/foo/*"}},
+			},
+		},
+		{
+			name: "path before method",
+			routes: []*Route{
+				{URIs: []string{"/foo/bar/*"}},
+				{URIs: []string{"/foo/*"}, Methods: []Method{MethodGET}},
+			},
+		},
+		{
+			name: "parameters end the literal path",
+			routes: []*Route{
+				{URIs: []string{"/users/me"}},
+				{URIs: []string{"/users/{id}"}},
+				{URIs: []string{"/*"}},
+			},
+		},
+		{
+			name: "least specific uri ranks",
+			routes: []*Route{
+				{URIs: []string{"/foo/bar/*"}},
+				{URIs: []string{"/foo/bar/baz", "/foo/*"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 1; i < len(tt.routes); i++ {
+				higher, lower := DerivePriority(tt.routes[i-1]), DerivePriority(tt.routes[i])
+				if higher <= lower {
+					t.Errorf("expected %v (%d) to rank above %v (%d)",
+						tt.routes[i-1].URIs, higher, tt.routes[i].URIs, lower)
+				}
+			}
+		})
+	}
+
+	// Routes matching the same requests get the same priority
+	a := DerivePriority(&Route{URIs: []string{"/foo/*"}})
+	b := DerivePriority(&Route{URIs: []string{"/foo/{*rest}"}})
+	if a != b {
+		t.Errorf("expected equal priorities for equivalent prefixes, got %d and %d", a, b)
+	}
+}
+
+func TestTransferDerivedPriorities(t *testing.T) {
+	explicit := int64(7)
+	resources := func(node string) *adc.Resources {
+		return &adc.Resources{
+			Services: []*adc.Service{{
+				Metadata: adc.Metadata{Name: "svc"},
+				Upstream: &adc.Upstream{
+					Nodes: adc.UpstreamNodes{{Host: node, Port: 80, Weight: 100}},
+				},
+				Routes: []*adc.Route{
+					{Metadata: adc.Metadata{Name: "exact"}, Uris: []string{"/foo"}},
+					{Metadata: adc.Metadata{Name: "prefix"}, Uris: []string{"/foo", "/foo/{*p}"}},
+					{Metadata: adc.Metadata{Name: "explicit"}, Uris: []string{"/foo"}, Priority: &explicit},
+				},
+			}},
+		}
+	}
+
+	transferred, err := TransferResources(resources("10.0.0.1"))
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	for _, route := range transferred.Routes {
+		if route.Name != "explicit" && route.Priority != 0 {
+			t.Errorf("expected no derived priority by default, got %d for %s", route.Priority, route.Name)
+		}
+	}
+
+	transferred, err = TransferResources(resources("10.0.0.1"), DerivePriorities())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	priorities := make(map[string]uint32)
+	for _, route := range transferred.Routes {
+		priorities[route.Name] = route.Priority
+	}
+	if priorities["exact"] <= priorities["prefix"] || priorities["prefix"] == 0 {
+		t.Errorf("expected the exact route to rank above the prefix route, got %v", priorities)
+	}
+	if priorities["explicit"] != uint32(explicit) {
+		t.Errorf("expected the explicit priority to win, got %d", priorities["explicit"])
+	}
+
+	// Changing the endpoints keeps the derived priorities
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, route := range transferred.Routes {
+		if err := cache.InsertRoute(route); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+	transferred, err = TransferResources(resources("10.0.0.2"), DerivePriorities())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	events, err := NewDiffer(cache).Diff(context.Background(), &TransferredResources{Routes: transferred.Routes}, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no route events after an endpoint change, got %d", len(events))
+	}
+}
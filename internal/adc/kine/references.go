@@ -0,0 +1,127 @@
+package kine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// ReferenceKind is the kind of object a plugin config references
+type ReferenceKind string
+
+const (
+	ReferenceConsumer ReferenceKind = "consumer"
+	ReferenceUpstream ReferenceKind = "upstream"
+)
+
+// PluginReference is an object referenced from a plugin config
+type PluginReference struct {
+	Kind ReferenceKind `json:"kind"`
+	// ID is the username of consumers and the ID of upstreams
+	ID string `json:"id"`
+	// Pointer is the JSON pointer of the reference in the plugin config
+	Pointer string `json:"pointer"`
+}
+
+// PluginReferences extracts the references of plugin configs by plugin
+// name. Plugins referencing consumers or upstreams by name are registered
+// here to have their references checked.
+var PluginReferences = map[string]func(config any) []PluginReference{
+	"consumer-restriction": consumerRestrictionReferences,
+	"traffic-split":        trafficSplitReferences,
+}
+
+// consumerRestrictionReferences returns the consumers listed by a
+// consumer-restriction config restricting consumer names, the default
+func consumerRestrictionReferences(config any) []PluginReference {
+	conf, _ := config.(map[string]any)
+	if restrictionType, ok := conf["type"].(string); ok && restrictionType != "consumer_name" {
+		return nil
+	}
+	var refs []PluginReference
+	for _, list := range []string{"whitelist", "blacklist"} {
+		names, _ := conf[list].([]any)
+		for i, name := range names {
+			if name, ok := name.(string); ok {
+				refs = append(refs, PluginReference{
+					Kind:    ReferenceConsumer,
+					ID:      name,
+					Pointer: "/" + list + "/" + strconv.Itoa(i),
+				})
+			}
+		}
+	}
+	return refs
+}
+
+// trafficSplitReferences returns the upstreams referenced by ID from the
+// weighted upstreams of a traffic-split config
+func trafficSplitReferences(config any) []PluginReference {
+	conf, _ := config.(map[string]any)
+	rules, _ := conf["rules"].([]any)
+	var refs []PluginReference
+	for i, rule := range rules {
+		rule, _ := rule.(map[string]any)
+		upstreams, _ := rule["weighted_upstreams"].([]any)
+		for j, upstream := range upstreams {
+			upstream, _ := upstream.(map[string]any)
+			if id, ok := upstream["upstream_id"].(string); ok {
+				refs = append(refs, PluginReference{
+					Kind:    ReferenceUpstream,
+					ID:      id,
+					Pointer: fmt.Sprintf("/rules/%d/weighted_upstreams/%d/upstream_id", i, j),
+				})
+			}
+		}
+	}
+	return refs
+}
+
+// DanglingReference is a plugin reference to an object that does not exist
+type DanglingReference struct {
+	ResourceType ResourceType `json:"resourceType"`
+	ResourceID   string       `json:"resourceId"`
+	Plugin       string       `json:"plugin"`
+	PluginReference
+}
+
+func (r *DanglingReference) Error() string {
+	return fmt.Sprintf("%s plugin of %s %s references missing %s %q at %s",
+		r.Plugin, r.ResourceType, r.ResourceID, r.Kind, r.ID, r.Pointer)
+}
+
+// CheckPluginReferences returns the references of the plugin configs of
+// the routes, services and global rules of resources that exists reports
+// missing, in resource and plugin name order
+func CheckPluginReferences(resources *TransferredResources, exists func(ReferenceKind, string) bool) []*DanglingReference {
+	var dangling []*DanglingReference
+	check := func(resourceType ResourceType, id string, plugins map[string]any) {
+		for _, plugin := range slices.Sorted(maps.Keys(plugins)) {
+			extract, ok := PluginReferences[plugin]
+			if !ok {
+				continue
+			}
+			for _, ref := range extract(plugins[plugin]) {
+				if !exists(ref.Kind, ref.ID) {
+					dangling = append(dangling, &DanglingReference{
+						ResourceType:    resourceType,
+						ResourceID:      id,
+						Plugin:          plugin,
+						PluginReference: ref,
+					})
+				}
+			}
+		}
+	}
+	for _, route := range resources.Routes {
+		check(ResourceTypeRoute, route.ID, route.Plugins)
+	}
+	for _, service := range resources.Services {
+		check(ResourceTypeService, service.ID, service.Plugins)
+	}
+	for _, globalRule := range resources.GlobalRules {
+		check(ResourceTypeGlobalRule, globalRule.ID, globalRule.Plugins)
+	}
+	return dangling
+}
@@ -0,0 +1,87 @@
+package kine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestCheckPluginReferences(t *testing.T) {
+	resources := &TransferredResources{
+		Routes: []*Route{{
+			Metadata: adc.Metadata{ID: "route"},
+			Plugins: map[string]any{
+				"consumer-restriction": map[string]any{
+					"whitelist": []any{"alice", "bob"},
+				},
+				"traffic-split": map[string]any{
+					"rules": []any{map[string]any{
+						"weighted_upstreams": []any{
+							map[string]any{"upstream_id": "canary", "weight": 10},
+							map[string]any{"weight": 90},
+						},
+					}},
+				},
+			},
+		}},
+		Services: []*Service{{
+			Metadata: adc.Metadata{ID: "svc"},
+			Plugins: map[string]any{
+				// Restrictions on other than consumer names reference no consumer
+				"consumer-restriction": map[string]any{
+					"type":      "route_id",
+					"blacklist": []any{"carol"},
+				},
+			},
+		}},
+		GlobalRules: []*GlobalRule{{
+			ID: "restrict",
+			Plugins: map[string]any{
+				"consumer-restriction": map[string]any{
+					"type":      "consumer_name",
+					"blacklist": []any{"dave"},
+				},
+			},
+		}},
+	}
+	existing := map[ReferenceKind]map[string]bool{
+		ReferenceConsumer: {"alice": true},
+		ReferenceUpstream: {},
+	}
+	dangling := CheckPluginReferences(resources, func(kind ReferenceKind, id string) bool {
+		return existing[kind][id]
+	})
+
+	want := []*DanglingReference{
+		{
+			ResourceType: ResourceTypeRoute, ResourceID: "route", Plugin: "consumer-restriction",
+			PluginReference: PluginReference{Kind: ReferenceConsumer, ID: "bob", Pointer: "/whitelist/1"},
+		},
+		{
+			ResourceType: ResourceTypeRoute, ResourceID: "route", Plugin: "traffic-split",
+			PluginReference: PluginReference{
+				Kind: ReferenceUpstream, ID: "canary", Pointer: "/rules/0/weighted_upstreams/0/upstream_id",
+			},
+		},
+		{
+			ResourceType: ResourceTypeGlobalRule, ResourceID: "restrict", Plugin: "consumer-restriction",
+			PluginReference: PluginReference{Kind: ReferenceConsumer, ID: "dave", Pointer: "/blacklist/0"},
+		},
+	}
+	if !reflect.DeepEqual(dangling, want) {
+		for _, ref := range dangling {
+			t.Logf("got %s", ref)
+		}
+		t.Fatalf("unexpected dangling references")
+	}
+
+	existing[ReferenceConsumer]["bob"] = true
+	existing[ReferenceConsumer]["dave"] = true
+	existing[ReferenceUpstream]["canary"] = true
+	if dangling := CheckPluginReferences(resources, func(kind ReferenceKind, id string) bool {
+		return existing[kind][id]
+	}); len(dangling) != 0 {
+		t.Errorf("expected no dangling references, got %v", dangling)
+	}
+}
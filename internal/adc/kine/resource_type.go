@@ -0,0 +1,115 @@
+package kine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// ResourceType represents the type of Kine resource. Its value is the
+// plural name of the type, as in the etcd keys of APISIX.
+type ResourceType string
+
+const (
+	ResourceTypeRoute      ResourceType = "routes"
+	ResourceTypeService    ResourceType = "services"
+	ResourceTypeUpstream   ResourceType = "upstreams"
+	ResourceTypeSSL        ResourceType = "ssls"
+	ResourceTypeGlobalRule ResourceType = "global_rules"
+	ResourceTypeProto      ResourceType = "protos"
+
+	ResourceTypePluginMetadata ResourceType = "plugin_metadata"
+)
+
+// ResourceTypes lists every resource type known to the differ
+var ResourceTypes = []ResourceType{
+	ResourceTypeRoute,
+	ResourceTypeService,
+	ResourceTypeUpstream,
+	ResourceTypeSSL,
+	ResourceTypeGlobalRule,
+	ResourceTypeProto,
+	ResourceTypePluginMetadata,
+}
+
+// ErrUnknownResourceType is returned for resource types not in ResourceTypes
+var ErrUnknownResourceType = fmt.Errorf("%w: unknown resource type", ErrInvalidInput)
+
+// _resourceTables holds the cache table of each resource type, its
+// singular name
+var _resourceTables = map[ResourceType]string{
+	ResourceTypeRoute:      "route",
+	ResourceTypeService:    "service",
+	ResourceTypeUpstream:   "upstream",
+	ResourceTypeSSL:        "ssl",
+	ResourceTypeGlobalRule: "global_rule",
+	ResourceTypeProto:      "proto",
+
+	ResourceTypePluginMetadata: "plugin_metadata",
+}
+
+// _resourceTypeAliases maps the names accepted by ParseResourceType to the
+// resource types: the plural and singular names, and the ADC type names
+var _resourceTypeAliases = func() map[string]ResourceType {
+	aliases := map[string]ResourceType{
+		adc.TypeRoute:          ResourceTypeRoute,
+		adc.TypeService:        ResourceTypeService,
+		adc.TypeSSL:            ResourceTypeSSL,
+		adc.TypeGlobalRule:     ResourceTypeGlobalRule,
+		adc.TypeProto:          ResourceTypeProto,
+		adc.TypePluginMetadata: ResourceTypePluginMetadata,
+	}
+	for resourceType, table := range _resourceTables {
+		aliases[string(resourceType)] = resourceType
+		aliases[table] = resourceType
+	}
+	return aliases
+}()
+
+// ParseResourceType returns the resource type named s, by its plural or
+// singular name or its ADC type name, case-insensitively
+func ParseResourceType(s string) (ResourceType, error) {
+	resourceType, ok := _resourceTypeAliases[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownResourceType, strconv.Quote(s))
+	}
+	return resourceType, nil
+}
+
+// ParseResourceTypes parses resource type names with ParseResourceType.
+// All unknown names are reported at once, together with the accepted values.
+func ParseResourceTypes(types []string) ([]ResourceType, error) {
+	parsed := make([]ResourceType, 0, len(types))
+	var unknown []string
+	for _, t := range types {
+		resourceType, err := ParseResourceType(t)
+		if err != nil {
+			unknown = append(unknown, strconv.Quote(t))
+			continue
+		}
+		parsed = append(parsed, resourceType)
+	}
+	if len(unknown) > 0 {
+		accepted := make([]string, 0, len(ResourceTypes))
+		for _, t := range ResourceTypes {
+			accepted = append(accepted, string(t))
+		}
+		return nil, fmt.Errorf("%w %s, accepted values are: %s",
+			ErrUnknownResourceType, strings.Join(unknown, ", "), strings.Join(accepted, ", "))
+	}
+	return parsed, nil
+}
+
+// KeySegment returns the segment naming the resource type in etcd keys,
+// such as routes in /apisix/routes/1
+func (t ResourceType) KeySegment() string {
+	return string(t)
+}
+
+// TableName returns the cache table holding the resource type, empty for
+// unknown types
+func (t ResourceType) TableName() string {
+	return _resourceTables[t]
+}
@@ -0,0 +1,58 @@
+package kine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+func TestParseResourceType(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  ResourceType
+		table string
+	}{
+		{[]string{"routes", "route", adc.TypeRoute, "Routes"}, ResourceTypeRoute, "route"},
+		{[]string{"services", "service", adc.TypeService, " SERVICE "}, ResourceTypeService, "service"},
+		{[]string{"upstreams", "upstream"}, ResourceTypeUpstream, "upstream"},
+		{[]string{"ssls", "ssl", adc.TypeSSL, "SSL"}, ResourceTypeSSL, "ssl"},
+		{[]string{"global_rules", "global_rule", adc.TypeGlobalRule}, ResourceTypeGlobalRule, "global_rule"},
+		{[]string{"protos", "proto", adc.TypeProto}, ResourceTypeProto, "proto"},
+		{[]string{"plugin_metadata", adc.TypePluginMetadata}, ResourceTypePluginMetadata, "plugin_metadata"},
+	}
+	covered := make(map[ResourceType]bool)
+	for _, tt := range tests {
+		covered[tt.want] = true
+		for _, name := range tt.names {
+			got, err := ParseResourceType(name)
+			if err != nil {
+				t.Errorf("failed to parse %q: %v", name, err)
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("expected %q to parse as %s, got %s", name, tt.want, got)
+			}
+		}
+		if table := tt.want.TableName(); table != tt.table {
+			t.Errorf("expected the table of %s to be %s, got %s", tt.want, tt.table, table)
+		}
+		if segment := tt.want.KeySegment(); segment != string(tt.want) {
+			t.Errorf("expected the key segment of %s to be %s, got %s", tt.want, tt.want, segment)
+		}
+	}
+	for _, resourceType := range ResourceTypes {
+		if !covered[resourceType] {
+			t.Errorf("no aliases tested for %s", resourceType)
+		}
+	}
+
+	for _, name := range []string{"", "routs", "globalrules", adc.TypeConsumer, "stream_routes"} {
+		if got, err := ParseResourceType(name); !errors.Is(err, ErrUnknownResourceType) {
+			t.Errorf("expected %q to be unknown, got %s (%v)", name, got, err)
+		}
+	}
+	if table := ResourceType("stream_routes").TableName(); table != "" {
+		t.Errorf("expected no table for an unknown type, got %s", table)
+	}
+}
@@ -0,0 +1,249 @@
+package kine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/hashicorp/go-memdb"
+	bolt "go.etcd.io/bbolt"
+)
+
+// revisionTable is the memdb table and bolt bucket holding the revision of
+// every cached object, keyed by table and object ID
+const revisionTable = "revision"
+
+// objectRevision records the revision the cache assigned to an object and
+// the hash of the content it was assigned for
+type objectRevision struct {
+	Key      string
+	Revision uint64
+	Hash     []byte
+}
+
+// revisionKey returns the key of the revision record of an object
+func revisionKey(table, id string) string {
+	return table + "/" + id
+}
+
+// updateRevision assigns the next revision to the object with the given id
+// unless its content is unchanged. It must run in the write transaction
+// inserting the object, which also serializes the counter updates.
+func (c *dbCache) updateRevision(txn *memdb.Txn, table, id string, obj any) error {
+	hash, err := ContentHash(obj)
+	if err != nil {
+		return err
+	}
+	key := revisionKey(table, id)
+	existing, err := txn.First(revisionTable, "id", key)
+	if err != nil {
+		return err
+	}
+	if existing != nil && bytes.Equal(existing.(*objectRevision).Hash, hash) {
+		return nil
+	}
+	c.revision++
+	return txn.Insert(revisionTable, &objectRevision{Key: key, Revision: c.revision, Hash: hash})
+}
+
+func (c *dbCache) Touch(resourceType ResourceType, id string) error {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return err
+	}
+	txn := c.db.Txn(true)
+	defer txn.Abort()
+	existing, err := txn.First(revisionTable, "id", revisionKey(table, id))
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+	c.revision++
+	touched := *existing.(*objectRevision)
+	touched.Revision = c.revision
+	if err := txn.Insert(revisionTable, &touched); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+// Revision returns the revision the cache assigned to the object of the
+// given type and id
+func (c *dbCache) Revision(resourceType ResourceType, id string) (uint64, error) {
+	return c.reader().Revision(resourceType, id)
+}
+
+// Revisions returns the revisions of all objects of the given type by ID
+func (c *dbCache) Revisions(resourceType ResourceType) (map[string]uint64, error) {
+	return c.reader().Revisions(resourceType)
+}
+
+// ContentHashes returns the content hashes of all objects of the given type
+// by ID
+func (c *dbCache) ContentHashes(resourceType ResourceType) (map[string][]byte, error) {
+	return c.reader().ContentHashes(resourceType)
+}
+
+func (r *dbReader) Revision(resourceType ResourceType, id string) (uint64, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return 0, err
+	}
+	obj, err := r.txn.First(revisionTable, "id", revisionKey(table, id))
+	if err != nil {
+		return 0, err
+	}
+	if obj == nil {
+		return 0, ErrNotFound
+	}
+	return obj.(*objectRevision).Revision, nil
+}
+
+func (r *dbReader) Revisions(resourceType ResourceType) (map[string]uint64, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	prefix := revisionKey(table, "")
+	it, err := r.txn.Get(revisionTable, "id_prefix", prefix)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]uint64)
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		record := obj.(*objectRevision)
+		revisions[strings.TrimPrefix(record.Key, prefix)] = record.Revision
+	}
+	return revisions, nil
+}
+
+func (r *dbReader) ContentHashes(resourceType ResourceType) (map[string][]byte, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	prefix := revisionKey(table, "")
+	it, err := r.txn.Get(revisionTable, "id_prefix", prefix)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string][]byte)
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		record := obj.(*objectRevision)
+		hashes[strings.TrimPrefix(record.Key, prefix)] = record.Hash
+	}
+	return hashes, nil
+}
+
+// Bolt revision records hold the big endian revision followed by the
+// content hash. The counter is the bucket sequence, so that it persists
+// and never goes back, even across Reset.
+
+// updateBoltRevision is the bolt counterpart of updateRevision
+func updateBoltRevision(tx *bolt.Tx, table, id string, obj any) error {
+	hash, err := ContentHash(obj)
+	if err != nil {
+		return err
+	}
+	bucket := tx.Bucket([]byte(revisionTable))
+	key := []byte(revisionKey(table, id))
+	if existing := bucket.Get(key); len(existing) > 8 && bytes.Equal(existing[8:], hash) {
+		return nil
+	}
+	revision, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, append(binary.BigEndian.AppendUint64(nil, revision), hash...))
+}
+
+func (c *boltCache) Touch(resourceType ResourceType, id string) error {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(revisionTable))
+		key := []byte(revisionKey(table, id))
+		existing := bucket.Get(key)
+		if len(existing) < 8 {
+			return ErrNotFound
+		}
+		revision, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, append(binary.BigEndian.AppendUint64(nil, revision), existing[8:]...))
+	})
+}
+
+// deleteBoltRevisions removes the revision records of all objects of a table
+func deleteBoltRevisions(tx *bolt.Tx, table string) error {
+	prefix := []byte(revisionKey(table, ""))
+	cursor := tx.Bucket([]byte(revisionTable)).Cursor()
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *boltReader) Revision(resourceType ResourceType, id string) (uint64, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return 0, err
+	}
+	var revision uint64
+	err = r.view(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(revisionTable)).Get([]byte(revisionKey(table, id)))
+		if len(value) < 8 {
+			return ErrNotFound
+		}
+		revision = binary.BigEndian.Uint64(value)
+		return nil
+	})
+	return revision, err
+}
+
+func (r *boltReader) Revisions(resourceType ResourceType) (map[string]uint64, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]uint64)
+	err = r.view(func(tx *bolt.Tx) error {
+		prefix := []byte(revisionKey(table, ""))
+		cursor := tx.Bucket([]byte(revisionTable)).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			if len(value) >= 8 {
+				revisions[string(key[len(prefix):])] = binary.BigEndian.Uint64(value)
+			}
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+func (r *boltReader) ContentHashes(resourceType ResourceType) (map[string][]byte, error) {
+	table, err := tableOf(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string][]byte)
+	err = r.view(func(tx *bolt.Tx) error {
+		prefix := []byte(revisionKey(table, ""))
+		cursor := tx.Bucket([]byte(revisionTable)).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			if len(value) > 8 {
+				// Bolt values are only valid within the transaction
+				hashes[string(key[len(prefix):])] = bytes.Clone(value[8:])
+			}
+		}
+		return nil
+	})
+	return hashes, err
+}
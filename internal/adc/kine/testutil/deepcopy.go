@@ -0,0 +1,128 @@
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// maxFillDepth bounds the nesting filled by Fill, so that recursive types
+// such as adc.StringOrSlice terminate
+const maxFillDepth = 6
+
+// Fill sets every exported field reachable from ptr to a deterministic
+// non-zero value: pointers, slices and maps are allocated with elements and
+// interfaces hold a map of strings. Fields already set are changed in place, through
+// the pointers, slices and maps they hold, so that filling an object a
+// second time alters every value it shares with another object.
+func Fill(ptr any) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		panic(fmt.Sprintf("testutil.Fill needs a non-nil pointer, got %T", ptr))
+	}
+	f := &filler{}
+	f.fill(v.Elem(), 0)
+}
+
+// filler hands out the values of Fill from a counter
+type filler struct {
+	n int
+}
+
+func (f *filler) next() int {
+	f.n++
+	return f.n
+}
+
+// fill changes v, which must be settable, or fills it when zero
+func (f *filler) fill(v reflect.Value, depth int) {
+	if depth > maxFillDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(!v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + int64(1+f.next()%100))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(v.Uint() + uint64(1+f.next()%100))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(v.Float() + float64(f.next()))
+	case reflect.String:
+		v.SetString(fmt.Sprintf("%s%d", v.String(), f.next()))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		f.fill(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		}
+		for i := 0; i < v.Len(); i++ {
+			f.fill(v.Index(i), depth+1)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			f.fill(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		// Map values are not addressable, change copies and store them
+		// back. Copies share what the values point to, which is changed
+		// in place.
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			f.fill(value, depth+1)
+			v.SetMapIndex(key, value)
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		f.fill(key, depth+1)
+		value := reflect.New(v.Type().Elem()).Elem()
+		f.fill(value, depth+1)
+		v.SetMapIndex(key, value)
+	case reflect.Interface:
+		if v.IsNil() {
+			// Nested maps catch copies sharing the values of plugin configs
+			nested := reflect.ValueOf(map[string]any{})
+			if !nested.Type().AssignableTo(v.Type()) || depth >= maxFillDepth {
+				v.Set(reflect.ValueOf(fmt.Sprintf("value%d", f.next())))
+				return
+			}
+			v.Set(nested)
+		}
+		value := reflect.New(v.Elem().Type()).Elem()
+		value.Set(v.Elem())
+		f.fill(value, depth+1)
+		v.Set(value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				f.fill(v.Field(i), depth+1)
+			}
+		}
+	}
+}
+
+// AssertDeepCopy checks that deepCopy copies every exported field of T and
+// shares nothing with the original: it deep copies a filled T, fails t
+// unless the copy equals the original, then changes every value of the
+// copy and fails t if that altered the original.
+func AssertDeepCopy[T any](t testing.TB, deepCopy func(*T) *T) {
+	t.Helper()
+	original, reference := new(T), new(T)
+	Fill(original)
+	Fill(reference)
+
+	copied := deepCopy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("%T deep copy lost fields:\noriginal: %+v\ncopy:     %+v", original, original, copied)
+	}
+	Fill(copied)
+	if !reflect.DeepEqual(original, reference) {
+		t.Fatalf("%T deep copy shares values with the original:\nwant: %+v\ngot:  %+v", original, reference, original)
+	}
+}
@@ -0,0 +1,71 @@
+// Package testutil generates synthetic ADC resources for the tests and
+// benchmarks of the kine package and of its users.
+package testutil
+
+import (
+	"fmt"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// DefaultLabels are the owner labels of generated resources unless
+// ResourceSpec.Labels is set
+var DefaultLabels = map[string]string{
+	"k8s/kind":      "Ingress",
+	"k8s/namespace": "default",
+	"k8s/name":      "synthetic",
+}
+
+// ResourceSpec describes the resources to generate
+type ResourceSpec struct {
+	// Services is the number of services, each with an inline upstream
+	Services int
+	// RoutesPerService is the number of routes of each service
+	RoutesPerService int
+	// SSLs is the number of single certificate SSLs
+	SSLs int
+	// Labels are stamped on every resource, DefaultLabels when nil
+	Labels map[string]string
+}
+
+// GenerateResources returns the resources described by spec. Resources are
+// named but carry no ID, like the ones produced by the translator, so that
+// transfers generate their IDs. The output only depends on spec.
+func GenerateResources(spec ResourceSpec) *adc.Resources {
+	labels := spec.Labels
+	if labels == nil {
+		labels = DefaultLabels
+	}
+	resources := &adc.Resources{
+		Services: make([]*adc.Service, 0, spec.Services),
+	}
+	for i := range spec.Services {
+		service := &adc.Service{
+			Metadata: adc.Metadata{Name: fmt.Sprintf("svc-%d", i), Labels: labels},
+			Hosts:    []string{fmt.Sprintf("svc-%d.example.com", i)},
+			Upstream: &adc.Upstream{
+				Nodes: adc.UpstreamNodes{
+					{Host: fmt.Sprintf("10.0.%d.%d", i/256%256, i%256), Port: 80, Weight: 100},
+				},
+			},
+			Routes: make([]*adc.Route, 0, spec.RoutesPerService),
+		}
+		for j := range spec.RoutesPerService {
+			service.Routes = append(service.Routes, &adc.Route{
+				Metadata: adc.Metadata{Name: fmt.Sprintf("route-%d", j), Labels: labels},
+				Uris:     []string{fmt.Sprintf("/svc-%d/route-%d", i, j)},
+				Methods:  []string{"GET"},
+				Plugins:  adc.Plugins{"proxy-rewrite": map[string]any{"regex_uri": []any{"^/svc-[0-9]+(.*)", "$1"}}},
+			})
+		}
+		resources.Services = append(resources.Services, service)
+	}
+	for i := range spec.SSLs {
+		resources.SSLs = append(resources.SSLs, &adc.SSL{
+			Metadata:     adc.Metadata{Name: fmt.Sprintf("ssl-%d", i), Labels: labels},
+			Certificates: []adc.Certificate{{Certificate: "certificate", Key: "key"}},
+			Snis:         []string{fmt.Sprintf("ssl-%d.example.com", i)},
+		})
+	}
+	return resources
+}
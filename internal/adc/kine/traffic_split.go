@@ -0,0 +1,180 @@
+package kine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// trafficSplitPlugin is the plugin routing a share of the requests of a
+// route or service to other upstreams
+const trafficSplitPlugin = "traffic-split"
+
+// extractSplitUpstreams returns plugins with the upstreams embedded in the
+// weighted upstreams of its traffic-split config replaced by an upstream_id
+// reference to their shared form, see shareUpstream, and the shared
+// upstreams. Weighted upstreams already referencing an upstream_id are left
+// as they are, so extracting from an extracted config changes nothing.
+// plugins itself is not modified.
+func extractSplitUpstreams(plugins map[string]any, adcSvc *adc.Service, o *TransferOptions) (map[string]any, []*Upstream, error) {
+	config, ok := plugins[trafficSplitPlugin]
+	if !ok {
+		return plugins, nil, nil
+	}
+	var upstreams []*Upstream
+	rewritten, err := rewriteWeightedUpstreams(config, func(pointer string, weighted map[string]any) (map[string]any, error) {
+		embedded, ok := weighted["upstream"]
+		if !ok || weighted["upstream_id"] != nil {
+			return nil, nil
+		}
+		data, err := json.Marshal(embedded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s upstream at %s: %w", trafficSplitPlugin, pointer, err)
+		}
+		var adcUpstream adc.Upstream
+		if err := json.Unmarshal(data, &adcUpstream); err != nil {
+			return nil, fmt.Errorf("invalid %s upstream at %s: %w", trafficSplitPlugin, pointer, err)
+		}
+		// The shared form carries no metadata, the ID is its hash
+		adcUpstream.Metadata = adc.Metadata{}
+		upstream, err := convertRouteUpstream(&adcUpstream, adcSvc, o)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s upstream at %s: %w", trafficSplitPlugin, pointer, err)
+		}
+		shared, err := shareUpstream(upstream, o)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, shared)
+
+		extracted := maps.Clone(weighted)
+		delete(extracted, "upstream")
+		extracted["upstream_id"] = shared.ID
+		return extracted, nil
+	})
+	if err != nil || len(upstreams) == 0 {
+		return plugins, nil, err
+	}
+	plugins = maps.Clone(plugins)
+	plugins[trafficSplitPlugin] = rewritten
+	return plugins, upstreams, nil
+}
+
+// inlineSplitUpstreams returns plugins with the weighted upstreams of its
+// traffic-split config referencing a shared upstream replaced by the
+// embedded upstream, the reverse of extractSplitUpstreams. References to
+// other upstreams are left as they are. plugins itself is not modified.
+func inlineSplitUpstreams(plugins adc.Plugins, cache Cache) (adc.Plugins, error) {
+	config, ok := plugins[trafficSplitPlugin]
+	if !ok {
+		return plugins, nil
+	}
+	inlined := false
+	rewritten, err := rewriteWeightedUpstreams(config, func(pointer string, weighted map[string]any) (map[string]any, error) {
+		id, ok := weighted["upstream_id"].(string)
+		if !ok {
+			return nil, nil
+		}
+		upstream, err := cache.GetUpstream(id)
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get upstream %s at %s: %w", id, pointer, err)
+		}
+		if !isSharedUpstream(upstream) {
+			return nil, nil
+		}
+		adcUpstream := exportUpstream(upstream)
+		adcUpstream.Metadata = adc.Metadata{}
+		data, err := json.Marshal(adcUpstream)
+		if err != nil {
+			return nil, err
+		}
+		var embedded map[string]any
+		if err := json.Unmarshal(data, &embedded); err != nil {
+			return nil, err
+		}
+		inlined = true
+
+		weighted = maps.Clone(weighted)
+		delete(weighted, "upstream_id")
+		weighted["upstream"] = embedded
+		return weighted, nil
+	})
+	if err != nil || !inlined {
+		return plugins, err
+	}
+	plugins = maps.Clone(plugins)
+	plugins[trafficSplitPlugin] = rewritten
+	return plugins, nil
+}
+
+// isSharedUpstream reports whether an upstream is the shared form of an
+// inline one, created by shareUpstream
+func isSharedUpstream(upstream *Upstream) bool {
+	return len(upstream.Labels) == 0 && upstream.Name == "shared-"+upstream.ID
+}
+
+// rewriteWeightedUpstreams returns a copy of a traffic-split config with
+// each weighted upstream replaced by the one rewrite returns for it, given
+// its JSON pointer in the config. Weighted upstreams for which rewrite
+// returns nil are kept. Only the objects on the path to a rewritten
+// weighted upstream are copied.
+func rewriteWeightedUpstreams(config any, rewrite func(pointer string, weighted map[string]any) (map[string]any, error)) (any, error) {
+	conf, ok := config.(map[string]any)
+	if !ok {
+		return config, nil
+	}
+	rules, ok := conf["rules"].([]any)
+	if !ok {
+		return config, nil
+	}
+	var rewrittenRules []any
+	for i, rule := range rules {
+		ruleConf, ok := rule.(map[string]any)
+		if !ok {
+			continue
+		}
+		weightedUpstreams, ok := ruleConf["weighted_upstreams"].([]any)
+		if !ok {
+			continue
+		}
+		var rewrittenUpstreams []any
+		for j, weighted := range weightedUpstreams {
+			weightedConf, ok := weighted.(map[string]any)
+			if !ok {
+				continue
+			}
+			rewritten, err := rewrite(fmt.Sprintf("/rules/%d/weighted_upstreams/%d", i, j), weightedConf)
+			if err != nil {
+				return nil, err
+			}
+			if rewritten == nil {
+				continue
+			}
+			if rewrittenUpstreams == nil {
+				rewrittenUpstreams = append([]any(nil), weightedUpstreams...)
+			}
+			rewrittenUpstreams[j] = rewritten
+		}
+		if rewrittenUpstreams == nil {
+			continue
+		}
+		if rewrittenRules == nil {
+			rewrittenRules = append([]any(nil), rules...)
+		}
+		ruleConf = maps.Clone(ruleConf)
+		ruleConf["weighted_upstreams"] = rewrittenUpstreams
+		rewrittenRules[i] = ruleConf
+	}
+	if rewrittenRules == nil {
+		return config, nil
+	}
+	conf = maps.Clone(conf)
+	conf["rules"] = rewrittenRules
+	return conf, nil
+}
@@ -0,0 +1,144 @@
+package kine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/apisix-ingress-controller/api/adc"
+)
+
+// canarySplit returns a traffic-split config sending 10% of the requests
+// to an embedded canary upstream, the rest to the upstream of the route
+func canarySplit() map[string]any {
+	return map[string]any{
+		"rules": []any{map[string]any{
+			"weighted_upstreams": []any{
+				map[string]any{
+					"upstream": map[string]any{
+						"type":  "roundrobin",
+						"nodes": map[string]any{"10.0.0.2:8080": float64(1)},
+					},
+					"weight": float64(10),
+				},
+				map[string]any{"weight": float64(90)},
+			},
+		}},
+	}
+}
+
+func canaryService(split map[string]any) *adc.Service {
+	return &adc.Service{
+		Metadata: adc.Metadata{Name: "svc"},
+		Upstream: &adc.Upstream{
+			Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 8080, Weight: 100}},
+		},
+		Routes: []*adc.Route{{
+			Metadata: adc.Metadata{Name: "canary"},
+			Uris:     []string{"/"},
+			Plugins:  adc.Plugins{"traffic-split": split},
+		}},
+	}
+}
+
+func TestTransferSplitUpstreams(t *testing.T) {
+	split := canarySplit()
+	resources := &adc.Resources{Services: []*adc.Service{canaryService(split)}}
+
+	transferred, err := TransferResources(resources)
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(transferred.Upstreams) != 0 {
+		t.Fatalf("expected embedded upstreams to be kept by default, got %d upstreams", len(transferred.Upstreams))
+	}
+
+	transferred, err = TransferResources(resources, SplitUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(transferred.Upstreams) != 1 {
+		t.Fatalf("expected one extracted upstream, got %d", len(transferred.Upstreams))
+	}
+	canary := transferred.Upstreams[0]
+	if !reflect.DeepEqual(canary.Nodes, map[string]uint32{"10.0.0.2:8080": 1}) || len(canary.Labels) != 0 {
+		t.Errorf("unexpected extracted upstream %+v", canary)
+	}
+	want := map[string]any{
+		"rules": []any{map[string]any{
+			"weighted_upstreams": []any{
+				map[string]any{"upstream_id": canary.ID, "weight": float64(10)},
+				map[string]any{"weight": float64(90)},
+			},
+		}},
+	}
+	route := transferred.Routes[0]
+	if !reflect.DeepEqual(route.Plugins["traffic-split"], want) {
+		t.Errorf("unexpected rewritten config %v", route.Plugins["traffic-split"])
+	}
+	if !reflect.DeepEqual(split, canarySplit()) {
+		t.Errorf("expected the input config to be left as is, got %v", split)
+	}
+
+	// Extracting again gives the same upstream, and extracting from the
+	// rewritten config changes nothing
+	again, err := TransferResources(resources, SplitUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if again.Upstreams[0].ID != canary.ID || !reflect.DeepEqual(again.Routes[0].Plugins, route.Plugins) {
+		t.Errorf("expected a stable extraction, got upstream %s", again.Upstreams[0].ID)
+	}
+	rewritten, err := TransferResources(&adc.Resources{Services: []*adc.Service{canaryService(want)}}, SplitUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(rewritten.Upstreams) != 0 || !reflect.DeepEqual(rewritten.Routes[0].Plugins["traffic-split"], want) {
+		t.Errorf("expected a rewritten config to be kept, got %v", rewritten.Routes[0].Plugins["traffic-split"])
+	}
+
+	// Exporting inlines the upstream back, which extracts the same again
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, service := range transferred.Services {
+		if err := cache.InsertService(service); err != nil {
+			t.Fatalf("failed to insert service: %v", err)
+		}
+	}
+	if err := cache.InsertRoute(route); err != nil {
+		t.Fatalf("failed to insert route: %v", err)
+	}
+	if err := cache.InsertUpstream(canary); err != nil {
+		t.Fatalf("failed to insert upstream: %v", err)
+	}
+	exported, err := ExportResources(cache)
+	if err != nil {
+		t.Fatalf("failed to export resources: %v", err)
+	}
+	exportedSplit := exported.Services[0].Routes[0].Plugins["traffic-split"].(map[string]any)
+	weighted := exportedSplit["rules"].([]any)[0].(map[string]any)["weighted_upstreams"].([]any)[0].(map[string]any)
+	if _, ok := weighted["upstream_id"]; ok || weighted["upstream"] == nil {
+		t.Fatalf("expected the exported config to embed the upstream, got %v", weighted)
+	}
+	retransferred, err := TransferResources(exported, SplitUpstreams())
+	if err != nil {
+		t.Fatalf("failed to transfer exported resources: %v", err)
+	}
+	if len(retransferred.Upstreams) != 1 || retransferred.Upstreams[0].ID != canary.ID {
+		t.Errorf("expected the exported upstream to extract to %s, got %v", canary.ID, retransferred.Upstreams)
+	}
+	if !reflect.DeepEqual(route.Plugins["traffic-split"], want) {
+		t.Errorf("expected exporting to leave the cached config as is, got %v", route.Plugins["traffic-split"])
+	}
+}
+
+func TestTransferSplitUpstreamsInvalid(t *testing.T) {
+	split := canarySplit()
+	weighted := split["rules"].([]any)[0].(map[string]any)["weighted_upstreams"].([]any)[0].(map[string]any)
+	weighted["upstream"].(map[string]any)["nodes"] = map[string]any{"10.0.0.2:99999": float64(1)}
+	_, err := TransferResources(&adc.Resources{Services: []*adc.Service{canaryService(split)}}, SplitUpstreams())
+	if err == nil {
+		t.Fatal("expected an invalid embedded upstream to fail the transfer")
+	}
+}
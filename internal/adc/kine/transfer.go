@@ -1,16 +1,375 @@
 package kine
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 
 	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
+)
+
+const (
+	// DefaultMaxRetries caps upstream retries unless MaxRetries is given
+	DefaultMaxRetries = 100
+	// MaxRetryTimeout caps upstream retry_timeout, in seconds
+	MaxRetryTimeout = 24 * 60 * 60
+
+	// DefaultMaxDescLength caps descriptions, like APISIX does
+	DefaultMaxDescLength = 256
+	// DefaultMaxLabelKeyLength caps label keys
+	DefaultMaxLabelKeyLength = 64
+	// DefaultMaxLabelValueLength caps label values, like APISIX does
+	DefaultMaxLabelValueLength = 64
+	// DefaultMaxLabels caps the number of labels of a resource
+	DefaultMaxLabels = 16
 )
 
-// TransferService converts an ADC Service to Kine Service and Routes
-func TransferService(adcSvc *adc.Service) (*Service, []*Route, []*Upstream, error) {
+// MetadataLimits caps the size of resource descriptions and labels, in
+// characters. Zero fields use the defaults.
+type MetadataLimits struct {
+	MaxDescLength       int
+	MaxLabelKeyLength   int
+	MaxLabelValueLength int
+	MaxLabels           int
+}
+
+// withDefaults returns the limits with zero fields set to the defaults
+func (l MetadataLimits) withDefaults() MetadataLimits {
+	if l.MaxDescLength == 0 {
+		l.MaxDescLength = DefaultMaxDescLength
+	}
+	if l.MaxLabelKeyLength == 0 {
+		l.MaxLabelKeyLength = DefaultMaxLabelKeyLength
+	}
+	if l.MaxLabelValueLength == 0 {
+		l.MaxLabelValueLength = DefaultMaxLabelValueLength
+	}
+	if l.MaxLabels == 0 {
+		l.MaxLabels = DefaultMaxLabels
+	}
+	return l
+}
+
+// TransferOption configures how ADC resources are transferred
+type TransferOption interface {
+	ApplyToTransfer(*TransferOptions)
+}
+
+// TransferOptions contains options for transfer operations
+type TransferOptions struct {
+	// BestEffort skips resources that fail to transfer and records them as
+	// warnings instead of aborting the whole transfer
+	BestEffort bool
+	// NamespacedIDs includes the owning kind and namespace labels in the
+	// hash input of generated IDs, so that same-named resources in different
+	// namespaces do not collide. Enabling it changes every generated ID.
+	NamespacedIDs bool
+	// SharedUpstreams replaces the inline upstream of services with an
+	// upstream_id reference to one upstream per distinct configuration
+	SharedUpstreams bool
+	// SplitUpstreams replaces the upstreams embedded in the traffic-split
+	// configs of routes and services with an upstream_id reference to one
+	// upstream per distinct configuration, like SharedUpstreams does for
+	// inline service upstreams
+	SplitUpstreams bool
+	// OwnerLabels are stamped on resources carrying no labels in the ADC
+	// input, such as global rules
+	OwnerLabels map[string]string
+	// MaxRetries caps upstream retries, DefaultMaxRetries when zero
+	MaxRetries int64
+	// IDGenerator derives the IDs of services, routes, upstreams and SSLs
+	// without an explicit ID, SHA1IDGenerator when nil. Changing it changes
+	// every generated ID: the next sync deletes and recreates all of them.
+	IDGenerator IDGenerator
+	// MetadataLimits caps descriptions and labels. Oversized ones are
+	// truncated with a warning, or fail the resource when
+	// StrictMetadataLimits is set.
+	MetadataLimits       MetadataLimits
+	StrictMetadataLimits bool
+	// ZeroWeightPolicy handles services whose upstream nodes all have
+	// weight 0, which the data plane can never route to. They fail the
+	// transfer unless it drops or disables their routes with a warning,
+	// as suits endpoints that are all temporarily unready.
+	ZeroWeightPolicy ZeroWeightPolicy
+	// DerivePriorities gives routes without an explicit priority one
+	// derived from the specificity of their paths by DerivePriority
+	DerivePriorities bool
+	// PropagateTimeouts gives routes without a timeout the one of the
+	// upstream serving them, as data planes ignoring upstream and service
+	// timeouts for routes would otherwise use their defaults
+	PropagateTimeouts bool
+	// PluginValidator checks the plugin configurations of routes, services
+	// and global rules. Invalid ones fail the resource, or skip it with a
+	// warning in best effort transfers. Plugins are not validated when nil.
+	PluginValidator PluginValidator
+
+	// warn receives non fatal problems, such as hosts that cannot be
+	// normalized. Set by TransferResources to collect TransferWarnings.
+	warn func(error)
+	// ids records the generated IDs, to detect collisions. Set by
+	// Transferrer, which checks it after each resource.
+	ids *idRegistry
+}
+
+// warnf reports a non fatal transfer problem, if anyone listens
+func (o *TransferOptions) warnf(err error) {
+	if o.warn != nil {
+		o.warn(err)
+	}
+}
+
+func (o *TransferOptions) ApplyToTransfer(to *TransferOptions) {
+	if o.BestEffort {
+		to.BestEffort = o.BestEffort
+	}
+	if o.NamespacedIDs {
+		to.NamespacedIDs = o.NamespacedIDs
+	}
+	if o.SharedUpstreams {
+		to.SharedUpstreams = o.SharedUpstreams
+	}
+	if o.SplitUpstreams {
+		to.SplitUpstreams = o.SplitUpstreams
+	}
+	if o.OwnerLabels != nil {
+		to.OwnerLabels = o.OwnerLabels
+	}
+	if o.MaxRetries != 0 {
+		to.MaxRetries = o.MaxRetries
+	}
+	if o.IDGenerator != nil {
+		to.IDGenerator = o.IDGenerator
+	}
+	if o.MetadataLimits != (MetadataLimits{}) {
+		to.MetadataLimits = o.MetadataLimits
+	}
+	if o.StrictMetadataLimits {
+		to.StrictMetadataLimits = o.StrictMetadataLimits
+	}
+	if o.ZeroWeightPolicy != "" {
+		to.ZeroWeightPolicy = o.ZeroWeightPolicy
+	}
+	if o.DerivePriorities {
+		to.DerivePriorities = o.DerivePriorities
+	}
+	if o.PropagateTimeouts {
+		to.PropagateTimeouts = o.PropagateTimeouts
+	}
+	if o.PluginValidator != nil {
+		to.PluginValidator = o.PluginValidator
+	}
+}
+
+func (o *TransferOptions) ApplyOptions(opts []TransferOption) *TransferOptions {
+	for _, opt := range opts {
+		opt.ApplyToTransfer(o)
+	}
+	return o
+}
+
+type bestEffortOption struct{}
+
+func (bestEffortOption) ApplyToTransfer(o *TransferOptions) {
+	o.BestEffort = true
+}
+
+// BestEffort makes the transfer skip invalid resources, reporting them in
+// TransferredResources.Warnings instead of failing
+func BestEffort() TransferOption {
+	return bestEffortOption{}
+}
+
+type namespacedIDsOption struct{}
+
+func (namespacedIDsOption) ApplyToTransfer(o *TransferOptions) {
+	o.NamespacedIDs = true
+}
+
+// NamespacedIDs scopes generated IDs by the owning kind and namespace labels
+func NamespacedIDs() TransferOption {
+	return namespacedIDsOption{}
+}
+
+type sharedUpstreamsOption struct{}
+
+func (sharedUpstreamsOption) ApplyToTransfer(o *TransferOptions) {
+	o.SharedUpstreams = true
+}
+
+// SharedUpstreams deduplicates identical inline service upstreams
+func SharedUpstreams() TransferOption {
+	return sharedUpstreamsOption{}
+}
+
+type splitUpstreamsOption struct{}
+
+func (splitUpstreamsOption) ApplyToTransfer(o *TransferOptions) {
+	o.SplitUpstreams = true
+}
+
+// SplitUpstreams extracts the upstreams embedded in traffic-split configs
+// into shared upstreams referenced by upstream_id
+func SplitUpstreams() TransferOption {
+	return splitUpstreamsOption{}
+}
+
+type derivePrioritiesOption struct{}
+
+func (derivePrioritiesOption) ApplyToTransfer(o *TransferOptions) {
+	o.DerivePriorities = true
+}
+
+// DerivePriorities derives the priority of routes without one from the
+// specificity of their paths
+func DerivePriorities() TransferOption {
+	return derivePrioritiesOption{}
+}
+
+type propagateTimeoutsOption struct{}
+
+func (propagateTimeoutsOption) ApplyToTransfer(o *TransferOptions) {
+	o.PropagateTimeouts = true
+}
+
+// PropagateTimeouts copies the timeout of the upstream serving a route onto
+// the route when it has none
+func PropagateTimeouts() TransferOption {
+	return propagateTimeoutsOption{}
+}
+
+type pluginValidatorOption struct {
+	validator PluginValidator
+}
+
+func (v pluginValidatorOption) ApplyToTransfer(o *TransferOptions) {
+	o.PluginValidator = v.validator
+}
+
+// ValidatePlugins checks the plugin configurations of routes, services and
+// global rules with validator
+func ValidatePlugins(validator PluginValidator) TransferOption {
+	return pluginValidatorOption{validator: validator}
+}
+
+type ownerLabelsOption map[string]string
+
+func (l ownerLabelsOption) ApplyToTransfer(o *TransferOptions) {
+	o.OwnerLabels = l
+}
+
+// OwnerLabels sets the labels stamped on global rules
+func OwnerLabels(labels map[string]string) TransferOption {
+	return ownerLabelsOption(labels)
+}
+
+type maxRetriesOption int64
+
+func (m maxRetriesOption) ApplyToTransfer(o *TransferOptions) {
+	o.MaxRetries = int64(m)
+}
+
+// MaxRetries sets the highest accepted upstream retries
+func MaxRetries(n int64) TransferOption {
+	return maxRetriesOption(n)
+}
+
+type idGeneratorOption struct {
+	generator IDGenerator
+}
+
+func (g idGeneratorOption) ApplyToTransfer(o *TransferOptions) {
+	o.IDGenerator = g.generator
+}
+
+// UseIDGenerator sets the generator of resource IDs. This is a breaking
+// migration: every generated ID changes, so the next sync replaces all the
+// resources without an explicit ID.
+func UseIDGenerator(generator IDGenerator) TransferOption {
+	return idGeneratorOption{generator: generator}
+}
+
+type metadataLimitsOption MetadataLimits
+
+func (l metadataLimitsOption) ApplyToTransfer(o *TransferOptions) {
+	o.MetadataLimits = MetadataLimits(l)
+}
+
+// LimitMetadata sets the limits of descriptions and labels
+func LimitMetadata(limits MetadataLimits) TransferOption {
+	return metadataLimitsOption(limits)
+}
+
+type strictMetadataLimitsOption struct{}
+
+func (strictMetadataLimitsOption) ApplyToTransfer(o *TransferOptions) {
+	o.StrictMetadataLimits = true
+}
+
+// StrictMetadataLimits fails resources exceeding the metadata limits
+// instead of truncating them
+func StrictMetadataLimits() TransferOption {
+	return strictMetadataLimitsOption{}
+}
+
+// ZeroWeightPolicy is what the transfer does with services whose upstream
+// nodes all have weight 0
+type ZeroWeightPolicy string
+
+const (
+	// ZeroWeightReject fails the service, the default
+	ZeroWeightReject ZeroWeightPolicy = "reject"
+	// ZeroWeightDropRoutes transfers the service without its routes
+	ZeroWeightDropRoutes ZeroWeightPolicy = "drop-routes"
+	// ZeroWeightDisableRoutes transfers the routes of the service disabled
+	ZeroWeightDisableRoutes ZeroWeightPolicy = "disable-routes"
+)
+
+type zeroWeightPolicyOption ZeroWeightPolicy
+
+func (p zeroWeightPolicyOption) ApplyToTransfer(o *TransferOptions) {
+	o.ZeroWeightPolicy = ZeroWeightPolicy(p)
+}
+
+// HandleZeroWeightUpstreams sets what the transfer does with services whose
+// upstream nodes all have weight 0
+func HandleZeroWeightUpstreams(policy ZeroWeightPolicy) TransferOption {
+	return zeroWeightPolicyOption(policy)
+}
+
+// TransferWarning describes a resource skipped during a best-effort transfer,
+// or a resource transferred with a problem worked around, such as an invalid
+// host
+type TransferWarning struct {
+	Kind   string            `json:"kind"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Cause  error             `json:"-"`
+}
+
+func (w TransferWarning) Error() string {
+	return fmt.Sprintf("%s %s: %v", w.Kind, w.Name, w.Cause)
+}
+
+func (w TransferWarning) Unwrap() error {
+	return w.Cause
+}
+
+// TransferService converts an ADC Service to Kine Service and Routes. Its
+// errors wrap ErrInvalidInput.
+func TransferService(adcSvc *adc.Service, opts ...TransferOption) (*Service, []*Route, []*Upstream, error) {
+	service, routes, upstreams, err := transferService(adcSvc, (&TransferOptions{}).ApplyOptions(opts))
+	return service, routes, upstreams, invalidInput(err)
+}
+
+func transferService(adcSvc *adc.Service, o *TransferOptions) (*Service, []*Route, []*Upstream, error) {
 	if adcSvc == nil {
 		return nil, nil, nil, fmt.Errorf("adc service is nil")
 	}
@@ -20,26 +379,98 @@ func TransferService(adcSvc *adc.Service) (*Service, []*Route, []*Upstream, erro
 		return nil, nil, nil, fmt.Errorf("adc service upstream is nil")
 	}
 
+	// Limit the service metadata first, its labels are copied to upstreams
+	limitedSvc := *adcSvc
+	if err := o.limitMetadata("service "+adcSvc.Name, &limitedSvc.Metadata); err != nil {
+		return nil, nil, nil, err
+	}
+	adcSvc = &limitedSvc
+
 	// Convert ADC Service to Kine Service
 	kineSvc := &Service{
 		Metadata: adc.Metadata{
-			ID:     generateServiceID(adcSvc),
+			ID:     generateServiceID(adcSvc, o),
 			Name:   adcSvc.Name,
 			Desc:   adcSvc.Desc,
 			Labels: copyLabels(adcSvc.Labels),
 		},
 		Plugins:  convertPlugins(adcSvc.Plugins),
-		Upstream: convertUpstream(adcSvc.Upstream, adcSvc),
+		Upstream: convertUpstream(adcSvc.Upstream, adcSvc, o),
 		Hosts:    copyStringSlice(adcSvc.Hosts),
+
+		EnableWebsocket: copyBool(adcSvc.EnableWebsocket),
+	}
+	if err := ValidateID(kineSvc.ID); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := o.validatePlugins(ResourceTypeService, adcSvc.Name, kineSvc.Plugins); err != nil {
+		return nil, nil, nil, err
+	}
+	// Hosts are checked before they are normalized, which only warns
+	if err := kineSvc.validateHosts(); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid hosts (labels %v): %w", adcSvc.Labels, err)
+	}
+	kineSvc.Hosts = normalizeHosts(adcSvc.Hosts, o)
+	if err := validateUpstreamID(kineSvc.Upstream); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := o.limitMetadata("upstream "+kineSvc.Upstream.Name, &kineSvc.Upstream.Metadata); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateUpstreamTimeout(kineSvc.Upstream); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateUpstreamRetries(adcSvc.Upstream, adcSvc, o); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateUpstreamNodes(adcSvc.Upstream, adcSvc); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(adcSvc.Routes) > 0 {
+		if err := validateHTTPUpstreamScheme(kineSvc.Upstream); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	adcRoutes, disableRoutes := adcSvc.Routes, false
+	if err := validateUpstreamNodeHosts(kineSvc.Upstream); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateUpstreamWeights(kineSvc.Upstream); err != nil {
+		switch o.ZeroWeightPolicy {
+		case ZeroWeightDropRoutes:
+			o.warnf(fmt.Errorf("%w, dropping the routes of the service", err))
+			adcRoutes = nil
+		case ZeroWeightDisableRoutes:
+			o.warnf(fmt.Errorf("%w, disabling the routes of the service", err))
+			disableRoutes = true
+		default:
+			return nil, nil, nil, err
+		}
 	}
 
 	// Convert ADC Routes to Kine Routes
-	kineRoutes := make([]*Route, 0, len(adcSvc.Routes))
-	for _, adcRoute := range adcSvc.Routes {
-		kineRoute, err := convertRoute(adcRoute, adcSvc)
+	kineRoutes := make([]*Route, 0, len(adcRoutes))
+	for i, adcRoute := range adcRoutes {
+		// Generated route IDs hash the route name, anonymous routes of a
+		// service would share an ID and overwrite each other
+		if adcRoute != nil && adcRoute.ID == "" && adcRoute.Name == "" {
+			return nil, nil, nil, fmt.Errorf("route %d of service %s (uris %v) has neither id nor name",
+				i, adcSvc.Name, adcRoute.Uris)
+		}
+		kineRoute, err := convertRoute(adcRoute, adcSvc, kineSvc.ID, o)
+		if err == nil {
+			err = ValidateID(kineRoute.ID)
+		}
+		if err == nil {
+			err = o.limitMetadata("route "+kineRoute.Name, &kineRoute.Metadata)
+		}
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to convert route: %w", err)
 		}
+		if disableRoutes {
+			status := RouteStatusDisabled
+			kineRoute.Status = &status
+		}
 		kineRoutes = append(kineRoutes, kineRoute)
 	}
 
@@ -47,81 +478,348 @@ func TransferService(adcSvc *adc.Service) (*Service, []*Route, []*Upstream, erro
 	kineUpstreams := make([]*Upstream, 0, len(adcSvc.Upstreams))
 	if adcSvc.Upstreams != nil {
 		for _, adcUpstream := range adcSvc.Upstreams {
-			kineUpstream := convertUpstream(adcUpstream, adcSvc)
+			kineUpstream := convertUpstream(adcUpstream, adcSvc, o)
+			if err := validateUpstreamID(kineUpstream); err != nil {
+				return nil, nil, nil, err
+			}
+			if err := validateUpstreamTimeout(kineUpstream); err != nil {
+				return nil, nil, nil, err
+			}
+			if err := validateUpstreamNodeHosts(kineUpstream); err != nil {
+				return nil, nil, nil, err
+			}
+			if err := validateUpstreamRetries(adcUpstream, adcSvc, o); err != nil {
+				return nil, nil, nil, err
+			}
+			if err := validateUpstreamNodes(adcUpstream, adcSvc); err != nil {
+				return nil, nil, nil, err
+			}
+			if kineUpstream != nil {
+				if err := o.limitMetadata("upstream "+kineUpstream.Name, &kineUpstream.Metadata); err != nil {
+					return nil, nil, nil, err
+				}
+			}
 			kineUpstreams = append(kineUpstreams, kineUpstream)
 		}
 	}
 
+	if o.SplitUpstreams {
+		plugins, splitUpstreams, err := extractSplitUpstreams(kineSvc.Plugins, adcSvc, o)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		kineSvc.Plugins = plugins
+		kineUpstreams = append(kineUpstreams, splitUpstreams...)
+		for _, kineRoute := range kineRoutes {
+			plugins, splitUpstreams, err := extractSplitUpstreams(kineRoute.Plugins, adcSvc, o)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to convert route: route %s: %w", kineRoute.Name, err)
+			}
+			kineRoute.Plugins = plugins
+			kineUpstreams = append(kineUpstreams, splitUpstreams...)
+		}
+	}
+
 	return kineSvc, kineRoutes, kineUpstreams, nil
 }
 
-// generateServiceID generates service ID from name using SHA1
-func generateServiceID(adcSvc *adc.Service) string {
+// validateUpstreamWeights rejects upstreams with nodes that all have weight
+// 0. Upstreams without nodes are left to the other checks.
+func validateUpstreamWeights(upstream *Upstream) error {
+	if upstream == nil || len(upstream.Nodes) == 0 || upstream.hasWeightedNode() {
+		return nil
+	}
+	return fmt.Errorf("upstream %s has no node with a weight above 0", upstream.Name)
+}
+
+// validateUpstreamNodeHosts rejects upstreams mixing domain name and IP
+// nodes
+func validateUpstreamNodeHosts(upstream *Upstream) error {
+	if upstream == nil {
+		return nil
+	}
+	return upstream.validateNodeHosts()
+}
+
+// validateUpstreamTimeout rejects invalid upstream timeouts before they reach etcd
+func validateUpstreamTimeout(upstream *Upstream) error {
+	if upstream == nil || upstream.Timeout == nil {
+		return nil
+	}
+	if err := upstream.Timeout.Validate(); err != nil {
+		return fmt.Errorf("invalid upstream %s timeout: %w", upstream.Name, err)
+	}
+	return nil
+}
+
+// validateUpstreamRetries rejects retries and retry_timeout values that do
+// not fit the Kine types, a negative retries would wrap to an endless retry
+// storm
+func validateUpstreamRetries(adcUpstream *adc.Upstream, adcSvc *adc.Service, o *TransferOptions) error {
+	if adcUpstream == nil {
+		return nil
+	}
+	name := adcUpstream.Name
+	if name == "" {
+		name = adcSvc.Name
+	}
+	if adcUpstream.Retries != nil {
+		maxRetries := o.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = DefaultMaxRetries
+		}
+		if retries := *adcUpstream.Retries; retries < 0 || retries > maxRetries {
+			return fmt.Errorf("invalid upstream %s retries %d: must be between 0 and %d", name, retries, maxRetries)
+		}
+	}
+	if adcUpstream.RetryTimeout != nil {
+		retryTimeout := *adcUpstream.RetryTimeout
+		if math.IsNaN(retryTimeout) || retryTimeout < 0 || retryTimeout > MaxRetryTimeout {
+			return fmt.Errorf("invalid upstream %s retry_timeout %v: must be between 0 and %d",
+				name, retryTimeout, MaxRetryTimeout)
+		}
+	}
+	return nil
+}
+
+// validateUpstreamNodes rejects nodes whose host, port or weight would
+// not survive the conversion: a node key APISIX cannot parse, or a
+// negative weight wrapping to a huge one
+func validateUpstreamNodes(adcUpstream *adc.Upstream, adcSvc *adc.Service) error {
+	if adcUpstream == nil {
+		return nil
+	}
+	name := adcUpstream.Name
+	if name == "" {
+		name = adcSvc.Name
+	}
+	for _, node := range adcUpstream.Nodes {
+		if node.Host == "" || !NODE_KEY_REGEX.MatchString(node.Host) {
+			return fmt.Errorf("invalid upstream %s node host %q", name, node.Host)
+		}
+		if node.Port < 1 || node.Port > math.MaxUint16 {
+			return fmt.Errorf("invalid upstream %s node %s port %d: must be between 1 and %d",
+				name, node.Host, node.Port, math.MaxUint16)
+		}
+		if node.Weight < 0 || int64(node.Weight) > math.MaxUint32 {
+			return fmt.Errorf("invalid upstream %s node %s weight %d: must be between 0 and %d",
+				name, node.Host, node.Weight, uint32(math.MaxUint32))
+		}
+	}
+	return nil
+}
+
+// validateUpstreamID validates the ID of an upstream, inline upstreams
+// may have none
+func validateUpstreamID(upstream *Upstream) error {
+	if upstream == nil || upstream.ID == "" {
+		return nil
+	}
+	return ValidateID(upstream.ID)
+}
+
+// generateServiceID generates service ID from name
+func generateServiceID(adcSvc *adc.Service, o *TransferOptions) string {
 	if adcSvc.ID != "" {
 		return adcSvc.ID
 	}
-	return sha1Hash(adcSvc.Name)
+	return o.generateID(idScope(adcSvc.Labels, o) + adcSvc.Name)
 }
 
-// generateRouteID generates route ID from service name and route name using SHA1
-func generateRouteID(adcRoute *adc.Route, adcSvc *adc.Service) string {
+// generateRouteID generates route ID from service name and route name
+func generateRouteID(adcRoute *adc.Route, adcSvc *adc.Service, o *TransferOptions) string {
 	if adcRoute.ID != "" {
 		return adcRoute.ID
 	}
-	return sha1Hash(adcSvc.Name + "." + adcRoute.Name)
+	return o.generateID(idScope(adcSvc.Labels, o) + adcSvc.Name + "." + adcRoute.Name)
 }
 
-// sha1Hash generates SHA1 hash of the input string
-func sha1Hash(input string) string {
-	hash := sha1.New()
-	hash.Write([]byte(input))
-	return hex.EncodeToString(hash.Sum(nil))
+// generateUpstreamID generates the ID of an upstream of a service from its
+// name, when it has no ID
+func generateUpstreamID(adcUpstream *adc.Upstream, adcSvc *adc.Service, o *TransferOptions) string {
+	if adcUpstream.ID != "" || adcUpstream.Name == "" {
+		return adcUpstream.ID
+	}
+	return o.generateID(idScope(adcSvc.Labels, o) + adcUpstream.Name)
 }
 
-// convertRoute converts an ADC Route to Kine Route
-func convertRoute(adcRoute *adc.Route, adcSvc *adc.Service) (*Route, error) {
+// idScope returns the hash input prefix scoping generated IDs to the owning
+// kind and namespace, or an empty string when NamespacedIDs is disabled
+func idScope(labels map[string]string, o *TransferOptions) string {
+	if !o.NamespacedIDs {
+		return ""
+	}
+	kind, namespace := labels[label.LabelKind], labels[label.LabelNamespace]
+	if kind == "" && namespace == "" {
+		return ""
+	}
+	return kind + "/" + namespace + "/"
+}
+
+// shareUpstream returns the shared form of an inline service upstream. Its
+// ID is generated from its configuration, so services with identical
+// upstreams share it. Shared upstreams carry no owner labels: they are not
+// deleted by label scoped syncs, only by full syncs once no service
+// references them.
+func shareUpstream(u *Upstream, o *TransferOptions) (*Upstream, error) {
+	shared := u.DeepCopy()
+	shared.Metadata = adc.Metadata{}
+	data, err := CanonicalJSON(shared)
+	if err != nil {
+		return nil, err
+	}
+	shared.ID = o.generateID(string(data))
+	shared.Name = "shared-" + shared.ID
+	return shared, nil
+}
+
+// convertRoute converts an ADC Route of the service with the given ID to
+// a Kine Route
+func convertRoute(adcRoute *adc.Route, adcSvc *adc.Service, serviceID string, o *TransferOptions) (*Route, error) {
 	if adcRoute == nil {
 		return nil, fmt.Errorf("adc route is nil")
 	}
+	// filter_func is a Lua function, which pingsix cannot run. Dropping it
+	// would match requests the route was meant to filter out.
+	if adcRoute.FilterFunc != "" {
+		return nil, fmt.Errorf("route %s has a filter_func, which is not supported", adcRoute.Name)
+	}
+	if len(adcRoute.Uris) == 0 {
+		return nil, fmt.Errorf("route %s has no uris", adcRoute.Name)
+	}
 
 	kineRoute := &Route{
 		Metadata: adc.Metadata{
-			ID:     generateRouteID(adcRoute, adcSvc),
+			ID:     generateRouteID(adcRoute, adcSvc, o),
 			Name:   adcRoute.Name,
 			Desc:   adcRoute.Desc,
-			Labels: copyLabels(adcRoute.Labels),
+			Labels: inheritOwnerLabels(adcRoute.Labels, adcSvc.Labels),
 		},
 		URIs:    copyStringSlice(adcRoute.Uris),
 		Methods: convertMethods(adcRoute.Methods),
-		Hosts:   copyStringSlice(adcRoute.Hosts),
+		Hosts:   normalizeHosts(adcRoute.Hosts, o),
 		Plugins: convertPlugins(adcRoute.Plugins),
 		Timeout: convertTimeout(adcRoute.Timeout),
+		Vars:    copyVars(adcRoute.Vars),
+	}
+	if kineRoute.Timeout == nil && o.PropagateTimeouts {
+		kineRoute.Timeout = upstreamTimeout(adcRoute, adcSvc, o)
+	}
+
+	if kineRoute.Timeout != nil {
+		if err := kineRoute.Timeout.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid route %s timeout: %w", adcRoute.Name, err)
+		}
+	}
+	if err := o.validatePlugins(ResourceTypeRoute, adcRoute.Name, kineRoute.Plugins); err != nil {
+		return nil, err
 	}
 
 	// Set ServiceID to reference the parent service
-	serviceID := generateServiceID(adcSvc)
 	kineRoute.ServiceID = &serviceID
 
+	// Canary routes of traffic splits override the upstream of the service
+	if adcRoute.Upstream != nil {
+		upstream, err := convertRouteUpstream(adcRoute.Upstream, adcSvc, o)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s upstream: %w", adcRoute.Name, err)
+		}
+		kineRoute.Upstream = upstream
+	}
+	if adcRoute.UpstreamID != "" {
+		if err := ValidateID(adcRoute.UpstreamID); err != nil {
+			return nil, fmt.Errorf("invalid route %s upstream_id: %w", adcRoute.Name, err)
+		}
+		upstreamID := adcRoute.UpstreamID
+		kineRoute.UpstreamID = &upstreamID
+	}
+
 	// Convert priority
 	if adcRoute.Priority != nil {
-		// ADC uses int64, Kine uses uint32
-		kineRoute.Priority = uint32(*adcRoute.Priority)
+		// ADC uses int64, Kine uses uint32: a negative priority would wrap
+		// to the highest one
+		priority := *adcRoute.Priority
+		if priority < 0 || priority > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid route %s priority %d: must be between 0 and %d",
+				adcRoute.Name, priority, uint32(math.MaxUint32))
+		}
+		kineRoute.Priority = uint32(priority)
+	} else if o.DerivePriorities {
+		kineRoute.Priority = DerivePriority(kineRoute)
+	}
+
+	if adcRoute.Status != nil {
+		status := int(*adcRoute.Status)
+		if status != RouteStatusDisabled && status != RouteStatusEnabled {
+			return nil, fmt.Errorf("invalid route %s status %d: must be %d or %d",
+				adcRoute.Name, status, RouteStatusDisabled, RouteStatusEnabled)
+		}
+		kineRoute.Status = &status
 	}
 
 	return kineRoute, nil
 }
 
+// upstreamTimeout returns the timeout of the upstream serving a route: its
+// inline upstream, the upstream of the service its upstream_id references,
+// explicit or generated, else the upstream of the service. Routes
+// referencing an upstream outside the service get none, its timeout is
+// unknown.
+func upstreamTimeout(adcRoute *adc.Route, adcSvc *adc.Service, o *TransferOptions) *Timeout {
+	upstream := adcSvc.Upstream
+	switch {
+	case adcRoute.Upstream != nil:
+		upstream = adcRoute.Upstream
+	case adcRoute.UpstreamID != "":
+		upstream = nil
+		for _, adcUpstream := range adcSvc.Upstreams {
+			if adcUpstream != nil && generateUpstreamID(adcUpstream, adcSvc, o) == adcRoute.UpstreamID {
+				upstream = adcUpstream
+				break
+			}
+		}
+	}
+	if upstream == nil {
+		return nil
+	}
+	return convertTimeout(upstream.Timeout)
+}
+
+// convertRouteUpstream converts the inline upstream of a route, checked
+// like the upstreams of services
+func convertRouteUpstream(adcUpstream *adc.Upstream, adcSvc *adc.Service, o *TransferOptions) (*Upstream, error) {
+	upstream := convertUpstream(adcUpstream, adcSvc, o)
+	if err := validateUpstreamID(upstream); err != nil {
+		return nil, err
+	}
+	if err := validateHTTPUpstreamScheme(upstream); err != nil {
+		return nil, err
+	}
+	if err := validateUpstreamTimeout(upstream); err != nil {
+		return nil, err
+	}
+	if err := validateUpstreamRetries(adcUpstream, adcSvc, o); err != nil {
+		return nil, err
+	}
+	if err := validateUpstreamNodes(adcUpstream, adcSvc); err != nil {
+		return nil, err
+	}
+	if err := validateUpstreamNodeHosts(upstream); err != nil {
+		return nil, err
+	}
+	if err := validateUpstreamWeights(upstream); err != nil {
+		return nil, err
+	}
+	return upstream, nil
+}
+
 // convertUpstream converts ADC Upstream to Kine Upstream
-func convertUpstream(adcUpstream *adc.Upstream, adcSvc *adc.Service) *Upstream {
+func convertUpstream(adcUpstream *adc.Upstream, adcSvc *adc.Service, o *TransferOptions) *Upstream {
 	if adcUpstream == nil {
 		return nil
 	}
 
-	// Generate upstream ID if not provided
-	upstreamID := adcUpstream.ID
-	if upstreamID == "" && adcUpstream.Name != "" {
-		upstreamID = sha1Hash(adcUpstream.Name)
-	}
+	upstreamID := generateUpstreamID(adcUpstream, adcSvc, o)
 
 	kineUpstream := &Upstream{
 		Metadata: adc.Metadata{
@@ -134,10 +832,12 @@ func convertUpstream(adcUpstream *adc.Upstream, adcSvc *adc.Service) *Upstream {
 		Type:     convertUpstreamType(adcUpstream.Type),
 		HashOn:   convertHashOn(adcUpstream.HashOn),
 		Key:      adcUpstream.Key,
-		Scheme:   convertScheme(adcUpstream.Scheme),
-		PassHost: convertPassHost(adcUpstream.PassHost),
+		Scheme:   convertScheme(adcUpstream.Scheme, o),
+		PassHost: convertPassHost(adcUpstream.PassHost, o),
 		Timeout:  convertTimeout(adcUpstream.Timeout),
 		Checks:   convertHealthCheck(adcUpstream.Checks),
+
+		KeepalivePool: convertKeepalivePool(adcUpstream.KeepalivePool),
 	}
 
 	// Convert retries
@@ -157,6 +857,10 @@ func convertUpstream(adcUpstream *adc.Upstream, adcSvc *adc.Service) *Upstream {
 		kineUpstream.UpstreamHost = &adcUpstream.UpstreamHost
 	}
 
+	// Domain name nodes, of ExternalName services for instance, are
+	// resolved by the data plane
+	kineUpstream.DNSResolveOnNodes = kineUpstream.hasDomainNode()
+
 	return kineUpstream
 }
 
@@ -205,9 +909,9 @@ func convertHashOn(hashOn string) UpstreamHashOn {
 }
 
 // convertScheme converts ADC scheme to Kine UpstreamScheme
-func convertScheme(scheme string) UpstreamScheme {
+func convertScheme(scheme string, o *TransferOptions) UpstreamScheme {
 	switch scheme {
-	case "http":
+	case "", "http":
 		return UpstreamSchemeHTTP
 	case "https":
 		return UpstreamSchemeHTTPS
@@ -215,21 +919,38 @@ func convertScheme(scheme string) UpstreamScheme {
 		return UpstreamSchemeGRPC
 	case "grpcs":
 		return UpstreamSchemeGRPCS
+	case "tcp":
+		return UpstreamSchemeTCP
+	case "tls":
+		return UpstreamSchemeTLS
+	case "udp":
+		return UpstreamSchemeUDP
 	default:
+		o.warnf(fmt.Errorf("unknown upstream scheme %q, falling back to %s", scheme, UpstreamSchemeHTTP))
 		return UpstreamSchemeHTTP
 	}
 }
 
+// validateHTTPUpstreamScheme rejects the stream schemes on upstreams of HTTP
+// routes, only stream routes can proxy tcp, tls and udp
+func validateHTTPUpstreamScheme(upstream *Upstream) error {
+	if upstream == nil || !upstream.Scheme.IsStream() {
+		return nil
+	}
+	return fmt.Errorf("upstream %s has the stream scheme %s, HTTP routes cannot use it", upstream.Name, upstream.Scheme)
+}
+
 // convertPassHost converts ADC pass_host to Kine UpstreamPassHost
-func convertPassHost(passHost string) UpstreamPassHost {
+func convertPassHost(passHost string, o *TransferOptions) UpstreamPassHost {
 	switch passHost {
-	case "pass":
+	case "", "pass":
 		return UpstreamPassHostPass
 	case "rewrite":
 		return UpstreamPassHostRewrite
 	case "node":
 		return UpstreamPassHostNode
 	default:
+		o.warnf(fmt.Errorf("unknown pass_host %q, falling back to %s", passHost, UpstreamPassHostPass))
 		return UpstreamPassHostPass
 	}
 }
@@ -246,6 +967,18 @@ func convertTimeout(adcTimeout *adc.Timeout) *Timeout {
 	}
 }
 
+// convertKeepalivePool converts ADC keepalive pool to Kine keepalive pool
+func convertKeepalivePool(adcPool *adc.UpstreamKeepalivePool) *KeepalivePool {
+	if adcPool == nil {
+		return nil
+	}
+	return &KeepalivePool{
+		Size:        uint32(adcPool.Size),
+		IdleTimeout: adcPool.IdleTimeout,
+		Requests:    uint32(adcPool.Requests),
+	}
+}
+
 // convertHealthCheck converts ADC health check to Kine health check
 func convertHealthCheck(adcCheck *adc.UpstreamHealthCheck) *HealthCheck {
 	if adcCheck == nil || adcCheck.Active == nil {
@@ -272,8 +1005,19 @@ func convertHealthCheck(adcCheck *adc.UpstreamHealthCheck) *HealthCheck {
 		kineCheck.Active.Port = &port
 	}
 
-	// Convert HTTPS verify certificate
-	kineCheck.Active.HTTPSVerifyCertificate = adcCheck.Active.HTTPSVerifyCert
+	// HTTPS settings only apply to https probes
+	if kineCheck.Active.Type == ActiveCheckTypeHTTPS {
+		// Left unset, verification gets the default of
+		// GetHTTPSVerifyCertificate below
+		if adcCheck.Active.HTTPSVerifyCert != nil {
+			verify := *adcCheck.Active.HTTPSVerifyCert
+			kineCheck.Active.HTTPSVerifyCertificate = &verify
+		}
+		if adcCheck.Active.HTTPSSni != "" {
+			sni := adcCheck.Active.HTTPSSni
+			kineCheck.Active.HTTPSSni = &sni
+		}
+	}
 
 	// Convert healthy
 	kineCheck.Active.Healthy = &Health{
@@ -288,6 +1032,14 @@ func convertHealthCheck(adcCheck *adc.UpstreamHealthCheck) *HealthCheck {
 		TCPFailures:  uint32(adcCheck.Active.Unhealthy.TCPFailures),
 	}
 
+	// Materialize the defaults of the getters, so that etcd carries the
+	// values the data plane probes with rather than leaving them to its own
+	// defaults. The differ applies the same defaults, cached checks without
+	// them compare equal.
+	kineCheck.Active = activeCheckWithDefaults(kineCheck.Active)
+	kineCheck.Active.Healthy = healthWithDefaults(kineCheck.Active.Healthy)
+	kineCheck.Active.Unhealthy = unhealthyWithDefaults(kineCheck.Active.Unhealthy)
+
 	return kineCheck
 }
 
@@ -326,6 +1078,29 @@ func convertPlugins(adcPlugins adc.Plugins) map[string]any {
 	return plugins
 }
 
+// ownerLabelKeys are the labels owning an object, selected by label scoped
+// syncs and diffs
+var ownerLabelKeys = []string{label.LabelKind, label.LabelNamespace, label.LabelName}
+
+// inheritOwnerLabels returns a copy of labels completed with the owner
+// labels of parent it lacks. Objects generated without labels, such as the
+// routes of some translations, would otherwise be invisible to the diffs
+// scoped by the selector of their parent and never be deleted.
+func inheritOwnerLabels(labels, parent map[string]string) map[string]string {
+	inherited := copyLabels(labels)
+	for _, key := range ownerLabelKeys {
+		value, ok := parent[key]
+		if _, has := inherited[key]; has || !ok {
+			continue
+		}
+		if inherited == nil {
+			inherited = make(map[string]string, len(ownerLabelKeys))
+		}
+		inherited[key] = value
+	}
+	return inherited
+}
+
 // copyLabels creates a copy of labels map
 func copyLabels(labels map[string]string) map[string]string {
 	if labels == nil {
@@ -338,6 +1113,158 @@ func copyLabels(labels map[string]string) map[string]string {
 	return copied
 }
 
+// limitMetadata applies the metadata limits to m, naming it what in the
+// reported problems. The owner labels indexed by KineLabelIndexer are never
+// cut, that would detach the resource from its owner. Limits are applied at
+// transfer time, so the diff only ever sees limited metadata.
+func (o *TransferOptions) limitMetadata(what string, m *adc.Metadata) error {
+	limits := o.MetadataLimits.withDefaults()
+	if withinLimits(m, limits) {
+		return nil
+	}
+	// Each problem is reported with the fix applied unless strict
+	var problems, fixes []string
+	report := func(fix, format string, args ...any) {
+		problems = append(problems, what+" "+fmt.Sprintf(format, args...))
+		fixes = append(fixes, fix)
+	}
+	if utf8.RuneCountInString(m.Desc) > limits.MaxDescLength {
+		report("truncated", "desc is longer than %d characters", limits.MaxDescLength)
+		m.Desc = truncate(m.Desc, limits.MaxDescLength)
+	}
+
+	// Owner labels first, so that they survive the label count limit
+	keys := make([]string, 0, len(m.Labels))
+	for _, key := range KineLabelIndexer.LabelKeys {
+		if _, ok := m.Labels[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.Labels)) {
+		if !slices.Contains(KineLabelIndexer.LabelKeys, key) {
+			keys = append(keys, key)
+		}
+	}
+	var limited map[string]string
+	if m.Labels != nil {
+		limited = make(map[string]string, len(m.Labels))
+	}
+	for _, key := range keys {
+		value := m.Labels[key]
+		owner := slices.Contains(KineLabelIndexer.LabelKeys, key)
+		switch {
+		case !owner && len(limited) >= limits.MaxLabels:
+			report("dropped", "label %s is over the limit of %d labels", key, limits.MaxLabels)
+		case !owner && utf8.RuneCountInString(key) > limits.MaxLabelKeyLength:
+			report("dropped", "label key %s... is longer than %d characters",
+				truncate(key, limits.MaxLabelKeyLength), limits.MaxLabelKeyLength)
+		case !owner && utf8.RuneCountInString(value) > limits.MaxLabelValueLength:
+			report("truncated", "label %s is longer than %d characters", key, limits.MaxLabelValueLength)
+			limited[key] = truncate(value, limits.MaxLabelValueLength)
+		default:
+			limited[key] = value
+		}
+	}
+	m.Labels = limited
+
+	if o.StrictMetadataLimits && len(problems) > 0 {
+		return fmt.Errorf("metadata exceeds limits: %s", strings.Join(problems, "; "))
+	}
+	for i, problem := range problems {
+		o.warnf(fmt.Errorf("%s, %s", problem, fixes[i]))
+	}
+	return nil
+}
+
+// withinLimits reports whether m needs no change to fit limits, sparing
+// the copies of limitMetadata in the common case
+func withinLimits(m *adc.Metadata, limits MetadataLimits) bool {
+	if len(m.Desc) > limits.MaxDescLength || len(m.Labels) > limits.MaxLabels {
+		// Multibyte descriptions may still fit, let the slow path count
+		return false
+	}
+	for key, value := range m.Labels {
+		if len(key) > limits.MaxLabelKeyLength || len(value) > limits.MaxLabelValueLength {
+			return false
+		}
+	}
+	return true
+}
+
+// truncate cuts s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// hostProfile converts hosts to their ASCII form. Underscores and other
+// characters outside of STD3 are tolerated, as Kubernetes lets them through.
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+)
+
+// InvalidHostError is reported for hosts that cannot be converted to ASCII
+type InvalidHostError struct {
+	Host  string
+	Cause error
+}
+
+func (e *InvalidHostError) Error() string {
+	return fmt.Sprintf("invalid host %q: %v", e.Host, e.Cause)
+}
+
+func (e *InvalidHostError) Unwrap() error {
+	return e.Cause
+}
+
+// normalizeHosts lowercases hosts and converts IDN labels to punycode, so
+// that they match Host headers and SNIs as sent on the wire. Hosts that
+// cannot be converted are kept lowercased and reported as warnings.
+func normalizeHosts(hosts []string, o *TransferOptions) []string {
+	if hosts == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		ascii, err := normalizeHost(host)
+		if err != nil {
+			o.warnf(err)
+			ascii = strings.ToLower(host)
+		}
+		normalized = append(normalized, ascii)
+	}
+	return normalized
+}
+
+// validateHost checks a host the way SNIs are checked when they are
+// normalized, rejecting wildcards anywhere but in the leading label
+func validateHost(host string) error {
+	name, _ := strings.CutPrefix(host, "*.")
+	if name == "" || strings.Contains(name, "*") {
+		return &InvalidHostError{Host: host, Cause: errors.New("expected a DNS name or a leading *. wildcard")}
+	}
+	_, err := normalizeHost(host)
+	return err
+}
+
+// normalizeHost converts a single host, keeping a leading wildcard label
+func normalizeHost(host string) (string, error) {
+	name, wildcard := strings.CutPrefix(host, "*.")
+	ascii, err := hostProfile.ToASCII(name)
+	if err != nil {
+		return "", &InvalidHostError{Host: host, Cause: err}
+	}
+	ascii = strings.ToLower(ascii)
+	if wildcard {
+		return "*." + ascii, nil
+	}
+	return ascii, nil
+}
+
 // copyStringSlice creates a copy of string slice
 func copyStringSlice(slice []string) []string {
 	if slice == nil {
@@ -361,7 +1288,12 @@ func convertIntSliceToUint32(intSlice []int) []uint32 {
 // Since ADC SSL supports multiple certificates and Kine SSL supports only one,
 // this function returns multiple Kine SSLs if there are multiple certificates.
 // Note: Kine does not support client certificates, so client-type SSLs are ignored.
-func TransferSSL(adcSSL *adc.SSL) ([]*SSL, error) {
+func TransferSSL(adcSSL *adc.SSL, opts ...TransferOption) ([]*SSL, error) {
+	ssls, err := transferSSL(adcSSL, (&TransferOptions{}).ApplyOptions(opts))
+	return ssls, invalidInput(err)
+}
+
+func transferSSL(adcSSL *adc.SSL, o *TransferOptions) ([]*SSL, error) {
 	if adcSSL == nil {
 		return nil, fmt.Errorf("adc ssl is nil")
 	}
@@ -379,23 +1311,42 @@ func TransferSSL(adcSSL *adc.SSL) ([]*SSL, error) {
 		return nil, fmt.Errorf("adc ssl has no snis")
 	}
 
+	// Generated SSL IDs hash the name, anonymous SSLs would collide
+	if adcSSL.ID == "" && adcSSL.Name == "" {
+		return nil, fmt.Errorf("adc ssl for snis %v has neither id nor name", adcSSL.Snis)
+	}
+
+	// The certificates share the metadata, limit it once
+	metadata := adcSSL.Metadata
+	if err := o.limitMetadata("ssl "+adcSSL.Name, &metadata); err != nil {
+		return nil, err
+	}
+
 	kineSSLs := make([]*SSL, 0, len(adcSSL.Certificates))
+	snis := normalizeHosts(adcSSL.Snis, o)
 
 	// For each certificate in ADC SSL, create a Kine SSL
 	// All certificates share the same SNIs
 	for i, cert := range adcSSL.Certificates {
-		sslID := generateSSLID(adcSSL, i)
+		// APISIX rejects SSLs without a certificate or key
+		if cert.Certificate == "" || cert.Key == "" {
+			return nil, fmt.Errorf("certificate %d of adc ssl %s lacks a certificate or key", i, adcSSL.Name)
+		}
+		sslID := generateSSLID(adcSSL, i, o)
+		if err := ValidateID(sslID); err != nil {
+			return nil, err
+		}
 
 		kineSSL := &SSL{
 			Metadata: adc.Metadata{
 				ID:     sslID,
 				Name:   adcSSL.Name,
-				Desc:   adcSSL.Desc,
-				Labels: copyLabels(adcSSL.Labels),
+				Desc:   metadata.Desc,
+				Labels: copyLabels(metadata.Labels),
 			},
 			Cert: cert.Certificate,
 			Key:  cert.Key,
-			SNIs: copyStringSlice(adcSSL.Snis),
+			SNIs: copyStringSlice(snis),
 		}
 
 		kineSSLs = append(kineSSLs, kineSSL)
@@ -406,9 +1357,9 @@ func TransferSSL(adcSSL *adc.SSL) ([]*SSL, error) {
 
 // generateSSLID generates SSL ID
 // If there's only one certificate and ID is provided, use it
-// If there's only one certificate and no ID, use sha1(name)
-// If there are multiple certificates, use sha1(name.index)
-func generateSSLID(adcSSL *adc.SSL, index int) string {
+// If there's only one certificate and no ID, use hash(name)
+// If there are multiple certificates, use hash(name.index)
+func generateSSLID(adcSSL *adc.SSL, index int, o *TransferOptions) string {
 	// If only one certificate and ID is provided, use it
 	if len(adcSSL.Certificates) == 1 && adcSSL.ID != "" {
 		return adcSSL.ID
@@ -416,27 +1367,61 @@ func generateSSLID(adcSSL *adc.SSL, index int) string {
 
 	// If only one certificate and no ID, generate from name
 	if len(adcSSL.Certificates) == 1 && adcSSL.Name != "" {
-		return sha1Hash(adcSSL.Name)
+		return o.generateID(idScope(adcSSL.Labels, o) + adcSSL.Name)
 	}
 
 	// Multiple certificates - append index to name
 	if adcSSL.Name != "" {
-		return sha1Hash(fmt.Sprintf("%s.%d", adcSSL.Name, index))
+		return o.generateID(fmt.Sprintf("%s%s.%d", idScope(adcSSL.Labels, o), adcSSL.Name, index))
 	}
 
-	// Fallback: use ID with index
-	if adcSSL.ID != "" {
-		return fmt.Sprintf("%s-%d", adcSSL.ID, index)
-	}
+	// Fallback: use ID with index, transferSSL requires an ID or a name
+	return fmt.Sprintf("%s-%d", adcSSL.ID, index)
+}
 
-	// Last resort: generate from index
-	return sha1Hash(fmt.Sprintf("ssl-%d", index))
+// TransferProto converts an ADC Proto to a Kine Proto. Plugins reference
+// protos by ID, so the ID is kept as is and never generated.
+func TransferProto(adcProto *adc.Proto, opts ...TransferOption) (*Proto, error) {
+	proto, err := transferProto(adcProto, (&TransferOptions{}).ApplyOptions(opts))
+	return proto, invalidInput(err)
+}
+
+func transferProto(adcProto *adc.Proto, o *TransferOptions) (*Proto, error) {
+	if adcProto == nil {
+		return nil, fmt.Errorf("adc proto is nil")
+	}
+	if adcProto.ID == "" {
+		return nil, fmt.Errorf("adc proto %q has no id", adcProto.Name)
+	}
+	kineProto := &Proto{
+		Metadata: adc.Metadata{
+			ID:     adcProto.ID,
+			Name:   adcProto.Name,
+			Desc:   adcProto.Desc,
+			Labels: copyLabels(adcProto.Labels),
+		},
+		Content: adcProto.Content,
+	}
+	if err := ValidateID(kineProto.ID); err != nil {
+		return nil, err
+	}
+	if err := o.limitMetadata("proto "+kineProto.ID, &kineProto.Metadata); err != nil {
+		return nil, err
+	}
+	if err := kineProto.Validate(); err != nil {
+		return nil, err
+	}
+	return kineProto, nil
 }
 
 // TransferGlobalRule converts an ADC GlobalRule to Kine GlobalRules
 // Each plugin in the ADC GlobalRule becomes a separate Kine GlobalRule
 // The plugin name is used as the ID
-func TransferGlobalRule(adcGlobalRule adc.GlobalRule) []*GlobalRule {
+func TransferGlobalRule(adcGlobalRule adc.GlobalRule, opts ...TransferOption) []*GlobalRule {
+	return transferGlobalRule(adcGlobalRule, (&TransferOptions{}).ApplyOptions(opts))
+}
+
+func transferGlobalRule(adcGlobalRule adc.GlobalRule, o *TransferOptions) []*GlobalRule {
 	if len(adcGlobalRule) == 0 {
 		return nil
 	}
@@ -450,9 +1435,45 @@ func TransferGlobalRule(adcGlobalRule adc.GlobalRule) []*GlobalRule {
 			Plugins: map[string]any{
 				pluginName: pluginConfig,
 			},
+			Labels: copyLabels(o.OwnerLabels),
 		}
 		kineGlobalRules = append(kineGlobalRules, kineGlobalRule)
 	}
 
 	return kineGlobalRules
 }
+
+// TransferPluginMetadata converts ADC plugin metadata to Kine PluginMetadata,
+// one per plugin, using the plugin name as the ID. Like global rules, plugin
+// metadata is shared by every route, so it is labeled with the owner labels.
+func TransferPluginMetadata(adcPluginMetadata adc.PluginMetadata, opts ...TransferOption) ([]*PluginMetadata, error) {
+	o := (&TransferOptions{}).ApplyOptions(opts)
+	kineMetadata := make([]*PluginMetadata, 0, len(adcPluginMetadata))
+	for _, name := range slices.Sorted(maps.Keys(adcPluginMetadata)) {
+		metadata, err := transferPluginMetadata(name, adcPluginMetadata[name], o)
+		if err != nil {
+			return nil, fmt.Errorf("plugin metadata %s: %w", name, invalidInput(err))
+		}
+		kineMetadata = append(kineMetadata, metadata)
+	}
+	return kineMetadata, nil
+}
+
+func transferPluginMetadata(name string, config any, o *TransferOptions) (*PluginMetadata, error) {
+	configMap, ok := config.(map[string]any)
+	if !ok && config != nil {
+		return nil, fmt.Errorf("config must be an object, got %T", config)
+	}
+	kineMetadata := &PluginMetadata{
+		ID:     name,
+		Config: copyPlugins(configMap),
+		Labels: copyLabels(o.OwnerLabels),
+	}
+	if err := ValidateID(kineMetadata.ID); err != nil {
+		return nil, err
+	}
+	if err := kineMetadata.Validate(); err != nil {
+		return nil, err
+	}
+	return kineMetadata, nil
+}
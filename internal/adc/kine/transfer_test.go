@@ -1,10 +1,18 @@
 package kine
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/apache/apisix-ingress-controller/api/adc"
+	"github.com/apache/apisix-ingress-controller/internal/controller/label"
 )
 
 func TestTransferService(t *testing.T) {
@@ -455,6 +463,222 @@ func TestTransferServiceUpstreamLabels(t *testing.T) {
 	// This is the current behavior of convertUpstream function
 }
 
+func TestTransferServiceNamespacedIDs(t *testing.T) {
+	newService := func(namespace string) *adc.Service {
+		return &adc.Service{
+			Metadata: adc.Metadata{
+				Name: "api",
+				Labels: map[string]string{
+					"k8s/kind":      "HTTPRoute",
+					"k8s/namespace": namespace,
+					"k8s/name":      "api",
+				},
+			},
+			Upstream: &adc.Upstream{
+				Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+			},
+			Upstreams: []*adc.Upstream{
+				{
+					Metadata: adc.Metadata{Name: "backend"},
+					Nodes:    adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+				},
+			},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}},
+			},
+		}
+	}
+
+	// Without the option same-named services collide across namespaces
+	svcA, routesA, upstreamsA, err := TransferService(newService("team-a"))
+	if err != nil {
+		t.Fatalf("TransferService failed: %v", err)
+	}
+	svcB, _, _, err := TransferService(newService("team-b"))
+	if err != nil {
+		t.Fatalf("TransferService failed: %v", err)
+	}
+	if svcA.ID != svcB.ID {
+		t.Fatalf("expected legacy IDs to collide, got %s and %s", svcA.ID, svcB.ID)
+	}
+
+	nsSvcA, nsRoutesA, nsUpstreamsA, err := TransferService(newService("team-a"), NamespacedIDs())
+	if err != nil {
+		t.Fatalf("TransferService failed: %v", err)
+	}
+	nsSvcB, nsRoutesB, nsUpstreamsB, err := TransferService(newService("team-b"), NamespacedIDs())
+	if err != nil {
+		t.Fatalf("TransferService failed: %v", err)
+	}
+	if nsSvcA.ID == nsSvcB.ID {
+		t.Errorf("expected distinct service IDs, got %s", nsSvcA.ID)
+	}
+	if nsRoutesA[0].ID == nsRoutesB[0].ID {
+		t.Errorf("expected distinct route IDs, got %s", nsRoutesA[0].ID)
+	}
+	if nsUpstreamsA[0].ID == nsUpstreamsB[0].ID {
+		t.Errorf("expected distinct upstream IDs, got %s", nsUpstreamsA[0].ID)
+	}
+
+	// Namespaced IDs differ from the legacy ones
+	if nsSvcA.ID == svcA.ID || nsRoutesA[0].ID == routesA[0].ID || nsUpstreamsA[0].ID == upstreamsA[0].ID {
+		t.Error("expected namespaced IDs to differ from legacy IDs")
+	}
+	if nsRoutesA[0].ServiceID == nil || *nsRoutesA[0].ServiceID != nsSvcA.ID {
+		t.Errorf("expected route to reference service %s", nsSvcA.ID)
+	}
+}
+
+func TestGenerateSSLIDNamespaced(t *testing.T) {
+	newSSL := func(namespace string) *adc.SSL {
+		return &adc.SSL{
+			Metadata: adc.Metadata{
+				Name: "tls",
+				Labels: map[string]string{
+					"k8s/kind":      "ApisixTls",
+					"k8s/namespace": namespace,
+				},
+			},
+			Certificates: []adc.Certificate{{Certificate: "cert", Key: "key"}},
+		}
+	}
+	o := &TransferOptions{NamespacedIDs: true}
+	if generateSSLID(newSSL("a"), 0, o) == generateSSLID(newSSL("b"), 0, o) {
+		t.Error("expected distinct SSL IDs across namespaces")
+	}
+	if generateSSLID(newSSL("a"), 1, o) == generateSSLID(newSSL("b"), 1, o) {
+		t.Error("expected distinct indexed SSL IDs across namespaces")
+	}
+}
+
+func TestTransferServiceNormalizesHosts(t *testing.T) {
+	adcSvc := &adc.Service{
+		Metadata: adc.Metadata{Name: "svc"},
+		Hosts:    []string{"API.Example.COM", "bücher.example"},
+		Upstream: &adc.Upstream{
+			Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+		},
+		Routes: []*adc.Route{
+			{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}, Hosts: []string{"*.Bücher.Example"}},
+		},
+	}
+
+	kineSvc, kineRoutes, _, err := TransferService(adcSvc)
+	if err != nil {
+		t.Fatalf("TransferService failed: %v", err)
+	}
+	if !cmp.Equal(kineSvc.Hosts, []string{"api.example.com", "xn--bcher-kva.example"}) {
+		t.Errorf("unexpected service hosts: %v", kineSvc.Hosts)
+	}
+	if !cmp.Equal(kineRoutes[0].Hosts, []string{"*.xn--bcher-kva.example"}) {
+		t.Errorf("unexpected route hosts: %v", kineRoutes[0].Hosts)
+	}
+}
+
+func TestTransferSSLNormalizesSNIs(t *testing.T) {
+	adcSSL := &adc.SSL{
+		Metadata:     adc.Metadata{ID: "ssl-1", Name: "tls"},
+		Certificates: []adc.Certificate{{Certificate: "cert", Key: "key"}},
+		Snis:         []string{"*.Bücher.example", "WWW.Example.com"},
+	}
+
+	kineSSLs, err := TransferSSL(adcSSL)
+	if err != nil {
+		t.Fatalf("TransferSSL failed: %v", err)
+	}
+	if !cmp.Equal(kineSSLs[0].SNIs, []string{"*.xn--bcher-kva.example", "www.example.com"}) {
+		t.Errorf("unexpected snis: %v", kineSSLs[0].SNIs)
+	}
+}
+
+func TestTransferResourcesInvalidHostWarning(t *testing.T) {
+	resources := &adc.Resources{
+		Services: []*adc.Service{
+			{
+				Metadata: adc.Metadata{Name: "svc"},
+				Upstream: &adc.Upstream{
+					Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+				},
+				Routes: []*adc.Route{
+					{
+						Metadata: adc.Metadata{Name: "route1"},
+						Uris:     []string{"/"},
+						Hosts:    []string{"-Bad.example", "good.example"},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := TransferResources(resources)
+	if err != nil {
+		t.Fatalf("TransferResources failed: %v", err)
+	}
+	if len(result.Routes) != 1 {
+		t.Fatalf("expected the route to be transferred, got %d", len(result.Routes))
+	}
+	if !cmp.Equal(result.Routes[0].Hosts, []string{"-bad.example", "good.example"}) {
+		t.Errorf("unexpected hosts: %v", result.Routes[0].Hosts)
+	}
+	if len(result.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d", len(result.Warnings))
+	}
+	var hostErr *InvalidHostError
+	if !errors.As(result.Warnings[0], &hostErr) || hostErr.Host != "-Bad.example" {
+		t.Errorf("expected invalid host warning, got %v", result.Warnings[0])
+	}
+}
+
+func TestTransferServiceHosts(t *testing.T) {
+	labels := map[string]string{label.LabelKind: "Ingress", label.LabelNamespace: "default", label.LabelName: "web"}
+	enableWebsocket := true
+	newService := func(hosts ...string) *adc.Service {
+		return &adc.Service{
+			Metadata:        adc.Metadata{Name: "svc", Labels: labels},
+			Hosts:           hosts,
+			EnableWebsocket: &enableWebsocket,
+			Upstream: &adc.Upstream{
+				Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+			},
+		}
+	}
+
+	svc, _, _, err := TransferService(newService("*.Example.com", "api.example.com"))
+	if err != nil {
+		t.Fatalf("unexpected error for a wildcard host: %v", err)
+	}
+	if !cmp.Equal(svc.Hosts, []string{"*.example.com", "api.example.com"}) {
+		t.Errorf("unexpected hosts: %v", svc.Hosts)
+	}
+	if svc.EnableWebsocket == nil || !*svc.EnableWebsocket {
+		t.Errorf("expected enable_websocket to be converted, got %v", svc.EnableWebsocket)
+	}
+
+	for _, host := range []string{"-bad.example", "api.*.example.com", "*", ""} {
+		_, _, _, err := TransferService(newService("good.example", host))
+		var hostErr *InvalidHostError
+		if !errors.As(err, &hostErr) || hostErr.Host != host {
+			t.Errorf("host %q: expected an invalid host error, got %v", host, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "web") {
+			t.Errorf("host %q: expected the labels in %q", host, err)
+		}
+		if err := (&Service{UpstreamID: &svc.ID, Hosts: []string{host}}).Validate(); err == nil {
+			t.Errorf("host %q: expected Validate to fail", host)
+		}
+	}
+
+	// Best effort transfers skip the service with a warning
+	result, err := TransferResources(&adc.Resources{Services: []*adc.Service{newService("-bad.example")}}, BestEffort())
+	if err != nil {
+		t.Fatalf("TransferResources failed: %v", err)
+	}
+	if len(result.Services) != 0 || len(result.Warnings) != 1 || !cmp.Equal(result.Warnings[0].Labels, labels) {
+		t.Errorf("expected the service to be skipped with a warning, got %+v", result)
+	}
+}
+
 func TestSha1Hash(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -515,6 +739,59 @@ func TestConvertNodes(t *testing.T) {
 	}
 }
 
+func TestConvertUpstreamDomainNodes(t *testing.T) {
+	adcSvc := &adc.Service{Metadata: adc.Metadata{Name: "svc"}}
+	tests := []struct {
+		name        string
+		nodes       adc.UpstreamNodes
+		wantResolve bool
+		wantErr     string
+	}{
+		{
+			name:  "ip",
+			nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 1}, {Host: "::1", Port: 80, Weight: 1}},
+		},
+		{
+			name:        "hostname",
+			nodes:       adc.UpstreamNodes{{Host: "api.partner.com", Port: 443, Weight: 1}},
+			wantResolve: true,
+		},
+		{
+			name:        "mixed",
+			nodes:       adc.UpstreamNodes{{Host: "api.partner.com", Port: 443, Weight: 1}, {Host: "10.0.0.1", Port: 443, Weight: 1}},
+			wantResolve: true,
+			wantErr:     "upstream partner mixes domain name nodes with IP node 10.0.0.1:443",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adcUpstream := &adc.Upstream{Metadata: adc.Metadata{Name: "partner"}, Nodes: tt.nodes}
+			upstream := convertUpstream(adcUpstream, adcSvc, &TransferOptions{})
+			if upstream.DNSResolveOnNodes != tt.wantResolve {
+				t.Errorf("expected dns_resolve_on_nodes %v, got %v", tt.wantResolve, upstream.DNSResolveOnNodes)
+			}
+			err := upstream.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected a valid upstream, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+
+			_, err = TransferResources(&adc.Resources{Services: []*adc.Service{{
+				Metadata: adc.Metadata{Name: "svc"},
+				Upstream: adcUpstream,
+			}}})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected the service to transfer, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected the transfer to fail with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestConvertMethods(t *testing.T) {
 	methods := []string{"GET", "POST", "PUT"}
 	result := convertMethods(methods)
@@ -555,23 +832,540 @@ func TestConvertTimeout(t *testing.T) {
 	}
 }
 
+func TestTransferSubSecondTimeout(t *testing.T) {
+	var resources adc.Resources
+	err := json.Unmarshal([]byte(`{"services": [{
+		"name": "svc",
+		"upstream": {
+			"nodes": [{"host": "10.0.0.1", "port": 80, "weight": 100}],
+			"timeout": {"connect": 0.5, "send": 1.5, "read": 2}
+		},
+		"routes": [{"name": "route", "uris": ["/"], "timeout": {"connect": 0.25, "send": 0.5, "read": 0.75}}]
+	}]}`), &resources)
+	if err != nil {
+		t.Fatalf("failed to unmarshal resources: %v", err)
+	}
+	transferred, err := TransferResources(&resources)
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if got, want := *transferred.Services[0].Upstream.Timeout, (Timeout{Connect: 0.5, Send: 1.5, Read: 2}); got != want {
+		t.Errorf("expected upstream timeout %+v, got %+v", want, got)
+	}
+	if got, want := *transferred.Routes[0].Timeout, (Timeout{Connect: 0.25, Send: 0.5, Read: 0.75}); got != want {
+		t.Errorf("expected route timeout %+v, got %+v", want, got)
+	}
+
+	// Exporting keeps the fractions
+	if got := exportTimeout(transferred.Routes[0].Timeout); got.Connect != 0.25 {
+		t.Errorf("expected the exported timeout to keep sub-second values, got %+v", got)
+	}
+}
+
+func TestTimeoutValidate(t *testing.T) {
+	if err := (&Timeout{Connect: -1, Send: 10, Read: 10}).Validate(); err == nil {
+		t.Error("expected error for negative timeout")
+	}
+	if err := (&Timeout{}).Validate(); err == nil {
+		t.Error("expected error for all-zero timeout")
+	}
+	subSecond := &Timeout{Connect: 0.5, Send: 0.5, Read: 0.5}
+	if err := subSecond.Validate(); err != nil {
+		t.Errorf("unexpected error for sub-second timeout: %v", err)
+	}
+
+	// Sub-second values survive copies and serialization
+	if copyTimeout(subSecond).Connect != 0.5 {
+		t.Error("expected sub-second timeout to survive DeepCopy")
+	}
+	data, err := json.Marshal(subSecond)
+	if err != nil {
+		t.Fatalf("failed to marshal timeout: %v", err)
+	}
+	if string(data) != `{"connect":0.5,"send":0.5,"read":0.5}` {
+		t.Errorf("unexpected timeout serialization: %s", data)
+	}
+}
+
+func TestTransferServiceInvalidTimeout(t *testing.T) {
+	newService := func(timeout *adc.Timeout) *adc.Service {
+		return &adc.Service{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Nodes:   adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+				Timeout: timeout,
+			},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}, Timeout: timeout},
+			},
+		}
+	}
+
+	if _, _, _, err := TransferService(newService(&adc.Timeout{Connect: -1, Send: 10, Read: 10})); err == nil {
+		t.Error("expected error for negative timeout")
+	}
+	if _, _, _, err := TransferService(newService(&adc.Timeout{})); err == nil {
+		t.Error("expected error for all-zero timeout")
+	}
+	if _, _, _, err := TransferService(newService(&adc.Timeout{Connect: 5, Send: 10, Read: 10})); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTransferPropagateTimeouts(t *testing.T) {
+	upstreamTimeout := &adc.Timeout{Connect: 5, Send: 10, Read: 60}
+	routeTimeout := &adc.Timeout{Connect: 1, Send: 2, Read: 3}
+	generatedID := SHA1IDGenerator.GenerateID("generated")
+	resources := func(serviceTimeout, routeTimeout *adc.Timeout) *adc.Resources {
+		return &adc.Resources{Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Nodes:   adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}},
+				Timeout: serviceTimeout,
+			},
+			Upstreams: []*adc.Upstream{{
+				Metadata: adc.Metadata{ID: "slow", Name: "slow"},
+				Nodes:    adc.UpstreamNodes{{Host: "10.0.0.2", Port: 80, Weight: 100}},
+				Timeout:  &adc.Timeout{Connect: 5, Send: 300, Read: 300},
+			}, {
+				// Referenced by its generated ID
+				Metadata: adc.Metadata{Name: "generated"},
+				Nodes:    adc.UpstreamNodes{{Host: "10.0.0.3", Port: 80, Weight: 100}},
+				Timeout:  &adc.Timeout{Connect: 7, Send: 8, Read: 9},
+			}},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{Name: "route"}, Uris: []string{"/"}, Timeout: routeTimeout},
+				{Metadata: adc.Metadata{Name: "slow"}, Uris: []string{"/slow"}, UpstreamID: "slow"},
+				{Metadata: adc.Metadata{Name: "generated"}, Uris: []string{"/generated"}, UpstreamID: generatedID},
+				{Metadata: adc.Metadata{Name: "external"}, Uris: []string{"/external"}, UpstreamID: "elsewhere"},
+			},
+		}}}
+	}
+	timeouts := func(transferred *TransferredResources) map[string]*Timeout {
+		got := make(map[string]*Timeout, len(transferred.Routes))
+		for _, route := range transferred.Routes {
+			got[route.Name] = route.Timeout
+		}
+		return got
+	}
+	slow := &Timeout{Connect: 5, Send: 300, Read: 300}
+	generated := &Timeout{Connect: 7, Send: 8, Read: 9}
+
+	tests := []struct {
+		name           string
+		serviceTimeout *adc.Timeout
+		routeTimeout   *adc.Timeout
+		want           map[string]*Timeout
+	}{
+		{
+			name:           "upstream only",
+			serviceTimeout: upstreamTimeout,
+			want: map[string]*Timeout{
+				"route": convertTimeout(upstreamTimeout), "slow": slow, "generated": generated, "external": nil,
+			},
+		},
+		{
+			name:           "route override",
+			serviceTimeout: upstreamTimeout,
+			routeTimeout:   routeTimeout,
+			want: map[string]*Timeout{
+				"route": convertTimeout(routeTimeout), "slow": slow, "generated": generated, "external": nil,
+			},
+		},
+		{
+			name: "neither",
+			want: map[string]*Timeout{"route": nil, "slow": slow, "generated": generated, "external": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transferred, err := TransferResources(resources(tt.serviceTimeout, tt.routeTimeout), PropagateTimeouts())
+			if err != nil {
+				t.Fatalf("failed to transfer resources: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, timeouts(transferred)); diff != "" {
+				t.Errorf("unexpected route timeouts (-want +got):\n%s", diff)
+			}
+
+			// The upstreams keep their timeouts
+			if got := transferred.Services[0].Upstream.Timeout; !cmp.Equal(got, convertTimeout(tt.serviceTimeout)) {
+				t.Errorf("expected the service upstream to keep its timeout, got %+v", got)
+			}
+		})
+	}
+
+	// Without the option, only explicit route timeouts are set
+	transferred, err := TransferResources(resources(upstreamTimeout, nil))
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	for name, timeout := range timeouts(transferred) {
+		if timeout != nil {
+			t.Errorf("expected no timeout on route %s by default, got %+v", name, timeout)
+		}
+	}
+
+	// Propagated timeouts are the same across syncs, the diff stays quiet
+	transferred, err = TransferResources(resources(upstreamTimeout, nil), PropagateTimeouts())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	cache, err := NewMemDBCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, route := range transferred.Routes {
+		if err := cache.InsertRoute(route); err != nil {
+			t.Fatalf("failed to insert route: %v", err)
+		}
+	}
+	transferred, err = TransferResources(resources(upstreamTimeout, nil), PropagateTimeouts())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	events, err := NewDiffer(cache).Diff(context.Background(), &TransferredResources{Routes: transferred.Routes}, &DiffOptions{})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no route events for unchanged timeouts, got %d", len(events))
+	}
+}
+
+func TestTransferServiceRouteStatus(t *testing.T) {
+	newService := func(status *int64) *adc.Service {
+		return &adc.Service{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+			},
+			Routes: []*adc.Route{
+				{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}, Status: status},
+			},
+		}
+	}
+
+	disabled := int64(RouteStatusDisabled)
+	_, routes, _, err := TransferService(newService(&disabled))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if routes[0].Status == nil || routes[0].GetStatus() != RouteStatusDisabled {
+		t.Errorf("expected a disabled route, got status %v", routes[0].Status)
+	}
+	if routes[0].DeepCopy().GetStatus() != RouteStatusDisabled {
+		t.Error("expected the status to survive DeepCopy")
+	}
+	data, err := json.Marshal(routes[0])
+	if err != nil {
+		t.Fatalf("failed to marshal route: %v", err)
+	}
+	if !strings.Contains(string(data), `"status":0`) {
+		t.Errorf("expected the disabled status to be serialized, got %s", data)
+	}
+
+	_, routes, _, err = TransferService(newService(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if routes[0].GetStatus() != RouteStatusEnabled {
+		t.Errorf("expected routes to be enabled by default, got %d", routes[0].GetStatus())
+	}
+
+	invalid := int64(2)
+	if _, _, _, err := TransferService(newService(&invalid)); err == nil {
+		t.Error("expected error for an unknown status")
+	}
+	status, upstreamID := 2, "upstream-1"
+	if err := (&Route{URIs: []string{"/"}, UpstreamID: &upstreamID, Status: &status}).Validate(); err == nil {
+		t.Error("expected Validate to reject an unknown status")
+	}
+}
+
+func TestTransferServiceRouteVars(t *testing.T) {
+	vars := adc.Vars{{{StrVal: "http_x_canary"}, {StrVal: "=="}, {StrVal: "true"}}}
+	service := &adc.Service{
+		Metadata: adc.Metadata{Name: "svc"},
+		Upstream: &adc.Upstream{
+			Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+		},
+		Routes: []*adc.Route{
+			{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}, Vars: vars},
+		},
+	}
+
+	_, routes, _, err := TransferService(service)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := json.Marshal(routes[0])
+	if err != nil {
+		t.Fatalf("failed to marshal route: %v", err)
+	}
+	if !strings.Contains(string(data), `"vars":[["http_x_canary","==","true"]]`) {
+		t.Errorf("expected the vars to be serialized, got %s", data)
+	}
+	service.Routes[0].Vars[0][2].StrVal = "false"
+	if routes[0].Vars[0][2].StrVal != "true" {
+		t.Error("expected the transferred vars not to share the service vars")
+	}
+}
+
+func TestTransferServiceFilterFunc(t *testing.T) {
+	resources := &adc.Resources{
+		Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 1}}},
+			Routes: []*adc.Route{{
+				Metadata:   adc.Metadata{Name: "filtered"},
+				Uris:       []string{"/"},
+				FilterFunc: "function(vars) return vars.arg_name == 'json' end",
+			}},
+		}},
+	}
+
+	_, err := TransferResources(resources)
+	if err == nil || !strings.Contains(err.Error(), "route filtered has a filter_func, which is not supported") {
+		t.Fatalf("expected the filter_func to fail the transfer naming the route, got %v", err)
+	}
+
+	result, err := TransferResources(resources, BestEffort())
+	if err != nil {
+		t.Fatalf("expected a best-effort transfer to skip the service, got %v", err)
+	}
+	if len(result.Routes) != 0 || len(result.Warnings) != 1 ||
+		!strings.Contains(result.Warnings[0].Error(), "route filtered has a filter_func") {
+		t.Errorf("expected the route to be skipped with a warning, got %d routes and %v", len(result.Routes), result.Warnings)
+	}
+}
+
+func TestTransferServiceZeroWeightUpstream(t *testing.T) {
+	newResources := func(weights ...int) *adc.Resources {
+		nodes := make(adc.UpstreamNodes, 0, len(weights))
+		for i, weight := range weights {
+			nodes = append(nodes, adc.UpstreamNode{Host: fmt.Sprintf("10.0.0.%d", i+1), Port: 80, Weight: weight})
+		}
+		return &adc.Resources{
+			Services: []*adc.Service{{
+				Metadata: adc.Metadata{Name: "svc"},
+				Upstream: &adc.Upstream{Metadata: adc.Metadata{Name: "pods"}, Nodes: nodes},
+				Routes: []*adc.Route{
+					{Metadata: adc.Metadata{Name: "route1"}, Uris: []string{"/"}},
+				},
+			}},
+		}
+	}
+
+	_, err := TransferResources(newResources(0, 0))
+	if err == nil || !strings.Contains(err.Error(), "upstream pods has no node with a weight above 0") {
+		t.Fatalf("expected all zero weights to fail naming the upstream, got %v", err)
+	}
+	if !errors.Is(err, ErrTransferFailed) || !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected a transfer error of invalid input, got %v", err)
+	}
+
+	result, err := TransferResources(newResources(0, 5))
+	if err != nil {
+		t.Fatalf("expected mixed weights to transfer, got %v", err)
+	}
+	if len(result.Routes) != 1 || len(result.Warnings) != 0 {
+		t.Errorf("expected the route without warnings, got %d routes and %v", len(result.Routes), result.Warnings)
+	}
+	if err := result.Services[0].Upstream.Validate(); err != nil {
+		t.Errorf("expected mixed weights to be valid, got %v", err)
+	}
+
+	result, err = TransferResources(newResources(0, 0), HandleZeroWeightUpstreams(ZeroWeightDropRoutes))
+	if err != nil {
+		t.Fatalf("expected the routes to be dropped, got %v", err)
+	}
+	if len(result.Services) != 1 || len(result.Routes) != 0 {
+		t.Errorf("expected the service without routes, got %d services and %d routes",
+			len(result.Services), len(result.Routes))
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0].Error(), "dropping the routes") {
+		t.Errorf("expected a warning for the dropped routes, got %v", result.Warnings)
+	}
+
+	result, err = TransferResources(newResources(0, 0), HandleZeroWeightUpstreams(ZeroWeightDisableRoutes))
+	if err != nil {
+		t.Fatalf("expected the routes to be disabled, got %v", err)
+	}
+	if len(result.Routes) != 1 || result.Routes[0].GetStatus() != RouteStatusDisabled || len(result.Warnings) != 1 {
+		t.Errorf("expected a disabled route with a warning, got %+v and %v", result.Routes, result.Warnings)
+	}
+
+	upstream := &Upstream{Metadata: adc.Metadata{Name: "pods"}, Nodes: map[string]uint32{"10.0.0.1:80": 0}}
+	if err := upstream.Validate(); err == nil || !strings.Contains(err.Error(), "pods") {
+		t.Errorf("expected Validate to reject all zero weights naming the upstream, got %v", err)
+	}
+}
+
+func TestTransferServiceRetryBounds(t *testing.T) {
+	newService := func(retries *int64, retryTimeout *float64) *adc.Service {
+		return &adc.Service{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Nodes:        adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+				Retries:      retries,
+				RetryTimeout: retryTimeout,
+			},
+		}
+	}
+	int64Ptr := func(v int64) *int64 { return &v }
+	float64Ptr := func(v float64) *float64 { return &v }
+
+	_, _, _, err := TransferService(newService(int64Ptr(-1), nil))
+	if err == nil || !strings.Contains(err.Error(), "svc") {
+		t.Errorf("expected error naming the upstream for negative retries, got %v", err)
+	}
+	if _, _, _, err := TransferService(newService(int64Ptr(DefaultMaxRetries+1), nil)); err == nil {
+		t.Error("expected error for retries above the default cap")
+	}
+	if _, _, _, err := TransferService(newService(int64Ptr(5), nil), MaxRetries(3)); err == nil {
+		t.Error("expected error for retries above the configured cap")
+	}
+	if _, _, _, err := TransferService(newService(nil, float64Ptr(-1))); err == nil {
+		t.Error("expected error for negative retry_timeout")
+	}
+	if _, _, _, err := TransferService(newService(nil, float64Ptr(1e30))); err == nil {
+		t.Error("expected error for huge retry_timeout")
+	}
+
+	svc, _, _, err := TransferService(newService(int64Ptr(3), float64Ptr(10)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *svc.Upstream.Retries != 3 || *svc.Upstream.RetryTimeout != 10 {
+		t.Errorf("unexpected retries %d and retry_timeout %d", *svc.Upstream.Retries, *svc.Upstream.RetryTimeout)
+	}
+}
+
+func TestConvertKeepalivePool(t *testing.T) {
+	adcSvc := &adc.Service{Metadata: adc.Metadata{Name: "svc"}}
+	adcUpstream := &adc.Upstream{
+		Metadata: adc.Metadata{Name: "backend"},
+		Nodes:    adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}},
+		KeepalivePool: &adc.UpstreamKeepalivePool{
+			Size:        320,
+			IdleTimeout: 60.5,
+			Requests:    1000,
+		},
+	}
+
+	result := convertUpstream(adcUpstream, adcSvc, &TransferOptions{})
+	pool := result.KeepalivePool
+	if pool == nil {
+		t.Fatal("KeepalivePool should not be nil")
+	}
+	if pool.Size != 320 || pool.IdleTimeout != 60.5 || pool.Requests != 1000 {
+		t.Errorf("KeepalivePool values mismatch: %+v", pool)
+	}
+	if err := result.Validate(); err != nil {
+		t.Errorf("expected valid upstream: %v", err)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to marshal upstream: %v", err)
+	}
+	if !strings.Contains(string(data), `"keepalive_pool":{"size":320,"idle_timeout":60.5,"requests":1000}`) {
+		t.Errorf("unexpected keepalive_pool serialization: %s", data)
+	}
+
+	copied := result.DeepCopy()
+	copied.KeepalivePool.Size = 1
+	if result.KeepalivePool.Size != 320 {
+		t.Error("DeepCopy should not share the keepalive pool")
+	}
+
+	if convertKeepalivePool(nil) != nil {
+		t.Error("Expected nil for nil input")
+	}
+}
+
+func TestKeepalivePoolValidate(t *testing.T) {
+	if err := (&KeepalivePool{Size: 0}).Validate(); err == nil {
+		t.Error("expected error for size 0")
+	}
+	if err := (&KeepalivePool{Size: 1, IdleTimeout: -1}).Validate(); err == nil {
+		t.Error("expected error for negative idle_timeout")
+	}
+	if err := (&KeepalivePool{Size: 1}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestConvertScheme(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected UpstreamScheme
+		warns    bool
 	}{
-		{"http", UpstreamSchemeHTTP},
-		{"https", UpstreamSchemeHTTPS},
-		{"grpc", UpstreamSchemeGRPC},
-		{"grpcs", UpstreamSchemeGRPCS},
-		{"unknown", UpstreamSchemeHTTP}, // default
+		{"", UpstreamSchemeHTTP, false},
+		{"http", UpstreamSchemeHTTP, false},
+		{"https", UpstreamSchemeHTTPS, false},
+		{"grpc", UpstreamSchemeGRPC, false},
+		{"grpcs", UpstreamSchemeGRPCS, false},
+		{"tcp", UpstreamSchemeTCP, false},
+		{"tls", UpstreamSchemeTLS, false},
+		{"udp", UpstreamSchemeUDP, false},
+		{"unknown", UpstreamSchemeHTTP, true}, // default
 	}
 
 	for _, tt := range tests {
-		result := convertScheme(tt.input)
+		var warnings []error
+		o := &TransferOptions{warn: func(err error) { warnings = append(warnings, err) }}
+		result := convertScheme(tt.input, o)
 		if result != tt.expected {
 			t.Errorf("convertScheme(%s) = %s, want %s", tt.input, result, tt.expected)
 		}
+		if warned := len(warnings) > 0; warned != tt.warns {
+			t.Errorf("convertScheme(%s) warned = %v, want %v", tt.input, warned, tt.warns)
+		}
+	}
+}
+
+func TestTransferStreamSchemes(t *testing.T) {
+	service := func(scheme string, routes ...*adc.Route) *adc.Resources {
+		return &adc.Resources{Services: []*adc.Service{{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{
+				Scheme: scheme,
+				Nodes:  adc.UpstreamNodes{{Host: "10.0.0.1", Port: 3306, Weight: 100}},
+			},
+			Routes: routes,
+		}}}
+	}
+	route := &adc.Route{Metadata: adc.Metadata{Name: "r"}, Uris: []string{"/"}}
+
+	// Services without routes may hold stream upstreams
+	transferred, err := TransferResources(service("tcp"))
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if scheme := transferred.Services[0].Upstream.Scheme; scheme != UpstreamSchemeTCP {
+		t.Errorf("expected the tcp scheme to be kept, got %s", scheme)
+	}
+
+	if _, err := TransferResources(service("udp", route)); err == nil || !strings.Contains(err.Error(), "stream scheme udp") {
+		t.Errorf("expected HTTP routes to reject a udp upstream, got %v", err)
+	}
+	routeUpstream := &adc.Route{
+		Metadata: adc.Metadata{Name: "r"},
+		Uris:     []string{"/"},
+		Upstream: &adc.Upstream{Scheme: "tls", Nodes: adc.UpstreamNodes{{Host: "10.0.0.2", Port: 443, Weight: 100}}},
+	}
+	if _, err := TransferResources(service("http", routeUpstream)); err == nil || !strings.Contains(err.Error(), "stream scheme tls") {
+		t.Errorf("expected HTTP routes to reject a tls route upstream, got %v", err)
+	}
+
+	transferred, err = TransferResources(service("ftp", route), BestEffort())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(transferred.Warnings) != 1 || transferred.Services[0].Upstream.Scheme != UpstreamSchemeHTTP {
+		t.Errorf("expected an unknown scheme to warn and fall back to http, got %v", transferred.Warnings)
 	}
 }
 
@@ -579,17 +1373,41 @@ func TestConvertPassHost(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected UpstreamPassHost
+		warns    bool
 	}{
-		{"pass", UpstreamPassHostPass},
-		{"rewrite", UpstreamPassHostRewrite},
-		{"unknown", UpstreamPassHostPass}, // default
+		{"", UpstreamPassHostPass, false},
+		{"pass", UpstreamPassHostPass, false},
+		{"rewrite", UpstreamPassHostRewrite, false},
+		{"node", UpstreamPassHostNode, false},
+		{"unknown", UpstreamPassHostPass, true}, // default
 	}
 
 	for _, tt := range tests {
-		result := convertPassHost(tt.input)
+		var warnings []error
+		o := &TransferOptions{warn: func(err error) { warnings = append(warnings, err) }}
+		result := convertPassHost(tt.input, o)
 		if result != tt.expected {
 			t.Errorf("convertPassHost(%s) = %s, want %s", tt.input, result, tt.expected)
 		}
+		if warned := len(warnings) > 0; warned != tt.warns {
+			t.Errorf("convertPassHost(%s) warned = %v, want %v", tt.input, warned, tt.warns)
+		}
+		if tt.warns && !strings.Contains(warnings[0].Error(), tt.input) {
+			t.Errorf("expected warning to name %q, got %v", tt.input, warnings[0])
+		}
+	}
+}
+
+func TestUpstreamValidatePassHost(t *testing.T) {
+	nodes := map[string]uint32{"127.0.0.1:8080": 100}
+
+	upstream := &Upstream{Nodes: nodes, PassHost: UpstreamPassHostNode}
+	if err := upstream.Validate(); err != nil {
+		t.Errorf("expected node pass_host without upstream_host to be valid, got %v", err)
+	}
+	upstream = &Upstream{Nodes: nodes, PassHost: UpstreamPassHostRewrite}
+	if err := upstream.Validate(); err == nil {
+		t.Error("expected error for rewrite pass_host without upstream_host")
 	}
 }
 
@@ -614,7 +1432,7 @@ func TestConvertUpstreamWithoutID(t *testing.T) {
 		},
 	}
 
-	result := convertUpstream(adcUpstream, adcSvc)
+	result := convertUpstream(adcUpstream, adcSvc, &TransferOptions{})
 
 	if result == nil {
 		t.Fatal("Result should not be nil")
@@ -651,7 +1469,7 @@ func TestConvertUpstreamWithID(t *testing.T) {
 		},
 	}
 
-	result := convertUpstream(adcUpstream, adcSvc)
+	result := convertUpstream(adcUpstream, adcSvc, &TransferOptions{})
 
 	if result == nil {
 		t.Fatal("Result should not be nil")
@@ -708,7 +1526,7 @@ func TestConvertUpstreamWithHealthCheck(t *testing.T) {
 		},
 	}
 
-	result := convertUpstream(adcUpstream, adcSvc)
+	result := convertUpstream(adcUpstream, adcSvc, &TransferOptions{})
 
 	if result == nil {
 		t.Fatal("Result should not be nil")
@@ -759,6 +1577,190 @@ func TestConvertUpstreamWithHealthCheck(t *testing.T) {
 	}
 }
 
+func TestConvertHealthCheckHTTPS(t *testing.T) {
+	newCheck := func(checkType string, verify *bool, sni string) *adc.UpstreamHealthCheck {
+		return &adc.UpstreamHealthCheck{
+			Active: &adc.UpstreamActiveHealthCheck{
+				Type:            checkType,
+				HTTPSVerifyCert: verify,
+				HTTPSSni:        sni,
+			},
+		}
+	}
+
+	// http probes carry no certificate settings
+	enabled, disabled := true, false
+	active := convertHealthCheck(newCheck("http", &enabled, "backend.example.com")).Active
+	if active.HTTPSVerifyCertificate != nil || active.HTTPSSni != nil {
+		t.Errorf("expected no https settings for an http check, got verify=%v sni=%v",
+			active.HTTPSVerifyCertificate, active.HTTPSSni)
+	}
+	if !active.GetHTTPSVerifyCertificate() {
+		t.Error("expected certificate verification to default to true")
+	}
+
+	active = convertHealthCheck(newCheck("https", &enabled, "backend.example.com")).Active
+	if !active.GetHTTPSVerifyCertificate() {
+		t.Error("expected certificate verification for an https check")
+	}
+	if active.HTTPSSni == nil || *active.HTTPSSni != "backend.example.com" {
+		t.Errorf("expected https_sni backend.example.com, got %v", active.HTTPSSni)
+	}
+
+	// https checks omitting the setting verify certificates
+	var omitted adc.UpstreamHealthCheck
+	if err := json.Unmarshal([]byte(`{"active": {"type": "https"}}`), &omitted); err != nil {
+		t.Fatalf("failed to unmarshal health check: %v", err)
+	}
+	active = convertHealthCheck(&omitted).Active
+	if active.HTTPSVerifyCertificate == nil || !*active.HTTPSVerifyCertificate {
+		t.Errorf("expected https_verify_certificate to default to true, got %v", active.HTTPSVerifyCertificate)
+	}
+
+	// Verification can be disabled per check
+	active = convertHealthCheck(newCheck("https", &disabled, "")).Active
+	if active.GetHTTPSVerifyCertificate() {
+		t.Error("expected certificate verification to be disabled")
+	}
+	if active.HTTPSSni != nil {
+		t.Errorf("expected no https_sni, got %q", *active.HTTPSSni)
+	}
+
+	copied := active.DeepCopy()
+	*copied.HTTPSVerifyCertificate = true
+	if active.GetHTTPSVerifyCertificate() {
+		t.Error("expected DeepCopy not to share https_verify_certificate")
+	}
+}
+
+func TestTransferServiceCanaryRoute(t *testing.T) {
+	adcSvc := &adc.Service{
+		Metadata: adc.Metadata{Name: "svc"},
+		Upstream: &adc.Upstream{
+			Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}},
+		},
+		Routes: []*adc.Route{
+			{Metadata: adc.Metadata{Name: "stable"}, Uris: []string{"/"}},
+			{
+				Metadata: adc.Metadata{Name: "canary"},
+				Uris:     []string{"/"},
+				Upstream: &adc.Upstream{
+					Nodes: adc.UpstreamNodes{{Host: "10.0.1.1", Port: 80, Weight: 100}},
+				},
+			},
+			{Metadata: adc.Metadata{Name: "shared"}, Uris: []string{"/"}, UpstreamID: "canary-upstream"},
+		},
+	}
+
+	service, routes, _, err := TransferService(adcSvc)
+	if err != nil {
+		t.Fatalf("failed to transfer service: %v", err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(routes))
+	}
+	stable, canary, shared := routes[0], routes[1], routes[2]
+	if stable.Upstream != nil || stable.UpstreamID != nil {
+		t.Errorf("expected the stable route to use the service upstream, got %+v", stable)
+	}
+	if _, ok := service.Upstream.Nodes["10.0.0.1:80"]; !ok {
+		t.Errorf("expected the service upstream nodes, got %v", service.Upstream.Nodes)
+	}
+	if canary.Upstream == nil {
+		t.Fatal("expected the canary route to carry its upstream")
+	}
+	if _, ok := canary.Upstream.Nodes["10.0.1.1:80"]; !ok || len(canary.Upstream.Nodes) != 1 {
+		t.Errorf("expected the canary nodes, got %v", canary.Upstream.Nodes)
+	}
+	if shared.UpstreamID == nil || *shared.UpstreamID != "canary-upstream" {
+		t.Errorf("expected upstream_id canary-upstream, got %v", shared.UpstreamID)
+	}
+	for _, route := range routes {
+		if route.ServiceID == nil || *route.ServiceID != service.ID {
+			t.Errorf("expected route %s to reference service %s, got %v", route.Name, service.ID, route.ServiceID)
+		}
+		if err := route.Validate(); err != nil {
+			t.Errorf("expected route %s to be valid: %v", route.Name, err)
+		}
+	}
+
+	// Route upstreams are checked like service upstreams
+	adcSvc.Routes[1].Upstream.Nodes[0].Weight = 0
+	if _, _, _, err := TransferService(adcSvc); err == nil || !strings.Contains(err.Error(), "invalid route canary upstream") {
+		t.Errorf("expected an invalid canary upstream error, got %v", err)
+	}
+}
+
+func TestConvertHealthCheckDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		check *adc.UpstreamActiveHealthCheck
+		want  string
+		// minimal checks were cached with zero values before the defaults
+		// were materialized
+		minimal bool
+	}{
+		{
+			name:    "minimal http",
+			check:   &adc.UpstreamActiveHealthCheck{},
+			minimal: true,
+			want: `{"active":{"type":"http","timeout":1,"http_path":"/",` +
+				`"healthy":{"interval":1,"http_statuses":[200,302],"successes":2},` +
+				`"unhealthy":{"http_failures":5,"tcp_failures":2}}}`,
+		},
+		{
+			name:    "minimal https",
+			check:   &adc.UpstreamActiveHealthCheck{Type: "https"},
+			minimal: true,
+			want: `{"active":{"type":"https","timeout":1,"http_path":"/","https_verify_certificate":true,` +
+				`"healthy":{"interval":1,"http_statuses":[200,302],"successes":2},` +
+				`"unhealthy":{"http_failures":5,"tcp_failures":2}}}`,
+		},
+		{
+			name: "explicit values",
+			check: &adc.UpstreamActiveHealthCheck{
+				Type:     "tcp",
+				Timeout:  3,
+				HTTPPath: "/healthz",
+				Healthy: adc.UpstreamActiveHealthCheckHealthy{
+					Interval: 5,
+					UpstreamPassiveHealthCheckHealthy: adc.UpstreamPassiveHealthCheckHealthy{
+						HTTPStatuses: []int{204},
+						Successes:    1,
+					},
+				},
+			},
+			want: `{"active":{"type":"tcp","timeout":3,"http_path":"/healthz",` +
+				`"healthy":{"interval":5,"http_statuses":[204],"successes":1},` +
+				`"unhealthy":{"http_failures":5,"tcp_failures":2}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := convertHealthCheck(&adc.UpstreamHealthCheck{Active: tt.check})
+			got, err := json.Marshal(check)
+			if err != nil {
+				t.Fatalf("failed to marshal health check: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("unexpected health check JSON:\nwant: %s\ngot:  %s", tt.want, got)
+			}
+			if !tt.minimal {
+				return
+			}
+			// Checks cached before the defaults were materialized do not churn
+			cached := check.DeepCopy()
+			cached.Active.Timeout = 0
+			cached.Active.HTTPPath = ""
+			cached.Active.Healthy = &Health{}
+			cached.Active.Unhealthy = &Unhealthy{}
+			if !areUpstreamsEqual(&Upstream{Checks: cached}, &Upstream{Checks: check}) {
+				t.Errorf("expected %+v to equal the materialized check", cached.Active)
+			}
+		})
+	}
+}
+
 func TestTransferSSLSingleCertificateWithID(t *testing.T) {
 	// Test SSL with single certificate and custom ID
 	adcSSL := &adc.SSL{
@@ -1046,7 +2048,7 @@ func TestGenerateSSLID(t *testing.T) {
 		},
 		Certificates: []adc.Certificate{{Certificate: "c", Key: "k"}},
 	}
-	id1 := generateSSLID(ssl1, 0)
+	id1 := generateSSLID(ssl1, 0, &TransferOptions{})
 	if id1 != "custom-id" {
 		t.Errorf("Expected 'custom-id', got '%s'", id1)
 	}
@@ -1058,7 +2060,7 @@ func TestGenerateSSLID(t *testing.T) {
 		},
 		Certificates: []adc.Certificate{{Certificate: "c", Key: "k"}},
 	}
-	id2 := generateSSLID(ssl2, 0)
+	id2 := generateSSLID(ssl2, 0, &TransferOptions{})
 	expectedID2 := sha1Hash("test-ssl")
 	if id2 != expectedID2 {
 		t.Errorf("Expected '%s', got '%s'", expectedID2, id2)
@@ -1074,8 +2076,8 @@ func TestGenerateSSLID(t *testing.T) {
 			{Certificate: "c2", Key: "k2"},
 		},
 	}
-	id3_0 := generateSSLID(ssl3, 0)
-	id3_1 := generateSSLID(ssl3, 1)
+	id3_0 := generateSSLID(ssl3, 0, &TransferOptions{})
+	id3_1 := generateSSLID(ssl3, 1, &TransferOptions{})
 	expectedID3_0 := sha1Hash("multi-ssl.0")
 	expectedID3_1 := sha1Hash("multi-ssl.1")
 	if id3_0 != expectedID3_0 {
@@ -1100,6 +2102,34 @@ func findSubstring(s, substr string) bool {
 	return false
 }
 
+func TestTransferProto(t *testing.T) {
+	labels := map[string]string{label.LabelKind: "ApisixRoute", label.LabelNamespace: "default", label.LabelName: "grpc"}
+	proto, err := TransferProto(&adc.Proto{
+		Metadata: adc.Metadata{ID: "helloworld", Desc: "greeter", Labels: labels},
+		Content:  testProtoContent,
+	})
+	if err != nil {
+		t.Fatalf("TransferProto failed: %v", err)
+	}
+	if proto.ID != "helloworld" || proto.Desc != "greeter" || proto.Content != testProtoContent {
+		t.Errorf("unexpected proto %+v", proto)
+	}
+	if !cmp.Equal(proto.Labels, labels) {
+		t.Errorf("expected labels %v, got %v", labels, proto.Labels)
+	}
+
+	for name, adcProto := range map[string]*adc.Proto{
+		"nil":           nil,
+		"missing id":    {Metadata: adc.Metadata{Name: "helloworld"}, Content: testProtoContent},
+		"empty content": {Metadata: adc.Metadata{ID: "helloworld"}},
+		"invalid id":    {Metadata: adc.Metadata{ID: "hello/world"}, Content: testProtoContent},
+	} {
+		if _, err := TransferProto(adcProto); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
 func TestTransferGlobalRule(t *testing.T) {
 	// Test GlobalRule with multiple plugins
 	adcGlobalRule := adc.GlobalRule{
@@ -1323,3 +2353,265 @@ func TestTransferGlobalRulePluginOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestTransferRejectsInvalidIDs(t *testing.T) {
+	upstream := &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 1}}}
+	services := map[string]*adc.Service{
+		"service": {
+			Metadata: adc.Metadata{ID: "foo/bar", Name: "svc"},
+			Upstream: upstream,
+		},
+		"route": {
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: upstream,
+			Routes:   []*adc.Route{{Metadata: adc.Metadata{ID: "my route"}, Uris: []string{"/"}}},
+		},
+		"upstream": {
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{Metadata: adc.Metadata{ID: "a/b"}, Nodes: upstream.Nodes},
+		},
+	}
+	for name, svc := range services {
+		_, _, _, err := TransferService(svc)
+		var invalid *InvalidIDError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: expected InvalidIDError, got %v", name, err)
+		}
+	}
+
+	_, err := TransferSSL(&adc.SSL{
+		Metadata:     adc.Metadata{ID: "../etc"},
+		Certificates: []adc.Certificate{{Certificate: "cert", Key: "key"}},
+		Snis:         []string{"example.com"},
+	})
+	var invalid *InvalidIDError
+	if !errors.As(err, &invalid) || invalid.ID != "../etc" {
+		t.Errorf("expected InvalidIDError for ssl, got %v", err)
+	}
+}
+
+func TestTransferServiceAnonymousRoutes(t *testing.T) {
+	svc := &adc.Service{
+		Metadata: adc.Metadata{Name: "svc"},
+		Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 1}}},
+		Routes: []*adc.Route{
+			{Uris: []string{"/a"}},
+			{Uris: []string{"/b"}},
+		},
+	}
+	_, _, _, err := TransferService(svc)
+	if err == nil {
+		t.Fatal("expected anonymous routes to fail the transfer")
+	}
+	if !strings.Contains(err.Error(), "service svc") || !strings.Contains(err.Error(), "/a") {
+		t.Errorf("expected the error to name the service and uris, got %v", err)
+	}
+
+	// Named routes get distinct IDs
+	svc.Routes[0].Name, svc.Routes[1].Name = "a", "b"
+	_, routes, _, err := TransferService(svc)
+	if err != nil {
+		t.Fatalf("failed to transfer service: %v", err)
+	}
+	if routes[0].ID == routes[1].ID {
+		t.Errorf("expected distinct route ids, got %s twice", routes[0].ID)
+	}
+}
+
+func TestTransferSSLAnonymous(t *testing.T) {
+	_, err := TransferSSL(&adc.SSL{
+		Certificates: []adc.Certificate{{Certificate: "cert", Key: "key"}},
+		Snis:         []string{"example.com"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "example.com") {
+		t.Errorf("expected an error naming the snis, got %v", err)
+	}
+}
+
+func TestTransferPluginMetadata(t *testing.T) {
+	if _, err := TransferPluginMetadata(adc.PluginMetadata{"http-logger": "not an object"}); err == nil {
+		t.Error("expected an error for a config that is not an object")
+	}
+	if _, err := TransferPluginMetadata(adc.PluginMetadata{"http-logger": map[string]any{"id": "x"}}); err == nil {
+		t.Error("expected an error for a reserved config field")
+	}
+
+	resources, err := TransferResources(&adc.Resources{
+		PluginMetadata: adc.PluginMetadata{"http-logger": "not an object", "syslog": map[string]any{}},
+	}, BestEffort())
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if len(resources.PluginMetadata) != 1 || resources.PluginMetadata[0].ID != "syslog" {
+		t.Errorf("expected only the syslog metadata, got %+v", resources.PluginMetadata)
+	}
+	if len(resources.Warnings) != 1 || resources.Warnings[0].Kind != adc.TypePluginMetadata {
+		t.Errorf("expected a plugin metadata warning, got %+v", resources.Warnings)
+	}
+}
+
+func TestTransferMetadataLimits(t *testing.T) {
+	owner := map[string]string{
+		label.LabelKind:      "Ingress",
+		label.LabelNamespace: "default",
+		// Owner labels are never cut, even past the value limit
+		label.LabelName: strings.Repeat("n", 100),
+	}
+	newService := func(desc string, extraLabels int) *adc.Service {
+		labels := copyLabels(owner)
+		for i := range extraLabels {
+			labels[fmt.Sprintf("extra-%02d", i)] = "value"
+		}
+		return &adc.Service{
+			Metadata: adc.Metadata{Name: "svc", Desc: desc, Labels: labels},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "127.0.0.1", Port: 8080, Weight: 100}}},
+			Routes:   []*adc.Route{{Metadata: adc.Metadata{Name: "route", Desc: "short"}, Uris: []string{"/"}}},
+		}
+	}
+
+	t.Run("long desc", func(t *testing.T) {
+		desc := strings.Repeat("é", 300)
+		result, err := TransferResources(&adc.Resources{Services: []*adc.Service{newService(desc, 0)}})
+		if err != nil {
+			t.Fatalf("failed to transfer resources: %v", err)
+		}
+		if got := result.Services[0].Desc; got != strings.Repeat("é", DefaultMaxDescLength) {
+			t.Errorf("expected the desc to be truncated to %d characters, got %d", DefaultMaxDescLength, len([]rune(got)))
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0].Error(), "desc is longer than 256 characters, truncated") {
+			t.Errorf("expected a truncation warning, got %v", result.Warnings)
+		}
+		if !cmp.Equal(result.Services[0].Labels, owner) {
+			t.Errorf("expected the owner labels to be kept, got %v", result.Services[0].Labels)
+		}
+
+		_, err = TransferResources(&adc.Resources{Services: []*adc.Service{newService(desc, 0)}}, StrictMetadataLimits())
+		if err == nil || !strings.Contains(err.Error(), "metadata exceeds limits") {
+			t.Errorf("expected strict limits to fail the service, got %v", err)
+		}
+	})
+
+	t.Run("too many labels", func(t *testing.T) {
+		limits := LimitMetadata(MetadataLimits{MaxLabels: 5})
+		result, err := TransferResources(&adc.Resources{Services: []*adc.Service{newService("", 4)}}, limits)
+		if err != nil {
+			t.Fatalf("failed to transfer resources: %v", err)
+		}
+		want := copyLabels(owner)
+		want["extra-00"], want["extra-01"] = "value", "value"
+		if !cmp.Equal(result.Services[0].Labels, want) {
+			t.Errorf("expected the owner labels and the first extra labels, got %v", result.Services[0].Labels)
+		}
+		// The inline upstream inherits the limited labels without warning again
+		if !cmp.Equal(result.Services[0].Upstream.Labels, want) || len(result.Warnings) != 2 {
+			t.Errorf("expected 2 dropped label warnings, got %v", result.Warnings)
+		}
+
+		result, err = TransferResources(&adc.Resources{Services: []*adc.Service{newService("", 4)}},
+			limits, StrictMetadataLimits(), BestEffort())
+		if err != nil {
+			t.Fatalf("failed to transfer resources: %v", err)
+		}
+		if len(result.Services) != 0 || len(result.Warnings) != 1 {
+			t.Errorf("expected the service to be skipped, got %+v", result)
+		}
+	})
+}
+
+func TestTransferInheritsOwnerLabels(t *testing.T) {
+	owner := map[string]string{
+		label.LabelKind:      "HTTPRoute",
+		label.LabelNamespace: "default",
+		label.LabelName:      "web",
+	}
+	withTeam := maps.Clone(owner)
+	withTeam["team"] = "a"
+	resources := &adc.Resources{Services: []*adc.Service{{
+		Metadata: adc.Metadata{Name: "svc", Labels: withTeam},
+		Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}}},
+		Upstreams: []*adc.Upstream{{
+			Metadata: adc.Metadata{Name: "canary"},
+			Nodes:    adc.UpstreamNodes{{Host: "10.0.0.2", Port: 80, Weight: 100}},
+		}},
+		Routes: []*adc.Route{
+			{Metadata: adc.Metadata{Name: "bare"}, Uris: []string{"/bare"}},
+			{
+				Metadata: adc.Metadata{Name: "own", Labels: map[string]string{label.LabelName: "other"}},
+				Uris:     []string{"/own"},
+			},
+		},
+	}}}
+
+	transferred, err := TransferResources(resources)
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if labels := transferred.Services[0].Labels; !maps.Equal(labels, withTeam) {
+		t.Errorf("expected the service to keep its labels, got %v", labels)
+	}
+	if labels := transferred.Upstreams[0].Labels; !maps.Equal(labels, withTeam) {
+		t.Errorf("expected the upstream to get the labels of the service, got %v", labels)
+	}
+	routes := make(map[string]map[string]string)
+	for _, route := range transferred.Routes {
+		routes[route.Name] = route.Labels
+	}
+	// Only the owner labels are inherited, labels of the route win
+	if !maps.Equal(routes["bare"], owner) {
+		t.Errorf("expected the bare route to inherit the owner labels, got %v", routes["bare"])
+	}
+	if routes["own"][label.LabelName] != "other" || routes["own"][label.LabelKind] != "HTTPRoute" {
+		t.Errorf("expected the route to keep its own name label, got %v", routes["own"])
+	}
+
+	// The owner labels of the transfer are only stamped on global rules,
+	// services and their children only get the labels of the input
+	resources.Services[0].Labels = nil
+	transferred, err = TransferResources(resources, OwnerLabels(owner))
+	if err != nil {
+		t.Fatalf("failed to transfer resources: %v", err)
+	}
+	if labels := transferred.Services[0].Labels; labels != nil {
+		t.Errorf("expected the service to get no owner labels, got %v", labels)
+	}
+	for _, route := range transferred.Routes {
+		if route.Labels[label.LabelKind] != "" {
+			t.Errorf("expected route %s to get no owner labels, got %v", route.Name, route.Labels)
+		}
+	}
+}
+
+func TestTransferRejectsUnconvertibleValues(t *testing.T) {
+	service := func(mutate func(*adc.Service)) *adc.Service {
+		svc := &adc.Service{
+			Metadata: adc.Metadata{Name: "svc"},
+			Upstream: &adc.Upstream{Nodes: adc.UpstreamNodes{{Host: "10.0.0.1", Port: 80, Weight: 100}}},
+			Routes:   []*adc.Route{{Metadata: adc.Metadata{Name: "route"}, Uris: []string{"/"}}},
+		}
+		mutate(svc)
+		return svc
+	}
+	negative := int64(-1)
+	tests := map[string]*adc.Service{
+		"negative priority":  service(func(s *adc.Service) { s.Routes[0].Priority = &negative }),
+		"route without uris": service(func(s *adc.Service) { s.Routes[0].Uris = nil }),
+		"empty node host":    service(func(s *adc.Service) { s.Upstream.Nodes[0].Host = " " }),
+		"negative node port": service(func(s *adc.Service) { s.Upstream.Nodes[0].Port = -1 }),
+		"node port overflow": service(func(s *adc.Service) { s.Upstream.Nodes[0].Port = 65536 }),
+		"negative weight":    service(func(s *adc.Service) { s.Upstream.Nodes[0].Weight = -5 }),
+	}
+	for name, svc := range tests {
+		if _, _, _, err := TransferService(svc); err == nil {
+			t.Errorf("%s: expected the transfer to fail", name)
+		}
+	}
+
+	_, err := TransferSSL(&adc.SSL{
+		Metadata:     adc.Metadata{Name: "ssl"},
+		Certificates: []adc.Certificate{{Certificate: "cert"}},
+		Snis:         []string{"example.com"},
+	})
+	if err == nil {
+		t.Errorf("expected the transfer of an ssl without key to fail")
+	}
+}
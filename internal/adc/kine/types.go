@@ -1,8 +1,13 @@
 package kine
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
 	"regexp"
+	"strings"
 
 	"github.com/apache/apisix-ingress-controller/api/adc"
 )
@@ -10,6 +15,27 @@ import (
 // NODE_KEY_REGEX for validating node keys
 var NODE_KEY_REGEX = regexp.MustCompile(`^[a-zA-Z0-9\.\-_:]+$`)
 
+// ID_REGEX matches the accepted resource IDs. IDs become a segment of the
+// etcd key of their resource, so they must not contain "/" or spaces.
+var ID_REGEX = regexp.MustCompile(`^[a-zA-Z0-9\.\-_]+$`)
+
+// InvalidIDError is returned for resource IDs outside of ID_REGEX
+type InvalidIDError struct {
+	ID string
+}
+
+func (e *InvalidIDError) Error() string {
+	return fmt.Sprintf("invalid resource id %q: only letters, digits, '.', '-' and '_' are allowed", e.ID)
+}
+
+// ValidateID checks that id only uses the characters of ID_REGEX
+func ValidateID(id string) error {
+	if !ID_REGEX.MatchString(id) {
+		return &InvalidIDError{ID: id}
+	}
+	return nil
+}
+
 // Method represents HTTP methods
 type Method string
 
@@ -23,6 +49,12 @@ const (
 	MethodOPTIONS Method = "OPTIONS"
 )
 
+// Route status values, a disabled route is kept but matches no request
+const (
+	RouteStatusDisabled = 0
+	RouteStatusEnabled  = 1
+)
+
 // SelectionType represents upstream selection algorithms
 type SelectionType string
 
@@ -59,8 +91,17 @@ const (
 	UpstreamSchemeHTTPS UpstreamScheme = "https"
 	UpstreamSchemeGRPC  UpstreamScheme = "grpc"
 	UpstreamSchemeGRPCS UpstreamScheme = "grpcs"
+	UpstreamSchemeTCP   UpstreamScheme = "tcp"
+	UpstreamSchemeTLS   UpstreamScheme = "tls"
+	UpstreamSchemeUDP   UpstreamScheme = "udp"
 )
 
+// IsStream reports whether the scheme is proxied by stream routes rather
+// than HTTP routes
+func (s UpstreamScheme) IsStream() bool {
+	return s == UpstreamSchemeTCP || s == UpstreamSchemeTLS || s == UpstreamSchemeUDP
+}
+
 // UpstreamPassHost represents upstream pass host options
 type UpstreamPassHost string
 
@@ -71,10 +112,11 @@ const (
 )
 
 // Timeout represents timeout configuration
+// Values are in seconds, fractions allow sub-second timeouts.
 type Timeout struct {
-	Connect int `json:"connect,omitempty"`
-	Send    int `json:"send,omitempty"`
-	Read    int `json:"read,omitempty"`
+	Connect float64 `json:"connect,omitempty"`
+	Send    float64 `json:"send,omitempty"`
+	Read    float64 `json:"read,omitempty"`
 }
 
 // Route represents an APISIX route
@@ -92,6 +134,11 @@ type Route struct {
 	UpstreamID *string        `json:"upstream_id,omitempty"`
 	ServiceID  *string        `json:"service_id,omitempty"`
 	Timeout    *Timeout       `json:"timeout,omitempty"`
+	// Status is RouteStatusEnabled when nil
+	Status *int `json:"status,omitempty"`
+	// Vars holds the extra matching conditions of the route, in the
+	// lua-resty-expr format of APISIX
+	Vars adc.Vars `json:"vars,omitempty"`
 }
 
 // Validate validates the Route
@@ -116,9 +163,21 @@ func (r *Route) Validate() error {
 		}
 	}
 
+	if r.Status != nil && *r.Status != RouteStatusDisabled && *r.Status != RouteStatusEnabled {
+		return fmt.Errorf("status must be %d or %d, got %d", RouteStatusDisabled, RouteStatusEnabled, *r.Status)
+	}
+
 	return nil
 }
 
+// GetStatus returns the status with default value
+func (r *Route) GetStatus() int {
+	if r.Status == nil {
+		return RouteStatusEnabled
+	}
+	return *r.Status
+}
+
 // GetHosts returns the hosts for the route
 func (r *Route) GetHosts() []string {
 	if r.Host != nil {
@@ -158,6 +217,13 @@ type Upstream struct {
 	Scheme       UpstreamScheme    `json:"scheme,omitempty"`
 	PassHost     UpstreamPassHost  `json:"pass_host,omitempty"`
 	UpstreamHost *string           `json:"upstream_host,omitempty"`
+	// KeepalivePool configures the connections kept open to the nodes
+	KeepalivePool *KeepalivePool `json:"keepalive_pool,omitempty"`
+	// DNSResolveOnNodes, dns_resolve_on_nodes in JSON, tells the data plane
+	// that the node hosts are domain names, such as those of ExternalName
+	// services, to resolve periodically instead of dialing them as they are.
+	// A resolved node set cannot hold IP literals.
+	DNSResolveOnNodes bool `json:"dns_resolve_on_nodes,omitempty"`
 }
 
 // Validate validates the Upstream
@@ -165,6 +231,9 @@ func (u *Upstream) Validate() error {
 	if len(u.Nodes) == 0 {
 		return fmt.Errorf("nodes cannot be empty")
 	}
+	if !u.hasWeightedNode() {
+		return fmt.Errorf("upstream %s has no node with a weight above 0", u.Name)
+	}
 
 	// Validate node keys
 	for key := range u.Nodes {
@@ -172,7 +241,12 @@ func (u *Upstream) Validate() error {
 			return fmt.Errorf("invalid node key: %s", key)
 		}
 	}
+	if err := u.validateNodeHosts(); err != nil {
+		return err
+	}
 
+	// pass and node derive the Host header from the request or the node,
+	// only rewrite needs an explicit upstream_host
 	if u.PassHost == UpstreamPassHostRewrite && u.UpstreamHost == nil {
 		return fmt.Errorf("upstream_host is required when pass_host is rewrite")
 	}
@@ -189,9 +263,61 @@ func (u *Upstream) Validate() error {
 		}
 	}
 
+	if u.KeepalivePool != nil {
+		if err := u.KeepalivePool.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasWeightedNode reports whether the data plane can pick a node of the
+// upstream: nodes of weight 0 are never picked
+func (u *Upstream) hasWeightedNode() bool {
+	for _, weight := range u.Nodes {
+		if weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDomainNode reports whether a node host of the upstream is a domain name
+func (u *Upstream) hasDomainNode() bool {
+	for key := range u.Nodes {
+		if !isIPNode(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNodeHosts rejects node sets mixing domain names and IP literals,
+// the data plane resolves either all nodes of an upstream or none
+func (u *Upstream) validateNodeHosts() error {
+	if !u.DNSResolveOnNodes {
+		return nil
+	}
+	for key := range u.Nodes {
+		if isIPNode(key) {
+			return fmt.Errorf("upstream %s mixes domain name nodes with IP node %s", u.Name, key)
+		}
+	}
 	return nil
 }
 
+// isIPNode reports whether the host of a "host:port" node key is an IP
+// literal. IPv6 hosts may be bracketed or not.
+func isIPNode(key string) bool {
+	host := key
+	if i := strings.LastIndexByte(key, ':'); i >= 0 {
+		host = key[:i]
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.ParseIP(host) != nil
+}
+
 // GetKey returns the key with default value
 func (u *Upstream) GetKey() string {
 	if u.Key == "" {
@@ -200,7 +326,26 @@ func (u *Upstream) GetKey() string {
 	return u.Key
 }
 
-// HealthCheck represents health check configuration
+// KeepalivePool represents the upstream keepalive connection pool
+type KeepalivePool struct {
+	Size        uint32  `json:"size,omitempty"`
+	IdleTimeout float64 `json:"idle_timeout,omitempty"`
+	Requests    uint32  `json:"requests,omitempty"`
+}
+
+// Validate validates the KeepalivePool
+func (k *KeepalivePool) Validate() error {
+	if k.Size < 1 {
+		return fmt.Errorf("keepalive_pool size must be at least 1")
+	}
+	if k.IdleTimeout < 0 {
+		return fmt.Errorf("keepalive_pool idle_timeout cannot be negative")
+	}
+	return nil
+}
+
+// HealthCheck represents health check configuration. Transferred checks
+// carry the defaults of the getters explicitly.
 type HealthCheck struct {
 	Active *ActiveCheck `json:"active,omitempty"`
 }
@@ -220,7 +365,8 @@ type ActiveCheck struct {
 	HTTPPath               string          `json:"http_path,omitempty"`
 	Host                   *string         `json:"host,omitempty"`
 	Port                   *uint32         `json:"port,omitempty"`
-	HTTPSVerifyCertificate bool            `json:"https_verify_certificate,omitempty"`
+	HTTPSVerifyCertificate *bool           `json:"https_verify_certificate,omitempty"`
+	HTTPSSni               *string         `json:"https_sni,omitempty"`
 	ReqHeaders             []string        `json:"req_headers,omitempty"`
 	Healthy                *Health         `json:"healthy,omitempty"`
 	Unhealthy              *Unhealthy      `json:"unhealthy,omitempty"`
@@ -252,7 +398,10 @@ func (a *ActiveCheck) GetHTTPPath() string {
 
 // GetHTTPSVerifyCertificate returns the HTTPS verify certificate with default value
 func (a *ActiveCheck) GetHTTPSVerifyCertificate() bool {
-	return a.HTTPSVerifyCertificate // default is true in the original code
+	if a.HTTPSVerifyCertificate == nil {
+		return true
+	}
+	return *a.HTTPSVerifyCertificate
 }
 
 // Health represents healthy check configuration
@@ -321,6 +470,8 @@ type Service struct {
 	Upstream   *Upstream      `json:"upstream,omitempty"`
 	UpstreamID *string        `json:"upstream_id,omitempty"`
 	Hosts      []string       `json:"hosts,omitempty"`
+	// EnableWebsocket is false when nil
+	EnableWebsocket *bool `json:"enable_websocket,omitempty"`
 }
 
 // Validate validates the Service
@@ -329,6 +480,10 @@ func (s *Service) Validate() error {
 		return fmt.Errorf("upstream or upstream_id is required")
 	}
 
+	if err := s.validateHosts(); err != nil {
+		return err
+	}
+
 	if s.Upstream != nil {
 		return s.Upstream.Validate()
 	}
@@ -336,10 +491,24 @@ func (s *Service) Validate() error {
 	return nil
 }
 
+// validateHosts checks that each host is a DNS name, optionally with a
+// leading wildcard label
+func (s *Service) validateHosts() error {
+	for _, host := range s.Hosts {
+		if err := validateHost(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GlobalRule represents an APISIX global rule
 type GlobalRule struct {
 	ID      string         `json:"id,omitempty"`
 	Plugins map[string]any `json:"plugins,omitempty"`
+	// Labels identify the owner of the rule, global rules are shared by
+	// every source configuring the same plugin
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // Validate validates the GlobalRule
@@ -370,7 +539,93 @@ func (s *SSL) Validate() error {
 	return nil
 }
 
+// Proto represents an APISIX protobuf definition, referenced by the
+// grpc-transcode plugin of routes
+type Proto struct {
+	adc.Metadata `json:",inline"`
+
+	Content string `json:"content"`
+}
+
+// Validate validates the Proto
+func (p *Proto) Validate() error {
+	if p.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	return nil
+}
+
+// ContentDigest returns the SHA-256 digest of the content, which stands for
+// the content where keeping a copy of it would be wasteful
+func (p *Proto) ContentDigest() string {
+	sum := sha256.Sum256([]byte(p.Content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PluginMetadata represents the APISIX metadata of a plugin, such as the
+// log format of http-logger, shared by every route using the plugin
+type PluginMetadata struct {
+	// ID is the name of the plugin
+	ID     string
+	Config map[string]any
+	// Labels identify the owner of the metadata, plugin metadata is shared
+	// by every source configuring the same plugin
+	Labels map[string]string
+}
+
+// Validate validates the PluginMetadata
+func (m *PluginMetadata) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("plugin name is required")
+	}
+	for _, key := range []string{"id", "labels"} {
+		if _, ok := m.Config[key]; ok {
+			return fmt.Errorf("config field %q is reserved", key)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the metadata the way APISIX stores it, with the
+// config fields next to the id
+func (m PluginMetadata) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]any, len(m.Config)+2)
+	for key, value := range m.Config {
+		obj[key] = value
+	}
+	obj["id"] = m.ID
+	if len(m.Labels) > 0 {
+		obj["labels"] = m.Labels
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON decodes metadata encoded by MarshalJSON
+func (m *PluginMetadata) UnmarshalJSON(data []byte) error {
+	var meta struct {
+		ID     string            `json:"id"`
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	delete(config, "id")
+	delete(config, "labels")
+	m.ID, m.Labels, m.Config = meta.ID, meta.Labels, config
+	return nil
+}
+
 // Validate validates the Timeout
 func (t *Timeout) Validate() error {
+	if t.Connect < 0 || t.Send < 0 || t.Read < 0 {
+		return fmt.Errorf("timeout values cannot be negative: connect=%v send=%v read=%v", t.Connect, t.Send, t.Read)
+	}
+	if t.Connect == 0 && t.Send == 0 && t.Read == 0 {
+		return fmt.Errorf("timeout is set but connect, send and read are all zero, omit it to use the defaults")
+	}
 	return nil
 }
@@ -0,0 +1,62 @@
+package kine
+
+// hasOwnerLabels reports whether an object carries every owner label of
+// KineLabelIndexer, which a full label selector needs to match it
+func hasOwnerLabels(obj any) bool {
+	labels := KineLabelIndexer.GetLabels(obj)
+	for _, key := range KineLabelIndexer.LabelKeys {
+		if _, ok := labels[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// unlabeled keeps the listed objects lacking an owner label
+func unlabeled[T any](objs []*T, err error) ([]any, error) {
+	if err != nil {
+		return nil, err
+	}
+	var kept []any
+	for _, obj := range objs {
+		if !hasOwnerLabels(obj) {
+			kept = append(kept, obj)
+		}
+	}
+	return kept, nil
+}
+
+// listUnlabeled implements ListUnlabeled on the list methods of r
+func listUnlabeled(r ReadTxn, resourceType ResourceType) ([]any, error) {
+	switch resourceType {
+	case ResourceTypeRoute:
+		return unlabeled(r.ListRoutes())
+	case ResourceTypeService:
+		return unlabeled(r.ListServices())
+	case ResourceTypeUpstream:
+		return unlabeled(r.ListUpstreams())
+	case ResourceTypeSSL:
+		return unlabeled(r.ListSSL())
+	case ResourceTypeGlobalRule:
+		return unlabeled(r.ListGlobalRules())
+	case ResourceTypeProto:
+		return unlabeled(r.ListProtos())
+	case ResourceTypePluginMetadata:
+		return unlabeled(r.ListPluginMetadata())
+	default:
+		_, err := tableOf(resourceType)
+		return nil, err
+	}
+}
+
+func (c *dbCache) ListUnlabeled(resourceType ResourceType) ([]any, error) {
+	return c.reader().ListUnlabeled(resourceType)
+}
+
+func (r *dbReader) ListUnlabeled(resourceType ResourceType) ([]any, error) {
+	return listUnlabeled(r, resourceType)
+}
+
+func (r *boltReader) ListUnlabeled(resourceType ResourceType) ([]any, error) {
+	return listUnlabeled(r, resourceType)
+}
@@ -164,9 +164,9 @@ func translateApisixUpstreamRetriesAndTimeout(config *apiv2.ApisixUpstreamConfig
 	sendTimeout := cmp.Or(timeout.Send.Duration, apiv2.DefaultUpstreamTimeout)
 
 	ups.Timeout = &adc.Timeout{
-		Connect: int(connTimeout.Seconds()),
-		Read:    int(readTimeout.Seconds()),
-		Send:    int(sendTimeout.Seconds()),
+		Connect: connTimeout.Seconds(),
+		Read:    readTimeout.Seconds(),
+		Send:    sendTimeout.Seconds(),
 	}
 
 	return nil
@@ -322,9 +322,8 @@ func translateUpstreamActiveHealthCheck(config *apiv2.ActiveHealthCheck) (*adc.U
 	active.HTTPPath = config.HTTPPath
 	active.HTTPRequestHeaders = config.RequestHeaders
 
-	if config.StrictTLS == nil || *config.StrictTLS {
-		active.HTTPSVerifyCert = true
-	}
+	verify := config.StrictTLS == nil || *config.StrictTLS
+	active.HTTPSVerifyCert = &verify
 
 	if config.Healthy != nil {
 		active.Healthy.Successes = config.Healthy.Successes
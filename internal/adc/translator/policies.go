@@ -69,9 +69,9 @@ func (t *Translator) attachBackendTrafficPolicyToUpstream(policy *v1alpha1.Backe
 	}
 	if policy.Spec.Timeout != nil {
 		upstream.Timeout = &adctypes.Timeout{
-			Connect: int(policy.Spec.Timeout.Connect.Seconds()),
-			Read:    int(policy.Spec.Timeout.Read.Seconds()),
-			Send:    int(policy.Spec.Timeout.Send.Seconds()),
+			Connect: policy.Spec.Timeout.Connect.Seconds(),
+			Read:    policy.Spec.Timeout.Read.Seconds(),
+			Send:    policy.Spec.Timeout.Send.Seconds(),
 		}
 	}
 	if policy.Spec.LoadBalancer != nil {
@@ -95,7 +95,7 @@ func New(log logr.Logger, updater status.Updater, readier readiness.ReadinessMan
 }
 
 func (d *apisixProvider) Register(pathPrefix string, mux *http.ServeMux) {
-	d.client.ADCDebugProvider.SetupHandler(pathPrefix, mux)
+	d.client.SetupDebugHandler(pathPrefix, mux)
 }
 
 func (d *apisixProvider) Update(ctx context.Context, tctx *provider.TranslateContext, obj client.Object) error {
@@ -68,6 +68,14 @@ var (
 		},
 		[]string{"operation", "status"},
 	)
+
+	// Kine adapter events merged into a later event of the same resource
+	KineEventsCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "apisix_ingress_kine_events_coalesced_total",
+			Help: "Total number of etcd adapter events coalesced before emission",
+		},
+	)
 )
 
 // init registers all metrics with the global prometheus registry
@@ -79,6 +87,7 @@ func init() {
 		ADCExecutionErrors,
 		StatusUpdateQueueLength,
 		FileIODuration,
+		KineEventsCoalesced,
 	)
 }
 
@@ -112,3 +121,8 @@ func DecStatusQueueLength() {
 func RecordFileIODuration(operation, status string, duration float64) {
 	FileIODuration.WithLabelValues(operation, status).Observe(duration)
 }
+
+// RecordCoalescedEvents records etcd adapter events merged by pacing
+func RecordCoalescedEvents(count int) {
+	KineEventsCoalesced.Add(float64(count))
+}